@@ -41,7 +41,8 @@ Smith-Waterman is better at smaller sequences with local similarities and
 handling sequences with long non-homologous regions. BLAST, on the other hand,
 takes advantage of more heuristic techniques to speed up alignment, and is better
 at finding similar sequences in large database, sacrificing precision for faster
-results.
+results. BandedSemiGlobal sits in between: when you already know roughly where
+a read goes on a much longer sequence, it only aligns around that spot.
 
 Both are "dynamic programming algorithms" which is a fancy 1980's term for they use
 matrices. If you're familiar with kernel operations, linear filters, or whatever term
@@ -290,3 +290,92 @@ func TestSmithWaterman(t *testing.T) {
 		t.Errorf("Alignment is %s, expected G", alignN)
 	}
 }
+
+func TestBandedSemiGlobal(t *testing.T) {
+	mat := [][]int{
+		/*       A C G T */
+		/* A */ {2, -3, -3, -3},
+		/* C */ {-3, 2, -3, -3},
+		/* G */ {-3, -3, 2, -3},
+		/* T */ {-3, -3, -3, 2},
+	}
+	alphabet := alphabet.NewAlphabet([]string{"A", "C", "G", "T"})
+	subMatrix, err := matrix.NewSubstitutionMatrix(alphabet, alphabet, mat)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	scoring := align.AffineScoring{SubstitutionMatrix: subMatrix, GapOpen: -6, GapExtend: -2}
+
+	// the query is missing the A at 16, and the flanks of the reference are
+	// free.
+	reference := "TTTTTTTTTTGATTACAGATTACACCCCCCCCCC"
+	score, start, alignReference, alignQuery, err := align.BandedSemiGlobal(reference, "GATTACGATTACA", 10, 3, scoring)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if score != 20 || start != 10 || alignReference != "GATTACAGATTACA" || alignQuery != "GATTAC-GATTACA" {
+		t.Errorf("score: %d, start: %d, reference: %s, query: %s", score, start, alignReference, alignQuery)
+	}
+
+	// a query placed a few bases off still aligns within the band.
+	_, start, _, alignQuery, err = align.BandedSemiGlobal(reference, "GATTACAGATTACA", 8, 3, scoring)
+	if err != nil || start != 10 || alignQuery != "GATTACAGATTACA" {
+		t.Errorf("start: %d, query: %s, error: %v", start, alignQuery, err)
+	}
+
+	if _, _, _, _, err := align.BandedSemiGlobal(reference, "", 10, 3, scoring); err == nil {
+		t.Errorf("empty query should fail")
+	}
+	if _, _, _, _, err := align.BandedSemiGlobal(reference, "GATTACA", 10, 0, scoring); err == nil {
+		t.Errorf("bandwidth 0 should fail")
+	}
+	for _, diagonal := range []int{100, -100} {
+		if _, _, _, _, err := align.BandedSemiGlobal(reference, "GATTACA", diagonal, 3, scoring); err == nil {
+			t.Errorf("band at %d outside of the reference should fail", diagonal)
+		}
+	}
+}
+
+func TestConservationScores(t *testing.T) {
+	// column 0 is invariant, column 1 is a conservative I/V/L change and
+	// column 2 is all over the place.
+	alignment := []string{
+		"WIK",
+		"WVD",
+		"WLG",
+		"WIP",
+	}
+	for _, method := range []align.ConservationMethod{align.SumOfPairs, align.JensenShannon} {
+		scores, err := align.ConservationScores(alignment, matrix.Blosum62, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(scores[0] > scores[1] && scores[1] > scores[2]) {
+			t.Errorf("method %d: expected decreasing conservation, got %v", method, scores)
+		}
+	}
+
+	// sum of pairs on an invariant column is the matrix's self score.
+	scores, _ := align.ConservationScores([]string{"W", "w", "W"}, matrix.Blosum62, align.SumOfPairs)
+	if scores[0] != 11 {
+		t.Errorf("expected 11, got %f", scores[0])
+	}
+	// nucleotide alignments use a nucleotide background.
+	scores, _ = align.ConservationScores([]string{"AC", "AG", "AT", "AA"}, nil, align.JensenShannon)
+	if scores[0] <= scores[1] || scores[0] > 1 {
+		t.Errorf("expected the invariant column to be more conserved, got %v", scores)
+	}
+
+	if _, err := align.ConservationScores(nil, matrix.Blosum62, align.SumOfPairs); err == nil {
+		t.Errorf("empty alignment should fail")
+	}
+	if _, err := align.ConservationScores([]string{"AC", "A"}, matrix.Blosum62, align.SumOfPairs); err == nil {
+		t.Errorf("ragged alignment should fail")
+	}
+	if _, err := align.ConservationScores([]string{"AC"}, nil, align.SumOfPairs); err == nil {
+		t.Errorf("sum of pairs without a matrix should fail")
+	}
+	if _, err := align.ConservationScores([]string{"AC"}, nil, align.ConservationMethod(7)); err == nil {
+		t.Errorf("unknown method should fail")
+	}
+}
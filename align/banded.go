@@ -0,0 +1,188 @@
+package align
+
+import (
+	"errors"
+	"math"
+
+	"github.com/TimothyStiles/poly/align/matrix"
+)
+
+/******************************************************************************
+
+Banded alignment begins here.
+
+NeedlemanWunsch and SmithWaterman fill in a matrix of every base of one
+sequence against every base of the other. That's fine for two genes, but
+aligning a 1 kb read to a 10 kb plasmid that way fills in ten million cells
+to find an alignment that only ever strays a few bases from one diagonal.
+
+When something else, like shared k-mers, has already said roughly where the
+query goes, BandedSemiGlobal only fills in the cells within a band of that
+diagonal, so an alignment costs O(query length * band) rather than O(query
+length * reference length). It is semi-global: all of the query is aligned,
+but the reference before and after it is free, which is what placing a read
+on a construct needs.
+
+Gaps are affine, so a gap costs more to open than to extend and an indel is
+reported as a single run rather than scattered single base gaps.
+
+******************************************************************************/
+
+// AffineScoring holds the substitution matrix and affine gap penalties of a
+// banded alignment. A gap of length n scores GapOpen + (n-1)*GapExtend.
+type AffineScoring struct {
+	SubstitutionMatrix *matrix.SubstitutionMatrix
+	GapOpen            int
+	GapExtend          int
+}
+
+// BandedSemiGlobal aligns all of query to the part of reference within
+// bandwidth bases of diagonal, the reference position expected to align with
+// the first base of query. Gaps at the ends of the reference are free.
+// Residues are scored with the substitution matrix's Lookup, so residues
+// outside of its alphabets score 0.
+//
+// It returns the score, the reference position the alignment starts at, and
+// the aligned reference and query with gaps as "-". It returns an error if
+// query is empty, bandwidth is less than 1 or the band doesn't overlap
+// reference.
+func BandedSemiGlobal(reference, query string, diagonal, bandwidth int, scoring AffineScoring) (int, int, string, string, error) {
+	if len(query) == 0 {
+		return 0, 0, "", "", errors.New("banded alignment: empty query")
+	}
+	if bandwidth < 1 {
+		return 0, 0, "", "", errors.New("banded alignment: bandwidth must be at least 1")
+	}
+	if scoring.SubstitutionMatrix == nil {
+		scoring.SubstitutionMatrix = matrix.Default
+	}
+	// negativeInfinity is small enough to never win, but far enough from the
+	// minimum int that adding penalties to it can't overflow.
+	const negativeInfinity = math.MinInt32 / 2
+	// alignments end in one of three states: a match or mismatch, an
+	// insertion in the query or a deletion from it.
+	const (
+		matchState = iota
+		insertionState
+		deletionState
+	)
+
+	windowStart := diagonal - bandwidth
+	if windowStart < 0 {
+		windowStart = 0
+	}
+	windowEnd := diagonal + len(query) + bandwidth
+	if windowEnd > len(reference) {
+		windowEnd = len(reference)
+	}
+	if windowEnd < windowStart {
+		// the band is entirely before or after reference, so leave the
+		// window empty and let the fill find no alignment.
+		windowEnd = windowStart
+		if windowStart > len(reference) {
+			windowStart, windowEnd = len(reference), len(reference)
+		}
+	}
+	window := reference[windowStart:windowEnd]
+	offset := diagonal - windowStart
+	width := 2*bandwidth + 1
+
+	// scores[state][i][k] is the best score aligning query[:i] ending at
+	// window column j = i + offset - bandwidth + k in state, and
+	// from[state][i][k] is the state the previous column of that alignment
+	// was in.
+	var scores [3][][]int
+	var from [3][][]byte
+	column := func(i, k int) int { return i + offset - bandwidth + k }
+	cell := func(state, i, j int) int {
+		k := j - (i + offset - bandwidth)
+		if i < 0 || k < 0 || k >= width || j < 0 || j > len(window) {
+			return negativeInfinity
+		}
+		return scores[state][i][k]
+	}
+	best := func(candidates [3]int) (int, byte) {
+		score, state := candidates[0], byte(0)
+		for candidateState, candidate := range candidates {
+			if candidate > score {
+				score, state = candidate, byte(candidateState)
+			}
+		}
+		return score, state
+	}
+	for state := range scores {
+		scores[state] = make([][]int, len(query)+1)
+		from[state] = make([][]byte, len(query)+1)
+	}
+	for i := 0; i <= len(query); i++ {
+		for state := range scores {
+			scores[state][i] = make([]int, width)
+			from[state][i] = make([]byte, width)
+		}
+		for k := 0; k < width; k++ {
+			j := column(i, k)
+			if j < 0 || j > len(window) || i == 0 {
+				for state := range scores {
+					scores[state][i][k] = negativeInfinity
+				}
+				if i == 0 && j >= 0 && j <= len(window) {
+					scores[matchState][i][k] = 0
+				}
+				continue
+			}
+
+			if j > 0 {
+				substitution := scoring.SubstitutionMatrix.Lookup(query[i-1], window[j-1])
+				score, state := best([3]int{cell(matchState, i-1, j-1), cell(insertionState, i-1, j-1), cell(deletionState, i-1, j-1)})
+				scores[matchState][i][k], from[matchState][i][k] = score+substitution, state
+			} else {
+				scores[matchState][i][k] = negativeInfinity
+			}
+
+			score, state := best([3]int{cell(matchState, i-1, j) + scoring.GapOpen, cell(insertionState, i-1, j) + scoring.GapExtend, cell(deletionState, i-1, j) + scoring.GapOpen})
+			scores[insertionState][i][k], from[insertionState][i][k] = score, state
+
+			score, state = best([3]int{cell(matchState, i, j-1) + scoring.GapOpen, cell(insertionState, i, j-1) + scoring.GapOpen, cell(deletionState, i, j-1) + scoring.GapExtend})
+			scores[deletionState][i][k], from[deletionState][i][k] = score, state
+		}
+	}
+
+	bestScore, bestState, bestK := negativeInfinity, 0, -1
+	for k := 0; k < width; k++ {
+		for state := range scores {
+			if scores[state][len(query)][k] > bestScore {
+				bestScore, bestState, bestK = scores[state][len(query)][k], state, k
+			}
+		}
+	}
+	if bestK == -1 {
+		return 0, 0, "", "", errors.New("banded alignment: the band doesn't overlap the reference")
+	}
+
+	var alignReference, alignQuery []byte
+	i, j := len(query), column(len(query), bestK)
+	for state := bestState; i > 0; {
+		k := j - (i + offset - bandwidth)
+		previous := int(from[state][i][k])
+		switch state {
+		case matchState:
+			alignReference = append(alignReference, window[j-1])
+			alignQuery = append(alignQuery, query[i-1])
+			i, j = i-1, j-1
+		case insertionState:
+			alignReference = append(alignReference, '-')
+			alignQuery = append(alignQuery, query[i-1])
+			i--
+		case deletionState:
+			alignReference = append(alignReference, window[j-1])
+			alignQuery = append(alignQuery, '-')
+			j--
+		}
+		state = previous
+	}
+	for left, right := 0, len(alignQuery)-1; left < right; left, right = left+1, right-1 {
+		alignReference[left], alignReference[right] = alignReference[right], alignReference[left]
+		alignQuery[left], alignQuery[right] = alignQuery[right], alignQuery[left]
+	}
+	return bestScore, windowStart + j, string(alignReference), string(alignQuery), nil
+}
@@ -0,0 +1,162 @@
+package align
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/TimothyStiles/poly/align/matrix"
+)
+
+/******************************************************************************
+
+Conservation scoring begins here
+
+Given a multiple sequence alignment (a set of equal length, gapped sequences)
+it's often useful to know how conserved each column is: conserved columns are
+where to put degenerate primers, where to look for active sites, and what to
+color in figures. Two classic scores are provided:
+
+	SumOfPairs: the average substitution matrix score over every pair of
+	sequences in the column. Pairs with a gap score zero, so gappy columns
+	score low. Its scale depends on the matrix.
+
+	JensenShannon: the Jensen-Shannon divergence between the residues in the
+	column and background residue frequencies, scaled by the fraction of
+	non-gap residues, from Capra & Singh 2007
+	(doi:10.1093/bioinformatics/btm270). It ranges from 0 to 1 and needs no
+	matrix.
+
+******************************************************************************/
+
+// ConservationMethod picks how ConservationScores scores columns.
+type ConservationMethod int
+
+const (
+	// SumOfPairs averages substitution matrix scores of every pair of residues in a column.
+	SumOfPairs ConservationMethod = iota
+	// JensenShannon measures how far a column's residues are from background frequencies.
+	JensenShannon
+)
+
+// proteinBackground are the BLOSUM62 background amino acid frequencies used
+// by Capra & Singh.
+var proteinBackground = map[byte]float64{
+	'A': 0.078, 'R': 0.051, 'N': 0.041, 'D': 0.052, 'C': 0.024,
+	'Q': 0.034, 'E': 0.059, 'G': 0.083, 'H': 0.025, 'I': 0.062,
+	'L': 0.092, 'K': 0.056, 'M': 0.024, 'F': 0.044, 'P': 0.043,
+	'S': 0.059, 'T': 0.055, 'W': 0.014, 'Y': 0.034, 'V': 0.072,
+}
+
+// nucleotideBackground is a uniform nucleotide background.
+var nucleotideBackground = map[byte]float64{'A': 0.25, 'C': 0.25, 'G': 0.25, 'T': 0.25}
+
+// ConservationScores scores how conserved each column of alignment is, where
+// alignment is a set of equal length sequences with '-' or '.' for gaps.
+// substitutionMatrix is only used by SumOfPairs and may be nil otherwise.
+// Higher scores are more conserved.
+func ConservationScores(alignment []string, substitutionMatrix *matrix.SubstitutionMatrix, method ConservationMethod) ([]float64, error) {
+	if len(alignment) == 0 {
+		return nil, errors.New("alignment is empty")
+	}
+	length := len(alignment[0])
+	for _, sequence := range alignment {
+		if len(sequence) != length {
+			return nil, errors.New("aligned sequences must all be the same length")
+		}
+	}
+	if method == SumOfPairs && substitutionMatrix == nil {
+		return nil, errors.New("SumOfPairs needs a substitution matrix")
+	}
+
+	background := nucleotideBackground
+	for _, sequence := range alignment {
+		if strings.Trim(strings.ToUpper(sequence), "ACGTUN-.") != "" {
+			background = proteinBackground
+			break
+		}
+	}
+
+	scores := make([]float64, length)
+	column := make([]byte, len(alignment))
+	for position := range scores {
+		for index, sequence := range alignment {
+			column[index] = upper(sequence[position])
+			if column[index] == 'U' {
+				column[index] = 'T'
+			}
+		}
+		switch method {
+		case SumOfPairs:
+			scores[position] = sumOfPairs(column, substitutionMatrix)
+		case JensenShannon:
+			scores[position] = jensenShannon(column, background)
+		default:
+			return nil, errors.New("unknown conservation method")
+		}
+	}
+	return scores, nil
+}
+
+// sumOfPairs returns the average matrix score of every pair in column.
+func sumOfPairs(column []byte, substitutionMatrix *matrix.SubstitutionMatrix) float64 {
+	if len(column) < 2 {
+		if isGap(column[0]) {
+			return 0
+		}
+		return float64(substitutionMatrix.Lookup(column[0], column[0]))
+	}
+	total, pairs := 0, 0
+	for i := range column {
+		for j := i + 1; j < len(column); j++ {
+			pairs++
+			if isGap(column[i]) || isGap(column[j]) {
+				continue
+			}
+			total += substitutionMatrix.Lookup(column[i], column[j])
+		}
+	}
+	return float64(total) / float64(pairs)
+}
+
+// jensenShannon returns the gap weighted Jensen-Shannon divergence of
+// column from background.
+func jensenShannon(column []byte, background map[byte]float64) float64 {
+	const pseudocount = 1e-6
+	counts := map[byte]float64{}
+	residues := 0
+	for _, residue := range column {
+		if _, ok := background[residue]; ok {
+			counts[residue]++
+			residues++
+		}
+	}
+	if residues == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, frequency := range background {
+		total += frequency
+	}
+	denominator := float64(residues) + pseudocount*float64(len(background))
+	divergence := 0.0
+	for residue, frequency := range background {
+		p := (counts[residue] + pseudocount) / denominator
+		q := frequency / total
+		m := (p + q) / 2
+		divergence += 0.5*p*math.Log2(p/m) + 0.5*q*math.Log2(q/m)
+	}
+	return divergence * float64(residues) / float64(len(column))
+}
+
+func isGap(symbol byte) bool {
+	return symbol == '-' || symbol == '.'
+}
+
+func upper(symbol byte) byte {
+	if symbol >= 'a' && symbol <= 'z' {
+		return symbol - 'a' + 'A'
+	}
+	return symbol
+}
@@ -14,6 +14,7 @@ type SubstitutionMatrix struct {
 	FirstAlphabet  *alphabet.Alphabet
 	SecondAlphabet *alphabet.Alphabet
 	scores         [][]int
+	lookup         *[256][256]int // scores of single byte symbols, for Lookup
 }
 
 // NewSubstitutionMatrix creates a new substitution matrix from two alphabets and a 2D array of scores.
@@ -21,7 +22,32 @@ func NewSubstitutionMatrix(firstAlphabet, secondAlphabet *alphabet.Alphabet, sco
 	if len(firstAlphabet.Symbols()) != len(scores) || len(secondAlphabet.Symbols()) != len(scores[0]) {
 		return nil, fmt.Errorf("invalid dimensions of substitution matrix")
 	}
-	return &SubstitutionMatrix{firstAlphabet, secondAlphabet, scores}, nil
+	lookup := new([256][256]int)
+	for firstIndex, first := range firstAlphabet.Symbols() {
+		for secondIndex, second := range secondAlphabet.Symbols() {
+			if len(first) != 1 || len(second) != 1 || secondIndex >= len(scores[firstIndex]) {
+				continue
+			}
+			// symbols are matched case insensitively, so fill in every case.
+			for _, a := range caseVariants(first[0]) {
+				for _, b := range caseVariants(second[0]) {
+					lookup[a][b] = scores[firstIndex][secondIndex]
+				}
+			}
+		}
+	}
+	return &SubstitutionMatrix{firstAlphabet, secondAlphabet, scores, lookup}, nil
+}
+
+// caseVariants returns the upper and lower case versions of a letter.
+func caseVariants(symbol byte) []byte {
+	switch {
+	case symbol >= 'A' && symbol <= 'Z':
+		return []byte{symbol, symbol - 'A' + 'a'}
+	case symbol >= 'a' && symbol <= 'z':
+		return []byte{symbol - 'a' + 'A', symbol}
+	}
+	return []byte{symbol}
 }
 
 // Score returns the score of two symbols in the substitution matrix.
@@ -37,6 +63,13 @@ func (matrix *SubstitutionMatrix) Score(a, b string) (int, error) {
 	return matrix.scores[firstSymbolIndex][secondSymbolIndex], nil
 }
 
+// Lookup returns the score of two single letter symbols, ignoring case.
+// Unlike Score it never fails: symbols outside of the matrix's alphabets
+// score 0. It is the fast path for scoring residues in tight loops.
+func (matrix *SubstitutionMatrix) Lookup(a, b byte) int {
+	return matrix.lookup[a][b]
+}
+
 // Default scoring matrix for ALL sequences. Diagonal values are 1, all other values are -1)
 var (
 	letters = []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z"}
@@ -72,3 +105,17 @@ var (
 	// Default is a generic catchall scoring matrix for both DNA and protein sequences. Matches are 1, mismatches are -1, and gaps are -1.
 	Default, _ = NewSubstitutionMatrix(alphabet.NewAlphabet(letters), alphabet.NewAlphabet(letters), letterMatrix)
 )
+
+// ProteinAlphabet is the alphabet the protein matrices in matrices.go are
+// defined over, with gaps first.
+var ProteinAlphabet = alphabet.NewAlphabet([]string{"-", "A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "P", "Q", "R", "S", "T", "V", "W", "X", "Y", "Z", "*"})
+
+// Commonly used protein substitution matrices, ready to use. BLOSUM62 is the
+// usual default, BLOSUM80 suits closely related proteins, and BLOSUM45 and
+// PAM250 suit distantly related ones.
+var (
+	Blosum45, _ = NewSubstitutionMatrix(ProteinAlphabet, ProteinAlphabet, BLOSUM45)
+	Blosum62, _ = NewSubstitutionMatrix(ProteinAlphabet, ProteinAlphabet, BLOSUM62)
+	Blosum80, _ = NewSubstitutionMatrix(ProteinAlphabet, ProteinAlphabet, BLOSUM80)
+	Pam250, _   = NewSubstitutionMatrix(ProteinAlphabet, ProteinAlphabet, PAM250)
+)
@@ -1,6 +1,7 @@
 package matrix_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/TimothyStiles/poly/align/matrix"
@@ -47,3 +48,51 @@ func TestSubstitutionMatrix(t *testing.T) {
 		}
 	}
 }
+
+func TestBlosum62Lookup(t *testing.T) {
+	// a few entries from the canonical NCBI BLOSUM62 table.
+	testCases := []struct {
+		a, b  byte
+		score int
+	}{
+		{'A', 'A', 4},
+		{'W', 'W', 11},
+		{'C', 'C', 9},
+		{'A', 'R', -1},
+		{'R', 'A', -1},
+		{'E', 'Q', 2},
+		{'I', 'V', 3},
+		{'Y', 'F', 3},
+		{'W', 'P', -4},
+		{'*', '*', 1},
+		{'d', 'e', 2},
+		{'A', '?', 0},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.score, matrix.Blosum62.Lookup(tc.a, tc.b), "%c%c", tc.a, tc.b)
+	}
+	assert.Equal(t, 17, matrix.Pam250.Lookup('W', 'W'))
+	assert.Equal(t, 15, matrix.Blosum45.Lookup('W', 'W'))
+	assert.Equal(t, 16, matrix.Blosum80.Lookup('W', 'W'))
+}
+
+func TestReadNCBI(t *testing.T) {
+	blosum62, err := matrix.ReadNCBI("data/BLOSUM62")
+	assert.Nil(t, err)
+	symbols := "ARNDCQEGHILKMFPSTWYVBZX*"
+	for i := 0; i < len(symbols); i++ {
+		for j := 0; j < len(symbols); j++ {
+			assert.Equal(t, matrix.Blosum62.Lookup(symbols[i], symbols[j]), blosum62.Lookup(symbols[i], symbols[j]), "%c%c", symbols[i], symbols[j])
+		}
+	}
+	score, err := blosum62.Score("W", "Y")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, score)
+
+	_, err = matrix.ReadNCBI("data/does_not_exist")
+	assert.NotNil(t, err)
+	for _, bad := range []string{"", "# only comments\n", "   A  R\nA  4 -1\nR -1\n", "   A\nA  x\n"} {
+		_, err = matrix.ParseNCBI(strings.NewReader(bad))
+		assert.NotNil(t, err, bad)
+	}
+}
@@ -0,0 +1,78 @@
+package matrix
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TimothyStiles/poly/alphabet"
+)
+
+/******************************************************************************
+
+NCBI matrix parsing begins here
+
+NCBI distributes substitution matrices (ftp://ftp.ncbi.nih.gov/blast/matrices)
+as plain text: '#' comment lines, a header line of column symbols, then one
+line per row starting with the row symbol. For example:
+
+	#  BLOSUM Clustered Scoring Matrix in 1/2 Bit Units
+	   A  R  N  D
+	A  4 -1 -2 -2
+	R -1  5  0 -2
+	...
+
+******************************************************************************/
+
+// ParseNCBI parses a substitution matrix in the NCBI text format.
+func ParseNCBI(r io.Reader) (*SubstitutionMatrix, error) {
+	scanner := bufio.NewScanner(r)
+	var columns, rows []string
+	var scores [][]int
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if columns == nil {
+			columns = fields
+			continue
+		}
+		if len(fields) != len(columns)+1 {
+			return nil, fmt.Errorf("line %d: expected a symbol and %d scores, got %d fields", lineNumber, len(columns), len(fields))
+		}
+		row := make([]int, len(columns))
+		for index, field := range fields[1:] {
+			score, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			row[index] = score
+		}
+		rows = append(rows, fields[0])
+		scores = append(scores, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no matrix found")
+	}
+	return NewSubstitutionMatrix(alphabet.NewAlphabet(rows), alphabet.NewAlphabet(columns), scores)
+}
+
+// ReadNCBI reads a substitution matrix in the NCBI text format from path.
+func ReadNCBI(path string) (*SubstitutionMatrix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseNCBI(file)
+}
@@ -0,0 +1,128 @@
+/*
+Package bio has utilities that work on records of any format.
+
+Every format in poly has its own record type (fasta.Fasta, fastq.Fastq,
+slow5.Read, ...) and its own writer, so the functions here are generic over
+the record type and take the format's writer as an argument.
+*/
+package bio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/******************************************************************************
+
+Stream splitting begins here
+
+A common chore is splitting one stream of records into several files: long
+reads and short reads, features by type, reads by barcode. Split does this for
+any record type, given routes deciding where each record goes and a function
+opening a writer for each route.
+
+Routes are checked in order and a record goes to the first route it matches,
+so overlapping routes are fine and the earlier one wins. Records matching no
+route go to the Unmatched route. Writers are only opened once a route gets its
+first record, so routes nothing matches never create empty files.
+
+******************************************************************************/
+
+// Unmatched is the name of the route for records that match no other route.
+const Unmatched = "unmatched"
+
+// Route is a named destination for records that Match returns true for.
+type Route[T any] struct {
+	Name  string
+	Match func(record T) bool
+}
+
+// Format writes a single record to w.
+type Format[T any] func(w io.Writer, record T) error
+
+// FormatFromBuild makes a Format from a Build function like fasta.Build or
+// fastq.Build. Every record is ended with a newline.
+func FormatFromBuild[T any](build func(records []T) ([]byte, error)) Format[T] {
+	return func(w io.Writer, record T) error {
+		recordBytes, err := build([]T{record})
+		if err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(recordBytes, []byte{'\n'}) {
+			recordBytes = append(recordBytes, '\n')
+		}
+		_, err = w.Write(recordBytes)
+		return err
+	}
+}
+
+// Split writes every record from records to the first route that matches
+// it, or to the Unmatched route if none do, using format. writerFor opens the
+// writer of a route the first time the route gets a record, and every writer
+// opened is closed before Split returns.
+//
+// Split returns how many records were written to each route. On an error,
+// like writerFor or a write failing, Split stops writing but keeps draining
+// records so whoever is sending them isn't blocked forever, then returns the
+// counts so far along with the error.
+func Split[T any](records <-chan T, routes []Route[T], writerFor func(routeName string) (io.WriteCloser, error), format Format[T]) (counts map[string]int, err error) {
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.Name == Unmatched {
+			return nil, fmt.Errorf("route name %q is reserved for records matching no route", Unmatched)
+		}
+		if seen[route.Name] {
+			return nil, fmt.Errorf("route %q is given more than once", route.Name)
+		}
+		if route.Match == nil {
+			return nil, fmt.Errorf("route %q has no Match function", route.Name)
+		}
+		seen[route.Name] = true
+	}
+
+	counts = make(map[string]int)
+	writers := make(map[string]io.WriteCloser)
+	var openOrder []string
+	defer func() {
+		for _, name := range openOrder {
+			if closeErr := writers[name].Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed to close route %s: %w", name, closeErr)
+			}
+		}
+	}()
+
+	for record := range records {
+		if err != nil {
+			continue // drain
+		}
+		name := Unmatched
+		for _, route := range routes {
+			if route.Match(record) {
+				name = route.Name
+				break
+			}
+		}
+		writer, ok := writers[name]
+		if !ok {
+			writer, err = writerFor(name)
+			if err != nil {
+				err = fmt.Errorf("failed to open route %s: %w", name, err)
+				continue
+			}
+			if writer == nil {
+				err = errors.New("writerFor returned a nil writer for route " + name)
+				continue
+			}
+			writers[name] = writer
+			openOrder = append(openOrder, name)
+		}
+		if err = format(writer, record); err != nil {
+			err = fmt.Errorf("failed to write record %d of route %s: %w", counts[name]+1, name, err)
+			continue
+		}
+		counts[name]++
+	}
+	return counts, err
+}
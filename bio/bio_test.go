@@ -0,0 +1,223 @@
+package bio_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/io/fasta"
+)
+
+// memoryWriter is an in-memory io.WriteCloser.
+type memoryWriter struct {
+	bytes.Buffer
+	closed   bool
+	closeErr error
+	writeErr error
+}
+
+func (writer *memoryWriter) Write(p []byte) (int, error) {
+	if writer.writeErr != nil {
+		return 0, writer.writeErr
+	}
+	return writer.Buffer.Write(p)
+}
+
+func (writer *memoryWriter) Close() error {
+	writer.closed = true
+	return writer.closeErr
+}
+
+// memoryFactory opens memoryWriters, failing for routes in failOpen.
+type memoryFactory struct {
+	writers  map[string]*memoryWriter
+	failOpen map[string]bool
+	opened   []string
+}
+
+func newMemoryFactory() *memoryFactory {
+	return &memoryFactory{writers: make(map[string]*memoryWriter), failOpen: make(map[string]bool)}
+}
+
+func (factory *memoryFactory) open(routeName string) (io.WriteCloser, error) {
+	factory.opened = append(factory.opened, routeName)
+	if factory.failOpen[routeName] {
+		return nil, errors.New("no space left on device")
+	}
+	writer, ok := factory.writers[routeName]
+	if !ok {
+		writer = &memoryWriter{}
+		factory.writers[routeName] = writer
+	}
+	return writer, nil
+}
+
+func sendFastas(fastas []fasta.Fasta) <-chan fasta.Fasta {
+	records := make(chan fasta.Fasta)
+	go func() {
+		for _, record := range fastas {
+			records <- record
+		}
+		close(records)
+	}()
+	return records
+}
+
+var splitFastas = []fasta.Fasta{
+	{Name: "long1", Sequence: "ATGCATGCATGC"},
+	{Name: "short1", Sequence: "ATG"},
+	{Name: "bc01_read", Sequence: "GGGGGGGG"},
+	{Name: "long2", Sequence: "TTTTTTTTTTTTTT"},
+	{Name: "bc01_short", Sequence: "CC"},
+}
+
+var splitRoutes = []bio.Route[fasta.Fasta]{
+	{Name: "barcode01", Match: func(record fasta.Fasta) bool { return strings.HasPrefix(record.Name, "bc01") }},
+	{Name: "long", Match: func(record fasta.Fasta) bool { return len(record.Sequence) >= 10 }},
+}
+
+func TestSplit(t *testing.T) {
+	factory := newMemoryFactory()
+	counts, err := bio.Split(sendFastas(splitFastas), splitRoutes, factory.open, bio.FormatFromBuild(fasta.Build))
+	if err != nil {
+		t.Fatalf("Split failed: %s", err)
+	}
+	expectedCounts := map[string]int{"barcode01": 2, "long": 2, bio.Unmatched: 1}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("expected counts %v, got %v", expectedCounts, counts)
+	}
+	// writers are opened lazily, in the order routes get their first record.
+	if expectedOpened := []string{"long", bio.Unmatched, "barcode01"}; !reflect.DeepEqual(factory.opened, expectedOpened) {
+		t.Errorf("expected writers opened in order %v, got %v", expectedOpened, factory.opened)
+	}
+
+	// bc01_short would be unmatched without the barcode route, and bc01_read
+	// isn't long, so both show the barcode route winning.
+	expected := map[string]string{
+		"barcode01":   ">bc01_read\nGGGGGGGG\n>bc01_short\nCC\n",
+		"long":        ">long1\nATGCATGCATGC\n>long2\nTTTTTTTTTTTTTT\n",
+		bio.Unmatched: ">short1\nATG\n",
+	}
+	for name, writer := range factory.writers {
+		if !writer.closed {
+			t.Errorf("writer of route %s was not closed", name)
+		}
+		if writer.String() != expected[name] {
+			t.Errorf("route %s: expected %q, got %q", name, expected[name], writer.String())
+		}
+		parsed, err := fasta.Parse(strings.NewReader(writer.String()))
+		if err != nil || len(parsed) != counts[name] {
+			t.Errorf("route %s: expected %d parsable records, got %d (%v)", name, counts[name], len(parsed), err)
+		}
+	}
+}
+
+func TestSplitOverlappingRoutes(t *testing.T) {
+	// the first route in order wins, whichever order they overlap in.
+	everything := func(fasta.Fasta) bool { return true }
+	for _, routes := range [][]bio.Route[fasta.Fasta]{
+		{{Name: "a", Match: everything}, {Name: "b", Match: everything}},
+		{{Name: "b", Match: everything}, {Name: "a", Match: everything}},
+	} {
+		factory := newMemoryFactory()
+		counts, err := bio.Split(sendFastas(splitFastas), routes, factory.open, bio.FormatFromBuild(fasta.Build))
+		if err != nil {
+			t.Fatalf("Split failed: %s", err)
+		}
+		if expected := map[string]int{routes[0].Name: len(splitFastas)}; !reflect.DeepEqual(counts, expected) {
+			t.Errorf("expected counts %v, got %v", expected, counts)
+		}
+	}
+}
+
+func TestSplitNoRecords(t *testing.T) {
+	factory := newMemoryFactory()
+	counts, err := bio.Split(sendFastas(nil), splitRoutes, factory.open, bio.FormatFromBuild(fasta.Build))
+	if err != nil {
+		t.Fatalf("Split failed: %s", err)
+	}
+	if len(counts) != 0 || len(factory.opened) != 0 {
+		t.Errorf("expected no counts and no writers, got %v and %v", counts, factory.opened)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	format := bio.FormatFromBuild(fasta.Build)
+
+	// a failed open stops writing, but closes what was opened and drains the
+	// channel so the sender finishes.
+	factory := newMemoryFactory()
+	factory.failOpen[bio.Unmatched] = true
+	counts, err := bio.Split(sendFastas(splitFastas), splitRoutes, factory.open, format)
+	if err == nil {
+		t.Fatal("expected an error opening the unmatched route")
+	}
+	if expected := map[string]int{"long": 1}; !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected counts %v, got %v", expected, counts)
+	}
+	if !factory.writers["long"].closed {
+		t.Error("writer of route long was not closed after an error")
+	}
+	if len(factory.opened) != 2 {
+		t.Errorf("expected no writers opened after the error, got %v", factory.opened)
+	}
+
+	// write and close errors.
+	factory = newMemoryFactory()
+	factory.writers["long"] = &memoryWriter{writeErr: errors.New("disk full")}
+	if _, err = bio.Split(sendFastas(splitFastas), splitRoutes, factory.open, format); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("expected a write error, got %v", err)
+	}
+	factory = newMemoryFactory()
+	factory.writers["barcode01"] = &memoryWriter{closeErr: errors.New("stale file handle")}
+	if _, err = bio.Split(sendFastas(splitFastas), splitRoutes, factory.open, format); err == nil || !strings.Contains(err.Error(), "stale file handle") {
+		t.Errorf("expected a close error, got %v", err)
+	}
+
+	// bad routes.
+	nilWriter := func(string) (io.WriteCloser, error) { return nil, nil }
+	if _, err = bio.Split(sendFastas(splitFastas), nil, nilWriter, format); err == nil {
+		t.Error("expected an error for a nil writer")
+	}
+	match := func(fasta.Fasta) bool { return true }
+	for _, routes := range [][]bio.Route[fasta.Fasta]{
+		{{Name: bio.Unmatched, Match: match}},
+		{{Name: "a", Match: match}, {Name: "a", Match: match}},
+		{{Name: "a"}},
+	} {
+		if _, err = bio.Split(make(chan fasta.Fasta), routes, factory.open, format); err == nil {
+			t.Errorf("expected an error for routes %v", routes)
+		}
+	}
+}
+
+func ExampleSplit() {
+	records := make(chan fasta.Fasta, 3)
+	records <- fasta.Fasta{Name: "plasmid", Sequence: "ATGCATGCATGCATGC"}
+	records <- fasta.Fasta{Name: "primer", Sequence: "ATGCA"}
+	records <- fasta.Fasta{Name: "oligo", Sequence: "GGCC"}
+	close(records)
+
+	routes := []bio.Route[fasta.Fasta]{
+		{Name: "short", Match: func(record fasta.Fasta) bool { return len(record.Sequence) < 10 }},
+	}
+	outputs := make(map[string]*memoryWriter)
+	writerFor := func(routeName string) (io.WriteCloser, error) {
+		outputs[routeName] = &memoryWriter{}
+		return outputs[routeName], nil
+	}
+	counts, _ := bio.Split(records, routes, writerFor, bio.FormatFromBuild(fasta.Build))
+	fmt.Println(counts["short"], counts[bio.Unmatched])
+	fmt.Print(outputs["short"].String())
+	// Output:
+	// 2 1
+	// >primer
+	// ATGCA
+	// >oligo
+	// GGCC
+}
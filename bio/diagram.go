@@ -0,0 +1,187 @@
+package bio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+
+Diagram export begins here
+
+Assembly plans are easier to review as a picture than as a pile of structs:
+which fragments go together, which primers make them, and what joins them.
+A Diagram is a small graph of those pieces that can be written as Graphviz
+DOT or as a Mermaid flowchart, ready to paste into docs or a PR.
+
+Nodes are written sorted by kind and then by ID, and edges by the nodes they
+join, so the same plan always gives the same text and diffs of a diagram only
+show real changes. Node IDs are replaced by generated ones, so IDs can be any
+string, and labels are escaped for each format.
+
+******************************************************************************/
+
+// DiagramNodeKind is what a node in a Diagram stands for. It sets the node's
+// shape.
+type DiagramNodeKind string
+
+// The kinds of nodes in an assembly diagram, in the order they are written.
+const (
+	FragmentNode  DiagramNodeKind = "fragment"
+	PrimerNode    DiagramNodeKind = "primer"
+	JunctionNode  DiagramNodeKind = "junction"
+	ConstructNode DiagramNodeKind = "construct"
+)
+
+// diagramNodeKinds are the known node kinds in the order they are written.
+var diagramNodeKinds = []DiagramNodeKind{FragmentNode, PrimerNode, JunctionNode, ConstructNode}
+
+// DiagramNode is a fragment, primer, junction or construct in a Diagram.
+type DiagramNode struct {
+	ID    string // ID identifies the node in edges. It can be any string.
+	Kind  DiagramNodeKind
+	Label string // Label is the text of the node. It may have newlines.
+}
+
+// DiagramEdge joins two nodes of a Diagram, like two fragments sharing an
+// overhang.
+type DiagramEdge struct {
+	From, To string // From and To are node IDs.
+	Label    string // Label is the text of the edge, like an overhang or homology length.
+}
+
+// Diagram is a graph of the pieces of an assembly plan.
+type Diagram struct {
+	Title string
+	Nodes []DiagramNode
+	Edges []DiagramEdge
+}
+
+// DOT returns the diagram as a Graphviz DOT digraph. It returns an error if
+// two nodes have the same ID or an edge joins a node that doesn't exist.
+func (diagram Diagram) DOT() (string, error) {
+	nodes, edges, ids, err := diagram.sorted()
+	if err != nil {
+		return "", err
+	}
+	shapes := map[DiagramNodeKind]string{FragmentNode: "box", PrimerNode: "parallelogram", JunctionNode: "diamond", ConstructNode: "doubleoctagon"}
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "digraph %s {\n", dotQuote(diagram.Title))
+	builder.WriteString("\trankdir=LR;\n")
+	for _, node := range nodes {
+		shape, ok := shapes[node.Kind]
+		if !ok {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&builder, "\t%s [label=%s, shape=%s];\n", ids[node.ID], dotQuote(node.Label), shape)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&builder, "\t%s -> %s", ids[edge.From], ids[edge.To])
+		if edge.Label != "" {
+			fmt.Fprintf(&builder, " [label=%s]", dotQuote(edge.Label))
+		}
+		builder.WriteString(";\n")
+	}
+	builder.WriteString("}\n")
+	return builder.String(), nil
+}
+
+// Mermaid returns the diagram as a Mermaid flowchart. It returns an error if
+// two nodes have the same ID or an edge joins a node that doesn't exist.
+func (diagram Diagram) Mermaid() (string, error) {
+	nodes, edges, ids, err := diagram.sorted()
+	if err != nil {
+		return "", err
+	}
+	shapes := map[DiagramNodeKind][2]string{FragmentNode: {"[", "]"}, PrimerNode: {"[/", "/]"}, JunctionNode: {"{", "}"}, ConstructNode: {"((", "))"}}
+	var builder strings.Builder
+	if diagram.Title != "" {
+		fmt.Fprintf(&builder, "---\ntitle: %s\n---\n", mermaidQuote(diagram.Title))
+	}
+	builder.WriteString("flowchart LR\n")
+	for _, node := range nodes {
+		shape, ok := shapes[node.Kind]
+		if !ok {
+			shape = [2]string{"(", ")"}
+		}
+		fmt.Fprintf(&builder, "\t%s%s%s%s\n", ids[node.ID], shape[0], mermaidQuote(node.Label), shape[1])
+	}
+	for _, edge := range edges {
+		if edge.Label == "" {
+			fmt.Fprintf(&builder, "\t%s --> %s\n", ids[edge.From], ids[edge.To])
+		} else {
+			fmt.Fprintf(&builder, "\t%s -->|%s| %s\n", ids[edge.From], mermaidQuote(edge.Label), ids[edge.To])
+		}
+	}
+	return builder.String(), nil
+}
+
+// sorted returns the nodes and edges of the diagram in the order they are
+// written, and the generated ID of every node.
+func (diagram Diagram) sorted() ([]DiagramNode, []DiagramEdge, map[string]string, error) {
+	kindOrder := make(map[DiagramNodeKind]int)
+	for index, kind := range diagramNodeKinds {
+		kindOrder[kind] = index + 1
+	}
+	nodes := append([]DiagramNode{}, diagram.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		// unknown kinds go last, sorted by name.
+		first, second := kindOrder[nodes[i].Kind], kindOrder[nodes[j].Kind]
+		if first == 0 {
+			first = len(diagramNodeKinds) + 1
+		}
+		if second == 0 {
+			second = len(diagramNodeKinds) + 1
+		}
+		if first != second {
+			return first < second
+		}
+		if nodes[i].Kind != nodes[j].Kind {
+			return nodes[i].Kind < nodes[j].Kind
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	ids := make(map[string]string)
+	order := make(map[string]int)
+	for index, node := range nodes {
+		if _, ok := ids[node.ID]; ok {
+			return nil, nil, nil, fmt.Errorf("two nodes have ID %q", node.ID)
+		}
+		ids[node.ID] = fmt.Sprintf("n%d", index+1)
+		order[node.ID] = index
+	}
+
+	edges := append([]DiagramEdge{}, diagram.Edges...)
+	for _, edge := range edges {
+		for _, id := range []string{edge.From, edge.To} {
+			if _, ok := ids[id]; !ok {
+				return nil, nil, nil, fmt.Errorf("edge %q -> %q joins node %q, which isn't in the diagram", edge.From, edge.To, id)
+			}
+		}
+	}
+	sort.SliceStable(edges, func(i, j int) bool {
+		if order[edges[i].From] != order[edges[j].From] {
+			return order[edges[i].From] < order[edges[j].From]
+		}
+		if order[edges[i].To] != order[edges[j].To] {
+			return order[edges[i].To] < order[edges[j].To]
+		}
+		return edges[i].Label < edges[j].Label
+	})
+	return nodes, edges, ids, nil
+}
+
+// dotQuote returns text as a quoted DOT string.
+func dotQuote(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", `\n`)
+	return `"` + replacer.Replace(text) + `"`
+}
+
+// mermaidQuote returns text as a quoted Mermaid string. Characters that end
+// or format a Mermaid string are written as entity codes.
+func mermaidQuote(text string) string {
+	replacer := strings.NewReplacer("#", "#35;", `"`, "#quot;", "<", "#lt;", ">", "#gt;", "\r", "", "\n", "<br/>")
+	return `"` + replacer.Replace(text) + `"`
+}
@@ -0,0 +1,86 @@
+package bio_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/bio"
+)
+
+// gibsonPlan is a diagram of a 3 fragment Gibson assembly, with the primers
+// adding homology to each fragment. Nodes and edges are out of order on
+// purpose.
+var gibsonPlan = bio.Diagram{
+	Title: "pGFP Gibson assembly",
+	Nodes: []bio.DiagramNode{
+		{ID: "pGFP", Kind: bio.ConstructNode, Label: "pGFP\n5,212 bp, circular"},
+		{ID: "vector", Kind: bio.FragmentNode, Label: "pUC19 backbone\n2,617 bp"},
+		{ID: "gfp", Kind: bio.FragmentNode, Label: "GFP\n717 bp"},
+		{ID: "promoter", Kind: bio.FragmentNode, Label: "J23100 \"strong\" promoter\n1,878 bp"},
+		{ID: "oGFP_F", Kind: bio.PrimerNode, Label: "oGFP_F"},
+		{ID: "oGFP_R", Kind: bio.PrimerNode, Label: "oGFP_R"},
+		{ID: "oProm_F", Kind: bio.PrimerNode, Label: "oProm_F"},
+		{ID: "oProm_R", Kind: bio.PrimerNode, Label: "oProm_R <5' tail>"},
+	},
+	Edges: []bio.DiagramEdge{
+		{From: "gfp", To: "vector", Label: "30 bp homology"},
+		{From: "vector", To: "promoter", Label: "30 bp homology"},
+		{From: "promoter", To: "gfp", Label: "25 bp homology"},
+		{From: "oGFP_F", To: "gfp"},
+		{From: "oGFP_R", To: "gfp"},
+		{From: "oProm_F", To: "promoter"},
+		{From: "oProm_R", To: "promoter"},
+		{From: "vector", To: "pGFP"},
+		{From: "gfp", To: "pGFP"},
+		{From: "promoter", To: "pGFP"},
+	},
+}
+
+// checkGolden compares got to the contents of the golden file at path.
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %s", err)
+	}
+	if got != string(expected) {
+		t.Errorf("output differs from %s, got:\n%s", path, got)
+	}
+}
+
+func TestDiagramGibson(t *testing.T) {
+	dot, err := gibsonPlan.DOT()
+	if err != nil {
+		t.Fatalf("DOT failed: %s", err)
+	}
+	checkGolden(t, "data/gibson.dot", dot)
+	mermaid, err := gibsonPlan.Mermaid()
+	if err != nil {
+		t.Fatalf("Mermaid failed: %s", err)
+	}
+	checkGolden(t, "data/gibson.mmd", mermaid)
+
+	// the order nodes and edges are given in doesn't change the output.
+	reversed := bio.Diagram{Title: gibsonPlan.Title}
+	for index := len(gibsonPlan.Nodes) - 1; index >= 0; index-- {
+		reversed.Nodes = append(reversed.Nodes, gibsonPlan.Nodes[index])
+	}
+	for index := len(gibsonPlan.Edges) - 1; index >= 0; index-- {
+		reversed.Edges = append(reversed.Edges, gibsonPlan.Edges[index])
+	}
+	if reversedDot, _ := reversed.DOT(); reversedDot != dot {
+		t.Errorf("expected the same DOT for nodes and edges in another order, got:\n%s", reversedDot)
+	}
+}
+
+func TestDiagramErrors(t *testing.T) {
+	duplicate := bio.Diagram{Nodes: []bio.DiagramNode{{ID: "a"}, {ID: "a"}}}
+	if _, err := duplicate.DOT(); err == nil {
+		t.Error("expected an error for duplicate node IDs")
+	}
+	dangling := bio.Diagram{Nodes: []bio.DiagramNode{{ID: "a"}}, Edges: []bio.DiagramEdge{{From: "a", To: "b"}}}
+	if _, err := dangling.Mermaid(); err == nil || !strings.Contains(err.Error(), `"b"`) {
+		t.Errorf("expected an error for an edge to a missing node, got %v", err)
+	}
+}
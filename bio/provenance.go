@@ -0,0 +1,128 @@
+package bio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/******************************************************************************
+
+Provenance begins here
+
+A sequence that has been edited a few times is hard to audit: the file says
+what the sequence is, not where it came from. A provenance chain records
+that, as one Provenance per derivation, oldest first: "derived from seqhash
+X by edits Y, with tool Z, at time T".
+
+Each entry holds the seqhash of the sequence it was derived from and the
+seqhash of the result, so a chain can be checked without the intermediate
+sequences: every entry's Parent is the Hash of the one before it, and the
+last Hash is the seqhash of the record carrying the chain.
+
+Records that can carry a chain implement Traceable. GenBank writes each
+entry as a structured COMMENT block and polyjson as a list in its metadata,
+and both parse them back, so a chain survives converting a record from one
+format to the other as long as the Provenance field is copied across.
+
+******************************************************************************/
+
+// Provenance is one derivation in a record's provenance chain.
+type Provenance struct {
+	Parent      string    `json:"parent"`       // Parent is the seqhash of the sequence the record was derived from.
+	Hash        string    `json:"hash"`         // Hash is the seqhash of the record after the edits.
+	Tool        string    `json:"tool"`         // Tool is the name of the tool that made the edits.
+	ToolVersion string    `json:"tool_version"` // ToolVersion is the version of Tool.
+	Timestamp   time.Time `json:"timestamp"`    // Timestamp is when the edits were made.
+	EditLog     string    `json:"edit_log"`     // EditLog describes or references the edits, like the path of a log of them.
+	Note        string    `json:"note"`         // Note is free-form text.
+}
+
+// Traceable is a record that can carry a provenance chain, like a
+// genbank.Genbank or a polyjson.Poly. Methods that change the record are on
+// its pointer.
+type Traceable interface {
+	// Seqhash returns the seqhash of the record's sequence.
+	Seqhash() (string, error)
+	// Provenance returns the record's provenance chain, oldest first.
+	Provenance() []Provenance
+	// SetProvenance replaces the record's provenance chain.
+	SetProvenance(chain []Provenance)
+}
+
+// ProvenanceOption sets an optional field of a Provenance made by
+// WithProvenance.
+type ProvenanceOption func(*Provenance)
+
+// ProvenanceTool sets the name and version of the tool that made the edits.
+func ProvenanceTool(name, version string) ProvenanceOption {
+	return func(provenance *Provenance) {
+		provenance.Tool, provenance.ToolVersion = name, version
+	}
+}
+
+// ProvenanceNote sets the free-form note.
+func ProvenanceNote(note string) ProvenanceOption {
+	return func(provenance *Provenance) {
+		provenance.Note = note
+	}
+}
+
+// ProvenanceTimestamp sets when the edits were made, instead of now.
+func ProvenanceTimestamp(timestamp time.Time) ProvenanceOption {
+	return func(provenance *Provenance) {
+		provenance.Timestamp = timestamp
+	}
+}
+
+// WithProvenance records that record was derived from parent by the edits
+// described by editLog. It sets record's provenance chain to parent's chain
+// followed by a new entry with the seqhashes of both, and returns the new
+// entry. It returns an error if parent's chain doesn't verify, since
+// extending a broken chain would hide where it broke.
+func WithProvenance(record, parent Traceable, editLog string, options ...ProvenanceOption) (Provenance, error) {
+	if err := VerifyProvenance(parent); err != nil {
+		return Provenance{}, fmt.Errorf("parent's provenance: %w", err)
+	}
+	parentHash, err := parent.Seqhash()
+	if err != nil {
+		return Provenance{}, fmt.Errorf("failed to hash parent: %w", err)
+	}
+	hash, err := record.Seqhash()
+	if err != nil {
+		return Provenance{}, fmt.Errorf("failed to hash record: %w", err)
+	}
+	provenance := Provenance{Parent: parentHash, Hash: hash, Timestamp: time.Now().UTC(), EditLog: editLog}
+	for _, option := range options {
+		option(&provenance)
+	}
+	chain := append(append([]Provenance{}, parent.Provenance()...), provenance)
+	record.SetProvenance(chain)
+	return provenance, nil
+}
+
+// VerifyProvenance checks that record's provenance chain is unbroken: each
+// entry's Parent is the Hash of the entry before it, and the last Hash is
+// record's seqhash. A record without a chain verifies.
+func VerifyProvenance(record Traceable) error {
+	chain := record.Provenance()
+	if len(chain) == 0 {
+		return nil
+	}
+	for index, provenance := range chain {
+		if provenance.Parent == "" || provenance.Hash == "" {
+			return fmt.Errorf("entry %d is missing a seqhash", index+1)
+		}
+		if index > 0 && provenance.Parent != chain[index-1].Hash {
+			return fmt.Errorf("entry %d was derived from %s, but entry %d made %s", index+1, provenance.Parent, index, chain[index-1].Hash)
+		}
+	}
+	hash, err := record.Seqhash()
+	if err != nil {
+		return fmt.Errorf("failed to hash record: %w", err)
+	}
+	if last := chain[len(chain)-1]; last.Hash != hash {
+		return errors.New("record's seqhash " + hash + " isn't the last entry's " + last.Hash + ", it was changed after its last entry")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package bio_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/io/genbank"
+	"github.com/TimothyStiles/poly/io/polyjson"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProvenance(t *testing.T) {
+	original, err := genbank.Read("../data/benchling.gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.Meta.Other["COMMENT"] = "made by hand"
+	timestamp := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	// two rounds of edits.
+	first := original
+	first.Sequence = "gg" + original.Sequence[2:]
+	if _, err = bio.WithProvenance(&first, &original, "changed bases 1-2 to GG", bio.ProvenanceTool("editor", "1.0"), bio.ProvenanceTimestamp(timestamp)); err != nil {
+		t.Fatal(err)
+	}
+	second := first
+	second.Sequence = first.Sequence[:100] + first.Sequence[110:]
+	if _, err = bio.WithProvenance(&second, &first, "deleted bases 101-110", bio.ProvenanceNote("removes a\nBsaI site"), bio.ProvenanceTimestamp(timestamp.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	chain := second.Provenance()
+	if len(chain) != 2 || len(first.Provenance()) != 1 {
+		t.Fatalf("Expected chains of 1 and 2 entries, got %d and %d", len(first.Provenance()), len(chain))
+	}
+	originalHash, _ := original.Seqhash()
+	if chain[0].Parent != originalHash || chain[1].Parent != chain[0].Hash || chain[0].Tool != "editor" || chain[1].EditLog != "deleted bases 101-110" {
+		t.Errorf("Unexpected chain %+v", chain)
+	}
+	if err = bio.VerifyProvenance(&second); err != nil {
+		t.Errorf("Expected the chain to verify, got %s", err)
+	}
+
+	// genbank to polyjson to genbank.
+	gbk, err := genbank.Build(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(gbk), "COMMENT     ##Provenance-START##") {
+		t.Errorf("Expected structured comments, got:\n%s", gbk)
+	}
+	parsed, err := genbank.Parse(bytes.NewReader(gbk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Meta.Other["COMMENT"] != "made by hand" {
+		t.Errorf("Expected the free text comment to be kept, got %q", parsed.Meta.Other["COMMENT"])
+	}
+	path := filepath.Join(t.TempDir(), "edited.json")
+	if err = polyjson.Write(polyjson.Poly{Meta: polyjson.Meta{Name: parsed.Meta.Locus.Name, Provenance: parsed.Provenance()}, Sequence: parsed.Sequence}, path); err != nil {
+		t.Fatal(err)
+	}
+	json, err := polyjson.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bio.VerifyProvenance(&json); err != nil {
+		t.Errorf("Expected the chain to verify in polyjson, got %s", err)
+	}
+	converted := parsed
+	converted.Sequence = json.Sequence
+	converted.SetProvenance(json.Provenance())
+	gbk, err = genbank.Build(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	final, err := genbank.Parse(bytes.NewReader(gbk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the note's newline is written as a space.
+	chain[1].Note = "removes a BsaI site"
+	if diff := cmp.Diff(chain, final.Provenance()); diff != "" {
+		t.Errorf("Chain didn't survive conversion (-want +got):\n%s", diff)
+	}
+	if err = bio.VerifyProvenance(&final); err != nil {
+		t.Errorf("Expected the converted chain to verify, got %s", err)
+	}
+
+	// changing the sequence or the chain breaks it.
+	tampered := final
+	tampered.Sequence = "a" + final.Sequence[1:]
+	if err = bio.VerifyProvenance(&tampered); err == nil || !strings.Contains(err.Error(), "changed after its last entry") {
+		t.Errorf("Expected a changed sequence to fail, got %v", err)
+	}
+	tampered = final
+	tampered.SetProvenance([]bio.Provenance{final.Provenance()[1]})
+	tampered.Meta.Provenance = append(tampered.Meta.Provenance, final.Provenance()[0])
+	if err = bio.VerifyProvenance(&tampered); err == nil || !strings.Contains(err.Error(), "entry 2 was derived from") {
+		t.Errorf("Expected a reordered chain to fail, got %v", err)
+	}
+	third := tampered
+	if _, err = bio.WithProvenance(&third, &tampered, "more edits"); err == nil {
+		t.Error("Expected WithProvenance to refuse a broken parent chain")
+	}
+}
+
+func TestProvenanceCommentErrors(t *testing.T) {
+	gbk, err := genbank.Build(genbank.Genbank{Meta: genbank.Meta{Locus: genbank.Locus{Name: "test", MoleculeType: "DNA"}}, Sequence: "atgc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, comment := range map[string]string{
+		"no end":        "COMMENT     ##Provenance-START##\n            Parent :: v1_DLD_0\n",
+		"no start":      "COMMENT     ##Provenance-END##\n",
+		"no separator":  "COMMENT     ##Provenance-START##\n            Parent v1_DLD_0\n            ##Provenance-END##\n",
+		"bad timestamp": "COMMENT     ##Provenance-START##\n            Timestamp :: yesterday\n            ##Provenance-END##\n",
+	} {
+		broken := strings.Replace(string(gbk), "FEATURES", comment+"FEATURES", 1)
+		if _, err = genbank.Parse(strings.NewReader(broken)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
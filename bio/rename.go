@@ -0,0 +1,211 @@
+package bio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+/******************************************************************************
+
+Renaming begins here
+
+Sharing sequences outside of a lab often means hiding what they are called,
+and a name shows up in more places than the record's identifier: a GFF
+feature's Parent points at another feature's ID, and GenBank features carry
+the /locus_tag of the gene they belong to. Renaming one without the others
+leaves a file that either leaks the old names or no longer hangs together.
+
+RenameRecords renames every name a record exposes through Renamable with a
+RenameScheme, and rewrites every reference to those names with the same new
+name, so a renamed file is as consistent as the original. It returns the
+mapping from old to new names, which WriteRenameMapping saves as a CSV so
+the records can be renamed back later with ReadRenameMapping.
+
+Schemes number names in the order they are first seen (SequentialNames),
+name them after a short seqhash of the sequence they identify (HashNames),
+or fill in a text/template (TemplateNames). Two old names that would get the
+same new name, like two features with the same sequence under HashNames, are
+an error rather than a silent merge.
+
+******************************************************************************/
+
+// RenameHashLength is the number of characters of a seqhash digest used by
+// HashNames.
+const RenameHashLength = 12
+
+// Name is a name in a record that can be replaced by RenameRecords.
+type Name struct {
+	// Name is the name as it is in the record.
+	Name string
+	// Seqhash returns the seqhash of the sequence the name identifies.
+	Seqhash func() (string, error)
+}
+
+// Renamable is a record whose names can be replaced, like a genbank.Genbank
+// or a gff.Gff. Methods that change the record are on its pointer.
+type Renamable interface {
+	// Names returns the names the record defines, each once, in the order
+	// they appear.
+	Names() []Name
+	// Rename replaces every name in the record, and every reference to one,
+	// that is a key of names with its value. It must not change maps or
+	// slices it shares with copies of the record.
+	Rename(names map[string]string)
+}
+
+// RenameScheme returns the new name of name, the index-th distinct name
+// found, counting from 0.
+type RenameScheme func(index int, name Name) (string, error)
+
+// SequentialNames names names prefix followed by their 1 indexed number,
+// padded to 4 digits, so the scheme "seq_" gives seq_0001, seq_0002 and on.
+func SequentialNames(prefix string) RenameScheme {
+	return func(index int, name Name) (string, error) {
+		return fmt.Sprintf("%s%04d", prefix, index+1), nil
+	}
+}
+
+// HashNames names names after the first RenameHashLength characters of the
+// digest of the seqhash of the sequence they identify, leaving out the
+// version and metadata prefix every seqhash of the same kind shares.
+func HashNames() RenameScheme {
+	return func(index int, name Name) (string, error) {
+		return shortHash(name)
+	}
+}
+
+// shortHash returns the first RenameHashLength characters of the digest of
+// the seqhash of name.
+func shortHash(name Name) (string, error) {
+	if name.Seqhash == nil {
+		return "", fmt.Errorf("%s has no sequence to hash", name.Name)
+	}
+	hash, err := name.Seqhash()
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", name.Name, err)
+	}
+	digest := hash[strings.LastIndex(hash, "_")+1:]
+	if len(digest) > RenameHashLength {
+		digest = digest[:RenameHashLength]
+	}
+	return digest, nil
+}
+
+// templateName is the data TemplateNames fills in its template with.
+type templateName struct {
+	Number int    // Number is the 1 indexed number of the name.
+	Name   string // Name is the old name.
+	name   Name
+}
+
+// Hash returns the name HashNames would give the name.
+func (name templateName) Hash() (string, error) {
+	return shortHash(name.name)
+}
+
+// TemplateNames names names by executing text, a text/template, with
+// {{.Number}} the 1 indexed number of the name, {{.Name}} the old name and
+// {{.Hash}} the name HashNames would give it, as in "{{.Hash}}-{{.Number}}".
+// It returns an error if text isn't a valid template.
+func TemplateNames(text string) (RenameScheme, error) {
+	nameTemplate, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(index int, name Name) (string, error) {
+		var buffer bytes.Buffer
+		if err := nameTemplate.Execute(&buffer, templateName{Number: index + 1, Name: name.Name, name: name}); err != nil {
+			return "", err
+		}
+		if buffer.Len() == 0 {
+			return "", fmt.Errorf("template gave %s an empty name", name.Name)
+		}
+		return buffer.String(), nil
+	}, nil
+}
+
+// RenameRecords returns copies of records with every name renamed by scheme,
+// and the mapping from old to new names. A name found in more than one
+// record gets the same new name in all of them. It returns an error if
+// scheme fails or gives two different names the same new name.
+func RenameRecords[T any, PT interface {
+	*T
+	Renamable
+}](records []T, scheme RenameScheme) ([]T, map[string]string, error) {
+	mapping := make(map[string]string)
+	oldNames := make(map[string]string)
+	for index := range records {
+		for _, name := range PT(&records[index]).Names() {
+			if _, ok := mapping[name.Name]; ok || name.Name == "" {
+				continue
+			}
+			newName, err := scheme(len(mapping), name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if oldName, ok := oldNames[newName]; ok {
+				return nil, nil, fmt.Errorf("%s and %s would both be renamed %s", oldName, name.Name, newName)
+			}
+			mapping[name.Name], oldNames[newName] = newName, name.Name
+		}
+	}
+
+	renamed := make([]T, len(records))
+	copy(renamed, records)
+	for index := range renamed {
+		PT(&renamed[index]).Rename(mapping)
+	}
+	return renamed, mapping, nil
+}
+
+// renameColumns is the header of the CSV written by WriteRenameMapping.
+var renameColumns = []string{"old_name", "new_name"}
+
+// WriteRenameMapping writes mapping, from old to new names, to w as a CSV
+// with an old_name,new_name header, sorted by old name.
+func WriteRenameMapping(w io.Writer, mapping map[string]string) error {
+	oldNames := make([]string, 0, len(mapping))
+	for oldName := range mapping {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(renameColumns); err != nil {
+		return err
+	}
+	for _, oldName := range oldNames {
+		if err := writer.Write([]string{oldName, mapping[oldName]}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadRenameMapping reads a mapping written by WriteRenameMapping from r.
+// Pass Rename the mapping it returns with keys and values swapped to undo a
+// renaming.
+func ReadRenameMapping(r io.Reader) (map[string]string, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) != 2 || rows[0][0] != renameColumns[0] || rows[0][1] != renameColumns[1] {
+		return nil, errors.New("missing old_name,new_name header")
+	}
+	mapping := make(map[string]string, len(rows)-1)
+	for _, row := range rows[1:] {
+		if _, ok := mapping[row[0]]; ok {
+			return nil, fmt.Errorf("%s is renamed more than once", row[0])
+		}
+		mapping[row[0]] = row[1]
+	}
+	return mapping, nil
+}
@@ -0,0 +1,182 @@
+package bio_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/io/genbank"
+	"github.com/TimothyStiles/poly/io/gff"
+	"github.com/TimothyStiles/poly/seqhash"
+	"github.com/google/go-cmp/cmp"
+)
+
+// renameGff is a gene with an mRNA, an exon and a CDS, and a second gene.
+const renameGff = `##gff-version 3
+##sequence-region patient_7 1 60
+patient_7	feature	gene	1	30	.	+	.	ID=BRCA_like
+patient_7	feature	mRNA	1	30	.	+	.	ID=BRCA_like.t1;Parent=BRCA_like
+patient_7	feature	exon	1	30	.	+	.	ID=BRCA_like.t1.exon1;Parent=BRCA_like.t1
+patient_7	feature	CDS	4	27	.	+	0	Parent=BRCA_like.t1,BRCA_like
+patient_7	feature	gene	31	60	.	-	.	ID=secret_gene
+###
+##FASTA
+>patient_7
+ATGAAACGCATTAGCACCACCATTACCACCGGTAACGGTGCGGGCTGACGCGTACAGGAA
+`
+
+func TestRenameRecordsGff(t *testing.T) {
+	original, err := gff.Parse(strings.NewReader(renameGff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, mapping, err := bio.RenameRecords([]gff.Gff{original}, bio.SequentialNames("seq_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"patient_7":          "seq_0001",
+		"BRCA_like":          "seq_0002",
+		"BRCA_like.t1":       "seq_0003",
+		"BRCA_like.t1.exon1": "seq_0004",
+		"secret_gene":        "seq_0005",
+	}
+	if diff := cmp.Diff(expected, mapping); diff != "" {
+		t.Errorf("Unexpected mapping (-want +got):\n%s", diff)
+	}
+
+	// every Parent still points at a feature's ID.
+	ids := make(map[string]bool)
+	for _, feature := range renamed[0].Features {
+		ids[feature.Attributes["ID"]] = true
+	}
+	for index, feature := range renamed[0].Features {
+		if feature.Name != "seq_0001" {
+			t.Errorf("Expected feature %d to be on seq_0001, got %s", index, feature.Name)
+		}
+		for _, parent := range strings.Split(feature.Attributes["Parent"], ",") {
+			if parent != "" && !ids[parent] {
+				t.Errorf("Parent %s of feature %d isn't an ID", parent, index)
+			}
+		}
+	}
+	if parents := renamed[0].Features[3].Attributes["Parent"]; parents != "seq_0003,seq_0002" {
+		t.Errorf("Expected the CDS to have parents seq_0003,seq_0002, got %s", parents)
+	}
+	built, err := gff.Build(renamed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for oldName := range mapping {
+		if strings.Contains(string(built), oldName) {
+			t.Errorf("Renamed gff still contains %s:\n%s", oldName, built)
+		}
+	}
+	if original.Meta.Name != "patient_7" || original.Features[1].Attributes["ID"] != "BRCA_like.t1" {
+		t.Errorf("RenameRecords changed the records it was given")
+	}
+
+	// the mapping renames the records back.
+	var buffer bytes.Buffer
+	if err = bio.WriteRenameMapping(&buffer, mapping); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), "old_name,new_name\nBRCA_like,seq_0002\n") {
+		t.Errorf("Unexpected mapping CSV:\n%s", buffer.String())
+	}
+	read, err := bio.ReadRenameMapping(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverse := make(map[string]string)
+	for oldName, newName := range read {
+		inverse[newName] = oldName
+	}
+	restored := renamed[0]
+	restored.Rename(inverse)
+	if diff := cmp.Diff(original.Features, restored.Features, cmp.FilterPath(func(path cmp.Path) bool {
+		return path.Last().String() == ".ParentSequence"
+	}, cmp.Ignore())); diff != "" || restored.Meta.Name != original.Meta.Name {
+		t.Errorf("Renaming back didn't restore the features (-want +got):\n%s", diff)
+	}
+
+	// the gene and its mRNA have the same sequence, so the same hash.
+	_, _, err = bio.RenameRecords([]gff.Gff{original}, bio.HashNames())
+	if err == nil || !strings.Contains(err.Error(), "BRCA_like and BRCA_like.t1 would both be renamed") {
+		t.Errorf("Expected a hash collision between the gene and its mRNA, got %v", err)
+	}
+	template, err := bio.TemplateNames("{{.Hash}}_{{.Number}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, mapping, err = bio.RenameRecords([]gff.Gff{original}, template); err != nil {
+		t.Errorf("Expected numbered hashes not to collide, got %s", err)
+	} else if !strings.HasSuffix(mapping["BRCA_like.t1"], "_3") || len(mapping["BRCA_like.t1"]) != bio.RenameHashLength+2 {
+		t.Errorf("Unexpected templated name %s", mapping["BRCA_like.t1"])
+	}
+}
+
+func TestRenameRecordsGenbank(t *testing.T) {
+	original, err := genbank.Read("../data/phix174.gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, mapping, err := bio.RenameRecords([]genbank.Genbank{original}, bio.HashNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := original.Seqhash()
+	if locus := renamed[0].Meta.Locus.Name; locus != mapping["CP004084"] || !strings.HasPrefix(hash[strings.LastIndex(hash, "_")+1:], locus) || len(locus) != bio.RenameHashLength {
+		t.Errorf("Expected the locus to be renamed to the start of %s, got %s", hash, locus)
+	}
+
+	// genes and their CDSs keep sharing a locus tag, named after the gene.
+	for index, feature := range original.Features {
+		locusTag, ok := feature.Attributes["locus_tag"]
+		if !ok {
+			continue
+		}
+		renamedTag := renamed[0].Features[index].Attributes["locus_tag"]
+		if renamedTag != mapping[locusTag] {
+			t.Errorf("Expected %s to be renamed %s in feature %d, got %s", locusTag, mapping[locusTag], index, renamedTag)
+		}
+		if feature.Type != "gene" {
+			continue
+		}
+		sequence, _ := feature.GetSequence()
+		featureHash, _ := seqhash.Hash(sequence, seqhash.DNA, false, true)
+		if !strings.HasPrefix(featureHash[strings.LastIndex(featureHash, "_")+1:], renamedTag) {
+			t.Errorf("Expected %s to be renamed to the start of %s, got %s", locusTag, featureHash, renamedTag)
+		}
+	}
+	if len(mapping) != 12 {
+		t.Errorf("Expected a locus and 11 locus tags to be renamed, got %v", mapping)
+	}
+	built, err := genbank.Build(renamed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(built), "F652_") || !strings.HasPrefix(string(built), "LOCUS       "+mapping["CP004084"]) {
+		t.Errorf("Unexpected renamed genbank:\n%s", built)
+	}
+	if original.Features[1].Attributes["locus_tag"] != "F652_4273" {
+		t.Errorf("RenameRecords changed the records it was given")
+	}
+}
+
+func TestTemplateNamesErrors(t *testing.T) {
+	if _, err := bio.TemplateNames("{{.Number"); err == nil {
+		t.Errorf("Expected an invalid template to fail")
+	}
+	scheme, err := bio.TemplateNames("{{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = scheme(0, bio.Name{Name: "x"}); err == nil {
+		t.Errorf("Expected a template with an unknown field to fail")
+	}
+	if _, err = bio.ReadRenameMapping(strings.NewReader("a,b\n")); err == nil {
+		t.Errorf("Expected a mapping without a header to fail")
+	}
+}
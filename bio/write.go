@@ -0,0 +1,80 @@
+package bio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+/******************************************************************************
+
+Writing begins here
+
+Every format writes records its own way: fasta.Write takes a path,
+pileup.WritePileups a writer, slow5.Write a channel. Writer is the one shape
+all of them can be fit into, one record at a time, so code that writes
+records doesn't need to know which format it is writing.
+
+Formats that write each record on its own, like FASTA, FASTQ, GenBank and
+pileup, become Writers through NewWriter and their Format. Formats that need
+more than records, like the headers of slow5, have their own Writer made
+with those, such as slow5.NewRecordWriter. WriteAll and WriteFile then
+write a slice of records through either.
+
+******************************************************************************/
+
+// Writer writes records of type T one at a time. Close must be called once
+// all records are written, to flush anything buffered.
+type Writer[T any] interface {
+	WriteRecord(record T) error
+	Close() error
+}
+
+// formatWriter is a Writer of a Format.
+type formatWriter[T any] struct {
+	buffer *bufio.Writer
+	format Format[T]
+}
+
+// NewWriter returns a Writer that writes each record to w with format. Its
+// Close flushes it, but doesn't close w.
+func NewWriter[T any](w io.Writer, format Format[T]) Writer[T] {
+	return &formatWriter[T]{buffer: bufio.NewWriter(w), format: format}
+}
+
+func (writer *formatWriter[T]) WriteRecord(record T) error {
+	return writer.format(writer.buffer, record)
+}
+
+func (writer *formatWriter[T]) Close() error {
+	return writer.buffer.Flush()
+}
+
+// WriteAll writes every record of records with writer and closes it. Writing
+// stops at the first record that fails, but writer is always closed, and the
+// first error is returned.
+func WriteAll[T any](writer Writer[T], records []T) error {
+	for index, record := range records {
+		if err := writer.WriteRecord(record); err != nil {
+			writer.Close()
+			return fmt.Errorf("failed to write record %d: %w", index+1, err)
+		}
+	}
+	return writer.Close()
+}
+
+// WriteFile writes every record of records to a file at path with format,
+// creating or truncating it.
+func WriteFile[T any](path string, format Format[T], records []T) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	return WriteAll(NewWriter(file, format), records)
+}
@@ -0,0 +1,157 @@
+package bio_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/io/fasta"
+	"github.com/TimothyStiles/poly/io/fastq"
+	"github.com/TimothyStiles/poly/io/genbank"
+	"github.com/TimothyStiles/poly/io/pileup"
+	"github.com/TimothyStiles/poly/io/slow5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// roundTrip writes records through the Writer made by newWriter and parses
+// them back with parse.
+func roundTrip[T any](t *testing.T, newWriter func(w io.Writer) bio.Writer[T], parse func(r io.Reader) ([]T, error), records []T) []T {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := bio.WriteAll(newWriter(&buffer), records); err != nil {
+		t.Fatalf("failed to write records: %s", err)
+	}
+	parsed, err := parse(&buffer)
+	if err != nil {
+		t.Fatalf("failed to parse written records: %s", err)
+	}
+	return parsed
+}
+
+func TestWriteAllRoundTrip(t *testing.T) {
+	t.Run("fasta", func(t *testing.T) {
+		records := []fasta.Fasta{{Name: "first", Sequence: "ATGC"}, {Name: "second", Sequence: strings.Repeat("GATTACA", 20)}}
+		parsed := roundTrip(t, func(w io.Writer) bio.Writer[fasta.Fasta] {
+			return bio.NewWriter(w, bio.FormatFromBuild(fasta.Build))
+		}, fasta.Parse, records)
+		if diff := cmp.Diff(records, parsed); diff != "" {
+			t.Errorf("fasta records changed in a round trip (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("fastq", func(t *testing.T) {
+		records, err := fastq.Read("../io/fastq/data/nanosavseq.fastq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := roundTrip(t, func(w io.Writer) bio.Writer[fastq.Fastq] {
+			return bio.NewWriter(w, bio.FormatFromBuild(fastq.Build))
+		}, fastq.Parse, records)
+		if diff := cmp.Diff(records, parsed); diff != "" {
+			t.Errorf("fastq records changed in a round trip (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("genbank", func(t *testing.T) {
+		records, err := genbank.ReadMulti("../data/multiGbk_test.seq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := roundTrip(t, func(w io.Writer) bio.Writer[genbank.Genbank] {
+			return bio.NewWriter(w, bio.FormatFromBuild(genbank.BuildMulti))
+		}, genbank.ParseMulti, records)
+		if diff := cmp.Diff(records, parsed, cmpopts.IgnoreFields(genbank.Feature{}, "ParentSequence")); diff != "" {
+			t.Errorf("genbank records changed in a round trip (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("pileup", func(t *testing.T) {
+		records, err := pileup.Read("../io/pileup/data/test.pileup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		format := func(w io.Writer, record pileup.Pileup) error {
+			return pileup.WritePileups([]pileup.Pileup{record}, w)
+		}
+		parsed := roundTrip(t, func(w io.Writer) bio.Writer[pileup.Pileup] {
+			return bio.NewWriter(w, format)
+		}, pileup.Parse, records)
+		if diff := cmp.Diff(records, parsed); diff != "" {
+			t.Errorf("pileup records changed in a round trip (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("slow5", func(t *testing.T) {
+		file, err := os.Open("../io/slow5/data/example.slow5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		const maxLineSize = 8 * 1024 * 1024
+		headers, records, err := slow5.ReadAll(file, maxLineSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := roundTrip(t, func(w io.Writer) bio.Writer[slow5.Read] {
+			return slow5.NewRecordWriter(headers, w)
+		}, func(r io.Reader) ([]slow5.Read, error) {
+			_, reads, err := slow5.ReadAll(r, maxLineSize)
+			return reads, err
+		}, records)
+		if diff := cmp.Diff(records, parsed, cmpopts.IgnoreUnexported(slow5.Read{})); diff != "" {
+			t.Errorf("slow5 reads changed in a round trip (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestWriteAllErrors(t *testing.T) {
+	failing := func(w io.Writer, record fasta.Fasta) error {
+		if record.Name == "bad" {
+			return errors.New("no space left on device")
+		}
+		return bio.FormatFromBuild(fasta.Build)(w, record)
+	}
+	var buffer bytes.Buffer
+	err := bio.WriteAll(bio.NewWriter(&buffer, failing), []fasta.Fasta{{Name: "good", Sequence: "ATGC"}, {Name: "bad", Sequence: "ATGC"}})
+	if err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Errorf("expected an error writing record 2, got %v", err)
+	}
+	// the records before the failure are still flushed.
+	if buffer.String() != ">good\nATGC\n" {
+		t.Errorf("expected the first record to be written, got %q", buffer.String())
+	}
+
+	// slow5 headers are checked before any read is written.
+	writer := slow5.NewRecordWriter(nil, io.Discard)
+	if err := bio.WriteAll[slow5.Read](writer, []slow5.Read{{ReadID: "read"}}); !errors.Is(err, slow5.ErrNoHeaders) {
+		t.Errorf("expected ErrNoHeaders, got %v", err)
+	}
+	if err := writer.WriteRecord(slow5.Read{}); err == nil {
+		t.Error("expected an error writing to a closed writer")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.fasta")
+	records := []fasta.Fasta{{Name: "first", Sequence: "ATGC"}}
+	if err := bio.WriteFile(path, bio.FormatFromBuild(fasta.Build), records); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := fasta.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(records, parsed); diff != "" {
+		t.Errorf("fasta file changed in a round trip (-want +got):\n%s", diff)
+	}
+
+	if err := bio.WriteFile(filepath.Join(t.TempDir(), "missing", "records.fasta"), bio.FormatFromBuild(fasta.Build), records); err == nil {
+		t.Error("expected an error writing to a directory that doesn't exist")
+	}
+}
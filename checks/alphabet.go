@@ -0,0 +1,242 @@
+package checks
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/******************************************************************************
+Alphabet detection begins here
+
+A U in a DNA file or a T in an RNA file doesn't look like much, but it
+breaks anything that picks its parameters by alphabet: folding rejects the
+sequence deep inside its dynamic programming, and an enzyme site scan just
+doesn't find sites. DetectAlphabet says what a sequence looks like and
+lists what doesn't fit, with positions, and RequireAlphabet turns that into
+an error at the entry points of fold. Primers and clone work on sequences
+with N stretches and other IUPAC ambiguity codes, like those of GenBank
+records, so they use RequireIUPACAlphabet, which lets them through.
+
+A sequence is taken to be a nucleic acid if at least nucleicFraction of its
+letters are A, C, G, T, U or N, which a protein of any length almost never
+is, or if all of its letters are IUPAC nucleotide codes, and then DNA or RNA
+by whether it has more T's or U's. Anything else made of amino acid letters
+is a protein. A sequence that is neither, or a
+nucleic acid with as many T's as U's, is Ambiguous.
+
+Detection is case insensitive. Confidence is the fraction of the sequence
+that fits the detected alphabet without anomalies, so a clean sequence is 1
+and a sequence with a stray U in every ten bases is 0.9.
+
+******************************************************************************/
+
+// Alphabet is the kind of sequence DetectAlphabet found.
+type Alphabet int
+
+// The alphabets a sequence can be detected as. Ambiguous is for sequences
+// that don't clearly fit any.
+const (
+	Ambiguous Alphabet = iota
+	DNA
+	RNA
+	Protein
+)
+
+// String returns the name of the alphabet.
+func (alphabet Alphabet) String() string {
+	switch alphabet {
+	case DNA:
+		return "DNA"
+	case RNA:
+		return "RNA"
+	case Protein:
+		return "protein"
+	default:
+		return "ambiguous"
+	}
+}
+
+// Confidence is the fraction of a sequence, from 0 to 1, that fits its
+// detected alphabet without anomalies.
+type Confidence float64
+
+// AnomalyKind is why a character doesn't fit an alphabet.
+type AnomalyKind int
+
+// The kinds of anomalies.
+const (
+	// InvalidCharacter is a character that isn't part of any sequence, like
+	// punctuation or a letter outside of the alphabet.
+	InvalidCharacter AnomalyKind = iota
+	// Digit is a number, like the positions of a GenBank ORIGIN block.
+	Digit
+	// Whitespace is a space, tab or line ending.
+	Whitespace
+	// Uracil is a U in DNA.
+	Uracil
+	// Thymine is a T in RNA.
+	Thymine
+	// AmbiguousBase is an IUPAC ambiguity code, like N, in DNA or RNA.
+	AmbiguousBase
+	// InternalStop is a '*' anywhere but the end of a protein.
+	InternalStop
+)
+
+// String returns a description of the anomaly kind.
+func (kind AnomalyKind) String() string {
+	switch kind {
+	case Digit:
+		return "digit"
+	case Whitespace:
+		return "whitespace"
+	case Uracil:
+		return "uracil"
+	case Thymine:
+		return "thymine"
+	case AmbiguousBase:
+		return "ambiguous base"
+	case InternalStop:
+		return "internal stop"
+	default:
+		return "invalid character"
+	}
+}
+
+// Anomaly is a character that doesn't fit a sequence's alphabet.
+type Anomaly struct {
+	Character rune        // Character is the anomalous character, as it is in the sequence.
+	Position  int         // Position is the byte offset of the character in the sequence, 0 indexed.
+	Kind      AnomalyKind // Kind is why the character doesn't fit.
+}
+
+// nucleicFraction is the fraction of a sequence's letters that must be A, C,
+// G, T, U or N for it to be detected as a nucleic acid.
+const nucleicFraction = 0.9
+
+const (
+	nucleotideLetters = "ACGTUN"
+	// ambiguityCodes are the IUPAC nucleotide ambiguity codes.
+	ambiguityCodes = "RYSWKMBDHVN"
+	// aminoAcidLetters are the amino acids seqhash accepts, including
+	// selenocysteine (U), pyrrolysine (O) and the ambiguity codes B, Z and X.
+	aminoAcidLetters = "ACDEFGHIKLMNPQRSTVWYUOBXZ"
+)
+
+// DetectAlphabet returns the alphabet seq looks like, the confidence of
+// that, and every character of seq that doesn't fit it. Only characters
+// that aren't letters are anomalies of an Ambiguous sequence.
+func DetectAlphabet(seq string) (Alphabet, Confidence, []Anomaly) {
+	letters, nucleotides, iupacNucleotides, thymines, uracils := 0, 0, 0, 0, 0
+	aminoAcids := true
+	for _, character := range strings.ToUpper(seq) {
+		if !unicode.IsLetter(character) {
+			continue
+		}
+		letters++
+		if strings.ContainsRune(nucleotideLetters, character) {
+			nucleotides++
+		}
+		if strings.ContainsRune(nucleotideLetters, character) || strings.ContainsRune(ambiguityCodes, character) {
+			iupacNucleotides++
+		}
+		switch character {
+		case 'T':
+			thymines++
+		case 'U':
+			uracils++
+		}
+		if !strings.ContainsRune(aminoAcidLetters, character) {
+			aminoAcids = false
+		}
+	}
+
+	alphabet := Ambiguous
+	switch {
+	case letters == 0:
+	case float64(nucleotides) >= nucleicFraction*float64(letters), iupacNucleotides == letters:
+		switch {
+		case uracils > thymines:
+			alphabet = RNA
+		case thymines > uracils || thymines == 0:
+			alphabet = DNA
+		}
+	case aminoAcids:
+		alphabet = Protein
+	}
+
+	anomalies := alphabetAnomalies(seq, alphabet)
+	if len(seq) == 0 || alphabet == Ambiguous {
+		return alphabet, 0, anomalies
+	}
+	return alphabet, Confidence(1 - float64(len(anomalies))/float64(len([]rune(seq)))), anomalies
+}
+
+// RequireAlphabet returns an error if seq isn't entirely want, case
+// insensitively, giving the position of the first character that doesn't
+// fit. DNA is only A, C, G and T, and RNA only A, C, G and U, so ambiguity
+// codes are errors. Proteins may end with a single '*'.
+func RequireAlphabet(seq string, want Alphabet) error {
+	return requireAlphabet(seq, want, false)
+}
+
+// RequireIUPACAlphabet is RequireAlphabet, but the IUPAC ambiguity codes R,
+// Y, S, W, K, M, B, D, H, V and N are allowed in DNA and RNA.
+func RequireIUPACAlphabet(seq string, want Alphabet) error {
+	return requireAlphabet(seq, want, true)
+}
+
+// requireAlphabet is RequireAlphabet, allowing ambiguity codes if
+// allowAmbiguous is true.
+func requireAlphabet(seq string, want Alphabet, allowAmbiguous bool) error {
+	if want == Ambiguous {
+		return fmt.Errorf("can't require the %s alphabet", want)
+	}
+	var anomalies []Anomaly
+	for _, anomaly := range alphabetAnomalies(seq, want) {
+		if !allowAmbiguous || anomaly.Kind != AmbiguousBase {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	if len(anomalies) == 0 {
+		return nil
+	}
+	first := anomalies[0]
+	return fmt.Errorf("sequence isn't %s: it has %d characters that don't fit, the first is %s %q at position %d", want, len(anomalies), first.Kind, first.Character, first.Position)
+}
+
+// alphabetAnomalies returns the characters of seq that don't fit alphabet.
+func alphabetAnomalies(seq string, alphabet Alphabet) []Anomaly {
+	var anomalies []Anomaly
+	for position, character := range seq {
+		upper := unicode.ToUpper(character)
+		kind := InvalidCharacter
+		switch {
+		case unicode.IsDigit(character):
+			kind = Digit
+		case unicode.IsSpace(character):
+			kind = Whitespace
+		case alphabet == Ambiguous && unicode.IsLetter(character):
+			continue
+		case alphabet == Protein && character == '*':
+			if position == len(seq)-1 {
+				continue
+			}
+			kind = InternalStop
+		case alphabet == Protein && strings.ContainsRune(aminoAcidLetters, upper):
+			continue
+		case alphabet == DNA && upper == 'U':
+			kind = Uracil
+		case alphabet == RNA && upper == 'T':
+			kind = Thymine
+		case (alphabet == DNA || alphabet == RNA) && strings.ContainsRune("ACG", upper):
+			continue
+		case alphabet == DNA && upper == 'T', alphabet == RNA && upper == 'U':
+			continue
+		case (alphabet == DNA || alphabet == RNA) && strings.ContainsRune(ambiguityCodes, upper):
+			kind = AmbiguousBase
+		}
+		anomalies = append(anomalies, Anomaly{Character: character, Position: position, Kind: kind})
+	}
+	return anomalies
+}
@@ -0,0 +1,95 @@
+package checks_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/checks"
+)
+
+func TestDetectAlphabet(t *testing.T) {
+	tests := []struct {
+		name       string
+		seq        string
+		alphabet   checks.Alphabet
+		confidence checks.Confidence
+		anomalies  []checks.Anomaly
+	}{
+		{"DNA", "acgtACGT", checks.DNA, 1, nil},
+		{"RNA", "ACGUACGU", checks.RNA, 1, nil},
+		{"DNA without T", "ACGACG", checks.DNA, 1, nil},
+		{"uracil in DNA", "ACGTACGTAU", checks.DNA, 0.9, []checks.Anomaly{{'U', 9, checks.Uracil}}},
+		{"thymine in RNA", "ACGUACGUAt", checks.RNA, 0.9, []checks.Anomaly{{'t', 9, checks.Thymine}}},
+		{"ambiguous base", "ACGTNACGTR", checks.DNA, 0.8, []checks.Anomaly{{'N', 4, checks.AmbiguousBase}, {'R', 9, checks.AmbiguousBase}}},
+		{"mostly ambiguous bases", "ACGTNNNRY", checks.DNA, 4.0 / 9, []checks.Anomaly{{'N', 4, checks.AmbiguousBase}, {'N', 5, checks.AmbiguousBase}, {'N', 6, checks.AmbiguousBase}, {'R', 7, checks.AmbiguousBase}, {'Y', 8, checks.AmbiguousBase}}},
+		{"digits and whitespace", "1 ACGTACGT", checks.DNA, 0.8, []checks.Anomaly{{'1', 0, checks.Digit}, {' ', 1, checks.Whitespace}}},
+		{"invalid character", "ACGT-ACGT", checks.DNA, 8.0 / 9, []checks.Anomaly{{'-', 4, checks.InvalidCharacter}}},
+		{"protein with a trailing stop", "MKVLAAGIW*", checks.Protein, 1, nil},
+		{"protein with an internal stop", "MKV*LAAGIW*", checks.Protein, 10.0 / 11, []checks.Anomaly{{'*', 3, checks.InternalStop}}},
+		{"letter outside of proteins", "MKVLJAGIW", checks.Ambiguous, 0, nil},
+		{"as many T's as U's", "ACGTACGU", checks.Ambiguous, 0, nil},
+		{"empty", "", checks.Ambiguous, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alphabet, confidence, anomalies := checks.DetectAlphabet(test.seq)
+			if alphabet != test.alphabet {
+				t.Errorf("expected %s, got %s", test.alphabet, alphabet)
+			}
+			if confidence < test.confidence-1e-9 || confidence > test.confidence+1e-9 {
+				t.Errorf("expected a confidence of %f, got %f", test.confidence, confidence)
+			}
+			if !reflect.DeepEqual(anomalies, test.anomalies) {
+				t.Errorf("expected anomalies %v, got %v", test.anomalies, anomalies)
+			}
+		})
+	}
+}
+
+func TestRequireAlphabet(t *testing.T) {
+	for _, test := range []struct {
+		seq       string
+		want      checks.Alphabet
+		errSubstr string
+	}{
+		{"ACGTacgt", checks.DNA, ""},
+		{"ACGUacgu", checks.RNA, ""},
+		{"MKVLAAGIW*", checks.Protein, ""},
+		{"ACGTACGUU", checks.DNA, "sequence isn't DNA: it has 2 characters that don't fit, the first is uracil 'U' at position 7"},
+		{"ACGUACGT", checks.RNA, "thymine 'T' at position 7"},
+		{"ACGTNNACGT", checks.DNA, "ambiguous base 'N' at position 4"},
+		{"MK*VL", checks.Protein, "internal stop '*' at position 2"},
+		{"ACGT", checks.Ambiguous, "can't require the ambiguous alphabet"},
+	} {
+		err := checks.RequireAlphabet(test.seq, test.want)
+		switch {
+		case test.errSubstr == "" && err != nil:
+			t.Errorf("%s: expected %s, got %s", test.seq, test.want, err)
+		case test.errSubstr != "" && (err == nil || !strings.Contains(err.Error(), test.errSubstr)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.seq, test.errSubstr, err)
+		}
+	}
+}
+
+func TestRequireIUPACAlphabet(t *testing.T) {
+	for _, test := range []struct {
+		seq       string
+		want      checks.Alphabet
+		errSubstr string
+	}{
+		{"ggtctcaNNNNatgc", checks.DNA, ""},
+		{"ACGURYSWKMBDHVN", checks.RNA, ""},
+		{"ACGTNNU", checks.DNA, "uracil 'U' at position 6"},
+		{"ACGTN-ACGT", checks.DNA, "invalid character '-' at position 5"},
+		{"MKVLJ", checks.Protein, "invalid character 'J' at position 4"},
+	} {
+		err := checks.RequireIUPACAlphabet(test.seq, test.want)
+		switch {
+		case test.errSubstr == "" && err != nil:
+			t.Errorf("%s: expected %s, got %s", test.seq, test.want, err)
+		case test.errSubstr != "" && (err == nil || !strings.Contains(err.Error(), test.errSubstr)):
+			t.Errorf("%s: expected an error containing %q, got %v", test.seq, test.errSubstr, err)
+		}
+	}
+}
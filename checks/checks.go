@@ -47,3 +47,30 @@ func IsRNA(seq string) bool {
 	}
 	return true
 }
+
+// IsValidDotBracketStructure returns true if structure is valid dot-bracket
+// notation: only '.', '(' and ')', with balanced parentheses. If
+// allowPseudoknots is true, square brackets are also accepted for pairs
+// crossing the parenthesized ones, and must balance among themselves.
+func IsValidDotBracketStructure(structure string, allowPseudoknots bool) bool {
+	var openParentheses, openBrackets int
+	for _, character := range structure {
+		switch {
+		case character == '.':
+		case character == '(':
+			openParentheses++
+		case character == ')':
+			openParentheses--
+		case character == '[' && allowPseudoknots:
+			openBrackets++
+		case character == ']' && allowPseudoknots:
+			openBrackets--
+		default:
+			return false
+		}
+		if openParentheses < 0 || openBrackets < 0 {
+			return false
+		}
+	}
+	return openParentheses == 0 && openBrackets == 0
+}
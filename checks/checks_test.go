@@ -86,3 +86,28 @@ func TestIsRNA(t *testing.T) {
 		})
 	}
 }
+
+func TestIsValidDotBracketStructure(t *testing.T) {
+	tests := []struct {
+		name             string
+		structure        string
+		allowPseudoknots bool
+		want             bool
+	}{
+		{name: "Nested", structure: ".((((.(((......)))....))))", want: true},
+		{name: "Unpaired", structure: "....", want: true},
+		{name: "Unbalanced", structure: "((..)", want: false},
+		{name: "ClosedBeforeOpened", structure: ")(", want: false},
+		{name: "UnknownCharacter", structure: "((..x))", want: false},
+		{name: "PseudoknotNotAllowed", structure: "((..[[..))..]]", want: false},
+		{name: "Pseudoknot", structure: "((..[[..))..]]", allowPseudoknots: true, want: true},
+		{name: "UnbalancedPseudoknot", structure: "((..[[..))..]", allowPseudoknots: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checks.IsValidDotBracketStructure(tt.structure, tt.allowPseudoknots); got != tt.want {
+				t.Errorf("IsValidDotBracketStructure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
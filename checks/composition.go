@@ -0,0 +1,167 @@
+package checks
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+)
+
+/******************************************************************************
+Composition bias begins here
+
+A few cheap statistics catch a lot of what goes wrong with assembled or
+synthesized sequences: a base composition far from the organism's, a strand
+that is suddenly G rich, or an ORF that doesn't look like it codes for
+anything.
+
+CompositionBias is Pearson's chi-square test of the counts of A, C, G and T
+against the frequencies expected from a background, with 3 degrees of
+freedom, for which the p-value has a closed form:
+
+	p = erfc(sqrt(chi2 / 2)) + sqrt(2 chi2 / pi) exp(-chi2 / 2)
+
+StrandBias is the GC skew, (G - C) / (G + C), of consecutive windows. It
+swings sign at replication origins and termini, and a stretch with a strong
+skew on one strand is worth a second look.
+
+IsLikelyCoding uses the 3 base periodicity of coding sequences, which comes
+from codon position biases and shows up as a peak at frequency 1/3 in the
+Fourier spectrum of the sequence (Tiwari et al. 1997,
+doi:10.1093/bioinformatics/13.3.263). For each base b, with u_b(n) 1 where
+the sequence has b and 0 elsewhere,
+
+	U_b = sum over n of u_b(n) exp(-2 pi i n / 3)
+
+and the score is the sum of |U_b|^2 over the four bases divided by its
+expectation for a random sequence of the same composition, which by
+Parseval's theorem is the mean power of the spectrum without its constant
+term:
+
+	sum over b of (N n_b - n_b^2) / (N - 1)
+
+where n_b is the count of base b and N the length of the sequence. A random
+sequence scores around 1, and coding sequences of a few hundred bases
+usually score well above codingThreshold. It needs no codon table, so it
+works for any organism, but it can't say which frame is coding and is
+unreliable on sequences much shorter than 100 bases.
+
+******************************************************************************/
+
+// codingThreshold is the 3 base periodicity score above which IsLikelyCoding
+// calls a sequence coding. Shuffled coding sequences score above it less
+// than 1% of the time.
+const codingThreshold = 4
+
+// baseIndex returns the index of base in A, C, G, T order, treating U as T,
+// or -1 for anything else.
+func baseIndex(base rune) int {
+	switch base {
+	case 'A', 'a':
+		return 0
+	case 'C', 'c':
+		return 1
+	case 'G', 'g':
+		return 2
+	case 'T', 't', 'U', 'u':
+		return 3
+	}
+	return -1
+}
+
+// CompositionBias tests whether the counts of A, C, G and T in seq fit the
+// base frequencies of background, given in A, C, G, T order. It returns
+// Pearson's chi-square statistic and its p-value with 3 degrees of freedom;
+// a small p-value means seq's composition is unlikely under the background.
+// background is normalized to sum to 1, and a background of all zeros is
+// taken to be uniform. U counts as T and other characters are ignored, so a
+// seq without any bases gives a chi-square of 0 and a p-value of 1.
+func CompositionBias(seq string, background [4]float64) (chi2 float64, pValue float64) {
+	var counts [4]float64
+	total := 0.0
+	for _, base := range seq {
+		if index := baseIndex(base); index != -1 {
+			counts[index]++
+			total++
+		}
+	}
+	if total == 0 {
+		return 0, 1
+	}
+	sum := background[0] + background[1] + background[2] + background[3]
+	if sum <= 0 {
+		background, sum = [4]float64{1, 1, 1, 1}, 4
+	}
+	for index, count := range counts {
+		expected := total * background[index] / sum
+		if expected == 0 {
+			if count > 0 {
+				return math.Inf(1), 0
+			}
+			continue
+		}
+		chi2 += (count - expected) * (count - expected) / expected
+	}
+	return chi2, math.Erfc(math.Sqrt(chi2/2)) + math.Sqrt(2*chi2/math.Pi)*math.Exp(-chi2/2)
+}
+
+// StrandBias returns the GC skew, (G - C) / (G + C), of each consecutive
+// window bases of seq, from -1 for only C's to 1 for only G's. The last
+// window may be shorter. Windows without G's or C's have a skew of 0, and a
+// window below 1 takes all of seq as one window.
+func StrandBias(seq string, window int) []float64 {
+	seq = strings.ToUpper(seq)
+	if window < 1 {
+		window = len(seq)
+	}
+	var skews []float64
+	for start := 0; start < len(seq); start += window {
+		end := start + window
+		if end > len(seq) {
+			end = len(seq)
+		}
+		g := float64(strings.Count(seq[start:end], "G"))
+		c := float64(strings.Count(seq[start:end], "C"))
+		if g+c == 0 {
+			skews = append(skews, 0)
+			continue
+		}
+		skews = append(skews, (g-c)/(g+c))
+	}
+	return skews
+}
+
+// IsLikelyCoding scores the 3 base periodicity of seq, the power at
+// frequency 1/3 of its Fourier spectrum relative to a random sequence of the
+// same composition, and returns the score and whether it is high enough to
+// be a coding sequence. Random sequences score around 1. U counts as T and
+// other characters are skipped. Sequences with fewer than two bases, or of a
+// single base, score 0.
+func IsLikelyCoding(seq string) (float64, bool) {
+	var sums [4]complex128
+	var counts [4]float64
+	length := 0
+	// exp(-2 pi i n / 3) only has three values.
+	phases := [3]complex128{1, cmplx.Exp(complex(0, -2*math.Pi/3)), cmplx.Exp(complex(0, -4*math.Pi/3))}
+	for _, base := range seq {
+		index := baseIndex(base)
+		if index == -1 {
+			continue
+		}
+		sums[index] += phases[length%3]
+		counts[index]++
+		length++
+	}
+	if length < 2 {
+		return 0, false
+	}
+	power, expected := 0.0, 0.0
+	for index, sum := range sums {
+		power += real(sum)*real(sum) + imag(sum)*imag(sum)
+		expected += (float64(length)*counts[index] - counts[index]*counts[index]) / float64(length-1)
+	}
+	if expected == 0 {
+		return 0, false
+	}
+	score := power / expected
+	return score, score > codingThreshold
+}
@@ -0,0 +1,85 @@
+package checks_test
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/checks"
+	"github.com/TimothyStiles/poly/io/genbank"
+)
+
+func TestCompositionBias(t *testing.T) {
+	uniform := [4]float64{0.25, 0.25, 0.25, 0.25}
+	chi2, pValue := checks.CompositionBias(strings.Repeat("ACGT", 25), uniform)
+	if chi2 != 0 || math.Abs(pValue-1) > 1e-12 {
+		t.Errorf("expected a balanced sequence to fit, got chi2 %f and p %f", chi2, pValue)
+	}
+
+	// (35-25)^2/25 + (15-25)^2/25 = 8, which with 3 degrees of freedom has a
+	// p-value of 0.0460.
+	seq := strings.Repeat("A", 35) + strings.Repeat("c", 25) + strings.Repeat("G", 25) + strings.Repeat("U", 15)
+	chi2, pValue = checks.CompositionBias(seq+"NN-", [4]float64{1, 1, 1, 1})
+	if math.Abs(chi2-8) > 1e-9 || math.Abs(pValue-0.0460) > 1e-4 {
+		t.Errorf("expected chi2 8 and p 0.0460, got %f and %f", chi2, pValue)
+	}
+
+	// against a GC rich background, 15 A's and T's are expected and 35 G's
+	// and C's: 15 + 15 + 2 * 15^2/35 = 42.86.
+	chi2, pValue = checks.CompositionBias(strings.Repeat("GC", 50), [4]float64{0.15, 0.35, 0.35, 0.15})
+	if math.Abs(chi2-300.0/7) > 1e-9 || pValue > 1e-6 {
+		t.Errorf("expected a GC only sequence to be biased, got chi2 %f and p %f", chi2, pValue)
+	}
+
+	if chi2, pValue = checks.CompositionBias("NNN", uniform); chi2 != 0 || pValue != 1 {
+		t.Errorf("expected no bases to give chi2 0 and p 1, got %f and %f", chi2, pValue)
+	}
+}
+
+func TestStrandBias(t *testing.T) {
+	skews := checks.StrandBias("GGGGCCCCGGGCATAT", 4)
+	expected := []float64{1, -1, 0.5, 0}
+	if len(skews) != len(expected) {
+		t.Fatalf("expected %d windows, got %v", len(expected), skews)
+	}
+	for index, skew := range skews {
+		if math.Abs(skew-expected[index]) > 1e-12 {
+			t.Errorf("expected window %d to have a skew of %f, got %f", index, expected[index], skew)
+		}
+	}
+	if skews = checks.StrandBias("ggc", 0); len(skews) != 1 || math.Abs(skews[0]-1.0/3) > 1e-12 {
+		t.Errorf("expected one window with a skew of 1/3, got %v", skews)
+	}
+	if skews = checks.StrandBias("GGGGCCC", 4); len(skews) != 2 || skews[1] != -1 {
+		t.Errorf("expected a short last window, got %v", skews)
+	}
+}
+
+func TestIsLikelyCoding(t *testing.T) {
+	puc19, err := genbank.Read("../data/puc19.gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the beta-lactamase CDS of pUC19, at 1284..2144.
+	bla := puc19.Sequence[1283:2144]
+	score, coding := checks.IsLikelyCoding(bla)
+	if !coding {
+		t.Errorf("expected bla to look coding, got a score of %f", score)
+	}
+
+	// shuffling keeps the composition but loses the codons.
+	random := rand.New(rand.NewSource(1))
+	shuffled := []byte(bla)
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	shuffledScore, coding := checks.IsLikelyCoding(string(shuffled))
+	if coding || shuffledScore >= score {
+		t.Errorf("expected shuffled bla not to look coding, got a score of %f against %f", shuffledScore, score)
+	}
+
+	for _, seq := range []string{"", "A", "AAAAAAAAA"} {
+		if score, coding = checks.IsLikelyCoding(seq); score != 0 || coding {
+			t.Errorf("expected %q to score 0, got %f", seq, score)
+		}
+	}
+}
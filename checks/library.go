@@ -0,0 +1,358 @@
+package checks
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+Oligo library checks begin here
+
+Oligo pools are ordered by the thousand, and problems with a pool usually
+only show up after it's been synthesized, amplified and sequenced. A few
+library-wide properties are worth checking before ordering:
+
+	1. Lengths. Pools are priced and synthesized by length, and oligos much
+	   shorter than the rest amplify better and take over the pool.
+	2. Distances. Synthesis and sequencing both make errors, so oligos that
+	   differ by only an edit or two can't be told apart afterwards.
+	   Duplicates are the extreme case, and oligos matching the reverse
+	   complement of another collide once the pool is double stranded.
+	3. Forbidden sites, like the restriction sites of the assembly the pool
+	   is for.
+	4. Per position composition. Array synthesis adds the same base to every
+	   oligo at once, so a position where nearly every oligo has the same base
+	   loads the synthesizer unevenly. Constant regions, like primer sites
+	   shared by every oligo, should be removed before checking this.
+
+Comparing every pair of oligos is too slow for big pools, so pairs are first
+filtered with the q-gram lemma: two sequences within edit distance d of each
+other share at least len - k + 1 - k*d k-mers. Only pairs sharing that many
+k-mers get their exact distance computed.
+
+******************************************************************************/
+
+// LibraryOptions are the thresholds LibraryReport checks a library against.
+type LibraryOptions struct {
+	// MinLength and MaxLength are the allowed oligo lengths. If both are 0,
+	// every oligo must be as long as the most common length.
+	MinLength, MaxLength int
+	// MinDistance is the smallest edit distance allowed between two oligos,
+	// or between an oligo and the reverse complement of another.
+	MinDistance int
+	// ForbiddenSites must not be found in any oligo, on either strand.
+	ForbiddenSites []string
+	// MaxPositionBias is the largest fraction of oligos allowed to have the
+	// same base at a position. 0 turns the check off.
+	MaxPositionBias float64
+}
+
+// DefaultLibraryOptions require uniform lengths, at least 3 edits between
+// oligos, and no more than 80% of one base at any position.
+var DefaultLibraryOptions = LibraryOptions{
+	MinDistance:     3,
+	MaxPositionBias: 0.8,
+}
+
+// OligoPair is a pair of oligos that are too similar.
+type OligoPair struct {
+	Oligos   [2]int // Oligos are indexes into the library, smallest first.
+	Distance int    // Distance is the edit distance between them.
+}
+
+// ForbiddenSiteHit is a forbidden site found in an oligo.
+type ForbiddenSiteHit struct {
+	Oligo    int    // Oligo is an index into the library.
+	Site     string // Site is the forbidden site, as given in the options.
+	Position int    // Position is where the site starts in the oligo, 0 indexed.
+	Reverse  bool   // Reverse is true if the site was found on the bottom strand.
+}
+
+// PositionBias is a position where too many oligos have the same base.
+type PositionBias struct {
+	Position int     // Position is 0 indexed.
+	Base     byte    // Base is the most common base at the position.
+	Fraction float64 // Fraction is the fraction of oligos long enough to reach the position that have Base there.
+}
+
+// LibraryResult lists everything LibraryReport found wrong with a library.
+type LibraryResult struct {
+	Passed                      bool               // Passed is true if nothing was found.
+	LengthOutliers              []int              // LengthOutliers are oligos with a length outside of the allowed range.
+	Duplicates                  []OligoPair        // Duplicates are identical oligos.
+	ClosePairs                  []OligoPair        // ClosePairs are oligos closer than MinDistance, but not identical.
+	ReverseComplementCollisions []OligoPair        // ReverseComplementCollisions are oligos closer than MinDistance to the reverse complement of another.
+	ForbiddenSites              []ForbiddenSiteHit // ForbiddenSites are the forbidden sites found.
+	BiasedPositions             []PositionBias     // BiasedPositions are positions more biased than MaxPositionBias.
+}
+
+// maxLibraryKmer is the longest k-mer used to prefilter pairs of oligos.
+const maxLibraryKmer = 12
+
+// minLibraryKmer is the shortest k-mer worth prefiltering with. Shorter
+// k-mers are shared by almost every pair, so every pair is compared instead.
+const minLibraryKmer = 4
+
+// LibraryReport checks a library of oligos against options before it is
+// ordered. It scales to tens of thousands of oligos.
+func LibraryReport(oligos []string, options LibraryOptions) LibraryResult {
+	upper := make([]string, len(oligos))
+	for index, oligo := range oligos {
+		upper[index] = strings.ToUpper(oligo)
+	}
+
+	var result LibraryResult
+	result.LengthOutliers = lengthOutliers(upper, options.MinLength, options.MaxLength)
+	result.ForbiddenSites = forbiddenSiteHits(upper, options.ForbiddenSites)
+	result.BiasedPositions = biasedPositions(upper, options.MaxPositionBias)
+
+	limit := options.MinDistance - 1
+	if limit < 0 {
+		limit = 0
+	}
+	forward, reverse := closeOligoPairs(upper, limit)
+	for _, pair := range forward {
+		if pair.Distance == 0 {
+			result.Duplicates = append(result.Duplicates, pair)
+		} else {
+			result.ClosePairs = append(result.ClosePairs, pair)
+		}
+	}
+	result.ReverseComplementCollisions = reverse
+
+	result.Passed = len(result.LengthOutliers) == 0 && len(result.Duplicates) == 0 && len(result.ClosePairs) == 0 &&
+		len(result.ReverseComplementCollisions) == 0 && len(result.ForbiddenSites) == 0 && len(result.BiasedPositions) == 0
+	return result
+}
+
+// lengthOutliers returns the oligos shorter than minLength or longer than
+// maxLength, or of a different length than the most common one if both are
+// 0.
+func lengthOutliers(oligos []string, minLength, maxLength int) []int {
+	if minLength == 0 && maxLength == 0 {
+		counts := make(map[int]int)
+		for _, oligo := range oligos {
+			counts[len(oligo)]++
+		}
+		for length, count := range counts {
+			if count > counts[minLength] || (count == counts[minLength] && length < minLength) {
+				minLength = length
+			}
+		}
+		maxLength = minLength
+	}
+	var outliers []int
+	for index, oligo := range oligos {
+		if len(oligo) < minLength || (maxLength > 0 && len(oligo) > maxLength) {
+			outliers = append(outliers, index)
+		}
+	}
+	return outliers
+}
+
+// forbiddenSiteHits finds the first occurrence of each site on each strand of
+// each oligo.
+func forbiddenSiteHits(oligos []string, sites []string) []ForbiddenSiteHit {
+	var hits []ForbiddenSiteHit
+	for index, oligo := range oligos {
+		for _, site := range sites {
+			upperSite := strings.ToUpper(site)
+			if position := strings.Index(oligo, upperSite); position != -1 {
+				hits = append(hits, ForbiddenSiteHit{Oligo: index, Site: site, Position: position})
+			}
+			reverseSite := transform.ReverseComplement(upperSite)
+			if reverseSite == upperSite {
+				continue // palindromic sites are the same on both strands.
+			}
+			if position := strings.Index(oligo, reverseSite); position != -1 {
+				hits = append(hits, ForbiddenSiteHit{Oligo: index, Site: site, Position: position, Reverse: true})
+			}
+		}
+	}
+	return hits
+}
+
+// biasedPositions returns the positions where more than maxBias of the
+// oligos reaching them have the same base.
+func biasedPositions(oligos []string, maxBias float64) []PositionBias {
+	var biased []PositionBias
+	if maxBias <= 0 {
+		return nil
+	}
+	for position := 0; ; position++ {
+		var counts [256]int
+		total := 0
+		for _, oligo := range oligos {
+			if position < len(oligo) {
+				counts[oligo[position]]++
+				total++
+			}
+		}
+		if total == 0 {
+			return biased
+		}
+		var base byte
+		for candidate := range counts {
+			if counts[candidate] > counts[base] {
+				base = byte(candidate)
+			}
+		}
+		if fraction := float64(counts[base]) / float64(total); fraction > maxBias {
+			biased = append(biased, PositionBias{Position: position, Base: base, Fraction: fraction})
+		}
+	}
+}
+
+// closeOligoPairs returns the pairs of oligos within limit edits of each
+// other, and the pairs where one is within limit edits of the reverse
+// complement of the other.
+func closeOligoPairs(oligos []string, limit int) (forward, reverse []OligoPair) {
+	reverseComplements := make([]string, len(oligos))
+	for index, oligo := range oligos {
+		reverseComplements[index] = transform.ReverseComplement(oligo)
+	}
+	compareForward := func(first, second int) {
+		if distance := boundedEditDistance(oligos[first], oligos[second], limit); distance <= limit {
+			forward = append(forward, OligoPair{Oligos: [2]int{first, second}, Distance: distance})
+		}
+	}
+	compareReverse := func(first, second int) {
+		if distance := boundedEditDistance(oligos[first], reverseComplements[second], limit); distance <= limit {
+			reverse = append(reverse, OligoPair{Oligos: [2]int{first, second}, Distance: distance})
+		}
+	}
+
+	shortest := -1
+	for _, oligo := range oligos {
+		if shortest == -1 || len(oligo) < shortest {
+			shortest = len(oligo)
+		}
+	}
+	k := shortest / (limit + 1)
+	if k > maxLibraryKmer {
+		k = maxLibraryKmer
+	}
+	if k < minLibraryKmer {
+		for first := range oligos {
+			for second := first + 1; second < len(oligos); second++ {
+				compareForward(first, second)
+				compareReverse(first, second)
+			}
+		}
+		return forward, reverse
+	}
+
+	// index the k-mers of every oligo and every reverse complement. Reverse
+	// complements get ids offset by the number of oligos.
+	index := make(map[string][]int)
+	for id, sequence := range append(append([]string{}, oligos...), reverseComplements...) {
+		for position := 0; position+k <= len(sequence); position++ {
+			index[sequence[position:position+k]] = append(index[sequence[position:position+k]], id)
+		}
+	}
+	shared := make(map[int]int)
+	for first, oligo := range oligos {
+		for key := range shared {
+			delete(shared, key)
+		}
+		for position := 0; position+k <= len(oligo); position++ {
+			for _, id := range index[oligo[position:position+k]] {
+				if id%len(oligos) > first {
+					shared[id]++
+				}
+			}
+		}
+		threshold := len(oligo) - k + 1 - k*limit
+		var candidates []int
+		for id, count := range shared {
+			if count >= threshold {
+				candidates = append(candidates, id)
+			}
+		}
+		sort.Ints(candidates)
+		for _, id := range candidates {
+			if id < len(oligos) {
+				compareForward(first, id)
+			} else {
+				compareReverse(first, id-len(oligos))
+			}
+		}
+	}
+	return forward, reverse
+}
+
+// boundedEditDistance returns the Levenshtein distance between a and b, or
+// limit+1 if it is more than limit. Only the diagonal band limit wide is
+// computed, so it takes O(len(a) * limit) time.
+func boundedEditDistance(a, b string, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	tooFar := limit + 1
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+		if j > limit {
+			previous[j] = tooFar
+		}
+	}
+	for i := 1; i <= len(a); i++ {
+		low, high := i-limit, i+limit
+		if low < 1 {
+			low = 1
+		}
+		if high > len(b) {
+			high = len(b)
+		}
+		current[0] = i
+		if i > limit {
+			current[0] = tooFar
+		}
+		if low > 1 {
+			current[low-1] = tooFar
+		}
+		rowMinimum := current[0]
+		for j := low; j <= high; j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			best := previous[j-1] + cost
+			if previous[j]+1 < best && j < i+limit {
+				best = previous[j] + 1
+			}
+			if current[j-1]+1 < best {
+				best = current[j-1] + 1
+			}
+			if best > tooFar {
+				best = tooFar
+			}
+			current[j] = best
+			if best < rowMinimum {
+				rowMinimum = best
+			}
+		}
+		if high < len(b) {
+			current[high+1] = tooFar
+		}
+		if rowMinimum > limit {
+			return tooFar
+		}
+		previous, current = current, previous
+	}
+	if previous[len(b)] > limit {
+		return tooFar
+	}
+	return previous[len(b)]
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
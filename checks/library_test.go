@@ -0,0 +1,161 @@
+package checks
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/TimothyStiles/poly/transform"
+)
+
+// randomOligos returns count random oligos of length bases.
+func randomOligos(count, length int, seed int64) []string {
+	random := rand.New(rand.NewSource(seed))
+	oligos := make([]string, count)
+	for index := range oligos {
+		oligo := make([]byte, length)
+		for position := range oligo {
+			oligo[position] = "ACGT"[random.Intn(4)]
+		}
+		oligos[index] = string(oligo)
+	}
+	return oligos
+}
+
+func TestLibraryReport(t *testing.T) {
+	oligos := randomOligos(20, 30, 1)
+	// position 5 is A in all but one oligo.
+	for index := range oligos {
+		base := "A"
+		if index == 0 {
+			base = "C"
+		}
+		oligos[index] = oligos[index][:5] + base + oligos[index][6:]
+	}
+	// 20 is a duplicate of 3, and 21 is 2 substitutions away from 4.
+	near := []byte(oligos[4])
+	for _, position := range []int{10, 20} {
+		near[position] = map[byte]byte{'A': 'C', 'C': 'G', 'G': 'T', 'T': 'A'}[near[position]]
+	}
+	oligos = append(oligos, oligos[3], string(near))
+
+	report := LibraryReport(oligos, DefaultLibraryOptions)
+	if report.Passed {
+		t.Fatal("Expected the library to fail")
+	}
+	if expected := []OligoPair{{Oligos: [2]int{3, 20}, Distance: 0}}; !reflect.DeepEqual(report.Duplicates, expected) {
+		t.Errorf("Expected duplicates %v, got %v", expected, report.Duplicates)
+	}
+	if expected := []OligoPair{{Oligos: [2]int{4, 21}, Distance: 2}}; !reflect.DeepEqual(report.ClosePairs, expected) {
+		t.Errorf("Expected close pairs %v, got %v", expected, report.ClosePairs)
+	}
+	if len(report.BiasedPositions) != 1 || report.BiasedPositions[0].Position != 5 || report.BiasedPositions[0].Base != 'A' {
+		t.Fatalf("Expected position 5 to be biased towards A, got %v", report.BiasedPositions)
+	}
+	if fraction := report.BiasedPositions[0].Fraction; fraction < 0.95 || fraction > 0.96 {
+		t.Errorf("Expected position 5 to be about 95%% A, got %f", fraction)
+	}
+	if report.LengthOutliers != nil || report.ReverseComplementCollisions != nil || report.ForbiddenSites != nil {
+		t.Errorf("Expected no other problems, got %+v", report)
+	}
+}
+
+func TestLibraryReportOtherChecks(t *testing.T) {
+	oligos := randomOligos(10, 30, 2)
+	oligos[2] = oligos[2][:25]
+	oligos[5] = transform.ReverseComplement(oligos[1])
+	oligos[7] = oligos[7][:10] + "GGTCTC" + oligos[7][16:]
+	oligos[8] = oligos[8][:3] + "GAGACC" + oligos[8][9:]
+
+	options := DefaultLibraryOptions
+	options.ForbiddenSites = []string{"GGTCTC"}
+	options.MaxPositionBias = 0
+	report := LibraryReport(oligos, options)
+	if expected := []int{2}; !reflect.DeepEqual(report.LengthOutliers, expected) {
+		t.Errorf("Expected length outliers %v, got %v", expected, report.LengthOutliers)
+	}
+	if expected := []OligoPair{{Oligos: [2]int{1, 5}, Distance: 0}}; !reflect.DeepEqual(report.ReverseComplementCollisions, expected) {
+		t.Errorf("Expected reverse complement collisions %v, got %v", expected, report.ReverseComplementCollisions)
+	}
+	expectedSites := []ForbiddenSiteHit{{Oligo: 7, Site: "GGTCTC", Position: 10}, {Oligo: 8, Site: "GGTCTC", Position: 3, Reverse: true}}
+	if !reflect.DeepEqual(report.ForbiddenSites, expectedSites) {
+		t.Errorf("Expected forbidden sites %v, got %v", expectedSites, report.ForbiddenSites)
+	}
+
+	// a length band accepts the short oligo.
+	options.MinLength, options.MaxLength = 20, 30
+	if report = LibraryReport(oligos, options); report.LengthOutliers != nil {
+		t.Errorf("Expected no length outliers within 20-30 bp, got %v", report.LengthOutliers)
+	}
+
+	if report = LibraryReport(randomOligos(10, 30, 3), DefaultLibraryOptions); !report.Passed {
+		t.Errorf("Expected a random library to pass, got %+v", report)
+	}
+}
+
+func TestLibraryReportPrefilter(t *testing.T) {
+	// the k-mer prefilter must find the same pairs as comparing every pair.
+	oligos := randomOligos(300, 40, 4)
+	random := rand.New(rand.NewSource(5))
+	for index := 0; index < 100; index++ {
+		mutant := []byte(oligos[random.Intn(len(oligos))])
+		for edit := 0; edit < random.Intn(4); edit++ {
+			mutant[random.Intn(len(mutant))] = "ACGT"[random.Intn(4)]
+		}
+		if random.Intn(5) == 0 {
+			mutant = []byte(transform.ReverseComplement(string(mutant)))
+		}
+		if random.Intn(5) == 0 {
+			position := random.Intn(len(mutant))
+			mutant = append(mutant[:position], mutant[position+1:]...)
+		}
+		oligos = append(oligos, string(mutant))
+	}
+
+	forward, reverse := closeOligoPairs(oligos, 2)
+	var bruteForward, bruteReverse []OligoPair
+	for first := range oligos {
+		for second := first + 1; second < len(oligos); second++ {
+			if distance := boundedEditDistance(oligos[first], oligos[second], 2); distance <= 2 {
+				bruteForward = append(bruteForward, OligoPair{Oligos: [2]int{first, second}, Distance: distance})
+			}
+			if distance := boundedEditDistance(oligos[first], transform.ReverseComplement(oligos[second]), 2); distance <= 2 {
+				bruteReverse = append(bruteReverse, OligoPair{Oligos: [2]int{first, second}, Distance: distance})
+			}
+		}
+	}
+	if len(bruteForward) < 50 || len(bruteReverse) < 10 {
+		t.Fatalf("Expected plenty of close pairs to test with, got %d and %d", len(bruteForward), len(bruteReverse))
+	}
+	if !reflect.DeepEqual(forward, bruteForward) || !reflect.DeepEqual(reverse, bruteReverse) {
+		t.Errorf("Prefiltered pairs differ from comparing every pair:\n%v\n%v\n%v\n%v", forward, bruteForward, reverse, bruteReverse)
+	}
+
+	// and it's fast enough for big pools.
+	if report := LibraryReport(randomOligos(10000, 100, 6), DefaultLibraryOptions); !report.Passed {
+		t.Errorf("Expected a random pool of 10000 oligos to pass, got %+v", report)
+	}
+}
+
+func TestBoundedEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		limit    int
+		expected int
+	}{
+		{"ACGT", "ACGT", 2, 0},
+		{"ACGT", "AGGT", 2, 1},
+		{"ACGT", "ACT", 2, 1},
+		{"ACGT", "CGTA", 2, 2},
+		{"ACGTACGT", "TGCATGCA", 2, 3},
+		{"ACGT", "ACGTAAA", 2, 3},
+		{"", "AC", 2, 2},
+		{"KITTEN", "SITTING", 3, 3},
+		{"KITTEN", "SITTING", 2, 3},
+	}
+	for _, test := range tests {
+		if distance := boundedEditDistance(test.a, test.b, test.limit); distance != test.expected {
+			t.Errorf("boundedEditDistance(%s, %s, %d) = %d, expected %d", test.a, test.b, test.limit, distance, test.expected)
+		}
+	}
+}
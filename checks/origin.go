@@ -0,0 +1,232 @@
+package checks
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+Origin identification begins here
+
+Every plasmid needs an origin of replication, and the origin decides a lot
+about how the plasmid behaves: how many copies a cell carries, which hosts it
+works in, and which other plasmids it can live alongside. Two plasmids with
+origins from the same incompatibility group compete for the same replication
+control and one of them gets lost, which is a classic way to waste a week on a
+co-transformation.
+
+Origins are identified here without BLAST by looking for a handful of
+signature motifs from each origin's key elements (the RNA I / RNA II control
+region of ColE1 type origins, the hairpins of phage origins, and so on). An
+origin is reported when at least half of its motifs are found on one strand.
+
+Only the ColE1 signature is tested against a real plasmid, pUC19. The p15A,
+f1 and SV40 motifs are from their reference origins but aren't checked
+against a plasmid in the tests, so a miss on one of them doesn't prove the
+origin isn't there. pSC101, RSF1010 and CloDF13 aren't in the panel yet, so
+plasmids with those origins get no hit and two such plasmids are never
+reported as incompatible. If you work with them, add their motifs to
+OriginSignatures.
+
+******************************************************************************/
+
+// OriginSignature describes an origin of replication and the motifs used to
+// find it.
+type OriginSignature struct {
+	Family               string   // Family is the name of the origin, like ColE1.
+	CopyNumber           string   // CopyNumber is a rough copy number class: high, medium, low or n/a.
+	IncompatibilityGroup string   // IncompatibilityGroup is empty for origins that don't compete.
+	Host                 string   // Host is where the origin works.
+	Motifs               []string // Motifs are IUPAC patterns from the origin's key elements.
+}
+
+// OriginHit is an origin of replication found in a sequence.
+type OriginHit struct {
+	Family               string
+	CopyNumber           string
+	IncompatibilityGroup string
+	Host                 string
+	// Start and End span the matched motifs, 0 indexed and end exclusive. End
+	// may be past the end of the sequence if the origin spans position zero.
+	Start, End    int
+	Reverse       bool // Reverse is true if the origin is on the bottom strand.
+	MotifsMatched int
+	MotifsTotal   int
+}
+
+// Incompatibility is a pair of plasmids whose origins share an
+// incompatibility group, so they can't be stably maintained together.
+type Incompatibility struct {
+	Group    string
+	Plasmids [2]int // Plasmids are indexes into the slice given to FindIncompatibilities.
+}
+
+// OriginSignatures is the panel of origins IdentifyOrigin looks for.
+var OriginSignatures = []OriginSignature{
+	{
+		Family:               "ColE1/pMB1",
+		CopyNumber:           "high",
+		IncompatibilityGroup: "ColE1",
+		Host:                 "E. coli",
+		Motifs: []string{
+			// RNA I
+			"CTGCGCGTAATCTGCTGCTTGCAAAC",
+			"CAAGAGCTACCAACTCTTTTTCCGAAGGTAACTGGCTTCAGCAGAGCGCAGATACC",
+			// RNA II
+			"GCTGAACGGGGGGTTCGTGCACACAGCCCAGCTTGGAGCGAACGACCTACACCGAACTGAGATACC",
+			"GGTATCTTTATAGTCCTGTCGGGTTTCGCCACCTCTGACTTGAGCGTCGATTTTTGTGATGCTCGTCAGG",
+		},
+	},
+	{
+		Family:               "p15A",
+		CopyNumber:           "medium",
+		IncompatibilityGroup: "p15A",
+		Host:                 "E. coli",
+		Motifs: []string{
+			"CTGCGCGTAATCTCTTGCTCTGAAAACGAAAAAACCGCCTTGCAGGGCGG",
+			"GAGCTACCAACTCTTTGAACCGAGGTAACTGGCTTGGAGGAGCGCAGTCACCAAAACTTGTCC",
+			"GTTCGTGCATACAGTCCAGCTTGGAGCGAACTGCCTACCCGGAACTGAGTGTCAGGCGTGGAATGAGACAAACGCGGCC",
+		},
+	},
+	{
+		Family:     "f1",
+		CopyNumber: "n/a",
+		Host:       "E. coli with helper phage",
+		Motifs: []string{
+			"CCCTTTAGGGTTCCGATTTAGTGCTTTACGGCACCTCGACCCC",
+			"AACTTGATTAGGGTGATGGTTCACGTAGTGGGCCATCGCCCTGATAGACGG",
+			"TTTGACGTTGGAGTCCACGTTCTTTAATAGTGGACTCTTGTTCCAAACTGG",
+		},
+	},
+	{
+		Family:     "SV40",
+		CopyNumber: "n/a",
+		Host:       "mammalian cells expressing SV40 large T antigen",
+		Motifs: []string{
+			// core origin
+			"GCAGAGGCCGAGGCCGCCTCGGCCTCTGAGCTATTCCAGAAGTAGTGAGGAGGCTTTTTTGGAGGCCTAGGCTTTTGCAAA",
+			// 72 bp enhancer repeat
+			"CCCAGGCTCCCCAGCAGGCAGAAGTATGCAAAGCATGCATCTCAATTAGTCAGCAACC",
+			// 21 bp GC repeats
+			"CCCGCCCCTAACTCCGCCCATCCCGCCCCTAACTCCGCCCAGTTCCGCCCATTCTCCGCCCC",
+		},
+	},
+}
+
+// IdentifyOrigin finds the origins of replication from OriginSignatures in a
+// plasmid. seq is treated as circular so origins spanning position zero are
+// found. Hits are sorted by position.
+func IdentifyOrigin(seq string) []OriginHit {
+	seq = strings.ToUpper(seq)
+	var hits []OriginHit
+	for _, signature := range OriginSignatures {
+		longest := 0
+		for _, motif := range signature.Motifs {
+			if len(motif) > longest {
+				longest = len(motif)
+			}
+		}
+		wrap := longest - 1
+		if wrap > len(seq) {
+			wrap = len(seq)
+		}
+		forward := seq + seq[:wrap]
+		reverse := transform.ReverseComplement(forward)
+
+		var best OriginHit
+		for strand, strandSeq := range []string{forward, reverse} {
+			hit := OriginHit{Reverse: strand == 1, MotifsTotal: len(signature.Motifs)}
+			var matches [][2]int
+			for _, motif := range signature.Motifs {
+				pattern, err := transform.IUPACToRegexp(motif)
+				if err != nil {
+					continue
+				}
+				location := pattern.FindStringIndex(strandSeq)
+				if location == nil {
+					continue
+				}
+				start, end := location[0], location[1]
+				if hit.Reverse {
+					// back to top strand coordinates.
+					start, end = len(forward)-end, len(forward)-start
+				}
+				if start >= len(seq) {
+					start, end = start-len(seq), end-len(seq)
+				}
+				hit.MotifsMatched++
+				matches = append(matches, [2]int{start, end})
+			}
+			hit.Start, hit.End = circularSpan(matches, len(seq))
+			if hit.MotifsMatched > best.MotifsMatched {
+				best = hit
+			}
+		}
+
+		if best.MotifsMatched*2 < best.MotifsTotal || best.MotifsMatched == 0 {
+			continue
+		}
+		best.Family = signature.Family
+		best.CopyNumber = signature.CopyNumber
+		best.IncompatibilityGroup = signature.IncompatibilityGroup
+		best.Host = signature.Host
+		hits = append(hits, best)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Start < hits[j].Start })
+	return hits
+}
+
+// FindIncompatibilities identifies the origins of each plasmid and returns
+// every pair of plasmids that share an incompatibility group.
+func FindIncompatibilities(plasmids []string) []Incompatibility {
+	groups := make([][]string, len(plasmids))
+	for index, plasmid := range plasmids {
+		for _, hit := range IdentifyOrigin(plasmid) {
+			if hit.IncompatibilityGroup != "" {
+				groups[index] = append(groups[index], hit.IncompatibilityGroup)
+			}
+		}
+	}
+
+	var incompatibilities []Incompatibility
+	for first := range plasmids {
+		for second := first + 1; second < len(plasmids); second++ {
+			for _, group := range groups[first] {
+				for _, otherGroup := range groups[second] {
+					if group == otherGroup {
+						incompatibilities = append(incompatibilities, Incompatibility{Group: group, Plasmids: [2]int{first, second}})
+					}
+				}
+			}
+		}
+	}
+	return incompatibilities
+}
+
+// circularSpan returns the shortest stretch of a circular sequence of length
+// that covers every interval. The span starts right after the largest gap
+// between intervals, so End is past length if the span wraps around zero.
+func circularSpan(intervals [][2]int, length int) (int, int) {
+	if len(intervals) == 0 {
+		return 0, 0
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i][0] < intervals[j][0] })
+	largestGap, after := -1, 0
+	for index, interval := range intervals {
+		next := intervals[(index+1)%len(intervals)][0]
+		if index == len(intervals)-1 {
+			next += length
+		}
+		if gap := next - interval[1]; gap > largestGap {
+			largestGap, after = gap, (index+1)%len(intervals)
+		}
+	}
+	before := (after + len(intervals) - 1) % len(intervals)
+	start, end := intervals[after][0], intervals[before][1]
+	if end <= start {
+		end += length
+	}
+	return start, end
+}
@@ -0,0 +1,64 @@
+package checks_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/checks"
+	"github.com/TimothyStiles/poly/io/genbank"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+func TestIdentifyOrigin(t *testing.T) {
+	puc19, err := genbank.Read("../data/puc19.gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits := checks.IdentifyOrigin(puc19.Sequence)
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 origin in pUC19, got %+v", hits)
+	}
+	hit := hits[0]
+	if hit.Family != "ColE1/pMB1" || hit.IncompatibilityGroup != "ColE1" || hit.CopyNumber != "high" {
+		t.Errorf("expected a ColE1 origin, got %+v", hit)
+	}
+	if hit.MotifsMatched != hit.MotifsTotal || hit.Reverse {
+		t.Errorf("expected every motif on the top strand, got %+v", hit)
+	}
+	// pUC19 annotates its origin at 2315..217, which wraps around position zero.
+	if hit.Start < 2314 || hit.End > len(puc19.Sequence)+217 {
+		t.Errorf("origin found at %d-%d, outside of the annotated origin", hit.Start, hit.End)
+	}
+
+	reverseHits := checks.IdentifyOrigin(transform.ReverseComplement(puc19.Sequence))
+	if len(reverseHits) != 1 || !reverseHits[0].Reverse || reverseHits[0].End-reverseHits[0].Start != hit.End-hit.Start {
+		t.Errorf("expected the same origin on the bottom strand, got %+v", reverseHits)
+	}
+
+	if hits := checks.IdentifyOrigin(strings.Repeat("ACGT", 500)); len(hits) != 0 {
+		t.Errorf("expected no origins, got %+v", hits)
+	}
+}
+
+func TestFindIncompatibilities(t *testing.T) {
+	puc19, err := genbank.Read("../data/puc19.gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second ColE1 plasmid, pUC19 with an insert in the multiple cloning site.
+	insert := "GCGGCCGCATGACCATGATTACGCCAAGCTTGCATGCC"
+	withInsert := puc19.Sequence[:400] + insert + puc19.Sequence[400:]
+	phix, err := genbank.Read("../data/phix174.gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incompatibilities := checks.FindIncompatibilities([]string{puc19.Sequence, phix.Sequence, withInsert})
+	if len(incompatibilities) != 1 {
+		t.Fatalf("expected 1 incompatibility, got %+v", incompatibilities)
+	}
+	if incompatibilities[0].Group != "ColE1" || incompatibilities[0].Plasmids != [2]int{0, 2} {
+		t.Errorf("expected plasmids 0 and 2 to be ColE1 incompatible, got %+v", incompatibilities[0])
+	}
+}
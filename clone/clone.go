@@ -112,6 +112,9 @@ func CutWithEnzymeByName(seq Part, directional bool, enzymeStr string) ([]Fragme
 	if _, ok := enzymeMap[enzymeStr]; !ok {
 		return []Fragment{}, errors.New("Enzyme " + enzymeStr + " not found in enzymeMap")
 	}
+	if err := checks.RequireIUPACAlphabet(seq.Sequence, checks.DNA); err != nil {
+		return []Fragment{}, err
+	}
 	enzyme := enzymeMap[enzymeStr]
 	return CutWithEnzyme(seq, directional, enzyme), nil
 }
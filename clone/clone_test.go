@@ -16,6 +16,18 @@ func TestCutWithEnzymeByName(t *testing.T) {
 	if err == nil {
 		t.Errorf("CutWithEnzymeByName should have failed when looking for fake restriction enzyme EcoFake")
 	}
+
+	// N stretches, like those of GenBank records, can be digested.
+	frag, err := clone.CutWithEnzymeByName(clone.Part{"ATATATATATATATAT" + "GGTCTCANNNNATGC" + "GCGCGCGCGCGCGCGCGCGC", false}, false, "BsaI")
+	if err != nil {
+		t.Errorf("CutWithEnzymeByName should allow ambiguous bases. Got error: %s", err)
+	}
+	if len(frag) != 2 {
+		t.Errorf("Cutting a sequence with ambiguous bases and a single cut site should give 2 fragments, got %d", len(frag))
+	}
+	if _, err = clone.CutWithEnzymeByName(clone.Part{"GGTCTCAUUUUATGC", false}, false, "BsaI"); err == nil {
+		t.Errorf("CutWithEnzymeByName should have failed on RNA")
+	}
 }
 
 func TestCutWithEnzyme(t *testing.T) {
@@ -0,0 +1,236 @@
+package clone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+
+CRISPR target finding and repair simulation begins here.
+
+Cas nucleases are steered by a guide RNA to a protospacer: a stretch of DNA
+matching the guide that sits right next to a short PAM (protospacer adjacent
+motif). Cas9 wants its PAM (NGG for SpCas9) on the 3' side of the protospacer
+and cuts both strands 3 bp away from it, leaving blunt ends. Cas12a wants its
+PAM (TTTV) on the 5' side and cuts 18 and 23 bp away from it, leaving a 5 bp
+5' overhang.
+
+Once cut, cells either glue the ends back together (NHEJ, usually leaving
+small insertions or deletions) or, if a donor with homology to both sides of
+the cut is around, copy the donor across the break (HDR). SimulateHDR
+predicts what HDR makes from a donor.
+
+The on-target score here is a simple heuristic, not a trained model. It
+rewards protospacers with moderate GC content, weighting the PAM-proximal
+seed region more, and penalizes homopolymers, especially TTTT, which
+terminates the U6 promoter guides are usually expressed from. Use it to rank
+guides against each other, not to predict cutting efficiency.
+
+******************************************************************************/
+
+// Target is a protospacer that a Cas nuclease can cut.
+type Target struct {
+	Protospacer string // Protospacer is the guide sequence, 5' to 3', without the PAM.
+	PAM         string // PAM is the PAM as found in the sequence, 5' to 3'.
+	Reverse     bool   // Reverse is true if the protospacer is on the bottom strand.
+	// Start and End are the top strand coordinates of the protospacer, 0
+	// indexed and end exclusive.
+	Start, End int
+	// CutTop and CutBottom are where each strand is cut, in top strand
+	// coordinates: the cut falls right before that index. They are equal for
+	// blunt cuts.
+	CutTop, CutBottom int
+	Score             float64 // Score is an on-target activity heuristic from 0 to 1.
+}
+
+// casNuclease describes where a nuclease needs its PAM and where it cuts.
+type casNuclease struct {
+	fivePrimePAM bool // PAM is 5' of the protospacer, like Cas12a.
+	// senseCut and antisenseCut are how far into the protospacer, from its
+	// PAM side, the protospacer strand and its complement are cut.
+	senseCut, antisenseCut int
+}
+
+// casNucleaseMap has the nucleases of common PAMs. Other PAMs are treated
+// like Cas9.
+var casNucleaseMap = map[string]casNuclease{
+	"NGG":    {false, 3, 3},  // SpCas9
+	"NAG":    {false, 3, 3},  // SpCas9, weakly
+	"NNGRRT": {false, 3, 3},  // SaCas9
+	"TTTV":   {true, 18, 23}, // Cas12a
+	"TTTN":   {true, 18, 23}, // Cas12a, relaxed
+}
+
+// FindCasTargets finds every protospacer of guideLength bases next to pam, an
+// IUPAC sequence like NGG or TTTV, on both strands of a linear seq. Targets
+// are sorted by Start.
+func FindCasTargets(seq string, pam string, guideLength int) []Target {
+	pam = strings.ToUpper(pam)
+	nuclease, ok := casNucleaseMap[pam]
+	if !ok {
+		nuclease = casNucleaseMap["NGG"]
+	}
+	pamPattern, err := transform.IUPACToRegexp(pam)
+	if err != nil || guideLength < 1 {
+		return nil
+	}
+
+	seq = strings.ToUpper(seq)
+	siteLength := len(pam) + guideLength
+	var targets []Target
+	for _, reverse := range []bool{false, true} {
+		strand := seq
+		if reverse {
+			strand = transform.ReverseComplement(seq)
+		}
+		for site := 0; site+siteLength <= len(strand); site++ {
+			pamStart, protospacerStart := site+guideLength, site
+			if nuclease.fivePrimePAM {
+				pamStart, protospacerStart = site, site+len(pam)
+			}
+			// pamPattern isn't anchored, but a match of the same length as pam
+			// always covers it entirely.
+			if !pamPattern.MatchString(strand[pamStart : pamStart+len(pam)]) {
+				continue
+			}
+			protospacer := strand[protospacerStart : protospacerStart+guideLength]
+			if strings.Trim(protospacer, "ACGT") != "" {
+				continue
+			}
+
+			// cuts in this strand's coordinates.
+			senseCut := protospacerStart + guideLength - nuclease.senseCut
+			antisenseCut := protospacerStart + guideLength - nuclease.antisenseCut
+			if nuclease.fivePrimePAM {
+				senseCut = protospacerStart + nuclease.senseCut
+				antisenseCut = protospacerStart + nuclease.antisenseCut
+			}
+			target := Target{
+				Protospacer: protospacer,
+				PAM:         strand[pamStart : pamStart+len(pam)],
+				Reverse:     reverse,
+				Start:       protospacerStart,
+				End:         protospacerStart + guideLength,
+				CutTop:      senseCut,
+				CutBottom:   antisenseCut,
+				Score:       scoreProtospacer(protospacer, nuclease.fivePrimePAM),
+			}
+			if reverse {
+				length := len(seq)
+				target.Start, target.End = length-target.End, length-target.Start
+				target.CutTop, target.CutBottom = length-antisenseCut, length-senseCut
+			}
+			targets = append(targets, target)
+		}
+	}
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].Start < targets[j].Start })
+	return targets
+}
+
+// scoreProtospacer is a heuristic on-target score from 0 to 1.
+func scoreProtospacer(protospacer string, fivePrimePAM bool) float64 {
+	// weight bases near the PAM (the seed) twice as much.
+	const seedLength = 10
+	gc, weights := 0.0, 0.0
+	for index := range protospacer {
+		distanceFromPAM := len(protospacer) - 1 - index
+		if fivePrimePAM {
+			distanceFromPAM = index
+		}
+		weight := 1.0
+		if distanceFromPAM < seedLength {
+			weight = 2
+		}
+		if protospacer[index] == 'G' || protospacer[index] == 'C' {
+			gc += weight
+		}
+		weights += weight
+	}
+	// best between 40% and 60% GC, falling to zero at 10% and 90%.
+	score := 1.0
+	if deviation := gc/weights - 0.5; deviation > 0.1 || deviation < -0.1 {
+		if deviation < 0 {
+			deviation = -deviation
+		}
+		score -= (deviation - 0.1) / 0.3
+	}
+
+	if strings.Contains(protospacer, "TTTT") {
+		score *= 0.1
+	}
+	for _, homopolymer := range []string{"AAAAA", "CCCCC", "GGGGG"} {
+		if strings.Contains(protospacer, homopolymer) {
+			score *= 0.5
+		}
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// SimulateHDR returns seq after a cut at target is repaired by homology
+// directed repair from donor. donor must start with a left homology arm
+// matching seq upstream of the cut and end with a right homology arm matching
+// seq downstream of it, each at least homologyArmMin bases long. Everything
+// between the arms replaces whatever is between their matches in seq, so
+// donors can insert, delete or substitute.
+//
+// For staggered cuts the top strand cut is used as the break.
+func SimulateHDR(seq string, target Target, donor string, homologyArmMin int) (string, error) {
+	upperSeq, upperDonor := strings.ToUpper(seq), strings.ToUpper(donor)
+	cut := target.CutTop
+	switch {
+	case homologyArmMin < 1:
+		return "", errors.New("homologyArmMin must be at least 1")
+	case cut < 0 || cut > len(seq):
+		return "", fmt.Errorf("cut site %d is outside of the sequence", cut)
+	case len(donor) < 2*homologyArmMin:
+		return "", fmt.Errorf("donor of length %d is too short for two %d bp homology arms", len(donor), homologyArmMin)
+	}
+	if err := checks.RequireIUPACAlphabet(seq, checks.DNA); err != nil {
+		return "", err
+	}
+	if err := checks.RequireIUPACAlphabet(donor, checks.DNA); err != nil {
+		return "", fmt.Errorf("donor: %w", err)
+	}
+
+	// the left arm starts at the closest match of the donor's start upstream
+	// of the cut, and extends towards the cut for as long as it matches.
+	leftSeed := upperDonor[:homologyArmMin]
+	leftStart := strings.LastIndex(upperSeq[:cut], leftSeed)
+	if leftStart == -1 {
+		return "", fmt.Errorf("left homology arm %s not found upstream of the cut at %d", leftSeed, cut)
+	}
+	leftLength := homologyArmMin
+	for leftStart+leftLength < cut && leftLength < len(donor) && upperSeq[leftStart+leftLength] == upperDonor[leftLength] {
+		leftLength++
+	}
+
+	// the right arm is the same, mirrored.
+	rightSeed := upperDonor[len(donor)-homologyArmMin:]
+	rightStart := strings.Index(upperSeq[cut:], rightSeed)
+	if rightStart == -1 {
+		return "", fmt.Errorf("right homology arm %s not found downstream of the cut at %d", rightSeed, cut)
+	}
+	rightStart += cut
+	rightLength := homologyArmMin
+	for rightStart > cut && rightLength < len(donor) && upperSeq[rightStart-1] == upperDonor[len(donor)-rightLength-1] {
+		rightStart--
+		rightLength++
+	}
+
+	if leftLength+rightLength > len(donor) {
+		leftLength = len(donor) - rightLength
+		if leftLength < homologyArmMin {
+			return "", errors.New("homology arms overlap in the donor")
+		}
+	}
+	return seq[:leftStart+leftLength] + donor[leftLength:len(donor)-rightLength] + seq[rightStart:], nil
+}
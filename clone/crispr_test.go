@@ -0,0 +1,92 @@
+package clone_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/clone"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+func TestFindCasTargets(t *testing.T) {
+	seq := strings.ToUpper(popen.Sequence[:600])
+	targets := clone.FindCasTargets(seq, "NGG", 20)
+
+	// count every NGG by hand: GG on the top strand with room for a
+	// protospacer upstream, and CC with room downstream.
+	expected := 0
+	for index := 0; index+2 <= len(seq); index++ {
+		if seq[index:index+2] == "GG" && index >= 21 {
+			expected++
+		}
+		if seq[index:index+2] == "CC" && index+23 <= len(seq) {
+			expected++
+		}
+	}
+	if len(targets) != expected {
+		t.Fatalf("expected %d targets, got %d", expected, len(targets))
+	}
+
+	for _, target := range targets {
+		switch {
+		case target.Score < 0 || target.Score > 1:
+			t.Errorf("score %f out of range for %+v", target.Score, target)
+		case !target.Reverse && (target.Protospacer != seq[target.Start:target.End] || seq[target.End+1:target.End+3] != "GG" || target.CutTop != target.End-3):
+			t.Errorf("bad forward target %+v", target)
+		case target.Reverse && (target.Protospacer != transform.ReverseComplement(seq[target.Start:target.End]) || seq[target.Start-3:target.Start-1] != "CC" || target.CutTop != target.Start+3):
+			t.Errorf("bad reverse target %+v", target)
+		case target.CutTop != target.CutBottom:
+			t.Errorf("Cas9 cuts should be blunt, got %+v", target)
+		}
+	}
+}
+
+func TestFindCasTargetsCas12a(t *testing.T) {
+	protospacer := "GACGTCAGCTAGGCATCGAC"
+	targets := clone.FindCasTargets("TTTA"+protospacer+"AGCT", "TTTV", 20)
+	if len(targets) != 1 {
+		t.Fatalf("expected 1 target, got %+v", targets)
+	}
+	if target := targets[0]; target.Protospacer != protospacer || target.Start != 4 || target.CutTop != 22 || target.CutBottom != 27 {
+		t.Errorf("unexpected target %+v", target)
+	}
+}
+
+func TestSimulateHDR(t *testing.T) {
+	seq := popen.Sequence[:600]
+	var target clone.Target
+	for _, candidate := range clone.FindCasTargets(seq, "NGG", 20) {
+		if candidate.CutTop > 250 {
+			target = candidate
+			break
+		}
+	}
+	cut := target.CutTop
+
+	// knock in an EcoRI site at the cut.
+	donor := seq[cut-40:cut] + "GAATTC" + seq[cut:cut+40]
+	edited, err := clone.SimulateHDR(seq, target, donor, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := seq[:cut] + "GAATTC" + seq[cut:]; edited != expected {
+		t.Errorf("knock in: expected %s, got %s", expected, edited)
+	}
+
+	// delete 10 bases after the cut.
+	donor = seq[cut-40:cut] + seq[cut+10:cut+50]
+	edited, err = clone.SimulateHDR(seq, target, donor, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := seq[:cut] + seq[cut+10:]; edited != expected {
+		t.Errorf("deletion: expected %s, got %s", expected, edited)
+	}
+
+	if _, err := clone.SimulateHDR(seq, target, strings.Repeat("A", 80), 30); err == nil {
+		t.Errorf("donor without homology should fail")
+	}
+	if _, err := clone.SimulateHDR(seq, target, seq[cut-20:cut+20], 30); err == nil {
+		t.Errorf("donor with short arms should fail")
+	}
+}
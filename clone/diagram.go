@@ -0,0 +1,36 @@
+package clone
+
+import (
+	"fmt"
+
+	"github.com/TimothyStiles/poly/bio"
+)
+
+// LigationDiagram returns a diagram of fragments ligating into construct,
+// like the fragments of a GoldenGate reaction, for bio.Diagram.DOT or
+// bio.Diagram.Mermaid. Fragments are joined by an edge labeled with their
+// overhang wherever the reverse overhang of one matches the forward overhang
+// of another. An empty construct leaves out the construct node.
+func LigationDiagram(fragments []Fragment, construct string) bio.Diagram {
+	diagram := bio.Diagram{Title: "ligation"}
+	id := func(index int) string { return fmt.Sprintf("fragment %03d", index+1) }
+	for index, fragment := range fragments {
+		length := len(fragment.ForwardOverhang) + len(fragment.Sequence) + len(fragment.ReverseOverhang)
+		label := fmt.Sprintf("fragment %d\n%d bp\n%s...%s", index+1, length, fragment.ForwardOverhang, fragment.ReverseOverhang)
+		diagram.Nodes = append(diagram.Nodes, bio.DiagramNode{ID: id(index), Kind: bio.FragmentNode, Label: label})
+	}
+	for first, fragment := range fragments {
+		for second, next := range fragments {
+			if first != second && fragment.ReverseOverhang != "" && fragment.ReverseOverhang == next.ForwardOverhang {
+				diagram.Edges = append(diagram.Edges, bio.DiagramEdge{From: id(first), To: id(second), Label: fragment.ReverseOverhang})
+			}
+		}
+	}
+	if construct != "" {
+		diagram.Nodes = append(diagram.Nodes, bio.DiagramNode{ID: "construct", Kind: bio.ConstructNode, Label: fmt.Sprintf("construct\n%d bp", len(construct))})
+		for index := range fragments {
+			diagram.Edges = append(diagram.Edges, bio.DiagramEdge{From: id(index), To: "construct"})
+		}
+	}
+	return diagram
+}
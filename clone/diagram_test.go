@@ -0,0 +1,40 @@
+package clone_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/TimothyStiles/poly/clone"
+)
+
+func TestLigationDiagram(t *testing.T) {
+	// a promoter, a CDS and a backbone with MoClo overhangs.
+	fragments := []clone.Fragment{
+		{Sequence: "TTGACAGCTAGCTCAGTCCTAGGTATAATGCTAGC", ForwardOverhang: "GGAG", ReverseOverhang: "AATG"},
+		{Sequence: "CGTAAAGGAGAAGAACTTTTCACTGGAGTTGTCCCAATTCTTGTTGAATTAGATGGTGATGTTAATGGGCACAAATTTTCTGTCTAA", ForwardOverhang: "AATG", ReverseOverhang: "GCTT"},
+		{Sequence: "CCAGGCATCAAATAAAACGAAAGGCTCAGTCGAAAGACTGGGCCTTTCGTTTTATCTGTTGTTTGTCGGTGAACGCTCTCTACTAGAGTCACACTGGCTCACCTTCGGGTGGGCCTTTCTGCGTTTATA", ForwardOverhang: "GCTT", ReverseOverhang: "GGAG"},
+	}
+	constructs, _, err := clone.CircularLigate(fragments)
+	if err != nil || len(constructs) == 0 {
+		t.Fatalf("expected the fragments to ligate, got %v", err)
+	}
+	diagram := clone.LigationDiagram(fragments, constructs[0])
+	diagram.Title = "Golden Gate"
+	dot, err := diagram.DOT()
+	if err != nil {
+		t.Fatalf("DOT failed: %s", err)
+	}
+	mermaid, err := diagram.Mermaid()
+	if err != nil {
+		t.Fatalf("Mermaid failed: %s", err)
+	}
+	for path, got := range map[string]string{"data/golden_gate.dot": dot, "data/golden_gate.mmd": mermaid} {
+		expected, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read golden file: %s", err)
+		}
+		if got != string(expected) {
+			t.Errorf("output differs from %s, got:\n%s", path, got)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package clone
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/TimothyStiles/poly/align"
+	"github.com/TimothyStiles/poly/align/matrix"
+	"github.com/TimothyStiles/poly/alphabet"
+	"github.com/TimothyStiles/poly/io/fasta"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+
+Construct verification begins here.
+
+After a clone is picked it gets Sanger sequenced, and somebody has to squint at
+the reads to decide whether the plasmid is what was ordered. VerifyConstruct
+does the squinting:
+
+	1. Each read is placed on the construct in both orientations by counting
+	   shared k-mers along each diagonal.
+	2. It is then aligned with align.BandedSemiGlobal around that diagonal,
+	   so a read costs O(read length * band) rather than O(read length *
+	   construct length).
+	3. Sanger reads are garbage at both ends. FASTA has no quality scores to
+	   trim by, so the alignment is soft clipped instead: ends are trimmed
+	   until a window of the alignment reaches a minimum identity.
+	4. Every remaining mismatch, insertion and deletion is tallied along with
+	   how many reads support it, and every base is marked verified,
+	   unverified (not enough coverage) or conflicted (a read disagrees).
+
+Circular constructs are handled by aligning against the construct twice over,
+so reads spanning the origin align in one piece.
+
+******************************************************************************/
+
+// Verification statuses of construct bases, regions and features.
+const (
+	Verified   = "verified"
+	Unverified = "unverified"
+	Conflicted = "conflicted"
+)
+
+// Types of Variant.
+const (
+	Mismatch  = "mismatch"
+	Insertion = "insertion"
+	Deletion  = "deletion"
+)
+
+// VerifyFeature is an annotated region of a construct, 0 indexed and end
+// exclusive, whose verification status should be reported.
+type VerifyFeature struct {
+	Name       string
+	Start, End int
+}
+
+// VerifyOptions configures VerifyConstruct.
+type VerifyOptions struct {
+	// SeedLength is the k-mer length used to place reads on the construct.
+	SeedLength int
+	// Bandwidth is how far an alignment may stray from its seeded diagonal.
+	Bandwidth int
+	// MinCoverage is the number of reads that must cover a base to verify it.
+	MinCoverage int
+	// ClipWindow is the window size used to soft clip read ends.
+	ClipWindow int
+	// MinClipIdentity is the identity a window must reach to stop clipping.
+	MinClipIdentity float64
+	// MinReadIdentity is the identity a clipped read needs to be used at all.
+	MinReadIdentity float64
+	// Features are reported on individually if provided.
+	Features []VerifyFeature
+}
+
+// DefaultVerifyOptions are sensible options for Sanger reads.
+var DefaultVerifyOptions = VerifyOptions{
+	SeedLength:      12,
+	Bandwidth:       20,
+	MinCoverage:     1,
+	ClipWindow:      20,
+	MinClipIdentity: 0.8,
+	MinReadIdentity: 0.9,
+}
+
+// ReadAlignment describes where a read aligned on a construct.
+type ReadAlignment struct {
+	Name    string
+	Reverse bool // Reverse is true if the read is the reverse complement of the construct.
+	// Start and End are the aligned region of the construct, 0 indexed and end
+	// exclusive. End may be past the end of a circular construct if the read
+	// spans the origin.
+	Start, End int
+	// ClipStart and ClipEnd are how many bases were soft clipped from the 5'
+	// and 3' end of the read.
+	ClipStart, ClipEnd int
+	Identity           float64
+}
+
+// Variant is a difference between the reads and the construct.
+type Variant struct {
+	Position int    // Position is where on the construct the variant is, 0 indexed. Insertions come before Position.
+	Type     string // Type is Mismatch, Insertion or Deletion.
+	Expected string // Expected is the construct sequence.
+	Observed string // Observed is the read sequence.
+	Support  int    // Support is the number of reads with this variant.
+	Coverage int    // Coverage is the number of reads covering Position.
+}
+
+// VerifyRegion is a stretch of a construct with a single verification status.
+type VerifyRegion struct {
+	Name       string
+	Start, End int
+	Status     string
+}
+
+// VerificationReport is the result of VerifyConstruct.
+type VerificationReport struct {
+	// Verified is true if every base of the construct, or of every feature
+	// if features were provided, is verified.
+	Verified   bool
+	Coverage   []int
+	Alignments []ReadAlignment
+	Unmapped   []string // Unmapped are the names of reads that did not align, including reads shorter than SeedLength.
+	Variants   []Variant
+	Regions    []VerifyRegion
+	Features   []VerifyRegion
+}
+
+// alignmentOp is a single column of an alignment. Deletions are construct
+// bases missing from the read and insertions are read bases missing from the
+// construct.
+type alignmentOp struct {
+	kind     byte // 'M', 'I' or 'D'
+	position int  // position on the reference, or the next reference base for insertions
+	readBase byte
+	refBase  byte
+}
+
+// VerifyConstruct aligns Sanger reads to a construct and reports which parts
+// of it are verified. See VerifyOptions and DefaultVerifyOptions.
+func VerifyConstruct(construct string, circular bool, reads []fasta.Fasta, opts VerifyOptions) (VerificationReport, error) {
+	construct = strings.ToUpper(construct)
+	if len(construct) == 0 {
+		return VerificationReport{}, errors.New("construct is empty")
+	}
+	if opts.SeedLength <= 0 || opts.Bandwidth <= 0 || opts.ClipWindow <= 0 {
+		return VerificationReport{}, errors.New("SeedLength, Bandwidth and ClipWindow must be greater than zero")
+	}
+	for _, feature := range opts.Features {
+		if feature.Start < 0 || feature.End > len(construct) || feature.Start >= feature.End {
+			return VerificationReport{}, errors.New("feature " + feature.Name + " is out of bounds")
+		}
+	}
+
+	reference := construct
+	if circular {
+		reference += construct
+	}
+	seeds := kmerIndex(reference, opts.SeedLength)
+
+	report := VerificationReport{Coverage: make([]int, len(construct))}
+	type variantKey struct {
+		position                 int
+		kind, expected, observed string
+	}
+	support := map[variantKey]int{}
+
+	for _, read := range reads {
+		alignment, ops, ok := alignRead(reference, len(construct), circular, seeds, read, opts)
+		if !ok {
+			report.Unmapped = append(report.Unmapped, read.Name)
+			continue
+		}
+		report.Alignments = append(report.Alignments, alignment)
+
+		for _, op := range ops {
+			if op.kind != 'I' && op.readBase != 'N' {
+				report.Coverage[op.position%len(construct)]++
+			}
+		}
+		for _, variant := range readVariants(ops, len(construct)) {
+			support[variantKey{variant.Position, variant.Type, variant.Expected, variant.Observed}]++
+		}
+	}
+
+	conflicted := make([]bool, len(construct))
+	for key, count := range support {
+		report.Variants = append(report.Variants, Variant{
+			Position: key.position,
+			Type:     key.kind,
+			Expected: key.expected,
+			Observed: key.observed,
+			Support:  count,
+			Coverage: report.Coverage[key.position],
+		})
+		span := len(key.expected)
+		if span == 0 {
+			span = 1
+		}
+		for offset := 0; offset < span; offset++ {
+			conflicted[(key.position+offset)%len(construct)] = true
+		}
+	}
+	sort.Slice(report.Variants, func(i, j int) bool {
+		if report.Variants[i].Position != report.Variants[j].Position {
+			return report.Variants[i].Position < report.Variants[j].Position
+		}
+		return report.Variants[i].Type < report.Variants[j].Type
+	})
+
+	statuses := make([]string, len(construct))
+	for position := range statuses {
+		switch {
+		case conflicted[position]:
+			statuses[position] = Conflicted
+		case report.Coverage[position] < opts.MinCoverage:
+			statuses[position] = Unverified
+		default:
+			statuses[position] = Verified
+		}
+	}
+	for start := 0; start < len(statuses); {
+		end := start + 1
+		for end < len(statuses) && statuses[end] == statuses[start] {
+			end++
+		}
+		report.Regions = append(report.Regions, VerifyRegion{Start: start, End: end, Status: statuses[start]})
+		start = end
+	}
+
+	report.Verified = true
+	if len(opts.Features) == 0 {
+		report.Verified = len(report.Regions) == 1 && report.Regions[0].Status == Verified
+	}
+	for _, feature := range opts.Features {
+		status := Verified
+		for _, baseStatus := range statuses[feature.Start:feature.End] {
+			if baseStatus == Conflicted {
+				status = Conflicted
+				break
+			}
+			if baseStatus == Unverified {
+				status = Unverified
+			}
+		}
+		report.Verified = report.Verified && status == Verified
+		report.Features = append(report.Features, VerifyRegion{Name: feature.Name, Start: feature.Start, End: feature.End, Status: status})
+	}
+	return report, nil
+}
+
+// alignRead places read on reference in whichever orientation shares the
+// most seeds, aligns it, and soft clips it. It returns false if the read
+// is shorter than a seed, could not be placed or is too divergent after
+// clipping.
+func alignRead(reference string, constructLength int, circular bool, seeds map[string][]int, read fasta.Fasta, opts VerifyOptions) (ReadAlignment, []alignmentOp, bool) {
+	forward := strings.ToUpper(read.Sequence)
+	if len(forward) < opts.SeedLength {
+		return ReadAlignment{}, nil, false
+	}
+	orientations := []string{forward, transform.ReverseComplement(forward)}
+
+	bestVotes, bestOrientation, bestDiagonal := 0, 0, 0
+	for orientation, sequence := range orientations {
+		votes := map[int]int{}
+		for position := 0; position+opts.SeedLength <= len(sequence); position++ {
+			for _, hit := range seeds[sequence[position:position+opts.SeedLength]] {
+				diagonal := hit - position
+				if circular {
+					diagonal = ((diagonal % constructLength) + constructLength) % constructLength
+				}
+				votes[diagonal]++
+			}
+		}
+		// ties go to the leftmost diagonal so results don't depend on map order.
+		orientationVotes, orientationDiagonal := 0, 0
+		for diagonal, count := range votes {
+			if count > orientationVotes || (count == orientationVotes && diagonal < orientationDiagonal) {
+				orientationVotes, orientationDiagonal = count, diagonal
+			}
+		}
+		if orientationVotes > bestVotes {
+			bestVotes, bestOrientation, bestDiagonal = orientationVotes, orientation, orientationDiagonal
+		}
+	}
+	if bestVotes == 0 {
+		return ReadAlignment{}, nil, false
+	}
+
+	sequence := orientations[bestOrientation]
+	ops := bandedAlign(reference, sequence, bestDiagonal, opts.Bandwidth)
+	clipStart, clipEnd, ops := softClip(ops, opts.ClipWindow, opts.MinClipIdentity)
+	if len(ops) == 0 {
+		return ReadAlignment{}, nil, false
+	}
+	matches := 0
+	for _, op := range ops {
+		if op.kind == 'M' && op.readBase == op.refBase {
+			matches++
+		}
+	}
+	identity := float64(matches) / float64(len(ops))
+	if identity < opts.MinReadIdentity {
+		return ReadAlignment{}, nil, false
+	}
+
+	alignment := ReadAlignment{
+		Name:      read.Name,
+		Reverse:   bestOrientation == 1,
+		Start:     ops[0].position % constructLength,
+		End:       ops[0].position%constructLength + ops[len(ops)-1].position + 1 - ops[0].position,
+		ClipStart: clipStart,
+		ClipEnd:   clipEnd,
+		Identity:  identity,
+	}
+	if alignment.Reverse {
+		alignment.ClipStart, alignment.ClipEnd = clipEnd, clipStart
+	}
+	return alignment, ops, true
+}
+
+// verifyScoring scores read alignments: matches 2, mismatches -3, and affine
+// gaps so that an indel is reported as a single run.
+var verifyScoring = func() align.AffineScoring {
+	letters := make([]string, 26)
+	scores := make([][]int, 26)
+	for first := range letters {
+		letters[first] = string(rune('A' + first))
+		scores[first] = make([]int, 26)
+		for second := range scores[first] {
+			scores[first][second] = -3
+		}
+		scores[first][first] = 2
+	}
+	substitutionMatrix, _ := matrix.NewSubstitutionMatrix(alphabet.NewAlphabet(letters), alphabet.NewAlphabet(letters), scores)
+	return align.AffineScoring{SubstitutionMatrix: substitutionMatrix, GapOpen: -6, GapExtend: -2}
+}()
+
+// bandedAlign aligns all of read to the part of reference around diagonal,
+// where diagonal is the reference position expected to align with the first
+// base of read, and returns the alignment's columns. It returns nil if read
+// can't be aligned there.
+func bandedAlign(reference, read string, diagonal, bandwidth int) []alignmentOp {
+	_, position, alignedReference, alignedRead, err := align.BandedSemiGlobal(reference, read, diagonal, bandwidth, verifyScoring)
+	if err != nil {
+		return nil
+	}
+	ops := make([]alignmentOp, 0, len(alignedRead))
+	for index := range alignedRead {
+		switch {
+		case alignedReference[index] == '-':
+			ops = append(ops, alignmentOp{kind: 'I', position: position, readBase: alignedRead[index]})
+		case alignedRead[index] == '-':
+			ops = append(ops, alignmentOp{kind: 'D', position: position, refBase: alignedReference[index]})
+			position++
+		default:
+			ops = append(ops, alignmentOp{kind: 'M', position: position, readBase: alignedRead[index], refBase: alignedReference[index]})
+			position++
+		}
+	}
+	return ops
+}
+
+// softClip trims both ends of an alignment until a window of it reaches
+// minIdentity, then trims any mismatches and gaps left at the ends. It
+// returns the number of read bases clipped from the start and end of the
+// alignment.
+func softClip(ops []alignmentOp, window int, minIdentity float64) (int, int, []alignmentOp) {
+	isMatch := func(op alignmentOp) bool { return op.kind == 'M' && op.readBase == op.refBase }
+	good := func(ops []alignmentOp) bool {
+		matches := 0
+		for _, op := range ops {
+			if isMatch(op) {
+				matches++
+			}
+		}
+		return float64(matches) >= minIdentity*float64(len(ops))
+	}
+	if window > len(ops) {
+		window = len(ops)
+	}
+
+	start := 0
+	for start+window <= len(ops) && !good(ops[start:start+window]) {
+		start++
+	}
+	end := len(ops)
+	for end-window >= start && !good(ops[end-window:end]) {
+		end--
+	}
+
+	// a window can still end in a few mismatches, so finish by trimming each
+	// end back to wherever the alignment score stops dropping.
+	score := func(op alignmentOp) int {
+		if isMatch(op) {
+			return 2
+		}
+		return -3
+	}
+	lowest, total := 0, 0
+	for index := start; index < end; index++ {
+		total += score(ops[index])
+		if total < lowest {
+			lowest, start = total, index+1
+		}
+	}
+	lowest, total = 0, 0
+	for index := end - 1; index >= start; index-- {
+		total += score(ops[index])
+		if total < lowest {
+			lowest, end = total, index
+		}
+	}
+
+	readBases := func(ops []alignmentOp) int {
+		count := 0
+		for _, op := range ops {
+			if op.kind != 'D' {
+				count++
+			}
+		}
+		return count
+	}
+	return readBases(ops[:start]), readBases(ops[end:]), ops[start:end]
+}
+
+// readVariants returns the variants in a single read's alignment, merging
+// runs of insertions and deletions into single variants.
+func readVariants(ops []alignmentOp, constructLength int) []Variant {
+	var variants []Variant
+	for index := 0; index < len(ops); index++ {
+		op := ops[index]
+		switch op.kind {
+		case 'M':
+			if op.readBase != op.refBase && op.readBase != 'N' {
+				variants = append(variants, Variant{Position: op.position % constructLength, Type: Mismatch, Expected: string(op.refBase), Observed: string(op.readBase)})
+			}
+		case 'I', 'D':
+			run := index
+			for run < len(ops) && ops[run].kind == op.kind {
+				run++
+			}
+			variant := Variant{Position: op.position % constructLength}
+			for _, gapOp := range ops[index:run] {
+				if op.kind == 'I' {
+					variant.Type = Insertion
+					variant.Observed += string(gapOp.readBase)
+				} else {
+					variant.Type = Deletion
+					variant.Expected += string(gapOp.refBase)
+				}
+			}
+			variants = append(variants, variant)
+			index = run - 1
+		}
+	}
+	return variants
+}
+
+// kmerIndex maps every k-mer of sequence to the positions it starts at.
+func kmerIndex(sequence string, k int) map[string][]int {
+	index := map[string][]int{}
+	for position := 0; position+k <= len(sequence); position++ {
+		kmer := sequence[position : position+k]
+		index[kmer] = append(index[kmer], position)
+	}
+	return index
+}
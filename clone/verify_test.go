@@ -0,0 +1,126 @@
+package clone_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/clone"
+	"github.com/TimothyStiles/poly/io/fasta"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+func TestVerifyConstruct(t *testing.T) {
+	construct := strings.ToUpper(popen.Sequence[:2000])
+
+	// the second read has an engineered mismatch at 1000 and junk on both
+	// ends, like a real Sanger read. Nothing covers 1300 to 1500.
+	mutated := []byte(construct[600:1300])
+	mutated[400] = map[byte]byte{'A': 'C', 'C': 'G', 'G': 'T', 'T': 'A'}[mutated[400]]
+	reads := []fasta.Fasta{
+		{Name: "read1", Sequence: construct[:700]},
+		{Name: "read2", Sequence: "GTGTCCATTAGGACTTACA" + transform.ReverseComplement(string(mutated)) + "TTTTTTTTCAGA"},
+		{Name: "read3", Sequence: strings.ToLower(construct[1500:])},
+		{Name: "junk", Sequence: strings.Repeat("ACGT", 50)},
+		{Name: "short", Sequence: construct[100:111]},
+		{Name: "empty"},
+	}
+	opts := clone.DefaultVerifyOptions
+	opts.Features = []clone.VerifyFeature{
+		{Name: "promoter", Start: 100, End: 200},
+		{Name: "cds", Start: 950, End: 1100},
+		{Name: "terminator", Start: 1350, End: 1400},
+	}
+
+	report, err := clone.VerifyConstruct(construct, false, reads, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verified {
+		t.Errorf("construct should not be verified")
+	}
+	// reads shorter than a seed can't be placed, even if they match.
+	if strings.Join(report.Unmapped, ",") != "junk,short,empty" {
+		t.Errorf("expected the junk, short and empty reads to be unmapped, got %v", report.Unmapped)
+	}
+
+	read2 := report.Alignments[1]
+	if !read2.Reverse || read2.Start != 600 || read2.End != 1300 || read2.ClipStart != 19 || read2.ClipEnd != 12 {
+		t.Errorf("read2 aligned badly: %+v", read2)
+	}
+
+	if len(report.Variants) != 1 {
+		t.Fatalf("expected 1 variant, got %+v", report.Variants)
+	}
+	variant := report.Variants[0]
+	if variant.Position != 1000 || variant.Type != clone.Mismatch || variant.Expected != construct[1000:1001] || variant.Support != 1 || variant.Coverage != 1 {
+		t.Errorf("unexpected variant %+v", variant)
+	}
+
+	expectedRegions := []clone.VerifyRegion{
+		{Start: 0, End: 1000, Status: clone.Verified},
+		{Start: 1000, End: 1001, Status: clone.Conflicted},
+		{Start: 1001, End: 1300, Status: clone.Verified},
+		{Start: 1300, End: 1500, Status: clone.Unverified},
+		{Start: 1500, End: 2000, Status: clone.Verified},
+	}
+	if len(report.Regions) != len(expectedRegions) {
+		t.Fatalf("expected regions %v, got %v", expectedRegions, report.Regions)
+	}
+	for index, region := range report.Regions {
+		if region != expectedRegions[index] {
+			t.Errorf("region %d: expected %v, got %v", index, expectedRegions[index], region)
+		}
+	}
+
+	for index, status := range []string{clone.Verified, clone.Conflicted, clone.Unverified} {
+		if report.Features[index].Status != status {
+			t.Errorf("feature %s: expected %s, got %s", report.Features[index].Name, status, report.Features[index].Status)
+		}
+	}
+}
+
+func TestVerifyConstructCircular(t *testing.T) {
+	construct := strings.ToUpper(popen.Sequence)
+	length := len(construct)
+
+	// the first read spans the origin and has a 3 base deletion.
+	reads := []fasta.Fasta{
+		{Name: "origin", Sequence: construct[length-400:] + construct[:200] + construct[203:600]},
+	}
+	for start := 500; start < length-400; start += 500 {
+		end := start + 600
+		if end > length-400 {
+			end = length - 400
+		}
+		reads = append(reads, fasta.Fasta{Name: "tile", Sequence: construct[start:end]})
+	}
+
+	report, err := clone.VerifyConstruct(construct, true, reads, clone.DefaultVerifyOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := report.Alignments[0]
+	if origin.Start != length-400 || origin.End != length+600 {
+		t.Errorf("origin read aligned to %d-%d", origin.Start, origin.End)
+	}
+	if len(report.Variants) != 1 || report.Variants[0].Type != clone.Deletion || report.Variants[0].Expected != construct[200:203] {
+		t.Errorf("expected a 3 base deletion, got %+v", report.Variants)
+	}
+	if report.Coverage[length-1] != 1 || report.Coverage[0] != 1 {
+		t.Errorf("origin should be covered, got %d and %d", report.Coverage[length-1], report.Coverage[0])
+	}
+}
+
+func TestVerifyConstructErrors(t *testing.T) {
+	if _, err := clone.VerifyConstruct("", false, nil, clone.DefaultVerifyOptions); err == nil {
+		t.Errorf("empty construct should fail")
+	}
+	if _, err := clone.VerifyConstruct("ACGT", false, nil, clone.VerifyOptions{}); err == nil {
+		t.Errorf("zero options should fail")
+	}
+	opts := clone.DefaultVerifyOptions
+	opts.Features = []clone.VerifyFeature{{Name: "bad", Start: 2, End: 10}}
+	if _, err := clone.VerifyConstruct("ACGT", false, nil, opts); err == nil {
+		t.Errorf("out of bounds feature should fail")
+	}
+}
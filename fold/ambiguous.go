@@ -0,0 +1,172 @@
+package fold
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+)
+
+/******************************************************************************
+
+Ambiguous folding begins here
+
+Degenerate primers and trimmed Sanger reads have IUPAC ambiguity codes, like
+N or R, which Zuker rejects since there are no energies for them. Folding
+every sequence an ambiguous one could be is exponential in the number of
+ambiguous bases, so Zuker approximates it instead, with one of two
+AmbiguityHandling modes set by WithAmbiguityHandling.
+
+Pessimistic lets an ambiguous base pair with any
+base that one of the bases it could be pairs with, and scores each loop
+with the most stable bases it could be. That is the worst case for a
+primer, the most stable structure any of its sequences could fold into, so
+a degenerate primer that folds poorly here folds poorly as every one of its
+sequences. Each loop picks its bases on its own, though, so two loops
+sharing an ambiguous base can each pick a different base for it, and the
+energy can be lower than that of any one sequence.
+
+Skip treats an ambiguous base as unknown, like an N in a read usually is:
+it never pairs, and the loops around it get no energy from it.
+
+******************************************************************************/
+
+// AmbiguityHandling is how Zuker folds the IUPAC ambiguity codes R, Y, S,
+// W, K, M, B, D, H, V and N.
+type AmbiguityHandling int
+
+const (
+	// Reject returns an error for sequences with ambiguity codes.
+	Reject AmbiguityHandling = iota
+	// Skip folds ambiguous bases as bases that never pair.
+	Skip
+	// Pessimistic folds ambiguous bases as the most stable bases they could
+	// be, pairing with anything one of them pairs with.
+	Pessimistic
+)
+
+// ZukerOption changes how Zuker folds.
+type ZukerOption func(*zukerOptions)
+
+type zukerOptions struct {
+	ambiguity AmbiguityHandling
+}
+
+// WithAmbiguityHandling sets how Zuker folds ambiguity codes, Reject unless
+// changed. With Skip or Pessimistic, a seq with a U is folded as RNA,
+// otherwise as DNA, and characters that are neither ambiguity codes nor
+// bases of that alphabet are still an error.
+func WithAmbiguityHandling(mode AmbiguityHandling) ZukerOption {
+	return func(options *zukerOptions) {
+		options.ambiguity = mode
+	}
+}
+
+// FoldAmbiguous is Zuker(seq, temp, WithAmbiguityHandling(Pessimistic)).
+//
+// Deprecated: Use Zuker with WithAmbiguityHandling(Pessimistic) instead.
+func FoldAmbiguous(seq string, temp float64) (Result, error) {
+	return Zuker(seq, temp, WithAmbiguityHandling(Pessimistic))
+}
+
+// newAmbiguousContext is newFoldingContext for a seq that can have
+// ambiguity codes, folded as mode, Skip or Pessimistic, says.
+func newAmbiguousContext(seq string, temp float64, mode AmbiguityHandling) (context, error) {
+	if mode != Skip && mode != Pessimistic {
+		return context{}, fmt.Errorf("unknown ambiguity handling %d", mode)
+	}
+	if err := checkTemperature(temp); err != nil {
+		return context{}, err
+	}
+	seq = strings.ToUpper(seq)
+	energyMap, err := ambiguousEnergies(seq)
+	if err != nil {
+		return context{}, err
+	}
+	codes := encodeSequence(seq)
+	if mode == Skip {
+		for index, code := range codes {
+			if code >= baseCodes {
+				codes[index] = noBase
+			}
+		}
+	}
+	foldContext := codedContext(seq, codes, energyMap, temp+zeroCelsius) // kelvin
+	foldContext.allocateCaches()
+	if _, err = unpairedMinimumFreeEnergyW(0, len(seq)-1, foldContext); err != nil {
+		return context{}, fmt.Errorf("error filling the caches for the FoldingContext: %w", err)
+	}
+	return foldContext, nil
+}
+
+// ambiguousEnergies is sequenceEnergies for an uppercase seq that can have
+// ambiguity codes.
+func ambiguousEnergies(seq string) (energies, error) {
+	alphabet := checks.DNA
+	if strings.ContainsRune(seq, 'U') {
+		alphabet = checks.RNA
+	}
+	// RequireAlphabet rejects ambiguity codes, so they're checked as an A,
+	// which is a base of both alphabets.
+	unambiguous := strings.Map(func(base rune) rune {
+		if strings.ContainsRune(ambiguityCodes, base) {
+			return 'A'
+		}
+		return base
+	}, seq)
+	if err := checks.RequireAlphabet(unambiguous, alphabet); err != nil {
+		return energies{}, err
+	}
+	if alphabet == checks.RNA {
+		return rnaEnergies, nil
+	}
+	return dnaEnergies, nil
+}
+
+// ambiguousTriTetraLoop returns the lowest free energy of the tri or
+// tetraloop bonus of the hairpin closed by start and end, for any of the
+// bases its ambiguous bases could be. Sequences that aren't in
+// triTetraLoops have no bonus, 0.
+func (foldContext context) ambiguousTriTetraLoop(start, end int) float64 {
+	codes := foldContext.codes[start : end+1]
+	if !ambiguous(codes) {
+		if energy, ok := foldContext.energies.triTetraLoops[foldContext.seq[start:end+1]]; ok {
+			return deltaG(energy.enthalpyH, energy.entropyS, foldContext.temp)
+		}
+		return 0
+	}
+
+	sequences := 1
+	for _, code := range codes {
+		sequences *= bits.OnesCount8(codeBases[code])
+	}
+	dG := 0.0
+	matches := 0
+	for loop, energy := range foldContext.energies.triTetraLoops {
+		if len(loop) != len(codes) || !matchesCodes(loop, codes) {
+			continue
+		}
+		matches++
+		if loopDG := deltaG(energy.enthalpyH, energy.entropyS, foldContext.temp); matches == 1 || loopDG < dG {
+			dG = loopDG
+		}
+	}
+	if matches < sequences && dG > 0 {
+		// one of the sequences isn't a known loop, and has no bonus
+		dG = 0
+	}
+	return dG
+}
+
+// matchesCodes returns true if every base of seq is one of the bases of
+// the code at the same position of codes.
+func matchesCodes(seq string, codes []uint8) bool {
+	for index := range codes {
+		code := baseCode(seq[index])
+		if code >= noBase || codeBases[codes[index]]&codeBases[code] == 0 {
+			return false
+		}
+	}
+	return true
+}
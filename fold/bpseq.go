@@ -0,0 +1,43 @@
+package fold
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/******************************************************************************
+
+BPSEQ files begin here
+
+BPSEQ is the structure format of the Comparative RNA Web Site, and the one
+most structure datasets for machine learning are distributed in. It is a
+line for every base with three columns: the base's 1 indexed position, the
+base, and the position of the base it pairs with, or 0 if it is unpaired.
+
+	1 G 11
+	2 G 10
+	...
+	11 C 1
+
+Unlike CT, there is no header line and no energy.
+
+******************************************************************************/
+
+// BPSEQ returns the result of folding seq in BPSEQ format. A sequence too
+// short to fold is written as unpaired.
+func (r Result) BPSEQ(seq string) string {
+	pairedWith, _ := r.exportTable(seq)
+	var builder strings.Builder
+	for index, partner := range pairedWith {
+		fmt.Fprintf(&builder, "%d %c %d\n", index+1, exportBase(seq, index), partner+1)
+	}
+	return builder.String()
+}
+
+// WriteBPSeq writes the result of folding seq to w in BPSEQ format, like
+// BPSEQ.
+func (r Result) WriteBPSeq(seq string, w io.Writer) error {
+	_, err := io.WriteString(w, r.BPSEQ(seq))
+	return err
+}
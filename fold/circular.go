@@ -0,0 +1,97 @@
+package fold
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+/******************************************************************************
+
+Circular folding begins here
+
+Plasmids, viroids and circular RNAs have no ends: the last base is next to
+the first, and a helix can run straight through the origin. Every structure
+of a circular sequence is still nested when written from the origin, so it
+has a dot-bracket like a linear one, but its exterior loop is closed. The
+bases outside the outermost pairs form a hairpin, stack, bulge, interior or
+multibranch loop through the origin, where a linear fold leaves free ends.
+
+FoldCircular uses the approach of Hofacker and Stadler 2006
+(doi:10.1093/bioinformatics/btl023). A circular structure is split by any
+of the pairs in its exterior loop, start and end: the inside of the pair
+folds like a linear subsequence, pairedMinimumFreeEnergyV(start,end), and
+the outside is the subsequence from end around the origin to start, closed
+by the same pair. Folding the sequence written out twice covers both sides
+of every pair, so the minimum free energy structure is the best pair's
+inside plus outside, or no structure at all if none of them are stable.
+
+The doubled sequence has the last base added before it and the first after
+it, so no pair is at its ends, where the energies of dangling ends would be
+added to what are really closed loops.
+
+******************************************************************************/
+
+// FoldCircular folds a circular seq at temp Celsius and returns its minimum
+// free energy structure, which can have base pairs and loops through the
+// origin between the last base and the first. Its DotBracket is written from
+// the first base of seq. If no structure is more stable than the unfolded
+// sequence, the Result has no structures.
+//
+// Both sides of each pair are folded, so it takes about four times the
+// memory of Zuker on a sequence of the same length.
+func FoldCircular(seq string, temp float64) (Result, error) {
+	n := len(seq)
+	if n == 0 {
+		return Result{}, errors.New("circular fold: empty sequence")
+	}
+	doubled := seq[n-1:] + seq + seq + seq[:1]
+	foldContext, err := emptyContext(doubled, temp, nil, 0)
+	if err != nil {
+		return Result{}, fmt.Errorf("circular fold: %w", err)
+	}
+
+	// the doubled sequence is offset by the base added before it
+	bestEnergy, bestStart, bestEnd := 0.0, -1, -1
+	for start := 1; start <= n; start++ {
+		for end := start + minLenForStruct; end <= n && end-start <= n-minLenForStruct; end++ {
+			inside, err := pairedMinimumFreeEnergyV(start, end, foldContext)
+			if err != nil {
+				return Result{}, fmt.Errorf("circular fold: %w", err)
+			}
+			if !inside.Valid() {
+				continue
+			}
+			outside, err := pairedMinimumFreeEnergyV(end, start+n, foldContext)
+			if err != nil {
+				return Result{}, fmt.Errorf("circular fold: %w", err)
+			}
+			if !outside.Valid() {
+				continue
+			}
+			if energy := inside.energy + outside.energy; energy < bestEnergy {
+				bestEnergy, bestStart, bestEnd = energy, start, end
+			}
+		}
+	}
+	if bestStart < 0 || math.IsInf(bestEnergy, 0) {
+		return Result{length: n}, nil
+	}
+
+	structs := tracebackPaired(bestStart, bestEnd, foldContext)
+	outside := tracebackPaired(bestEnd, bestStart+n, foldContext)
+	// the pair closing the outside is the same as the one closing the
+	// inside, so it's kept only as the loop through the origin
+	outside[0].inner = nil
+	structs = append(structs, outside...)
+	for index := range structs {
+		for innerIndex, inner := range structs[index].inner {
+			start, end := (inner.start-1)%n, (inner.end-1)%n
+			if start > end {
+				start, end = end, start
+			}
+			structs[index].inner[innerIndex] = subsequence{start, end}
+		}
+	}
+	return Result{structs: structs, length: n}, nil
+}
@@ -0,0 +1,139 @@
+package fold
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+)
+
+/******************************************************************************
+
+Two strand folding begins here
+
+Primer dimers, probes binding their targets and siRNA duplexes are all two
+strands folding together, which Zuker can't do since it folds one strand.
+CoFold uses the approach of RNAcofold (Bernhart et al. 2006,
+doi:10.1186/1748-7188-1-3): the strands are joined end to end and folded as
+one sequence, except that the loop holding the cut between them isn't
+really closed, so it is scored as an exterior loop instead of a hairpin,
+bulge, interior or multibranch loop. That loop instead pays the free energy
+of bringing two strands together, the duplex initiation of SantaLucia 2004
+for DNA and Xia et al. 1998 for RNA, which every structure with a pair
+between the strands has exactly once. Pairs across the cut also don't need
+the minimum hairpin length between them, since there is no hairpin.
+
+The minimum free energy of the dimer includes each strand's own structure,
+so BindingEnergy subtracts what each strand reaches folded on its own to
+give the free energy of binding.
+
+******************************************************************************/
+
+// duplexInitiation returns the free energy of two strands coming together,
+// at temp Kelvin.
+func duplexInitiation(energyMap energies, temp float64) float64 {
+	if energyMap.complement('A') == 'U' {
+		// Xia et al. 1998, doi:10.1021/bi9809425
+		return deltaG(3.61, -1.5, temp)
+	}
+	// SantaLucia and Hicks 2004, doi:10.1146/annurev.biophys.32.110601.141800
+	return deltaG(0.2, -5.7, temp)
+}
+
+// spansCut returns true if the two strands of a CoFold are cut between
+// start and end, so the loop they close is open.
+func (foldContext context) spansCut(start, end int) bool {
+	return foldContext.cut > 0 && start < foldContext.cut && foldContext.cut <= end
+}
+
+// branchesSpanCut returns true if the cut is inside one of branches.
+func (foldContext context) branchesSpanCut(branches []subsequence) bool {
+	for _, branch := range branches {
+		if foldContext.spansCut(branch.start, branch.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// CoFold folds seqA and seqB together at temp Celsius, finding the minimum
+// free energy structure of the pair, with base pairs both within and between
+// the strands. Both strands have to be DNA or both RNA.
+//
+// Its DotBracket marks the break between the strands with an "&", Strands
+// splits it into each strand's dot-bracket, and BindingEnergy gives the free
+// energy of the strands binding each other.
+// Fold a sequence with itself to check for homodimers. If nothing pairs at
+// all, the Result has no structures and its MinimumFreeEnergy is +Inf.
+func CoFold(seqA, seqB string, temp float64) (Result, error) {
+	seqA, seqB = strings.ToUpper(seqA), strings.ToUpper(seqB)
+	if seqA == "" || seqB == "" {
+		return Result{}, errors.New("cofold: both strands need a sequence")
+	}
+	alphabetA, _, _ := checks.DetectAlphabet(seqA)
+	alphabetB, _, _ := checks.DetectAlphabet(seqB)
+	if alphabetA == checks.RNA && strings.ContainsRune(seqB, 'T') || alphabetB == checks.RNA && strings.ContainsRune(seqA, 'T') {
+		return Result{}, errors.New("cofold: can't fold DNA with RNA, both strands have to be the same")
+	}
+
+	var monomerEnergy float64
+	for _, seq := range []string{seqA, seqB} {
+		result, err := Zuker(seq, temp)
+		if err != nil {
+			return Result{}, fmt.Errorf("cofold: %w", err)
+		}
+		// a strand that has no structure, or only unstable ones, stays unfolded
+		if energy := result.MinimumFreeEnergy(); !math.IsInf(energy, 0) && energy < 0 {
+			monomerEnergy += energy
+		}
+	}
+
+	seq := seqA + seqB
+	foldContext, err := newContext(seq, temp, nil, len(seqA))
+	if err != nil {
+		return Result{}, fmt.Errorf("cofold: %w", err)
+	}
+	var structs []nucleicAcidStructure
+	if foldContext.unpairedMinimumFreeEnergyW.get(0, len(seq)-1).Valid() {
+		structs = traceback(0, len(seq)-1, foldContext)
+	}
+	return Result{
+		structs:       structs,
+		cut:           len(seqA),
+		length:        len(seq),
+		monomerEnergy: monomerEnergy,
+	}, nil
+}
+
+// Strands returns the dot-bracket of each strand of a CoFold. Pairs between
+// the strands are opened in the first and closed in the second. For a
+// Result of a single strand it returns its DotBracket and "".
+func (r Result) Strands() (string, string) {
+	dotBracket := r.dotBracket()
+	if r.cut == 0 {
+		return dotBracket, ""
+	}
+	return dotBracket[:r.cut], dotBracket[r.cut:]
+}
+
+// BindingEnergy returns the free energy in kcal/mol of the two strands of a
+// CoFold binding each other: the minimum free energy of the dimer less those
+// of each strand folded alone. It is 0 if the strands don't pair with each
+// other, or for a Result of a single strand.
+func (r Result) BindingEnergy() float64 {
+	if r.cut == 0 {
+		return 0
+	}
+	intermolecular := false
+	for _, structure := range r.structs {
+		if len(structure.inner) == 1 && structure.inner[0].start < r.cut && r.cut <= structure.inner[0].end {
+			intermolecular = true
+		}
+	}
+	if !intermolecular {
+		return 0
+	}
+	return r.MinimumFreeEnergy() - r.monomerEnergy
+}
@@ -0,0 +1,275 @@
+package fold
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/******************************************************************************
+
+Constrained folding begins here
+
+Designs often fix part of a structure: a probe's binding region has to stay
+single stranded, or a stem is known from experiments and only the rest of
+the structure is in question. FoldConstrained folds like Zuker, but only
+over structures that leave every base in Constraints.Unpaired unpaired and
+form every pair in Constraints.Pairs.
+
+The constraints are checked by the recursions themselves: V is infinite for
+pairs that aren't allowed, hairpins and interior loops that would leave a
+forced base unpaired aren't considered, and W and WM are infinite for a
+subsequence holding a base whose forced partner is outside it. Forced pairs are also
+exempt from the isolated base pair penalty, since they are there whether
+they are isolated or not.
+
+Exterior and multibranch loops are split into branches, each closed by a
+pair of V, so a forced pair can close a branch of either loop or sit
+anywhere inside one.
+
+Constraints that conflict with each other, like a base that is both forced
+unpaired and forced to pair, two forced pairs sharing a base, or forced
+pairs that cross, are reported before folding with the indexes involved.
+Constraints that are consistent but that no structure can meet, like forced
+pairs around a loop that Zuker never folds, are reported after.
+
+Tethered designs, like aptamers attached to a surface or probes with a
+toehold, need a few bases at an end single stranded. FoldWithOptions forces
+the first ForceSingleStrandedPrefix and last ForceSingleStrandedSuffix bases
+unpaired without building Constraints by hand, and folds the sequence
+without them too, so the cost of keeping the ends open is reported
+alongside the structure. A circular sequence has no ends to keep open, so
+FoldOptions can ask for a circular fold or for open ends, but not both.
+
+******************************************************************************/
+
+// Constraints are bases that must stay unpaired and pairs that must form
+// when folding with FoldConstrained. Indexes are 0 based.
+type Constraints struct {
+	Unpaired []int      // Unpaired are the indexes of bases that can't pair.
+	Pairs    []BasePair // Pairs are the pairs that must form.
+}
+
+// foldConstraints are Constraints indexed by base.
+type foldConstraints struct {
+	unpaired []bool
+	// partners[i] is the base i is forced to pair with, or -1.
+	partners []int
+	// forcedBefore[i] is how many of the bases before i are forced to pair.
+	forcedBefore []int
+}
+
+// FoldConstrained folds seq at temp Celsius like Zuker, into the structure
+// with the lowest free energy that meets constraints. It returns an error
+// if constraints conflict, naming the bases that conflict, or if no
+// structure meets them.
+func FoldConstrained(seq string, temp float64, constraints Constraints) (Result, error) {
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return Result{}, fmt.Errorf("constrained fold: %w", err)
+	}
+	indexed, err := indexConstraints(seq, energyMap, constraints)
+	if err != nil {
+		return Result{}, fmt.Errorf("constrained fold: %w", err)
+	}
+	foldContext, err := newContext(seq, temp, indexed, 0)
+	if err != nil {
+		return Result{}, fmt.Errorf("constrained fold: %w", err)
+	}
+	if !foldContext.unpairedMinimumFreeEnergyW.get(0, len(seq)-1).Valid() {
+		if len(constraints.Pairs) == 0 {
+			return Result{}, errors.New("constrained fold: no structure leaves the unpaired bases unpaired")
+		}
+		return Result{}, errors.New("constrained fold: no structure forms every forced pair")
+	}
+	return Result{structs: traceback(0, len(seq)-1, foldContext), length: len(seq)}, nil
+}
+
+// FoldOptions are the options of FoldWithOptions.
+type FoldOptions struct {
+	// ForceSingleStrandedPrefix and ForceSingleStrandedSuffix are how many
+	// bases at the 5' and 3' ends must stay unpaired.
+	ForceSingleStrandedPrefix, ForceSingleStrandedSuffix int
+	// Circular folds the sequence with FoldCircular. It can't be used with
+	// single stranded ends.
+	Circular bool
+}
+
+// OptionsResult is the fold of a sequence with FoldOptions, and of the
+// same sequence without its ends forced open.
+type OptionsResult struct {
+	Result               // Result is the fold with the options.
+	Unconstrained Result // Unconstrained is the fold without single stranded ends.
+}
+
+// EnergyPenalty returns how much higher, in kcal/mol, the minimum free
+// energy is with the ends forced open than without. A sequence that
+// doesn't fold counts as 0 kcal/mol.
+func (result OptionsResult) EnergyPenalty() float64 {
+	return windowEnergy(result.Result) - windowEnergy(result.Unconstrained)
+}
+
+// ChangedMinimumFreeEnergy returns true if forcing the ends open raised the
+// minimum free energy, rather than leaving the ends unpaired in a structure
+// as stable as the unconstrained one.
+func (result OptionsResult) ChangedMinimumFreeEnergy() bool {
+	return result.EnergyPenalty() > 1e-9
+}
+
+// FoldWithOptions folds seq at temp Celsius with options, returning both
+// the fold with the options and, as Unconstrained, the fold without its
+// ends forced open. It returns an error if the forced ends are negative,
+// cover the whole sequence, or are asked for with Circular.
+func FoldWithOptions(seq string, temp float64, options FoldOptions) (OptionsResult, error) {
+	prefix, suffix := options.ForceSingleStrandedPrefix, options.ForceSingleStrandedSuffix
+	switch {
+	case prefix < 0 || suffix < 0:
+		return OptionsResult{}, fmt.Errorf("fold: single stranded prefix %d and suffix %d can't be negative", prefix, suffix)
+	case options.Circular && prefix+suffix > 0:
+		return OptionsResult{}, errors.New("fold: a circular sequence has no ends to force single stranded")
+	case prefix+suffix > 0 && prefix+suffix >= len(seq):
+		return OptionsResult{}, fmt.Errorf("fold: single stranded prefix %d and suffix %d leave none of the %d bases to fold", prefix, suffix, len(seq))
+	}
+
+	if options.Circular {
+		result, err := FoldCircular(seq, temp)
+		return OptionsResult{Result: result, Unconstrained: result}, err
+	}
+	unconstrained, err := Zuker(seq, temp)
+	if err != nil {
+		return OptionsResult{}, err
+	}
+	if prefix+suffix == 0 {
+		return OptionsResult{Result: unconstrained, Unconstrained: unconstrained}, nil
+	}
+
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return OptionsResult{}, fmt.Errorf("fold: %w", err)
+	}
+	var unpaired []int
+	for index := 0; index < len(seq); index++ {
+		if index < prefix || index >= len(seq)-suffix {
+			unpaired = append(unpaired, index)
+		}
+	}
+	indexed, err := indexConstraints(seq, energyMap, Constraints{Unpaired: unpaired})
+	if err != nil {
+		return OptionsResult{}, fmt.Errorf("fold: %w", err)
+	}
+	foldContext, err := newContext(seq, temp, indexed, 0)
+	if err != nil {
+		return OptionsResult{}, fmt.Errorf("fold: %w", err)
+	}
+	// unlike FoldConstrained, having no structure at all is a fine answer.
+	constrained := Result{length: len(seq)}
+	if foldContext.unpairedMinimumFreeEnergyW.get(0, len(seq)-1).Valid() {
+		constrained.structs = traceback(0, len(seq)-1, foldContext)
+	}
+	return OptionsResult{Result: constrained, Unconstrained: unconstrained}, nil
+}
+
+// indexConstraints checks constraints against seq and each other and
+// indexes them by base.
+func indexConstraints(seq string, energyMap energies, constraints Constraints) (*foldConstraints, error) {
+	n := len(seq)
+	indexed := &foldConstraints{unpaired: make([]bool, n), partners: make([]int, n), forcedBefore: make([]int, n+1)}
+	for index := range indexed.partners {
+		indexed.partners[index] = -1
+	}
+	for _, index := range constraints.Unpaired {
+		if index < 0 || index >= n {
+			return nil, fmt.Errorf("unpaired index %d is outside the sequence of %d bases", index, n)
+		}
+		indexed.unpaired[index] = true
+	}
+	for _, pair := range constraints.Pairs {
+		start, end := pair.Start, pair.End
+		if start > end {
+			start, end = end, start
+		}
+		switch {
+		case start < 0 || end >= n:
+			return nil, fmt.Errorf("forced pair %d-%d is outside the sequence of %d bases", pair.Start, pair.End, n)
+		case end-start < minLenForStruct:
+			return nil, fmt.Errorf("forced pair %d-%d is too close to close a hairpin, it needs at least %d bases between them", pair.Start, pair.End, minLenForStruct-1)
+		case energyMap.complement(rune(seq[start])) != rune(seq[end]):
+			return nil, fmt.Errorf("forced pair %d-%d can't form, %c and %c aren't complementary", pair.Start, pair.End, seq[start], seq[end])
+		}
+		for _, index := range []int{start, end} {
+			if indexed.unpaired[index] {
+				return nil, fmt.Errorf("base %d is both forced unpaired and forced to pair in %d-%d", index, pair.Start, pair.End)
+			}
+			if partner := indexed.partners[index]; partner != -1 && partner != start+end-index {
+				return nil, fmt.Errorf("base %d is forced to pair with both %d and %d", index, partner, start+end-index)
+			}
+		}
+		indexed.partners[start], indexed.partners[end] = end, start
+	}
+	for index, partner := range indexed.partners {
+		indexed.forcedBefore[index+1] = indexed.forcedBefore[index]
+		if partner != -1 {
+			indexed.forcedBefore[index+1]++
+		}
+	}
+	// pairs cross if one has exactly one base inside the other.
+	for start, end := range indexed.partners {
+		if end <= start {
+			continue
+		}
+		if !indexed.closedWithin(start, end) {
+			for index := start + 1; index < end; index++ {
+				if partner := indexed.partners[index]; partner != -1 && (partner < start || partner > end) {
+					return nil, fmt.Errorf("forced pairs %d-%d and %d-%d cross", start, end, index, partner)
+				}
+			}
+		}
+	}
+	return indexed, nil
+}
+
+// forcedBetween returns true if any base from start to end, inclusive, is
+// forced to pair.
+func (constraints *foldConstraints) forcedBetween(start, end int) bool {
+	if start > end {
+		return false
+	}
+	return constraints.forcedBefore[end+1]-constraints.forcedBefore[start] > 0
+}
+
+// closedWithin returns true if every base from start to end, inclusive,
+// that is forced to pair is forced to pair with another base in that range.
+func (constraints *foldConstraints) closedWithin(start, end int) bool {
+	if !constraints.forcedBetween(start, end) {
+		return true
+	}
+	for index := start; index <= end; index++ {
+		if partner := constraints.partners[index]; partner != -1 && (partner < start || partner > end) {
+			return false
+		}
+	}
+	return true
+}
+
+// canPair returns true if start and end may pair: neither is forced
+// unpaired or forced to pair with another base, and no forced pair crosses
+// theirs.
+func (constraints *foldConstraints) canPair(start, end int) bool {
+	if constraints.unpaired[start] || constraints.unpaired[end] {
+		return false
+	}
+	if partner := constraints.partners[start]; partner != -1 && partner != end {
+		return false
+	}
+	if partner := constraints.partners[end]; partner != -1 && partner != start {
+		return false
+	}
+	return constraints.closedWithin(start+1, end-1)
+}
+
+// forced returns true if start and end are forced to pair.
+func (constraints *foldConstraints) forced(start, end int) bool {
+	return constraints.partners[start] == end
+}
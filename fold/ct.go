@@ -0,0 +1,189 @@
+package fold
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+
+CT files begin here
+
+Connectivity table files, .ct, are what RNAstructure writes and what most
+drawing tools, like VARNA, read. A CT file starts with a header line holding
+the length of the sequence and its free energy, followed by a line for every
+base with six columns:
+
+	  11  ENERGY = -4.30
+	    1 G     0     2    11     1
+	    2 G     1     3    10     2
+	  ...
+	   11 C    10     0     1    11
+
+The columns are the base's 1 indexed position, the base, the positions of the
+bases before and after it, the position of the base it pairs with, and its
+natural numbering. The 5' base has no base before it, the 3' base has none
+after it, and unpaired bases have no partner, all of which are written as 0.
+
+ParseCT reads structures from other tools back in, as dot-bracket so they
+can be scored with Evaluate. Files can hold several structures one after
+another, like the suboptimal structures RNAstructure writes, but only the
+first is read. Pseudoknotted pairs are put in square brackets, as in
+DotBracketWithPseudoknots.
+
+******************************************************************************/
+
+// CT returns the result of folding seq as a connectivity table, with its
+// minimum free energy in the header line. A sequence too short to fold is
+// written as unpaired, with an energy of 0.
+func (r Result) CT(seq string) string {
+	pairedWith, energy := r.exportTable(seq)
+	length := len(pairedWith)
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%5d  ENERGY = %.2f\n", length, energy)
+	for index := 0; index < length; index++ {
+		next := index + 2
+		if index == length-1 {
+			next = 0
+		}
+		fmt.Fprintf(&builder, "%5d %c %5d %5d %5d %5d\n", index+1, exportBase(seq, index), index, next, pairedWith[index]+1, index+1)
+	}
+	return builder.String()
+}
+
+// WriteCT writes the result of folding seq to w as a connectivity table,
+// like CT.
+func (r Result) WriteCT(seq string, w io.Writer) error {
+	_, err := io.WriteString(w, r.CT(seq))
+	return err
+}
+
+// ParseCT reads the first structure of a connectivity table file, and
+// returns its sequence and its structure in dot-bracket notation. Any
+// structures after the first are ignored.
+func ParseCT(r io.Reader) (string, string, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	nextLine := func() ([]string, bool) {
+		for scanner.Scan() {
+			line++
+			if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+				return fields, true
+			}
+		}
+		return nil, false
+	}
+
+	header, ok := nextLine()
+	if !ok {
+		if err := scanner.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", errors.New("empty CT file")
+	}
+	length, err := strconv.Atoi(header[0])
+	if err != nil || length < 0 {
+		return "", "", fmt.Errorf("line %d: header should start with the length of the sequence, got %q", line, header[0])
+	}
+
+	seq := make([]byte, length)
+	pairedWith := make([]int, length)
+	for index := 0; index < length; index++ {
+		fields, ok := nextLine()
+		if !ok {
+			if err := scanner.Err(); err != nil {
+				return "", "", err
+			}
+			return "", "", fmt.Errorf("CT file ends after %d of its %d bases", index, length)
+		}
+		if len(fields) < 5 {
+			return "", "", fmt.Errorf("line %d: expected at least 5 columns, got %d", line, len(fields))
+		}
+		if position, err := strconv.Atoi(fields[0]); err != nil || position != index+1 {
+			return "", "", fmt.Errorf("line %d: expected base %d, got %q", line, index+1, fields[0])
+		}
+		partner, err := strconv.Atoi(fields[4])
+		if err != nil || partner < 0 || partner > length || partner == index+1 {
+			return "", "", fmt.Errorf("line %d: base %d pairs with %q, which isn't a base of a sequence of %d", line, index+1, fields[4], length)
+		}
+		if len(fields[1]) != 1 {
+			return "", "", fmt.Errorf("line %d: expected a single base, got %q", line, fields[1])
+		}
+		seq[index] = fields[1][0]
+		pairedWith[index] = partner - 1
+	}
+	for index, partner := range pairedWith {
+		if partner != -1 && pairedWith[partner] != index {
+			return "", "", fmt.Errorf("base %d pairs with %d, but base %d pairs with %d", index+1, partner+1, partner+1, pairedWith[partner]+1)
+		}
+	}
+
+	structure, err := nestedDotBracket(pairedWith)
+	if err != nil {
+		return "", "", err
+	}
+	return string(seq), structure, nil
+}
+
+// nestedDotBracket returns the dot-bracket notation of pairedWith, the index
+// each base pairs with or -1. Pairs crossing a pair in parentheses are put
+// in square brackets, and it is an error if they cross each other too.
+func nestedDotBracket(pairedWith []int) (string, error) {
+	structure := []byte(strings.Repeat(".", len(pairedWith)))
+	// crosses returns true if the pair start, end crosses a pair already
+	// written with open. Pairs are written in the order they open, so only
+	// pairs opening before start can cross it.
+	crosses := func(start, end int, open byte) bool {
+		for index := 0; index < start; index++ {
+			if structure[index] == open && pairedWith[index] > start && pairedWith[index] < end {
+				return true
+			}
+		}
+		return false
+	}
+	for start, end := range pairedWith {
+		if end <= start {
+			continue
+		}
+		switch {
+		case !crosses(start, end, '('):
+			structure[start], structure[end] = '(', ')'
+		case !crosses(start, end, '['):
+			structure[start], structure[end] = '[', ']'
+		default:
+			return "", fmt.Errorf("pair %d-%d crosses pairs in both parentheses and square brackets", start+1, end+1)
+		}
+	}
+	return string(structure), nil
+}
+
+// exportTable returns the index each base of the result of folding seq
+// pairs with, or -1 for unpaired bases, and its minimum free energy, for
+// writing to a file. A sequence too short to fold is unpaired, with an
+// energy of 0.
+func (r Result) exportTable(seq string) ([]int, float64) {
+	structure, energy := r.dotBracket(), r.MinimumFreeEnergy()
+	if math.IsInf(energy, 0) {
+		structure, energy = "", 0
+	}
+	// a structure longer than seq means seq isn't the folded sequence, so
+	// its missing bases are written as N rather than dropping pairs.
+	length := len(seq)
+	if len(structure) > length {
+		length = len(structure)
+	}
+	return pairTable(structure, length), energy
+}
+
+// exportBase returns the base of seq at index, or N past its end.
+func exportBase(seq string, index int) byte {
+	if index < len(seq) {
+		return seq[index]
+	}
+	return 'N'
+}
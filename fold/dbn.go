@@ -0,0 +1,128 @@
+package fold
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+)
+
+/******************************************************************************
+
+DBN files begin here
+
+Dot-bracket notation files, .dbn or .fold, are how the Vienna RNA package and
+most tools around it pass structures around. Each record is a FASTA style
+header line, the sequence, and the structure, optionally followed by its free
+energy in parentheses, which is exactly what RNAfold prints:
+
+	>hairpin
+	GGGGAAACCCC
+	((((...)))) ( -4.30)
+
+The energy is written with padding inside the parentheses, so it is parsed
+without caring about whitespace. Some tools leave out the header, in which
+case the record has no name.
+
+******************************************************************************/
+
+// DBNRecord is a structure read from a dot-bracket notation file.
+type DBNRecord struct {
+	Name      string  // Name is the header line of the record, without the '>'. It is empty for records without one.
+	Sequence  string  // Sequence is the folded sequence.
+	Structure string  // Structure is the structure in dot-bracket notation, as long as Sequence.
+	Energy    float64 // Energy is the free energy of the structure in kcal/mol, if HasEnergy is true.
+	HasEnergy bool    // HasEnergy is true if the record had an energy.
+}
+
+// WriteDBN writes the result of folding seq to w as a dot-bracket notation
+// record named name, with its minimum free energy, as RNAfold would.
+func (r Result) WriteDBN(w io.Writer, name, seq string) error {
+	structure := r.DotBracket()
+	if len(structure) > len(seq) {
+		return fmt.Errorf("structure is %d bases long, but sequence %s is only %d", len(structure), name, len(seq))
+	}
+	// a Result that wasn't folded, like the zero Result, has no structure.
+	structure += strings.Repeat(".", len(seq)-len(structure))
+	_, err := fmt.Fprintf(w, ">%s\n%s\n%s (%6.2f)\n", name, seq, structure, r.MinimumFreeEnergy())
+	return err
+}
+
+// ReadDBN reads every record of a dot-bracket notation file. Structures may
+// have pseudoknots in square brackets, and must be as long as their sequence.
+func ReadDBN(r io.Reader) ([]DBNRecord, error) {
+	var records []DBNRecord
+	var record DBNRecord
+	// next is the line of the record expected next.
+	const (
+		headerOrSequence = iota
+		sequence
+		structure
+	)
+	next := headerOrSequence
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, ">"):
+			if next != headerOrSequence {
+				return nil, fmt.Errorf("line %d: record %q has no structure", line, record.Name)
+			}
+			record = DBNRecord{Name: strings.TrimSpace(text[1:])}
+			next = sequence
+		case next == headerOrSequence:
+			record = DBNRecord{Sequence: text}
+			next = structure
+		case next == sequence:
+			record.Sequence = text
+			next = structure
+		default:
+			parsed, err := parseStructureLine(text, record)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records = append(records, parsed)
+			next = headerOrSequence
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if next != headerOrSequence {
+		return nil, fmt.Errorf("record %q has no structure", record.Name)
+	}
+	return records, nil
+}
+
+// parseStructureLine adds the structure and energy of a structure line, like
+// "((((...)))) ( -4.30)", to record.
+func parseStructureLine(text string, record DBNRecord) (DBNRecord, error) {
+	structure, energy := text, ""
+	if index := strings.IndexAny(text, " \t"); index != -1 {
+		structure, energy = text[:index], strings.TrimSpace(text[index:])
+	}
+	if len(structure) != len(record.Sequence) {
+		return record, fmt.Errorf("structure of record %q is %d long, but its sequence is %d", record.Name, len(structure), len(record.Sequence))
+	}
+	if !checks.IsValidDotBracketStructure(structure, true) {
+		return record, fmt.Errorf("structure of record %q is not valid dot-bracket notation: %s", record.Name, structure)
+	}
+	record.Structure = structure
+	if energy == "" {
+		return record, nil
+	}
+	if !strings.HasPrefix(energy, "(") || !strings.HasSuffix(energy, ")") {
+		return record, fmt.Errorf("energy of record %q should be in parentheses, got %s", record.Name, energy)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(energy[1:len(energy)-1]), 64)
+	if err != nil {
+		return record, fmt.Errorf("failed to parse energy of record %q: %w", record.Name, err)
+	}
+	record.Energy, record.HasEnergy = value, true
+	return record, nil
+}
@@ -0,0 +1,73 @@
+package fold
+
+import (
+	"fmt"
+	"sort"
+)
+
+/******************************************************************************
+
+Dot-bracket parsing begins here
+
+DotBracket turns a folded structure into a string, and ParseDotBracket turns
+a string back into the pairs of a structure, so structures from other tools
+or drawn by hand can be compared with or scored like the ones Zuker finds.
+
+Each pair encloses an interval of the sequence, and the pairs inside it are
+nested within that interval, so the pairs sorted by where they start are a
+preorder walk of the structure as a tree. Pseudoknots, written with [], {} or
+<> in the extended notation, are matched like parentheses but separately
+from them, so their pairs cross the others.
+
+******************************************************************************/
+
+// BasePair is a pair of bases of a structure, given as their 0 indexed
+// positions, with Start < End.
+type BasePair struct {
+	Start, End int
+}
+
+// dotBracketClosers maps each closing bracket of dot-bracket notation to the
+// bracket that opens it.
+var dotBracketClosers = map[rune]rune{')': '(', ']': '[', '}': '{', '>': '<'}
+
+// ParseDotBracket returns the base pairs of a structure in dot-bracket
+// notation, sorted by Start. Unpaired bases are '.', and pseudoknots may be
+// written with [], {} or <>. It returns an error with the index of the
+// offending character for an unknown character, a closing bracket without
+// an opening one, or an opening bracket that is never closed.
+func ParseDotBracket(dotBracket string) ([]BasePair, error) {
+	opened := make(map[rune][]int)
+	var pairs []BasePair
+	for index, character := range dotBracket {
+		switch character {
+		case '.':
+		case '(', '[', '{', '<':
+			opened[character] = append(opened[character], index)
+		case ')', ']', '}', '>':
+			opener := dotBracketClosers[character]
+			stack := opened[opener]
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced %q at index %d of %s has no %q before it", character, index, dotBracket, opener)
+			}
+			pairs = append(pairs, BasePair{Start: stack[len(stack)-1], End: index})
+			opened[opener] = stack[:len(stack)-1]
+		default:
+			return nil, fmt.Errorf("invalid character %q at index %d of %s", character, index, dotBracket)
+		}
+	}
+	// report the first bracket left open.
+	unclosed := -1
+	for _, stack := range opened {
+		if len(stack) > 0 && (unclosed == -1 || stack[0] < unclosed) {
+			unclosed = stack[0]
+		}
+	}
+	if unclosed != -1 {
+		return nil, fmt.Errorf("unbalanced %q at index %d of %s is never closed", dotBracket[unclosed], unclosed, dotBracket)
+	}
+
+	// pairs are found in order of End.
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Start < pairs[j].Start })
+	return pairs, nil
+}
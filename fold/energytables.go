@@ -0,0 +1,218 @@
+package fold
+
+import "strings"
+
+/******************************************************************************
+
+Energy tables begin here
+
+The energy maps in dna.go and rna.go are keyed by strings like "AC/TG",
+which is how the papers write nearest neighbors, but building those
+strings and hashing them in the inner loops of the folding recursions was
+most of the time spent folding. So when a context is made, the sequence is
+encoded as small integer codes, and each of the nearest neighbor, mismatch
+and dangling end maps is turned into an array indexed by the codes of its
+four bases, holding the free energy at the context's temperature. The maps
+are only read while building the arrays.
+
+The free energies in the arrays are computed by deltaG from the same
+enthalpies and entropies as before, so folding gives exactly the same
+energies as looking them up in the maps.
+
+The IUPAC ambiguity codes Zuker folds as Pessimistic have codes of their
+own, and the tables of a sequence with any of them have a key for every
+four codes, each holding the lowest free energy of the keys it could be.
+The recursions look ambiguous bases up like any other, so they don't need
+to know about them. Folded as Skip, ambiguous bases are noBase instead.
+
+******************************************************************************/
+
+const (
+	// noBase is the code of the "." that stands in for a missing base in
+	// dangling ends, or a base that isn't in the energy maps.
+	noBase = 4
+	// baseCodes is how many codes there are, A, C, G, T or U, and noBase.
+	baseCodes = 5
+	// ambiguityCodes are the IUPAC codes Zuker can fold, coded from
+	// baseCodes on in this order.
+	ambiguityCodes = "RYSWKMBDHVN"
+	// allCodes is how many codes there are with the ambiguity codes.
+	allCodes = baseCodes + len(ambiguityCodes)
+)
+
+// codeBases are the bases each code could be, as a bit for each of A, C,
+// G and T or U, in the order of their codes.
+var codeBases = [allCodes]uint8{
+	0b0001, 0b0010, 0b0100, 0b1000, 0, // A, C, G, T, noBase
+	0b0101, 0b1010, 0b0110, 0b1001, 0b1100, 0b0011, // R, Y, S, W, K, M
+	0b1110, 0b1101, 0b1011, 0b0111, 0b1111, // B, D, H, V, N
+}
+
+// complementBases returns the complements of bases, bits of codeBases.
+func complementBases(bases uint8) uint8 {
+	return bases>>3&1 | bases>>1&2 | bases<<1&4 | bases<<3&8
+}
+
+// pairingCodes is true for the codes that can pair with each other,
+// because one of the bases of the first is the complement of one of the
+// bases of the second.
+var pairingCodes = func() (pairing [allCodes][allCodes]bool) {
+	for first := range pairing {
+		for second := range pairing[first] {
+			pairing[first][second] = complementBases(codeBases[first])&codeBases[second] != 0
+		}
+	}
+	return pairing
+}()
+
+// energyTable is a matchingBasepairEnergy at a temperature, indexed by
+// pairCode instead of strings.
+type energyTable struct {
+	// deltaG is the free energy of each key, or 0 if it isn't in the map.
+	deltaG []float64
+	// known is true for the keys that are in the map.
+	known []bool
+}
+
+// energyTables holds an energyTable for each of the maps of energies that
+// are keyed by two pairs.
+type energyTables struct {
+	danglingEnds, internalMismatches, nearestNeighbors, terminalMismatches energyTable
+	// codes is how many codes the tables are indexed by, baseCodes or, for
+	// sequences with ambiguity codes, allCodes.
+	codes int
+}
+
+// baseCode returns the code of a base in the energy maps.
+func baseCode(base byte) uint8 {
+	switch base {
+	case 'A':
+		return 0
+	case 'C':
+		return 1
+	case 'G':
+		return 2
+	case 'T', 'U':
+		return 3
+	}
+	if index := strings.IndexByte(ambiguityCodes, base); index >= 0 {
+		return uint8(baseCodes + index)
+	}
+	return noBase
+}
+
+// knownBases returns true if every base of key is A, C, G, T or U, or is a
+// ".".
+func knownBases(key string) bool {
+	for index := range key {
+		if baseCode(key[index]) >= noBase && key[index] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// ambiguous returns true if any of codes is an ambiguity code.
+func ambiguous(codes []uint8) bool {
+	for _, code := range codes {
+		if code >= baseCodes {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeSequence returns the code of each base of seq.
+func encodeSequence(seq string) []uint8 {
+	codes := make([]uint8, len(seq))
+	for index := range seq {
+		codes[index] = baseCode(seq[index])
+	}
+	return codes
+}
+
+// pairCode returns the index in an energyTable indexed by codes codes of
+// the four codes that are written first, second, fourth and fifth in the
+// key of a map.
+func pairCode(codes int, first, second, third, fourth uint8) int {
+	return ((int(first)*codes+int(second))*codes+int(third))*codes + int(fourth)
+}
+
+// newEnergyTable turns energyMap into an energyTable indexed by codes codes
+// at temp Kelvin.
+func newEnergyTable(energyMap matchingBasepairEnergy, temp float64, codes int) energyTable {
+	keys := codes * codes * codes * codes
+	table := energyTable{deltaG: make([]float64, keys), known: make([]bool, keys)}
+	for key, foldEnergy := range energyMap {
+		if len(key) != 5 || key[2] != '/' || !knownBases(key[:2]+key[3:]) {
+			continue
+		}
+		code := pairCode(codes, baseCode(key[0]), baseCode(key[1]), baseCode(key[3]), baseCode(key[4]))
+		table.deltaG[code] = deltaG(foldEnergy.enthalpyH, foldEnergy.entropyS, temp)
+		table.known[code] = true
+	}
+	if codes == allCodes {
+		table.fillAmbiguous()
+	}
+	return table
+}
+
+// fillAmbiguous sets the keys of table with ambiguity codes to the lowest
+// free energy of the known keys they could be, or leaves them unknown if
+// none are known. The lowest is found one base of the keys at a time: once
+// the first base has been filled in for every key, a key ambiguous in its
+// first two bases is the lowest of the keys with the bases the second
+// could be, and so on.
+func (table energyTable) fillAmbiguous() {
+	for place := allCodes * allCodes * allCodes; place > 0; place /= allCodes {
+		for key := range table.deltaG {
+			code := key / place % allCodes
+			if code < baseCodes {
+				continue
+			}
+			for base := 0; base < noBase; base++ {
+				if codeBases[code]&(1<<base) == 0 {
+					continue
+				}
+				other := key + (base-code)*place
+				if table.known[other] && (!table.known[key] || table.deltaG[other] < table.deltaG[key]) {
+					table.deltaG[key] = table.deltaG[other]
+					table.known[key] = true
+				}
+			}
+		}
+	}
+}
+
+// newEnergyTables returns the energyTables of energyMap at temp Kelvin,
+// indexed by codes codes.
+func newEnergyTables(energyMap energies, temp float64, codes int) *energyTables {
+	return &energyTables{
+		danglingEnds:       newEnergyTable(energyMap.danglingEnds, temp, codes),
+		internalMismatches: newEnergyTable(energyMap.internalMismatches, temp, codes),
+		nearestNeighbors:   newEnergyTable(energyMap.nearestNeighbors, temp, codes),
+		terminalMismatches: newEnergyTable(energyMap.terminalMismatches, temp, codes),
+		codes:              codes,
+	}
+}
+
+// code returns the code of the base at index of the sequence being folded,
+// or noBase if index is -1, like the "." pair puts in its keys.
+func (foldContext context) code(index int) uint8 {
+	if index < 0 {
+		return noBase
+	}
+	return foldContext.codes[index]
+}
+
+// pairCode returns the energyTable index of what pair returns as a key.
+func (foldContext context) pairCode(start, rightOfStart, end, leftOfEnd int) int {
+	return pairCode(foldContext.tables.codes, foldContext.code(start), foldContext.code(rightOfStart), foldContext.code(end), foldContext.code(leftOfEnd))
+}
+
+// canPair returns true if the bases at start and end of the sequence being
+// folded can pair, or for ambiguity codes, if any of the bases they could
+// be can.
+func (foldContext context) canPair(start, end int) bool {
+	return pairingCodes[foldContext.codes[start]][foldContext.codes[end]]
+}
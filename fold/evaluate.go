@@ -0,0 +1,127 @@
+package fold
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+)
+
+/******************************************************************************
+
+Structure evaluation begins here
+
+Zuker searches for the structure with the lowest free energy, but often the
+structure is already known: it was designed, drawn from a paper, or predicted
+by another tool, and the question is how stable it is, or how far it is from
+the minimum. Evaluate scores a given structure with the same energy tables.
+
+Every structure without pseudoknots breaks down into loops, each closed by a
+pair and holding the pairs directly inside it: a hairpin holds none, a stack,
+bulge or interior loop holds one, and a multibranch loop holds two or more.
+The unpaired bases and branches outside every pair make up the exterior
+loop. The free energy of the structure is the sum of the energies of its
+loops, each scored exactly as pairedMinimumFreeEnergyV scores it, and the
+exterior loop adds nothing. Since Zuker scores every loop the same way, the
+structure it folds evaluates to its minimum free energy, and no other
+structure evaluates any lower.
+
+******************************************************************************/
+
+// Evaluate returns the free energy in kcal/mol of seq folded into the
+// structure dotBracket at temp Celsius. dotBracket must be as long as seq,
+// have only '.', '(' and ')', and only pair complementary bases with at
+// least 3 bases between them. Interior loops whose bases beside a pair
+// would stack on it are an error too, since Zuker never folds them. A pair
+// with no pair that could stack on it, inside or outside, gets the same
+// heavy penalty Zuker gives it. Errors about the structure give the position
+// of the offending character or pair.
+func Evaluate(seq string, dotBracket string, temp float64) (float64, error) {
+	if err := checkTemperature(temp); err != nil {
+		return 0, fmt.Errorf("evaluate: %w", err)
+	}
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return 0, fmt.Errorf("evaluate: %w", err)
+	}
+	if len(dotBracket) != len(seq) {
+		return 0, fmt.Errorf("evaluate: structure is %d long, but sequence is %d", len(dotBracket), len(seq))
+	}
+	if !checks.IsValidDotBracketStructure(dotBracket, false) {
+		if _, err := ParseDotBracket(dotBracket); err != nil {
+			return 0, fmt.Errorf("evaluate: %w", err)
+		}
+		return 0, fmt.Errorf("evaluate: structure %s has pseudoknots, which can't be evaluated", dotBracket)
+	}
+	pairs, err := ParseDotBracket(dotBracket)
+	if err != nil {
+		return 0, fmt.Errorf("evaluate: %w", err)
+	}
+
+	foldContext := scoringContext(seq, energyMap, temp+zeroCelsius)
+	partners := make([]int, len(seq))
+	for index := range partners {
+		partners[index] = -1
+	}
+	for _, pair := range pairs {
+		if energyMap.complement(rune(seq[pair.Start])) != rune(seq[pair.End]) {
+			return 0, fmt.Errorf("evaluate: bases %c at index %d and %c at index %d can't pair", seq[pair.Start], pair.Start, seq[pair.End], pair.End)
+		}
+		partners[pair.Start], partners[pair.End] = pair.End, pair.Start
+	}
+
+	total := 0.0
+	for _, pair := range pairs {
+		energy, err := closedLoopEnergy(pair.Start, pair.End, partners, foldContext)
+		if err != nil {
+			return 0, fmt.Errorf("evaluate: %w", err)
+		}
+		if isolated(pair.Start, pair.End, foldContext) {
+			// pairedMinimumFreeEnergyV scores these with the penalty alone.
+			energy = isolatedBasePairPenalty
+		}
+		total += energy
+	}
+	return total, nil
+}
+
+// closedLoopEnergy returns the free energy of the loop closed by the pair of start
+// and end, given the partner of every base, or -1 for unpaired bases.
+func closedLoopEnergy(start, end int, partners []int, foldContext context) (float64, error) {
+	branches := loopBranches(start, end, partners)
+
+	switch len(branches) {
+	case 0:
+		if end-start < minLenForStruct {
+			return 0, fmt.Errorf("hairpin closed by indexes %d and %d has %d unpaired bases, it needs at least %d", start, end, end-start-1, minLenForStruct-1)
+		}
+		return hairpin(start, end, foldContext)
+	case 1:
+		rightOfStart, leftOfEnd := branches[0].start, branches[0].end
+		energy, ok, err := interiorLoopEnergy(start, rightOfStart, end, leftOfEnd, foldContext)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			// Zuker never folds these, it pairs the bases beside the pairs instead.
+			return 0, fmt.Errorf("interior loop between the pairs of indexes %d and %d and of %d and %d has bases beside a pair that stack on it", start, end, rightOfStart, leftOfEnd)
+		}
+		return energy, nil
+	default:
+		return multibranchLoopEnergy(start, end, branches, foldContext), nil
+	}
+}
+
+// loopBranches returns the pairs directly inside the loop closed by the pair
+// of start and end, given the partner of every base.
+func loopBranches(start, end int, partners []int) []subsequence {
+	var branches []subsequence
+	for index := start + 1; index < end; index++ {
+		if partners[index] > index {
+			branches = append(branches, subsequence{index, partners[index]})
+			index = partners[index]
+		}
+	}
+	return branches
+}
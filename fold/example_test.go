@@ -10,5 +10,5 @@ func ExampleZuker() {
 	result, _ := fold.Zuker("ACCCCCUCCUUCCUUGGAUCAAGGGGCUCAA", 37.0)
 	brackets := result.DotBracket()
 	fmt.Println(brackets)
-	// Output: .((((.(((......)))....))))
+	// Output: .((((.(((......)))....)))).....
 }
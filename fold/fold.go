@@ -31,7 +31,6 @@ package fold
 import (
 	"fmt"
 	"math"
-	"strings"
 
 	"github.com/TimothyStiles/poly/transform"
 )
@@ -49,21 +48,66 @@ import (
 // Args:
 //
 //	seq: The sequence to Fold
-//	temp: The temperature the Fold takes place in, in Celsius
+//	temp: The temperature the Fold takes place in, in Celsius, from
+//	MinTemperature to MaxTemperature
+//	options: How to fold, like WithAmbiguityHandling to fold sequences
+//	with IUPAC ambiguity codes, which are rejected otherwise
 //
 // Returns a slice of NucleicAcidStructure with the energy and description,
 // i.e. stacks, bulges, hairpins, etc.
-func Zuker(seq string, temp float64) (Result, error) {
-	foldContext, err := newFoldingContext(seq, temp)
+func Zuker(seq string, temp float64, options ...ZukerOption) (Result, error) {
+	settings := zukerOptions{ambiguity: Reject}
+	for _, option := range options {
+		option(&settings)
+	}
+	var (
+		foldContext context
+		err         error
+	)
+	if settings.ambiguity == Reject {
+		foldContext, err = newFoldingContext(seq, temp)
+	} else {
+		foldContext, err = newAmbiguousContext(seq, temp, settings.ambiguity)
+	}
 	if err != nil {
 		return Result{}, fmt.Errorf("error creating folding context: %w", err)
 	}
+	return minimumFreeEnergyResult(foldContext), nil
+}
 
-	// get the minimum free energy structure out of the cache
-
+// minimumFreeEnergyResult returns the Result of foldContext, with its
+// caches filled.
+func minimumFreeEnergyResult(foldContext context) Result {
+	// get the minimum free energy structure out of the cache, if there is one
+	n := len(foldContext.seq)
+	var structs []nucleicAcidStructure
+	if foldContext.unpairedMinimumFreeEnergyW.get(0, n-1).Valid() {
+		structs = traceback(0, n-1, foldContext)
+	}
 	return Result{
-		structs: traceback(0, len(seq)-1, foldContext),
-	}, nil
+		structs: structs,
+		length:  n,
+	}
+}
+
+// FoldAtKelvin is Zuker at a temperature in Kelvin rather than Celsius.
+func FoldAtKelvin(seq string, kelvin float64) (Result, error) {
+	return Zuker(seq, kelvin-zeroCelsius)
+}
+
+// FoldWithMatrices is Zuker, also returning the energies of the dynamic
+// programming matrices it filled, V and W, in kcal/mol. V[start][end] is
+// the lowest free energy of the subsequence from start to end, inclusive,
+// with start paired to end, and W[start][end] the lowest with or without
+// that pair. Both are square, with NaN for the subsequences the fold
+// didn't need, like those with end before start, and +Inf for those with
+// no structure. They're copies, so changing them doesn't change any fold.
+func FoldWithMatrices(seq string, temp float64) (Result, [][]float64, [][]float64, error) {
+	foldContext, err := newFoldingContext(seq, temp)
+	if err != nil {
+		return Result{}, nil, nil, fmt.Errorf("error creating folding context: %w", err)
+	}
+	return minimumFreeEnergyResult(foldContext), foldContext.pairedMinimumFreeEnergyV.energies(), foldContext.unpairedMinimumFreeEnergyW.energies(), nil
 }
 
 // unpairedMinimumFreeEnergyW returns the minimum free energy of a subsequence
@@ -81,43 +125,49 @@ func Zuker(seq string, temp float64) (Result, error) {
 //	 foldContext: The context for this sequence
 //
 // Returns the free energy for the subsequence from start to end
-func unpairedMinimumFreeEnergyW(start, end int, foldContext context) (nucleicAcidStructure, error) {
-	if !foldContext.unpairedMinimumFreeEnergyW[start][end].Equal(defaultStructure) {
-		return foldContext.unpairedMinimumFreeEnergyW[start][end], nil
+func unpairedMinimumFreeEnergyW(start, end int, foldContext context) (cachedStructure, error) {
+	if cached := foldContext.unpairedMinimumFreeEnergyW.get(start, end); cached.kind != unfilled {
+		return cached, nil
 	}
 
-	if end-start < minLenForStruct {
-		foldContext.unpairedMinimumFreeEnergyW[start][end] = invalidStructure
-		return foldContext.unpairedMinimumFreeEnergyW[start][end], nil
+	if end-start < minLenForStruct && !foldContext.spansCut(start, end) || foldContext.constraints != nil && !foldContext.constraints.closedWithin(start, end) {
+		foldContext.unpairedMinimumFreeEnergyW.set(start, end, invalidCached)
+		return invalidCached, nil
 	}
 
 	endDanglingLeft, err := unpairedMinimumFreeEnergyW(start+1, end, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
+		return cachedStructure{}, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
 	}
 	endDanglingRight, err := unpairedMinimumFreeEnergyW(start, end-1, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
+		return cachedStructure{}, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
 	}
 	endsPaired, err := pairedMinimumFreeEnergyV(start, end, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
+		return cachedStructure{}, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
 	}
 
-	endBifurcation := invalidStructure
+	// the exterior loop adds nothing, so it can be split between branches
+	// at any base, each side folding on its own.
+	endBifurcation := invalidCached
 	for k := start + 1; k < end-1; k++ {
-		testBranch, err := multibranch(start, k, end, foldContext, false)
+		left, err := unpairedMinimumFreeEnergyW(start, k, foldContext)
 		if err != nil {
-			return defaultStructure, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
+			return cachedStructure{}, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
+		}
+		right, err := unpairedMinimumFreeEnergyW(k+1, end, foldContext)
+		if err != nil {
+			return cachedStructure{}, fmt.Errorf("w: subsequence (%d, %d): %w", start, end, err)
 		}
 
-		if testBranch.Valid() && testBranch.energy < endBifurcation.energy {
-			endBifurcation = testBranch
+		if left.Valid() && right.Valid() && left.energy+right.energy < endBifurcation.energy {
+			endBifurcation = cachedStructure{energy: left.energy + right.energy, start: int32(start), end: int32(end), first: int32(k), kind: exteriorBranches}
 		}
 	}
 
 	minStuctEnergy := minimumStructure(endDanglingLeft, endDanglingRight, endsPaired, endBifurcation)
-	foldContext.unpairedMinimumFreeEnergyW[start][end] = minStuctEnergy
+	foldContext.unpairedMinimumFreeEnergyW.set(start, end, minStuctEnergy)
 	return minStuctEnergy, nil
 }
 
@@ -136,57 +186,67 @@ func unpairedMinimumFreeEnergyW(start, end int, foldContext context) (nucleicAci
 //	 foldContext: The context for this sequence
 //
 // Returns the minimum energy folding structure possible between start and end on seq
-func pairedMinimumFreeEnergyV(start, end int, foldContext context) (nucleicAcidStructure, error) {
-	if !foldContext.pairedMinimumFreeEnergyV[start][end].Equal(defaultStructure) {
-		return foldContext.pairedMinimumFreeEnergyV[start][end], nil
+func pairedMinimumFreeEnergyV(start, end int, foldContext context) (cachedStructure, error) {
+	if cached := foldContext.pairedMinimumFreeEnergyV.get(start, end); cached.kind != unfilled {
+		return cached, nil
 	}
 
 	// the ends must basepair for pairedMinimumFreeEnergyV(start,end)
-	if foldContext.energies.complement(rune(foldContext.seq[start])) != rune(foldContext.seq[end]) {
-		foldContext.pairedMinimumFreeEnergyV[start][end] = invalidStructure
-		return foldContext.pairedMinimumFreeEnergyV[start][end], nil
+	if !foldContext.canPair(start, end) {
+		foldContext.pairedMinimumFreeEnergyV.set(start, end, invalidCached)
+		return invalidCached, nil
+	}
+	constraints := foldContext.constraints
+	if constraints != nil && !constraints.canPair(start, end) {
+		foldContext.pairedMinimumFreeEnergyV.set(start, end, invalidCached)
+		return invalidCached, nil
 	}
 	// if the basepair is isolated, and the seq large, penalize at 1,600 kcal/mol
 	// heuristic for speeding this up
 	// from https://www.ncbi.nlm.nih.gov/pubmed/10329189
-	isolatedOuter := true
-	if start > 0 && end < len(foldContext.seq)-1 {
-		isolatedOuter = foldContext.energies.complement(rune(foldContext.seq[start-1])) != rune(foldContext.seq[end+1])
-	}
-	isolatedInner := foldContext.energies.complement(rune(foldContext.seq[start+1])) != rune(foldContext.seq[end-1])
-
-	if isolatedOuter && isolatedInner {
-		foldContext.pairedMinimumFreeEnergyV[start][end] = nucleicAcidStructure{energy: isolatedBasePairPenalty}
-		return foldContext.pairedMinimumFreeEnergyV[start][end], nil
+	if isolated(start, end, foldContext) && (constraints == nil || !constraints.forced(start, end)) {
+		isolated := cachedStructure{energy: isolatedBasePairPenalty, start: int32(start), end: int32(end), kind: isolatedPair}
+		foldContext.pairedMinimumFreeEnergyV.set(start, end, isolated)
+		return isolated, nil
 	}
 
-	paired := pair(foldContext.seq, start, start+1, end, end-1)
 	hairpin, err := hairpin(start, end, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
+		return cachedStructure{}, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
+	}
+	e1 := cachedStructure{energy: hairpin, start: int32(start), end: int32(end), kind: hairpinLoop}
+	if constraints != nil && constraints.forcedBetween(start+1, end-1) {
+		// a forced pair can't be inside a hairpin
+		e1 = invalidCached
 	}
-	e1 := nucleicAcidStructure{energy: hairpin, description: "HAIRPIN:" + paired}
-	if end-start == minLenForStruct { // small hairpin; 4bp
-		foldContext.pairedMinimumFreeEnergyV[start][end] = e1
-		foldContext.unpairedMinimumFreeEnergyW[start][end] = e1
-		return foldContext.pairedMinimumFreeEnergyV[start][end], nil
+	if end-start == minLenForStruct && !foldContext.spansCut(start, end) { // small hairpin; 4bp
+		foldContext.pairedMinimumFreeEnergyV.set(start, end, e1)
+		foldContext.unpairedMinimumFreeEnergyW.set(start, end, e1)
+		return e1, nil
 	}
 
-	n := len(foldContext.seq)
-	e2 := nucleicAcidStructure{energy: math.Inf(1)}
-	for rightOfStart := start + 1; rightOfStart < end-minLenForStruct; rightOfStart++ {
-		for leftOfEnd := rightOfStart + minLenForStruct; leftOfEnd < end; leftOfEnd++ {
+	// pairs across the cut between two strands can be as close as adjacent
+	innerSpan := minLenForStruct
+	if foldContext.cut > 0 {
+		innerSpan = 1
+	}
+	e2 := invalidCached
+	for rightOfStart := start + 1; rightOfStart < end-innerSpan; rightOfStart++ {
+		for leftOfEnd := rightOfStart + innerSpan; leftOfEnd < end; leftOfEnd++ {
+			if leftOfEnd-rightOfStart < minLenForStruct && !foldContext.spansCut(rightOfStart, leftOfEnd) {
+				continue
+			}
 			// rightOfStart and leftOfEnd must match
-			if foldContext.energies.complement(rune(foldContext.seq[rightOfStart])) != rune(foldContext.seq[leftOfEnd]) {
+			if !foldContext.canPair(rightOfStart, leftOfEnd) {
+				continue
+			}
+			// bases forced to pair can't be in the loop
+			if constraints != nil && (constraints.forcedBetween(start+1, rightOfStart-1) || constraints.forcedBetween(leftOfEnd+1, end-1)) {
 				continue
 			}
 
-			paired := pair(foldContext.seq, start, rightOfStart, end, leftOfEnd)
-			pairLeft := pair(foldContext.seq, start, start+1, end, end-1)
-			pairRight := pair(foldContext.seq, rightOfStart-1, rightOfStart, leftOfEnd+1, leftOfEnd)
-			_, pairLeftInner := foldContext.energies.nearestNeighbors[pairLeft]
-			_, pairRightInner := foldContext.energies.nearestNeighbors[pairRight]
-			pairInner := pairLeftInner || pairRightInner
+			pairInner := foldContext.tables.nearestNeighbors.known[foldContext.pairCode(start, start+1, end, end-1)] ||
+				foldContext.tables.nearestNeighbors.known[foldContext.pairCode(rightOfStart-1, rightOfStart, leftOfEnd+1, leftOfEnd)]
 
 			isStack := rightOfStart == start+1 && leftOfEnd == end-1
 			bulgeLeft := rightOfStart > start+1
@@ -194,48 +254,33 @@ func pairedMinimumFreeEnergyV(start, end int, foldContext context) (nucleicAcidS
 
 			var (
 				e2Test     float64
-				e2TestType string
+				e2TestKind loopKind
 				err        error
 			)
 			switch {
+			case foldContext.spansCut(start, end) && !foldContext.spansCut(rightOfStart, leftOfEnd):
+				// the cut between two strands is in the loop, so it's open
+				e2Test = foldContext.duplexInitiation
+				e2TestKind = intermolecularLoop
 			case isStack:
 				// it's a neighboring/stacking pair in a helix
 				e2Test = stack(start, rightOfStart, end, leftOfEnd, foldContext)
-				e2TestType = fmt.Sprintf("STACK:%s", paired)
-
-				if start > 0 && end == n-1 || start == 0 && end < n-1 {
-					// there's a dangling end
-					e2TestType = fmt.Sprintf("STACKDanglingEnds:%s", paired)
-				}
+				e2TestKind = stackLoop
 			case bulgeLeft && bulgeRight && !pairInner:
 				// it's an interior loop
 				il, err := internalLoop(start, rightOfStart, end, leftOfEnd, foldContext)
 				if err != nil {
-					return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
+					return cachedStructure{}, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
 				}
 				e2Test = il
-				e2TestType = fmt.Sprintf("INTERIOR_LOOP:%d/%d", rightOfStart-start, end-leftOfEnd)
-
-				if rightOfStart-start == 2 && end-leftOfEnd == 2 {
-					loopLeftIndex := foldContext.seq[start : rightOfStart+1]
-					loopRightIndex := foldContext.seq[leftOfEnd : end+1]
-					// technically an interior loop of 1. really 1bp mismatch
-					e2TestType = fmt.Sprintf("STACK:%s/%s", loopLeftIndex, transform.Reverse(loopRightIndex))
-				}
-			case bulgeLeft && !bulgeRight:
-				// it's a bulge on the left side
+				e2TestKind = interiorLoop
+			case bulgeLeft != bulgeRight:
+				// it's a bulge on the left or right side
 				e2Test, err = Bulge(start, rightOfStart, end, leftOfEnd, foldContext)
 				if err != nil {
-					return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
+					return cachedStructure{}, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
 				}
-				e2TestType = fmt.Sprintf("BULGE:%d", rightOfStart-start)
-			case !bulgeLeft && bulgeRight:
-				// it's a bulge on the right side
-				e2Test, err = Bulge(start, rightOfStart, end, leftOfEnd, foldContext)
-				if err != nil {
-					return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
-				}
-				e2TestType = fmt.Sprintf("BULGE:%d", end-leftOfEnd)
+				e2TestKind = bulgeLoop
 			default:
 				// it's basically a hairpin, only outside bp match
 				continue
@@ -244,33 +289,97 @@ func pairedMinimumFreeEnergyV(start, end int, foldContext context) (nucleicAcidS
 			// add pairedMinimumFreeEnergyV(start', end')
 			tv, err := pairedMinimumFreeEnergyV(rightOfStart, leftOfEnd, foldContext)
 			if err != nil {
-				return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
+				return cachedStructure{}, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
 			}
 			e2Test += tv.energy
 			if e2Test != math.Inf(-1) && e2Test < e2.energy {
-				e2 = nucleicAcidStructure{energy: e2Test, description: e2TestType, inner: []subsequence{{rightOfStart, leftOfEnd}}}
+				e2 = cachedStructure{energy: e2Test, start: int32(start), end: int32(end), first: int32(rightOfStart), second: int32(leftOfEnd), kind: e2TestKind}
 			}
 		}
 	}
 
-	e3 := invalidStructure
-	if !isolatedOuter || start == 0 || end == len(foldContext.seq)-1 {
-		for k := start + 1; k < end-1; k++ {
-			e3Test, err := multibranch(start, k, end, foldContext, true)
-			if err != nil {
-				return defaultStructure, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
-			}
-
-			if e3Test.Valid() && e3Test.energy < e3.energy {
-				e3 = e3Test
-			}
-		}
+	e3, err := multibranch(start, end, foldContext)
+	if err != nil {
+		return cachedStructure{}, fmt.Errorf("v: subsequence (%d, %d): %w", start, end, err)
 	}
 	e := minimumStructure(e1, e2, e3)
-	foldContext.pairedMinimumFreeEnergyV[start][end] = e
+	foldContext.pairedMinimumFreeEnergyV.set(start, end, e)
 	return e, nil
 }
 
+// isolated returns whether the pair of start and end would stand alone:
+// neither the bases just outside it nor the bases just inside it can pair.
+// The ends of the sequence count as unable to pair.
+func isolated(start, end int, foldContext context) bool {
+	isolatedOuter := true
+	if start > 0 && end < len(foldContext.seq)-1 {
+		isolatedOuter = !foldContext.canPair(start-1, end+1)
+	}
+	return isolatedOuter && !foldContext.canPair(start+1, end-1)
+}
+
+// loopKind is how a cachedStructure was formed.
+type loopKind uint8
+
+const (
+	// unfilled is a cachedStructure that hasn't been computed yet.
+	unfilled loopKind = iota
+	// noStructure is a cachedStructure that isn't valid.
+	noStructure
+	// isolatedPair is a pair penalized for being isolated.
+	isolatedPair
+	// hairpinLoop closes no other pair.
+	hairpinLoop
+	// stackLoop, interiorLoop, bulgeLoop and intermolecularLoop are closed
+	// by two pairs, one inside the other.
+	stackLoop
+	interiorLoop
+	bulgeLoop
+	intermolecularLoop
+	// exteriorBranches are branches of W with no pair closing them, and
+	// multibranchLoop are branches closed by a pair, split at a mid.
+	exteriorBranches
+	multibranchLoop
+	// intermolecularBranches are branches closed by a pair whose loop holds
+	// the cut between two strands, so it's open, split at the cut.
+	intermolecularBranches
+	// multibranchPair, multibranchUnpaired and multibranchSplit are the
+	// parts of a multibranch loop in WM: a branch closed by the pair of
+	// start and end, an unpaired base at one end followed by the part from
+	// first to second, and two parts split at first.
+	multibranchPair
+	multibranchUnpaired
+	multibranchSplit
+)
+
+// describeLoop returns the description of the loop of kind between the pair
+// of start and end and the pair of rightOfStart and leftOfEnd. Descriptions
+// are only built for the loops that are kept, since formatting them is
+// slower than finding their energy.
+func describeLoop(kind loopKind, start, rightOfStart, end, leftOfEnd int, foldContext context) string {
+	n := len(foldContext.seq)
+	paired := pair(foldContext.seq, start, rightOfStart, end, leftOfEnd)
+	switch kind {
+	case intermolecularLoop:
+		return fmt.Sprintf("INTERMOLECULAR:%s", paired)
+	case stackLoop:
+		if start > 0 && end == n-1 || start == 0 && end < n-1 {
+			// there's a dangling end
+			return fmt.Sprintf("STACKDanglingEnds:%s", paired)
+		}
+		return fmt.Sprintf("STACK:%s", paired)
+	case interiorLoop:
+		if rightOfStart-start == 2 && end-leftOfEnd == 2 {
+			loopLeftIndex := foldContext.seq[start : rightOfStart+1]
+			loopRightIndex := foldContext.seq[leftOfEnd : end+1]
+			// technically an interior loop of 1. really 1bp mismatch
+			return fmt.Sprintf("STACK:%s/%s", loopLeftIndex, transform.Reverse(loopRightIndex))
+		}
+		return fmt.Sprintf("INTERIOR_LOOP:%d/%d", rightOfStart-start, end-leftOfEnd)
+	}
+	return fmt.Sprintf("BULGE:%d", max(rightOfStart-start, end-leftOfEnd))
+}
+
 // Bulge calculates the free energy associated with a bulge.
 //
 // Args:
@@ -304,8 +413,8 @@ func Bulge(start, rightOfStart, end, leftOfEnd int, foldContext context) (float6
 
 	if loopLength == 1 {
 		// if len 1, include the delta G of intervening nearestNeighbors (SantaLucia 2004)
-		paired := pair(foldContext.seq, start, rightOfStart, end, leftOfEnd)
-		if _, ok := foldContext.energies.nearestNeighbors[paired]; !ok {
+		if !foldContext.tables.nearestNeighbors.known[foldContext.pairCode(start, rightOfStart, end, leftOfEnd)] {
+			paired := pair(foldContext.seq, start, rightOfStart, end, leftOfEnd)
 			return 0, fmt.Errorf("bulge: paired %q not in the nearestNeighbors energies", paired)
 		}
 		dG += stack(start, rightOfStart, end, leftOfEnd, foldContext)
@@ -321,196 +430,167 @@ func Bulge(start, rightOfStart, end, leftOfEnd int, foldContext context) (float6
 	return dG, nil
 }
 
-func addBranch(structure nucleicAcidStructure, branches *[]subsequence, foldContext context) error {
-	if !structure.Valid() || len(structure.inner) == 0 {
-		return nil
-	}
-	if len(structure.inner) == 1 {
-		*branches = append(*branches, structure.inner[0])
-		return nil
-	}
-	for _, inner := range structure.inner {
-		structure, err := unpairedMinimumFreeEnergyW(inner.start, inner.end, foldContext)
-		if err != nil {
-			return err
-		}
-		err = addBranch(structure, branches, foldContext)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// multibranch calculates a multi-branch foldEnergy penalty using a linear formula.
+// multibranchMinimumFreeEnergyWM returns the minimum free energy of a
+// subsequence from start to end, inclusive, as part of a multibranch loop:
+// one or more branches with the energy each adds to the loop, and the
+// energy of each unpaired base between them.
 //
-// From Jaeger, Turner, and Zuker, 1989.
-// Found to be better than logarithmic in Ward, et al. 2017
+// Each branch costs b and each unpaired base c of the linear multibranch
+// energy, so WM splits like W does, and a multibranch loop is its closing
+// pair, a and b, and the best split of what's inside into two parts of WM.
 // Args:
 //
-//		start: The left starting index
-//		mid: The mid-point in the search
-//		end: The right ending index
-//	 foldContext: The FoldingContext for this sequence
-//		helix: Whether this multibranch is enclosed by a helix
-//		helix: Whether pairedMinimumFreeEnergyV(start, end) bond with one another in a helix
+//		start: The start index
+//		end: The end index (inclusive)
+//	 foldContext: The context for this sequence
 //
-// Returns a multi-branch structure
-func multibranch(start, mid, end int, foldContext context, helix bool) (nucleicAcidStructure, error) {
-	var (
-		left, right nucleicAcidStructure
-		err         error
-	)
-	if helix {
-		left, err = unpairedMinimumFreeEnergyW(start+1, mid, foldContext)
+// Returns the free energy for the subsequence from start to end
+func multibranchMinimumFreeEnergyWM(start, end int, foldContext context) (cachedStructure, error) {
+	if cached := foldContext.multibranchMinimumFreeEnergyWM.get(start, end); cached.kind != unfilled {
+		return cached, nil
+	}
+
+	if end-start < minLenForStruct && !foldContext.spansCut(start, end) || foldContext.constraints != nil && !foldContext.constraints.closedWithin(start, end) {
+		foldContext.multibranchMinimumFreeEnergyWM.set(start, end, invalidCached)
+		return invalidCached, nil
+	}
+	multibranch := foldContext.energies.multibranch
+
+	paired, err := pairedMinimumFreeEnergyV(start, end, foldContext)
+	if err != nil {
+		return cachedStructure{}, fmt.Errorf("wm: subsequence (%d, %d): %w", start, end, err)
+	}
+	branch := invalidCached
+	if paired.Valid() {
+		branch = cachedStructure{energy: paired.energy + multibranch.unpairedCount, start: int32(start), end: int32(end), kind: multibranchPair}
+	}
+
+	// a loop that holds the cut between two strands is open, so its
+	// unpaired bases can't be beside the cut.
+	unpairedLeft := invalidCached
+	if foldContext.cut != start+1 {
+		rest, err := multibranchMinimumFreeEnergyWM(start+1, end, foldContext)
 		if err != nil {
-			return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, end, mid, err)
+			return cachedStructure{}, fmt.Errorf("wm: subsequence (%d, %d): %w", start, end, err)
 		}
-		right, err = unpairedMinimumFreeEnergyW(mid+1, end-1, foldContext)
-		if err != nil {
-			return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, end, mid, err)
+		if rest.Valid() {
+			unpairedLeft = cachedStructure{energy: rest.energy + multibranch.coaxialStackCount, start: int32(start), end: int32(end), first: int32(start + 1), second: int32(end), kind: multibranchUnpaired}
 		}
-	} else {
-		left, err = unpairedMinimumFreeEnergyW(start, mid, foldContext)
+	}
+	unpairedRight := invalidCached
+	if foldContext.cut != end {
+		rest, err := multibranchMinimumFreeEnergyWM(start, end-1, foldContext)
 		if err != nil {
-			return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, end, mid, err)
+			return cachedStructure{}, fmt.Errorf("wm: subsequence (%d, %d): %w", start, end, err)
 		}
-		right, err = unpairedMinimumFreeEnergyW(mid+1, end, foldContext)
-		if err != nil {
-			return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, end, mid, err)
+		if rest.Valid() {
+			unpairedRight = cachedStructure{energy: rest.energy + multibranch.coaxialStackCount, start: int32(start), end: int32(end), first: int32(start), second: int32(end - 1), kind: multibranchUnpaired}
 		}
 	}
 
-	if !left.Valid() || !right.Valid() {
-		return invalidStructure, nil
+	split := invalidCached
+	for k := start + 1; k < end-1; k++ {
+		left, right, err := multibranchSides(start, k, end, foldContext)
+		if err != nil {
+			return cachedStructure{}, fmt.Errorf("wm: subsequence (%d, %d): %w", start, end, err)
+		}
+		if left.Valid() && right.Valid() && left.energy+right.energy < split.energy {
+			split = cachedStructure{energy: left.energy + right.energy, start: int32(start), end: int32(end), first: int32(k), kind: multibranchSplit}
+		}
 	}
 
-	// gather all branches of this multi-branch structure
-	var branches []subsequence
+	minimum := minimumStructure(branch, unpairedLeft, unpairedRight, split)
+	foldContext.multibranchMinimumFreeEnergyWM.set(start, end, minimum)
+	return minimum, nil
+}
 
-	// in python this was a recursive closure, in Go this is not possible so
-	// we pull it out and pass all the parameters
-	err = addBranch(left, &branches, foldContext)
+// multibranchSides returns multibranchMinimumFreeEnergyWM of start to mid
+// and of mid+1 to end, or invalid structures if the cut between two
+// strands is between them.
+func multibranchSides(start, mid, end int, foldContext context) (cachedStructure, cachedStructure, error) {
+	if foldContext.cut == mid+1 {
+		return invalidCached, invalidCached, nil
+	}
+	left, err := multibranchMinimumFreeEnergyWM(start, mid, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, mid, end, err)
+		return cachedStructure{}, cachedStructure{}, err
 	}
-	err = addBranch(right, &branches, foldContext)
+	right, err := multibranchMinimumFreeEnergyWM(mid+1, end, foldContext)
 	if err != nil {
-		return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, mid, end, err)
-	}
-
-	// this isn't multi-branched
-	if len(branches) < 2 {
-		return invalidStructure, nil
-	}
-
-	// if there's a helix, start,end counts as well
-	if helix {
-		branches = append(branches, subsequence{start, end})
-	}
-
-	// count up unpaired bp and asymmetry
-	branchCount := len(branches)
-	unpaired := 0
-	summedEnergy := 0.0
-	curSequence := subsequence{start, end}
-	for index, currentBranch := range branches {
-		leftStart, leftEnd := currentBranch.start, currentBranch.end
-		curBranchLeft := branches[abs((index-1)%len(branches))]
-		leftOfEnd := curBranchLeft.end
-		curBranchRight := branches[abs((index+1)%len(branches))]
-		rightStart, rightEnd := curBranchRight.start, curBranchRight.end
-
-		// add foldEnergy from unpaired bp to the right
-		// of the helix as though it was a dangling end
-		// if there's only one bp, it goes to whichever
-		// helix (this or the next) has the more favorable energy
-		unpairedLeft := 0
-		unpairedRight := 0
-		danglingEnergy := 0.0
-		if index == len(branches)-1 && !helix {
-			// pass
-		} else if curBranchRight == curSequence {
-			unpairedLeft = leftStart - leftOfEnd - 1
-			unpairedRight = rightEnd - leftEnd - 1
-
-			if unpairedLeft != 0 && unpairedRight != 0 {
-				danglingEnergy = stack(leftStart-1, leftStart, leftEnd+1, leftEnd, foldContext)
-			} else if unpairedRight != 0 {
-				danglingEnergy = stack(-1, leftStart, leftEnd+1, leftEnd, foldContext)
-				if unpairedRight == 1 {
-					danglingEnergy = math.Min(stack(rightStart, -1, rightEnd, rightEnd-1, foldContext), danglingEnergy)
-				}
-			}
-		} else if currentBranch == curSequence {
-			unpairedLeft = leftEnd - leftOfEnd - 1
-			unpairedRight = rightStart - leftStart - 1
-
-			if unpairedLeft != 0 && unpairedRight != 0 {
-				danglingEnergy = stack(leftStart-1, leftStart, leftEnd+1, leftEnd, foldContext)
-			} else if unpairedRight != 0 {
-				danglingEnergy = stack(leftStart, leftStart+1, leftEnd, -1, foldContext)
-				if unpairedRight == 1 {
-					danglingEnergy = math.Min(stack(rightStart-1, rightStart, -1, rightEnd, foldContext), danglingEnergy)
-				}
-			}
-		} else {
-			unpairedLeft = leftStart - leftOfEnd - 1
-			unpairedRight = rightStart - leftEnd - 1
-
-			if unpairedLeft != 0 && unpairedRight != 0 {
-				danglingEnergy = stack(leftStart-1, leftStart, leftEnd+1, leftEnd, foldContext)
-			} else if unpairedRight != 0 {
-				danglingEnergy = stack(-1, leftStart, leftEnd+1, leftEnd, foldContext)
-				if unpairedRight == 1 {
-					danglingEnergy = math.Min(stack(leftStart-1, leftStart, leftEnd+1, leftEnd, foldContext), danglingEnergy)
-				}
-			}
-		}
-		summedEnergy += danglingEnergy
-		unpaired += unpairedRight
-		if unpairedRight < 0 {
-			return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): unpairedRight < 0", start, end, mid)
-		}
+		return cachedStructure{}, cachedStructure{}, err
+	}
+	return left, right, nil
+}
 
-		if currentBranch != curSequence { // add energy
-			w, err := unpairedMinimumFreeEnergyW(leftStart, leftEnd, foldContext)
+// multibranch returns the lowest energy multibranch loop closed by the pair
+// of start and end, which has at least two branches.
+//
+// From Jaeger, Turner, and Zuker, 1989, the loop's energy is linear: a for
+// the loop, b for each branch including the closing pair, and c for each
+// unpaired base. Found to be better than logarithmic in Ward, et al. 2017.
+// A loop holding the cut between two strands is open instead, and costs
+// the duplex initiation plus whatever each strand folds to on its own.
+func multibranch(start, end int, foldContext context) (cachedStructure, error) {
+	multibranch := foldContext.energies.multibranch
+	loop := invalidCached
+	if foldContext.spansCut(start, end) {
+		energy := foldContext.duplexInitiation
+		for _, side := range [][2]int{{start + 1, foldContext.cut - 1}, {foldContext.cut, end - 1}} {
+			sideEnergy, err := openLoopSide(side[0], side[1], foldContext)
 			if err != nil {
-				return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): %w", start, end, mid, err)
+				return cachedStructure{}, err
 			}
-			summedEnergy += w.energy
+			energy += sideEnergy
 		}
+		loop = cachedStructure{energy: energy, start: int32(start), end: int32(end), first: int32(foldContext.cut - 1), kind: intermolecularBranches}
 	}
-
-	if unpaired < 0 {
-		return defaultStructure, fmt.Errorf("multibranch: subsequence (%d, %d, %d): unpaired < 0", start, end, mid)
+	if foldContext.cut == start+1 || foldContext.cut == end {
+		return loop, nil
 	}
 
-	// this is just for readability of the formulas below
-	var (
-		helicesCount          = foldContext.energies.multibranch.helicesCount
-		unpairedCount         = foldContext.energies.multibranch.unpairedCount
-		coaxialStackCount     = foldContext.energies.multibranch.coaxialStackCount
-		terminalMismatchCount = foldContext.energies.multibranch.terminalMismatchCount
-	)
-
-	// penalty for unmatched bp and multi-branch
-	multibranchEnergy := helicesCount + unpairedCount*float64(len(branches)) + coaxialStackCount*float64(unpaired)
-
-	if unpaired == 0 {
-		multibranchEnergy = helicesCount + terminalMismatchCount
+	for k := start + 1; k < end-1; k++ {
+		left, right, err := multibranchSides(start+1, k, end-1, foldContext)
+		if err != nil {
+			return cachedStructure{}, err
+		}
+		if !left.Valid() || !right.Valid() {
+			continue
+		}
+		energy := multibranch.helicesCount + multibranch.unpairedCount + left.energy + right.energy
+		if energy < loop.energy {
+			loop = cachedStructure{energy: energy, start: int32(start), end: int32(end), first: int32(k), kind: multibranchLoop}
+		}
 	}
+	return loop, nil
+}
 
-	// energy of min-energy neighbors
-	e := multibranchEnergy + summedEnergy
-
-	// pointer to next structures
-	if helix {
-		// branches.pop()
-		branches = branches[:len(branches)-1]
+// openLoopSide returns the energy of the bases from start to end, inclusive,
+// on one side of the cut in an open loop: unpairedMinimumFreeEnergyW, or 0
+// if they're better off unpaired.
+func openLoopSide(start, end int, foldContext context) (float64, error) {
+	if end < start {
+		return 0, nil
 	}
+	side, err := unpairedMinimumFreeEnergyW(start, end, foldContext)
+	if err != nil {
+		return 0, err
+	}
+	if !side.Valid() || side.energy > 0 {
+		return 0, nil
+	}
+	return side.energy, nil
+}
 
-	return nucleicAcidStructure{energy: e, description: fmt.Sprintf("BIFURCATION:%dn/%dh", unpaired, branchCount), inner: branches}, nil
+// multibranchLoopEnergy returns the energy of the multibranch loop closed by
+// the pair of start and end with branches inside it, not counting the
+// energies of the branches themselves.
+func multibranchLoopEnergy(start, end int, branches []subsequence, foldContext context) float64 {
+	multibranch := foldContext.energies.multibranch
+	unpaired := end - start - 1
+	for _, branch := range branches {
+		unpaired -= branch.end - branch.start + 1
+	}
+	return multibranch.helicesCount + multibranch.unpairedCount*float64(len(branches)+1) + multibranch.coaxialStackCount*float64(unpaired)
 }
 
 // internalLoop calculates the free energy of an internal loop.
@@ -567,15 +647,8 @@ func internalLoop(start, rightOfStart, end, leftOfEnd int, foldContext context)
 	dG += loopsAsymmetryPenalty * loopAsymmetry
 
 	// apply penalty based on the mismatching pairs on either side of the loop
-	pairedMismatchLeftEnergy := pair(foldContext.seq, start, start+1, end, end-1)
-	foldEnergy := foldContext.energies.terminalMismatches[pairedMismatchLeftEnergy]
-	enthalpyHDifference, entropySDifference = foldEnergy.enthalpyH, foldEnergy.entropyS
-	dG += deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
-
-	pairedMismatchRightEnergy := pair(foldContext.seq, rightOfStart-1, rightOfStart, leftOfEnd+1, leftOfEnd)
-	foldEnergy = foldContext.energies.terminalMismatches[pairedMismatchRightEnergy]
-	enthalpyHDifference, entropySDifference = foldEnergy.enthalpyH, foldEnergy.entropyS
-	dG += deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+	dG += foldContext.tables.terminalMismatches.deltaG[foldContext.pairCode(start, start+1, end, end-1)]
+	dG += foldContext.tables.terminalMismatches.deltaG[foldContext.pairCode(rightOfStart-1, rightOfStart, leftOfEnd+1, leftOfEnd)]
 
 	return dG, nil
 }
@@ -606,66 +679,44 @@ func stack(start, rightOfStart, end, leftOfEnd int, foldContext context) float64
 		}
 	}
 
-	paired := pair(foldContext.seq, start, rightOfStart, end, leftOfEnd)
+	tables := foldContext.tables
+	paired := foldContext.pairCode(start, rightOfStart, end, leftOfEnd)
 	// if any(x == -1 for x in [start,rightOfStart, end, leftOfEnd]):
 	for _, indices := range []int{start, rightOfStart, end, leftOfEnd} {
 		if indices == -1 {
 			// it's a dangling end
-			foldEnergy := foldContext.energies.danglingEnds[paired]
-			enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-			return deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+			return tables.danglingEnds.deltaG[paired]
 		}
 	}
 
+	// pairs that aren't nearest neighbors are mismatches
+	dG := tables.internalMismatches.deltaG[paired]
+	if tables.nearestNeighbors.known[paired] {
+		dG = tables.nearestNeighbors.deltaG[paired]
+	}
 	if start > 0 && end < len(foldContext.seq)-1 {
 		// it's internal
-		foldEnergy, ok := foldContext.energies.nearestNeighbors[paired]
-		if !ok {
-			foldEnergy = foldContext.energies.internalMismatches[paired]
-		}
-		enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-		return deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+		return dG
 	}
 	if start == 0 && end == len(foldContext.seq)-1 {
 		// it's terminal
-		foldEnergy, ok := foldContext.energies.nearestNeighbors[paired]
-		if !ok {
-			foldEnergy = foldContext.energies.internalMismatches[paired]
-		}
-		enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-		return deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+		return dG
 	}
 
 	if start > 0 && end == len(foldContext.seq)-1 {
 		// it's dangling on left
-		foldEnergy, ok := foldContext.energies.nearestNeighbors[paired]
-		if !ok {
-			foldEnergy = foldContext.energies.internalMismatches[paired]
-		}
-		enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-		dG := deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
-
-		pairDanglingEnds := fmt.Sprintf("%c%c/.%c", foldContext.seq[start-1], foldContext.seq[start], foldContext.seq[end])
-		if foldEnergy, ok := foldContext.energies.danglingEnds[pairDanglingEnds]; ok {
-			enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-			dG += deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+		pairDanglingEnds := foldContext.pairCode(start-1, start, -1, end)
+		if tables.danglingEnds.known[pairDanglingEnds] {
+			dG += tables.danglingEnds.deltaG[pairDanglingEnds]
 		}
 		return dG
 	}
 
 	if start == 0 && end < len(foldContext.seq)-1 {
 		// it's dangling on right
-		foldEnergy, ok := foldContext.energies.nearestNeighbors[paired]
-		if !ok {
-			foldEnergy = foldContext.energies.internalMismatches[paired]
-		}
-		enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-		dG := deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
-
-		pairDanglingEnds := fmt.Sprintf(".%c/%c%c", +foldContext.seq[start], foldContext.seq[end+1], foldContext.seq[end])
-		if foldEnergy, ok := foldContext.energies.danglingEnds[pairDanglingEnds]; ok {
-			enthalpyHDifference, entropySDifference := foldEnergy.enthalpyH, foldEnergy.entropyS
-			dG += deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+		pairDanglingEnds := foldContext.pairCode(-1, start, end+1, end)
+		if tables.danglingEnds.known[pairDanglingEnds] {
+			dG += tables.danglingEnds.deltaG[pairDanglingEnds]
 			return dG
 		}
 	}
@@ -681,21 +732,26 @@ func stack(start, rightOfStart, end, leftOfEnd int, foldContext context) float64
 //
 // Returns the free energy increment from the hairpin structure
 func hairpin(start, end int, foldContext context) (float64, error) {
+	if foldContext.spansCut(start, end) {
+		// the cut between two strands is in the loop, so it's open
+		return foldContext.duplexInitiation, nil
+	}
 	if end-start < minLenForStruct {
 		return math.Inf(1), nil
 	}
 
 	hairpinSeq := foldContext.seq[start : end+1]
 	hairpinLength := len(hairpinSeq) - 2
-	paired := pair(foldContext.seq, start, start+1, end, end-1)
 
-	if foldContext.energies.complement(rune(hairpinSeq[0])) != rune(hairpinSeq[len(hairpinSeq)-1]) {
+	if !foldContext.canPair(start, end) {
 		// not known terminal pair, nothing to close "hairpin"
 		return 0, fmt.Errorf("hairpin: subsequence (%d, %d): unknown hairpin terminal pairing %c - %c", start, end, hairpinSeq[0], hairpinSeq[len(hairpinSeq)-1])
 	}
 
 	dG := 0.0
-	if foldContext.energies.triTetraLoops != nil {
+	if foldContext.energies.triTetraLoops != nil && foldContext.tables.codes == allCodes {
+		dG = foldContext.ambiguousTriTetraLoop(start, end)
+	} else if foldContext.energies.triTetraLoops != nil {
 		if energy, ok := foldContext.energies.triTetraLoops[hairpinSeq]; ok {
 			// it's a pre-known hairpin with known value
 			enthalpyHDifference, entropySDifference := energy.enthalpyH, energy.entropyS
@@ -716,10 +772,9 @@ func hairpin(start, end int, foldContext context) (float64, error) {
 	}
 
 	// add penalty for a terminal mismatch
-	energy, ok := foldContext.energies.terminalMismatches[paired]
-	if hairpinLength > 3 && ok {
-		enthalpyHDifference, entropySDifference := energy.enthalpyH, energy.entropyS
-		dG += deltaG(enthalpyHDifference, entropySDifference, foldContext.temp)
+	paired := foldContext.pairCode(start, start+1, end, end-1)
+	if hairpinLength > 3 && foldContext.tables.terminalMismatches.known[paired] {
+		dG += foldContext.tables.terminalMismatches.deltaG[paired]
 	}
 
 	// add penalty if length 3 and AT closing, formula 8 from SantaLucia, 2004
@@ -775,29 +830,29 @@ func jacobsonStockmayer(queryLen, knownLen int, dGx, temp float64) float64 {
 //
 // Returns string representation of the pair
 func pair(s string, start, rightOfStart, end, leftOfEnd int) string {
-	seqRunes := []rune(s)
-	ret := []rune{'.', '.', '/', '.', '.'}
+	ret := []byte{'.', '.', '/', '.', '.'}
 	if start >= 0 {
-		ret[0] = seqRunes[start]
+		ret[0] = s[start]
 	}
 	if rightOfStart >= 0 {
-		ret[1] = seqRunes[rightOfStart]
+		ret[1] = s[rightOfStart]
 	}
 	if end >= 0 {
-		ret[3] = seqRunes[end]
+		ret[3] = s[end]
 	}
 	if leftOfEnd >= 0 {
-		ret[4] = seqRunes[leftOfEnd]
+		ret[4] = s[leftOfEnd]
 	}
 	return string(ret)
 }
 
 // Traceback thru the pairedMinimumFreeEnergyV(start,end) and unpairedMinimumFreeEnergyW(start,end) caches to find the structure
-// For each step, get to the lowest energy unpairedMinimumFreeEnergyW(start,end) within that block
-// Store the structure in unpairedMinimumFreeEnergyW(start,end)
-// Inc start and end
-// If the next structure is viable according to pairedMinimumFreeEnergyV(start,end), store as well
-// Repeat
+// unpairedMinimumFreeEnergyW(start,end) holds the structure it was found
+// from, which keeps its own start and end, so unpaired bases at the ends
+// are skipped by following those. If the structure is split between
+// several branches, each side of the split is traced back on its own,
+// otherwise its ends pair and pairedMinimumFreeEnergyV(start,end) is
+// followed.
 // Args:
 //
 //		start: The leftmost index to start searching in
@@ -806,20 +861,22 @@ func pair(s string, start, rightOfStart, end, leftOfEnd int) string {
 //
 // Returns a list of NucleicAcidStructure in the final secondary structure
 func traceback(start, end int, foldContext context) []nucleicAcidStructure {
-	// move start,end down-left to start coordinates
-	structure := foldContext.unpairedMinimumFreeEnergyW[start][end]
-	if !strings.Contains(structure.description, "HAIRPIN") {
-		for foldContext.unpairedMinimumFreeEnergyW[start+1][end].Equal(structure) {
-			start += 1
-		}
-		for foldContext.unpairedMinimumFreeEnergyW[start][end-1].Equal(structure) {
-			end -= 1
-		}
+	cached := foldContext.unpairedMinimumFreeEnergyW.get(start, end)
+	if cached.kind == exteriorBranches {
+		// the exterior loop adds nothing, so it has no structure of its own
+		left := traceback(int(cached.start), int(cached.first), foldContext)
+		return append(left, traceback(int(cached.first)+1, int(cached.end), foldContext)...)
 	}
+	return tracebackPaired(int(cached.start), int(cached.end), foldContext)
+}
 
+// tracebackPaired is traceback of a subsequence whose ends pair with each
+// other, following pairedMinimumFreeEnergyV(start,end) instead of
+// unpairedMinimumFreeEnergyW(start,end).
+func tracebackPaired(start, end int, foldContext context) []nucleicAcidStructure {
 	NucleicAcidStructures := []nucleicAcidStructure{}
 	for {
-		structure = foldContext.pairedMinimumFreeEnergyV[start][end]
+		structure := expand(foldContext.pairedMinimumFreeEnergyV.get(start, end), foldContext)
 
 		NucleicAcidStructures = append(NucleicAcidStructures, nucleicAcidStructure{energy: structure.energy, description: structure.description, inner: []subsequence{{start: start, end: end}}})
 
@@ -837,19 +894,13 @@ func traceback(start, end int, foldContext context) []nucleicAcidStructure {
 			continue
 		}
 
-		// it's a multibranch
+		// it's a multibranch, each branch of which is closed by a pair
 		summedEnergy := 0.0
 		NucleicAcidStructures = trackbackEnergy(NucleicAcidStructures)
 		branches := []nucleicAcidStructure{}
-		for _, subseq := range structure.inner {
-			rightOfStart, leftOfEnd := subseq.start, subseq.end
-			tb := traceback(rightOfStart, leftOfEnd, foldContext)
-			if len(tb) > 0 && len(tb[0].inner) > 0 {
-				subseq := tb[0].inner[0]
-				subStart, subEnd := subseq.start, subseq.end
-				summedEnergy += foldContext.unpairedMinimumFreeEnergyW[subStart][subEnd].energy
-				branches = append(branches, tb...)
-			}
+		for _, branch := range structure.inner {
+			summedEnergy += foldContext.pairedMinimumFreeEnergyV.get(branch.start, branch.end).energy
+			branches = append(branches, tracebackPaired(branch.start, branch.end, foldContext)...)
 		}
 
 		NucleicAcidStructures[len(NucleicAcidStructures)-1].energy -= summedEnergy
@@ -857,14 +908,78 @@ func traceback(start, end int, foldContext context) []nucleicAcidStructure {
 	}
 }
 
+// expand returns cached as a nucleicAcidStructure, with the description and
+// inner subsequences the caches leave out.
+func expand(cached cachedStructure, foldContext context) nucleicAcidStructure {
+	start, end := int(cached.start), int(cached.end)
+	switch cached.kind {
+	case unfilled:
+		return defaultStructure
+	case hairpinLoop:
+		return nucleicAcidStructure{energy: cached.energy, description: "HAIRPIN:" + pair(foldContext.seq, start, start+1, end, end-1)}
+	case stackLoop, interiorLoop, bulgeLoop, intermolecularLoop:
+		rightOfStart, leftOfEnd := int(cached.first), int(cached.second)
+		description := describeLoop(cached.kind, start, rightOfStart, end, leftOfEnd, foldContext)
+		return nucleicAcidStructure{energy: cached.energy, description: description, inner: []subsequence{{rightOfStart, leftOfEnd}}}
+	case multibranchLoop, intermolecularBranches:
+		var branches []subsequence
+		if cached.kind == multibranchLoop {
+			branches = multibranchBranches(start+1, int(cached.first), foldContext, branches)
+			branches = multibranchBranches(int(cached.first)+1, end-1, foldContext, branches)
+		} else {
+			for _, side := range [][2]int{{start + 1, foldContext.cut - 1}, {foldContext.cut, end - 1}} {
+				// as openLoopSide, sides that are better off unpaired have no branches
+				if side[1] >= side[0] {
+					if sideStructure := foldContext.unpairedMinimumFreeEnergyW.get(side[0], side[1]); sideStructure.Valid() && sideStructure.energy <= 0 {
+						branches = exteriorLoopBranches(side[0], side[1], foldContext, branches)
+					}
+				}
+			}
+		}
+		unpaired := end - start - 1
+		for _, branch := range branches {
+			unpaired -= branch.end - branch.start + 1
+		}
+		return nucleicAcidStructure{energy: cached.energy, description: fmt.Sprintf("BIFURCATION:%dn/%dh", unpaired, len(branches)+1), inner: branches}
+	}
+	return nucleicAcidStructure{energy: cached.energy}
+}
+
+// multibranchBranches appends the pairs closing the branches of the
+// lowest energy multibranchMinimumFreeEnergyWM(start,end) to branches.
+func multibranchBranches(start, end int, foldContext context, branches []subsequence) []subsequence {
+	cached := foldContext.multibranchMinimumFreeEnergyWM.get(start, end)
+	switch cached.kind {
+	case multibranchPair:
+		return append(branches, subsequence{start, end})
+	case multibranchUnpaired:
+		return multibranchBranches(int(cached.first), int(cached.second), foldContext, branches)
+	case multibranchSplit:
+		branches = multibranchBranches(start, int(cached.first), foldContext, branches)
+		return multibranchBranches(int(cached.first)+1, end, foldContext, branches)
+	}
+	return branches
+}
+
+// exteriorLoopBranches appends the pairs closing the branches of the lowest
+// energy unpairedMinimumFreeEnergyW(start,end) to branches.
+func exteriorLoopBranches(start, end int, foldContext context, branches []subsequence) []subsequence {
+	cached := foldContext.unpairedMinimumFreeEnergyW.get(start, end)
+	if cached.kind == exteriorBranches {
+		branches = exteriorLoopBranches(int(cached.start), int(cached.first), foldContext, branches)
+		return exteriorLoopBranches(int(cached.first)+1, int(cached.end), foldContext, branches)
+	}
+	return append(branches, subsequence{int(cached.start), int(cached.end)})
+}
+
 // Return the struct with the lowest free energy that isn't -inf
 // Args:
 //
 //	structures: NucleicAcidStructure being compared
 //
 // Returns the min free energy structure
-func minimumStructure(structures ...nucleicAcidStructure) nucleicAcidStructure {
-	minimumStructure := invalidStructure
+func minimumStructure(structures ...cachedStructure) cachedStructure {
+	minimumStructure := invalidCached
 	for _, structure := range structures {
 		if structure.energy != math.Inf(-1) && structure.energy < minimumStructure.energy {
 			minimumStructure = structure
@@ -1,10 +1,15 @@
 package fold
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"os"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/TimothyStiles/poly/checks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,7 +24,7 @@ func TestFold(t *testing.T) {
 		seqDg := res.MinimumFreeEnergy()
 		require.NoError(t, err)
 
-		assert.InDelta(t, seqDg, foldContext.unpairedMinimumFreeEnergyW[0][len(seq)-1].energy, 1)
+		assert.InDelta(t, seqDg, foldContext.unpairedMinimumFreeEnergyW.get(0, len(seq)-1).energy, 1)
 	})
 	t.Run("FoldDNA", func(t *testing.T) {
 		// unafold's estimates for free energy estimates of DNA oligos
@@ -71,7 +76,7 @@ func TestFold(t *testing.T) {
 		res, err := Zuker(seq, 37.0)
 		require.NoError(t, err)
 
-		assert.Equal(t, "((((((((.((((......))))..((((.......)))).))))))))", res.DotBracket())
+		assert.Equal(t, "(((((((((((((......)))))(((((.......)))))))))))))", res.DotBracket())
 	})
 	t.Run("multibranch", func(t *testing.T) {
 		seq := "GGGAGGTCGTTACATCTGGGTAACACCGGTACTGATCCGGTGACCTCCC" // three branch
@@ -201,3 +206,1153 @@ func TestFold(t *testing.T) {
 		assert.InDelta(t, struc.energy, -4.2, 0.2)
 	})
 }
+
+func TestDetectPseudoknots(t *testing.T) {
+	// an H-type pseudoknot: the loop of the GGGCGC hairpin pairs with GUCCA
+	// downstream of it.
+	seq := "GGGCGCAAAAGUCCAGUGCGCCCAAAUGGACAAA"
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	require.Equal(t, "(((((((.........)))))))...........", result.DotBracket(), "the nested fold should miss the second stem")
+
+	pseudoknots := DetectPseudoknots(result, seq, 37, 4)
+	require.Len(t, pseudoknots, 1)
+	pseudoknot := pseudoknots[0]
+	assert.Equal(t, Pseudoknot{Start: 10, End: 30, Length: 5}, Pseudoknot{Start: pseudoknot.Start, End: pseudoknot.End, Length: pseudoknot.Length})
+	assert.Less(t, pseudoknot.Energy, 0.0)
+	assert.Equal(t, seq[10:15], "GUCCA")
+	assert.Equal(t, seq[26:31], "UGGAC")
+
+	dotBracket := result.DotBracketWithPseudoknots(pseudoknots)
+	assert.Equal(t, "(((((((...[[[[[.)))))))...]]]]]...", dotBracket)
+	assert.True(t, checks.IsValidDotBracketStructure(dotBracket, true))
+	assert.False(t, checks.IsValidDotBracketStructure(dotBracket, false))
+
+	// stems longer than the ones available aren't reported.
+	assert.Empty(t, DetectPseudoknots(result, seq, 37, 6))
+
+	// a sequence that is just a hairpin has nothing to cross.
+	seq = "GGGGAAACCCC"
+	result, err = Zuker(seq, 37)
+	require.NoError(t, err)
+	assert.Empty(t, DetectPseudoknots(result, seq, 37, 2))
+
+	assert.Nil(t, DetectPseudoknots(result, "NOTDNA", 37, 2))
+}
+
+func TestNestedOrApart(t *testing.T) {
+	outer := Pseudoknot{Start: 0, End: 20, Length: 3}
+	assert.True(t, nestedOrApart(outer, Pseudoknot{Start: 5, End: 15, Length: 3}))
+	assert.True(t, nestedOrApart(Pseudoknot{Start: 21, End: 30, Length: 2}, outer))
+	assert.False(t, nestedOrApart(outer, Pseudoknot{Start: 10, End: 25, Length: 2}))
+	assert.False(t, nestedOrApart(outer, Pseudoknot{Start: 2, End: 15, Length: 2}))
+}
+
+func TestDBN(t *testing.T) {
+	// round trip.
+	var file strings.Builder
+	seqs := []string{"GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA", "ATGGATTTAGATAGAT"}
+	for index, seq := range seqs {
+		result, err := Zuker(seq, 37)
+		require.NoError(t, err)
+		require.NoError(t, result.WriteDBN(&file, fmt.Sprintf("seq%d", index), seq))
+	}
+	records, err := ReadDBN(strings.NewReader(file.String()))
+	require.NoError(t, err)
+	require.Len(t, records, len(seqs))
+	for index, record := range records {
+		result, _ := Zuker(seqs[index], 37)
+		assert.Equal(t, fmt.Sprintf("seq%d", index), record.Name)
+		assert.Equal(t, seqs[index], record.Sequence)
+		assert.Len(t, record.Structure, len(seqs[index]))
+		assert.Equal(t, result.DotBracket(), record.Structure)
+		assert.True(t, record.HasEnergy)
+		assert.InDelta(t, result.MinimumFreeEnergy(), record.Energy, 0.005)
+	}
+
+	// RNAfold output, with a record without a header and padded energies.
+	rnafold, err := os.Open("data/rnafold.dbn")
+	require.NoError(t, err)
+	defer rnafold.Close()
+	records, err = ReadDBN(rnafold)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, DBNRecord{Name: "hairpin", Sequence: "GGGGAAACCCC", Structure: "((((...))))", Energy: -4.3, HasEnergy: true}, records[0])
+	assert.Equal(t, "tRNA-Phe", records[1].Name)
+	assert.Equal(t, -21.6, records[1].Energy)
+	assert.Equal(t, "", records[2].Name)
+	assert.Equal(t, 0.0, records[2].Energy)
+
+	// structures without an energy, with pseudoknots.
+	records, err = ReadDBN(strings.NewReader(">pk\nGGGCGCAAAAGUCCAGUGCGCCCAAAUGGACAAA\n(((((((...[[[[[.)))))))...]]]]]...\n"))
+	require.NoError(t, err)
+	assert.False(t, records[0].HasEnergy)
+
+	for name, broken := range map[string]string{
+		"too short":             ">a\nGGGGAAACCCC\n((((..)))) (-4.30)\n",
+		"unbalanced":            ">a\nGGGGAAACCCC\n((((...))). (-4.30)\n",
+		"missing structure":     ">a\nGGGGAAACCCC\n>b\nGGGGAAACCCC\n((((...))))\n",
+		"truncated":             ">a\nGGGGAAACCCC\n",
+		"energy without parens": ">a\nGGGGAAACCCC\n((((...)))) -4.30\n",
+		"bad energy":            ">a\nGGGGAAACCCC\n((((...)))) (four)\n",
+	} {
+		_, err = ReadDBN(strings.NewReader(broken))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseDotBracket(t *testing.T) {
+	// a nested stem followed by a second hairpin.
+	pairs, err := ParseDotBracket("((.(..)))..((...))")
+	require.NoError(t, err)
+	assert.Equal(t, []BasePair{{0, 8}, {1, 7}, {3, 6}, {11, 17}, {12, 16}}, pairs)
+
+	// the pairs of a fold are the ones of its dot-bracket.
+	result, err := Zuker("GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA", 37)
+	require.NoError(t, err)
+	pairs, err = ParseDotBracket(result.DotBracket())
+	require.NoError(t, err)
+	assert.Equal(t, strings.Count(result.DotBracket(), "("), len(pairs))
+	for _, pair := range pairs {
+		assert.Equal(t, byte('('), result.DotBracket()[pair.Start])
+		assert.Equal(t, byte(')'), result.DotBracket()[pair.End])
+	}
+
+	// pseudoknot pairs cross the others.
+	pairs, err = ParseDotBracket("((..[[..))..]]")
+	require.NoError(t, err)
+	assert.Equal(t, []BasePair{{0, 9}, {1, 8}, {4, 13}, {5, 12}}, pairs)
+
+	pairs, err = ParseDotBracket("....")
+	require.NoError(t, err)
+	assert.Empty(t, pairs)
+
+	for structure, index := range map[string]string{
+		"((..)))":   "index 6",
+		"(((..))":   "index 0",
+		"..((..)))": "index 8",
+		"((..]]":    "index 4",
+		"((.x.))":   "index 3",
+	} {
+		_, err = ParseDotBracket(structure)
+		require.Error(t, err, structure)
+		assert.Contains(t, err.Error(), index, structure)
+	}
+}
+
+func TestPartitionFunction(t *testing.T) {
+	// a stable hairpin spends nearly all its time folded as Zuker folds it.
+	seq := "GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA"
+	mfe, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	result, err := PartitionFunction(seq, 37)
+	require.NoError(t, err)
+
+	mfePairs, err := ParseDotBracket(mfe.DotBracket())
+	require.NoError(t, err)
+	require.NotEmpty(t, mfePairs)
+	for _, pair := range mfePairs {
+		assert.Greater(t, result.PairProbability(pair.Start, pair.End), 0.5, "pair %v", pair)
+		assert.Equal(t, result.PairProbability(pair.Start, pair.End), result.PairProbability(pair.End, pair.Start))
+	}
+	assert.Greater(t, result.PositionalUnpairedProbability(len(seq)-1), 0.5)
+
+	// every base is either unpaired or paired with exactly one other base.
+	for i := range seq {
+		total := result.PositionalUnpairedProbability(i)
+		for j := range seq {
+			probability := result.PairProbability(i, j)
+			assert.GreaterOrEqual(t, probability, 0.0)
+			total += probability
+		}
+		assert.InDelta(t, 1, total, 1e-9, "base %d", i)
+	}
+
+	// the ensemble is at least as stable as its best structure.
+	assert.LessOrEqual(t, result.EnsembleFreeEnergy(), mfe.MinimumFreeEnergy()+1e-9)
+	assert.Zero(t, result.PairProbability(-1, 3))
+	assert.Zero(t, result.PositionalUnpairedProbability(len(seq)))
+
+	// melting the hairpin unpairs it.
+	hot, err := PartitionFunction(seq, 95)
+	require.NoError(t, err)
+	assert.Less(t, hot.PairProbability(mfePairs[0].Start, mfePairs[0].End), result.PairProbability(mfePairs[0].Start, mfePairs[0].End))
+
+	// too short to pair.
+	short, err := PartitionFunction("ACGU", 37)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, short.PositionalUnpairedProbability(2))
+	assert.InDelta(t, 0, short.EnsembleFreeEnergy(), 1e-9)
+	for _, seq := range []string{"A", "GC"} {
+		single, err := PartitionFunction(seq, 37)
+		require.NoError(t, err, seq)
+		assert.Equal(t, 1.0, single.PositionalUnpairedProbability(0), seq)
+		assert.InDelta(t, 0, single.EnsembleFreeEnergy(), 1e-9, seq)
+	}
+
+	_, err = PartitionFunction("", 37)
+	assert.Error(t, err)
+	_, err = PartitionFunction("NOTDNA", 37)
+	assert.Error(t, err)
+	// mixed DNA and RNA fails before folding, with the position of the base.
+	_, err = Zuker("GGGGTTTCCCCU", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "uracil 'U' at position 11")
+}
+
+func TestScanWindows(t *testing.T) {
+	// a strong hairpin between two flanks that barely fold.
+	flank5 := "ACAUACAAUCAACUAAUCCAAACAUUCACAAUACAACUAA"
+	hairpin := "GGCGCGGCCAGCGCCGCGGAAACGCGGCGCUGGCCGCGCC"
+	flank3 := "UCAAACACAUUCAAUACCAAAUCACAAUCAAACUACAUCA"
+	seq := flank5 + hairpin + flank3
+	windows := ScanWindows(seq, 40, 20, 37, 2, WithShuffles(20), WithSeed(1))
+	require.Len(t, windows, 5)
+	for index, window := range windows {
+		require.NoError(t, window.Error)
+		assert.Equal(t, index*20, window.Start)
+		assert.Equal(t, index*20+40, window.End)
+		assert.InDelta(t, window.MinimumFreeEnergy/40, window.NormalizedEnergy, 1e-9)
+	}
+	assert.Less(t, windows[2].ZScore, -2.0)
+	assert.Greater(t, windows[0].ZScore, -2.0)
+	assert.Greater(t, windows[4].ZScore, -2.0)
+	assert.Equal(t, strings.Repeat("(", 18)+"...."+strings.Repeat(")", 18), windows[2].DotBracket)
+
+	// the same seed gives the same scan, however many workers run it.
+	assert.Equal(t, windows, ScanWindows(seq, 40, 20, 37, 1, WithShuffles(20), WithSeed(1)))
+
+	// the last window is moved back to end at the end of the sequence.
+	tail := ScanWindows(seq[:110], 40, 20, 37, 1, WithShuffles(0))
+	require.Len(t, tail, 5)
+	assert.Equal(t, 70, tail[4].Start)
+	assert.Equal(t, 110, tail[4].End)
+	assert.Zero(t, tail[4].ZScore)
+
+	var bedGraph strings.Builder
+	require.NoError(t, WriteBedGraph(&bedGraph, "chr1", tail, func(window WindowResult) float64 { return window.NormalizedEnergy }))
+	lines := strings.Split(strings.TrimSpace(bedGraph.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.True(t, strings.HasPrefix(lines[0], "chr1\t10\t30\t"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[4], "chr1\t90\t100\t"), lines[4])
+
+	bad := ScanWindows("GGGGAAACCCCNNNN", 8, 4, 37, 1)
+	assert.Error(t, bad[len(bad)-1].Error)
+
+	// there are no windows to fold in an empty or too short sequence.
+	assert.Empty(t, ScanWindows("", 40, 20, 37, 1))
+	assert.Empty(t, ScanWindows("", 0, 20, 37, 1))
+	assert.Empty(t, ScanWindows(hairpin, 41, 20, 37, 1))
+	whole := ScanWindows(hairpin, 0, 20, 37, 1, WithShuffles(0))
+	require.Len(t, whole, 1)
+	assert.Equal(t, windows[2].DotBracket, whole[0].DotBracket)
+}
+
+func TestFoldWindows(t *testing.T) {
+	flank5 := "ACAUACAAUCAACUAAUCCAAACAUUCACAAUACAACUAA"
+	hairpin := "GGCGCGGCCAGCGCCGCGGAAACGCGGCGCUGGCCGCGCC"
+	flank3 := "UCAAACACAUUCAAUACCAAAUCACAAUCAAACUACAUCA"
+	seq := strings.Repeat(flank5+hairpin+flank3, 3)
+	windows, err := FoldWindows(strings.ToLower(seq), 37, 50, 15)
+	require.NoError(t, err)
+	require.Len(t, windows, 22)
+	for index, window := range windows {
+		if index < len(windows)-1 {
+			assert.Equal(t, index*15, window.Start)
+		}
+		assert.Equal(t, window.Start+50, window.End)
+		// every window folds as it would on its own.
+		result, err := Zuker(seq[window.Start:window.End], 37)
+		require.NoError(t, err)
+		assert.Equal(t, result.DotBracket(), window.DotBracket, "window %d", window.Start)
+		assert.InDelta(t, windowEnergy(result), window.MinimumFreeEnergy, 1e-9, "window %d", window.Start)
+		assert.InDelta(t, window.MinimumFreeEnergy/50, window.NormalizedEnergy, 1e-9)
+	}
+	assert.Equal(t, 310, windows[21].Start)
+	assert.Less(t, windows[3].MinimumFreeEnergy, windows[0].MinimumFreeEnergy)
+
+	// like ScanWindows, a sequence shorter than the window has no windows
+	short, err := FoldWindows(hairpin, 37, 100, 10)
+	require.NoError(t, err)
+	assert.Empty(t, short)
+	assert.Empty(t, ScanWindows(hairpin, 100, 10, 37, 1))
+	whole, err := FoldWindows(hairpin, 37, len(hairpin), 10)
+	require.NoError(t, err)
+	require.Len(t, whole, 1)
+	assert.Equal(t, strings.Repeat("(", 18)+"...."+strings.Repeat(")", 18), whole[0].DotBracket)
+
+	_, err = FoldWindows("GGGGAAACCCCNNNN", 37, 8, 4)
+	assert.Error(t, err)
+	_, err = FoldWindows(seq, 37, 50, 0)
+	assert.Error(t, err)
+	_, err = FoldWindows(seq, 310, 50, 10)
+	assert.Error(t, err)
+}
+
+func TestSuboptimal(t *testing.T) {
+	seq := "GGGGAAAACCCCAAAAGGGGAAAACCCC"
+	mfe, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	results, err := Suboptimal(seq, 37, 3)
+	require.NoError(t, err)
+	require.Greater(t, len(results), 1)
+
+	// the first structure is the minimum free energy structure.
+	assert.Equal(t, mfe.DotBracket(), results[0].DotBracket())
+	assert.InDelta(t, mfe.MinimumFreeEnergy(), results[0].MinimumFreeEnergy(), 1e-9)
+
+	structures := make(map[string]bool)
+	for index, result := range results {
+		assert.False(t, structures[result.DotBracket()], "%s is returned twice", result.DotBracket())
+		structures[result.DotBracket()] = true
+		assert.LessOrEqual(t, result.MinimumFreeEnergy(), mfe.MinimumFreeEnergy()+3+1e-9)
+		if index > 0 {
+			assert.LessOrEqual(t, results[index-1].MinimumFreeEnergy(), result.MinimumFreeEnergy())
+		}
+		_, err := ParseDotBracket(result.DotBracket())
+		assert.NoError(t, err)
+	}
+	// the second hairpin folded inside the first.
+	assert.True(t, structures["((((....((((....))))....))))"])
+
+	// a wider range includes every structure of a narrower one.
+	wider, err := Suboptimal(seq, 37, 4)
+	require.NoError(t, err)
+	assert.Greater(t, len(wider), len(results))
+
+	capped, err := Suboptimal(seq, 37, 4, WithMaxStructures(3))
+	require.NoError(t, err)
+	assert.Equal(t, wider[:3], capped)
+
+	only, err := Suboptimal(seq, 37, 0)
+	require.NoError(t, err)
+	require.Len(t, only, 1)
+	assert.Equal(t, mfe.DotBracket(), only[0].DotBracket())
+
+	unfoldable, err := Suboptimal("ACGT", 37, 5)
+	require.NoError(t, err)
+	assert.Empty(t, unfoldable)
+
+	_, err = Suboptimal(seq, 37, -1)
+	assert.Error(t, err)
+	_, err = Suboptimal(seq, 37, 1, WithMaxStructures(0))
+	assert.Error(t, err)
+	_, err = Suboptimal("NOTDNA", 37, 1)
+	assert.Error(t, err)
+}
+
+func TestSuboptimalEnergies(t *testing.T) {
+	// every structure is reported with the energy Evaluate gives it, so the
+	// energy range and the order are those of the structures returned.
+	for _, seq := range []string{
+		"GGGGAAAACCCCAAAAGGGGAAAACCCC",
+		"GGGGAAAACCCCAGCGCAAAAGCGCU",
+		"AUGGCUAGCUAGGCUAGCUAGCCUAGCUAGCAUGCAUGCGCGAAAGCGC",
+		"GGGAGGTCGTTACATCTGGGTAACACCGGTACTGATCCGGTGACCTCCC",
+		"GGGAGGGGAAAACCCCAAGGGGAAAACCCCACCCA",
+	} {
+		results, err := Suboptimal(seq, 37, 3, WithMaxStructures(200))
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		for _, result := range results {
+			energy, err := Evaluate(seq, result.DotBracket(), 37)
+			require.NoError(t, err, result.DotBracket())
+			assert.InDelta(t, energy, result.MinimumFreeEnergy(), 1e-9, "%s %s", seq, result.DotBracket())
+		}
+	}
+}
+
+func TestMeltingTemperature(t *testing.T) {
+	seq := "GGGGAAAACCCC"
+	tm, err := MeltingTemperature(seq)
+	require.NoError(t, err)
+	assert.Greater(t, tm, 0.0)
+	assert.Less(t, tm, 100.0)
+
+	// the structure is stable just below tm and not just above it.
+	below, err := Zuker(seq, tm-0.1)
+	require.NoError(t, err)
+	assert.Less(t, below.MinimumFreeEnergy(), 0.0)
+	above, err := Zuker(seq, tm+0.1)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, above.MinimumFreeEnergy(), 0.0)
+
+	// a longer stem melts at a higher temperature.
+	longer, err := MeltingTemperature("GCGGGGAAAACCCCGC")
+	require.NoError(t, err)
+	assert.Greater(t, longer, tm)
+
+	_, err = MeltingTemperature("AAAAAAAAAAAA")
+	assert.Error(t, err)
+	_, err = MeltingTemperature("GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA")
+	assert.Error(t, err)
+	_, err = MeltingTemperature("NOTDNA")
+	assert.Error(t, err)
+}
+
+func TestMeltingCurve(t *testing.T) {
+	seq := "GCGGGGAAAACCCCGC"
+	curve, err := MeltingCurve(seq, 0, 100, 5)
+	require.NoError(t, err)
+	require.Len(t, curve, 21)
+	assert.Equal(t, 100.0, curve[20].Temperature)
+
+	// the stem-loop weakens as it heats up, until it's unfolded
+	assert.Less(t, curve[0].MinimumFreeEnergy, 0.0)
+	assert.Equal(t, 1.0-4.0/16, curve[0].PairedFraction)
+	for index := 1; index < len(curve); index++ {
+		assert.GreaterOrEqual(t, curve[index].MinimumFreeEnergy, curve[index-1].MinimumFreeEnergy, "%.0f C", curve[index].Temperature)
+		assert.LessOrEqual(t, curve[index].PairedFraction, curve[index-1].PairedFraction, "%.0f C", curve[index].Temperature)
+	}
+	assert.Equal(t, MeltPoint{Temperature: 100}, curve[20])
+
+	// reusing the caches gives exactly what folding from scratch does
+	for _, point := range curve {
+		result, err := Zuker(seq, point.Temperature)
+		require.NoError(t, err)
+		if energy := result.MinimumFreeEnergy(); energy < 0 {
+			assert.Equal(t, energy, point.MinimumFreeEnergy, "%.0f C", point.Temperature)
+		}
+	}
+
+	_, err = MeltingCurve(seq, 50, 40, 1)
+	assert.Error(t, err)
+	_, err = MeltingCurve(seq, 40, 50, 0)
+	assert.Error(t, err)
+	_, err = MeltingCurve("", 40, 50, 1)
+	assert.Error(t, err)
+
+	// sequences too short to pair never fold
+	for _, short := range []string{"A", "GC", "GAC"} {
+		curve, err := MeltingCurve(short, 20, 80, 10)
+		require.NoError(t, err, short)
+		require.Len(t, curve, 7, short)
+		for _, point := range curve {
+			assert.Equal(t, MeltPoint{Temperature: point.Temperature}, point, short)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	// structures score as Zuker scores them, with a multibranch loop in the
+	// third and hairpins side by side in the exterior loop of the others.
+	for _, seq := range []string{"GGGGAAAACCCCAAAAGGGGAAAACCCC", "ACCCCCUCCUUCCUUGGAUCAAGGGGCUCAA", "GGCGAGCGCGAAAGCGCAAGCGCGAAAGCGCAACGCC", "CGCGCGAAAGCGCGTTTTCCCCGAAAGGGGA"} {
+		mfe, err := Zuker(seq, 37)
+		require.NoError(t, err)
+		structure := mfe.DotBracket()
+		structure += strings.Repeat(".", len(seq)-len(structure))
+		energy, err := Evaluate(seq, structure, 37)
+		require.NoError(t, err)
+		assert.InDelta(t, mfe.MinimumFreeEnergy(), energy, 1e-9, seq)
+
+		// any other structure is no more stable.
+		other, err := Evaluate(seq, "."+structure[:len(structure)-1], 37)
+		if err == nil {
+			assert.Greater(t, other, energy)
+		}
+	}
+
+	seq := "GGGGAAAACCCCAAAAGGGGAAAACCCC"
+	unfolded, err := Evaluate(seq, strings.Repeat(".", len(seq)), 37)
+	require.NoError(t, err)
+	assert.Zero(t, unfolded)
+
+	// two hairpins in a multibranch loop.
+	branched, err := Evaluate("GGGAGGGGAAAACCCCAAGGGGAAAACCCCACCCA", "(((.((((....))))..((((....)))).))).", 37)
+	require.NoError(t, err)
+	assert.Less(t, branched, 0.0)
+
+	_, err = Evaluate(seq, "((((....", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is 8 long")
+	_, err = Evaluate(seq, "((((....((((....))))....))))"[1:]+".", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "index 26")
+	_, err = Evaluate(seq, "(((((...((((....))))....)))))"[:28], 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "index 0")
+	_, err = Evaluate(seq, "((((....[[[[....))))....]]]]", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pseudoknots")
+	_, err = Evaluate(seq, "(...)..........................."[:28], 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't pair")
+	// the C and G beside the pairs of the interior loop would stack on them.
+	_, err = Evaluate("GGGAAAUCCCGCGCAAAGCGC", "(((....)))(.((...)).)", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interior loop between the pairs of indexes 10 and 20 and of 12 and 18")
+	_, err = Evaluate("GGGGAACCCC", "((((..))))", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hairpin")
+	_, err = Evaluate("NOTDNA", "......", 37)
+	assert.Error(t, err)
+}
+
+func TestEvaluateNeverBelowZuker(t *testing.T) {
+	for _, test := range []struct {
+		seq        string
+		structures []string
+	}{
+		{"GGGGAAAACCCCAGCGCAAAAGCGCU", []string{"((((....)))).((((....)))).", ".(((....)))..((((....))))."}},
+		{"GGGGAAAACCCCAAAAGGGGAAAACCCC", []string{"((((....((((....))))....))))"}},
+		{"GGCGAGCGCGAAAGCGCAAGCGCGAAAGCGCAACGCC", nil},
+		{"GGGAGGTCGTTACATCTGGGTAACACCGGTACTGATCCGGTGACCTCCC", []string{"((((((((.((((......))))..((((.......)))).))))))))"}},
+		{"AUGGCUAGCUAGGCUAGCUAGCCUAGCUAGCAUGCAUGCGCGAAAGCGC", nil},
+		{"GCGGAUUUAGCUCAGUUGGGAGAGCGCCAGACUGAAGAUCUGGAGGUCCUGUGUUCGAUCCACAGAAUUCGCACCA", nil},
+	} {
+		mfe, err := Zuker(test.seq, 37)
+		require.NoError(t, err)
+		// the given structures and those just above the minimum are all
+		// structures Zuker could fold.
+		structures := test.structures
+		suboptimal, err := Suboptimal(test.seq, 37, 2, WithMaxStructures(100))
+		require.NoError(t, err)
+		for _, result := range suboptimal {
+			structures = append(structures, result.DotBracket())
+		}
+		for _, structure := range structures {
+			energy, err := Evaluate(test.seq, structure, 37)
+			require.NoError(t, err, structure)
+			assert.GreaterOrEqual(t, energy, mfe.MinimumFreeEnergy()-1e-9, "%s %s", test.seq, structure)
+		}
+
+		// leaving a pair out of the minimum free energy structure can leave
+		// a loop Zuker never folds, but the rest are no more stable either.
+		for _, pair := range mfe.Pairs() {
+			structure := []byte(mfe.DotBracket())
+			structure[pair[0]], structure[pair[1]] = '.', '.'
+			if energy, err := Evaluate(test.seq, string(structure), 37); err == nil {
+				assert.GreaterOrEqual(t, energy, mfe.MinimumFreeEnergy()-1e-9, "%s %s", test.seq, structure)
+			}
+		}
+	}
+}
+
+func TestPartitionFunctionLong(t *testing.T) {
+	// a long, very stable sequence overflows float64 without scaling.
+	seq := strings.Repeat("GGGGCGAAAGCCCC", 22)
+	ensemble, err := PartitionFunction(seq, 37)
+	require.NoError(t, err)
+	energy := ensemble.EnsembleFreeEnergy()
+	assert.False(t, math.IsInf(energy, 0) || math.IsNaN(energy))
+	assert.Less(t, energy, -100.0)
+	for i := range seq {
+		total := ensemble.PositionalUnpairedProbability(i)
+		for j := range seq {
+			total += ensemble.PairProbability(i, j)
+		}
+		assert.InDelta(t, 1, total, 1e-6, "base %d", i)
+	}
+}
+
+func TestFoldWithOptions(t *testing.T) {
+	// a hairpin with its 5' arm at the start, and a tail that doesn't fold.
+	seq := "GCGCGCGAAAACGCGCGCAAAAAAAA"
+	result, err := FoldWithOptions(seq, 37, FoldOptions{ForceSingleStrandedPrefix: 4})
+	require.NoError(t, err)
+	unconstrained, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, unconstrained.DotBracket(), result.Unconstrained.DotBracket())
+	assert.Equal(t, [2]int{0, 17}, unconstrained.Pairs()[0])
+	for _, pair := range result.Pairs() {
+		assert.GreaterOrEqual(t, pair[0], 4, "pair %v is in the prefix", pair)
+	}
+	assert.True(t, strings.HasPrefix(result.DotBracket(), "...."))
+	assert.True(t, result.ChangedMinimumFreeEnergy())
+	assert.Greater(t, result.EnergyPenalty(), 0.0)
+	assert.InDelta(t, result.MinimumFreeEnergy()-unconstrained.MinimumFreeEnergy(), result.EnergyPenalty(), 1e-9)
+
+	// the tail is single stranded anyway.
+	result, err = FoldWithOptions(seq, 37, FoldOptions{ForceSingleStrandedSuffix: 8})
+	require.NoError(t, err)
+	assert.Equal(t, unconstrained.DotBracket(), result.DotBracket())
+	assert.False(t, result.ChangedMinimumFreeEnergy())
+	assert.Zero(t, result.EnergyPenalty())
+
+	// nothing left to fold is no structure, not an error.
+	result, err = FoldWithOptions(seq, 37, FoldOptions{ForceSingleStrandedPrefix: 8, ForceSingleStrandedSuffix: 10})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(".", len(seq)), result.DotBracket())
+	assert.InDelta(t, -unconstrained.MinimumFreeEnergy(), result.EnergyPenalty(), 1e-9)
+
+	circular, err := FoldWithOptions(seq, 37, FoldOptions{Circular: true})
+	require.NoError(t, err)
+	expected, err := FoldCircular(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, expected.DotBracket(), circular.DotBracket())
+	assert.False(t, circular.ChangedMinimumFreeEnergy())
+
+	for _, options := range []FoldOptions{
+		{ForceSingleStrandedPrefix: -1},
+		{ForceSingleStrandedPrefix: 20, ForceSingleStrandedSuffix: 6},
+		{ForceSingleStrandedPrefix: 2, Circular: true},
+	} {
+		_, err = FoldWithOptions(seq, 37, options)
+		assert.Error(t, err, "%+v", options)
+	}
+}
+
+func TestFoldConstrained(t *testing.T) {
+	seq := "GGGGAAAACCCCAAAAGGGGAAAACCCC"
+	mfe, err := Zuker(seq, 37)
+	require.NoError(t, err)
+
+	// no constraints folds like Zuker.
+	result, err := FoldConstrained(seq, 37, Constraints{})
+	require.NoError(t, err)
+	assert.Equal(t, mfe.DotBracket(), result.DotBracket())
+	assert.Equal(t, mfe.MinimumFreeEnergy(), result.MinimumFreeEnergy())
+
+	// keeping the first stem single stranded leaves the last hairpin.
+	result, err = FoldConstrained(seq, 37, Constraints{Unpaired: []int{0, 1, 2, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, "................((((....))))", result.DotBracket())
+	assert.Greater(t, result.MinimumFreeEnergy(), mfe.MinimumFreeEnergy())
+
+	// forcing the first hairpin.
+	result, err = FoldConstrained(seq, 37, Constraints{Pairs: []BasePair{{Start: 0, End: 11}}})
+	require.NoError(t, err)
+	assert.Equal(t, "((((....))))....((((....))))", result.DotBracket())
+
+	// forced pairs in two separate hairpins.
+	result, err = FoldConstrained(seq, 37, Constraints{Pairs: []BasePair{{Start: 2, End: 9}, {Start: 25, End: 18}}})
+	require.NoError(t, err)
+	pairs, err := ParseDotBracket(result.DotBracket())
+	require.NoError(t, err)
+	assert.Contains(t, pairs, BasePair{Start: 2, End: 9})
+	assert.Contains(t, pairs, BasePair{Start: 18, End: 25})
+
+	// forced pairs closing hairpins side by side in the exterior loop, and
+	// forcing one of them keeps the other.
+	adjacent := "GGGGAAAACCCCAGCGCAAAAGCGCU"
+	adjacentMFE, err := Zuker(adjacent, 37)
+	require.NoError(t, err)
+	for _, forced := range [][]BasePair{{{Start: 0, End: 11}, {Start: 13, End: 24}}, {{Start: 0, End: 11}}, {{Start: 13, End: 24}}} {
+		result, err = FoldConstrained(adjacent, 37, Constraints{Pairs: forced})
+		require.NoError(t, err, "%+v", forced)
+		assert.Equal(t, "((((....))))(((((....)))))", result.DotBracket())
+		assert.Equal(t, adjacentMFE.MinimumFreeEnergy(), result.MinimumFreeEnergy())
+	}
+
+	// forced pairs closing the branches of a multibranch loop.
+	branched := "GGGAGGGGAAAACCCCAAGGGGAAAACCCCACCCA"
+	result, err = FoldConstrained(branched, 37, Constraints{Pairs: []BasePair{{Start: 4, End: 15}, {Start: 18, End: 29}}})
+	require.NoError(t, err)
+	assert.Equal(t, "(((.((((....))))..((((....)))).))).", result.DotBracket())
+	energy, err := Evaluate(branched, result.DotBracket(), 37)
+	require.NoError(t, err)
+	assert.InDelta(t, energy, result.MinimumFreeEnergy(), 1e-9)
+
+	for _, test := range []struct {
+		constraints Constraints
+		err         string
+	}{
+		{Constraints{Pairs: []BasePair{{Start: 0, End: 11}, {Start: 8, End: 19}}}, "forced pairs 0-11 and 8-19 cross"},
+		{Constraints{Pairs: []BasePair{{Start: 0, End: 3}}}, "too close"},
+		{Constraints{Pairs: []BasePair{{Start: 0, End: 5}}}, "aren't complementary"},
+		{Constraints{Pairs: []BasePair{{Start: 0, End: 11}, {Start: 0, End: 27}}}, "base 0 is forced to pair with both 11 and 27"},
+		{Constraints{Unpaired: []int{0}, Pairs: []BasePair{{Start: 0, End: 11}}}, "base 0 is both forced unpaired and forced to pair"},
+		{Constraints{Unpaired: []int{28}}, "outside the sequence"},
+		{Constraints{Pairs: []BasePair{{Start: 0, End: 28}}}, "outside the sequence"},
+		// the only loop between the forced pairs has bases that could pair
+		// with each other, which Zuker never leaves unpaired.
+		{Constraints{Unpaired: []int{1}, Pairs: []BasePair{{Start: 0, End: 11}, {Start: 2, End: 9}}}, "no structure forms every forced pair"},
+	} {
+		_, err := FoldConstrained(seq, 37, test.constraints)
+		if assert.Error(t, err, "%+v", test.constraints) {
+			assert.Contains(t, err.Error(), test.err, "%+v", test.constraints)
+		}
+	}
+}
+
+func TestZukerExteriorBranches(t *testing.T) {
+	// two hairpins side by side, with no pair enclosing both.
+	for _, test := range []struct {
+		seq, dotBracket string
+		energy          float64
+	}{
+		{"ACGCGTTTTACGCGTAAAAAGGCCTTTTGGCCTT", "((((((...))))))...((((((....))))))", -12.45},
+		{"GGGGAAAACCCCAGCGCAAAAGCGCU", "((((....))))(((((....)))))", -14.58},
+	} {
+		result, err := Zuker(test.seq, 37)
+		require.NoError(t, err)
+		assert.Equal(t, test.dotBracket, result.DotBracket())
+		assert.InDelta(t, test.energy, result.MinimumFreeEnergy(), 0.01)
+	}
+
+	// the ends of the exterior loop don't pair, so tracing back from them
+	// alone found no structure, and an infinite energy.
+	seq := "CTATCAAGGCTGCAACCGCCGTGTAAGTCTGGACATAGTTCCTAACTGAACGCTGCCACCCCCGATCTGTGAAGACGCAGCATCTAAGGATGGAGCATACTAAGACCTCTACCAAGAACTATGGGAGGCTAATCTATGTCCCG"
+	result, err := Zuker(seq, 25)
+	require.NoError(t, err)
+	assert.Equal(t, "((..((.(((.......))).))..))...(((((((((((...((.((.((..........)).)).))))).....(((.(((.((.(((...))).)).)))...((.(((.......))).)))))...))))))))..", result.DotBracket())
+	assert.InDelta(t, -26.08, result.MinimumFreeEnergy(), 0.01)
+}
+
+func TestDotBracketLength(t *testing.T) {
+	// a hairpin followed by a 3' tail that is entirely unpaired.
+	seq := "GGGGAAAACCCC" + strings.Repeat("A", 20)
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, "((((....))))"+strings.Repeat(".", 20), result.DotBracket())
+
+	// a sequence with no structure at all.
+	result, err = Zuker("AAAAAAAAAA", 37)
+	require.NoError(t, err)
+	assert.Equal(t, "..........", result.DotBracket())
+}
+
+func TestPairs(t *testing.T) {
+	// a stem with a bulge, and two stems side by side.
+	for _, seq := range []string{"GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA", "ACGCGTTTTACGCGTAAAAAGGCCTTTTGGCCTT"} {
+		result, err := Zuker(seq, 37)
+		require.NoError(t, err)
+		expected, err := ParseDotBracket(result.DotBracket())
+		require.NoError(t, err)
+		pairs := result.Pairs()
+		require.Len(t, pairs, len(expected))
+		paired := make(map[int]bool)
+		for index, pair := range pairs {
+			assert.Equal(t, [2]int{expected[index].Start, expected[index].End}, pair)
+			assert.False(t, paired[pair[0]] || paired[pair[1]], "pairs %v overlap", pairs)
+			paired[pair[0]], paired[pair[1]] = true, true
+		}
+	}
+
+	result, err := Zuker("AAAAAAAAAA", 37)
+	require.NoError(t, err)
+	assert.Empty(t, result.Pairs())
+}
+
+func TestCT(t *testing.T) {
+	seq := "GGGGAAACCCCAA"
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	require.Equal(t, "((((...))))..", result.DotBracket())
+
+	lines := strings.Split(strings.TrimSuffix(result.CT(seq), "\n"), "\n")
+	require.Len(t, lines, len(seq)+1)
+	assert.Equal(t, fmt.Sprintf("%5d  ENERGY = %.2f", len(seq), result.MinimumFreeEnergy()), lines[0])
+	assert.Equal(t, []string{"1", "G", "0", "2", "11", "1"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"5", "A", "4", "6", "0", "5"}, strings.Fields(lines[5]))
+	assert.Equal(t, []string{"11", "C", "10", "12", "1", "11"}, strings.Fields(lines[11]))
+	// the trailing unpaired bases are written, and the last has no next base.
+	assert.Equal(t, []string{"13", "A", "12", "0", "0", "13"}, strings.Fields(lines[13]))
+
+	// a sequence that doesn't fold is all unpaired.
+	result, err = Zuker("AAAA", 37)
+	require.NoError(t, err)
+	assert.Equal(t, "    4  ENERGY = 0.00\n    1 A     0     2     0     1\n    2 A     1     3     0     2\n    3 A     2     4     0     3\n    4 A     3     0     0     4\n", result.CT("AAAA"))
+}
+
+func TestBPSEQ(t *testing.T) {
+	// round trip through the pairs of the dot-bracket.
+	seq := "GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA"
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(result.BPSEQ(seq), "\n"), "\n")
+	require.Len(t, lines, len(seq))
+	structure := []byte(strings.Repeat(".", len(seq)))
+	for index, line := range lines {
+		var position, partner int
+		var base string
+		_, err = fmt.Sscanf(line, "%d %s %d", &position, &base, &partner)
+		require.NoError(t, err)
+		assert.Equal(t, index+1, position)
+		assert.Equal(t, seq[index:index+1], base)
+		switch {
+		case partner == 0:
+		case partner > position:
+			structure[index] = '('
+		default:
+			structure[index] = ')'
+			assert.True(t, strings.HasSuffix(lines[partner-1], fmt.Sprintf(" %d", position)), "pairs should be symmetric")
+		}
+	}
+	assert.Equal(t, result.DotBracket(), string(structure))
+
+	result, err = Zuker("AAAA", 37)
+	require.NoError(t, err)
+	assert.Equal(t, "1 A 0\n2 A 0\n3 A 0\n4 A 0\n", result.BPSEQ("AAAA"))
+}
+
+func TestWriteCTAndBPSeq(t *testing.T) {
+	seq := "GGGGAAACCCCAA"
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	var ct, bpseq strings.Builder
+	require.NoError(t, result.WriteCT(seq, &ct))
+	require.NoError(t, result.WriteBPSeq(seq, &bpseq))
+	assert.Equal(t, result.CT(seq), ct.String())
+	assert.Equal(t, result.BPSEQ(seq), bpseq.String())
+}
+
+func TestParseCT(t *testing.T) {
+	// round trip through CT, then score the structure read back in.
+	seq := "GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA"
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	parsedSeq, structure, err := ParseCT(strings.NewReader(result.CT(seq)))
+	require.NoError(t, err)
+	assert.Equal(t, seq, parsedSeq)
+	assert.Equal(t, result.DotBracket(), structure)
+	energy, err := Evaluate(parsedSeq, structure, 37)
+	require.NoError(t, err)
+	assert.InDelta(t, result.MinimumFreeEnergy(), energy, 0.01)
+
+	// pairing columns are 1 indexed, and only the first of several
+	// structures is read.
+	ct := "5 ENERGY = -1.0 first\n" +
+		"1 G 0 2 5 1\n2 A 1 3 0 2\n3 A 2 4 0 3\n4 A 3 5 0 4\n5 C 4 0 1 5\n" +
+		"5 ENERGY = 0.0 second\n" +
+		"1 G 0 2 0 1\n2 A 1 3 0 2\n3 A 2 4 0 3\n4 A 3 5 0 4\n5 C 4 0 0 5\n"
+	parsedSeq, structure, err = ParseCT(strings.NewReader(ct))
+	require.NoError(t, err)
+	assert.Equal(t, "GAAAC", parsedSeq)
+	assert.Equal(t, "(...)", structure)
+
+	// crossing pairs are a pseudoknot in square brackets.
+	ct = "4 pseudoknot\n1 G 0 2 3 1\n2 G 1 3 4 2\n3 C 2 4 1 3\n4 C 3 0 2 4\n"
+	_, structure, err = ParseCT(strings.NewReader(ct))
+	require.NoError(t, err)
+	assert.Equal(t, "([)]", structure)
+
+	for name, ct := range map[string]string{
+		"empty":       "",
+		"header":      "ENERGY = -1.0\n",
+		"short":       "3 ENERGY = 0.0\n1 G 0 2 0 1\n",
+		"columns":     "1 ENERGY = 0.0\n1 G 0 0\n",
+		"position":    "2 ENERGY = 0.0\n1 G 0 2 0 1\n3 C 1 0 0 2\n",
+		"partner":     "2 ENERGY = 0.0\n1 G 0 2 3 1\n2 C 1 0 0 2\n",
+		"asymmetric":  "3 ENERGY = 0.0\n1 G 0 2 3 1\n2 A 1 3 0 2\n3 C 2 0 2 3\n",
+		"three knots": "6 ENERGY = 0.0\n1 G 0 2 4 1\n2 G 1 3 5 2\n3 G 2 4 6 3\n4 C 3 5 1 4\n5 C 4 6 2 5\n6 C 5 0 3 6\n",
+	} {
+		_, _, err := ParseCT(strings.NewReader(ct))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCoFold(t *testing.T) {
+	// a DNA primer and its reverse complement form a full duplex
+	result, err := CoFold("ACGTTGCATGCCAGTTACGA", "TCGTAACTGGCATGCAACGT", 37)
+	require.NoError(t, err)
+	assert.Equal(t, "((((((((((((((((((((&))))))))))))))))))))", result.DotBracket())
+	strandA, strandB := result.Strands()
+	assert.Equal(t, "((((((((((((((((((((", strandA)
+	assert.Equal(t, "))))))))))))))))))))", strandB)
+	assert.Less(t, result.BindingEnergy(), -20.0)
+
+	// RNA strands, whose duplex is more stable than the DNA one
+	rna, err := CoFold("ACGUUGCAUGCCAGUUACGA", "UCGUAACUGGCAUGCAACGU", 37)
+	require.NoError(t, err)
+	strandA, strandB = rna.Strands()
+	assert.Equal(t, "((((((((((((((((((((", strandA)
+	assert.Equal(t, "))))))))))))))))))))", strandB)
+	assert.Less(t, rna.BindingEnergy(), result.BindingEnergy())
+
+	// a self-complementary strand forms a homodimer rather than a hairpin
+	homodimer, err := CoFold("CGCGAATTCGCG", "CGCGAATTCGCG", 37)
+	require.NoError(t, err)
+	strandA, strandB = homodimer.Strands()
+	assert.Equal(t, "((((((((((((", strandA)
+	assert.Equal(t, "))))))))))))", strandB)
+	assert.Less(t, homodimer.BindingEnergy(), 0.0)
+	assert.InDelta(t, homodimer.MinimumFreeEnergy(), homodimer.BindingEnergy()+2*mustFoldEnergy(t, "CGCGAATTCGCG"), 0.001)
+
+	// strands that don't bind keep their own structures
+	apart, err := CoFold("GGGAAACCC", "TTTTTT", 37)
+	require.NoError(t, err)
+	strandA, strandB = apart.Strands()
+	assert.Equal(t, "((....)).", strandA)
+	assert.Equal(t, "......", strandB)
+	assert.Equal(t, "((....)).&......", apart.DotBracket())
+	assert.Equal(t, 0.0, apart.BindingEnergy())
+
+	_, err = CoFold("ACGTTGCA", "UGCAACGU", 37)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't fold DNA with RNA")
+	_, err = CoFold("ACGT", "", 37)
+	assert.Error(t, err)
+
+	// a single strand Result has a single strand
+	single, err := Zuker("GGGAAACCC", 37)
+	require.NoError(t, err)
+	strandA, strandB = single.Strands()
+	assert.Equal(t, single.DotBracket(), strandA)
+	assert.Equal(t, "", strandB)
+}
+
+// mustFoldEnergy returns the minimum free energy of seq at 37 C, or 0 if
+// it doesn't fold.
+func mustFoldEnergy(t *testing.T, seq string) float64 {
+	result, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	if energy := result.MinimumFreeEnergy(); energy < 0 && !math.IsInf(energy, 0) {
+		return energy
+	}
+	return 0
+}
+
+func TestFoldCircular(t *testing.T) {
+	// a hairpin whose stem runs through the origin: GACC at the end pairs
+	// with GGTC, and GCTG at the start with CAGC
+	seq := "GCTGTTTTCAGCGGTCAAAAAAGACC"
+	result, err := FoldCircular(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, "((((....))))((((......))))", result.DotBracket())
+	// folded linearly the two halves of the stem are hairpins side by side,
+	// with nothing stacking them on each other.
+	linear, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, "((((....))))((((......))))", linear.DotBracket())
+	assert.Less(t, result.MinimumFreeEnergy(), linear.MinimumFreeEnergy())
+
+	// a circle has no start, so every rotation folds the same
+	for rotation := 1; rotation < len(seq); rotation++ {
+		rotated, err := FoldCircular(seq[rotation:]+seq[:rotation], 37)
+		require.NoError(t, err)
+		assert.InDelta(t, result.MinimumFreeEnergy(), rotated.MinimumFreeEnergy(), 1e-9, "rotation %d", rotation)
+	}
+
+	unfolded, err := FoldCircular("AAAAAAAAAAAA", 37)
+	require.NoError(t, err)
+	assert.Equal(t, "............", unfolded.DotBracket())
+
+	_, err = FoldCircular("", 37)
+	assert.Error(t, err)
+}
+
+// TestZukerCorpus checks that folding random DNA and RNA sequences gives
+// exactly the structures and energies recorded in data/mfe_corpus.tsv, so
+// that speeding up the energy lookups can't change what they return.
+func TestZukerCorpus(t *testing.T) {
+	corpus, err := os.ReadFile("data/mfe_corpus.tsv")
+	require.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(corpus)), "\n") {
+		fields := strings.Split(line, "\t")
+		require.Len(t, fields, 4)
+		temp, err := strconv.ParseFloat(fields[1], 64)
+		require.NoError(t, err)
+		energy, err := strconv.ParseFloat(fields[3], 64)
+		require.NoError(t, err)
+
+		result, err := Zuker(fields[0], temp)
+		require.NoError(t, err)
+		assert.Equal(t, fields[2], result.DotBracket(), fields[0])
+		assert.Equal(t, energy, result.MinimumFreeEnergy(), fields[0])
+	}
+}
+
+func TestFoldWithMatrices(t *testing.T) {
+	seq := "ACCCCCTCCTTCCTTGGATCAAGGGGCTCAA"
+	expected, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	result, v, w, err := FoldWithMatrices(seq, 37)
+	require.NoError(t, err)
+	assert.Equal(t, expected.DotBracket(), result.DotBracket())
+	require.Len(t, v, len(seq))
+	require.Len(t, w, len(seq))
+	for start := range w {
+		require.Len(t, v[start], len(seq))
+		require.Len(t, w[start], len(seq))
+	}
+	assert.InDelta(t, result.MinimumFreeEnergy(), w[0][len(seq)-1], 1e-9)
+	assert.True(t, math.IsNaN(w[len(seq)-1][0]))
+	// too short to fold, so never computed
+	assert.True(t, math.IsNaN(v[0][1]))
+	// A and C can't pair
+	assert.True(t, math.IsInf(v[0][5], 1))
+
+	// the matrices are copies
+	w[0][len(seq)-1] = 0
+	_, _, again, err := FoldWithMatrices(seq, 37)
+	require.NoError(t, err)
+	assert.InDelta(t, result.MinimumFreeEnergy(), again[0][len(seq)-1], 1e-9)
+
+	_, _, _, err = FoldWithMatrices("ACGTX", 37)
+	assert.Error(t, err)
+}
+
+func TestPessimisticAmbiguity(t *testing.T) {
+	seq := "GCGCGCGAAAACGCGCGCAAAAAAAA"
+	expected, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	result, err := Zuker(seq, 37, WithAmbiguityHandling(Pessimistic))
+	require.NoError(t, err)
+	assert.Equal(t, expected.DotBracket(), result.DotBracket())
+	assert.Equal(t, expected.MinimumFreeEnergy(), result.MinimumFreeEnergy())
+
+	// an N in the stem pairs as the G it replaced.
+	degenerate := "GCNCGCGAAAACGCGCGCAAAAAAAA"
+	_, err = Zuker(degenerate, 37)
+	require.Error(t, err)
+	result, err = Zuker(degenerate, 37, WithAmbiguityHandling(Pessimistic))
+	require.NoError(t, err)
+	assert.Equal(t, expected.DotBracket(), result.DotBracket())
+	assert.InDelta(t, expected.MinimumFreeEnergy(), result.MinimumFreeEnergy(), 1e-9)
+
+	// a degenerate primer folds at least as well as every primer it could be.
+	primer := "ACCCCCTCCTTCCYTGGATCAAGGRGCTCAA"
+	result, err = Zuker(primer, 37, WithAmbiguityHandling(Pessimistic))
+	require.NoError(t, err)
+	for _, first := range "CT" {
+		for _, second := range "AG" {
+			concrete := strings.Replace(strings.Replace(primer, "Y", string(first), 1), "R", string(second), 1)
+			folded, err := Zuker(concrete, 37)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, result.MinimumFreeEnergy(), folded.MinimumFreeEnergy()+1e-9, concrete)
+		}
+	}
+
+	rna, err := Zuker("GCGCGCGAAAACGCGCGCUUUUNNNN", 37, WithAmbiguityHandling(Pessimistic))
+	require.NoError(t, err)
+	assert.Less(t, rna.MinimumFreeEnergy(), 0.0)
+
+	for _, invalid := range []string{"GCGCGXGAAAACGCGCGC", "GCGCGCGAAAACGCGCGCTTUU"} {
+		_, err = Zuker(invalid, 37, WithAmbiguityHandling(Pessimistic))
+		assert.Error(t, err, invalid)
+	}
+	_, err = Zuker(degenerate, 400, WithAmbiguityHandling(Pessimistic))
+	assert.Error(t, err)
+
+	// FoldAmbiguous is only a shorthand for the option.
+	alias, err := FoldAmbiguous(primer, 37)
+	require.NoError(t, err)
+	assert.Equal(t, result, alias)
+}
+
+func TestAmbiguityHandling(t *testing.T) {
+	seq := "GCGCGCGAAAACGCGCGCAAAAAAAA"
+	expected, err := Zuker(seq, 37)
+	require.NoError(t, err)
+
+	// an N in the middle of the stem, in place of the C paired to 14.
+	degenerate := "GCGNGCGAAAACGCGCGCAAAAAAAA"
+	_, err = Zuker(degenerate, 37)
+	assert.Error(t, err)
+	_, err = Zuker(degenerate, 37, WithAmbiguityHandling(Reject))
+	assert.Error(t, err)
+
+	pessimistic, err := Zuker(degenerate, 37, WithAmbiguityHandling(Pessimistic))
+	require.NoError(t, err)
+	assert.Equal(t, expected.DotBracket(), pessimistic.DotBracket())
+	assert.InDelta(t, expected.MinimumFreeEnergy(), pessimistic.MinimumFreeEnergy(), 1e-9)
+
+	skip, err := Zuker(degenerate, 37, WithAmbiguityHandling(Skip))
+	require.NoError(t, err)
+	assert.Greater(t, skip.MinimumFreeEnergy(), expected.MinimumFreeEnergy())
+	assert.Equal(t, byte('.'), skip.DotBracket()[3])
+	for _, pair := range skip.Pairs() {
+		assert.NotContains(t, pair, 3, "the N is paired")
+	}
+
+	// without ambiguity codes, every mode folds the same.
+	for _, mode := range []AmbiguityHandling{Skip, Pessimistic} {
+		result, err := Zuker(seq, 37, WithAmbiguityHandling(mode))
+		require.NoError(t, err)
+		assert.Equal(t, expected.DotBracket(), result.DotBracket())
+		assert.Equal(t, expected.MinimumFreeEnergy(), result.MinimumFreeEnergy())
+	}
+
+	_, err = Zuker(degenerate, 37, WithAmbiguityHandling(AmbiguityHandling(7)))
+	assert.Error(t, err)
+	_, err = Zuker("GCGXGCGAAAACGCGCGC", 37, WithAmbiguityHandling(Skip))
+	assert.Error(t, err)
+}
+
+func BenchmarkZuker(b *testing.B) {
+	benchmarkZuker(b, 300)
+}
+
+// BenchmarkZukerLong folds a sequence long enough for the size of the
+// caches to matter. A fold takes about 10 minutes, so it only runs with
+// FOLD_BENCHMARK_LONG set, and with -benchtime=1x, like:
+//
+//	FOLD_BENCHMARK_LONG=1 go test ./fold -run '^$' -bench ZukerLong -benchtime 1x -timeout 1h
+func BenchmarkZukerLong(b *testing.B) {
+	if os.Getenv("FOLD_BENCHMARK_LONG") == "" {
+		b.Skip("set FOLD_BENCHMARK_LONG to fold a 1,500 nt sequence, which takes about 10 minutes")
+	}
+	benchmarkZuker(b, 1500)
+}
+
+func benchmarkZuker(b *testing.B, length int) {
+	random := rand.New(rand.NewSource(int64(length)))
+	seq := make([]byte, length)
+	for index := range seq {
+		seq[index] = "ACGU"[random.Intn(4)]
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Zuker(string(seq), 37); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStructures(t *testing.T) {
+	// tRNA-Phe folds with a loop of every kind
+	result, err := Zuker("GCGGAUUUAGCUCAGUUGGGAGAGCGCCAGACUGAAGAUCUGGAGGUCCUGUGUUCGAUCCACAGAAUUCGCACCA", 37)
+	require.NoError(t, err)
+	elements := result.Structures()
+	kinds := make(map[ElementKind][]StructureElement)
+	energy := 0.0
+	for _, element := range elements {
+		kinds[element.Kind] = append(kinds[element.Kind], element)
+		energy += element.Energy
+	}
+	assert.InDelta(t, result.MinimumFreeEnergy(), energy, 1e-9)
+	for _, kind := range []ElementKind{StackElement, HairpinElement, BulgeElement, InteriorElement, MultibranchElement, DanglingElement} {
+		assert.NotEmpty(t, kinds[kind], kind.String())
+	}
+
+	assert.Equal(t, StructureElement{Kind: DanglingElement, Ranges: [][2]int{{0, 71}, {1, 70}}, Description: "STACKDanglingEnds:GC/CG", Energy: elements[0].Energy}, elements[0])
+	assert.Equal(t, [][2]int{{5, 66}, {11, 34}, {38, 65}}, kinds[MultibranchElement][0].Ranges)
+	assert.Equal(t, [][2]int{{19, 26}}, kinds[HairpinElement][0].Ranges)
+	assert.Equal(t, [][2]int{{45, 59}, {46, 57}}, kinds[BulgeElement][0].Ranges)
+	assert.Equal(t, "BULGE:2", kinds[BulgeElement][0].Description)
+	assert.Equal(t, [][2]int{{2, 69}, {4, 67}}, kinds[InteriorElement][0].Ranges)
+
+	// the exterior loop adds nothing, so two hairpins side by side are all
+	// there is
+	result, err = Zuker("ACGCGTTTTACGCGTAAAAAGGCCTTTTGGCCTT", 37)
+	require.NoError(t, err)
+	for _, element := range result.Structures() {
+		assert.NotEqual(t, ExteriorElement, element.Kind)
+	}
+
+	// but a circular sequence closes it through the origin
+	result, err = FoldCircular("GCTGTTTTCAGCGGTCAAAAAAGACC", 37)
+	require.NoError(t, err)
+	elements = result.Structures()
+	assert.Equal(t, ExteriorElement, elements[1].Kind)
+	assert.Equal(t, [][2]int{{0, 11}, {12, 25}}, elements[1].Ranges)
+	assert.Equal(t, "exterior", elements[1].Kind.String())
+}
+
+func TestTemperatureRange(t *testing.T) {
+	seq := "ACCCCCTCCTTCCTTGGATCAAGGGGCTCAA"
+	celsius, err := Zuker(seq, 37)
+	require.NoError(t, err)
+	kelvin, err := FoldAtKelvin(seq, 310.15)
+	require.NoError(t, err)
+	assert.Equal(t, celsius.DotBracket(), kelvin.DotBracket())
+	assert.InDelta(t, celsius.MinimumFreeEnergy(), kelvin.MinimumFreeEnergy(), 1e-9)
+
+	// 310.15 was meant as Kelvin
+	_, err = Zuker(seq, 310.15)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is it 37.00°C in Kelvin?")
+	_, err = Zuker(seq, -60)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "Kelvin")
+	_, err = FoldAtKelvin(seq, 37)
+	assert.Error(t, err)
+	_, err = MeltingCurve(seq, 100, 160, 10)
+	assert.Error(t, err)
+	_, err = PartitionFunction(seq, 400)
+	assert.Error(t, err)
+	_, err = Evaluate(seq, strings.Repeat(".", len(seq)), 400)
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package fold
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/******************************************************************************
+
+Structure melting temperature begins here
+
+A hairpin in a primer or probe only matters if it is still folded at the
+temperature it is used at. The melting temperature of a structure is taken
+here as the temperature where the free energy of the minimum free energy
+structure crosses zero: below it folding is favorable, above it the
+sequence is mostly unfolded.
+
+Free energy rises with temperature, since every loop and stack has
+dG = dH - T dS with dS negative, so the crossing is found by bisecting
+between meltingMinTemp and meltingMaxTemp, folding the sequence at each
+step.
+
+******************************************************************************/
+
+const (
+	// meltingMinTemp and meltingMaxTemp bracket the search of
+	// MeltingTemperature, in Celsius.
+	meltingMinTemp = 0.0
+	meltingMaxTemp = 100.0
+	// meltingTolerance is how close MeltingTemperature gets to the crossing,
+	// in Celsius.
+	meltingTolerance = 0.01
+)
+
+// MeltingTemperature returns the temperature in Celsius, between 0 and 100,
+// at which the minimum free energy of seq's structure crosses 0 kcal/mol. It
+// returns an error if seq has no stable structure at 0 or is still stable
+// at 100.
+func MeltingTemperature(seq string) (float64, error) {
+	low, high := meltingMinTemp, meltingMaxTemp
+	energy, err := foldEnergy(seq, low)
+	if err != nil {
+		return 0, err
+	}
+	if energy >= 0 {
+		return 0, fmt.Errorf("melting temperature: %s has no stable structure at %.0f°C", seq, low)
+	}
+	energy, err = foldEnergy(seq, high)
+	if err != nil {
+		return 0, err
+	}
+	if energy < 0 {
+		return 0, fmt.Errorf("melting temperature: %s is still folded at %.0f°C", seq, high)
+	}
+
+	for high-low > meltingTolerance {
+		mid := (low + high) / 2
+		energy, err := foldEnergy(seq, mid)
+		if err != nil {
+			return 0, err
+		}
+		if energy < 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
+
+// foldEnergy returns the minimum free energy of seq at temp Celsius, or 0 if
+// it has no structure at all.
+func foldEnergy(seq string, temp float64) (float64, error) {
+	result, err := Zuker(seq, temp)
+	if err != nil {
+		return 0, fmt.Errorf("melting temperature: %w", err)
+	}
+	energy := result.MinimumFreeEnergy()
+	if math.IsInf(energy, 0) {
+		return 0, nil
+	}
+	return energy, nil
+}
+
+/******************************************************************************
+
+Melting curves begin here
+
+MeltingCurve folds a sequence at every step of a range of temperatures, to
+see how a hairpin or toehold switch comes apart rather than just where. A
+sequence is the same at every temperature, so its caches are allocated once
+and emptied before each fold instead of being made again.
+
+******************************************************************************/
+
+// MeltPoint is the fold of a sequence at one temperature of a MeltingCurve.
+type MeltPoint struct {
+	Temperature       float64 // Temperature is in Celsius.
+	MinimumFreeEnergy float64 // MinimumFreeEnergy is in kcal/mol, 0 once no structure is stable.
+	PairedFraction    float64 // PairedFraction is the fraction of bases paired in the MFE structure.
+}
+
+// MeltingCurve folds seq at each temperature from startTemp to endTemp
+// Celsius, step apart, and returns the MFE and fraction of bases paired at
+// each. Once no structure is more stable than the unfolded sequence, the
+// MFE and fraction paired are 0.
+func MeltingCurve(seq string, startTemp, endTemp, step float64) ([]MeltPoint, error) {
+	if len(seq) == 0 {
+		return nil, errors.New("melting curve: empty sequence")
+	}
+	if step <= 0 || math.IsNaN(step) {
+		return nil, fmt.Errorf("melting curve: step must be more than 0, got %f", step)
+	}
+	if endTemp < startTemp {
+		return nil, fmt.Errorf("melting curve: end temperature %.2f is below start temperature %.2f", endTemp, startTemp)
+	}
+	foldContext, err := emptyContext(seq, startTemp, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("melting curve: %w", err)
+	}
+
+	// count the steps instead of adding them up, so rounding can't lose the last
+	steps := int(math.Floor((endTemp-startTemp)/step+1e-9)) + 1
+	curve := make([]MeltPoint, steps)
+	for index := range curve {
+		temp := startTemp + float64(index)*step
+		if err := foldContext.refold(temp); err != nil {
+			return nil, fmt.Errorf("melting curve: %w", err)
+		}
+		curve[index].Temperature = temp
+
+		result := minimumFreeEnergyResult(foldContext)
+		energy := result.MinimumFreeEnergy()
+		if math.IsInf(energy, 0) || energy >= 0 {
+			continue
+		}
+		curve[index].MinimumFreeEnergy = energy
+		paired := strings.Count(result.DotBracket(), "(") * 2
+		curve[index].PairedFraction = float64(paired) / float64(len(seq))
+	}
+	return curve, nil
+}
@@ -0,0 +1,414 @@
+package fold
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/******************************************************************************
+
+Partition function begins here
+
+Zuker finds the single structure with the lowest free energy, but a sequence
+spends its time in many structures, and for primer and probe design what
+matters is how likely a base is to be paired at all. McCaskill's algorithm
+(McCaskill, 1990, doi:10.1002/bip.360290621) sums the Boltzmann weights
+exp(-dG/RT) of every structure, the partition function Q, and from it the
+probability of every base pair.
+
+PartitionFunction uses the same energy tables and loop functions as Zuker:
+hairpins, stacks, bulges, interior loops and multibranch loops are scored
+exactly as pairedMinimumFreeEnergyV scores them, and isolated base pairs are
+left out like they are there. The one difference is that interior loops and
+bulges are limited to maxLenPreCalulated unpaired bases, which keeps the
+algorithm O(n^3).
+
+The matrices parallel Zuker's caches: pairedQ[i][j] is the partition
+function of i..j given that i pairs with j, like V, and exteriorQ[i][j] is
+the partition function of i..j unconstrained, like W. multiQ and
+multiBranchQ hold the parts of multibranch loops. Probabilities are then
+found from the outside in, each pair collecting the probability of the pairs
+that enclose it.
+
+Boltzmann weights of long sequences overflow float64, so every matrix entry
+is divided by scale^(number of bases it covers), where scale is the weight of
+the ensemble free energy per base, as ViennaRNA does. That energy isn't known
+until the matrices are filled, so they are filled with a guess and filled
+again with the energy the guess gives, until the partition function of the
+whole sequence is close to 1. Probabilities are ratios of terms covering the
+same bases, so scale cancels out of them.
+
+******************************************************************************/
+
+// gasConstant is R in kcal/(mol K).
+const gasConstant = 1.9872e-3
+
+const (
+	// scaleEnergyGuess is the ensemble free energy per base, in kcal/mol,
+	// the matrices are first scaled with.
+	scaleEnergyGuess = -0.3
+	// scaleEnergyStep is how much the guess changes, in kcal/mol per base,
+	// when the partition function overflows or underflows.
+	scaleEnergyStep = 1.0
+	// maxScaledLogQ is how far from 0 the log of the scaled partition
+	// function may be.
+	maxScaledLogQ = 50.0
+	// maxRescales is how many times the matrices are filled again with a
+	// better scale before giving up.
+	maxRescales = 10
+)
+
+// Ensemble holds the base pair probabilities of a sequence, computed by
+// PartitionFunction.
+type Ensemble struct {
+	// probabilities[i][j], for i < j, is the probability that i pairs with j.
+	probabilities [][]float64
+	unpaired      []float64
+	// ensembleEnergy is -RT ln Q in kcal/mol.
+	ensembleEnergy float64
+}
+
+// PairProbability returns the probability that bases i and j, 0 indexed,
+// pair with each other. The order of i and j doesn't matter, and bases
+// outside the sequence never pair.
+func (ensemble *Ensemble) PairProbability(i, j int) float64 {
+	if i > j {
+		i, j = j, i
+	}
+	if i < 0 || j >= len(ensemble.unpaired) {
+		return 0
+	}
+	return ensemble.probabilities[i][j]
+}
+
+// PositionalUnpairedProbability returns the probability that base i, 0
+// indexed, isn't paired with any base. It returns 0 for bases outside the
+// sequence.
+func (ensemble *Ensemble) PositionalUnpairedProbability(i int) float64 {
+	if i < 0 || i >= len(ensemble.unpaired) {
+		return 0
+	}
+	return ensemble.unpaired[i]
+}
+
+// EnsembleFreeEnergy returns the free energy of the whole ensemble of
+// structures, -RT ln Q, in kcal/mol. It is never above the free energy of
+// any single structure in the model.
+func (ensemble *Ensemble) EnsembleFreeEnergy() float64 {
+	return ensemble.ensembleEnergy
+}
+
+// partitionContext holds what is needed to fill the partition function
+// matrices of a sequence.
+type partitionContext struct {
+	foldContext context
+	n           int
+	kT          float64
+	// scale is the per base scaling factor of every matrix entry.
+	scale float64
+	// scales[k] is scale^-k.
+	scales       []float64
+	pairedQ      [][]float64
+	exteriorQ    [][]float64
+	multiQ       [][]float64
+	multiBranchQ [][]float64
+}
+
+// PartitionFunction computes the partition function of seq at temp Celsius
+// and the probability of each of its base pairs, using McCaskill's
+// algorithm with the energies Zuker uses.
+func PartitionFunction(seq string, temp float64) (*Ensemble, error) {
+	if len(seq) == 0 {
+		return nil, errors.New("partition function: empty sequence")
+	}
+	if err := checkTemperature(temp); err != nil {
+		return nil, fmt.Errorf("partition function: %w", err)
+	}
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return nil, fmt.Errorf("partition function: %w", err)
+	}
+
+	n := len(seq)
+	kelvin := temp + zeroCelsius
+	pc := &partitionContext{
+		foldContext: scoringContext(seq, energyMap, kelvin),
+		n:           n,
+		kT:          gasConstant * kelvin,
+	}
+	energyPerBase := scaleEnergyGuess
+	for rescale := 0; ; rescale++ {
+		pc.setScale(math.Exp(-energyPerBase / pc.kT))
+		if err = pc.fillInside(); err != nil {
+			return nil, err
+		}
+		total := pc.exterior(0, n-1)
+		logTotal := math.Log(total)
+		if math.Abs(logTotal) < maxScaledLogQ {
+			break
+		}
+		if rescale == maxRescales {
+			return nil, fmt.Errorf("partition function: failed to scale the partition function of %d bases", n)
+		}
+		switch {
+		case math.IsInf(total, 1) || math.IsNaN(total):
+			energyPerBase -= scaleEnergyStep
+		case total == 0:
+			energyPerBase += scaleEnergyStep
+		default:
+			energyPerBase -= pc.kT * logTotal / float64(n)
+		}
+	}
+	result, err := pc.fillOutside()
+	if err != nil {
+		return nil, err
+	}
+	result.ensembleEnergy = -pc.kT * (math.Log(pc.exterior(0, n-1)) + float64(n)*math.Log(pc.scale))
+	return result, nil
+}
+
+// setScale sets the per base scaling factor and empties the matrices.
+func (pc *partitionContext) setScale(scale float64) {
+	pc.scale = scale
+	// multibranch loops are scaled by scales[2], even in sequences too short
+	// to have one.
+	length := pc.n + 1
+	if length < 3 {
+		length = 3
+	}
+	pc.scales = make([]float64, length)
+	pc.scales[0] = 1
+	for k := 1; k < length; k++ {
+		pc.scales[k] = pc.scales[k-1] / scale
+	}
+	pc.pairedQ = newMatrix(pc.n)
+	pc.exteriorQ = newMatrix(pc.n)
+	pc.multiQ = newMatrix(pc.n)
+	pc.multiBranchQ = newMatrix(pc.n)
+}
+
+// newMatrix returns an n by n matrix of zeros.
+func newMatrix(n int) [][]float64 {
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n)
+	}
+	return matrix
+}
+
+// boltzmann returns the Boltzmann weight of a free energy in kcal/mol.
+func (pc *partitionContext) boltzmann(energy float64) float64 {
+	return math.Exp(-energy / pc.kT)
+}
+
+// exterior returns exteriorQ[i][j], which is 1 for the empty subsequence
+// where j < i.
+func (pc *partitionContext) exterior(i, j int) float64 {
+	if j < i {
+		return 1
+	}
+	return pc.exteriorQ[i][j]
+}
+
+// multi returns multiQ[i][j], which is 0 for the empty subsequence.
+func (pc *partitionContext) multi(i, j int) float64 {
+	if j < i {
+		return 0
+	}
+	return pc.multiQ[i][j]
+}
+
+// unpairedInMultibranch returns the scaled Boltzmann weight of count
+// unpaired bases in a multibranch loop.
+func (pc *partitionContext) unpairedInMultibranch(count int) float64 {
+	return pc.boltzmann(pc.foldContext.energies.multibranch.coaxialStackCount*float64(count)) * pc.scales[count]
+}
+
+// canPair returns true if start and end are complementary.
+func (pc *partitionContext) canPair(start, end int) bool {
+	return start >= 0 && end < len(pc.foldContext.seq) && pc.foldContext.canPair(start, end)
+}
+
+// allowedPair returns true if start and end can pair in a structure: they
+// are complementary, far enough apart to close a hairpin, and not an
+// isolated pair as pairedMinimumFreeEnergyV defines them.
+func (pc *partitionContext) allowedPair(start, end int) bool {
+	if end-start < minLenForStruct || !pc.canPair(start, end) {
+		return false
+	}
+	isolatedOuter := start == 0 || end == pc.n-1 || !pc.canPair(start-1, end+1)
+	isolatedInner := !pc.canPair(start+1, end-1)
+	return !(isolatedOuter && isolatedInner)
+}
+
+// interiorLoops calls visit with every pair (rightOfStart, leftOfEnd) that
+// can close a stack, bulge or interior loop with (start, end), and the free
+// energy of the loop.
+func (pc *partitionContext) interiorLoops(start, end int, visit func(rightOfStart, leftOfEnd int, energy float64)) error {
+	for rightOfStart := start + 1; rightOfStart < end-minLenForStruct && rightOfStart-start-1 <= maxLenPreCalulated; rightOfStart++ {
+		for leftOfEnd := end - 1; leftOfEnd-rightOfStart >= minLenForStruct; leftOfEnd-- {
+			if rightOfStart-start-1+end-leftOfEnd-1 > maxLenPreCalulated {
+				break
+			}
+			if pc.pairedQ[rightOfStart][leftOfEnd] == 0 {
+				continue
+			}
+			energy, ok, err := interiorLoopEnergy(start, rightOfStart, end, leftOfEnd, pc.foldContext)
+			if err != nil {
+				return fmt.Errorf("partition function: subsequence (%d, %d): %w", start, end, err)
+			}
+			if ok {
+				visit(rightOfStart, leftOfEnd, energy)
+			}
+		}
+	}
+	return nil
+}
+
+// interiorLoopEnergy returns the free energy of the stack, bulge or interior
+// loop closed by the pairs (start, end) and (rightOfStart, leftOfEnd),
+// scored the way pairedMinimumFreeEnergyV scores it. It returns false for
+// loops pairedMinimumFreeEnergyV doesn't consider.
+func interiorLoopEnergy(start, rightOfStart, end, leftOfEnd int, foldContext context) (float64, bool, error) {
+	pairLeftInner := foldContext.tables.nearestNeighbors.known[foldContext.pairCode(start, start+1, end, end-1)]
+	pairRightInner := foldContext.tables.nearestNeighbors.known[foldContext.pairCode(rightOfStart-1, rightOfStart, leftOfEnd+1, leftOfEnd)]
+	bulgeLeft := rightOfStart > start+1
+	bulgeRight := leftOfEnd < end-1
+	switch {
+	case !bulgeLeft && !bulgeRight:
+		return stack(start, rightOfStart, end, leftOfEnd, foldContext), true, nil
+	case bulgeLeft && bulgeRight && !(pairLeftInner || pairRightInner):
+		energy, err := internalLoop(start, rightOfStart, end, leftOfEnd, foldContext)
+		return energy, err == nil, err
+	case bulgeLeft != bulgeRight:
+		energy, err := Bulge(start, rightOfStart, end, leftOfEnd, foldContext)
+		return energy, err == nil, err
+	}
+	return 0, false, nil
+}
+
+// fillInside fills the partition function matrices from the shortest
+// subsequences up.
+func (pc *partitionContext) fillInside() error {
+	multibranch := pc.foldContext.energies.multibranch
+	closing := pc.boltzmann(multibranch.helicesCount+multibranch.unpairedCount) * pc.scales[2]
+	branch := pc.boltzmann(multibranch.unpairedCount)
+	for span := 0; span < pc.n; span++ {
+		for start := 0; start+span < pc.n; start++ {
+			end := start + span
+			if pc.allowedPair(start, end) {
+				hairpinEnergy, err := hairpin(start, end, pc.foldContext)
+				if err != nil {
+					return fmt.Errorf("partition function: subsequence (%d, %d): %w", start, end, err)
+				}
+				paired := pc.boltzmann(hairpinEnergy) * pc.scales[span+1]
+				err = pc.interiorLoops(start, end, func(rightOfStart, leftOfEnd int, energy float64) {
+					paired += pc.boltzmann(energy) * pc.scales[rightOfStart-start+end-leftOfEnd] * pc.pairedQ[rightOfStart][leftOfEnd]
+				})
+				if err != nil {
+					return err
+				}
+				// a multibranch loop is at least one branch, and then the last
+				// branch starting at lastBranch.
+				for lastBranch := start + 2; lastBranch < end; lastBranch++ {
+					paired += closing * pc.multi(start+1, lastBranch-1) * pc.multiBranchQ[lastBranch][end-1]
+				}
+				pc.pairedQ[start][end] = paired
+			}
+
+			// multiBranchQ is a branch starting at start, followed by unpaired
+			// bases up to end.
+			multiBranch := 0.0
+			for branchEnd := start + minLenForStruct; branchEnd <= end; branchEnd++ {
+				multiBranch += pc.pairedQ[start][branchEnd] * branch * pc.unpairedInMultibranch(end-branchEnd)
+			}
+			pc.multiBranchQ[start][end] = multiBranch
+
+			// multiQ is one or more branches, the last starting at lastBranch.
+			multi := 0.0
+			for lastBranch := start; lastBranch <= end; lastBranch++ {
+				multi += (pc.unpairedInMultibranch(lastBranch-start) + pc.multi(start, lastBranch-1)) * pc.multiBranchQ[lastBranch][end]
+			}
+			pc.multiQ[start][end] = multi
+
+			// exteriorQ either leaves end unpaired or pairs it with some base.
+			exterior := pc.exterior(start, end-1) * pc.scales[1]
+			for pairStart := start; pairStart <= end-minLenForStruct; pairStart++ {
+				exterior += pc.exterior(start, pairStart-1) * pc.pairedQ[pairStart][end]
+			}
+			pc.exteriorQ[start][end] = exterior
+		}
+	}
+	return nil
+}
+
+// fillOutside finds the probability of every pair from the outermost in.
+func (pc *partitionContext) fillOutside() (*Ensemble, error) {
+	n := pc.n
+	multibranch := pc.foldContext.energies.multibranch
+	closing := pc.boltzmann(multibranch.helicesCount+multibranch.unpairedCount) * pc.scales[2]
+	branch := pc.boltzmann(multibranch.unpairedCount)
+	total := pc.exterior(0, n-1)
+
+	probabilities := newMatrix(n)
+	// interior[i][j] is the probability collected by (i, j) from the pairs
+	// closing a stack, bulge or interior loop around it.
+	interior := newMatrix(n)
+	// closedUnpaired[h][l] and closedMulti[h][l] sum, over the pairs (h, m)
+	// closing a multibranch loop, the weight of the loop's bases after a
+	// branch ending at l being unpaired, or holding more branches.
+	closedUnpaired := newMatrix(n)
+	closedMulti := newMatrix(n)
+	for span := n - 1; span >= minLenForStruct; span-- {
+		for start := 0; start+span < n; start++ {
+			end := start + span
+			paired := pc.pairedQ[start][end]
+			if paired == 0 {
+				continue
+			}
+			probability := pc.exterior(0, start-1) * paired * pc.exterior(end+1, n-1) / total
+			probability += interior[start][end]
+			for closer := 0; closer < start; closer++ {
+				left := pc.multi(closer+1, start-1)
+				probability += paired * branch * (left*(closedMulti[closer][end]+closedUnpaired[closer][end]) + pc.unpairedInMultibranch(start-closer-1)*closedMulti[closer][end])
+			}
+			if probability > 1 {
+				probability = 1
+			}
+			probabilities[start][end] = probability
+			if probability == 0 {
+				continue
+			}
+
+			err := pc.interiorLoops(start, end, func(rightOfStart, leftOfEnd int, energy float64) {
+				interior[rightOfStart][leftOfEnd] += probability / paired * pc.boltzmann(energy) * pc.scales[rightOfStart-start+end-leftOfEnd] * pc.pairedQ[rightOfStart][leftOfEnd]
+			})
+			if err != nil {
+				return nil, err
+			}
+			weight := probability / paired * closing
+			for branchEnd := start + 1; branchEnd < end; branchEnd++ {
+				closedUnpaired[start][branchEnd] += weight * pc.unpairedInMultibranch(end-branchEnd-1)
+				closedMulti[start][branchEnd] += weight * pc.multi(branchEnd+1, end-1)
+			}
+		}
+	}
+
+	unpaired := make([]float64, n)
+	for i := range unpaired {
+		unpaired[i] = 1
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			unpaired[i] -= probabilities[i][j]
+			unpaired[j] -= probabilities[i][j]
+		}
+	}
+	for i := range unpaired {
+		unpaired[i] = math.Max(0, unpaired[i])
+	}
+	return &Ensemble{probabilities: probabilities, unpaired: unpaired}, nil
+}
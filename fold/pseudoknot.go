@@ -0,0 +1,183 @@
+package fold
+
+import (
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+
+Pseudoknot detection begins here
+
+Zuker style folding only finds nested structures, where no two pairs cross.
+Pseudoknots, where bases in a loop pair with bases outside of it, are common
+in functional RNAs (ribosomal frameshift signals, riboswitches, telomerase
+RNA), but predicting them exactly is NP-hard for general energy models.
+
+DetectPseudoknots uses a cheap approximation instead. It takes the nested
+MFE structure as given and looks for stems that could form between its
+unpaired bases and that cross the nested pairs. Each candidate stem is scored
+as a standalone duplex with the same nearest neighbor energies used for
+folding, ignoring the loop penalties a real pseudoknot would pay, so treat
+what it finds as candidates worth a closer look rather than predictions.
+
+The simplest and most common pseudoknot is the H-type, where the loop of a
+hairpin pairs with bases downstream of the hairpin:
+
+	5' ((((.....[[[[...))))...]]]] 3'
+
+Pseudoknotted pairs are written in square brackets, as above, by
+DotBracketWithPseudoknots.
+
+******************************************************************************/
+
+// Pseudoknot is a stem crossing the pairs of a nested structure. Its bases
+// Start to Start+Length-1 pair with End down to End-Length+1.
+type Pseudoknot struct {
+	Start  int     // Start is the first base of the stem's 5' strand.
+	End    int     // End is the last base of the stem's 3' strand, paired with Start.
+	Length int     // Length is the number of base pairs in the stem.
+	Energy float64 // Energy is the free energy of the stem as a standalone duplex, in kcal/mol.
+}
+
+// pseudoknotMinLoop is the fewest unpaired bases a stem can close.
+const pseudoknotMinLoop = 3
+
+// DetectPseudoknots finds stems of at least minStemLength base pairs that
+// could form between the bases left unpaired in result, the nested fold of
+// seq at temp Celsius, and that cross its pairs. Only stems with a negative
+// free energy are returned. Stems never share bases or cross each other, and
+// the most stable ones win when they would. They are sorted by Start.
+//
+// It returns nil if seq is not DNA or RNA.
+func DetectPseudoknots(result Result, seq string, temp float64, minStemLength int) []Pseudoknot {
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return nil
+	}
+	if minStemLength < 1 {
+		minStemLength = 1
+	}
+	foldContext := scoringContext(seq, energyMap, temp+zeroCelsius)
+	pairedWith := pairTable(result.dotBracket(), len(seq))
+
+	canPair := func(i, j int) bool {
+		return pairedWith[i] == -1 && pairedWith[j] == -1 && foldContext.energies.complement(rune(seq[i])) == rune(seq[j])
+	}
+	crossesNested := func(start, end int) bool {
+		for i, j := range pairedWith {
+			if j > i && (start < i && i < end && end < j || i < start && start < j && j < end) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var candidates []Pseudoknot
+	for start := range seq {
+		for end := len(seq) - 1; end-start > pseudoknotMinLoop; end-- {
+			// only look at the outermost pair of each stem.
+			if !canPair(start, end) || (start > 0 && end < len(seq)-1 && canPair(start-1, end+1)) {
+				continue
+			}
+			length := 1
+			for end-length-(start+length) > pseudoknotMinLoop && canPair(start+length, end-length) {
+				length++
+			}
+			if length < minStemLength || !crossesNested(start, end) {
+				continue
+			}
+			stem := Pseudoknot{Start: start, End: end, Length: length, Energy: stemEnergy(start, end, length, foldContext)}
+			if stem.Energy < 0 {
+				candidates = append(candidates, stem)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Energy < candidates[j].Energy })
+	var pseudoknots []Pseudoknot
+	for _, candidate := range candidates {
+		compatible := true
+		for _, accepted := range pseudoknots {
+			if !nestedOrApart(candidate, accepted) {
+				compatible = false
+				break
+			}
+		}
+		if compatible {
+			pseudoknots = append(pseudoknots, candidate)
+		}
+	}
+	sort.Slice(pseudoknots, func(i, j int) bool { return pseudoknots[i].Start < pseudoknots[j].Start })
+	return pseudoknots
+}
+
+// DotBracketWithPseudoknots returns the dot-bracket notation of the result
+// with the pairs of pseudoknots, as found by DetectPseudoknots, in square
+// brackets.
+func (r Result) DotBracketWithPseudoknots(pseudoknots []Pseudoknot) string {
+	structure := []byte(r.dotBracket())
+	for _, pseudoknot := range pseudoknots {
+		for len(structure) <= pseudoknot.End {
+			structure = append(structure, '.')
+		}
+		for offset := 0; offset < pseudoknot.Length; offset++ {
+			structure[pseudoknot.Start+offset] = '['
+			structure[pseudoknot.End-offset] = ']'
+		}
+	}
+	return string(structure)
+}
+
+// pairTable returns the index each base of a dot-bracket structure pairs
+// with, or -1 for unpaired bases, padded to length.
+func pairTable(dotBracket string, length int) []int {
+	pairedWith := make([]int, length)
+	for index := range pairedWith {
+		pairedWith[index] = -1
+	}
+	var opened []int
+	for index, character := range dotBracket {
+		switch character {
+		case '(':
+			opened = append(opened, index)
+		case ')':
+			start := opened[len(opened)-1]
+			opened = opened[:len(opened)-1]
+			pairedWith[start], pairedWith[index] = index, start
+		}
+	}
+	return pairedWith
+}
+
+// stemEnergy is the free energy of a stem as a standalone duplex: its
+// nearest neighbor stacks, and a penalty for each AT or AU terminal pair.
+func stemEnergy(start, end, length int, foldContext context) float64 {
+	energy := 0.0
+	for offset := 0; offset+1 < length; offset++ {
+		energy += foldContext.tables.nearestNeighbors.deltaG[foldContext.pairCode(start+offset, start+offset+1, end-offset, end-offset-1)]
+	}
+	for _, base := range []byte{foldContext.seq[start], foldContext.seq[start+length-1]} {
+		if base == 'A' || base == 'T' || base == 'U' {
+			energy += closingATPenalty
+		}
+	}
+	return energy
+}
+
+// nestedOrApart returns true if two stems share no bases and don't cross, so
+// they can be drawn with the same kind of bracket.
+func nestedOrApart(a, b Pseudoknot) bool {
+	if b.Start < a.Start {
+		a, b = b, a
+	}
+	switch {
+	case b.Start > a.End: // apart
+		return true
+	case b.End < a.End: // b inside a, so it must be inside a's loop
+		return b.Start > a.Start+a.Length-1 && b.End < a.End-a.Length+1
+	default: // crossing or overlapping
+		return false
+	}
+}
@@ -3,6 +3,7 @@ package fold
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 
 	"github.com/TimothyStiles/poly/checks"
@@ -30,6 +31,15 @@ const (
 	// an AT basepair.
 	// Formula 8 from SantaLucia, 2004
 	closingATPenalty = 0.5
+
+	// MinTemperature and MaxTemperature bound the temperatures, in Celsius,
+	// that sequences can be folded at. Water freezes and boils well inside
+	// them, so a temperature outside of them is almost certainly in the
+	// wrong unit, like Kelvin, rather than an experiment.
+	MinTemperature = -50.0
+	MaxTemperature = 150.0
+	// zeroCelsius is 0 Celsius in Kelvin.
+	zeroCelsius = 273.15
 )
 
 /*
@@ -133,67 +143,268 @@ var invalidStructure = nucleicAcidStructure{
 	energy:      math.Inf(1),
 }
 
+/******************************************************************************
+
+Caches begin here
+
+Folding fills V and W for every subsequence of the sequence, and every
+entry used to be a nucleicAcidStructure with a description string and a
+slice of inner subsequences, built for each candidate loop whether or not
+it won. Nearly all of them are thrown away: traceback only visits the few
+entries along the minimum free energy structure. Building them was most of
+the memory folding allocated, and much of its time.
+
+So the caches hold cachedStructures instead, a fixed size record of the
+energy, the kind of loop and the indexes needed to find its inner pairs,
+laid out as the upper triangle of a matrix in one slice. Descriptions and
+inner subsequences are made by expand during traceback, from the same
+entries, so the structures found are exactly the same as before.
+
+******************************************************************************/
+
+// cachedStructure is a structure in the caches of a context. It holds only
+// what the recursions need, which is a third of the memory of a
+// nucleicAcidStructure and none of its allocations. The description and
+// inner subsequences of a structure are made by expand, only for the
+// structures traceback keeps.
+type cachedStructure struct {
+	// energy is the free energy of the structure.
+	energy float64
+	// start and end are the subsequence the structure was found for. W
+	// copies structures of subsequences inside it, which keep theirs.
+	start, end int32
+	// first and second are the inner pair of a loop closing one pair, or
+	// what's left of a part of a multibranch loop after an unpaired base,
+	// and first is the mid of a structure split between branches.
+	first, second int32
+	// kind is how the structure was formed, or unfilled if it hasn't been
+	// computed yet.
+	kind loopKind
+}
+
+// Valid returns true if the cachedStructure is valid.
+func (structure cachedStructure) Valid() bool {
+	return structure.energy != math.Inf(1) && structure.energy != math.Inf(-1)
+}
+
+// invalidCached is a cachedStructure that isn't valid.
+var invalidCached = cachedStructure{energy: math.Inf(1), kind: noStructure}
+
+// structureCache holds a cachedStructure for each subsequence start, end of
+// a sequence with start <= end, row by row, so it takes half the memory of
+// a square matrix. Subsequences with end before start aren't valid.
+type structureCache struct {
+	length  int
+	entries []cachedStructure
+}
+
+// newStructureCache returns an unfilled structureCache for a sequence of
+// length bases.
+func newStructureCache(length int) structureCache {
+	return structureCache{length: length, entries: make([]cachedStructure, length*(length+1)/2)}
+}
+
+// index returns the index of start, end in entries.
+func (cache structureCache) index(start, end int) int {
+	return start*cache.length - start*(start-1)/2 + end - start
+}
+
+// get returns the structure of start, end.
+func (cache structureCache) get(start, end int) cachedStructure {
+	if end < start {
+		return invalidCached
+	}
+	return cache.entries[cache.index(start, end)]
+}
+
+// set replaces the structure of start, end.
+func (cache structureCache) set(start, end int, structure cachedStructure) {
+	cache.entries[cache.index(start, end)] = structure
+}
+
+// energies returns the energy of each start, end of cache as a square
+// matrix, indexed [start][end]. Subsequences that weren't computed, and
+// those with end before start, are NaN.
+func (cache structureCache) energies() [][]float64 {
+	matrix := make([][]float64, cache.length)
+	for start := range matrix {
+		matrix[start] = make([]float64, cache.length)
+		for end := range matrix[start] {
+			matrix[start][end] = math.NaN()
+			if structure := cache.get(start, end); end >= start && structure.kind != unfilled {
+				matrix[start][end] = structure.energy
+			}
+		}
+	}
+	return matrix
+}
+
 // context holds the energy caches, energy maps, sequence, and temperature
 // needed in order to compute the folding energy and structures.
 type context struct {
 	energies                   energies
 	seq                        string
-	pairedMinimumFreeEnergyV   [][]nucleicAcidStructure
-	unpairedMinimumFreeEnergyW [][]nucleicAcidStructure
-	temp                       float64
+	pairedMinimumFreeEnergyV   structureCache
+	unpairedMinimumFreeEnergyW structureCache
+	// multibranchMinimumFreeEnergyWM holds the parts of multibranch loops.
+	multibranchMinimumFreeEnergyWM structureCache
+	temp                           float64
+	// constraints are the bases forced unpaired or paired by FoldConstrained,
+	// or nil.
+	constraints *foldConstraints
+	// codes is seq encoded for looking up energies in tables.
+	codes []uint8
+	// tables are the energies keyed by two pairs, at temp.
+	tables *energyTables
+	// cut is the index of the first base of the second strand when two
+	// strands are folded together by CoFold, or 0 for a single strand.
+	cut int
+	// duplexInitiation is the free energy of bringing the two strands of a
+	// CoFold together, added to the loop that holds the cut.
+	duplexInitiation float64
+}
+
+// checkTemperature returns an error if temp isn't a plausible temperature in
+// Celsius.
+func checkTemperature(temp float64) error {
+	if temp >= MinTemperature && temp <= MaxTemperature {
+		return nil
+	}
+	if temp-zeroCelsius >= MinTemperature && temp-zeroCelsius <= MaxTemperature {
+		return fmt.Errorf("temperature %.2f°C is outside of %.0f to %.0f°C, is it %.2f°C in Kelvin? Use FoldAtKelvin to fold at a temperature in Kelvin", temp, MinTemperature, MaxTemperature, temp-zeroCelsius)
+	}
+	return fmt.Errorf("temperature %.2f°C is outside of %.0f to %.0f°C", temp, MinTemperature, MaxTemperature)
 }
 
 // newFoldingContext returns a context ready to use, in case of error
 // the returned FoldingContext is empty.
 func newFoldingContext(seq string, temp float64) (context, error) {
-	seq = strings.ToUpper(seq)
+	return newContext(seq, temp, nil, 0)
+}
 
-	// figure out whether it's DNA or rna, choose energy map
-	var energyMap energies
-	switch {
-	case checks.IsDNA(seq):
-		energyMap = dnaEnergies
-	case checks.IsRNA(seq):
-		energyMap = rnaEnergies
-	default:
-		return context{}, fmt.Errorf("the sequence %s is not RNA or DNA", seq)
-	}
-
-	var (
-		sequenceLength = len(seq)
-		vCache         = make([][]nucleicAcidStructure, sequenceLength)
-		wCache         = make([][]nucleicAcidStructure, sequenceLength)
-		row            = make([]nucleicAcidStructure, sequenceLength)
-	)
-	for nucleicAcidIndex := 0; nucleicAcidIndex < sequenceLength; nucleicAcidIndex++ {
-		row[nucleicAcidIndex] = defaultStructure
-	}
-	for j := 0; j < sequenceLength; j++ {
-		vCache[j] = make([]nucleicAcidStructure, sequenceLength)
-		copy(vCache[j], row)
-
-		wCache[j] = make([]nucleicAcidStructure, sequenceLength)
-		copy(wCache[j], row)
-	}
-	ret := context{
-		energies:                   energyMap,
-		seq:                        seq,
-		pairedMinimumFreeEnergyV:   vCache,
-		unpairedMinimumFreeEnergyW: wCache,
-		temp:                       temp + 273.15, // kelvin
+// newContext returns a context ready to use, folded under constraints if
+// they aren't nil, and as two strands split before cut if it isn't 0. In
+// case of error the returned context is empty.
+func newContext(seq string, temp float64, constraints *foldConstraints, cut int) (context, error) {
+	ret, err := emptyContext(seq, temp, constraints, cut)
+	if err != nil {
+		return context{}, err
 	}
 
 	// fill the cache
-	_, err := unpairedMinimumFreeEnergyW(0, sequenceLength-1, ret)
+	_, err = unpairedMinimumFreeEnergyW(0, len(ret.seq)-1, ret)
 	if err != nil {
 		return context{}, fmt.Errorf("error filling the caches for the FoldingContext: %w", err)
 	}
 	return ret, nil
 }
 
+// refold empties the caches of foldContext and fills them again at temp
+// Celsius, so a sequence can be folded at many temperatures without
+// allocating new caches each time.
+func (foldContext *context) refold(temp float64) error {
+	if err := checkTemperature(temp); err != nil {
+		return err
+	}
+	foldContext.temp = temp + zeroCelsius // kelvin
+	foldContext.tables = newEnergyTables(foldContext.energies, foldContext.temp, foldContext.tables.codes)
+	if foldContext.cut > 0 {
+		foldContext.duplexInitiation = duplexInitiation(foldContext.energies, foldContext.temp)
+	}
+	foldContext.clearCaches()
+	if _, err := unpairedMinimumFreeEnergyW(0, len(foldContext.seq)-1, *foldContext); err != nil {
+		return fmt.Errorf("error filling the caches for the FoldingContext: %w", err)
+	}
+	return nil
+}
+
+// allocateCaches gives foldContext new, unfilled caches for its sequence.
+func (foldContext *context) allocateCaches() {
+	foldContext.pairedMinimumFreeEnergyV = newStructureCache(len(foldContext.seq))
+	foldContext.unpairedMinimumFreeEnergyW = newStructureCache(len(foldContext.seq))
+	foldContext.multibranchMinimumFreeEnergyWM = newStructureCache(len(foldContext.seq))
+}
+
+// clearCaches empties the caches of foldContext, so it can be folded again.
+func (foldContext *context) clearCaches() {
+	for _, cache := range []structureCache{foldContext.pairedMinimumFreeEnergyV, foldContext.unpairedMinimumFreeEnergyW, foldContext.multibranchMinimumFreeEnergyWM} {
+		for index := range cache.entries {
+			cache.entries[index] = cachedStructure{}
+		}
+	}
+}
+
+// emptyContext returns a context like newContext, but with caches that
+// haven't been filled yet.
+func emptyContext(seq string, temp float64, constraints *foldConstraints, cut int) (context, error) {
+	if err := checkTemperature(temp); err != nil {
+		return context{}, err
+	}
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return context{}, err
+	}
+
+	ret := scoringContext(seq, energyMap, temp+zeroCelsius) // kelvin
+	ret.allocateCaches()
+	ret.constraints = constraints
+	ret.cut = cut
+	if cut > 0 {
+		ret.duplexInitiation = duplexInitiation(energyMap, ret.temp)
+	}
+	return ret, nil
+}
+
+// scoringContext returns a context for scoring the loops of an uppercase seq
+// at temp Kelvin, without the caches needed to fold it.
+func scoringContext(seq string, energyMap energies, temp float64) context {
+	return codedContext(seq, encodeSequence(seq), energyMap, temp)
+}
+
+// codedContext is scoringContext for seq encoded as codes.
+func codedContext(seq string, codes []uint8, energyMap energies, temp float64) context {
+	tableCodes := baseCodes
+	if ambiguous(codes) {
+		tableCodes = allCodes
+	}
+	return context{
+		energies: energyMap,
+		seq:      seq,
+		temp:     temp,
+		codes:    codes,
+		tables:   newEnergyTables(energyMap, temp, tableCodes),
+	}
+}
+
+// sequenceEnergies figures out whether an uppercase seq is DNA or RNA and
+// returns its energy maps. Sequences that are neither, like DNA with a U,
+// are an error giving the position of the first base that doesn't fit.
+func sequenceEnergies(seq string) (energies, error) {
+	alphabet, _, _ := checks.DetectAlphabet(seq)
+	if alphabet != checks.RNA {
+		alphabet = checks.DNA
+	}
+	if err := checks.RequireAlphabet(seq, alphabet); err != nil {
+		return energies{}, err
+	}
+	if alphabet == checks.RNA {
+		return rnaEnergies, nil
+	}
+	return dnaEnergies, nil
+}
+
 // Result holds the resulting structures of the folded s
 type Result struct {
 	structs []nucleicAcidStructure
+	// length is the length of the sequence folded, of both strands for a
+	// CoFold.
+	length int
+	// cut and monomerEnergy are set by CoFold: the index of the first base
+	// of the second strand, and the summed minimum free energies of each
+	// strand folded on its own.
+	cut           int
+	monomerEnergy float64
 }
 
 // DotBracket returns the dot-bracket notation of the secondary nucleic acid
@@ -202,20 +413,32 @@ type Result struct {
 // Dot-bracket notation, consisting in a balanced parentheses string composed
 // by a three-character alphabet {.,(,)}, that can be unambiguously converted
 // in the RNA secondary structure. See example_test.go for a small example.
+//
+// It has a character for every base of the sequence folded, so a sequence
+// with no structure is all dots.
+//
+// The structure of two strands folded by CoFold has an "&" between the
+// strands, like "((((&))))", and covers the whole of both.
 func (r Result) DotBracket() string {
-	if len(r.structs) == 0 {
-		return ""
+	if r.cut == 0 {
+		return r.dotBracket()
 	}
-	lastStructEnd := 0
+	strandA, strandB := r.Strands()
+	return strandA + "&" + strandB
+}
+
+// dotBracket is DotBracket without the "&" between strands, so that its
+// indexes are those of the sequence folded.
+func (r Result) dotBracket() string {
+	length := r.length
 	for _, structure := range r.structs {
 		for _, innerSubsequence := range structure.inner {
-			if innerSubsequence.end > lastStructEnd {
-				lastStructEnd = innerSubsequence.end
+			if innerSubsequence.end >= length {
+				length = innerSubsequence.end + 1
 			}
 		}
 	}
-	lastStructEnd += 1
-	result := make([]byte, lastStructEnd)
+	result := make([]byte, length)
 	for i := range result {
 		result[i] = '.'
 	}
@@ -229,6 +452,22 @@ func (r Result) DotBracket() string {
 	return string(result)
 }
 
+// Pairs returns the 0 indexed bases that pair with each other, each as
+// (i, j) with i < j, sorted by i. Unpaired bases aren't in any pair. The
+// indexes of a CoFold are those of both strands joined together.
+func (r Result) Pairs() [][2]int {
+	var pairs [][2]int
+	for _, structure := range r.structs {
+		if len(structure.inner) == 1 {
+			pairs = append(pairs, [2]int{structure.inner[0].start, structure.inner[0].end})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i][0] < pairs[j][0]
+	})
+	return pairs
+}
+
 // MinimumFreeEnergy return just the delta G of the structures resulting from
 // folding a sequence.
 //
@@ -0,0 +1,152 @@
+package fold
+
+import "strings"
+
+/******************************************************************************
+
+Structure elements begin here
+
+A Result is a list of loops, each with a free energy, that add up to its
+minimum free energy. Structures exports them as StructureElements, so a
+caller can report the hairpin at 34-52 and its energy rather than
+re-deriving it from the dot-bracket.
+
+The kind of each loop is read off its pairs rather than its description:
+a loop closed by a pair that encloses no other pair is a hairpin, one that
+encloses exactly one pair is a stack, bulge or interior loop depending on
+which sides have unpaired bases, and one that encloses more is a
+multibranch loop. Stacks whose energy includes a dangling end, at the ends
+of the sequence, are dangling. The exterior loop, which isn't closed by any
+pair, adds nothing and has no element of its own. The loop through the
+origin of a FoldCircular and the loop holding the cut between the two
+strands of a CoFold are exterior elements.
+
+******************************************************************************/
+
+// ElementKind is the kind of loop of a StructureElement.
+type ElementKind int
+
+const (
+	// StackElement is two pairs stacked next to each other in a helix.
+	StackElement ElementKind = iota
+	// HairpinElement is a loop closed by one pair.
+	HairpinElement
+	// BulgeElement is two pairs with unpaired bases on one side between them.
+	BulgeElement
+	// InteriorElement is two pairs with unpaired bases on both sides between them.
+	InteriorElement
+	// MultibranchElement is a loop closed by one pair with two or more
+	// helices branching off it.
+	MultibranchElement
+	// DanglingElement is a stack at an end of the sequence, including the
+	// energy of the unpaired base dangling off it.
+	DanglingElement
+	// ExteriorElement is the loop through the origin of a circular
+	// sequence, or the loop holding the cut between two strands.
+	ExteriorElement
+)
+
+// String returns the name of kind, like "hairpin".
+func (kind ElementKind) String() string {
+	switch kind {
+	case StackElement:
+		return "stack"
+	case HairpinElement:
+		return "hairpin"
+	case BulgeElement:
+		return "bulge"
+	case InteriorElement:
+		return "interior"
+	case MultibranchElement:
+		return "multibranch"
+	case DanglingElement:
+		return "dangling"
+	case ExteriorElement:
+		return "exterior"
+	}
+	return "unknown"
+}
+
+// StructureElement is one loop of a folded structure.
+type StructureElement struct {
+	Kind ElementKind
+	// Ranges are the 0 indexed, inclusive start and end of the pairs of the
+	// loop. The pair closing it comes first, followed by the pairs inside
+	// it. The loop through the origin has only the pairs inside it.
+	Ranges [][2]int
+	// Description is the description of the loop from folding, like
+	// "HAIRPIN:GA/CA" or "BULGE:2".
+	Description string
+	// Energy is the free energy of the loop in kcal/mol.
+	Energy float64
+}
+
+// Structures returns the loops of the structure, whose energies add up to
+// its MinimumFreeEnergy, in the order they were traced back.
+func (r Result) Structures() []StructureElement {
+	dotBracket := r.dotBracket()
+	pairedWith := pairTable(dotBracket, len(dotBracket))
+
+	elements := make([]StructureElement, 0, len(r.structs))
+	for _, structure := range r.structs {
+		element := StructureElement{Description: structure.description, Energy: structure.energy}
+		if len(structure.inner) != 1 {
+			// the loop through the origin of a circular sequence
+			element.Kind = ExteriorElement
+			element.Ranges = enclosedPairs(0, len(dotBracket), pairedWith)
+			elements = append(elements, element)
+			continue
+		}
+
+		start, end := structure.inner[0].start, structure.inner[0].end
+		enclosed := enclosedPairs(start+1, end, pairedWith)
+		element.Ranges = append([][2]int{{start, end}}, enclosed...)
+		switch {
+		case r.cut > 0 && start < r.cut && r.cut <= end && !enclosesCut(enclosed, r.cut):
+			element.Kind = ExteriorElement
+		case len(enclosed) == 0:
+			element.Kind = HairpinElement
+		case len(enclosed) > 1:
+			element.Kind = MultibranchElement
+		default:
+			unpairedLeft := enclosed[0][0] - start - 1
+			unpairedRight := end - enclosed[0][1] - 1
+			switch {
+			case unpairedLeft > 0 && unpairedRight > 0:
+				element.Kind = InteriorElement
+			case unpairedLeft > 0 || unpairedRight > 0:
+				element.Kind = BulgeElement
+			case strings.HasPrefix(structure.description, "STACKDanglingEnds"):
+				element.Kind = DanglingElement
+			default:
+				element.Kind = StackElement
+			}
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// enclosedPairs returns the pairs from start up to end that aren't inside
+// other pairs in that range.
+func enclosedPairs(start, end int, pairedWith []int) [][2]int {
+	var pairs [][2]int
+	for index := start; index < end; index++ {
+		if partner := pairedWith[index]; partner > index && partner < end {
+			pairs = append(pairs, [2]int{index, partner})
+			index = partner
+		}
+	}
+	return pairs
+}
+
+// enclosesCut returns true if the cut between two strands is inside one of
+// pairs.
+func enclosesCut(pairs [][2]int, cut int) bool {
+	for _, pair := range pairs {
+		if pair[0] < cut && cut <= pair[1] {
+			return true
+		}
+	}
+	return false
+}
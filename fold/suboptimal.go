@@ -0,0 +1,362 @@
+package fold
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+
+Suboptimal structures begin here
+
+Zuker returns the single structure with the lowest free energy, but energy
+parameters are only accurate to a kcal/mol or so, and a structure slightly
+above the minimum is often the one that matters: the one a riboswitch
+switches to, or the one that hides a primer's binding site. Suboptimal
+returns every structure within some energy of the minimum.
+
+It uses the backtracking of Wuchty et al. 1999 (doi:10.1002/(SICI)1097-
+0282(199902)49:2<145::AID-BIP4>3.0.CO;2-G) over the caches Zuker fills.
+A partial structure is a list of loops already chosen and a list of
+subsequences not yet folded, each of which is either unpaired,
+unpairedMinimumFreeEnergyW, part of a multibranch loop,
+multibranchMinimumFreeEnergyWM, or closed by a pair,
+pairedMinimumFreeEnergyV. Loops are scored exactly as Zuker and Evaluate
+score them.
+The caches hold the lowest energy each of those can reach, so the lowest
+energy any completion of a partial structure can reach is known exactly,
+and partial structures that can't get within the energy range are dropped.
+
+The recursions of W and WM are ambiguous, in that the same structure can
+be reached by trimming unpaired bases off either end first, or by splitting
+a loop at any base between two branches. Partial structures are
+expanded lowest energy first, and one that has been seen before is
+skipped, so every structure is found once, and structures come out sorted
+by energy.
+
+******************************************************************************/
+
+// DefaultMaxStructures is the most structures Suboptimal returns unless
+// changed with WithMaxStructures.
+const DefaultMaxStructures = 1000
+
+// SuboptimalOption changes how Suboptimal enumerates structures.
+type SuboptimalOption func(*suboptimalOptions)
+
+type suboptimalOptions struct {
+	maxStructures int
+}
+
+// WithMaxStructures sets the most structures Suboptimal returns. The
+// number of structures within a few kcal/mol of the minimum grows
+// exponentially with sequence length, so this keeps long or repetitive
+// sequences from using all of memory.
+func WithMaxStructures(maxStructures int) SuboptimalOption {
+	return func(options *suboptimalOptions) {
+		options.maxStructures = maxStructures
+	}
+}
+
+// Suboptimal folds seq at temp Celsius and returns every structure whose free
+// energy is within energyDelta kcal/mol of the minimum, sorted by energy
+// with the minimum free energy structure first. Each structure is returned
+// once, and at most DefaultMaxStructures are returned unless changed with
+// WithMaxStructures. A sequence that can't form any base pair has no
+// structures.
+func Suboptimal(seq string, temp float64, energyDelta float64, options ...SuboptimalOption) ([]Result, error) {
+	settings := suboptimalOptions{maxStructures: DefaultMaxStructures}
+	for _, option := range options {
+		option(&settings)
+	}
+	if energyDelta < 0 || math.IsNaN(energyDelta) {
+		return nil, fmt.Errorf("suboptimal: energy delta must be at least 0, got %f", energyDelta)
+	}
+	if settings.maxStructures < 1 {
+		return nil, fmt.Errorf("suboptimal: max structures must be at least 1, got %d", settings.maxStructures)
+	}
+	if len(seq) == 0 {
+		return nil, errors.New("suboptimal: empty sequence")
+	}
+	foldContext, err := newFoldingContext(seq, temp)
+	if err != nil {
+		return nil, fmt.Errorf("suboptimal: %w", err)
+	}
+
+	whole := suboptimalTask{start: 0, end: len(seq) - 1}
+	minimum, err := whole.minimumFreeEnergy(foldContext)
+	if err != nil {
+		return nil, fmt.Errorf("suboptimal: %w", err)
+	}
+	if math.IsInf(minimum, 0) {
+		return nil, nil
+	}
+	limit := minimum + energyDelta
+	// floating point sums of the same loops in different orders differ slightly.
+	const tolerance = 1e-9
+
+	var results []Result
+	found := make(map[string]bool)
+	seen := make(map[string]bool)
+	states := &suboptimalHeap{{bound: minimum, pending: []suboptimalTask{whole}}}
+	for states.Len() > 0 && len(results) < settings.maxStructures {
+		state := heap.Pop(states).(suboptimalState)
+		key := state.key(len(seq))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if len(state.pending) == 0 {
+			result := Result{structs: multibranchLoops(state.structs, foldContext), length: len(seq)}
+			structure := result.DotBracket()
+			if !found[structure] {
+				found[structure] = true
+				results = append(results, result)
+			}
+			continue
+		}
+
+		task := state.pending[len(state.pending)-1]
+		rest := state.pending[:len(state.pending)-1]
+		taskEnergy, err := task.minimumFreeEnergy(foldContext)
+		if err != nil {
+			return nil, fmt.Errorf("suboptimal: %w", err)
+		}
+		alternatives, err := task.alternatives(foldContext)
+		if err != nil {
+			return nil, fmt.Errorf("suboptimal: %w", err)
+		}
+		for _, alternative := range alternatives {
+			bound := state.bound - taskEnergy + alternative.energy
+			for _, child := range alternative.children {
+				childEnergy, err := child.minimumFreeEnergy(foldContext)
+				if err != nil {
+					return nil, fmt.Errorf("suboptimal: %w", err)
+				}
+				bound += childEnergy
+			}
+			if math.IsInf(bound, 0) || math.IsNaN(bound) || bound > limit+tolerance {
+				continue
+			}
+			next := suboptimalState{bound: bound, structs: state.structs}
+			if len(alternative.structure.inner) > 0 {
+				next.structs = append(append([]nucleicAcidStructure{}, state.structs...), alternative.structure)
+			}
+			next.pending = append(append([]suboptimalTask{}, rest...), alternative.children...)
+			heap.Push(states, next)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].MinimumFreeEnergy() < results[j].MinimumFreeEnergy()
+	})
+	return results, nil
+}
+
+// suboptimalTask is a subsequence of a partial structure that hasn't been
+// folded yet. If paired is true, its ends pair with each other, and if
+// multibranch is true, it's part of a multibranch loop.
+type suboptimalTask struct {
+	paired, multibranch bool
+	start, end          int
+}
+
+// minimumFreeEnergy returns the lowest energy the subsequence can fold to.
+func (task suboptimalTask) minimumFreeEnergy(foldContext context) (float64, error) {
+	var structure cachedStructure
+	var err error
+	switch {
+	case task.paired:
+		structure, err = pairedMinimumFreeEnergyV(task.start, task.end, foldContext)
+	case task.multibranch:
+		structure, err = multibranchMinimumFreeEnergyWM(task.start, task.end, foldContext)
+	default:
+		structure, err = unpairedMinimumFreeEnergyW(task.start, task.end, foldContext)
+	}
+	return structure.energy, err
+}
+
+// suboptimalAlternative is one way to fold a suboptimalTask: the energy it
+// adds, the loop it closes, if any, and the subsequences inside it left to
+// fold.
+type suboptimalAlternative struct {
+	energy    float64
+	structure nucleicAcidStructure
+	children  []suboptimalTask
+}
+
+// alternatives returns every way the recursions of Zuker can fold the
+// subsequence of task.
+func (task suboptimalTask) alternatives(foldContext context) ([]suboptimalAlternative, error) {
+	switch {
+	case task.paired:
+		return pairedAlternatives(task.start, task.end, foldContext)
+	case task.multibranch:
+		return multibranchAlternatives(task.start, task.end, foldContext), nil
+	}
+	return unpairedAlternatives(task.start, task.end), nil
+}
+
+// unpairedAlternatives returns the alternatives unpairedMinimumFreeEnergyW
+// chooses between for start and end.
+func unpairedAlternatives(start, end int) []suboptimalAlternative {
+	if end-start < minLenForStruct {
+		return nil
+	}
+	alternatives := []suboptimalAlternative{
+		{children: []suboptimalTask{{start: start + 1, end: end}}},
+		{children: []suboptimalTask{{start: start, end: end - 1}}},
+		{children: []suboptimalTask{{paired: true, start: start, end: end}}},
+	}
+	for mid := start + 1; mid < end-1; mid++ {
+		alternatives = append(alternatives, suboptimalAlternative{children: []suboptimalTask{{start: start, end: mid}, {start: mid + 1, end: end}}})
+	}
+	return alternatives
+}
+
+// multibranchAlternatives returns the alternatives
+// multibranchMinimumFreeEnergyWM chooses between for start and end.
+func multibranchAlternatives(start, end int, foldContext context) []suboptimalAlternative {
+	if end-start < minLenForStruct {
+		return nil
+	}
+	multibranch := foldContext.energies.multibranch
+	alternatives := []suboptimalAlternative{
+		{energy: multibranch.unpairedCount, children: []suboptimalTask{{paired: true, start: start, end: end}}},
+		{energy: multibranch.coaxialStackCount, children: []suboptimalTask{{multibranch: true, start: start + 1, end: end}}},
+		{energy: multibranch.coaxialStackCount, children: []suboptimalTask{{multibranch: true, start: start, end: end - 1}}},
+	}
+	for mid := start + 1; mid < end-1; mid++ {
+		alternatives = append(alternatives, suboptimalAlternative{children: []suboptimalTask{{multibranch: true, start: start, end: mid}, {multibranch: true, start: mid + 1, end: end}}})
+	}
+	return alternatives
+}
+
+// pairedAlternatives returns the alternatives pairedMinimumFreeEnergyV
+// chooses between for start and end. Each has the pair of start and end.
+func pairedAlternatives(start, end int, foldContext context) ([]suboptimalAlternative, error) {
+	seq := foldContext.seq
+	if !foldContext.canPair(start, end) {
+		return nil, nil
+	}
+	closing := []subsequence{{start: start, end: end}}
+	if isolated(start, end, foldContext) {
+		return []suboptimalAlternative{{energy: isolatedBasePairPenalty, structure: nucleicAcidStructure{energy: isolatedBasePairPenalty, description: "ISOLATED", inner: closing}}}, nil
+	}
+
+	hairpinEnergy, err := hairpin(start, end, foldContext)
+	if err != nil {
+		return nil, err
+	}
+	alternatives := []suboptimalAlternative{{energy: hairpinEnergy, structure: nucleicAcidStructure{energy: hairpinEnergy, description: "HAIRPIN:" + pair(seq, start, start+1, end, end-1), inner: closing}}}
+	if end-start == minLenForStruct {
+		return alternatives, nil
+	}
+
+	for rightOfStart := start + 1; rightOfStart < end-minLenForStruct; rightOfStart++ {
+		for leftOfEnd := rightOfStart + minLenForStruct; leftOfEnd < end; leftOfEnd++ {
+			if !foldContext.canPair(rightOfStart, leftOfEnd) {
+				continue
+			}
+			energy, ok, err := interiorLoopEnergy(start, rightOfStart, end, leftOfEnd, foldContext)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			description := fmt.Sprintf("INTERIOR_LOOP:%d/%d", rightOfStart-start, end-leftOfEnd)
+			switch {
+			case rightOfStart == start+1 && leftOfEnd == end-1:
+				description = "STACK:" + pair(seq, start, rightOfStart, end, leftOfEnd)
+			case leftOfEnd == end-1:
+				description = fmt.Sprintf("BULGE:%d", rightOfStart-start)
+			case rightOfStart == start+1:
+				description = fmt.Sprintf("BULGE:%d", end-leftOfEnd)
+			}
+			alternatives = append(alternatives, suboptimalAlternative{
+				energy:    energy,
+				structure: nucleicAcidStructure{energy: energy, description: description, inner: closing},
+				children:  []suboptimalTask{{paired: true, start: rightOfStart, end: leftOfEnd}},
+			})
+		}
+	}
+
+	// the branches of a multibranch loop aren't known until they're folded,
+	// so multibranchLoops fills in its energy and description once they are.
+	multibranch := foldContext.energies.multibranch
+	for mid := start + 1; mid < end-1; mid++ {
+		alternatives = append(alternatives, suboptimalAlternative{
+			energy:    multibranch.helicesCount + multibranch.unpairedCount,
+			structure: nucleicAcidStructure{description: "BIFURCATION", inner: closing},
+			children:  []suboptimalTask{{multibranch: true, start: start + 1, end: mid}, {multibranch: true, start: mid + 1, end: end - 1}},
+		})
+	}
+	return alternatives, nil
+}
+
+// multibranchLoops returns a copy of the loops of a structure, structs,
+// with the energy and description of its multibranch loops, which are only
+// known once all their branches are.
+func multibranchLoops(structs []nucleicAcidStructure, foldContext context) []nucleicAcidStructure {
+	structs = append([]nucleicAcidStructure{}, structs...)
+	pairedWith := pairTable(Result{structs: structs, length: len(foldContext.seq)}.dotBracket(), len(foldContext.seq))
+	for index, structure := range structs {
+		if structure.description != "BIFURCATION" {
+			continue
+		}
+		start, end := structure.inner[0].start, structure.inner[0].end
+		var branches []subsequence
+		unpaired := end - start - 1
+		for _, branch := range enclosedPairs(start+1, end, pairedWith) {
+			branches = append(branches, subsequence{branch[0], branch[1]})
+			unpaired -= branch[1] - branch[0] + 1
+		}
+		structs[index].energy = multibranchLoopEnergy(start, end, branches, foldContext)
+		structs[index].description = fmt.Sprintf("BIFURCATION:%dn/%dh", unpaired, len(branches)+1)
+	}
+	return structs
+}
+
+// suboptimalState is a partial structure.
+type suboptimalState struct {
+	// bound is the lowest energy any completion of the state can have.
+	bound   float64
+	structs []nucleicAcidStructure
+	pending []suboptimalTask
+}
+
+// key returns a string that is the same for two states only if they have
+// the same pairs and the same subsequences left to fold.
+func (state suboptimalState) key(length int) string {
+	structure := []byte(strings.Repeat(".", length))
+	for _, loop := range state.structs {
+		for _, inner := range loop.inner {
+			structure[inner.start], structure[inner.end] = '(', ')'
+		}
+	}
+	pending := make([]string, len(state.pending))
+	for index, task := range state.pending {
+		pending[index] = fmt.Sprintf("%t:%t:%d:%d", task.paired, task.multibranch, task.start, task.end)
+	}
+	sort.Strings(pending)
+	return string(structure) + "|" + strings.Join(pending, ",")
+}
+
+// suboptimalHeap is a min heap of partial structures by their bound.
+type suboptimalHeap []suboptimalState
+
+func (h suboptimalHeap) Len() int            { return len(h) }
+func (h suboptimalHeap) Less(i, j int) bool  { return h[i].bound < h[j].bound }
+func (h suboptimalHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *suboptimalHeap) Push(x interface{}) { *h = append(*h, x.(suboptimalState)) }
+func (h *suboptimalHeap) Pop() interface{} {
+	old := *h
+	state := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return state
+}
@@ -0,0 +1,302 @@
+package fold
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+
+Window scanning begins here
+
+Folding a whole plasmid or mRNA at once is both too slow and not what is
+usually wanted: structured elements like riboswitches, terminators and IRESs
+are local, and base pairs hundreds of bases apart are rarely real. ScanWindows
+folds overlapping windows instead, so the window size is the longest base
+pair span allowed, and windows are folded concurrently.
+
+A low MFE on its own mostly says a window is GC rich. The standard test for
+a structured RNA (Clote et al. 2005, doi:10.1261/rna.7211505) compares a
+window's MFE to the MFEs of shuffles of it that keep its dinucleotides,
+which keep its composition and stacking energies but not its structure:
+
+	z = (MFE - mean of shuffled MFEs) / standard deviation of shuffled MFEs
+
+A z-score of -2 or below means the window folds better than almost all of
+its shuffles. Shuffles are seeded by the window's position, so scans are
+reproducible however many workers run them.
+
+FoldWindows is the quick version for long constructs, like scanning 10 kb
+for hairpins strong enough to get in the way of synthesis: it only folds
+each window, without shuffles, on one worker per CPU. Every window is the
+same size, so each worker allocates its caches once and empties them
+between windows rather than making new ones for each.
+
+******************************************************************************/
+
+// WindowResult is the fold of one window of a sequence.
+type WindowResult struct {
+	Start, End        int     // Start and End are the 0 indexed, end exclusive position of the window.
+	MinimumFreeEnergy float64 // MinimumFreeEnergy is the MFE of the window in kcal/mol.
+	NormalizedEnergy  float64 // NormalizedEnergy is the MFE per base, in kcal/mol/nt.
+	ZScore            float64 // ZScore compares the MFE to the MFEs of dinucleotide shuffles of the window.
+	DotBracket        string  // DotBracket is the MFE structure of the window.
+	Error             error   // Error is why the window couldn't be folded, like an ambiguous base.
+}
+
+// ScanOption changes how ScanWindows scores windows.
+type ScanOption func(*scanOptions)
+
+type scanOptions struct {
+	shuffles int
+	seed     int64
+}
+
+// DefaultScanShuffles is how many shuffles of each window ScanWindows folds
+// to compute its z-score.
+const DefaultScanShuffles = 20
+
+// WithShuffles sets how many dinucleotide shuffles of each window are folded
+// for its z-score. 0 skips them, leaving every z-score 0.
+func WithShuffles(shuffles int) ScanOption {
+	return func(options *scanOptions) {
+		options.shuffles = shuffles
+	}
+}
+
+// WithSeed sets the seed the shuffles of each window are derived from.
+func WithSeed(seed int64) ScanOption {
+	return func(options *scanOptions) {
+		options.seed = seed
+	}
+}
+
+// ScanWindows folds every windowSize window of seq, starting every step
+// bases, at temp Celsius, using workers goroutines. A last window ending at
+// the end of seq is added if the steps don't reach it, and a windowSize less
+// than 1 folds seq as one window. Results are in order of Start, and there
+// are none if seq is empty or shorter than windowSize. Each window's z-score
+// is computed against DefaultScanShuffles dinucleotide shuffles unless
+// changed with WithShuffles.
+func ScanWindows(seq string, windowSize, step int, temp float64, workers int, options ...ScanOption) []WindowResult {
+	settings := scanOptions{shuffles: DefaultScanShuffles}
+	for _, option := range options {
+		option(&settings)
+	}
+	if len(seq) == 0 || windowSize > len(seq) {
+		return []WindowResult{}
+	}
+	if windowSize < 1 {
+		windowSize = len(seq)
+	}
+	if step < 1 {
+		step = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	windows := windowBounds(len(seq), windowSize, step)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				window := &windows[index]
+				foldWindow(window, seq[window.Start:window.End], temp, settings)
+			}
+		}()
+	}
+	for index := range windows {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return windows
+}
+
+// windowBounds returns the windowSize windows of a sequence of length bases,
+// starting every step bases, with a last window ending at the end of the
+// sequence if the steps don't reach it.
+func windowBounds(length, windowSize, step int) []WindowResult {
+	var windows []WindowResult
+	for start := 0; start+windowSize <= length; start += step {
+		windows = append(windows, WindowResult{Start: start, End: start + windowSize})
+	}
+	if len(windows) > 0 && windows[len(windows)-1].End < length {
+		windows = append(windows, WindowResult{Start: length - windowSize, End: length})
+	}
+	return windows
+}
+
+// FoldWindows folds every windowSize window of seq, starting every stepSize
+// bases, at temp Celsius, with as many goroutines as there are CPUs. Windows
+// are placed as in ScanWindows and each is folded on its own, as Zuker
+// would fold it, but only their Start, End, MinimumFreeEnergy,
+// NormalizedEnergy and DotBracket are set. Results are in order of Start,
+// and like ScanWindows there are none if seq is shorter than windowSize.
+//
+// Unlike ScanWindows, it returns an error rather than folding what it can:
+// if seq isn't DNA or RNA, windowSize or stepSize is less than 1, or temp is
+// out of range.
+func FoldWindows(seq string, temp float64, windowSize, stepSize int) ([]WindowResult, error) {
+	if len(seq) == 0 {
+		return nil, errors.New("fold windows: empty sequence")
+	}
+	if windowSize < 1 || stepSize < 1 {
+		return nil, fmt.Errorf("fold windows: window size %d and step size %d must be at least 1", windowSize, stepSize)
+	}
+	if err := checkTemperature(temp); err != nil {
+		return nil, fmt.Errorf("fold windows: %w", err)
+	}
+	seq = strings.ToUpper(seq)
+	energyMap, err := sequenceEnergies(seq)
+	if err != nil {
+		return nil, fmt.Errorf("fold windows: %w", err)
+	}
+	if windowSize > len(seq) {
+		return []WindowResult{}, nil
+	}
+
+	windows := windowBounds(len(seq), windowSize, stepSize)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(windows) {
+		workers = len(windows)
+	}
+	// the energy tables only depend on the energies and temperature, so
+	// every worker shares them.
+	shared := scoringContext(seq[:windowSize], energyMap, temp+zeroCelsius)
+	indexes := make(chan int)
+	errs := make([]error, len(windows))
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			foldContext := shared
+			foldContext.allocateCaches()
+			for index := range indexes {
+				window := &windows[index]
+				foldContext.seq = seq[window.Start:window.End]
+				foldContext.codes = encodeSequence(foldContext.seq)
+				foldContext.clearCaches()
+				if _, err := unpairedMinimumFreeEnergyW(0, windowSize-1, foldContext); err != nil {
+					errs[index] = fmt.Errorf("fold windows: window %d-%d: %w", window.Start, window.End, err)
+					continue
+				}
+				result := Result{length: windowSize}
+				if foldContext.unpairedMinimumFreeEnergyW.get(0, windowSize-1).Valid() {
+					result.structs = traceback(0, windowSize-1, foldContext)
+				}
+				window.MinimumFreeEnergy = windowEnergy(result)
+				window.NormalizedEnergy = window.MinimumFreeEnergy / float64(windowSize)
+				window.DotBracket = result.DotBracket()
+			}
+		}()
+	}
+	for index := range windows {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return windows, nil
+}
+
+// foldWindow folds seq, the bases of window, and scores it against its
+// shuffles.
+func foldWindow(window *WindowResult, seq string, temp float64, settings scanOptions) {
+	result, err := Zuker(seq, temp)
+	if err != nil {
+		window.Error = fmt.Errorf("window %d-%d: %w", window.Start, window.End, err)
+		return
+	}
+	window.MinimumFreeEnergy = windowEnergy(result)
+	window.NormalizedEnergy = window.MinimumFreeEnergy / float64(len(seq))
+	window.DotBracket = result.DotBracket()
+	if settings.shuffles < 2 {
+		return
+	}
+
+	energies := make([]float64, settings.shuffles)
+	mean := 0.0
+	for shuffle := range energies {
+		shuffled, err := transform.ShufflePreservingKmers(seq, 2, settings.seed+int64(window.Start)*int64(settings.shuffles)+int64(shuffle))
+		if err != nil {
+			window.Error = fmt.Errorf("window %d-%d: %w", window.Start, window.End, err)
+			return
+		}
+		shuffledResult, err := Zuker(shuffled, temp)
+		if err != nil {
+			window.Error = fmt.Errorf("window %d-%d: %w", window.Start, window.End, err)
+			return
+		}
+		energies[shuffle] = windowEnergy(shuffledResult)
+		mean += energies[shuffle]
+	}
+	mean /= float64(len(energies))
+	variance := 0.0
+	for _, energy := range energies {
+		variance += (energy - mean) * (energy - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(energies)-1))
+	if stdev > 0 {
+		window.ZScore = (window.MinimumFreeEnergy - mean) / stdev
+	}
+}
+
+// windowEnergy returns the MFE of a result, or 0 if nothing folded.
+func windowEnergy(result Result) float64 {
+	energy := result.MinimumFreeEnergy()
+	if math.IsInf(energy, 0) {
+		return 0
+	}
+	return energy
+}
+
+// WriteBedGraph writes a value of each window, picked by value, to w as a
+// bedGraph track on chrom. bedGraph intervals can't overlap, so each
+// window's value covers the step bases at its middle, where step is the
+// distance between the starts of the first two windows. Windows with an
+// Error are skipped.
+func WriteBedGraph(w io.Writer, chrom string, windows []WindowResult, value func(WindowResult) float64) error {
+	writer := bufio.NewWriter(w)
+	step := 0
+	if len(windows) > 1 {
+		step = windows[1].Start - windows[0].Start
+	}
+	previousEnd := 0
+	for _, window := range windows {
+		start, end := window.Start, window.End
+		if step > 0 && step < end-start {
+			start += (end - start - step) / 2
+			end = start + step
+		}
+		// the last window may be closer to the one before it.
+		if start < previousEnd {
+			start = previousEnd
+		}
+		if window.Error != nil || start >= end {
+			continue
+		}
+		if _, err := fmt.Fprintf(writer, "%s\t%d\t%d\t%g\n", chrom, start, end, value(window)); err != nil {
+			return err
+		}
+		previousEnd = end
+	}
+	return writer.Flush()
+}
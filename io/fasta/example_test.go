@@ -112,3 +112,14 @@ func ExampleParser() {
 	// MCHU - Calmodulin - Human, rabbit, bovine, rat, and chicken
 	// EOF
 }
+
+// ExampleOpenIndexed shows how to fetch a region of a large fasta file
+// without reading the whole thing.
+func ExampleOpenIndexed() {
+	indexed, _ := fasta.OpenIndexed("data/indexed.fasta")
+	defer indexed.Close()
+
+	region, _ := indexed.Fetch("chr1", 8, 14)
+	fmt.Println(region)
+	// Output: ACGTac
+}
@@ -0,0 +1,274 @@
+package fasta
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/******************************************************************************
+Indexed Fasta begins here
+
+Parsing a whole genome just to look at a couple hundred base pairs gets old
+fast, especially when a pipeline does it thousands of times against a 3GB
+reference. The samtools folks solved this ages ago with the .fai index, which
+records where each sequence starts in the file and how its lines are wrapped.
+With that we can jump straight to the bytes we want.
+
+IndexedFasta memory maps the file where the platform supports it so fetches
+are just slicing and newline stripping. Everywhere else (or if mapping fails)
+it falls back to positional reads (pread) on the open file. Both are safe to
+use from many goroutines at once.
+
+If there is no .fai next to the fasta we build the index in memory, which
+costs one pass over the file. Write it out with WriteIndex if you'll open the
+file again.
+
+******************************************************************************/
+
+var (
+	errIndexedFastaClosed = errors.New("indexed fasta is closed")
+	mmapFn                = mmapFile
+)
+
+// IndexRecord is a single line of a samtools style .fai index.
+type IndexRecord struct {
+	Name      string // Name is the first word of the fasta header.
+	Length    int64  // Length is the number of bases in the sequence.
+	Offset    int64  // Offset is the byte offset of the sequence's first base.
+	LineBases int64  // LineBases is the number of bases on each full line.
+	LineWidth int64  // LineWidth is the number of bytes on each full line, including the newline.
+}
+
+// ReadIndex parses a samtools style .fai index.
+func ReadIndex(r io.Reader) ([]IndexRecord, error) {
+	var records []IndexRecord
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Text()) == 0 {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("fai line %d: expected 5 fields, got %d", line, len(fields))
+		}
+		var values [4]int64
+		for i := range values {
+			value, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("fai line %d: %w", line, err)
+			}
+			values[i] = value
+		}
+		records = append(records, IndexRecord{Name: fields[0], Length: values[0], Offset: values[1], LineBases: values[2], LineWidth: values[3]})
+	}
+	return records, scanner.Err()
+}
+
+// WriteIndex writes records as a samtools style .fai index.
+func WriteIndex(records []IndexRecord, w io.Writer) error {
+	for _, record := range records {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", record.Name, record.Length, record.Offset, record.LineBases, record.LineWidth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildIndex builds a samtools style .fai index by scanning a fasta file.
+// Every line of a sequence but the last must have the same length, as
+// random access relies on it.
+func BuildIndex(r io.Reader) ([]IndexRecord, error) {
+	var (
+		records    []IndexRecord
+		record     *IndexRecord
+		offset     int64
+		lineNumber int
+		lastLine   bool // set once a sequence line shorter than LineBases is seen
+	)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		lineNumber++
+		lineOffset := offset
+		offset += int64(len(line))
+		bases := int64(len(bytes.TrimRight(line, "\r\n")))
+
+		switch {
+		case line[0] == '>':
+			name := strings.Fields(string(line[1:]))
+			if len(name) == 0 {
+				return nil, fmt.Errorf("line %d: empty fasta name", lineNumber)
+			}
+			records = append(records, IndexRecord{Name: name[0], Offset: offset})
+			record = &records[len(records)-1]
+			lastLine = false
+		case bases == 0 || line[0] == ';':
+			// anything after a gap inside a sequence would break the offset math.
+			if record != nil && record.LineBases > 0 {
+				lastLine = true
+			}
+			continue
+		case record == nil:
+			return nil, fmt.Errorf("line %d: did not find fasta start '>'", lineNumber)
+		default:
+			if record.LineBases == 0 {
+				record.Offset = lineOffset
+				record.LineBases = bases
+				record.LineWidth = int64(len(line))
+			} else if lastLine || bases > record.LineBases {
+				return nil, fmt.Errorf("line %d: inconsistent line length in %q", lineNumber, record.Name)
+			}
+			lastLine = bases < record.LineBases
+			record.Length += bases
+		}
+	}
+	return records, nil
+}
+
+// IndexedFasta provides random access to the sequences of a fasta file
+// without loading it into memory. It is initialized with OpenIndexed and
+// is safe for concurrent use.
+type IndexedFasta struct {
+	mu      sync.RWMutex
+	file    *os.File
+	data    []byte // memory mapped file contents, nil when using pread
+	unmap   func() error
+	records map[string]IndexRecord
+	names   []string
+}
+
+// OpenIndexed opens a fasta file for random access. It uses the index at
+// path+".fai" if there is one, otherwise it indexes the file itself.
+func OpenIndexed(path string) (*IndexedFasta, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []IndexRecord
+	indexFile, err := openFn(path + ".fai")
+	switch {
+	case err == nil:
+		records, err = ReadIndex(indexFile)
+		indexFile.Close()
+	case errors.Is(err, os.ErrNotExist):
+		records, err = BuildIndex(bufio.NewReader(file))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	indexed := &IndexedFasta{file: file, records: make(map[string]IndexRecord, len(records))}
+	for _, record := range records {
+		indexed.records[record.Name] = record
+		indexed.names = append(indexed.names, record.Name)
+	}
+
+	// mapping is an optimization, so we quietly fall back to pread on failure.
+	if data, unmap, err := mmapFn(file); err == nil {
+		indexed.data = data
+		indexed.unmap = unmap
+	}
+	return indexed, nil
+}
+
+// Names returns the names of the indexed sequences in file order.
+func (indexed *IndexedFasta) Names() []string {
+	return indexed.names
+}
+
+// Length returns the number of bases in the named sequence.
+func (indexed *IndexedFasta) Length(name string) (int, error) {
+	record, ok := indexed.records[name]
+	if !ok {
+		return 0, fmt.Errorf("sequence %q not in index", name)
+	}
+	return int(record.Length), nil
+}
+
+// Fetch returns the bases of the named sequence from start (inclusive) to
+// end (exclusive), counting from 0. Case is preserved, so soft masked
+// regions come back lowercase.
+func (indexed *IndexedFasta) Fetch(name string, start, end int) (string, error) {
+	record, ok := indexed.records[name]
+	if !ok {
+		return "", fmt.Errorf("sequence %q not in index", name)
+	}
+	if start < 0 || end > int(record.Length) || start > end {
+		return "", fmt.Errorf("range [%d, %d) out of bounds for %q of length %d", start, end, name, record.Length)
+	}
+	if start == end {
+		return "", nil
+	}
+
+	indexed.mu.RLock()
+	defer indexed.mu.RUnlock()
+	if indexed.file == nil {
+		return "", errIndexedFastaClosed
+	}
+
+	first := record.byteOffset(int64(start))
+	last := record.byteOffset(int64(end - 1))
+	var raw []byte
+	if indexed.data != nil {
+		if last >= int64(len(indexed.data)) {
+			return "", fmt.Errorf("index for %q points past the end of the file", name)
+		}
+		raw = indexed.data[first : last+1]
+	} else {
+		raw = make([]byte, last-first+1)
+		if _, err := indexed.file.ReadAt(raw, first); err != nil {
+			return "", err
+		}
+	}
+
+	sequence := make([]byte, 0, end-start)
+	for _, base := range raw {
+		if base != '\n' && base != '\r' {
+			sequence = append(sequence, base)
+		}
+	}
+	return string(sequence), nil
+}
+
+// Close releases the mapping and file backing indexed. Fetches after Close
+// return an error.
+func (indexed *IndexedFasta) Close() error {
+	indexed.mu.Lock()
+	defer indexed.mu.Unlock()
+	if indexed.file == nil {
+		return nil
+	}
+	var err error
+	if indexed.unmap != nil {
+		err = indexed.unmap()
+		indexed.data = nil
+		indexed.unmap = nil
+	}
+	if closeErr := indexed.file.Close(); err == nil {
+		err = closeErr
+	}
+	indexed.file = nil
+	return err
+}
+
+// byteOffset returns the file offset of the base at position in the record.
+func (record IndexRecord) byteOffset(position int64) int64 {
+	return record.Offset + position/record.LineBases*record.LineWidth + position%record.LineBases
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package fasta
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on this platform, so IndexedFasta always falls
+// back to positional reads.
+func mmapFile(file *os.File) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mmap not supported on this platform")
+}
@@ -0,0 +1,200 @@
+package fasta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildIndex(t *testing.T) {
+	fastaFile, err := os.Open("data/indexed.fasta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fastaFile.Close()
+	built, err := BuildIndex(fastaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexFile, err := os.Open("data/indexed.fasta.fai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexFile.Close()
+	read, err := ReadIndex(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, read, built)
+
+	var written bytes.Buffer
+	if err := WriteIndex(built, &written); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := os.ReadFile("data/indexed.fasta.fai")
+	assert.Equal(t, string(expected), written.String())
+}
+
+func TestBuildIndexInconsistentLines(t *testing.T) {
+	for _, content := range []string{
+		">a\nACGT\nACGTA\n",
+		">a\nACGT\nAC\nACGT\n",
+		">a\nACGT\n\nACGT\n",
+		"ACGT\n",
+	} {
+		if _, err := BuildIndex(strings.NewReader(content)); err == nil {
+			t.Errorf("expected error indexing %q", content)
+		}
+	}
+}
+
+func TestIndexedFastaFetch(t *testing.T) {
+	// copy the fasta without its index so that both the .fai and the
+	// in memory index paths are exercised.
+	unindexedPath := filepath.Join(t.TempDir(), "indexed.fasta")
+	content, _ := os.ReadFile("data/indexed.fasta")
+	if err := os.WriteFile(unindexedPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"data/indexed.fasta", unindexedPath} {
+		for _, useMmap := range []bool{true, false} {
+			if useMmap {
+				mmapFn = mmapFile
+			} else {
+				mmapFn = mmapUnsupported
+			}
+			indexed, err := OpenIndexed(path)
+			mmapFn = mmapFile
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, []string{"chr1", "chr2"}, indexed.Names())
+
+			for _, test := range []struct {
+				name       string
+				start, end int
+				expected   string
+			}{
+				{"chr1", 0, 1, "A"},       // first base
+				{"chr1", 22, 23, "G"},     // last base
+				{"chr1", 8, 14, "ACGTac"}, // spanning a line wrap
+				{"chr1", 0, 23, "ACGTACGTACGTacgtACGTACG"},
+				{"chr1", 5, 5, ""},
+				{"chr2", 4, 12, "AAAACCCC"},
+			} {
+				got, err := indexed.Fetch(test.name, test.start, test.end)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, got, "%s:%d-%d", test.name, test.start, test.end)
+			}
+
+			for _, test := range []struct {
+				name       string
+				start, end int
+			}{
+				{"chr1", -1, 2},
+				{"chr1", 20, 24},
+				{"chr1", 5, 4},
+				{"chr3", 0, 1},
+			} {
+				_, err := indexed.Fetch(test.name, test.start, test.end)
+				assert.Error(t, err, "%s:%d-%d", test.name, test.start, test.end)
+			}
+
+			assert.NoError(t, indexed.Close())
+			_, err = indexed.Fetch("chr1", 0, 1)
+			assert.True(t, errors.Is(err, errIndexedFastaClosed), "%v", err)
+			assert.NoError(t, indexed.Close())
+		}
+	}
+}
+
+func TestIndexedFastaConcurrentFetch(t *testing.T) {
+	indexed, err := OpenIndexed("data/indexed.fasta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexed.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				got, err := indexed.Fetch("chr1", 8, 14)
+				if err != nil || got != "ACGTac" {
+					t.Errorf("concurrent fetch got %q, %v", got, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func mmapUnsupported(file *os.File) ([]byte, func() error, error) {
+	return nil, nil, os.ErrInvalid
+}
+
+func writeUniprotFasta(b *testing.B) (string, []IndexRecord) {
+	path := filepath.Join(b.TempDir(), "uniprot.fasta")
+	fastas, err := Parse(strings.NewReader(uniprotFasta))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := Write(fastas, path); err != nil {
+		b.Fatal(err)
+	}
+	file, _ := os.Open(path)
+	defer file.Close()
+	records, err := BuildIndex(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return path, records
+}
+
+func BenchmarkIndexedFetch(b *testing.B) {
+	path, records := writeUniprotFasta(b)
+	indexed, err := OpenIndexed(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer indexed.Close()
+	random := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		record := records[random.Intn(len(records))]
+		if _, err := indexed.Fetch(record.Name, 0, int(record.Length)/2); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNaiveFetch(b *testing.B) {
+	path, records := writeUniprotFasta(b)
+	random := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		record := records[random.Intn(len(records))]
+		fastas, err := Read(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, fasta := range fastas {
+			if strings.Fields(fasta.Name)[0] == record.Name {
+				_ = fasta.Sequence[:record.Length/2]
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package genbank
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TimothyStiles/poly/io/gff"
+)
+
+/******************************************************************************
+
+Feature conversion begins here
+
+Every feature format counts differently:
+
+	GenBank: 1-based, closed.      "10..20" is 11 bases.
+	GFF3:    1-based, closed.      start 10, end 20 is 11 bases.
+	BED:     0-based, half-open.   start 9, end 20 is 11 bases.
+
+Inside poly all three are parsed into 0-based, half-open Locations, so the
+only arithmetic left is in how the formats split up a feature. That
+arithmetic lives here, in one place, so the off-by-ones only have to be
+fixed once:
+
+	- Joined locations become one GFF line per part sharing an ID, or a
+	  single BED12 line with one block per part.
+	- Strand comes from complement() in GenBank and a +/- column elsewhere.
+	- GFF phase is computed from the CDS parts in transcription order.
+	- Fuzzy ends (< and >) cannot be written in GFF or BED and are dropped.
+	  Converting a partial feature out of GenBank and back loses the < and >.
+
+******************************************************************************/
+
+// BEDRecord is a single line of a BED12 file. Coordinates are 0-based and
+// half-open, as in the BED spec.
+type BEDRecord struct {
+	Chrom       string
+	Start       int
+	End         int
+	Name        string
+	Score       int
+	Strand      string
+	ThickStart  int
+	ThickEnd    int
+	ItemRGB     string
+	BlockSizes  []int
+	BlockStarts []int // relative to Start
+}
+
+// String formats record as a BED12 line without a trailing newline.
+func (record BEDRecord) String() string {
+	itemRGB := record.ItemRGB
+	if itemRGB == "" {
+		itemRGB = "0"
+	}
+	return strings.Join([]string{
+		record.Chrom,
+		strconv.Itoa(record.Start),
+		strconv.Itoa(record.End),
+		record.Name,
+		strconv.Itoa(record.Score),
+		record.Strand,
+		strconv.Itoa(record.ThickStart),
+		strconv.Itoa(record.ThickEnd),
+		itemRGB,
+		strconv.Itoa(len(record.BlockSizes)),
+		joinInts(record.BlockSizes),
+		joinInts(record.BlockStarts),
+	}, "\t")
+}
+
+// ParseBEDRecord parses a single BED line with 3 to 12 columns.
+func ParseBEDRecord(line string) (BEDRecord, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	if len(fields) < 3 {
+		return BEDRecord{}, fmt.Errorf("BED line needs at least 3 columns, got %d", len(fields))
+	}
+	record := BEDRecord{Chrom: fields[0], Strand: "."}
+	var err error
+	if record.Start, err = strconv.Atoi(fields[1]); err != nil {
+		return BEDRecord{}, err
+	}
+	if record.End, err = strconv.Atoi(fields[2]); err != nil {
+		return BEDRecord{}, err
+	}
+	record.ThickStart, record.ThickEnd = record.Start, record.End
+	if len(fields) > 3 {
+		record.Name = fields[3]
+	}
+	if len(fields) > 4 {
+		if record.Score, err = strconv.Atoi(fields[4]); err != nil {
+			return BEDRecord{}, err
+		}
+	}
+	if len(fields) > 5 {
+		record.Strand = fields[5]
+	}
+	if len(fields) > 7 {
+		if record.ThickStart, err = strconv.Atoi(fields[6]); err != nil {
+			return BEDRecord{}, err
+		}
+		if record.ThickEnd, err = strconv.Atoi(fields[7]); err != nil {
+			return BEDRecord{}, err
+		}
+	}
+	if len(fields) > 8 {
+		record.ItemRGB = fields[8]
+	}
+	if len(fields) > 11 {
+		if record.BlockSizes, err = splitInts(fields[10]); err != nil {
+			return BEDRecord{}, err
+		}
+		if record.BlockStarts, err = splitInts(fields[11]); err != nil {
+			return BEDRecord{}, err
+		}
+		if len(record.BlockSizes) != len(record.BlockStarts) {
+			return BEDRecord{}, fmt.Errorf("BED line has %d block sizes but %d block starts", len(record.BlockSizes), len(record.BlockStarts))
+		}
+	}
+	return record, nil
+}
+
+// FeaturesToBED converts features into BED12 records on chrom. Joined
+// features become a single record with a block per part. Records are named
+// after the feature's label, gene or locus_tag qualifier, falling back to its
+// type. Thick regions cover CDS features only.
+func FeaturesToBED(chrom string, features []Feature) []BEDRecord {
+	records := make([]BEDRecord, 0, len(features))
+	for _, feature := range features {
+		parts, complement := flattenLocation(feature.Location)
+		sorted := append([]Location(nil), parts...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+		record := BEDRecord{
+			Chrom:   chrom,
+			Start:   sorted[0].Start,
+			End:     sorted[len(sorted)-1].End,
+			Name:    featureName(feature),
+			Strand:  strandOf(complement),
+			ItemRGB: "0",
+		}
+		for _, part := range sorted {
+			record.BlockSizes = append(record.BlockSizes, part.End-part.Start)
+			record.BlockStarts = append(record.BlockStarts, part.Start-record.Start)
+		}
+		record.ThickStart, record.ThickEnd = record.Start, record.Start
+		if feature.Type == "CDS" {
+			record.ThickEnd = record.End
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// BEDToFeatures converts BED records into features of featureType. The
+// record name is stored as the label qualifier and records with more than
+// one block become joined locations.
+func BEDToFeatures(records []BEDRecord, featureType string) []Feature {
+	features := make([]Feature, 0, len(records))
+	for _, record := range records {
+		complement := record.Strand == "-"
+		var parts []Location
+		for index, size := range record.BlockSizes {
+			start := record.Start + record.BlockStarts[index]
+			parts = append(parts, Location{Start: start, End: start + size})
+		}
+		if len(parts) == 0 {
+			parts = []Location{{Start: record.Start, End: record.End}}
+		}
+		feature := Feature{Type: featureType, Attributes: map[string]string{}, Location: buildLocation(parts, complement)}
+		if record.Name != "" {
+			feature.Attributes["label"] = record.Name
+		}
+		features = append(features, feature)
+	}
+	return features
+}
+
+// FeaturesToGFF converts features into GFF features on seqID. Qualifiers are
+// copied into attributes. Joined features are split into one GFF feature per
+// part, all sharing an ID attribute (taken from the ID qualifier or generated
+// from the feature's index), and CDS parts are given phases.
+func FeaturesToGFF(seqID string, features []Feature) []gff.Feature {
+	var gffFeatures []gff.Feature
+	for featureIndex, feature := range features {
+		parts, complement := flattenLocation(feature.Location)
+		attributes := make(map[string]string, len(feature.Attributes)+1)
+		for key, value := range feature.Attributes {
+			attributes[key] = value
+		}
+		if len(parts) > 1 && attributes["ID"] == "" {
+			attributes["ID"] = feature.Type + "_" + strconv.Itoa(featureIndex+1)
+		}
+
+		// phase is the number of bases to skip before the next codon, counted
+		// in transcription order.
+		phases := make([]string, len(parts))
+		transcribed := 0
+		if codonStart, err := strconv.Atoi(feature.Attributes["codon_start"]); err == nil && codonStart > 0 {
+			transcribed = 3 - (codonStart - 1)
+		}
+		for _, index := range transcriptionOrder(parts, complement) {
+			phases[index] = "."
+			if feature.Type == "CDS" {
+				phases[index] = strconv.Itoa((3 - transcribed%3) % 3)
+			}
+			transcribed += parts[index].End - parts[index].Start
+		}
+
+		for index, part := range parts {
+			gffFeatures = append(gffFeatures, gff.Feature{
+				Name:       seqID,
+				Source:     "poly",
+				Type:       feature.Type,
+				Score:      ".",
+				Strand:     strandOf(complement),
+				Phase:      phases[index],
+				Attributes: attributes,
+				Location:   gff.Location{Start: part.Start, End: part.End, Complement: complement},
+			})
+		}
+	}
+	return gffFeatures
+}
+
+// GFFToFeatures converts GFF features back into features. Consecutive GFF
+// features with the same type and ID attribute are joined into a single
+// feature, the way FeaturesToGFF splits them.
+func GFFToFeatures(gffFeatures []gff.Feature) []Feature {
+	var features []Feature
+	for index := 0; index < len(gffFeatures); {
+		first := gffFeatures[index]
+		parts := []Location{{Start: first.Location.Start, End: first.Location.End}}
+		next := index + 1
+		for id := first.Attributes["ID"]; id != "" && next < len(gffFeatures); next++ {
+			candidate := gffFeatures[next]
+			if candidate.Type != first.Type || candidate.Attributes["ID"] != id {
+				break
+			}
+			parts = append(parts, Location{Start: candidate.Location.Start, End: candidate.Location.End})
+		}
+		index = next
+
+		attributes := make(map[string]string, len(first.Attributes))
+		for key, value := range first.Attributes {
+			attributes[key] = value
+		}
+		complement := first.Strand == "-" || (first.Strand == "" && first.Location.Complement)
+		features = append(features, Feature{Type: first.Type, Attributes: attributes, Location: buildLocation(parts, complement)})
+	}
+	return features
+}
+
+// flattenLocation returns the simple parts of location in the order they are
+// listed, and whether the feature is on the reverse strand. A location is
+// considered reverse stranded if it, or all of its parts, are complemented.
+func flattenLocation(location Location) ([]Location, bool) {
+	if len(location.SubLocations) == 0 {
+		return []Location{{Start: location.Start, End: location.End}}, location.Complement
+	}
+	var parts []Location
+	allComplement := true
+	for _, subLocation := range location.SubLocations {
+		subParts, complement := flattenLocation(subLocation)
+		parts = append(parts, subParts...)
+		allComplement = allComplement && complement
+	}
+	return parts, location.Complement || allComplement
+}
+
+// buildLocation is the inverse of flattenLocation, producing a GenBank style
+// location from parts listed in order.
+func buildLocation(parts []Location, complement bool) Location {
+	if len(parts) == 1 {
+		return Location{Start: parts[0].Start, End: parts[0].End, Complement: complement}
+	}
+	return Location{Start: parts[0].Start, End: parts[len(parts)-1].End, Join: true, Complement: complement, SubLocations: parts}
+}
+
+// transcriptionOrder returns the indexes of parts in the order they are
+// transcribed: by ascending start on the forward strand and descending start
+// on the reverse strand.
+func transcriptionOrder(parts []Location, complement bool) []int {
+	order := make([]int, len(parts))
+	for index := range order {
+		order[index] = index
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if complement {
+			return parts[order[i]].Start > parts[order[j]].Start
+		}
+		return parts[order[i]].Start < parts[order[j]].Start
+	})
+	return order
+}
+
+func featureName(feature Feature) string {
+	for _, qualifier := range []string{"label", "gene", "locus_tag"} {
+		if name := feature.Attributes[qualifier]; name != "" {
+			return name
+		}
+	}
+	return feature.Type
+}
+
+func strandOf(complement bool) string {
+	if complement {
+		return "-"
+	}
+	return "+"
+}
+
+func joinInts(values []int) string {
+	var builder strings.Builder
+	for _, value := range values {
+		builder.WriteString(strconv.Itoa(value))
+		builder.WriteString(",")
+	}
+	return builder.String()
+}
+
+func splitInts(field string) ([]int, error) {
+	var values []int
+	for _, value := range strings.Split(strings.TrimSuffix(field, ","), ",") {
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, parsed)
+	}
+	return values, nil
+}
@@ -0,0 +1,131 @@
+package genbank
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/TimothyStiles/poly/io/gff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeaturesToBEDJoinedCDS(t *testing.T) {
+	location, err := parseLocation("join(101..200,301..350,401..500)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feature := Feature{Type: "CDS", Attributes: map[string]string{"gene": "abcD"}, Location: location}
+
+	records := FeaturesToBED("chr1", []Feature{feature})
+	assert.Len(t, records, 1)
+	assert.Equal(t, "chr1\t100\t500\tabcD\t0\t+\t100\t500\t0\t3\t100,50,100,\t0,200,300,", records[0].String())
+
+	parsed, err := ParseBEDRecord(records[0].String())
+	assert.NoError(t, err)
+	assert.Equal(t, records[0], parsed)
+
+	roundTrip := BEDToFeatures([]BEDRecord{parsed}, "CDS")
+	assert.Equal(t, "join(101..200,301..350,401..500)", BuildLocationString(roundTrip[0].Location))
+	assert.Equal(t, "abcD", roundTrip[0].Attributes["label"])
+}
+
+func TestFeaturesToBEDComplementJoin(t *testing.T) {
+	for _, locationString := range []string{
+		"complement(join(101..200,301..350))",
+		"join(complement(301..350),complement(101..200))",
+	} {
+		location, err := parseLocation(locationString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := FeaturesToBED("chr1", []Feature{{Type: "mRNA", Location: location}})
+		assert.Equal(t, "chr1\t100\t350\tmRNA\t0\t-\t100\t100\t0\t2\t100,50,\t0,200,", records[0].String(), locationString)
+	}
+}
+
+func TestFeaturesToGFFPhase(t *testing.T) {
+	// a CDS split 10/11/9 gives phases 0, 2 and 0 reading 5' to 3'.
+	location, err := parseLocation("complement(join(1..9,21..31,41..50))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gffFeatures := FeaturesToGFF("seq", []Feature{{Type: "CDS", Attributes: map[string]string{}, Location: location}})
+	assert.Len(t, gffFeatures, 3)
+	var phases []string
+	for _, gffFeature := range gffFeatures {
+		assert.Equal(t, "-", gffFeature.Strand)
+		assert.Equal(t, "CDS_1", gffFeature.Attributes["ID"])
+		phases = append(phases, gffFeature.Phase)
+	}
+	assert.Equal(t, []string{"0", "2", "0"}, phases)
+
+	// codon_start=2 means the first base is skipped.
+	location, _ = parseLocation("1..30")
+	gffFeatures = FeaturesToGFF("seq", []Feature{{Type: "CDS", Attributes: map[string]string{"codon_start": "2"}, Location: location}})
+	assert.Equal(t, "1", gffFeatures[0].Phase)
+}
+
+func TestFeaturesToGFFRoundTrip(t *testing.T) {
+	location, err := parseLocation("complement(join(11..20,31..40))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := []Feature{{Type: "CDS", Attributes: map[string]string{"gene": "abcD"}, Location: location}}
+
+	// write the features out to GFF text and parse them back in.
+	gffFile := gff.Gff{Meta: gff.Meta{Version: "3", RegionStart: 1, RegionEnd: 100, Name: "seq"}, Sequence: "", Features: FeaturesToGFF("seq", features)}
+	for index := range gffFile.Features {
+		gffFile.Features[index].ParentSequence = &gffFile
+	}
+	text, err := gff.Build(gffFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(text), "seq\tpoly\tCDS\t11\t20\t.\t-\t")
+
+	parsed, err := gff.Parse(bytes.NewReader(text))
+	assert.NoError(t, err)
+	roundTrip := GFFToFeatures(parsed.Features)
+	assert.Len(t, roundTrip, 1)
+	assert.Equal(t, "complement(join(11..20,31..40))", BuildLocationString(roundTrip[0].Location))
+	assert.Equal(t, "abcD", roundTrip[0].Attributes["gene"])
+}
+
+func TestFuzzyEndsAreDropped(t *testing.T) {
+	location, err := parseLocation("<1..>30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := []Feature{{Type: "gene", Location: location}}
+	roundTrip := BEDToFeatures(FeaturesToBED("chr1", features), "gene")
+	assert.Equal(t, "1..30", BuildLocationString(roundTrip[0].Location))
+}
+
+func TestParseBEDRecord(t *testing.T) {
+	record, err := ParseBEDRecord("chr1\t9\t20")
+	assert.NoError(t, err)
+	assert.Equal(t, BEDRecord{Chrom: "chr1", Start: 9, End: 20, Strand: ".", ThickStart: 9, ThickEnd: 20}, record)
+	assert.Len(t, BEDToFeatures([]BEDRecord{record}, "misc_feature")[0].Location.SubLocations, 0)
+
+	_, err = ParseBEDRecord("chr1\t9")
+	assert.Error(t, err)
+	_, err = ParseBEDRecord("chr1\tnine\t20")
+	assert.Error(t, err)
+	_, err = ParseBEDRecord("chr1\t0\t20\tname\t0\t+\t0\t20\t0\t2\t5,5,\t0,")
+	assert.Error(t, err)
+}
+
+// TestConversionRoundTripProperty checks that simple features keep their
+// coordinates and strand through every conversion.
+func TestConversionRoundTripProperty(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 500; trial++ {
+		start := random.Intn(10000)
+		location := Location{Start: start, End: start + 1 + random.Intn(1000), Complement: random.Intn(2) == 0}
+		features := []Feature{{Type: "misc_feature", Attributes: map[string]string{}, Location: location}}
+
+		fromBED := BEDToFeatures(FeaturesToBED("chr1", features), "misc_feature")
+		assert.Equal(t, location, fromBED[0].Location)
+
+		fromGFF := GFFToFeatures(FeaturesToGFF("chr1", features))
+		assert.Equal(t, location, fromGFF[0].Location)
+	}
+}
@@ -17,9 +17,11 @@ import (
 	"io"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/TimothyStiles/poly/bio"
 	"github.com/TimothyStiles/poly/transform"
 	"github.com/lunny/log"
 	"github.com/mitchellh/go-wordwrap"
@@ -62,6 +64,7 @@ type Meta struct {
 	Name                 string            `json:"name"`
 	SequenceHash         string            `json:"sequence_hash"`
 	SequenceHashFunction string            `json:"hash_function"`
+	Provenance           []bio.Provenance  `json:"provenance"`
 }
 
 // Feature holds the information for a feature in a Genbank file and other annotated sequence files.
@@ -315,6 +318,7 @@ func BuildMulti(sequences []Genbank) ([]byte, error) {
 			otherString := buildMetaString(otherKey, sequence.Meta.Other[otherKey])
 			gbkString.WriteString(otherString)
 		}
+		gbkString.WriteString(buildProvenanceComments(sequence.Meta.Provenance))
 
 		// start writing features section.
 		gbkString.WriteString("FEATURES             Location/Qualifiers\n")
@@ -475,6 +479,15 @@ func ParseMultiNth(r io.Reader, count int) ([]Genbank, error) {
 					}
 					parameters.genbank.Meta.References = append(parameters.genbank.Meta.References, reference)
 
+				case "COMMENT":
+					comment, chain, err := parseComment(parameters.metadataData)
+					if err != nil {
+						return []Genbank{}, fmt.Errorf("Failed in parsing comment above line %d. Got error: %s", lineNum, err)
+					}
+					parameters.genbank.Meta.Provenance = append(parameters.genbank.Meta.Provenance, chain...)
+					if comment != "" {
+						parameters.genbank.Meta.Other["COMMENT"] = comment
+					}
 				case "FEATURES":
 					parameters.parseStep = "features"
 
@@ -521,11 +534,12 @@ func ParseMultiNth(r io.Reader, count int) ([]Genbank, error) {
 				parameters.parseStep = "sequence"
 
 				// save our completed attribute / qualifier string to the current feature
-				if parameters.attributeValue != "" {
-					parameters.feature.Attributes[parameters.attribute] = parameters.attributeValue
+				if parameters.attributeValue != "" || parameters.emptyAttribute {
+					parameters.feature.Attributes[parameters.attribute] = decodeQualifierValue(parameters.attribute, parameters.attributeValue)
 					parameters.features = append(parameters.features, parameters.feature)
 					parameters.attributeValue = ""
 					parameters.attribute = ""
+					parameters.emptyAttribute = false
 					parameters.feature = Feature{}
 					parameters.feature.Attributes = make(map[string]string)
 				} else {
@@ -556,11 +570,12 @@ func ParseMultiNth(r io.Reader, count int) ([]Genbank, error) {
 			// determine if current line is a new top level feature
 			if countLeadingSpaces(parameters.currentLine) < countLeadingSpaces(parameters.prevline) || parameters.prevline == "FEATURES" {
 				// save our completed attribute / qualifier string to the current feature
-				if parameters.attributeValue != "" {
-					parameters.feature.Attributes[parameters.attribute] = parameters.attributeValue
+				if parameters.attributeValue != "" || parameters.emptyAttribute {
+					parameters.feature.Attributes[parameters.attribute] = decodeQualifierValue(parameters.attribute, parameters.attributeValue)
 					parameters.features = append(parameters.features, parameters.feature)
 					parameters.attributeValue = ""
 					parameters.attribute = ""
+					parameters.emptyAttribute = false
 					parameters.feature = Feature{}
 					parameters.feature.Attributes = make(map[string]string)
 				}
@@ -581,42 +596,43 @@ func ParseMultiNth(r io.Reader, count int) ([]Genbank, error) {
 				parameters.feature.Type = strings.TrimSpace(splitLine[0])
 				parameters.feature.Location.GbkLocationString = strings.TrimSpace(splitLine[len(splitLine)-1])
 				parameters.multiLineFeature = false // without this we can't tell if something is a multiline feature or multiline qualifier
+			} else if parameters.attribute != "" && qualifierQuoteOpen(parameters.attributeValue) { // current line continues a quoted qualifier, whatever it contains
+				parameters.attributeValue = parameters.attributeValue + "\n" + trimmedLine
 			} else if !strings.Contains(parameters.currentLine, "/") { // current line is continuation of a feature or qualifier (sub-constituent of a feature)
 				// if it's a continuation of the current feature, add it to the location
 				if !strings.Contains(parameters.currentLine, "\"") && (countLeadingSpaces(parameters.currentLine) > countLeadingSpaces(parameters.prevline) || parameters.multiLineFeature) {
 					parameters.feature.Location.GbkLocationString += strings.TrimSpace(line)
 					parameters.multiLineFeature = true // without this we can't tell if something is a multiline feature or multiline qualifier
 				} else { // it's a continued line of a qualifier
-					removeAttributeValueQuotes := strings.Replace(trimmedLine, "\"", "", -1)
-
-					parameters.attributeValue = parameters.attributeValue + removeAttributeValueQuotes
+					parameters.attributeValue = parameters.attributeValue + "\n" + trimmedLine
 				}
 			} else if strings.Contains(parameters.currentLine, "/") { // current line is a new qualifier
 				trimmedCurrentLine := strings.TrimSpace(parameters.currentLine)
 				if trimmedCurrentLine[0] != '/' { // if we have an exception case, like (adenine(1518)-N(6)/adenine(1519)-N(6))-
-					parameters.attributeValue = parameters.attributeValue + trimmedCurrentLine
+					parameters.attributeValue = parameters.attributeValue + "\n" + trimmedCurrentLine
 					continue
 				}
 				// save our completed attribute / qualifier string to the current feature
 				if parameters.attributeValue != "" || parameters.emptyAttribute {
-					parameters.feature.Attributes[parameters.attribute] = parameters.attributeValue
+					parameters.feature.Attributes[parameters.attribute] = decodeQualifierValue(parameters.attribute, parameters.attributeValue)
 					parameters.emptyAttribute = false
 				}
 				parameters.attributeValue = ""
-				splitAttribute := strings.Split(line, "=")
+				splitAttribute := strings.SplitN(line, "=", 2)
 				trimmedSpaceAttribute := strings.TrimSpace(splitAttribute[0])
 				removedForwardSlashAttribute := strings.Replace(trimmedSpaceAttribute, "/", "", 1)
 
 				parameters.attribute = removedForwardSlashAttribute
 
-				var removeAttributeValueQuotes string
+				var rawAttributeValue string
 				if len(splitAttribute) == 1 { // handle case of ` /pseudo `, which has no text
-					removeAttributeValueQuotes = ""
+					rawAttributeValue = ""
 					parameters.emptyAttribute = true
 				} else { // this is normally triggered
-					removeAttributeValueQuotes = strings.Replace(splitAttribute[1], "\"", "", -1)
+					// quotes are kept until the whole value is read, see decodeQualifierValue.
+					rawAttributeValue = strings.TrimRight(splitAttribute[1], " ")
 				}
-				parameters.attributeValue = removeAttributeValueQuotes
+				parameters.attributeValue = rawAttributeValue
 				parameters.multiLineFeature = false // without this we can't tell if something is a multiline feature or multiline qualifier
 			}
 
@@ -1004,13 +1020,141 @@ func BuildFeatureString(feature Feature) string {
 	for key := range feature.Attributes {
 		qualifierKeys = append(qualifierKeys, key)
 	}
+	sort.Strings(qualifierKeys)
 
 	for _, qualifier := range qualifierKeys {
-		returnString += generateWhiteSpace(qualifierIndex) + "/" + qualifier + "=\"" + feature.Attributes[qualifier] + "\"\n"
+		for _, qualifierLine := range foldQualifier(qualifier, feature.Attributes[qualifier]) {
+			returnString += generateWhiteSpace(qualifierIndex) + qualifierLine + "\n"
+		}
 	}
 	return returnString
 }
 
+/******************************************************************************
+
+Qualifier quoting and folding begins here.
+
+The INSDC feature table has a few rules for writing qualifiers that are easy
+to get wrong:
+
+	- Free text values are quoted, and quotes inside them are doubled:
+	  /note="the ""best"" promoter"
+	- Some values are never quoted, like /codon_start=1 or
+	  /anticodon=(pos:34..36,aa:Phe).
+	- Flag qualifiers like /pseudo have no value at all.
+	- Values are folded onto continuation lines so no line is wider than 79
+	  characters. Free text is folded at spaces, which read back as a single
+	  space. /translation has no spaces, so it is folded anywhere and read
+	  back with nothing in between, as is a line ending in a hyphen.
+
+The parser undoes each of these, so a value written and read back is
+unchanged. The one exception is an empty value, which is written as a flag.
+
+******************************************************************************/
+
+// qualifierWidth is how many characters of a qualifier fit on a line after
+// the 21 character indent.
+const qualifierWidth = 79 - qualifierIndex
+
+// unquotedQualifiers are written without quotes, as long as their values
+// contain no spaces or quotes.
+var unquotedQualifiers = map[string]bool{
+	"anticodon":        true,
+	"citation":         true,
+	"codon_start":      true,
+	"compare":          true,
+	"direction":        true,
+	"estimated_length": true,
+	"number":           true,
+	"rpt_type":         true,
+	"rpt_unit_range":   true,
+	"tag_peptide":      true,
+	"transl_except":    true,
+	"transl_table":     true,
+}
+
+// unspacedQualifiers are folded without spaces, so continuation lines are
+// joined with nothing in between.
+var unspacedQualifiers = map[string]bool{
+	"translation": true,
+}
+
+// foldQualifier returns the lines of a qualifier, without indentation.
+func foldQualifier(qualifier, value string) []string {
+	if value == "" {
+		return []string{"/" + qualifier}
+	}
+	if unquotedQualifiers[qualifier] && !strings.ContainsAny(value, " \"") {
+		return []string{"/" + qualifier + "=" + value}
+	}
+
+	text := "/" + qualifier + "=\"" + strings.ReplaceAll(value, "\"", "\"\"") + "\""
+	var lines []string
+	for len(text) > qualifierWidth {
+		if unspacedQualifiers[qualifier] {
+			lines = append(lines, text[:qualifierWidth])
+			text = text[qualifierWidth:]
+			continue
+		}
+		// fold at the last lone space that fits, or the first one after if a
+		// word is too long to fit. Lone, so the parser trimming whitespace
+		// off each line can't eat any of the value, and not after a hyphen,
+		// which the parser joins without a space.
+		fold := -1
+		for index := 1; index < len(text)-1; index++ {
+			if text[index] == ' ' && text[index-1] != ' ' && text[index-1] != '-' && text[index+1] != ' ' {
+				if index > qualifierWidth && fold != -1 {
+					break
+				}
+				fold = index
+				if index > qualifierWidth {
+					break
+				}
+			}
+		}
+		if fold == -1 {
+			break
+		}
+		lines = append(lines, text[:fold])
+		text = text[fold+1:]
+	}
+	return append(lines, text)
+}
+
+// qualifierQuoteOpen returns true if rawValue starts a quoted value that
+// hasn't been closed yet. Quotes inside values are doubled, so a closed value
+// always has an even number of them.
+func qualifierQuoteOpen(rawValue string) bool {
+	return strings.HasPrefix(rawValue, "\"") && strings.Count(rawValue, "\"")%2 == 1
+}
+
+// decodeQualifierValue turns a qualifier value as written in a file, with
+// its lines separated by newlines, into the value it represents.
+func decodeQualifierValue(qualifier, rawValue string) string {
+	joiner := " "
+	if unspacedQualifiers[qualifier] {
+		joiner = ""
+	}
+	if !strings.HasPrefix(rawValue, "\"") {
+		return strings.ReplaceAll(rawValue, "\n", "")
+	}
+	value := strings.TrimPrefix(rawValue, "\"")
+	if strings.HasSuffix(value, "\"") && !qualifierQuoteOpen(rawValue) {
+		value = strings.TrimSuffix(value, "\"")
+	}
+	lines := strings.Split(value, "\n")
+	value = lines[0]
+	for _, line := range lines[1:] {
+		// a line ending in a hyphen was folded inside a hyphenated word.
+		if strings.HasSuffix(value, "-") {
+			value += line
+		} else {
+			value += joiner + line
+		}
+	}
+	return strings.ReplaceAll(value, "\"\"", "\"")
+}
+
 func generateWhiteSpace(length int) string {
 	var spaceBuilder strings.Builder
 
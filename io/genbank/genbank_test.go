@@ -749,6 +749,46 @@ func TestBuildFeatureString(t *testing.T) {
 	assert.Equal(t, str, "     test type       gbk location\n")
 }
 
+func TestQualifierRoundTrip(t *testing.T) {
+	translation := strings.Repeat("MSKGEELFTGVVPILVELDGDVNGHKFSVSGEGEGDATYGKLTLKFICTTGKLPVPWPTLVTTF", 3)
+	note := `the "best" promoter in the collection, as described by "Smith et al." in a paper that is long enough to fold onto several lines`
+	feature := Feature{
+		Type:     "CDS",
+		Location: Location{GbkLocationString: "1..10"},
+		Attributes: map[string]string{
+			"translation": translation,
+			"note":        note,
+			"codon_start": "1",
+			"pseudo":      "",
+		},
+	}
+	featureString := BuildFeatureString(feature)
+	for _, line := range strings.Split(strings.TrimSuffix(featureString, "\n"), "\n") {
+		if len(line) > 79 {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+	assert.Contains(t, featureString, "/codon_start=1\n")
+	assert.Contains(t, featureString, "/pseudo\n")
+	assert.Contains(t, featureString, `/note="the ""best"" promoter`)
+
+	gbk, err := Read("../../data/puc19.gbk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gbk.Features = nil
+	_ = gbk.AddFeature(&feature)
+	build, err := Build(gbk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(strings.NewReader(string(build)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, feature.Attributes, parsed.Features[0].Attributes)
+}
+
 func TestParse_error(t *testing.T) {
 	parseMultiErr := errors.New("parse error")
 	oldParseMultiNthFn := parseMultiNthFn
@@ -781,7 +821,7 @@ func TestParseReferences_error(t *testing.T) {
 
 func TestIssue303Regression(t *testing.T) {
 	seq, _ := Read("../../data/puc19_303_regression.gbk")
-	expectedAttribute := "16S rRNA(adenine(1518)-N(6)/adenine(1519)-N(6))-dimethyltransferase"
+	expectedAttribute := "16S rRNA (adenine(1518)-N(6)/adenine(1519)-N(6))-dimethyltransferase"
 	for _, feature := range seq.Features {
 		if feature.Attributes["locus_tag"] == "JCVISYN3A_0004" && feature.Type == "CDS" {
 			if feature.Attributes["product"] != expectedAttribute {
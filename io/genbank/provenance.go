@@ -0,0 +1,148 @@
+package genbank
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/seqhash"
+)
+
+/******************************************************************************
+
+Provenance comments begin here
+
+GenBank has no field for provenance, but it does have structured comments:
+COMMENT blocks that start and end with ##Name-START## and ##Name-END## lines,
+with a "key :: value" line for each field in between, which NCBI uses for
+assembly and sequencing metadata. Each entry of a record's provenance chain
+is written as one of these, oldest first:
+
+	COMMENT     ##Provenance-START##
+	            Parent          :: v1_DLD_...
+	            Hash            :: v1_DLD_...
+	            Timestamp       :: 2023-01-02T15:04:05Z
+	            Edit Log        :: removed BsaI site at 120
+	            ##Provenance-END##
+
+Fields that are empty aren't written. Text in a COMMENT outside of a
+provenance block is kept in Meta.Other["COMMENT"], as before.
+
+******************************************************************************/
+
+const (
+	provenanceStart = "##Provenance-START##"
+	provenanceEnd   = "##Provenance-END##"
+)
+
+// Seqhash returns the seqhash of the sequence, as RNA if the molecule type
+// is RNA and as double stranded DNA otherwise, and circular if the locus is.
+func (sequence Genbank) Seqhash() (string, error) {
+	moleculeType := strings.ToUpper(sequence.Meta.Locus.MoleculeType)
+	switch {
+	case strings.Contains(moleculeType, "RNA"):
+		return seqhash.Hash(sequence.Sequence, seqhash.RNA, sequence.Meta.Locus.Circular, strings.HasPrefix(moleculeType, "DS-"))
+	default:
+		return seqhash.Hash(sequence.Sequence, seqhash.DNA, sequence.Meta.Locus.Circular, !strings.HasPrefix(moleculeType, "SS-"))
+	}
+}
+
+// Provenance returns the provenance chain of the sequence, oldest first.
+func (sequence Genbank) Provenance() []bio.Provenance {
+	return sequence.Meta.Provenance
+}
+
+// SetProvenance replaces the provenance chain of the sequence.
+func (sequence *Genbank) SetProvenance(chain []bio.Provenance) {
+	sequence.Meta.Provenance = chain
+}
+
+// buildProvenanceComments returns the structured COMMENT blocks of chain.
+func buildProvenanceComments(chain []bio.Provenance) string {
+	var comments strings.Builder
+	for _, provenance := range chain {
+		timestamp := ""
+		if !provenance.Timestamp.IsZero() {
+			timestamp = provenance.Timestamp.Format(time.RFC3339Nano)
+		}
+		comments.WriteString("COMMENT     " + provenanceStart + "\n")
+		for _, field := range [][2]string{
+			{"Parent", provenance.Parent},
+			{"Hash", provenance.Hash},
+			{"Tool", provenance.Tool},
+			{"Tool Version", provenance.ToolVersion},
+			{"Timestamp", timestamp},
+			{"Edit Log", provenance.EditLog},
+			{"Note", provenance.Note},
+		} {
+			// values can't be wrapped, or they would be read back with the
+			// next line's key.
+			value := strings.Join(strings.Fields(field[1]), " ")
+			if value != "" {
+				comments.WriteString(fmt.Sprintf("%s%-15s :: %s\n", generateWhiteSpace(12), field[0], value))
+			}
+		}
+		comments.WriteString(generateWhiteSpace(12) + provenanceEnd + "\n")
+	}
+	return comments.String()
+}
+
+// parseComment splits the lines of a COMMENT into its provenance blocks and
+// the rest of its text.
+func parseComment(lines []string) (string, []bio.Provenance, error) {
+	var chain []bio.Provenance
+	var text []string
+	var provenance *bio.Provenance
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == provenanceStart:
+			if provenance != nil {
+				return "", nil, fmt.Errorf("provenance comment %d has no %s", len(chain)+1, provenanceEnd)
+			}
+			provenance = &bio.Provenance{}
+		case line == provenanceEnd:
+			if provenance == nil {
+				return "", nil, fmt.Errorf("%s without %s", provenanceEnd, provenanceStart)
+			}
+			chain = append(chain, *provenance)
+			provenance = nil
+		case provenance != nil:
+			key, value, found := strings.Cut(line, "::")
+			if !found {
+				return "", nil, fmt.Errorf("provenance comment line %q isn't \"key :: value\"", line)
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "Parent":
+				provenance.Parent = value
+			case "Hash":
+				provenance.Hash = value
+			case "Tool":
+				provenance.Tool = value
+			case "Tool Version":
+				provenance.ToolVersion = value
+			case "Timestamp":
+				timestamp, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return "", nil, fmt.Errorf("failed to parse provenance timestamp: %w", err)
+				}
+				provenance.Timestamp = timestamp
+			case "Edit Log":
+				provenance.EditLog = value
+			case "Note":
+				provenance.Note = value
+			}
+		default:
+			text = append(text, line)
+		}
+	}
+	if provenance != nil {
+		return "", nil, fmt.Errorf("provenance comment %d has no %s", len(chain)+1, provenanceEnd)
+	}
+	if len(text) == 0 {
+		return "", chain, nil
+	}
+	return parseMetadata(text), chain, nil
+}
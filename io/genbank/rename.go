@@ -0,0 +1,57 @@
+package genbank
+
+import (
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/seqhash"
+)
+
+// Names returns the LOCUS name of the sequence, followed by the distinct
+// /locus_tag qualifiers of its features. A locus tag's sequence is that of
+// the first feature carrying it.
+func (sequence Genbank) Names() []bio.Name {
+	names := []bio.Name{{Name: sequence.Meta.Locus.Name, Seqhash: sequence.Seqhash}}
+	seen := map[string]bool{sequence.Meta.Locus.Name: true}
+	for _, feature := range sequence.Features {
+		locusTag := feature.Attributes["locus_tag"]
+		if locusTag == "" || seen[locusTag] {
+			continue
+		}
+		seen[locusTag] = true
+		feature := feature
+		feature.ParentSequence = &sequence
+		names = append(names, bio.Name{Name: locusTag, Seqhash: func() (string, error) {
+			featureSequence, err := feature.GetSequence()
+			if err != nil {
+				return "", err
+			}
+			return seqhash.Hash(featureSequence, seqhash.DNA, false, true)
+		}})
+	}
+	return names
+}
+
+// Rename replaces the LOCUS name and /locus_tag qualifiers of the sequence
+// that are keys of names with their values. Meta.Name is renamed too if it
+// is one of them. Other metadata, like the DEFINITION, is left alone.
+func (sequence *Genbank) Rename(names map[string]string) {
+	if name, ok := names[sequence.Meta.Locus.Name]; ok {
+		sequence.Meta.Locus.Name = name
+	}
+	if name, ok := names[sequence.Meta.Name]; ok {
+		sequence.Meta.Name = name
+	}
+	features := make([]Feature, len(sequence.Features))
+	for index, feature := range sequence.Features {
+		if name, ok := names[feature.Attributes["locus_tag"]]; ok {
+			attributes := make(map[string]string, len(feature.Attributes))
+			for key, value := range feature.Attributes {
+				attributes[key] = value
+			}
+			attributes["locus_tag"] = name
+			feature.Attributes = attributes
+		}
+		feature.ParentSequence = sequence
+		features[index] = feature
+	}
+	sequence.Features = features
+}
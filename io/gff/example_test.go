@@ -168,3 +168,19 @@ func TestFeature_GetSequence(t *testing.T) {
 		t.Error("Feature sequence was not properly retrieved.")
 	}
 }
+
+// This example reads a GTF file, in which one gene only has exon lines, and
+// prints the gene and transcript hierarchy built from their ids.
+func ExampleReadGTF() {
+	sequence, _ := gff.ReadGTF("../../data/ensembl-fragment.gtf")
+	for _, feature := range sequence.Features[7:] {
+		fmt.Printf("%s ID=%q Parent=%q\n", feature.Type, feature.Attributes["ID"], feature.Attributes["Parent"])
+	}
+	// Output:
+	// gene ID="STRG.2" Parent=""
+	// mRNA ID="STRG.2.1" Parent="STRG.2"
+	// exon ID="" Parent="STRG.2.1"
+	// exon ID="" Parent="STRG.2.1"
+	// mRNA ID="STRG.2.2" Parent="STRG.2"
+	// exon ID="" Parent="STRG.2.2"
+}
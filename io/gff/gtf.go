@@ -0,0 +1,375 @@
+package gff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+/******************************************************************************
+
+GTF begins here
+
+GTF, or GFF2, is the older format much of the world's annotation still
+ships in, from Ensembl downloads to the output of StringTie and Cufflinks.
+Its columns are the same as GFF3's but its attributes aren't: they're
+written `gene_id "ENSG01"; transcript_id "ENST01";`, and a feature's place
+in the gene, transcript, exon hierarchy is given by those ids instead of by
+ID and Parent attributes.
+
+ParseGTF turns a GTF file into the same Gff as Parse does for GFF3. Each
+feature keeps its GTF attributes, escaped the GFF3 way, with repeated keys
+like tag joined by commas, and gains the ID and Parent a GFF3 file would
+have: genes are their gene_id, transcripts their transcript_id, and every
+other feature is a child of its transcript. Many GTF files only have exon
+and CDS lines, so genes and transcripts without a line of their own are
+made up, spanning their children, with transcripts typed mRNA. Features
+come out grouped by gene, parents before children, in the order genes are
+first seen.
+
+BuildGTF goes the other way, getting gene_id and transcript_id back from
+the hierarchy for features that don't have them.
+
+******************************************************************************/
+
+// gtfGene is a gene of a GTF file and the features that belong to it.
+type gtfGene struct {
+	id          string
+	feature     *Feature // feature is nil if the file has no gene line.
+	children    []Feature
+	transcripts []*gtfTranscript
+}
+
+// gtfTranscript is a transcript of a gtfGene and its exons, CDSs and so on.
+type gtfTranscript struct {
+	id       string
+	feature  *Feature // feature is nil if the file has no transcript line.
+	children []Feature
+}
+
+// ParseGTF parses a GTF (GFF2) file into a Gff with the gene, transcript
+// hierarchy of a GFF3 one, making up the genes and mRNAs that only exist as
+// ids of other features.
+func ParseGTF(file io.Reader) (Gff, error) {
+	fileBytes, err := readAllFn(file)
+	if err != nil {
+		return Gff{}, err
+	}
+	gff := Gff{}
+
+	var (
+		genes     = make(map[string]*gtfGene)
+		ordered   []*gtfGene
+		emitOrder []interface{} // the *gtfGenes and standalone Features in file order
+	)
+	for lineIndex, line := range strings.Split(string(fileBytes), "\n") {
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 9 {
+			return Gff{}, fmt.Errorf("gtf: line %d has %d fields instead of 9", lineIndex+1, len(fields))
+		}
+		feature := Feature{
+			Name:   fields[0],
+			Source: fields[1],
+			Type:   fields[2],
+			Score:  fields[5],
+			Strand: fields[6],
+			Phase:  fields[7],
+		}
+		// Indexing starts at 1 for gtf so we need to shift down for Sequence 0 index.
+		feature.Location.Start, err = atoiFn(fields[3])
+		if err != nil {
+			return Gff{}, err
+		}
+		feature.Location.Start--
+		feature.Location.End, err = atoiFn(fields[4])
+		if err != nil {
+			return Gff{}, err
+		}
+		feature.Attributes, err = parseGTFAttributes(fields[8])
+		if err != nil {
+			return Gff{}, fmt.Errorf("gtf: line %d: %w", lineIndex+1, err)
+		}
+
+		geneID, transcriptID := feature.Attributes["gene_id"], feature.Attributes["transcript_id"]
+		if geneID == "" {
+			emitOrder = append(emitOrder, feature)
+			continue
+		}
+		gene, ok := genes[geneID]
+		if !ok {
+			gene = &gtfGene{id: geneID}
+			genes[geneID] = gene
+			ordered = append(ordered, gene)
+			emitOrder = append(emitOrder, gene)
+		}
+		switch {
+		case feature.Type == "gene":
+			feature.Attributes["ID"] = geneID
+			gene.feature = &feature
+		case transcriptID == "":
+			feature.Attributes["Parent"] = geneID
+			gene.children = append(gene.children, feature)
+		case feature.Type == "transcript" || feature.Type == "mRNA":
+			feature.Attributes["ID"] = transcriptID
+			feature.Attributes["Parent"] = geneID
+			gene.transcript(transcriptID).feature = &feature
+		default:
+			feature.Attributes["Parent"] = transcriptID
+			transcript := gene.transcript(transcriptID)
+			transcript.children = append(transcript.children, feature)
+		}
+	}
+
+	for _, gene := range ordered {
+		gene.synthesize()
+	}
+	for _, item := range emitOrder {
+		switch item := item.(type) {
+		case Feature:
+			gff.Features = append(gff.Features, item)
+		case *gtfGene:
+			gff.Features = append(gff.Features, *item.feature)
+			gff.Features = append(gff.Features, item.children...)
+			for _, transcript := range item.transcripts {
+				gff.Features = append(gff.Features, *transcript.feature)
+				gff.Features = append(gff.Features, transcript.children...)
+			}
+		}
+	}
+	for index := range gff.Features {
+		gff.Features[index].ParentSequence = &gff
+	}
+
+	gff.Meta.Version = "3"
+	gff.Meta.RegionStart = 1
+	for _, feature := range gff.Features {
+		if gff.Meta.Name == "" {
+			gff.Meta.Name = feature.Name
+		}
+		if feature.Location.End > gff.Meta.RegionEnd {
+			gff.Meta.RegionEnd = feature.Location.End
+		}
+	}
+	gff.Meta.Size = gff.Meta.RegionEnd - gff.Meta.RegionStart
+	gff.Meta.CheckSum = blake3.Sum256(fileBytes)
+	return gff, nil
+}
+
+// transcript returns the transcript of gene with id, adding it if it's new.
+func (gene *gtfGene) transcript(id string) *gtfTranscript {
+	for _, transcript := range gene.transcripts {
+		if transcript.id == id {
+			return transcript
+		}
+	}
+	transcript := &gtfTranscript{id: id}
+	gene.transcripts = append(gene.transcripts, transcript)
+	return transcript
+}
+
+// synthesize makes up the gene and transcript features that a GTF file only
+// has as ids, spanning the features that belong to them.
+func (gene *gtfGene) synthesize() {
+	var geneSpan []Feature
+	for _, transcript := range gene.transcripts {
+		if transcript.feature == nil {
+			mRNA := spanningFeature("mRNA", transcript.children)
+			mRNA.Attributes = map[string]string{"ID": transcript.id, "Parent": gene.id, "gene_id": gene.id, "transcript_id": transcript.id}
+			transcript.feature = &mRNA
+		}
+		geneSpan = append(geneSpan, *transcript.feature)
+	}
+	if gene.feature == nil {
+		geneFeature := spanningFeature("gene", append(geneSpan, gene.children...))
+		geneFeature.Attributes = map[string]string{"ID": gene.id, "gene_id": gene.id}
+		gene.feature = &geneFeature
+	}
+}
+
+// spanningFeature returns a feature of featureType from the first to the
+// last base of features, on their sequence and strand.
+func spanningFeature(featureType string, features []Feature) Feature {
+	first := features[0]
+	spanning := Feature{
+		Name:     first.Name,
+		Source:   first.Source,
+		Type:     featureType,
+		Score:    ".",
+		Strand:   first.Strand,
+		Phase:    ".",
+		Location: Location{Start: first.Location.Start, End: first.Location.End},
+	}
+	for _, feature := range features[1:] {
+		if feature.Location.Start < spanning.Location.Start {
+			spanning.Location.Start = feature.Location.Start
+		}
+		if feature.Location.End > spanning.Location.End {
+			spanning.Location.End = feature.Location.End
+		}
+	}
+	return spanning
+}
+
+// parseGTFAttributes parses the `key "value"; key value;` attributes of a GTF
+// line into GFF3 attributes, escaping the values and joining the values of
+// repeated keys with commas.
+func parseGTFAttributes(attributes string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	rest := strings.TrimSpace(attributes)
+	for rest != "" {
+		key, value, found := strings.Cut(rest, " ")
+		if !found || key == "" {
+			return nil, fmt.Errorf("attribute %q has no value", rest)
+		}
+		value = strings.TrimLeft(value, " ")
+		if strings.HasPrefix(value, `"`) {
+			closing := strings.Index(value[1:], `"`)
+			if closing < 0 {
+				return nil, fmt.Errorf("attribute %s has an unclosed quote", key)
+			}
+			rest = value[closing+2:]
+			value = value[1 : closing+1]
+		} else {
+			value, rest, _ = strings.Cut(value, ";")
+			value = strings.TrimSpace(value)
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ";"))
+
+		value = escapeAttribute(value)
+		if previous, ok := parsed[key]; ok {
+			value = previous + "," + value
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// attributeEscaper and attributeUnescaper convert the characters GFF3 gives
+// meaning to in attributes to and from their percent encodings.
+var (
+	attributeEscaper   = strings.NewReplacer("%", "%25", ";", "%3B", "=", "%3D", "&", "%26", ",", "%2C")
+	attributeUnescaper = strings.NewReplacer("%25", "%", "%3B", ";", "%3D", "=", "%26", "&", "%2C", ",")
+)
+
+func escapeAttribute(value string) string   { return attributeEscaper.Replace(value) }
+func unescapeAttribute(value string) string { return attributeUnescaper.Replace(value) }
+
+// BuildGTF returns a Gff as a GTF file. Features without gene_id and
+// transcript_id attributes get them from their ID and Parent attributes, so
+// GFF3 genes, transcripts and their children stay linked.
+func BuildGTF(sequence Gff) ([]byte, error) {
+	byID := make(map[string]Feature)
+	for _, feature := range sequence.Features {
+		if id, ok := feature.Attributes["ID"]; ok {
+			byID[id] = feature
+		}
+	}
+
+	var gtfBuffer bytes.Buffer
+	for _, feature := range sequence.Features {
+		geneID, transcriptID := gtfIDs(feature, byID)
+
+		var attributes []string
+		if geneID != "" {
+			attributes = append(attributes, gtfAttribute("gene_id", geneID))
+		}
+		if transcriptID != "" {
+			attributes = append(attributes, gtfAttribute("transcript_id", transcriptID))
+		}
+		keys := make([]string, 0, len(feature.Attributes))
+		for key := range feature.Attributes {
+			switch key {
+			case "ID", "Parent", "gene_id", "transcript_id":
+				continue
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range strings.Split(feature.Attributes[key], ",") {
+				attributes = append(attributes, gtfAttribute(key, value))
+			}
+		}
+
+		columns := []string{
+			feature.Name,
+			orDot(feature.Source),
+			orDot(feature.Type),
+			// Indexing starts at 1 for gtf so we need to shift up from Sequence 0 index.
+			strconv.Itoa(feature.Location.Start + 1),
+			strconv.Itoa(feature.Location.End),
+			orDot(feature.Score),
+			orDot(feature.Strand),
+			orDot(feature.Phase),
+			strings.Join(attributes, " "),
+		}
+		gtfBuffer.WriteString(strings.Join(columns, "\t") + "\n")
+	}
+	return gtfBuffer.Bytes(), nil
+}
+
+// gtfIDs returns the gene_id and transcript_id of feature, from its
+// attributes if it has them and from its ID and Parent if it doesn't.
+func gtfIDs(feature Feature, byID map[string]Feature) (string, string) {
+	geneID, transcriptID := feature.Attributes["gene_id"], feature.Attributes["transcript_id"]
+	if geneID != "" || transcriptID != "" {
+		return geneID, transcriptID
+	}
+	id, parentID := feature.Attributes["ID"], feature.Attributes["Parent"]
+	if feature.Type == "gene" {
+		return id, ""
+	}
+	parent, ok := byID[parentID]
+	switch {
+	case !ok:
+		return parentID, ""
+	case parent.Type == "gene":
+		// feature is a transcript, or belongs to the gene itself
+		if feature.Type == "mRNA" || feature.Type == "transcript" {
+			return parentID, id
+		}
+		return parentID, ""
+	}
+	return parent.Attributes["Parent"], parentID
+}
+
+// gtfAttribute returns a GTF attribute with an unescaped, quoted value.
+func gtfAttribute(key, value string) string {
+	return key + ` "` + unescapeAttribute(value) + `";`
+}
+
+// orDot returns column, or "." if it's empty.
+func orDot(column string) string {
+	if column == "" {
+		return "."
+	}
+	return column
+}
+
+// ReadGTF takes in a filepath for a .gtf file and parses it into a Gff.
+func ReadGTF(path string) (Gff, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return Gff{}, err
+	}
+	defer file.Close()
+	return ParseGTF(file)
+}
+
+// WriteGTF takes a Gff and a path string and writes out a gtf to that path.
+func WriteGTF(sequence Gff, path string) error {
+	gtf, err := BuildGTF(sequence)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, gtf, 0644)
+}
@@ -0,0 +1,123 @@
+package gff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseGTF(t *testing.T) {
+	gtf, err := ReadGTF("../../data/ensembl-fragment.gtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gtf.Features) != 13 {
+		t.Fatalf("ParseGTF() returned %d features, expected 13", len(gtf.Features))
+	}
+	if gtf.Meta.Name != "1" || gtf.Meta.RegionEnd != 92240 {
+		t.Errorf("ParseGTF() meta is %+v, expected name 1 ending at 92240", gtf.Meta)
+	}
+
+	tests := []struct {
+		index                     int
+		featureType, id, parent   string
+		start, end                int
+		strand                    string
+		attribute, attributeValue string
+	}{
+		// the Ensembl gene has its own gene and transcript lines
+		{0, "gene", "ENSG00000186092", "", 65418, 71585, "+", "gene_name", "OR4F5"},
+		{1, "transcript", "ENST00000641515", "ENSG00000186092", 65418, 71585, "+", "tag", "basic,CCDS"},
+		{4, "CDS", "", "ENST00000641515", 65564, 65573, "+", "protein_id", "ENSP00000493376"},
+		// the StringTie gene only has exons, so its gene and mRNAs are made up
+		{7, "gene", "STRG.2", "", 89294, 92240, "-", "gene_id", "STRG.2"},
+		{8, "mRNA", "STRG.2.1", "STRG.2", 89294, 92240, "-", "transcript_id", "STRG.2.1"},
+		{9, "exon", "", "STRG.2.1", 89294, 91629, "-", "cov", "3.5"},
+		{10, "exon", "", "STRG.2.1", 92090, 92240, "-", "exon_number", "2"},
+		{11, "mRNA", "STRG.2.2", "STRG.2", 89549, 91629, "-", "transcript_id", "STRG.2.2"},
+		{12, "exon", "", "STRG.2.2", 89549, 91629, "-", "cov", "1.0"},
+	}
+	for _, test := range tests {
+		feature := gtf.Features[test.index]
+		if feature.Type != test.featureType || feature.Attributes["ID"] != test.id || feature.Attributes["Parent"] != test.parent {
+			t.Errorf("feature %d is a %s with ID %q and Parent %q, expected a %s with ID %q and Parent %q", test.index, feature.Type, feature.Attributes["ID"], feature.Attributes["Parent"], test.featureType, test.id, test.parent)
+		}
+		if feature.Location.Start != test.start || feature.Location.End != test.end || feature.Strand != test.strand {
+			t.Errorf("feature %d is at %d-%d on %s, expected %d-%d on %s", test.index, feature.Location.Start, feature.Location.End, feature.Strand, test.start, test.end, test.strand)
+		}
+		if value := feature.Attributes[test.attribute]; value != test.attributeValue {
+			t.Errorf("feature %d has %s %q, expected %q", test.index, test.attribute, value, test.attributeValue)
+		}
+	}
+	if gtf.Features[4].Phase != "0" || gtf.Features[4].ParentSequence == nil {
+		t.Errorf("CDS lost its phase or parent sequence: %+v", gtf.Features[4])
+	}
+}
+
+func TestGTFRoundTrip(t *testing.T) {
+	gtf, err := ReadGTF("../../data/ensembl-fragment.gtf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignore := cmpopts.IgnoreFields(Feature{}, "ParentSequence")
+
+	// GTF to GTF
+	built, err := BuildGTF(gtf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := ParseGTF(bytes.NewReader(built))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(gtf.Features, reparsed.Features, ignore); diff != "" {
+		t.Errorf("parsing the output of BuildGTF() doesn't give back the features parsed. Got this diff:\n%s", diff)
+	}
+	if !strings.Contains(string(built), `tag "basic"; tag "CCDS";`) {
+		t.Errorf("BuildGTF() should repeat keys with several values, got:\n%s", built)
+	}
+
+	// GTF to GFF3
+	gff3, err := Build(gtf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err = Parse(bytes.NewReader(gff3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(gtf.Features, reparsed.Features, ignore); diff != "" {
+		t.Errorf("parsing the GFF3 Build() of a GTF doesn't give back its features. Got this diff:\n%s", diff)
+	}
+
+	// GFF3 to GTF, where gene_id and transcript_id come from ID and Parent
+	for _, feature := range reparsed.Features {
+		delete(feature.Attributes, "gene_id")
+		delete(feature.Attributes, "transcript_id")
+	}
+	built, err = BuildGTF(reparsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(built), "\n")
+	if !strings.HasSuffix(lines[0], `gene_id "ENSG00000186092"; gene_biotype "protein_coding"; gene_name "OR4F5"; gene_source "ensembl_havana"; gene_version "7";`) {
+		t.Errorf("BuildGTF() gene line is %q", lines[0])
+	}
+	if !strings.Contains(lines[10], `gene_id "STRG.2"; transcript_id "STRG.2.1";`) {
+		t.Errorf("BuildGTF() exon line is %q", lines[10])
+	}
+}
+
+func TestParseGTF_error(t *testing.T) {
+	_, err := ParseGTF(strings.NewReader("1\thavana\texon\t1\t10\t.\t+\t.\n"))
+	if err == nil {
+		t.Error("ParseGTF() should fail on a line without attributes")
+	}
+	_, err = ParseGTF(strings.NewReader("1\thavana\texon\t1\t10\t.\t+\t.\tgene_id \"unclosed;\n"))
+	if err == nil {
+		t.Error("ParseGTF() should fail on an unclosed quote")
+	}
+}
@@ -0,0 +1,77 @@
+package gff
+
+import (
+	"strings"
+
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/seqhash"
+)
+
+// Names returns the sequence region name of the sequence and its features,
+// followed by the distinct ID attributes of its features.
+func (sequence Gff) Names() []bio.Name {
+	sequenceHash := func() (string, error) {
+		return seqhash.Hash(sequence.Sequence, seqhash.DNA, false, true)
+	}
+	names := []bio.Name{{Name: sequence.Meta.Name, Seqhash: sequenceHash}}
+	seen := map[string]bool{sequence.Meta.Name: true}
+	for _, feature := range sequence.Features {
+		if !seen[feature.Name] {
+			seen[feature.Name] = true
+			names = append(names, bio.Name{Name: feature.Name, Seqhash: sequenceHash})
+		}
+		id := feature.Attributes["ID"]
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		feature := feature
+		feature.ParentSequence = &sequence
+		names = append(names, bio.Name{Name: id, Seqhash: func() (string, error) {
+			featureSequence, err := feature.GetSequence()
+			if err != nil {
+				return "", err
+			}
+			return seqhash.Hash(featureSequence, seqhash.DNA, false, true)
+		}})
+	}
+	return names
+}
+
+// Rename replaces the sequence region name, feature sequence names, and ID
+// and Parent attributes of the sequence that are keys of names with their
+// values. Each of the comma separated IDs of a Parent is renamed on its own.
+func (sequence *Gff) Rename(names map[string]string) {
+	if name, ok := names[sequence.Meta.Name]; ok {
+		if sequence.Meta.Description == ">"+sequence.Meta.Name {
+			sequence.Meta.Description = ">" + name
+		}
+		sequence.Meta.Name = name
+	}
+	features := make([]Feature, len(sequence.Features))
+	for index, feature := range sequence.Features {
+		if name, ok := names[feature.Name]; ok {
+			feature.Name = name
+		}
+		attributes := make(map[string]string, len(feature.Attributes))
+		for key, value := range feature.Attributes {
+			attributes[key] = value
+		}
+		if name, ok := names[attributes["ID"]]; ok {
+			attributes["ID"] = name
+		}
+		if parents, ok := attributes["Parent"]; ok {
+			parentIDs := strings.Split(parents, ",")
+			for parentIndex, parentID := range parentIDs {
+				if name, ok := names[parentID]; ok {
+					parentIDs[parentIndex] = name
+				}
+			}
+			attributes["Parent"] = strings.Join(parentIDs, ",")
+		}
+		feature.Attributes = attributes
+		feature.ParentSequence = sequence
+		features[index] = feature
+	}
+	sequence.Features = features
+}
@@ -13,6 +13,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/TimothyStiles/poly/bio"
+	"github.com/TimothyStiles/poly/seqhash"
 	"github.com/TimothyStiles/poly/transform"
 )
 
@@ -45,6 +47,8 @@ type Meta struct {
 	CreatedWith string    `json:"created_with"`
 	CreatedOn   time.Time `json:"created_on"`
 	Schema      string    `json:"schema"`
+	// Provenance is the sequence's provenance chain, oldest first.
+	Provenance []bio.Provenance `json:"provenance,omitempty"`
 }
 
 // Feature contains all the feature data for a poly feature struct.
@@ -110,6 +114,23 @@ func getFeatureSequence(feature Feature, location Location) (string, error) {
 	return sequenceString, nil
 }
 
+// Seqhash returns the seqhash of the sequence. Poly JSON doesn't record
+// whether a sequence is circular or single stranded, so it is hashed as
+// linear double stranded DNA.
+func (sequence Poly) Seqhash() (string, error) {
+	return seqhash.Hash(sequence.Sequence, seqhash.DNA, false, true)
+}
+
+// Provenance returns the provenance chain of the sequence, oldest first.
+func (sequence Poly) Provenance() []bio.Provenance {
+	return sequence.Meta.Provenance
+}
+
+// SetProvenance replaces the provenance chain of the sequence.
+func (sequence *Poly) SetProvenance(chain []bio.Provenance) {
+	sequence.Meta.Provenance = chain
+}
+
 // Parse parses a Poly JSON file and adds appropriate pointers to struct.
 func Parse(file io.Reader) (Poly, error) {
 	var sequence Poly
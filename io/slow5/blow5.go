@@ -0,0 +1,473 @@
+package slow5
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/******************************************************************************
+
+blow5 parser and writer begin here. Specification below:
+https://hasindu2008.github.io/slow5specs/slow5-v1.0.0.pdf
+
+blow5 is the binary twin of slow5. It holds exactly the same information, but
+numbers are stored as little endian binary instead of text and every record
+can be compressed on its own, which makes blow5 files a lot smaller and a lot
+faster to read than slow5.
+
+A blow5 file is laid out like this:
+
+	magic                      "BLOW5\1"
+	version                    3 uint8s, major minor patch
+	record compression         uint8, see Compression
+	number of read groups      uint32
+	signal compression         uint8, see SignalCompression
+	padding                    zeros up to 64 bytes
+	header size                uint32
+	header                     the slow5 text header, minus the first 2 lines
+	records                    uint64 size, then the (compressed) record
+	EOF marker                 "5WOLB"
+
+Records hold the same columns as slow5 rows, in the same order. The read ID
+is prefixed with its length as a uint16, the raw signal takes its length from
+len_raw_signal, and auxiliary strings are prefixed with their length as a
+uint64. Enums are a uint8 index. If the signal is compressed, raw_signal is
+instead the compressed signal prefixed with its size in bytes as a uint64.
+
+Some writers keep the #slow5_version and #num_read_groups lines in the text
+header. The parser accepts both, and when the two disagree the binary header
+wins, since that is what the records were written with.
+
+******************************************************************************/
+
+// Compression is how blow5 records are compressed.
+type Compression uint8
+
+// Record compression methods, numbered as in the blow5 specification.
+const (
+	NoCompression   Compression = 0
+	ZlibCompression Compression = 1
+)
+
+// zstdCompression is the specification's number for zstd records, which
+// slow5tools can write but this package can't read or write yet.
+const zstdCompression Compression = 2
+
+// SignalCompression is how the raw signal inside blow5 records is compressed.
+type SignalCompression uint8
+
+// Signal compression methods, numbered as in the blow5 specification.
+const (
+	NoSignalCompression    SignalCompression = 0
+	SvbZdSignalCompression SignalCompression = 1
+)
+
+var (
+	blow5Magic           = []byte{'B', 'L', 'O', 'W', '5', 1}
+	blow5EOF             = []byte{'5', 'W', 'O', 'L', 'B'}
+	blow5FixedHeaderSize = 64 // size of the fixed part of the header
+)
+
+// BinaryParser parses reads from a blow5 file. It is initialized with
+// NewBinaryParser.
+type BinaryParser struct {
+	reader            *bufio.Reader
+	compression       Compression
+	signalCompression SignalCompression
+	record            uint // number of records parsed, for errors
+	headerMap         map[int]string
+	endReasonMap      map[int]string
+	done              bool
+}
+
+// NewBinaryParser parses the header of a blow5 file. maxLineSize must be
+// larger than the longest line of the text header.
+func NewBinaryParser(r io.ReadSeeker, maxLineSize int) (*BinaryParser, []Header, error) {
+	reader := bufio.NewReader(r)
+	fixed := make([]byte, blow5FixedHeaderSize+4)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		return nil, nil, fmt.Errorf("failed to read blow5 header: %w", err)
+	}
+	if !bytes.Equal(fixed[:len(blow5Magic)], blow5Magic) {
+		return nil, nil, fmt.Errorf("not a blow5 file: expected magic bytes %q, got %q", blow5Magic, fixed[:len(blow5Magic)])
+	}
+	version := fmt.Sprintf("%d.%d.%d", fixed[6], fixed[7], fixed[8])
+	compression := Compression(fixed[9])
+	numReadGroups := binary.LittleEndian.Uint32(fixed[10:14])
+	signalCompression := SignalCompression(fixed[14])
+	if err := checkBlow5Compression(compression, signalCompression); err != nil {
+		return nil, nil, err
+	}
+
+	headerText := make([]byte, binary.LittleEndian.Uint32(fixed[blow5FixedHeaderSize:]))
+	if _, err := io.ReadFull(reader, headerText); err != nil {
+		return nil, nil, fmt.Errorf("failed to read blow5 text header: %w", err)
+	}
+	// reuse the slow5 header parser, with version and read groups from the
+	// binary header.
+	for _, prefix := range []string{"#slow5_version\t", "#num_read_groups\t"} {
+		if bytes.HasPrefix(headerText, []byte(prefix)) {
+			headerText = headerText[bytes.IndexByte(headerText, '\n')+1:]
+		}
+	}
+	slow5Header := fmt.Sprintf("#slow5_version\t%s\n#num_read_groups\t%d\n%s", version, numReadGroups, headerText)
+	textParser, headers, err := NewParser(strings.NewReader(slow5Header), maxLineSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &BinaryParser{
+		reader:            reader,
+		compression:       compression,
+		signalCompression: signalCompression,
+		headerMap:         textParser.headerMap,
+		endReasonMap:      textParser.endReasonMap,
+	}, headers, nil
+}
+
+// ParseNext parses the next read from a blow5 file. It returns io.EOF once
+// the EOF marker is reached.
+func (parser *BinaryParser) ParseNext() (Read, error) {
+	if parser.done {
+		return Read{}, io.EOF
+	}
+	next, err := parser.reader.Peek(len(blow5EOF))
+	if bytes.Equal(next, blow5EOF) {
+		parser.done = true
+		return Read{}, io.EOF
+	}
+	if err == io.EOF {
+		return Read{}, fmt.Errorf("blow5 file ends after record %d without an EOF marker: %w", parser.record, io.ErrUnexpectedEOF)
+	}
+
+	var size uint64
+	if err = binary.Read(parser.reader, binary.LittleEndian, &size); err != nil {
+		return Read{}, fmt.Errorf("failed to read size of blow5 record %d: %w", parser.record, err)
+	}
+	var data []byte
+	if parser.compression == ZlibCompression {
+		zlibReader, err := zlib.NewReader(io.LimitReader(parser.reader, int64(size)))
+		if err != nil {
+			return Read{}, fmt.Errorf("failed to decompress blow5 record %d: %w", parser.record, err)
+		}
+		data, err = io.ReadAll(zlibReader)
+		if err != nil {
+			return Read{}, fmt.Errorf("failed to decompress blow5 record %d: %w", parser.record, err)
+		}
+	} else {
+		data = make([]byte, size)
+		if _, err = io.ReadFull(parser.reader, data); err != nil {
+			return Read{}, fmt.Errorf("failed to read blow5 record %d: %w", parser.record, err)
+		}
+	}
+
+	read, err := parser.decodeRecord(data)
+	if err != nil {
+		return Read{}, fmt.Errorf("failed to parse blow5 record %d: %w", parser.record, err)
+	}
+	parser.record++
+	return read, nil
+}
+
+// decodeRecord decodes an uncompressed blow5 record, using the column names
+// of the header to know which fields are present.
+func (parser *BinaryParser) decodeRecord(data []byte) (Read, error) {
+	record := bytes.NewReader(data)
+	field := func(value interface{}) error {
+		return binary.Read(record, binary.LittleEndian, value)
+	}
+	text := func(length uint64) (string, error) {
+		if length > uint64(record.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		value := make([]byte, length)
+		_, err := io.ReadFull(record, value)
+		return string(value), err
+	}
+
+	var read Read
+	var err error
+	for column := 0; column < len(parser.headerMap) && err == nil; column++ {
+		switch parser.headerMap[column] {
+		case "read_id":
+			var length uint16
+			if err = field(&length); err == nil {
+				read.ReadID, err = text(uint64(length))
+			}
+		case "read_group":
+			err = field(&read.ReadGroupID)
+		case "digitisation":
+			err = field(&read.Digitisation)
+		case "offset":
+			err = field(&read.Offset)
+		case "range":
+			err = field(&read.Range)
+		case "sampling_rate":
+			err = field(&read.SamplingRate)
+		case "len_raw_signal":
+			err = field(&read.LenRawSignal)
+		case "raw_signal":
+			if parser.signalCompression == SvbZdSignalCompression {
+				var length uint64
+				var compressedSignal string
+				if err = field(&length); err == nil {
+					compressedSignal, err = text(length)
+				}
+				if err == nil {
+					read.RawSignal, err = svbZdDecode([]byte(compressedSignal), read.LenRawSignal)
+				}
+			} else if read.LenRawSignal*2 > uint64(record.Len()) {
+				err = io.ErrUnexpectedEOF
+			} else {
+				read.RawSignal = make([]int16, read.LenRawSignal)
+				err = field(read.RawSignal)
+			}
+		case "start_time":
+			err = field(&read.StartTime)
+		case "read_number":
+			err = field(&read.ReadNumber)
+		case "start_mux":
+			err = field(&read.StartMux)
+		case "median_before":
+			err = field(&read.MedianBefore)
+		case "end_reason":
+			var endReason uint8
+			if err = field(&endReason); err == nil {
+				var ok bool
+				if read.EndReason, ok = parser.endReasonMap[int(endReason)]; !ok {
+					err = fmt.Errorf("end reason %d is not in the header", endReason)
+				}
+			}
+		case "channel_number":
+			var length uint64
+			if err = field(&length); err == nil {
+				read.ChannelNumber, err = text(length)
+			}
+		default:
+			err = fmt.Errorf("unknown field '%s'. Please report to github.com/TimothyStiles/poly", parser.headerMap[column])
+		}
+	}
+	if err != nil {
+		return Read{}, err
+	}
+	if record.Len() != 0 {
+		return Read{}, fmt.Errorf("%d unexpected bytes at the end of the record", record.Len())
+	}
+	return read, nil
+}
+
+// WriteBinaryOptions configures WriteBinary.
+type WriteBinaryOptions struct {
+	// RecordCompression compresses each record.
+	RecordCompression Compression
+	// SignalCompression compresses the raw signal of each record before the
+	// record itself is compressed.
+	SignalCompression SignalCompression
+	// BatchSize is how many reads are encoded and compressed concurrently
+	// before being written. Larger batches are faster but hold more reads in
+	// memory. 0 or 1 encodes reads one at a time.
+	BatchSize int
+}
+
+// DefaultWriteBinaryOptions are the defaults of slow5tools: zlib records and
+// svb-zd signal.
+var DefaultWriteBinaryOptions = WriteBinaryOptions{
+	RecordCompression: ZlibCompression,
+	SignalCompression: SvbZdSignalCompression,
+	BatchSize:         64,
+}
+
+// WriteBlow5 writes a list of headers and a channel of reads to an output as
+// blow5, compressing each record with compression. Like Write, reads are
+// written as they come off the channel.
+func WriteBlow5(headers []Header, reads <-chan Read, output io.Writer, compression Compression) error {
+	return WriteBinary(headers, reads, output, WriteBinaryOptions{RecordCompression: compression})
+}
+
+// WriteBinary writes a list of headers and a channel of reads to an output as
+// blow5, with the compression picked in opts. Like Write, reads are written
+// as they come off the channel, in the order they come. Extra columns aren't
+// written, since blow5 needs a binary encoding for each column type.
+func WriteBinary(headers []Header, reads <-chan Read, output io.Writer, opts WriteBinaryOptions) error {
+	if err := ValidateHeaders(headers); err != nil {
+		return err
+	}
+	if err := checkBlow5Compression(opts.RecordCompression, opts.SignalCompression); err != nil {
+		return err
+	}
+	version, err := parseBlow5Version(headers[0].Slow5Version)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(output)
+
+	// fixed size part of the header
+	fixed := make([]byte, blow5FixedHeaderSize)
+	copy(fixed, blow5Magic)
+	copy(fixed[6:], version[:])
+	fixed[9] = byte(opts.RecordCompression)
+	binary.LittleEndian.PutUint32(fixed[10:], uint32(len(headers)))
+	fixed[14] = byte(opts.SignalCompression)
+	if _, err = writer.Write(fixed); err != nil {
+		return err
+	}
+
+	// text part of the header
+	var headerText bytes.Buffer
+	if err = writeHeaderBody(headers, nil, &headerText); err != nil {
+		return err
+	}
+	if err = binary.Write(writer, binary.LittleEndian, uint32(headerText.Len())); err != nil {
+		return err
+	}
+	if _, err = headerText.WriteTo(writer); err != nil {
+		return err
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	endReasonHeaderMap := mergeEndReasons(headers)
+	batch := make([]Read, 0, batchSize)
+	records := make([][]byte, batchSize)
+	errs := make([]error, batchSize)
+	writeBatch := func() error {
+		var wait sync.WaitGroup
+		for index := range batch {
+			wait.Add(1)
+			go func(index int) {
+				defer wait.Done()
+				records[index], errs[index] = encodeBlow5Record(batch[index], endReasonHeaderMap, opts)
+			}(index)
+		}
+		wait.Wait()
+		for index := range batch {
+			if errs[index] != nil {
+				return errs[index]
+			}
+			if err := binary.Write(writer, binary.LittleEndian, uint64(len(records[index]))); err != nil {
+				return err
+			}
+			if _, err := writer.Write(records[index]); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for read := range reads {
+		batch = append(batch, read)
+		if len(batch) == batchSize {
+			if err = writeBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = writeBatch(); err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(blow5EOF); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// encodeBlow5Record returns the binary form of read, compressed as asked in
+// opts.
+func encodeBlow5Record(read Read, endReasonHeaderMap map[string]int, opts WriteBinaryOptions) ([]byte, error) {
+	if len(read.ReadID) > 0xffff {
+		return nil, fmt.Errorf("read ID %s... is too long for blow5", read.ReadID[:32])
+	}
+	endReason, ok := endReasonHeaderMap[read.EndReason]
+	if !ok && read.EndReason != "" {
+		return nil, fmt.Errorf("read %s has end reason '%s' which is not in the header", read.ReadID, read.EndReason)
+	}
+
+	signal := []interface{}{read.RawSignal}
+	if opts.SignalCompression == SvbZdSignalCompression {
+		compressedSignal := svbZdEncode(read.RawSignal)
+		signal = []interface{}{uint64(len(compressedSignal)), compressedSignal}
+	}
+	fields := []interface{}{
+		uint16(len(read.ReadID)), []byte(read.ReadID),
+		read.ReadGroupID,
+		read.Digitisation,
+		read.Offset,
+		read.Range,
+		read.SamplingRate,
+		uint64(len(read.RawSignal)), // len_raw_signal
+	}
+	fields = append(fields, signal...)
+	fields = append(fields,
+		read.StartTime,
+		read.ReadNumber,
+		read.StartMux,
+		read.MedianBefore,
+		uint8(endReason),
+		uint64(len(read.ChannelNumber)), []byte(read.ChannelNumber),
+	)
+	var record bytes.Buffer
+	for _, field := range fields {
+		if err := binary.Write(&record, binary.LittleEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	if opts.RecordCompression != ZlibCompression {
+		return record.Bytes(), nil
+	}
+
+	var compressed bytes.Buffer
+	zlibWriter := zlib.NewWriter(&compressed)
+	if _, err := zlibWriter.Write(record.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zlibWriter.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// checkBlow5Compression returns an error for compression methods this
+// package can't handle.
+func checkBlow5Compression(compression Compression, signalCompression SignalCompression) error {
+	switch compression {
+	case NoCompression, ZlibCompression:
+	case zstdCompression:
+		return fmt.Errorf("zstd blow5 record compression is not supported")
+	default:
+		return fmt.Errorf("unknown blow5 record compression %d", compression)
+	}
+	if signalCompression != NoSignalCompression && signalCompression != SvbZdSignalCompression {
+		return fmt.Errorf("unknown blow5 signal compression %d", signalCompression)
+	}
+	return nil
+}
+
+// parseBlow5Version turns a slow5 version like 0.2.0 into the 3 bytes of a
+// blow5 header. Missing versions default to 0.2.0.
+func parseBlow5Version(version string) ([3]byte, error) {
+	if version == "" {
+		return [3]byte{0, 2, 0}, nil
+	}
+	var parsed [3]byte
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return parsed, fmt.Errorf("slow5 version %s is not major.minor.patch", version)
+	}
+	for index, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return parsed, fmt.Errorf("slow5 version %s is not major.minor.patch: %w", version, err)
+		}
+		parsed[index] = byte(number)
+	}
+	return parsed, nil
+}
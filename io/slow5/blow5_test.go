@@ -0,0 +1,243 @@
+package slow5
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteBlow5(t *testing.T) {
+	parser, headers, err := NewParserFromFile("data/example.slow5", maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := parseAll(t, parser)
+	parser.Close()
+
+	var slow5 bytes.Buffer
+	if err := Write(headers, sendAll(reads), &slow5); err != nil {
+		t.Fatal(err)
+	}
+	slow5Lines := strings.SplitAfter(slow5.String(), "\n")
+	var expectedHeader string
+	for _, line := range slow5Lines[2:] {
+		expectedHeader += line
+		if strings.HasPrefix(line, "#read_id") {
+			break
+		}
+	}
+
+	sizes := map[Compression]int{}
+	for _, compression := range []Compression{NoCompression, ZlibCompression} {
+		var output bytes.Buffer
+		if err := WriteBlow5(headers, sendAll(reads), &output, compression); err != nil {
+			t.Fatal(err)
+		}
+		blow5 := output.Bytes()
+		sizes[compression] = len(blow5)
+
+		if !bytes.HasPrefix(blow5, blow5Magic) || !bytes.HasSuffix(blow5, blow5EOF) {
+			t.Fatalf("compression %d: missing magic or EOF marker", compression)
+		}
+		if !bytes.Equal(blow5[6:10], []byte{0, 2, 0, byte(compression)}) || binary.LittleEndian.Uint32(blow5[10:14]) != 1 {
+			t.Errorf("compression %d: bad fixed header %v", compression, blow5[:15])
+		}
+		headerSize := int(binary.LittleEndian.Uint32(blow5[64:68]))
+		if header := string(blow5[68 : 68+headerSize]); header != expectedHeader {
+			t.Errorf("compression %d: header text doesn't match slow5", compression)
+		}
+
+		// walk the records, checking the read IDs and signals.
+		records := blow5[68+headerSize : len(blow5)-len(blow5EOF)]
+		for index := 0; len(records) > 0; index++ {
+			size := binary.LittleEndian.Uint64(records)
+			record := records[8 : 8+size]
+			records = records[8+size:]
+			if compression == ZlibCompression {
+				zlibReader, err := zlib.NewReader(bytes.NewReader(record))
+				if err != nil {
+					t.Fatal(err)
+				}
+				record, err = io.ReadAll(zlibReader)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			idLength := int(binary.LittleEndian.Uint16(record))
+			if readID := string(record[2 : 2+idLength]); readID != reads[index].ReadID {
+				t.Errorf("compression %d record %d: got read ID %s, expected %s", compression, index, readID, reads[index].ReadID)
+			}
+			signalStart := 2 + idLength + 4 + 4*8
+			signalLength := binary.LittleEndian.Uint64(record[signalStart:])
+			signal := make([]int16, signalLength)
+			if err := binary.Read(bytes.NewReader(record[signalStart+8:]), binary.LittleEndian, signal); err != nil {
+				t.Fatal(err)
+			}
+			for signalIndex, value := range signal {
+				if value != reads[index].RawSignal[signalIndex] {
+					t.Fatalf("compression %d record %d: signal differs at %d", compression, index, signalIndex)
+				}
+			}
+			// the last field is the channel number.
+			if !bytes.HasSuffix(record, []byte(reads[index].ChannelNumber)) {
+				t.Errorf("compression %d record %d: channel number missing", compression, index)
+			}
+			if index == len(reads)-1 && len(records) != 0 {
+				t.Errorf("compression %d: more records than reads", compression)
+			}
+		}
+	}
+	if sizes[ZlibCompression] >= sizes[NoCompression] {
+		t.Errorf("zlib compression should shrink the file, got %d and %d bytes", sizes[ZlibCompression], sizes[NoCompression])
+	}
+}
+
+func TestWriteBlow5Errors(t *testing.T) {
+	if err := WriteBlow5(nil, sendAll(nil), io.Discard, NoCompression); err == nil {
+		t.Errorf("writing no headers should fail")
+	}
+	headers := []Header{{Slow5Version: "0.2.0", EndReasonHeaderMap: map[string]int{"unknown": 0}}}
+	if err := WriteBlow5(headers, sendAll(nil), io.Discard, Compression(7)); err == nil {
+		t.Errorf("unknown compression should fail")
+	}
+	if err := WriteBlow5(headers, sendAll([]Read{{ReadID: "a", EndReason: "mux_change"}}), io.Discard, NoCompression); err == nil {
+		t.Errorf("end reason missing from the header should fail")
+	}
+	if err := WriteBinary(headers, sendAll(nil), io.Discard, WriteBinaryOptions{RecordCompression: zstdCompression}); err == nil {
+		t.Errorf("zstd compression should fail")
+	}
+	headers[0].Slow5Version = "two"
+	if err := WriteBlow5(headers, sendAll(nil), io.Discard, NoCompression); err == nil {
+		t.Errorf("bad version should fail")
+	}
+}
+
+// writeExampleBlow5 writes data/example.slow5 as blow5.
+func writeExampleBlow5(t *testing.T, opts WriteBinaryOptions) ([]Header, []Read, []byte) {
+	parser, headers, err := NewParserFromFile("data/example.slow5", maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := parseAll(t, parser)
+	parser.Close()
+	var output bytes.Buffer
+	if err := WriteBinary(headers, sendAll(reads), &output, opts); err != nil {
+		t.Fatal(err)
+	}
+	return headers, reads, output.Bytes()
+}
+
+func TestBinaryParserRoundTrip(t *testing.T) {
+	for _, opts := range []WriteBinaryOptions{
+		{},
+		{RecordCompression: ZlibCompression},
+		{SignalCompression: SvbZdSignalCompression, BatchSize: 7},
+		DefaultWriteBinaryOptions,
+	} {
+		headers, reads, blow5 := writeExampleBlow5(t, opts)
+		parser, parsedHeaders, err := NewBinaryParser(bytes.NewReader(blow5), maxLineSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(headers, parsedHeaders) {
+			t.Errorf("%+v: headers differ after round trip", opts)
+		}
+		var parsedReads []Read
+		for {
+			read, err := parser.ParseNext()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsedReads = append(parsedReads, read)
+		}
+		if !reflect.DeepEqual(reads, parsedReads) {
+			t.Errorf("%+v: reads differ after round trip", opts)
+		}
+		if _, err := parser.ParseNext(); !errors.Is(err, io.EOF) {
+			t.Errorf("%+v: parsing past the EOF marker should return io.EOF, got %v", opts, err)
+		}
+	}
+}
+
+func TestSvbZd(t *testing.T) {
+	signal := []int16{0, 1, -1, 300, -300, 32767, -32768, 32767, 500, 501, 499}
+	encoded := svbZdEncode(signal)
+	decoded, err := svbZdDecode(encoded, uint64(len(signal)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(signal, decoded) {
+		t.Errorf("expected %v, got %v", signal, decoded)
+	}
+	if _, err := svbZdDecode(encoded, uint64(len(signal)+1)); err == nil {
+		t.Errorf("wrong sample count should fail")
+	}
+	if _, err := svbZdDecode(encoded[:len(encoded)-1], uint64(len(signal))); err == nil {
+		t.Errorf("truncated signal should fail")
+	}
+
+	// real signal should shrink to well under 2 bytes a sample.
+	_, reads, _ := writeExampleBlow5(t, WriteBinaryOptions{})
+	rawSignal := reads[0].RawSignal
+	if size := len(svbZdEncode(rawSignal)); size >= 2*len(rawSignal) {
+		t.Errorf("svb-zd should compress signal, got %d bytes for %d samples", size, len(rawSignal))
+	}
+}
+
+func TestBinaryParserVersionLines(t *testing.T) {
+	// the text header keeps its version lines, with a different version than
+	// the binary header. The binary header wins.
+	_, _, blow5 := writeExampleBlow5(t, WriteBinaryOptions{})
+	headerSize := binary.LittleEndian.Uint32(blow5[64:68])
+	headerText := append([]byte("#slow5_version\t0.1.0\n#num_read_groups\t1\n"), blow5[68:68+headerSize]...)
+	var edited bytes.Buffer
+	edited.Write(blow5[:64])
+	_ = binary.Write(&edited, binary.LittleEndian, uint32(len(headerText)))
+	edited.Write(headerText)
+	edited.Write(blow5[68+headerSize:])
+
+	parser, headers, err := NewBinaryParser(bytes.NewReader(edited.Bytes()), maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers[0].Slow5Version != "0.2.0" {
+		t.Errorf("expected version 0.2.0 from the binary header, got %s", headers[0].Slow5Version)
+	}
+	if _, err := parser.ParseNext(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBinaryParserErrors(t *testing.T) {
+	slow5 := []byte("#slow5_version\t0.2.0\n" + strings.Repeat("x", 100))
+	if _, _, err := NewBinaryParser(bytes.NewReader(slow5), maxLineSize); err == nil || !strings.Contains(err.Error(), "magic bytes") {
+		t.Errorf("slow5 passed as blow5 should fail on magic bytes, got %v", err)
+	}
+
+	_, _, zstd := writeExampleBlow5(t, WriteBinaryOptions{})
+	zstd[9] = byte(zstdCompression)
+	if _, _, err := NewBinaryParser(bytes.NewReader(zstd), maxLineSize); err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("a blow5 with zstd records should fail on its compression, got %v", err)
+	}
+
+	_, _, blow5 := writeExampleBlow5(t, WriteBinaryOptions{RecordCompression: ZlibCompression})
+	truncated := blow5[:len(blow5)-len(blow5EOF)]
+	parser, _, err := NewBinaryParser(bytes.NewReader(truncated), maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = parser.ParseNext()
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("a file without an EOF marker should fail, got %v", err)
+	}
+}
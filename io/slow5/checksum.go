@@ -0,0 +1,113 @@
+package slow5
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+/******************************************************************************
+
+Signal checksums begin here
+
+Raw signal is kept for years after a run, long enough for a disk or a copy
+to flip a bit that nothing notices until a basecaller chokes on it. Write
+can add a checksum of each read's signal as an auxiliary column, and a
+Parser made WithVerifyChecksums checks it, so a damaged read is caught on
+its own rather than silently feeding bad signal downstream.
+
+The column is raw_signal_crc32, of type uint32_t. Its value is the CRC-32
+(IEEE, as in gzip and zip) of raw_signal as little endian int16 values, two
+bytes each, in the order they're written, so blow5 readers can compute it
+from the same bytes. Files without the column parse exactly as before, and
+reads with "." in it aren't checked.
+
+******************************************************************************/
+
+// ChecksumColumn is the auxiliary column holding each read's SignalChecksum.
+const ChecksumColumn = "raw_signal_crc32"
+
+// SignalChecksum returns the CRC-32 (IEEE) of rawSignal as little endian
+// int16 values.
+func SignalChecksum(rawSignal []int16) uint32 {
+	signalBytes := make([]byte, 2*len(rawSignal))
+	for index, signal := range rawSignal {
+		binary.LittleEndian.PutUint16(signalBytes[2*index:], uint16(signal))
+	}
+	return crc32.ChecksumIEEE(signalBytes)
+}
+
+// ChecksumError is a read whose raw signal doesn't match its checksum.
+type ChecksumError struct {
+	ReadID string
+	// Expected is the checksum in the file, and Actual is the checksum of
+	// the signal that was read.
+	Expected, Actual uint32
+}
+
+// Error describes the mismatch, naming the read.
+func (checksumError ChecksumError) Error() string {
+	return fmt.Sprintf("read %s has a %s of %d, but its raw signal has a checksum of %d", checksumError.ReadID, ChecksumColumn, checksumError.Expected, checksumError.Actual)
+}
+
+// WithChecksums makes Write add ChecksumColumn to the reads it writes,
+// replacing any value the reads already have.
+func WithChecksums() WriteOption {
+	return func(options *writeOptions) {
+		options.checksums = true
+	}
+}
+
+// WithVerifyChecksums makes the parser check the raw signal of reads with a
+// ChecksumColumn, setting Read.Error to a ChecksumError if it doesn't match.
+func WithVerifyChecksums() ParserOption {
+	return func(parser *Parser) {
+		parser.verifyChecksums = true
+	}
+}
+
+// verifyChecksum returns an error if read's raw signal doesn't match its
+// ChecksumColumn, or nil if it does or read doesn't have one.
+func verifyChecksum(read Read) error {
+	value, ok := read.ExtraAttributes[ChecksumColumn]
+	if !ok {
+		return nil
+	}
+	expected, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return fmt.Errorf("Failed to convert %s '%s' of read %s to uint. Got Error: %w", ChecksumColumn, value, read.ReadID, err)
+	}
+	if actual := SignalChecksum(read.RawSignal); actual != uint32(expected) {
+		return ChecksumError{ReadID: read.ReadID, Expected: uint32(expected), Actual: actual}
+	}
+	return nil
+}
+
+// withChecksumColumn returns headers with ChecksumColumn as an extra column
+// of the first, without changing the maps of headers.
+func withChecksumColumn(headers []Header) []Header {
+	withColumn := make([]Header, len(headers))
+	copy(withColumn, headers)
+	columnTypes := map[string]string{ChecksumColumn: "uint32_t"}
+	for name, columnType := range headers[0].ExtraColumnTypes {
+		if name != ChecksumColumn {
+			columnTypes[name] = columnType
+		}
+	}
+	withColumn[0].ExtraColumnTypes = columnTypes
+	return withColumn
+}
+
+// withChecksum returns read with its SignalChecksum in ChecksumColumn,
+// without changing the ExtraAttributes of read.
+func withChecksum(read Read) Read {
+	attributes := map[string]string{ChecksumColumn: strconv.FormatUint(uint64(SignalChecksum(read.RawSignal)), 10)}
+	for name, value := range read.ExtraAttributes {
+		if name != ChecksumColumn {
+			attributes[name] = value
+		}
+	}
+	read.ExtraAttributes = attributes
+	return read
+}
@@ -0,0 +1,129 @@
+package slow5
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseAllReads parses every read of the slow5 file at path with options,
+// keeping reads that have an Error.
+func parseAllReads(t *testing.T, path string, options ...ParserOption) ([]Header, []Read) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", path, err)
+	}
+	defer file.Close()
+	parser, headers, err := NewParser(file, maxLineSize, options...)
+	if err != nil {
+		t.Fatalf("Failed to parse headers of %s: %s", path, err)
+	}
+	var reads []Read
+	for {
+		read, err := parser.ParseNext()
+		if err != nil {
+			break
+		}
+		reads = append(reads, read)
+	}
+	return headers, reads
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	// the third raw signal value of the second read was changed after it was
+	// written.
+	_, reads := parseAllReads(t, "data/checksums.slow5", WithVerifyChecksums())
+	if len(reads) != 3 {
+		t.Fatalf("Expected 3 reads, got %d", len(reads))
+	}
+	for index, read := range reads {
+		if index != 1 {
+			if read.Error != nil {
+				t.Errorf("Unexpected error for read %s: %s", read.ReadID, read.Error)
+			}
+			continue
+		}
+		var checksumError ChecksumError
+		if !errors.As(read.Error, &checksumError) {
+			t.Fatalf("Expected a ChecksumError for read %s, got %v", read.ReadID, read.Error)
+		}
+		if checksumError.ReadID != read.ReadID || checksumError.Expected == checksumError.Actual {
+			t.Errorf("Unexpected ChecksumError %+v", checksumError)
+		}
+	}
+
+	// checksums aren't checked unless asked for.
+	_, reads = parseAllReads(t, "data/checksums.slow5")
+	for _, read := range reads {
+		if read.Error != nil {
+			t.Errorf("Unexpected error for read %s without verification: %s", read.ReadID, read.Error)
+		}
+	}
+
+	// files without the column parse the same either way.
+	_, plain := parseAllReads(t, "data/example.slow5")
+	_, verified := parseAllReads(t, "data/example.slow5", WithVerifyChecksums())
+	if !reflect.DeepEqual(plain, verified) {
+		t.Errorf("Verifying checksums changed reads without a %s column", ChecksumColumn)
+	}
+}
+
+func TestWriteChecksums(t *testing.T) {
+	headers, reads := parseAllReads(t, "data/example.slow5")
+	write := func(headers []Header, reads []Read) string {
+		t.Helper()
+		channel := make(chan Read, len(reads))
+		for _, read := range reads {
+			channel <- read
+		}
+		close(channel)
+		var buffer bytes.Buffer
+		if err := Write(headers, channel, &buffer, WithChecksums()); err != nil {
+			t.Fatalf("Failed to write: %s", err)
+		}
+		return buffer.String()
+	}
+	written := write(headers, reads)
+	if headers[0].ExtraColumnTypes != nil {
+		t.Errorf("Write changed the headers it was given: %v", headers[0].ExtraColumnTypes)
+	}
+
+	parser, checksummedHeaders, err := NewParser(strings.NewReader(written), maxLineSize, WithVerifyChecksums())
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	if checksummedHeaders[0].ExtraColumnTypes[ChecksumColumn] != "uint32_t" {
+		t.Errorf("Expected a uint32_t %s column, got %v", ChecksumColumn, checksummedHeaders[0].ExtraColumnTypes)
+	}
+	var checksummed []Read
+	for {
+		read, err := parser.ParseNext()
+		if err != nil {
+			break
+		}
+		if read.Error != nil {
+			t.Errorf("Unexpected error for read %s: %s", read.ReadID, read.Error)
+		}
+		checksummed = append(checksummed, read)
+	}
+	if len(checksummed) != len(reads) {
+		t.Fatalf("Expected %d reads, got %d", len(reads), len(checksummed))
+	}
+
+	// writing checksummed reads again replaces their checksums rather than
+	// adding another column.
+	if rewritten := write(checksummedHeaders, checksummed); rewritten != written {
+		t.Errorf("Rewriting a checksummed file changed it")
+	}
+}
+
+func TestSignalChecksum(t *testing.T) {
+	// the CRC-32 of the bytes 1, 0, 255, 255.
+	if checksum := SignalChecksum([]int16{1, -1}); checksum != 0x27deaa86 {
+		t.Errorf("Expected checksum 0x27deaa86, got %#x", checksum)
+	}
+}
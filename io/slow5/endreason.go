@@ -0,0 +1,179 @@
+package slow5
+
+import (
+	"sort"
+	"sync"
+)
+
+/******************************************************************************
+
+End reasons begin here
+
+Every read records why it ended: the strand finished, the pore was
+unblocked, adaptive sampling rejected it, and so on. slow5 files store this
+as an index into an end_reason enum declared in the header, and the enum
+grows as MinKNOW adds reasons, so files can hold labels poly has never seen.
+
+EndReason is the typed form of those labels. The reasons poly knows are
+constants, and any other label gets its own value from Other the first time
+it is seen, so a novel label parses instead of failing and is written back
+under the same label it was read with. The integer values are only
+meaningful within a process: files are always read and written through the
+header's enum, so a read's index in its file round trips exactly.
+
+Read.EndReason still holds the label as a string for one more release.
+Read.Reason and Read.SetReason read and write it as an EndReason.
+
+******************************************************************************/
+
+// EndReason is why a read ended.
+type EndReason int
+
+// The end reasons in MinKNOW's end_reason enum. NoEndReason is for reads
+// without one.
+const (
+	NoEndReason EndReason = iota
+	EndReasonUnknown
+	EndReasonPartial
+	EndReasonMuxChange
+	EndReasonUnblockMuxChange
+	EndReasonDataServiceUnblockMuxChange
+	EndReasonSignalPositive
+	EndReasonSignalNegative
+	// firstOtherEndReason is the value of the first end reason from Other.
+	firstOtherEndReason
+)
+
+// knownEndReasons are the labels of the known end reasons.
+var knownEndReasons = map[string]EndReason{
+	"unknown":                         EndReasonUnknown,
+	"partial":                         EndReasonPartial,
+	"mux_change":                      EndReasonMuxChange,
+	"unblock_mux_change":              EndReasonUnblockMuxChange,
+	"data_service_unblock_mux_change": EndReasonDataServiceUnblockMuxChange,
+	"signal_positive":                 EndReasonSignalPositive,
+	"signal_negative":                 EndReasonSignalNegative,
+}
+
+// otherEndReasons holds the labels of the end reasons made by Other.
+var otherEndReasons = struct {
+	sync.RWMutex
+	labels []string
+	values map[string]EndReason
+}{values: make(map[string]EndReason)}
+
+// ParseEndReason returns the end reason with label, as written in an
+// end_reason enum. Labels poly doesn't know are returned from Other, and an
+// empty label is NoEndReason.
+func ParseEndReason(label string) EndReason {
+	if label == "" {
+		return NoEndReason
+	}
+	if reason, ok := knownEndReasons[label]; ok {
+		return reason
+	}
+	return Other(label)
+}
+
+// Other returns the end reason for a label poly doesn't know, like one added
+// by a newer MinKNOW. Every call with the same label returns the same end
+// reason, and known labels return their constant.
+func Other(label string) EndReason {
+	if reason, ok := knownEndReasons[label]; ok {
+		return reason
+	}
+	otherEndReasons.RLock()
+	reason, ok := otherEndReasons.values[label]
+	otherEndReasons.RUnlock()
+	if ok {
+		return reason
+	}
+	otherEndReasons.Lock()
+	defer otherEndReasons.Unlock()
+	if reason, ok = otherEndReasons.values[label]; !ok {
+		reason = firstOtherEndReason + EndReason(len(otherEndReasons.labels))
+		otherEndReasons.labels = append(otherEndReasons.labels, label)
+		otherEndReasons.values[label] = reason
+	}
+	return reason
+}
+
+// String returns the label of the end reason, as written in an end_reason
+// enum, or "" for NoEndReason and values that aren't end reasons.
+func (reason EndReason) String() string {
+	for label, known := range knownEndReasons {
+		if known == reason {
+			return label
+		}
+	}
+	otherEndReasons.RLock()
+	defer otherEndReasons.RUnlock()
+	if index := int(reason - firstOtherEndReason); index >= 0 && index < len(otherEndReasons.labels) {
+		return otherEndReasons.labels[index]
+	}
+	return ""
+}
+
+// IsOther returns true if the end reason isn't one poly knows.
+func (reason EndReason) IsOther() bool {
+	return reason >= firstOtherEndReason
+}
+
+// IsUnblock returns true if the read ended because the pore was unblocked,
+// by MinKNOW or by adaptive sampling.
+func (reason EndReason) IsUnblock() bool {
+	return reason == EndReasonUnblockMuxChange || reason == EndReasonDataServiceUnblockMuxChange
+}
+
+// IsSignalPositive returns true if the read ended normally, with the strand
+// leaving the pore.
+func (reason EndReason) IsSignalPositive() bool {
+	return reason == EndReasonSignalPositive
+}
+
+// IsSignalNegative returns true if the read ended because the signal was
+// lost, like when the pore blocked.
+func (reason EndReason) IsSignalNegative() bool {
+	return reason == EndReasonSignalNegative
+}
+
+// Reason returns the read's end reason.
+func (read Read) Reason() EndReason {
+	return ParseEndReason(read.EndReason)
+}
+
+// SetReason sets the read's end reason.
+func (read *Read) SetReason(reason EndReason) {
+	read.EndReason = reason.String()
+}
+
+// EndReasons returns the header's end_reason enum, in the order of its
+// indexes.
+func (header Header) EndReasons() []EndReason {
+	labels := make([]string, 0, len(header.EndReasonHeaderMap))
+	for label := range header.EndReasonHeaderMap {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return header.EndReasonHeaderMap[labels[i]] < header.EndReasonHeaderMap[labels[j]]
+	})
+	reasons := make([]EndReason, len(labels))
+	for index, label := range labels {
+		reasons[index] = ParseEndReason(label)
+	}
+	return reasons
+}
+
+// HasEndReason returns a predicate for Filter that keeps reads with any of
+// reasons.
+func HasEndReason(reasons ...EndReason) func(Read) bool {
+	return func(read Read) bool {
+		reason := read.Reason()
+		for _, wanted := range reasons {
+			if reason == wanted {
+				return true
+			}
+		}
+		return false
+	}
+}
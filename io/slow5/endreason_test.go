@@ -0,0 +1,103 @@
+package slow5
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEndReason(t *testing.T) {
+	for label, reason := range knownEndReasons {
+		if ParseEndReason(label) != reason || reason.String() != label || reason.IsOther() {
+			t.Errorf("Expected %s to round trip, got %d and %s", label, ParseEndReason(label), reason.String())
+		}
+	}
+	if ParseEndReason("") != NoEndReason || NoEndReason.String() != "" {
+		t.Error("Expected an empty label to be NoEndReason")
+	}
+	novel := Other("cosmic_ray")
+	if !novel.IsOther() || novel.String() != "cosmic_ray" || Other("cosmic_ray") != novel || ParseEndReason("cosmic_ray") != novel {
+		t.Errorf("Expected a novel label to get one Other end reason, got %d", novel)
+	}
+	if Other("signal_positive") != EndReasonSignalPositive {
+		t.Error("Expected Other to return the constant of a known label")
+	}
+	if !EndReasonUnblockMuxChange.IsUnblock() || !EndReasonDataServiceUnblockMuxChange.IsUnblock() || EndReasonMuxChange.IsUnblock() {
+		t.Error("IsUnblock is wrong")
+	}
+	if !EndReasonSignalPositive.IsSignalPositive() || EndReasonSignalNegative.IsSignalPositive() || !EndReasonSignalNegative.IsSignalNegative() {
+		t.Error("IsSignalPositive or IsSignalNegative is wrong")
+	}
+}
+
+func TestParseNovelEndReason(t *testing.T) {
+	// endReason.slow5 has an enum starting with "bad", which poly doesn't
+	// know, and a read with end reason 0.
+	file, err := os.Open("data/read_tests/endReason.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open endReason.slow5: %s", err)
+	}
+	defer file.Close()
+	headers, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse a file with a novel end reason: %s", err)
+	}
+	enum := headers[0].EndReasons()
+	if len(enum) != 8 || enum[0] != Other("bad") || enum[7] != EndReasonSignalNegative {
+		t.Errorf("Expected bad to parse as Other, got %v", enum)
+	}
+	if len(reads) != 1 || reads[0].Reason() != Other("bad") || reads[0].EndReason != "bad" {
+		t.Errorf("Expected the read's end reason to be Other(\"bad\"), got %v", reads)
+	}
+}
+
+func TestNovelEndReasonRoundTrip(t *testing.T) {
+	// an enum starting with "bad", which poly doesn't know.
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example.slow5: %s", err)
+	}
+	headers, reads, err := ReadAll(strings.NewReader(strings.Replace(string(example), "enum{", "enum{bad,", 1)), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse a file with a novel end reason: %s", err)
+	}
+	enum := headers[0].EndReasons()
+	if len(enum) != 8 || !enum[0].IsOther() || enum[0].String() != "bad" || enum[1] != EndReasonUnknown {
+		t.Fatalf("Expected the novel end reason first in the enum, got %v", enum)
+	}
+	if reads[0].Reason() != EndReasonDataServiceUnblockMuxChange {
+		t.Errorf("Expected end reason 5 to be data_service_unblock_mux_change, got %s", reads[0].Reason())
+	}
+
+	reads[0].SetReason(Other("bad"))
+	var output strings.Builder
+	if err = Write(headers, sendAll(reads[:1]), &output); err != nil {
+		t.Fatalf("Failed to write a novel end reason: %s", err)
+	}
+	if !strings.Contains(output.String(), "enum{bad,unknown,partial,") {
+		t.Errorf("Expected the enum to keep its order, got:\n%s", output.String())
+	}
+	fields := strings.Split(strings.TrimSpace(output.String()[strings.LastIndex(strings.TrimSpace(output.String()), "\n")+1:]), "\t")
+	if fields[12] != "0" {
+		t.Errorf("Expected the novel end reason to be written as its original index 0, got %s", fields[12])
+	}
+	_, rereads, err := ReadAll(strings.NewReader(output.String()), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to reparse a novel end reason: %s", err)
+	}
+	if rereads[0].Reason() != Other("bad") {
+		t.Errorf("Expected the novel end reason to round trip, got %s", rereads[0].Reason())
+	}
+
+	// filtering and summaries use the typed end reason.
+	kept := 0
+	for range Filter(sendAll(rereads), HasEndReason(Other("bad"), EndReasonUnknown)) {
+		kept++
+	}
+	if kept != 1 {
+		t.Errorf("Expected HasEndReason to keep the read, kept %d", kept)
+	}
+	if summary := Summarize(sendAll(rereads)); summary.EndReasonCounts[Other("bad")] != 1 {
+		t.Errorf("Expected the novel end reason to be counted, got %v", summary.EndReasonCounts)
+	}
+}
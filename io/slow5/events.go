@@ -0,0 +1,155 @@
+package slow5
+
+import (
+	"math"
+	"sort"
+)
+
+/******************************************************************************
+
+Signal statistics and event detection begin here
+
+QC dashboards want a few numbers per read, like the mean and spread of its
+current, and these are all computed on the signal in picoamperes.
+
+Segment splits a read's signal into events, the stretches of roughly constant
+current as each k-mer sits in the pore, the same way scrappie and older
+basecallers do. At every sample it compares the windowSize samples before
+with the windowSize samples after using Welch's t statistic,
+
+	t = |mean2 - mean1| / sqrt((var1 + var2) / windowSize)
+
+which is large where the current steps. Boundaries are placed at peaks of t
+above threshold, at least windowSize samples apart, and each event is
+reported with its mean current. Running sums keep this linear in the length
+of the signal.
+
+******************************************************************************/
+
+// SignalSegment is an event of a read's signal, a stretch of samples with a
+// roughly constant current.
+type SignalSegment struct {
+	Start int     // Start is the index of the first sample of the segment.
+	End   int     // End is the index after the last sample of the segment.
+	Mean  float64 // Mean is the mean current of the segment in picoamperes.
+}
+
+// SignalMean returns the mean of the read's signal in picoamperes, or 0 for a
+// read without signal.
+func (read Read) SignalMean() float64 {
+	if len(read.RawSignal) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for index := range read.RawSignal {
+		sum += read.PicoampAt(index)
+	}
+	return sum / float64(len(read.RawSignal))
+}
+
+// SignalStdev returns the population standard deviation of the read's
+// signal in picoamperes, or 0 for a read without signal.
+func (read Read) SignalStdev() float64 {
+	if len(read.RawSignal) == 0 {
+		return 0
+	}
+	mean := read.SignalMean()
+	sum := 0.0
+	for index := range read.RawSignal {
+		difference := read.PicoampAt(index) - mean
+		sum += difference * difference
+	}
+	return math.Sqrt(sum / float64(len(read.RawSignal)))
+}
+
+// SignalMedian returns the median of the read's signal in picoamperes, or 0
+// for a read without signal. For an even number of samples it is the mean
+// of the middle two.
+func (read Read) SignalMedian() float64 {
+	if len(read.RawSignal) == 0 {
+		return 0
+	}
+	picoamps := read.Picoamps()
+	sort.Float64s(picoamps)
+	middle := len(picoamps) / 2
+	if len(picoamps)%2 == 0 {
+		return (picoamps[middle-1] + picoamps[middle]) / 2
+	}
+	return picoamps[middle]
+}
+
+// Segment splits the read's signal into events, placing a boundary wherever
+// the t statistic between the windowSize samples on either side of it peaks
+// above threshold. Boundaries are at least windowSize samples apart. Reads
+// without signal have no segments, and a windowSize below 1 or signal too
+// short for two windows gives a single segment.
+func (read Read) Segment(windowSize int, threshold float64) []SignalSegment {
+	length := len(read.RawSignal)
+	if length == 0 {
+		return nil
+	}
+	picoamps := read.Picoamps()
+	// sums[i] and squares[i] are the sums of the first i samples and of their squares.
+	sums := make([]float64, length+1)
+	squares := make([]float64, length+1)
+	for index, value := range picoamps {
+		sums[index+1] = sums[index] + value
+		squares[index+1] = squares[index] + value*value
+	}
+
+	var boundaries []int
+	if windowSize >= 1 && length >= 2*windowSize {
+		scores := make([]float64, length+1)
+		for index := windowSize; index <= length-windowSize; index++ {
+			scores[index] = tStatistic(sums, squares, index-windowSize, index, index+windowSize)
+		}
+		for index := windowSize; index <= length-windowSize; index++ {
+			if scores[index] > threshold && isPeak(scores, index, windowSize) {
+				boundaries = append(boundaries, index)
+			}
+		}
+	}
+
+	segments := make([]SignalSegment, 0, len(boundaries)+1)
+	start := 0
+	for _, end := range append(boundaries, length) {
+		segments = append(segments, SignalSegment{Start: start, End: end, Mean: (sums[end] - sums[start]) / float64(end-start)})
+		start = end
+	}
+	return segments
+}
+
+// tStatistic returns Welch's t statistic between the samples [start, middle)
+// and [middle, end), which must be the same length, from running sums.
+func tStatistic(sums, squares []float64, start, middle, end int) float64 {
+	size := float64(middle - start)
+	firstMean := (sums[middle] - sums[start]) / size
+	secondMean := (sums[end] - sums[middle]) / size
+	firstVariance := (squares[middle]-squares[start])/size - firstMean*firstMean
+	secondVariance := (squares[end]-squares[middle])/size - secondMean*secondMean
+	difference := math.Abs(secondMean - firstMean)
+	variance := (firstVariance + secondVariance) / size
+	// rounding can leave a tiny or negative variance for flat signal.
+	if variance <= 1e-12 {
+		if difference < 1e-9 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return difference / math.Sqrt(variance)
+}
+
+// isPeak returns true if scores[index] is the highest score within
+// windowSize of it. Ties go to the earliest score, so a flat peak gives one
+// boundary.
+func isPeak(scores []float64, index, windowSize int) bool {
+	for offset := 1; offset < windowSize; offset++ {
+		if index-offset >= 0 && scores[index-offset] >= scores[index] {
+			return false
+		}
+		if index+offset < len(scores) && scores[index+offset] > scores[index] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package slow5_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 
@@ -30,3 +31,41 @@ func ExampleNewParser() {
 	fmt.Println(outputReads[0].RawSignal[0:10])
 	// Output: [430 472 463 467 454 465 463 450 450 449]
 }
+
+func ExampleReadAll() {
+	file, _ := os.Open("data/example.slow5")
+	defer file.Close()
+	const maxLineSize = 2 * 32 * 1024
+	headers, reads, _ := slow5.ReadAll(file, maxLineSize)
+
+	fmt.Println(len(headers), len(reads), reads[0].ReadID)
+	// Output: 1 1 0026631e-33a3-49ab-aa22-3ab157d71f8b
+}
+
+func ExampleFilter() {
+	file, _ := os.Open("data/example.slow5")
+	defer file.Close()
+	const maxLineSize = 2 * 32 * 1024
+	parser, headers, _ := slow5.NewParser(file, maxLineSize)
+
+	reads := make(chan slow5.Read)
+	go func() {
+		defer close(reads)
+		for {
+			read, err := parser.ParseNext()
+			if err != nil {
+				// Break at EOF
+				break
+			}
+			reads <- read
+		}
+	}()
+
+	// keep reads whose strand left the pore normally.
+	var output bytes.Buffer
+	_ = slow5.Write(headers, slow5.Filter(reads, slow5.HasEndReason(slow5.EndReasonSignalPositive)), &output)
+
+	_, written, _ := slow5.ReadAll(&output, maxLineSize)
+	fmt.Println(len(written), written[0].Reason())
+	// Output: 1 signal_positive
+}
@@ -0,0 +1,143 @@
+package slow5
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+/******************************************************************************
+
+File helpers begin here
+
+slow5tools usually gzips the text form of slow5, and a .slow5.gz is a fraction
+of the size of the plain file. NewParserFromFile and WriteFile take care of
+opening, compressing and closing so nobody has to remember that a gzip.Writer
+that isn't closed silently drops the end of the file.
+
+Files are treated as gzipped if they end in .gz or start with the gzip magic
+bytes, so a gzipped file that lost its extension still parses.
+
+Streams that aren't files are decompressed by NewParserCompressed with
+whatever decoder they need. GzipDecoder covers both plain gzip and bgzf,
+since a bgzf file is a series of small gzip members that gzip reads one
+after another, and keeping those block boundaries is what will let an index
+seek into a compressed file later.
+
+******************************************************************************/
+
+var (
+	createFn   = os.Create
+	gzipMagic  = []byte{0x1f, 0x8b}
+	gzipSuffix = ".gz"
+)
+
+// NewParserFromFile opens the slow5 file at path, decompressing it if it is
+// gzipped, and parses its headers. The returned parser must be closed with
+// Close once done.
+func NewParserFromFile(path string, maxLineSize int) (*Parser, []Header, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	buffered := bufio.NewReader(file)
+	var reader io.Reader = buffered
+	closers := []io.Closer{file}
+
+	magic, _ := buffered.Peek(len(gzipMagic))
+	if strings.HasSuffix(path, gzipSuffix) || bytes.Equal(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		reader = gzipReader
+		closers = append([]io.Closer{gzipReader}, closers...)
+	}
+
+	parser, headers, err := NewParser(reader, maxLineSize)
+	if err != nil {
+		for _, closer := range closers {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	parser.closers = closers
+	return parser, headers, nil
+}
+
+// NewParserCompressed parses the headers of the compressed slow5 stream in
+// r, decompressed by decoder. If the decompressed reader is an io.Closer, it
+// is closed by the parser's Close, but r itself is left open.
+func NewParserCompressed(r io.Reader, maxLineSize int, decoder func(io.Reader) (io.Reader, error)) (*Parser, []Header, error) {
+	decoded, err := decoder(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	parser, headers, err := NewParser(decoded, maxLineSize)
+	closer, isCloser := decoded.(io.Closer)
+	if err != nil {
+		if isCloser {
+			closer.Close()
+		}
+		return nil, nil, err
+	}
+	if isCloser {
+		parser.closers = []io.Closer{closer}
+	}
+	return parser, headers, nil
+}
+
+// GzipDecoder is a decoder for NewParserCompressed that reads gzip, including
+// bgzf and other multi-member gzip streams.
+func GzipDecoder(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// Close closes any readers opened by NewParserFromFile or
+// NewParserCompressed. It is safe to call on parsers made with NewParser,
+// where it does nothing.
+func (parser *Parser) Close() error {
+	var firstErr error
+	for _, closer := range parser.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	parser.closers = nil
+	return firstErr
+}
+
+// WriteFile writes headers and reads to a slow5 file at path, gzipping it if
+// path ends in .gz. The file is always flushed and closed, even if writing
+// fails, and the first error encountered is returned.
+func WriteFile(headers []Header, reads <-chan Read, path string) (err error) {
+	file, err := createFn(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	if !strings.HasSuffix(path, gzipSuffix) {
+		writer := bufio.NewWriter(file)
+		if err = Write(headers, reads, writer); err != nil {
+			return err
+		}
+		return writer.Flush()
+	}
+
+	gzipWriter := gzip.NewWriter(file)
+	defer func() {
+		if closeErr := gzipWriter.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	return Write(headers, reads, gzipWriter)
+}
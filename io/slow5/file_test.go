@@ -0,0 +1,211 @@
+package slow5
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// parseAll reads every read out of a parser.
+func parseAll(t *testing.T, parser *Parser) []Read {
+	var reads []Read
+	for {
+		read, err := parser.ParseNext()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatal(err)
+			}
+			return reads
+		}
+		reads = append(reads, read)
+	}
+}
+
+// sendAll sends reads on a closed channel.
+func sendAll(reads []Read) <-chan Read {
+	channel := make(chan Read, len(reads))
+	for _, read := range reads {
+		channel <- read
+	}
+	close(channel)
+	return channel
+}
+
+func TestWriteFileRoundTrip(t *testing.T) {
+	parser, headers, err := NewParserFromFile("data/example.slow5", maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := parseAll(t, parser)
+	if err := parser.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+	for _, name := range []string{"example.slow5", "example.slow5.gz"} {
+		path := filepath.Join(tmpDir, name)
+		if err := WriteFile(headers, sendAll(reads), path); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		written, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isGzip := bytes.HasPrefix(written, gzipMagic); isGzip != (filepath.Ext(name) == ".gz") {
+			t.Errorf("%s: gzip magic present is %t", name, isGzip)
+		}
+
+		roundTripParser, roundTripHeaders, err := NewParserFromFile(path, maxLineSize)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		roundTripReads := parseAll(t, roundTripParser)
+		if err := roundTripParser.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(headers, roundTripHeaders) {
+			t.Errorf("%s: headers changed in round trip", name)
+		}
+		if !reflect.DeepEqual(reads, roundTripReads) {
+			t.Errorf("%s: reads changed in round trip", name)
+		}
+	}
+
+	// the plain path writes exactly what Write does.
+	var expected bytes.Buffer
+	if err := Write(headers, sendAll(reads), &expected); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := os.ReadFile(filepath.Join(tmpDir, "example.slow5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected.Bytes(), plain) {
+		t.Errorf("WriteFile without .gz should match Write")
+	}
+
+	// gzipped files are detected by their magic bytes too.
+	if err := os.Rename(filepath.Join(tmpDir, "example.slow5.gz"), filepath.Join(tmpDir, "renamed")); err != nil {
+		t.Fatal(err)
+	}
+	renamedParser, _, err := NewParserFromFile(filepath.Join(tmpDir, "renamed"), maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renamedParser.Close()
+	if renamedReads := parseAll(t, renamedParser); !reflect.DeepEqual(reads, renamedReads) {
+		t.Errorf("gzipped file without .gz suffix parsed differently")
+	}
+}
+
+func TestNewParserFromFileErrors(t *testing.T) {
+	if _, _, err := NewParserFromFile("data/does_not_exist.slow5", maxLineSize); err == nil {
+		t.Errorf("missing file should fail")
+	}
+	if _, _, err := NewParserFromFile("data/example.slow5.gz", maxLineSize); err == nil {
+		t.Errorf("missing gzipped file should fail")
+	}
+	// a plain file named .gz isn't gzipped.
+	path := filepath.Join(t.TempDir(), "plain.slow5.gz")
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, example, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewParserFromFile(path, maxLineSize); err == nil {
+		t.Errorf("plain file with a .gz suffix should fail")
+	}
+	if _, _, err := NewParserFromFile("data/header_tests/test_header_empty.slow5", maxLineSize); err == nil {
+		t.Errorf("bad headers should fail")
+	}
+	if err := WriteFile(nil, nil, filepath.Join(t.TempDir(), "missing", "dir.slow5")); err == nil {
+		t.Errorf("writing to a missing directory should fail")
+	}
+}
+
+// bgzf compresses data as bgzf: gzip members of blockSize bytes of data
+// each, with their compressed size in a BC extra field, followed by an empty
+// EOF block. htslib uses blocks of 0xff00 bytes.
+func bgzf(t *testing.T, data []byte, blockSize int) []byte {
+	var output bytes.Buffer
+	for start := 0; start <= len(data); start += blockSize {
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		var block bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&block, gzip.BestCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		if _, err = writer.Write(data[start:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// BSIZE, the block size minus 1, follows the 12 byte gzip header and
+		// the 4 bytes of the extra subfield's header.
+		binary.LittleEndian.PutUint16(block.Bytes()[16:], uint16(block.Len()-1))
+		output.Write(block.Bytes())
+		if end == len(data) {
+			break
+		}
+	}
+	// the EOF block is an empty member.
+	output.Write([]byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0, 0x1b, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	return output.Bytes()
+}
+
+func TestNewParserCompressed(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, expectedHeaders, err := NewParser(bytes.NewReader(example), maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := parseAll(t, parser)
+
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	if _, err = writer.Write(example); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// small blocks split the example read, so it is read across blocks.
+	bgzipped := bgzf(t, example, 4096)
+	if !bytes.Equal(bgzipped[12:14], []byte("BC")) || bytes.Count(bgzipped, []byte{0x1f, 0x8b, 8, 4}) < 5 {
+		t.Fatal("Expected the bgzf file to be several BC blocks")
+	}
+
+	for name, compressed := range map[string][]byte{"gzip": gzipped.Bytes(), "bgzf": bgzipped} {
+		parser, headers, err := NewParserCompressed(bytes.NewReader(compressed), maxLineSize, GzipDecoder)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		reads := parseAll(t, parser)
+		if err = parser.Close(); err != nil {
+			t.Errorf("%s: failed to close: %s", name, err)
+		}
+		if !reflect.DeepEqual(headers, expectedHeaders) || !reflect.DeepEqual(reads, expected) {
+			t.Errorf("%s: parsed differently from the uncompressed file", name)
+		}
+	}
+
+	if _, _, err = NewParserCompressed(bytes.NewReader(example), maxLineSize, GzipDecoder); err == nil {
+		t.Error("Expected GzipDecoder to fail on an uncompressed file")
+	}
+}
@@ -0,0 +1,312 @@
+package slow5
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/******************************************************************************
+
+Header validation begins here
+
+slow5 itself doesn't care which attributes a header has, but slow5tools and
+the tools downstream of it expect the ones MinKNOW writes, and an attribute
+key with a typo is silently carried along until something looks for it.
+Header.Validate checks attributes against KnownHeaderAttributes, the keys
+Nanopore software writes, so typos show up as warnings before a file is
+written.
+
+******************************************************************************/
+
+var (
+	// ErrUnknownAttribute is wrapped by warnings from Header.Validate about
+	// attributes not in KnownHeaderAttributes.
+	ErrUnknownAttribute = errors.New("unknown header attribute")
+	// ErrMissingAttribute is wrapped by errors from Header.Validate about
+	// required attributes that are missing.
+	ErrMissingAttribute = errors.New("missing required header attribute")
+	// ErrInvalidAttribute is wrapped by errors from Header.Validate about
+	// attribute values that can't be right.
+	ErrInvalidAttribute = errors.New("invalid header attribute")
+	// ErrNoHeaders is wrapped by the error from ValidateHeaders for an empty
+	// list of headers.
+	ErrNoHeaders = errors.New("no headers")
+	// ErrInconsistentVersion is wrapped by the error from ValidateHeaders
+	// for headers with different slow5 versions.
+	ErrInconsistentVersion = errors.New("inconsistent slow5 versions")
+	// ErrReadGroupID is wrapped by the error from ValidateHeaders for
+	// headers whose read group IDs aren't 0 to n-1 in order.
+	ErrReadGroupID = errors.New("read group IDs must be 0 to n-1 in order")
+)
+
+// KnownHeaderAttributes are the header attributes written by Nanopore
+// software, mapped to whether they are required. Add to it to accept other
+// attributes.
+var KnownHeaderAttributes = map[string]bool{
+	"@asic_id":                         true,
+	"@asic_id_eeprom":                  false,
+	"@asic_temp":                       false,
+	"@asic_version":                    false,
+	"@auto_update":                     false,
+	"@auto_update_source":              false,
+	"@barcoding_enabled":               false,
+	"@barcoding_kit":                   false,
+	"@basecall_config_filename":        false,
+	"@bream_is_standard":               false,
+	"@configuration_version":           false,
+	"@device_id":                       false,
+	"@device_type":                     false,
+	"@distribution_status":             false,
+	"@distribution_version":            false,
+	"@exp_script_name":                 false,
+	"@exp_script_purpose":              false,
+	"@exp_start_time":                  false,
+	"@experiment_duration_set":         false,
+	"@experiment_kit":                  false,
+	"@experiment_type":                 false,
+	"@file_type":                       false,
+	"@file_version":                    false,
+	"@filename":                        false,
+	"@flongle_adapter_id":              false,
+	"@flow_cell_id":                    false,
+	"@flow_cell_product_code":          false,
+	"@guppy_version":                   false,
+	"@heatsink_temp":                   false,
+	"@host_product_code":               false,
+	"@host_product_serial_number":      false,
+	"@hostname":                        false,
+	"@installation_type":               false,
+	"@local_basecalling":               false,
+	"@local_firmware_file":             false,
+	"@operating_system":                false,
+	"@package":                         false,
+	"@package_version":                 false,
+	"@pore_type":                       false,
+	"@protocol_group_id":               false,
+	"@protocol_run_id":                 false,
+	"@protocol_start_time":             false,
+	"@protocols_version":               false,
+	"@run_id":                          true,
+	"@sample_frequency":                true,
+	"@sample_id":                       false,
+	"@sample_type":                     false,
+	"@selected_speed_bases_per_second": false,
+	"@sequencing_kit":                  false,
+	"@usb_config":                      false,
+	"@user_filename_input":             false,
+	"@version":                         false,
+}
+
+// Validate checks the header's attributes against KnownHeaderAttributes. It
+// returns a warning wrapping ErrUnknownAttribute for each unknown attribute,
+// and an error wrapping ErrMissingAttribute or ErrInvalidAttribute for each
+// missing required attribute or impossible value, like a sample frequency
+// that isn't a positive number. Use errors.Is to tell them apart. Problems
+// are sorted by attribute, and nil means the header is fine.
+func (header Header) Validate() []error {
+	var problems []error
+	keys := make([]string, 0, len(header.Attributes))
+	for key := range header.Attributes {
+		keys = append(keys, key)
+	}
+	for key, required := range KnownHeaderAttributes {
+		if _, ok := header.Attributes[key]; required && !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, ok := header.Attributes[key]
+		required, known := KnownHeaderAttributes[key]
+		switch {
+		case !ok || (required && value == "."):
+			problems = append(problems, fmt.Errorf("read group %d: %w %s", header.ReadGroupID, ErrMissingAttribute, key))
+		case strings.ContainsAny(key+value, "\t\n"):
+			problems = append(problems, fmt.Errorf("read group %d: %w %s: tabs and newlines aren't allowed", header.ReadGroupID, ErrInvalidAttribute, key))
+		case !known:
+			problems = append(problems, fmt.Errorf("read group %d: %w %s", header.ReadGroupID, ErrUnknownAttribute, key))
+		case key == "@sample_frequency":
+			if frequency, err := strconv.ParseFloat(value, 64); err != nil || frequency <= 0 {
+				problems = append(problems, fmt.Errorf("read group %d: %w %s: %q isn't a positive number", header.ReadGroupID, ErrInvalidAttribute, key, value))
+			}
+		}
+	}
+	return problems
+}
+
+// ValidateHeaders checks that headers can be written as one slow5 file:
+// there is at least one, they have the same Slow5Version, each one's
+// ReadGroupID is its index, since read groups are written in order, and each
+// has the required attributes of KnownHeaderAttributes. It returns the first
+// problem found, wrapping ErrNoHeaders, ErrInconsistentVersion,
+// ErrReadGroupID or ErrMissingAttribute, or nil if the headers are fine.
+func ValidateHeaders(headers []Header) error {
+	if len(headers) == 0 {
+		return ErrNoHeaders
+	}
+	for index, header := range headers {
+		if header.Slow5Version != headers[0].Slow5Version {
+			return fmt.Errorf("read group %d has version %q, but read group %d has %q: %w", header.ReadGroupID, header.Slow5Version, headers[0].ReadGroupID, headers[0].Slow5Version, ErrInconsistentVersion)
+		}
+		if header.ReadGroupID != uint32(index) {
+			return fmt.Errorf("header %d has read group ID %d: %w", index, header.ReadGroupID, ErrReadGroupID)
+		}
+		for _, problem := range header.Validate() {
+			if errors.Is(problem, ErrMissingAttribute) {
+				return problem
+			}
+		}
+	}
+	return nil
+}
+
+/******************************************************************************
+
+Header reconciliation begins here
+
+Headers built in code, like by Merge or from fast5 files, often disagree.
+Some read groups have attributes others don't, which Write quietly fills
+with ".", and some attributes describe the run and hardware rather than the
+read group, so read groups split from one run must agree on them. A file
+where two read groups of the same flowcell have different asic_ids was
+put together wrong, and nothing downstream will notice.
+
+ReconcileHeaders finds both problems and applies a ReconcilePolicy: keep the
+headers as they are, refuse to go on, or take the first read group's value.
+Either way it returns the conflicts so they can be reported.
+
+******************************************************************************/
+
+// RunAttributes are the header attributes that describe a sequencing run and
+// its hardware, so every read group of a file must agree on them. Add to it
+// or remove from it to change what ReconcileHeaders checks.
+var RunAttributes = map[string]bool{
+	"@asic_id":          true,
+	"@asic_id_eeprom":   true,
+	"@device_id":        true,
+	"@exp_start_time":   true,
+	"@flow_cell_id":     true,
+	"@run_id":           true,
+	"@sample_frequency": true,
+}
+
+// ReconcilePolicy is what ReconcileHeaders does about conflicts.
+type ReconcilePolicy int
+
+const (
+	// KeepAll returns the headers unchanged, so missing attributes are
+	// written as ".".
+	KeepAll ReconcilePolicy = iota
+	// RequireConsistent returns no headers if there are any conflicts.
+	RequireConsistent
+	// PreferFirst sets each of the RunAttributes of every header to its
+	// value in the first header that has it. Other missing attributes are
+	// left for Write to fill with ".".
+	PreferFirst
+)
+
+// ConflictKind is the kind of a Conflict between headers.
+type ConflictKind int
+
+const (
+	// MissingAttribute is an attribute some read groups have and others
+	// don't. An attribute with the value "." is missing.
+	MissingAttribute ConflictKind = iota
+	// InconsistentAttribute is one of the RunAttributes with different
+	// values in different read groups.
+	InconsistentAttribute
+)
+
+// Conflict is an attribute the headers of a file disagree on.
+type Conflict struct {
+	Attribute string
+	Kind      ConflictKind
+	// Values are the attribute's value in each read group, keyed by
+	// ReadGroupID. Read groups without the attribute aren't in it.
+	Values map[uint32]string
+}
+
+// Error describes the conflict, so conflicts can be reported as errors.
+func (conflict Conflict) Error() string {
+	readGroupIDs := make([]int, 0, len(conflict.Values))
+	for readGroupID := range conflict.Values {
+		readGroupIDs = append(readGroupIDs, int(readGroupID))
+	}
+	sort.Ints(readGroupIDs)
+	values := make([]string, len(readGroupIDs))
+	for index, readGroupID := range readGroupIDs {
+		values[index] = fmt.Sprintf("%d=%s", readGroupID, conflict.Values[uint32(readGroupID)])
+	}
+	if conflict.Kind == MissingAttribute {
+		return fmt.Sprintf("attribute %s is only in some read groups: %s", conflict.Attribute, strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("attribute %s differs between read groups: %s", conflict.Attribute, strings.Join(values, ", "))
+}
+
+// ReconcileHeaders finds attributes that only some of headers have, and
+// RunAttributes that differ between them, and applies policy. It returns the
+// headers sorted by ReadGroupID, which are copies that can be changed without
+// changing headers, along with every conflict sorted by attribute, whatever
+// the policy. Under RequireConsistent the returned headers are nil if there
+// are any conflicts.
+func ReconcileHeaders(headers []Header, policy ReconcilePolicy) ([]Header, []Conflict) {
+	reconciled := make([]Header, len(headers))
+	for index, header := range headers {
+		attributes := make(map[string]string, len(header.Attributes))
+		for key, value := range header.Attributes {
+			attributes[key] = value
+		}
+		header.Attributes = attributes
+		reconciled[index] = header
+	}
+	sort.SliceStable(reconciled, func(i, j int) bool {
+		return reconciled[i].ReadGroupID < reconciled[j].ReadGroupID
+	})
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, header := range reconciled {
+		for key, value := range header.Attributes {
+			if value != "." && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var conflicts []Conflict
+	for _, key := range keys {
+		values := make(map[uint32]string)
+		distinct := make(map[string]bool)
+		first := ""
+		for _, header := range reconciled {
+			if value, ok := header.Attributes[key]; ok && value != "." {
+				if len(values) == 0 {
+					first = value
+				}
+				values[header.ReadGroupID] = value
+				distinct[value] = true
+			}
+		}
+		if len(values) < len(reconciled) {
+			conflicts = append(conflicts, Conflict{Attribute: key, Kind: MissingAttribute, Values: values})
+		}
+		if RunAttributes[key] && len(distinct) > 1 {
+			conflicts = append(conflicts, Conflict{Attribute: key, Kind: InconsistentAttribute, Values: values})
+		}
+		if policy == PreferFirst && RunAttributes[key] {
+			for _, header := range reconciled {
+				header.Attributes[key] = first
+			}
+		}
+	}
+	if policy == RequireConsistent && len(conflicts) > 0 {
+		return nil, conflicts
+	}
+	return reconciled, conflicts
+}
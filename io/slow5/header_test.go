@@ -0,0 +1,183 @@
+package slow5
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestHeaderValidate(t *testing.T) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open example.slow5: %s", err)
+	}
+	defer file.Close()
+	_, headers, err := NewParser(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	if problems := headers[0].Validate(); problems != nil {
+		t.Errorf("Expected example.slow5 to have a valid header, got %v", problems)
+	}
+
+	header := Header{Attributes: map[string]string{
+		"@asic_id":          "4175987214",
+		"@sample_frequency": "fast",
+		"@flowcell_id":      "AEI279", // typo of @flow_cell_id
+		"@device_type":      "minion\t",
+	}}
+	problems := header.Validate()
+	expected := []error{ErrInvalidAttribute, ErrUnknownAttribute, ErrMissingAttribute, ErrInvalidAttribute}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for index, problem := range problems {
+		if !errors.Is(problem, expected[index]) {
+			t.Errorf("Expected problem %d to be %v, got %v", index, expected[index], problem)
+		}
+	}
+
+	// known attributes can be extended.
+	KnownHeaderAttributes["@flowcell_id"] = false
+	defer delete(KnownHeaderAttributes, "@flowcell_id")
+	if problems = header.Validate(); len(problems) != 3 {
+		t.Errorf("Expected @flowcell_id to be accepted once known, got %v", problems)
+	}
+}
+
+// reconcileTestHeaders are three read groups of one run, split and put back
+// together badly: read group 1 has another asic_id, and only read group 2
+// has a sample_id.
+func reconcileTestHeaders() []Header {
+	return []Header{
+		{ReadGroupID: 2, Attributes: map[string]string{"@asic_id": "4175987214", "@run_id": "bfdfd1d8", "@sample_frequency": "4000", "@sample_id": "sample"}},
+		{ReadGroupID: 0, Attributes: map[string]string{"@asic_id": "4175987214", "@run_id": "bfdfd1d8", "@sample_frequency": "4000", "@sample_id": "."}},
+		{ReadGroupID: 1, Attributes: map[string]string{"@asic_id": "1234567890", "@run_id": "bfdfd1d8", "@sample_frequency": "4000"}},
+	}
+}
+
+func TestReconcileHeaders(t *testing.T) {
+	expectedConflicts := []Conflict{
+		{Attribute: "@asic_id", Kind: InconsistentAttribute, Values: map[uint32]string{0: "4175987214", 1: "1234567890", 2: "4175987214"}},
+		{Attribute: "@sample_id", Kind: MissingAttribute, Values: map[uint32]string{2: "sample"}},
+	}
+	checkConflicts := func(policy ReconcilePolicy, conflicts []Conflict) {
+		t.Helper()
+		if len(conflicts) != len(expectedConflicts) {
+			t.Fatalf("Policy %d: expected %d conflicts, got %v", policy, len(expectedConflicts), conflicts)
+		}
+		for index, conflict := range conflicts {
+			if conflict.Error() != expectedConflicts[index].Error() || conflict.Kind != expectedConflicts[index].Kind {
+				t.Errorf("Policy %d: expected conflict %q, got %q", policy, expectedConflicts[index], conflict)
+			}
+		}
+	}
+
+	// KeepAll sorts the headers but doesn't change them.
+	headers := reconcileTestHeaders()
+	reconciled, conflicts := ReconcileHeaders(headers, KeepAll)
+	checkConflicts(KeepAll, conflicts)
+	for index, header := range reconciled {
+		if header.ReadGroupID != uint32(index) {
+			t.Errorf("Expected header %d to be read group %d, got %d", index, index, header.ReadGroupID)
+		}
+	}
+	if reconciled[1].Attributes["@asic_id"] != "1234567890" {
+		t.Errorf("Expected KeepAll to keep asic_id 1234567890, got %s", reconciled[1].Attributes["@asic_id"])
+	}
+
+	// RequireConsistent returns no headers.
+	reconciled, conflicts = ReconcileHeaders(reconcileTestHeaders(), RequireConsistent)
+	checkConflicts(RequireConsistent, conflicts)
+	if reconciled != nil {
+		t.Errorf("Expected RequireConsistent to return no headers, got %v", reconciled)
+	}
+	if reconciled, conflicts = ReconcileHeaders(reconcileTestHeaders()[:1], RequireConsistent); len(reconciled) != 1 || conflicts != nil {
+		t.Errorf("Expected one header to be consistent, got %v", conflicts)
+	}
+
+	// PreferFirst takes the asic_id of read group 0, and leaves the input alone.
+	headers = reconcileTestHeaders()
+	reconciled, conflicts = ReconcileHeaders(headers, PreferFirst)
+	checkConflicts(PreferFirst, conflicts)
+	if reconciled[1].Attributes["@asic_id"] != "4175987214" {
+		t.Errorf("Expected PreferFirst to set asic_id to 4175987214, got %s", reconciled[1].Attributes["@asic_id"])
+	}
+	if _, ok := reconciled[1].Attributes["@sample_id"]; ok {
+		t.Error("Expected PreferFirst to leave sample_id missing, since it isn't a run attribute")
+	}
+	if headers[2].Attributes["@asic_id"] != "1234567890" {
+		t.Error("Expected ReconcileHeaders not to change its input")
+	}
+	if _, conflicts = ReconcileHeaders(reconciled, RequireConsistent); len(conflicts) != 1 || conflicts[0].Kind != MissingAttribute {
+		t.Errorf("Expected only the missing sample_id after PreferFirst, got %v", conflicts)
+	}
+}
+
+func TestWriteStrictHeaders(t *testing.T) {
+	headers, _ := ReconcileHeaders(reconcileTestHeaders(), KeepAll)
+	for index := range headers {
+		headers[index].Slow5Version = "0.2.0"
+	}
+	for _, strict := range []bool{false, true} {
+		var options []WriteOption
+		if strict {
+			options = append(options, WithStrictHeaders())
+		}
+		reads := make(chan Read)
+		close(reads)
+		err := Write(headers, reads, io.Discard, options...)
+		if strict && err == nil {
+			t.Error("Expected Write with strict headers to refuse conflicting headers")
+		}
+		if !strict && err != nil {
+			t.Errorf("Expected Write to fill in conflicting headers, got %s", err)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	valid := func() []Header {
+		headers, _ := ReconcileHeaders(reconcileTestHeaders(), PreferFirst)
+		for index := range headers {
+			headers[index].Slow5Version = "0.2.0"
+		}
+		return headers
+	}
+	if err := ValidateHeaders(valid()); err != nil {
+		t.Errorf("Expected valid headers, got %s", err)
+	}
+
+	// Write used to panic on no headers.
+	reads := make(chan Read)
+	close(reads)
+	if err := Write(nil, reads, io.Discard); !errors.Is(err, ErrNoHeaders) {
+		t.Errorf("Expected Write to fail with ErrNoHeaders, got %v", err)
+	}
+
+	versions := valid()
+	versions[2].Slow5Version = "0.1.0"
+	outOfOrder := valid()
+	outOfOrder[0], outOfOrder[1] = outOfOrder[1], outOfOrder[0]
+	gap := valid()
+	gap[2].ReadGroupID = 3
+	missing := valid()
+	delete(missing[1].Attributes, "@run_id")
+	for name, test := range map[string]struct {
+		headers  []Header
+		expected error
+	}{
+		"versions":     {versions, ErrInconsistentVersion},
+		"out of order": {outOfOrder, ErrReadGroupID},
+		"gap":          {gap, ErrReadGroupID},
+		"missing":      {missing, ErrMissingAttribute},
+	} {
+		if err := ValidateHeaders(test.headers); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, err)
+		}
+		if err := Write(test.headers, reads, io.Discard); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected Write to fail with %v, got %v", name, test.expected, err)
+		}
+	}
+}
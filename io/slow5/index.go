@@ -0,0 +1,288 @@
+package slow5
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+/******************************************************************************
+
+slow5 index begins here
+
+slow5tools keeps a .idx file next to every slow5 file mapping each read ID to
+the byte range of its record, so a single read can be pulled out of a huge
+file by seeking straight to it instead of parsing everything before it.
+
+The index format is binary and little endian:
+
+	magic           "SLOW5IDX\1"
+	version         3 uint8s, the slow5 version of the indexed file
+	padding         zeros up to 64 bytes
+	entries         uint16 read ID length, read ID, uint64 offset, uint64 size
+	EOF marker      "XDI5WOLS"
+
+For slow5 files the offset is the start of the read's line and the size
+includes its newline.
+
+There are two ways to use an index. NewIndex indexes a file (or loads its
+sidecar index) and fetches reads itself with GetRead, which is safe to call
+from many goroutines at once. A Parser reading from an io.ReadSeeker can also
+jump to a read with ReadAt, using an index from BuildIndex or LoadIndex.
+
+******************************************************************************/
+
+var (
+	indexMagic      = []byte{'S', 'L', 'O', 'W', '5', 'I', 'D', 'X', 1}
+	indexEOF        = []byte{'X', 'D', 'I', '5', 'W', 'O', 'L', 'S'}
+	indexHeaderSize = 64
+)
+
+// Index maps read IDs to where their records are in a slow5 file.
+type Index struct {
+	Version string   // Version is the slow5 version of the indexed file.
+	ReadIDs []string // ReadIDs are in file order.
+	entries map[string]indexEntry
+
+	// set by NewIndex, for GetRead.
+	data         io.ReaderAt
+	headerMap    map[int]string
+	endReasonMap map[int]string
+}
+
+// indexEntry is the byte range of a record.
+type indexEntry struct {
+	offset, size uint64
+}
+
+// addEntry adds a read to the index.
+func (index *Index) addEntry(readID string, offset, size uint64) error {
+	if _, ok := index.entries[readID]; ok {
+		return fmt.Errorf("read ID %s is in the index more than once", readID)
+	}
+	index.ReadIDs = append(index.ReadIDs, readID)
+	index.entries[readID] = indexEntry{offset: offset, size: size}
+	return nil
+}
+
+// NewIndex indexes the slow5 file r so reads can be fetched with GetRead. If
+// r is a file (anything with a Name method, like *os.File) with an index next
+// to it, named like reads.slow5.idx, that index is loaded. Otherwise r is
+// scanned to build one.
+func NewIndex(r io.ReaderAt) (*Index, error) {
+	parser, _, err := NewParser(io.NewSectionReader(r, 0, math.MaxInt64), parallelMaxLineSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var index *Index
+	if named, ok := r.(interface{ Name() string }); ok {
+		if sidecar, err := openFn(named.Name() + ".idx"); err == nil {
+			index, err = parseIndex(bufio.NewReader(sidecar))
+			sidecar.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s.idx: %w", named.Name(), err)
+			}
+		}
+	}
+	if index == nil {
+		if index, err = parser.BuildIndex(); err != nil {
+			return nil, err
+		}
+	}
+	index.data = r
+	index.headerMap = parser.headerMap
+	index.endReasonMap = parser.endReasonMap
+	return index, nil
+}
+
+// GetRead reads and parses the read readID from the file given to NewIndex.
+// It is safe to call from many goroutines at once.
+func (index *Index) GetRead(readID string) (Read, error) {
+	if index.data == nil {
+		return Read{}, errors.New("index has no file to read from. Make it with NewIndex")
+	}
+	entry, ok := index.entries[readID]
+	if !ok {
+		return Read{}, fmt.Errorf("read %s is not in the index", readID)
+	}
+	record := make([]byte, entry.size)
+	// ReadAt may return io.EOF along with the last record of the file.
+	if n, err := index.data.ReadAt(record, int64(entry.offset)); n != len(record) {
+		return Read{}, fmt.Errorf("failed to read %s: %w", readID, err)
+	}
+	parser := &Parser{
+		reader:       *bufio.NewReaderSize(bytes.NewReader(record), len(record)+1),
+		headerMap:    index.headerMap,
+		endReasonMap: index.endReasonMap,
+	}
+	read, err := parser.ParseNext()
+	if err != nil {
+		return Read{}, err
+	}
+	if read.ReadID != readID {
+		return Read{}, fmt.Errorf("index is out of date: expected read %s at offset %d, found %s", readID, entry.offset, read.ReadID)
+	}
+	return read, nil
+}
+
+// BuildIndex indexes the reads left in a parser by scanning them, without
+// parsing their signal. Build the index right after NewParser to index the
+// whole file.
+func (parser *Parser) BuildIndex() (*Index, error) {
+	index := &Index{Version: parser.version, entries: make(map[string]indexEntry)}
+	for {
+		lineBytes, err := parser.reader.ReadSlice('\n')
+		if len(bytes.TrimSpace(lineBytes)) > 0 {
+			offset := parser.offset
+			readID := lineBytes
+			if tab := bytes.IndexByte(lineBytes, '\t'); tab != -1 {
+				readID = lineBytes[:tab]
+			}
+			if indexErr := index.addEntry(string(readID), uint64(offset), uint64(len(lineBytes))); indexErr != nil {
+				return nil, indexErr
+			}
+		}
+		parser.line++
+		parser.offset += int64(len(lineBytes))
+		if errors.Is(err, io.EOF) {
+			return index, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to index line %d: %w", parser.line, err)
+		}
+	}
+}
+
+// ReadAt parses the read readID by seeking straight to it using index. The
+// parser must read from an io.ReadSeeker, like an uncompressed os.File.
+// Parsing continues from the read after readID.
+func (parser *Parser) ReadAt(index *Index, readID string) (Read, error) {
+	entry, ok := index.entries[readID]
+	if !ok {
+		return Read{}, fmt.Errorf("read %s is not in the index", readID)
+	}
+	seeker, ok := parser.source.(io.Seeker)
+	if !ok {
+		return Read{}, errors.New("parser can't seek. Use a parser reading from an io.ReadSeeker")
+	}
+	if _, err := seeker.Seek(int64(entry.offset), io.SeekStart); err != nil {
+		return Read{}, err
+	}
+	parser.reader.Reset(parser.source)
+	parser.offset = int64(entry.offset)
+	read, err := parser.ParseNext()
+	if err != nil {
+		return Read{}, err
+	}
+	if read.ReadID != readID {
+		return Read{}, fmt.Errorf("index is out of date: expected read %s at offset %d, found %s", readID, entry.offset, read.ReadID)
+	}
+	return read, nil
+}
+
+// LoadIndex reads a slow5 index file, usually named like reads.slow5.idx.
+func LoadIndex(path string) (*Index, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseIndex(bufio.NewReader(file))
+}
+
+// parseIndex reads an index from r.
+func parseIndex(r io.Reader) (*Index, error) {
+	header := make([]byte, indexHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read index header: %w", err)
+	}
+	if !bytes.Equal(header[:len(indexMagic)], indexMagic) {
+		return nil, fmt.Errorf("not a slow5 index: expected magic bytes %q, got %q", indexMagic, header[:len(indexMagic)])
+	}
+	version := header[len(indexMagic) : len(indexMagic)+3]
+	index := &Index{
+		Version: fmt.Sprintf("%d.%d.%d", version[0], version[1], version[2]),
+		entries: make(map[string]indexEntry),
+	}
+
+	for {
+		// an entry starts with a 2 byte read ID length, and the EOF marker
+		// is longer than that, so read 2 bytes and check for the marker.
+		start := make([]byte, 2)
+		if _, err := io.ReadFull(r, start); err != nil {
+			return nil, fmt.Errorf("index ends after %d entries without an EOF marker: %w", len(index.ReadIDs), io.ErrUnexpectedEOF)
+		}
+		if bytes.Equal(start, indexEOF[:2]) {
+			rest := make([]byte, len(indexEOF)-2)
+			if _, err := io.ReadFull(r, rest); err == nil && bytes.Equal(rest, indexEOF[2:]) {
+				return index, nil
+			}
+			return nil, fmt.Errorf("index entry %d is corrupt", len(index.ReadIDs))
+		}
+
+		readID := make([]byte, binary.LittleEndian.Uint16(start))
+		var entry indexEntry
+		if _, err := io.ReadFull(r, readID); err != nil {
+			return nil, fmt.Errorf("failed to read index entry %d: %w", len(index.ReadIDs), err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry.offset); err != nil {
+			return nil, fmt.Errorf("failed to read index entry %d: %w", len(index.ReadIDs), err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry.size); err != nil {
+			return nil, fmt.Errorf("failed to read index entry %d: %w", len(index.ReadIDs), err)
+		}
+		if err := index.addEntry(string(readID), entry.offset, entry.size); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WriteIndex writes index to path in the slow5tools index format.
+func WriteIndex(path string, index *Index) (err error) {
+	file, err := createFn(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	writer := bufio.NewWriter(file)
+	if err = index.WriteIndex(writer); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// WriteIndex writes the index to w in the slow5tools index format.
+func (index *Index) WriteIndex(w io.Writer) error {
+	version, err := parseBlow5Version(index.Version)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, indexHeaderSize)
+	copy(header, indexMagic)
+	copy(header[len(indexMagic):], version[:])
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	for _, readID := range index.ReadIDs {
+		entry := index.entries[readID]
+		if len(readID) > 0xffff {
+			return fmt.Errorf("read ID %s... is too long for an index", readID[:32])
+		}
+		for _, field := range []interface{}{uint16(len(readID)), []byte(readID), entry.offset, entry.size} {
+			if err = binary.Write(w, binary.LittleEndian, field); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = w.Write(indexEOF)
+	return err
+}
@@ -0,0 +1,169 @@
+package slow5
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	path := writeManyReads(t, 20)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := parser.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedParser, _, err := NewParserFromFile(path, maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := parseAll(t, expectedParser)
+	expectedParser.Close()
+	if len(index.ReadIDs) != len(reads) || index.Version != "0.2.0" {
+		t.Fatalf("expected %d reads of version 0.2.0, got %d of version %s", len(reads), len(index.ReadIDs), index.Version)
+	}
+
+	// jump around the file, then keep parsing from the last read.
+	for _, readNumber := range []int{len(reads) / 2, 0, len(reads) - 2} {
+		read, err := parser.ReadAt(index, reads[readNumber].ReadID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, reads[readNumber]) {
+			t.Errorf("read %d differs when read from the index", readNumber)
+		}
+	}
+	if next, err := parser.ParseNext(); err != nil || next.ReadID != reads[len(reads)-1].ReadID {
+		t.Errorf("parsing should continue after the read from the index, got %s and %v", next.ReadID, err)
+	}
+	if _, err := parser.ReadAt(index, "not a read"); err == nil {
+		t.Errorf("unknown read should fail")
+	}
+
+	indexPath := path + ".idx"
+	if err := WriteIndex(indexPath, index); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(index, loaded) {
+		t.Errorf("index differs after writing and loading")
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(bufio.NewReader(file), maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := parser.BuildIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ReadAt(index, index.ReadIDs[0]); err == nil {
+		t.Errorf("parser that can't seek should fail")
+	}
+
+	if _, err := LoadIndex("data/example.slow5"); err == nil || !strings.Contains(err.Error(), "magic bytes") {
+		t.Errorf("loading a slow5 file as an index should fail on magic bytes, got %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "truncated.idx")
+	if err := os.WriteFile(path, append(indexMagic, make([]byte, indexHeaderSize)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(path); err == nil {
+		t.Errorf("index without an EOF marker should fail")
+	}
+}
+
+func TestNewIndex(t *testing.T) {
+	path := writeManyReads(t, 30)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	index, err := NewIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.ReadIDs) != 30 {
+		t.Fatalf("expected 30 reads, got %d", len(index.ReadIDs))
+	}
+
+	parser, _, err := NewParserFromFile(path, maxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := parseAll(t, parser)
+	parser.Close()
+	var wait sync.WaitGroup
+	for readNumber := range reads {
+		wait.Add(1)
+		go func(readNumber int) {
+			defer wait.Done()
+			read, err := index.GetRead(reads[readNumber].ReadID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(read, reads[readNumber]) {
+				t.Errorf("read %d differs when read from the index", readNumber)
+			}
+		}(readNumber)
+	}
+	wait.Wait()
+	if _, err := index.GetRead("not a read"); err == nil {
+		t.Errorf("unknown read should fail")
+	}
+
+	// a sidecar index is loaded instead of scanning. This one only lists
+	// the first 5 reads, to tell the two apart.
+	index.ReadIDs = index.ReadIDs[:5]
+	var sidecar bytes.Buffer
+	if err := index.WriteIndex(&sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".idx", sidecar.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.ReadIDs) != 5 {
+		t.Errorf("expected the sidecar index with 5 reads, got %d", len(loaded.ReadIDs))
+	}
+	if read, err := loaded.GetRead(reads[3].ReadID); err != nil || !reflect.DeepEqual(read, reads[3]) {
+		t.Errorf("failed to get a read with a sidecar index: %v", err)
+	}
+
+	fromFile, err := LoadIndex(path + ".idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fromFile.GetRead(reads[3].ReadID); err == nil {
+		t.Errorf("GetRead without a file to read from should fail")
+	}
+}
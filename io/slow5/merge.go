@@ -0,0 +1,221 @@
+package slow5
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+
+Merging begins here
+
+A flowcell is often run more than once, or a run is restarted, leaving several
+slow5 files that belong together. Merge combines them into one file with a
+read group per run.
+
+Read group IDs are only unique within a file, so each input's read groups are
+renumbered after the ones of the inputs before it, and its reads with them.
+End reason enums can differ between runs, both in which end reasons they have
+and in their order, but reads are parsed with their end reasons as strings,
+so Write re-indexes them against the union of every enum. Read groups with
+identical attributes come from the same run, like a run MinKNOW wrote to
+several files, so they are kept as one read group, with the end reasons and
+extra columns of all of them.
+
+Split does the opposite, writing each read group of a file to its own
+single read group file. Both stream reads, so neither needs a file to fit in
+memory.
+
+******************************************************************************/
+
+// Merge reads every slow5 file in inputs and writes their read groups and
+// reads to output as one file. The read groups of each input are renumbered
+// to follow the ones of the inputs before it, and read groups with the same
+// attributes as an earlier one are merged into it. Merge stops at the first
+// read that fails to parse, returning its error.
+func Merge(inputs []io.Reader, maxLineSize int, output io.Writer) error {
+	if len(inputs) == 0 {
+		return errors.New("no slow5 files to merge")
+	}
+	var headers []Header
+	parsers := make([]*Parser, len(inputs))
+	readGroupIDs := make([]map[uint32]uint32, len(inputs))
+	attributeReadGroups := make(map[string]uint32)
+	for inputIndex, input := range inputs {
+		parser, inputHeaders, err := NewParser(input, maxLineSize)
+		if err != nil {
+			return fmt.Errorf("failed to parse headers of input %d: %w", inputIndex, err)
+		}
+		parsers[inputIndex] = parser
+		readGroupIDs[inputIndex] = make(map[uint32]uint32)
+		for _, header := range inputHeaders {
+			key := attributesKey(header.Attributes)
+			if readGroupID, ok := attributeReadGroups[key]; ok {
+				readGroupIDs[inputIndex][header.ReadGroupID] = readGroupID
+				headers[readGroupID] = mergeHeader(headers[readGroupID], header)
+				continue
+			}
+			attributeReadGroups[key] = uint32(len(headers))
+			readGroupIDs[inputIndex][header.ReadGroupID] = uint32(len(headers))
+			header.ReadGroupID = uint32(len(headers))
+			headers = append(headers, header)
+		}
+	}
+
+	reads := make(chan Read)
+	done := make(chan struct{})
+	parseErrors := make(chan error, 1)
+	go func() {
+		defer close(reads)
+		parseErrors <- mergeReads(parsers, readGroupIDs, reads, done)
+	}()
+	err := Write(headers, reads, output)
+	close(done)
+	parseErr := <-parseErrors
+	if parseErr != nil {
+		return parseErr
+	}
+	return err
+}
+
+// mergeReads sends the reads of each parser to reads, with their read group
+// renumbered by readGroupIDs, until the parsers run out or done is closed.
+func mergeReads(parsers []*Parser, readGroupIDs []map[uint32]uint32, reads chan<- Read, done <-chan struct{}) error {
+	for parserIndex, parser := range parsers {
+		for {
+			read, err := parser.ParseNext()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse input %d: %w", parserIndex, err)
+			}
+			if read.Error != nil {
+				return fmt.Errorf("failed to parse read %s of input %d: %w", read.ReadID, parserIndex, read.Error)
+			}
+			readGroupID, ok := readGroupIDs[parserIndex][read.ReadGroupID]
+			if !ok {
+				return fmt.Errorf("read %s of input %d is in read group %d, which has no header", read.ReadID, parserIndex, read.ReadGroupID)
+			}
+			read.ReadGroupID = readGroupID
+			select {
+			case reads <- read:
+			case <-done:
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// mergeHeader returns kept with the end reasons and extra columns of other,
+// a header with the same attributes, that kept doesn't have. End reasons
+// only in other are numbered after those of kept, and a column in both keeps
+// the type kept gives it.
+func mergeHeader(kept, other Header) Header {
+	kept.EndReasonHeaderMap = mergeEndReasons([]Header{kept, other})
+
+	if len(other.ExtraColumnTypes) > 0 {
+		columnTypes := make(map[string]string, len(kept.ExtraColumnTypes)+len(other.ExtraColumnTypes))
+		for name, columnType := range other.ExtraColumnTypes {
+			columnTypes[name] = columnType
+		}
+		for name, columnType := range kept.ExtraColumnTypes {
+			columnTypes[name] = columnType
+		}
+		kept.ExtraColumnTypes = columnTypes
+	}
+	return kept
+}
+
+// attributesKey returns a string that is the same for two sets of header
+// attributes only if they are identical.
+func attributesKey(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	for _, key := range keys {
+		// tabs and newlines can't be in attributes, so they separate them.
+		fmt.Fprintf(&builder, "%s\t%s\n", key, attributes[key])
+	}
+	return builder.String()
+}
+
+// Split writes each read group of the slow5 file in r to its own file, with
+// one read group numbered 0. outputFor is called once for each read group, in
+// order, with its ID in r, and decides where it is written. Split stops at the
+// first read that fails to parse or is in a read group without a header,
+// returning its error.
+func Split(r io.Reader, maxLineSize int, outputFor func(readGroupID uint32) (io.Writer, error)) error {
+	parser, headers, err := NewParser(r, maxLineSize)
+	if err != nil {
+		return err
+	}
+	outputs := make([]io.Writer, len(headers))
+	for headerIndex, header := range headers {
+		outputs[headerIndex], err = outputFor(header.ReadGroupID)
+		if err != nil {
+			return fmt.Errorf("failed to get output for read group %d: %w", header.ReadGroupID, err)
+		}
+	}
+
+	// every read group is written by its own Write, fed by its own channel.
+	channels := make(map[uint32]chan Read)
+	writeErrors := make(chan error, len(headers))
+	for headerIndex, header := range headers {
+		readGroupID := header.ReadGroupID
+		header.ReadGroupID = 0
+		channel := make(chan Read)
+		channels[readGroupID] = channel
+		go func(header Header, channel chan Read, output io.Writer) {
+			err := Write([]Header{header}, channel, output)
+			for range channel {
+				// keep reading after a failed write so Split doesn't block.
+			}
+			writeErrors <- err
+		}(header, channel, outputs[headerIndex])
+	}
+
+	parseErr := splitReads(parser, channels)
+	for _, channel := range channels {
+		close(channel)
+	}
+	for range headers {
+		if writeErr := <-writeErrors; writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if parseErr != nil {
+		return parseErr
+	}
+	return err
+}
+
+// splitReads sends each read parsed by parser to the channel of its read
+// group, renumbered to 0.
+func splitReads(parser *Parser, channels map[uint32]chan Read) error {
+	for {
+		read, err := parser.ParseNext()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if read.Error != nil {
+			return fmt.Errorf("failed to parse read %s: %w", read.ReadID, read.Error)
+		}
+		channel, ok := channels[read.ReadGroupID]
+		if !ok {
+			return fmt.Errorf("read %s on line %d is in read group %d, but the file only has headers for read groups 0 to %d", read.ReadID, parser.line, read.ReadGroupID, len(channels)-1)
+		}
+		read.ReadGroupID = 0
+		channel <- read
+	}
+}
@@ -0,0 +1,206 @@
+package slow5
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+/******************************************************************************
+
+Parallel parsing begins here
+
+A single slow5 file from a full PromethION run can be hundreds of gigabytes,
+and parsing all those raw signal integers on one core takes forever. Since
+every read is a single line, we can cut the file into byte ranges, nudge each
+cut forward to the start of the next line, and hand each range to its own
+parser. Every line belongs to exactly one range, so no read is lost or read
+twice.
+
+That needs a file to seek in. ParseConcurrent works on any reader instead:
+reading lines is cheap, and converting raw signal strings to integers is
+where the time goes, so one goroutine reads lines and hands them out to
+workers to parse.
+
+******************************************************************************/
+
+// parallelMaxLineSize is the buffer size of each ParseParallel worker. Reads
+// are single lines, so this must be larger than the longest read.
+const parallelMaxLineSize = 16 * 1024 * 1024
+
+var openFn = os.Open
+
+// ParseParallel parses a slow5 file at path using workers concurrent parsers,
+// each reading its own byte range of the file. Headers are read once up front
+// and reads are sent on the returned channel, which is closed once every read
+// has been parsed.
+//
+// Reads are NOT returned in file order: each worker sends reads as soon as it
+// parses them. Sort them afterwards (by ReadID, for example) if order matters.
+//
+// If a worker hits an error it sends a Read with only the Error field set and
+// stops parsing its range.
+func ParseParallel(path string, workers int) ([]Header, <-chan Read, error) {
+	if workers < 1 {
+		return nil, nil, fmt.Errorf("workers must be at least 1, got %d", workers)
+	}
+	file, err := openFn(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	headerParser, headers, err := NewParser(file, parallelMaxLineSize)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	// cut the reads into ranges aligned to line starts.
+	readsStart, readsEnd := headerParser.offset, info.Size()
+	boundaries := []int64{readsStart}
+	for worker := 1; worker < workers; worker++ {
+		cut := readsStart + (readsEnd-readsStart)*int64(worker)/int64(workers)
+		cut, err = nextLineStart(file, cut, readsStart, readsEnd)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		boundaries = append(boundaries, cut)
+	}
+	boundaries = append(boundaries, readsEnd)
+
+	reads := make(chan Read)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		start, end := boundaries[worker], boundaries[worker+1]
+		if start >= end {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parser := &Parser{
+				reader:       *bufio.NewReaderSize(io.NewSectionReader(file, start, end-start), parallelMaxLineSize),
+				headerMap:    headerParser.headerMap,
+				endReasonMap: headerParser.endReasonMap,
+			}
+			for {
+				read, err := parser.ParseNext()
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						reads <- Read{Error: fmt.Errorf("parsing bytes %d-%d: %w", start, end, err)}
+					}
+					return
+				}
+				reads <- read
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		file.Close()
+		close(reads)
+	}()
+	return headers, reads, nil
+}
+
+// nextLineStart returns the offset of the first line starting at or after
+// offset, or limit if there is none. A line starts at offset if it is the
+// first byte of the reads or the previous byte is a newline.
+func nextLineStart(file io.ReaderAt, offset, first, limit int64) (int64, error) {
+	if offset <= first {
+		return first, nil
+	}
+	buffer := make([]byte, 4096)
+	for position := offset - 1; position < limit; {
+		n, err := file.ReadAt(buffer, position)
+		for i := 0; i < n; i++ {
+			if buffer[i] == '\n' {
+				return position + int64(i) + 1, nil
+			}
+		}
+		position += int64(n)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, err
+		}
+	}
+	return limit, nil
+}
+
+// numberedLine is a line of a slow5 file waiting to be parsed by a
+// ParseConcurrent worker.
+type numberedLine struct {
+	line   string
+	number uint
+}
+
+// ParseConcurrent parses the rest of the parser's reads using workers
+// goroutines and sends them on the returned channel, which is closed once
+// every read has been parsed or ctx is cancelled. The parser must not be used
+// while reads are being parsed.
+//
+// Reads are NOT returned in file order. Problems with a read are put in
+// Read.Error, even in strict mode, and a failure to read the file is sent as
+// a Read with only the Error field set.
+func (parser *Parser) ParseConcurrent(ctx context.Context, workers int) <-chan Read {
+	if workers < 1 {
+		workers = 1
+	}
+	lines := make(chan numberedLine, workers)
+	reads := make(chan Read, workers)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(lines)
+		for {
+			line, err := parser.nextLine()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				select {
+				case reads <- Read{Error: fmt.Errorf("reading line %d: %w", parser.line+1, err)}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			select {
+			case lines <- numberedLine{line: line, number: parser.line}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range lines {
+				select {
+				case reads <- parser.parseLine(line.line, line.number):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(reads)
+	}()
+	return reads
+}
@@ -0,0 +1,244 @@
+package slow5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeManyReads writes a slow5 file with count reads copied from
+// example.slow5, each with a unique ReadID, returning its path.
+func writeManyReads(tb testing.TB, count int) string {
+	return writeManyShortReads(tb, count, 0)
+}
+
+// writeManyShortReads is writeManyReads with the raw signal of each read cut
+// to signalLength samples, or left whole if signalLength is 0.
+func writeManyShortReads(tb testing.TB, count, signalLength int) string {
+	tb.Helper()
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+	parser, headers, err := NewParser(file, maxLineSize)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var templates []Read
+	for {
+		read, err := parser.ParseNext()
+		if err != nil {
+			break
+		}
+		templates = append(templates, read)
+	}
+
+	path := filepath.Join(tb.TempDir(), "many.slow5")
+	output, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer output.Close()
+	reads := make(chan Read)
+	go func() {
+		for i := 0; i < count; i++ {
+			read := templates[i%len(templates)]
+			read.ReadID = fmt.Sprintf("read-%06d", i)
+			if signalLength > 0 && signalLength < len(read.RawSignal) {
+				read.RawSignal = read.RawSignal[:signalLength]
+				read.LenRawSignal = uint64(signalLength)
+			}
+			reads <- read
+		}
+		close(reads)
+	}()
+	if err := Write(headers, reads, output); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func readIDsSerial(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, parallelMaxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var readIDs []string
+	for {
+		read, err := parser.ParseNext()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatal(err)
+			}
+			break
+		}
+		readIDs = append(readIDs, read.ReadID)
+	}
+	sort.Strings(readIDs)
+	return readIDs
+}
+
+func TestParseParallel(t *testing.T) {
+	for _, path := range []string{"data/example.slow5", writeManyReads(t, 257)} {
+		expected := readIDsSerial(t, path)
+		for _, workers := range []int{1, 2, 3, 7, 16, 1000} {
+			headers, reads, err := ParseParallel(path, workers)
+			if err != nil {
+				t.Fatalf("%s with %d workers: %s", path, workers, err)
+			}
+			if len(headers) != 1 {
+				t.Errorf("expected 1 header, got %d", len(headers))
+			}
+			var readIDs []string
+			for read := range reads {
+				if read.Error != nil {
+					t.Errorf("%s with %d workers: %s", path, workers, read.Error)
+				}
+				readIDs = append(readIDs, read.ReadID)
+			}
+			sort.Strings(readIDs)
+			if fmt.Sprint(readIDs) != fmt.Sprint(expected) {
+				t.Errorf("%s with %d workers: got %d reads, expected %d matching a serial parse", path, workers, len(readIDs), len(expected))
+			}
+		}
+	}
+}
+
+func TestParseParallelErrors(t *testing.T) {
+	if _, _, err := ParseParallel("data/example.slow5", 0); err == nil {
+		t.Errorf("expected error for zero workers")
+	}
+	if _, _, err := ParseParallel("data/missing.slow5", 2); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+	if _, _, err := ParseParallel("data/header_tests/test_header_empty.slow5", 2); err == nil {
+		t.Errorf("expected error for empty file")
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	path := writeManyReads(t, 257)
+	expected := readIDsSerial(t, path)
+	for _, workers := range []int{0, 1, 4, 16} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser, _, err := NewParser(file, parallelMaxLineSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var readIDs []string
+		for read := range parser.ParseConcurrent(context.Background(), workers) {
+			if read.Error != nil {
+				t.Errorf("%d workers: %s", workers, read.Error)
+			}
+			readIDs = append(readIDs, read.ReadID)
+		}
+		file.Close()
+		sort.Strings(readIDs)
+		if fmt.Sprint(readIDs) != fmt.Sprint(expected) {
+			t.Errorf("%d workers: got %d reads, expected %d matching a serial parse", workers, len(readIDs), len(expected))
+		}
+	}
+}
+
+func TestParseConcurrentCancel(t *testing.T) {
+	file, err := os.Open(writeManyReads(t, 257))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, parallelMaxLineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	reads := parser.ParseConcurrent(ctx, 4)
+	<-reads
+	cancel()
+	count := 1
+	for range reads {
+		count++
+	}
+	if count == 257 {
+		t.Error("expected cancelling to stop parsing early")
+	}
+}
+
+func TestParseConcurrentErrors(t *testing.T) {
+	file, err := os.Open("data/read_tests/raw_signal.slow5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, maxLineSize, WithStrictMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorCount := 0
+	for read := range parser.ParseConcurrent(context.Background(), 2) {
+		if read.Error != nil {
+			errorCount++
+		}
+	}
+	if errorCount == 0 {
+		t.Error("expected reads that fail to parse to have an Error")
+	}
+}
+
+// BenchmarkParseConcurrent parses 100k short reads with more and more
+// workers.
+func BenchmarkParseConcurrent(b *testing.B) {
+	path := writeManyShortReads(b, 100000, 256)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				file, _ := os.Open(path)
+				parser, _, _ := NewParser(file, parallelMaxLineSize)
+				for range parser.ParseConcurrent(context.Background(), workers) {
+				}
+				file.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkParseSerial(b *testing.B) {
+	path := writeManyReads(b, 2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		file, _ := os.Open(path)
+		parser, _, _ := NewParser(file, parallelMaxLineSize)
+		for {
+			if _, err := parser.ParseNext(); err != nil {
+				break
+			}
+		}
+		file.Close()
+	}
+}
+
+func BenchmarkParseParallel(b *testing.B) {
+	path := writeManyReads(b, 2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, reads, err := ParseParallel(path, 8)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range reads {
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package slow5
+
+import (
+	"math/rand"
+	"sort"
+)
+
+/******************************************************************************
+
+Read pipelines begin here
+
+Reads are streamed through channels so runs never have to fit in memory, and
+Map keeps it that way while transforming them: it applies a function to each
+read as it comes and closes its output once its input is closed, so Maps can
+be chained between a parser and Write. Filter and Subsample drop reads the
+same way. Summarize sits at the end of a
+pipeline instead, boiling a run down to the numbers a QC dashboard shows.
+
+******************************************************************************/
+
+// Map returns a channel of the reads from in transformed by fn, in the same
+// order. The returned channel is closed once in is closed and drained.
+func Map(in <-chan Read, fn func(Read) Read) <-chan Read {
+	out := make(chan Read)
+	go func() {
+		defer close(out)
+		for read := range in {
+			out <- fn(read)
+		}
+	}()
+	return out
+}
+
+// Downsample returns a function for Map that keeps every factor-th sample of
+// a read's raw signal, starting with the first, and updates LenRawSignal and
+// SamplingRate to match. Factors below 2 leave reads unchanged.
+func Downsample(factor int) func(Read) Read {
+	return func(read Read) Read {
+		if factor < 2 {
+			return read
+		}
+		downsampled := make([]int16, 0, (len(read.RawSignal)+factor-1)/factor)
+		for index := 0; index < len(read.RawSignal); index += factor {
+			downsampled = append(downsampled, read.RawSignal[index])
+		}
+		read.RawSignal = downsampled
+		read.LenRawSignal = uint64(len(downsampled))
+		read.SamplingRate /= float64(factor)
+		return read
+	}
+}
+
+// FilterOption changes which reads Filter keeps.
+type FilterOption func(*filterOptions)
+
+type filterOptions struct {
+	dropErrors bool
+}
+
+// DropErrors drops reads with an Error, which Filter otherwise keeps without
+// calling the predicate on them.
+func DropErrors() FilterOption {
+	return func(options *filterOptions) {
+		options.dropErrors = true
+	}
+}
+
+// Filter returns a channel of the reads from in for which predicate returns
+// true, in the same order. Reads with an Error are kept without calling
+// predicate, so the error reaches whatever reads the channel, unless
+// DropErrors is given. The returned channel is closed once in is closed and
+// drained.
+func Filter(in <-chan Read, predicate func(Read) bool, options ...FilterOption) <-chan Read {
+	var settings filterOptions
+	for _, option := range options {
+		option(&settings)
+	}
+	out := make(chan Read)
+	go func() {
+		defer close(out)
+		for read := range in {
+			if read.Error != nil {
+				if !settings.dropErrors {
+					out <- read
+				}
+				continue
+			}
+			if predicate(read) {
+				out <- read
+			}
+		}
+	}()
+	return out
+}
+
+// Subsample returns a channel of a random fraction of the reads from in, in
+// the same order. Each read is kept with probability fraction, so the number
+// kept varies around fraction of the total, and the same seed keeps the same
+// reads. Reads with an Error are always kept, like with Filter.
+func Subsample(in <-chan Read, fraction float64, seed int64) <-chan Read {
+	random := rand.New(rand.NewSource(seed))
+	return Filter(in, func(Read) bool { return random.Float64() < fraction })
+}
+
+// Summary describes the reads of a run.
+type Summary struct {
+	ReadCount        int               // ReadCount is the number of reads.
+	TotalSamples     uint64            // TotalSamples is the number of raw signal samples of every read.
+	MeanLength       float64           // MeanLength is the mean number of samples per read.
+	MedianLength     float64           // MedianLength is the median number of samples per read.
+	MeanMedianBefore float64           // MeanMedianBefore is the mean of the reads' MedianBefore.
+	EndReasonCounts  map[EndReason]int // EndReasonCounts is the number of reads with each end reason. Known end reasons without reads are 0.
+}
+
+// Summarize reads every read from in and summarizes them. Reads without an
+// end reason aren't counted in EndReasonCounts.
+func Summarize(in <-chan Read) Summary {
+	summary := Summary{EndReasonCounts: make(map[EndReason]int)}
+	for _, endReason := range knownEndReasons {
+		summary.EndReasonCounts[endReason] = 0
+	}
+	var lengths []int
+	medianBeforeTotal := 0.0
+	for read := range in {
+		summary.ReadCount++
+		summary.TotalSamples += uint64(len(read.RawSignal))
+		lengths = append(lengths, len(read.RawSignal))
+		medianBeforeTotal += read.MedianBefore
+		if reason := read.Reason(); reason != NoEndReason {
+			summary.EndReasonCounts[reason]++
+		}
+	}
+	if summary.ReadCount == 0 {
+		return summary
+	}
+	summary.MeanLength = float64(summary.TotalSamples) / float64(summary.ReadCount)
+	summary.MeanMedianBefore = medianBeforeTotal / float64(summary.ReadCount)
+	sort.Ints(lengths)
+	middle := len(lengths) / 2
+	if len(lengths)%2 == 1 {
+		summary.MedianLength = float64(lengths[middle])
+	} else {
+		summary.MedianLength = float64(lengths[middle-1]+lengths[middle]) / 2
+	}
+	return summary
+}
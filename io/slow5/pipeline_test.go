@@ -0,0 +1,147 @@
+package slow5
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	in := make(chan Read)
+	go func() {
+		for _, readID := range []string{"a", "b", "c"} {
+			in <- Read{ReadID: readID, RawSignal: []int16{1, 2, 3, 4, 5, 6, 7}, LenRawSignal: 7, SamplingRate: 4000}
+		}
+		close(in)
+	}()
+	rename := func(read Read) Read {
+		read.ReadID += "-renamed"
+		return read
+	}
+
+	var readIDs []string
+	for read := range Map(Map(in, Downsample(3)), rename) {
+		readIDs = append(readIDs, read.ReadID)
+		if !reflect.DeepEqual(read.RawSignal, []int16{1, 4, 7}) || read.LenRawSignal != 3 || read.SamplingRate != 4000.0/3 {
+			t.Errorf("Read %s downsampled incorrectly: %v, %d samples at %f Hz", read.ReadID, read.RawSignal, read.LenRawSignal, read.SamplingRate)
+		}
+	}
+	if expected := []string{"a-renamed", "b-renamed", "c-renamed"}; !reflect.DeepEqual(readIDs, expected) {
+		t.Errorf("Expected reads %v in order, got %v", expected, readIDs)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	read := Read{RawSignal: []int16{1, 2, 3, 4}, LenRawSignal: 4, SamplingRate: 4000}
+	if downsampled := Downsample(1)(read); !reflect.DeepEqual(downsampled, read) {
+		t.Errorf("Expected a factor of 1 to leave the read unchanged, got %v", downsampled)
+	}
+	downsampled := Downsample(2)(read)
+	if !reflect.DeepEqual(downsampled.RawSignal, []int16{1, 3}) || downsampled.LenRawSignal != 2 || downsampled.SamplingRate != 2000 {
+		t.Errorf("Unexpected downsampled read %v", downsampled)
+	}
+	if !reflect.DeepEqual(read.RawSignal, []int16{1, 2, 3, 4}) {
+		t.Errorf("Downsample changed the original signal: %v", read.RawSignal)
+	}
+	if downsampled = Downsample(10)(Read{}); len(downsampled.RawSignal) != 0 || downsampled.LenRawSignal != 0 {
+		t.Errorf("Expected an empty read to stay empty, got %v", downsampled)
+	}
+}
+
+func sendReads(reads []Read) <-chan Read {
+	in := make(chan Read)
+	go func() {
+		for _, read := range reads {
+			in <- read
+		}
+		close(in)
+	}()
+	return in
+}
+
+func TestSummarize(t *testing.T) {
+	reads := []Read{
+		{RawSignal: make([]int16, 10), MedianBefore: 200, EndReason: "signal_positive"},
+		{RawSignal: make([]int16, 3), MedianBefore: 220, EndReason: "signal_positive"},
+		{RawSignal: make([]int16, 8), MedianBefore: 210, EndReason: "unblock_mux_change"},
+		{RawSignal: make([]int16, 1), MedianBefore: 230},
+	}
+	summary := Summarize(sendReads(reads))
+	if summary.ReadCount != 4 || summary.TotalSamples != 22 || summary.MeanLength != 5.5 || summary.MeanMedianBefore != 215 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	// the median of an even count is the mean of the middle two.
+	if summary.MedianLength != 5.5 {
+		t.Errorf("Expected a median length of 5.5, got %f", summary.MedianLength)
+	}
+	if summary.EndReasonCounts[EndReasonSignalPositive] != 2 || summary.EndReasonCounts[EndReasonUnblockMuxChange] != 1 {
+		t.Errorf("Unexpected end reason counts %v", summary.EndReasonCounts)
+	}
+	if count, ok := summary.EndReasonCounts[EndReasonSignalNegative]; !ok || count != 0 {
+		t.Errorf("Expected end reasons without reads to be 0, got %v", summary.EndReasonCounts)
+	}
+
+	if odd := Summarize(sendReads(reads[:3])); odd.MedianLength != 8 {
+		t.Errorf("Expected a median length of 8, got %f", odd.MedianLength)
+	}
+	if empty := Summarize(sendReads(nil)); empty.ReadCount != 0 || empty.MedianLength != 0 || len(empty.EndReasonCounts) != len(knownEndReasons) {
+		t.Errorf("Unexpected summary of no reads %+v", empty)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var reads []Read
+	for channel := 1; channel <= 256; channel++ {
+		reads = append(reads, Read{ReadID: fmt.Sprint(channel), ChannelNumber: fmt.Sprint(channel)})
+	}
+	broken := Read{ReadID: "broken", Error: errors.New("bad raw signal")}
+	reads = append(reads[:10], append([]Read{broken}, reads[10:]...)...)
+
+	firstHalf := func(read Read) bool {
+		var channel int
+		_, err := fmt.Sscan(read.ChannelNumber, &channel)
+		return err == nil && channel <= 128
+	}
+	var kept []string
+	for read := range Filter(sendReads(reads), firstHalf) {
+		kept = append(kept, read.ReadID)
+	}
+	if len(kept) != 129 || kept[0] != "1" || kept[10] != "broken" || kept[128] != "128" {
+		t.Errorf("Expected channels 1 to 128 and the broken read, got %v", kept)
+	}
+	count := 0
+	for read := range Filter(sendReads(reads), firstHalf, DropErrors()) {
+		if read.Error != nil {
+			t.Errorf("Expected reads with errors to be dropped, got %s", read.ReadID)
+		}
+		count++
+	}
+	if count != 128 {
+		t.Errorf("Expected 128 reads, got %d", count)
+	}
+}
+
+func TestSubsample(t *testing.T) {
+	reads := make([]Read, 10000)
+	for index := range reads {
+		reads[index].ReadID = fmt.Sprint(index)
+	}
+	subsample := func(seed int64) []string {
+		var kept []string
+		for read := range Subsample(sendReads(reads), 0.1, seed) {
+			kept = append(kept, read.ReadID)
+		}
+		return kept
+	}
+	first := subsample(1)
+	if len(first) < 900 || len(first) > 1100 {
+		t.Errorf("Expected about 1000 reads, got %d", len(first))
+	}
+	if !reflect.DeepEqual(first, subsample(1)) {
+		t.Error("Expected the same seed to keep the same reads")
+	}
+	if reflect.DeepEqual(first, subsample(2)) {
+		t.Error("Expected different seeds to keep different reads")
+	}
+}
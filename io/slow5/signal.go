@@ -0,0 +1,56 @@
+package slow5
+
+import "fmt"
+
+/******************************************************************************
+
+Signal conversion begins here
+
+Nanopore devices store current as raw ADC values, which is what RawSignal
+holds. Converting them to picoamperes, which is what basecallers and most
+signal processing expect, takes three per-read values:
+
+	pA = (raw + offset) * range / digitisation
+
+The example read in the slow5 spec has a digitisation of 8192, an offset of
+16 and a range of 1489.52832, so its first raw value of 430 is 81.09 pA.
+
+******************************************************************************/
+
+// Picoamps returns the read's raw signal converted to picoamperes.
+func (read Read) Picoamps() []float64 {
+	picoamps := make([]float64, len(read.RawSignal))
+	read.SignalPAInto(picoamps)
+	return picoamps
+}
+
+// SignalPA returns the read's raw signal converted to picoamperes. It is the
+// same as Picoamps.
+func (read Read) SignalPA() []float64 {
+	return read.Picoamps()
+}
+
+// SignalPAInto converts the read's raw signal to picoamperes in dst, so a
+// buffer can be reused across reads. Like copy, it converts as much of the
+// signal as fits in dst.
+func (read Read) SignalPAInto(dst []float64) {
+	for index := 0; index < len(dst) && index < len(read.RawSignal); index++ {
+		dst[index] = read.PicoampAt(index)
+	}
+}
+
+// SignalPAChecked is SignalPA, but returns an error instead of infinite or
+// NaN values if the read has no digitisation, like a read with a missing
+// digitisation column.
+func (read Read) SignalPAChecked() ([]float64, error) {
+	if read.Digitisation == 0 {
+		return nil, fmt.Errorf("read %s has a digitisation of 0, so its signal can't be converted to picoamperes", read.ReadID)
+	}
+	return read.SignalPA(), nil
+}
+
+// PicoampAt returns the raw signal at index i converted to picoamperes. It
+// panics if i is out of range, like indexing RawSignal would.
+func (read Read) PicoampAt(i int) float64 {
+	return (float64(read.RawSignal[i]) + read.Offset) * read.Range / read.Digitisation
+}
@@ -0,0 +1,127 @@
+package slow5
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestPicoamps(t *testing.T) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open example.slow5: %s", err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	read, err := parser.ParseNext()
+	if err != nil {
+		t.Fatalf("Failed to parse read: %s", err)
+	}
+
+	// (430 + 16) * 1489.52832 / 8192 and (472 + 16) * 1489.52832 / 8192, from
+	// the example read of the slow5 spec.
+	expected := []float64{81.094925625, 88.7316675}
+	picoamps := read.Picoamps()
+	if len(picoamps) != len(read.RawSignal) {
+		t.Fatalf("Expected %d picoamp values, got %d", len(read.RawSignal), len(picoamps))
+	}
+	for index, value := range expected {
+		if math.Abs(picoamps[index]-value) > 1e-9 {
+			t.Errorf("Expected signal %d to be %f pA, got %f", index, value, picoamps[index])
+		}
+		if picoamps[index] != read.PicoampAt(index) {
+			t.Errorf("Picoamps and PicoampAt disagree at %d: %f != %f", index, picoamps[index], read.PicoampAt(index))
+		}
+	}
+}
+
+func TestSignalPA(t *testing.T) {
+	read := Read{ReadID: "read", Digitisation: 8192, Offset: 16, Range: 1489.52832, RawSignal: []int16{430, 472, 463}}
+	expected := read.Picoamps()
+	signal := read.SignalPA()
+	for index := range expected {
+		if signal[index] != expected[index] {
+			t.Errorf("SignalPA and Picoamps disagree at %d: %f != %f", index, signal[index], expected[index])
+		}
+	}
+
+	// SignalPAInto fills what fits.
+	buffer := make([]float64, 2)
+	read.SignalPAInto(buffer)
+	if buffer[0] != expected[0] || buffer[1] != expected[1] {
+		t.Errorf("Expected SignalPAInto to give %v, got %v", expected[:2], buffer)
+	}
+	buffer = []float64{-1, -1, -1, -1}
+	read.SignalPAInto(buffer)
+	if buffer[2] != expected[2] || buffer[3] != -1 {
+		t.Errorf("Expected SignalPAInto to only fill the first 3 values, got %v", buffer)
+	}
+
+	checked, err := read.SignalPAChecked()
+	if err != nil || len(checked) != 3 || checked[0] != expected[0] {
+		t.Errorf("Expected SignalPAChecked to give %v, got %v, %v", expected, checked, err)
+	}
+	read.Digitisation = 0
+	if _, err = read.SignalPAChecked(); err == nil {
+		t.Error("Expected SignalPAChecked to fail with a digitisation of 0")
+	}
+}
+
+func TestSignalStatistics(t *testing.T) {
+	// with a digitisation equal to the range, raw values are picoamperes.
+	read := Read{ReadID: "read", Digitisation: 1, Range: 1, RawSignal: []int16{4, 1, 3, 2}}
+	if mean := read.SignalMean(); mean != 2.5 {
+		t.Errorf("Expected a mean of 2.5, got %f", mean)
+	}
+	if median := read.SignalMedian(); median != 2.5 {
+		t.Errorf("Expected a median of 2.5, got %f", median)
+	}
+	if stdev := read.SignalStdev(); math.Abs(stdev-math.Sqrt(1.25)) > 1e-9 {
+		t.Errorf("Expected a standard deviation of %f, got %f", math.Sqrt(1.25), stdev)
+	}
+	read.RawSignal = []int16{5, 1, 3}
+	if median := read.SignalMedian(); median != 3 {
+		t.Errorf("Expected a median of 3, got %f", median)
+	}
+
+	read.RawSignal = nil
+	if read.SignalMean() != 0 || read.SignalStdev() != 0 || read.SignalMedian() != 0 {
+		t.Error("Expected statistics of an empty signal to be 0")
+	}
+	if segments := read.Segment(5, 4); segments != nil {
+		t.Errorf("Expected no segments for an empty signal, got %v", segments)
+	}
+}
+
+func TestSegment(t *testing.T) {
+	// three noisy levels of 100, 60 and 90 pA.
+	var signal []int16
+	noise := []int16{1, -1, 2, 0, -2, 1, 0, -1}
+	for _, level := range []int16{100, 60, 90} {
+		for index := 0; index < 40; index++ {
+			signal = append(signal, level+noise[index%len(noise)])
+		}
+	}
+	read := Read{ReadID: "read", Digitisation: 1, Range: 1, RawSignal: signal}
+	segments := read.Segment(6, 5)
+	if len(segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %v", segments)
+	}
+	for index, expected := range []SignalSegment{{0, 40, 100}, {40, 80, 60}, {80, 120, 90}} {
+		segment := segments[index]
+		if segment.Start != expected.Start || segment.End != expected.End || math.Abs(segment.Mean-expected.Mean) > 0.5 {
+			t.Errorf("Expected segment %d to be %v, got %v", index, expected, segment)
+		}
+	}
+
+	// too short for two windows, or no window, is one segment.
+	for _, windowSize := range []int{0, 100} {
+		segments = read.Segment(windowSize, 5)
+		if len(segments) != 1 || segments[0].Start != 0 || segments[0].End != len(signal) {
+			t.Errorf("Expected one segment for a window of %d, got %v", windowSize, segments)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 /*
 Package slow5 contains slow5 parsers and writers.
 
-Right now, only parsing slow5 files is supported. Support for writing and blow5
-coming soon.
+slow5 files can be parsed and written. blow5 files can be parsed with
+NewBinaryParser and written with WriteBlow5.
 
 slow5 is a file format alternative to fast5, which is the file format outputted
 by Oxford Nanopore sequencing devices. fast5 uses hdf5, which is a complex file
@@ -20,6 +20,8 @@ package slow5
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
@@ -61,6 +63,10 @@ type Header struct {
 	Slow5Version       string
 	Attributes         map[string]string
 	EndReasonHeaderMap map[string]int
+	// ExtraColumnTypes are the types of read columns poly doesn't know,
+	// like uint64_t, keyed by column name. Write writes these columns from
+	// Read.ExtraAttributes.
+	ExtraColumnTypes map[string]string
 }
 
 // Read contains metadata and raw signal strengths for a single nanopore read.
@@ -80,18 +86,39 @@ type Read struct {
 	ReadNumber    int32
 	StartMux      uint8
 	StartTime     uint64
-	EndReason     string // enum{unknown,partial,mux_change,unblock_mux_change,data_service_unblock_mux_change,signal_positive,signal_negative}
+	// EndReason is the label of the read's end reason, as written in the
+	// header's end_reason enum.
+	//
+	// Deprecated: use Reason and SetReason, which take it as an EndReason.
+	EndReason string
+
+	// ExtraAttributes are the values of columns poly doesn't know, as
+	// written in the file, keyed by column name. Newer versions of MinKNOW
+	// add columns like num_minknow_events.
+	ExtraAttributes map[string]string
+	// auxParsers are the functions registered with Parser.RegisterAux
+	// when the read was parsed, which Aux parses ExtraAttributes with.
+	auxParsers map[string]func(string) (interface{}, error)
 
 	Error error // in case there is an error while parsing!
 }
 
-var knownEndReasons = map[string]bool{"unknown": true,
-	"partial":                         true,
-	"mux_change":                      true,
-	"unblock_mux_change":              true,
-	"data_service_unblock_mux_change": true,
-	"signal_positive":                 true,
-	"signal_negative":                 true,
+// knownColumns are the read columns parsed into Read fields.
+var knownColumns = map[string]bool{
+	"read_id":        true,
+	"read_group":     true,
+	"digitisation":   true,
+	"offset":         true,
+	"range":          true,
+	"sampling_rate":  true,
+	"len_raw_signal": true,
+	"raw_signal":     true,
+	"start_time":     true,
+	"read_number":    true,
+	"start_mux":      true,
+	"median_before":  true,
+	"end_reason":     true,
+	"channel_number": true,
 }
 
 // Parser is a flexible parser that provides ample
@@ -100,31 +127,71 @@ var knownEndReasons = map[string]bool{"unknown": true,
 type Parser struct {
 	// reader keeps state of current reader.
 	reader       bufio.Reader
+	source       io.Reader // source is what reader reads from, seeked by ReadAt
 	line         uint
+	offset       int64 // bytes consumed from the underlying reader
+	version      string
 	headerMap    map[int]string
 	endReasonMap map[int]string
+	closers      []io.Closer // closed by Close, innermost first
+	strict       bool
+	// strictColumns makes unknown columns an error instead of extra
+	// attributes.
+	strictColumns bool
+	// auxParsers parse extra columns for Read.Aux, keyed by column name.
+	auxParsers map[string]func(string) (interface{}, error)
+	// verifyChecksums checks reads against their ChecksumColumn.
+	verifyChecksums bool
+}
+
+// ParserOption configures a Parser made with NewParser.
+type ParserOption func(parser *Parser)
+
+// WithStrictMode makes ParseNext return problems with a read as an error,
+// instead of setting Read.Error. It also makes ParseNext check that
+// len_raw_signal is the length of raw_signal.
+func WithStrictMode() ParserOption {
+	return func(parser *Parser) {
+		parser.strict = true
+	}
+}
+
+// WithStrictColumns makes columns poly doesn't know an error, set in
+// Read.Error, instead of putting them in Read.ExtraAttributes. Use it to
+// catch typos in column names.
+func WithStrictColumns() ParserOption {
+	return func(parser *Parser) {
+		parser.strictColumns = true
+	}
 }
 
 // NewParser parsers a slow5 file.
-func NewParser(r io.Reader, maxLineSize int) (*Parser, []Header, error) {
+func NewParser(r io.Reader, maxLineSize int, options ...ParserOption) (*Parser, []Header, error) {
 	parser := &Parser{
 		reader: *bufio.NewReaderSize(r, maxLineSize),
+		source: r,
 		line:   0,
 	}
+	for _, option := range options {
+		option(parser)
+	}
 	var headers []Header
 	var slow5Version string
 	var numReadGroups uint32
 	headerMap := make(map[int]string)
 	endReasonMap := make(map[int]string)
 	endReasonHeaderMap := make(map[string]int)
+	var columnTypes []string
 
 	for {
 		lineBytes, err := parser.reader.ReadSlice('\n')
-		if err != nil {
+		// like in ParseNext, a last line without a newline comes with io.EOF.
+		if err != nil && !(errors.Is(err, io.EOF) && len(lineBytes) > 0) {
 			return parser, []Header{}, err
 		}
 		line := strings.TrimSpace(string(lineBytes))
 		parser.line++
+		parser.offset += int64(len(lineBytes))
 		values := strings.Split(line, "\t")
 		if len(values) < 2 {
 			return parser, []Header{}, fmt.Errorf("Got following line without tabs: %s", line)
@@ -151,16 +218,19 @@ func NewParser(r io.Reader, maxLineSize int) (*Parser, []Header, error) {
 		// Terminate if we hit the beginning of the raw read headers
 		// Get endReasonEnums. This is simply a string between enum{} that is used for the reasons that a read could have ended.
 		if values[0] == "#char*" {
+			columnTypes = values
 			for _, typeInfo := range values {
 				if strings.Contains(typeInfo, "enum") {
 					endReasonEnumsMinusPrefix := strings.TrimPrefix(typeInfo, "enum{")
 					endReasonEnumsMinusSuffix := strings.TrimSuffix(endReasonEnumsMinusPrefix, "}")
 					endReasons := strings.Split(endReasonEnumsMinusSuffix, ",")
+					if endReasonEnumsMinusSuffix == "" {
+						endReasons = nil // files written without end reasons have an empty enum{}
+					}
 
+					// end reasons poly doesn't know, like ones from a newer
+					// MinKNOW, are kept as they are and parse into Other.
 					for endReasonIndex, endReason := range endReasons {
-						if _, ok := knownEndReasons[endReason]; !ok {
-							return parser, headers, fmt.Errorf("unknown end reason '%s' found in end_reason enum. Please report", endReason)
-						}
 						endReasonMap[endReasonIndex] = endReason
 						endReasonHeaderMap[endReason] = endReasonIndex
 					}
@@ -176,8 +246,20 @@ func NewParser(r io.Reader, maxLineSize int) (*Parser, []Header, error) {
 		// Get the read headers and their identifiers. Though the primary read headers are in a defined order, the auxiliary headers are not.
 		if values[0] == "#read_id" {
 			headerMap[0] = "read_id"
+			extraColumnTypes := make(map[string]string)
 			for headerNum := 1; headerNum < len(values); headerNum++ {
 				headerMap[headerNum] = values[headerNum]
+				if !knownColumns[values[headerNum]] {
+					extraColumnTypes[values[headerNum]] = "char*"
+					if headerNum < len(columnTypes) {
+						extraColumnTypes[values[headerNum]] = columnTypes[headerNum]
+					}
+				}
+			}
+			if len(extraColumnTypes) > 0 {
+				for headerIndex := range headers {
+					headers[headerIndex].ExtraColumnTypes = extraColumnTypes
+				}
 			}
 			break
 		}
@@ -191,24 +273,122 @@ func NewParser(r io.Reader, maxLineSize int) (*Parser, []Header, error) {
 		}
 		continue
 	}
+	parser.version = slow5Version
 	parser.headerMap = headerMap
 	parser.endReasonMap = endReasonMap
 	return parser, headers, nil
 }
 
-// ParseNext parses the next read from a parser.
+// RegisterAux registers parse to parse the values of the auxiliary column
+// name for Read.Aux, for columns poly doesn't know, like ones added by newer
+// versions of MinKNOW. Registered columns are accepted even with
+// WithStrictColumns. Known columns, like read_id, are always parsed into
+// their Read fields, so registering them does nothing. RegisterAux must be
+// called before reads are parsed.
+func (parser *Parser) RegisterAux(name string, parse func(string) (interface{}, error)) {
+	if parser.auxParsers == nil {
+		parser.auxParsers = make(map[string]func(string) (interface{}, error))
+	}
+	parser.auxParsers[name] = parse
+}
+
+// Aux returns the value of the auxiliary column name, parsed from
+// ExtraAttributes by the function registered for it with
+// Parser.RegisterAux, or as the raw string for columns without one. It
+// returns nil if the read has no such column, and the registered function's
+// error if it can't parse the value. ExtraAttributes is the only copy of
+// the value, so a value changed there is what Aux parses and Write writes.
+func (read Read) Aux(name string) (interface{}, error) {
+	value, ok := read.ExtraAttributes[name]
+	if !ok {
+		return nil, nil
+	}
+	if parse, registered := read.auxParsers[name]; registered {
+		return parse(value)
+	}
+	return value, nil
+}
+
+// ParseNext parses the next read from a parser. Problems with the read's
+// values are put in Read.Error, or returned as an error in strict mode.
+// Blank lines are skipped, and io.EOF itself, unwrapped, is returned once
+// there are no reads left, so it can be compared with ==. Failing to read the
+// file is returned as any other error.
 func (parser *Parser) ParseNext() (Read, error) {
-	lineBytes, err := parser.reader.ReadSlice('\n')
+	line, err := parser.nextLine()
 	if err != nil {
 		return Read{}, err
 	}
-	parser.line++
-	line := strings.TrimSpace(string(lineBytes))
+	read := parser.parseLine(line, parser.line)
+	if parser.strict && read.Error != nil {
+		return Read{}, read.Error
+	}
+	return read, nil
+}
+
+// ParseToChannel sends each of the parser's remaining reads to reads, in file
+// order, until the file ends or ctx is cancelled. Problems with a read are
+// put in Read.Error, even in strict mode, so that one bad read doesn't stop
+// a run. It returns nil at the end of the file, ctx.Err() if ctx was
+// cancelled, or the first failure to read the file. The caller owns reads,
+// so it is not closed.
+func (parser *Parser) ParseToChannel(ctx context.Context, reads chan<- Read) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := parser.nextLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case reads <- parser.parseLine(line, parser.line):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
+// nextLine returns the next line that isn't blank, without its newline.
+func (parser *Parser) nextLine() (string, error) {
+	var line string
+	for line == "" {
+		lineBytes, err := parser.reader.ReadSlice('\n')
+		// the last line of a file may not end with a newline, in which case
+		// it comes with io.EOF.
+		if errors.Is(err, io.EOF) && len(lineBytes) == 0 {
+			return "", io.EOF
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return "", fmt.Errorf("line %d is longer than the maximum line size of %d bytes: %w", parser.line+1, parser.reader.Size(), err)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read line %d: %w", parser.line+1, err)
+		}
+		parser.line++
+		parser.offset += int64(len(lineBytes))
+		line = strings.TrimSpace(string(lineBytes))
+	}
+	return line, nil
+}
+
+// parseLine parses a read from line, which is line number lineNumber of the
+// file. It only reads the parser's settings, so lines can be parsed
+// concurrently.
+func (parser *Parser) parseLine(line string, lineNumber uint) Read {
 	values := strings.Split(line, "\t")
 	// Reads have started.
 	// Once we have the read headers, start to parse the actual reads
 	var newRead Read
+	if len(values) != len(parser.headerMap) {
+		newRead.Error = fmt.Errorf("Expected %d columns on line %d, got %d", len(parser.headerMap), lineNumber, len(values))
+		if len(values) > len(parser.headerMap) {
+			values = values[:len(parser.headerMap)]
+		}
+	}
 	for valueIndex := 0; valueIndex < len(values); valueIndex++ {
 		fieldValue := parser.headerMap[valueIndex]
 		if values[valueIndex] == "." {
@@ -220,37 +400,37 @@ func (parser *Parser) ParseNext() (Read, error) {
 		case "read_group":
 			readGroupID, err := strconv.ParseUint(values[valueIndex], 10, 32)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed convert read_group '%s' to uint on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed convert read_group '%s' to uint on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.ReadGroupID = uint32(readGroupID)
 		case "digitisation":
 			digitisation, err := strconv.ParseFloat(values[valueIndex], 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert digitisation '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert digitisation '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.Digitisation = digitisation
 		case "offset":
 			offset, err := strconv.ParseFloat(values[valueIndex], 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert offset '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert offset '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.Offset = offset
 		case "range":
 			nanoporeRange, err := strconv.ParseFloat(values[valueIndex], 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert range '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert range '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.Range = nanoporeRange
 		case "sampling_rate":
 			samplingRate, err := strconv.ParseFloat(values[valueIndex], 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert sampling_rate '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert sampling_rate '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.SamplingRate = samplingRate
 		case "len_raw_signal":
 			lenRawSignal, err := strconv.ParseUint(values[valueIndex], 10, 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert len_raw_signal '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert len_raw_signal '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.LenRawSignal = lenRawSignal
 		case "raw_signal":
@@ -258,7 +438,7 @@ func (parser *Parser) ParseNext() (Read, error) {
 			for rawSignalIndex, rawSignalString := range strings.Split(values[valueIndex], ",") {
 				rawSignal, err := strconv.ParseInt(rawSignalString, 10, 16)
 				if err != nil {
-					newRead.Error = fmt.Errorf("Failed to convert raw signal '%s' to int on line %d, signal index %d. Got Error: %w", rawSignalString, parser.line, rawSignalIndex, err)
+					newRead.Error = fmt.Errorf("Failed to convert raw signal '%s' to int on line %d, signal index %d. Got Error: %w", rawSignalString, lineNumber, rawSignalIndex, err)
 				}
 				rawSignals = append(rawSignals, int16(rawSignal))
 			}
@@ -266,44 +446,89 @@ func (parser *Parser) ParseNext() (Read, error) {
 		case "start_time":
 			startTime, err := strconv.ParseUint(values[valueIndex], 10, 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert start_time '%s' to uint on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert start_time '%s' to uint on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.StartTime = startTime
 		case "read_number":
 			readNumber, err := strconv.ParseInt(values[valueIndex], 10, 32)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert read_number '%s' to int on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert read_number '%s' to int on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.ReadNumber = int32(readNumber)
 		case "start_mux":
 			startMux, err := strconv.ParseUint(values[valueIndex], 10, 8)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert start_mux '%s' to uint on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert start_mux '%s' to uint on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.StartMux = uint8(startMux)
 		case "median_before":
 			medianBefore, err := strconv.ParseFloat(values[valueIndex], 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert median_before '%s' to float on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert median_before '%s' to float on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			newRead.MedianBefore = medianBefore
 		case "end_reason":
 			endReasonIndex, err := strconv.ParseInt(values[valueIndex], 10, 64)
 			if err != nil {
-				newRead.Error = fmt.Errorf("Failed to convert end_reason '%s' to int on line %d. Got Error: %w", values[valueIndex], parser.line, err)
+				newRead.Error = fmt.Errorf("Failed to convert end_reason '%s' to int on line %d. Got Error: %w", values[valueIndex], lineNumber, err)
 			}
 			if _, ok := parser.endReasonMap[int(endReasonIndex)]; !ok {
-				newRead.Error = fmt.Errorf("End reason out of range. Got '%d' on line %d. Cannot find valid enum reason", int(endReasonIndex), parser.line)
+				newRead.Error = fmt.Errorf("End reason out of range. Got '%d' on line %d. Cannot find valid enum reason", int(endReasonIndex), lineNumber)
 			}
 			newRead.EndReason = parser.endReasonMap[int(endReasonIndex)]
 		case "channel_number":
 			// For whatever reason, this is a string.
 			newRead.ChannelNumber = values[valueIndex]
 		default:
-			newRead.Error = fmt.Errorf("Unknown field to parser '%s' found on line %d. Please report to github.com/TimothyStiles/poly", fieldValue, parser.line)
+			parse, registered := parser.auxParsers[fieldValue]
+			if parser.strictColumns && !registered {
+				newRead.Error = fmt.Errorf("Unknown field to parser '%s' found on line %d. Please report to github.com/TimothyStiles/poly", fieldValue, lineNumber)
+				continue
+			}
+			if newRead.ExtraAttributes == nil {
+				newRead.ExtraAttributes = make(map[string]string)
+			}
+			newRead.ExtraAttributes[fieldValue] = values[valueIndex]
+			if registered {
+				newRead.auxParsers = parser.auxParsers
+				if _, err := parse(values[valueIndex]); err != nil {
+					newRead.Error = fmt.Errorf("Failed to parse auxiliary field %s '%s' on line %d. Got Error: %w", fieldValue, values[valueIndex], lineNumber, err)
+				}
+			}
+		}
+	}
+	if parser.strict && newRead.Error == nil && newRead.LenRawSignal != uint64(len(newRead.RawSignal)) {
+		newRead.Error = fmt.Errorf("len_raw_signal is %d on line %d, but raw_signal has %d values", newRead.LenRawSignal, lineNumber, len(newRead.RawSignal))
+	}
+	if parser.verifyChecksums && newRead.Error == nil {
+		newRead.Error = verifyChecksum(newRead)
+	}
+	return newRead
+}
+
+// ReadAll parses every header and read in r into memory. It is meant for
+// small files, like test fixtures. Large runs should be parsed one read at a
+// time with NewParser and ParseNext. ReadAll stops at the first read that
+// fails to parse, returning its error.
+func ReadAll(r io.Reader, maxLineSize int) ([]Header, []Read, error) {
+	parser, headers, err := NewParser(r, maxLineSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reads []Read
+	for {
+		read, err := parser.ParseNext()
+		if errors.Is(err, io.EOF) {
+			return headers, reads, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if read.Error != nil {
+			return nil, nil, fmt.Errorf("failed to parse read %s: %w", read.ReadID, read.Error)
 		}
+		reads = append(reads, read)
 	}
-	return newRead, nil
 }
 
 /******************************************************************************
@@ -326,11 +551,46 @@ Keoni
 
 ******************************************************************************/
 
-// Write writes a list of headers and a channel of reads to an output.
-func Write(headers []Header, reads <-chan Read, output io.Writer) error {
+// WriteOption configures Write.
+type WriteOption func(options *writeOptions)
+
+type writeOptions struct {
+	strictHeaders bool
+	checksums     bool
+}
+
+// WithStrictHeaders makes Write refuse headers that ReconcileHeaders finds
+// conflicts in under RequireConsistent, instead of filling missing
+// attributes with ".".
+func WithStrictHeaders() WriteOption {
+	return func(options *writeOptions) {
+		options.strictHeaders = true
+	}
+}
+
+// Write writes a list of headers and a channel of reads to an output. Read
+// groups may have different EndReasonHeaderMaps, which are merged into one
+// end_reason enum, but every read's EndReason must be in at least one of
+// them. Headers are checked with ValidateHeaders before anything is written.
+func Write(headers []Header, reads <-chan Read, output io.Writer, options ...WriteOption) error {
+	var settings writeOptions
+	for _, option := range options {
+		option(&settings)
+	}
+	if err := ValidateHeaders(headers); err != nil {
+		return err
+	}
+	if settings.strictHeaders {
+		if _, conflicts := ReconcileHeaders(headers, RequireConsistent); len(conflicts) > 0 {
+			return fmt.Errorf("headers have %d conflicts, the first is: %w", len(conflicts), conflicts[0])
+		}
+	}
+	if settings.checksums {
+		headers = withChecksumColumn(headers)
+	}
 	// First, write the slow5 version number
 	slow5Version := headers[0].Slow5Version
-	endReasonHeaderMap := headers[0].EndReasonHeaderMap
+	endReasonHeaderMap := mergeEndReasons(headers)
 	_, err := fmt.Fprintf(output, "#slow5_version\t%s\n", slow5Version)
 	if err != nil {
 		return err
@@ -340,6 +600,133 @@ func Write(headers []Header, reads <-chan Read, output io.Writer) error {
 	if err != nil {
 		return err
 	}
+	extraColumns := extraColumnNames(headers)
+	err = writeHeaderBody(headers, extraColumns, output)
+	if err != nil {
+		return err
+	}
+
+	// Iterate over reads. This is reading from a channel, and will end
+	// when the channel is closed.
+	for read := range reads {
+		if settings.checksums {
+			read = withChecksum(read)
+		}
+		// converts []int16 to string
+		var rawSignalStringBuilder strings.Builder
+		for signalIndex, signal := range read.RawSignal {
+			_, err = fmt.Fprint(&rawSignalStringBuilder, signal)
+			if err != nil {
+				return err
+			}
+			if signalIndex != len(read.RawSignal)-1 { // Don't add a comma to last number
+				_, err = fmt.Fprint(&rawSignalStringBuilder, ",")
+				if err != nil {
+					return err
+				}
+			}
+		}
+		// Reads without an end reason get ".", the slow5 missing value.
+		endReason := "."
+		if read.EndReason != "" {
+			endReasonIndex, ok := endReasonHeaderMap[read.EndReason]
+			if !ok {
+				return fmt.Errorf("read %s has end reason '%s', which isn't in the EndReasonHeaderMap of any header", read.ReadID, read.EndReason)
+			}
+			endReason = strconv.Itoa(endReasonIndex)
+		}
+		// Look at above output.Write("#read_id ... for the values here.
+		_, err = fmt.Fprintf(output, "%s\t%d\t%g\t%g\t%g\t%g\t%d\t%s\t%d\t%d\t%d\t%g\t%s\t%s", read.ReadID, read.ReadGroupID, read.Digitisation, read.Offset, read.Range, read.SamplingRate, read.LenRawSignal, rawSignalStringBuilder.String(), read.StartTime, read.ReadNumber, read.StartMux, read.MedianBefore, endReason, read.ChannelNumber)
+		if err != nil {
+			return err
+		}
+		err = writeExtraAttributes(read, extraColumns, output)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeEndReasons returns the union of the EndReasonHeaderMaps of headers,
+// which differ when read groups come from different runs. The end reasons of
+// the first header keep their indexes, and end reasons only found in later
+// headers are numbered after them, in the order they're found.
+func mergeEndReasons(headers []Header) map[string]int {
+	merged := make(map[string]int)
+	for _, header := range headers {
+		endReasons := make([]string, 0, len(header.EndReasonHeaderMap))
+		for endReason := range header.EndReasonHeaderMap {
+			endReasons = append(endReasons, endReason)
+		}
+		sort.Slice(endReasons, func(i, j int) bool {
+			return header.EndReasonHeaderMap[endReasons[i]] < header.EndReasonHeaderMap[endReasons[j]]
+		})
+		for _, endReason := range endReasons {
+			if _, ok := merged[endReason]; !ok {
+				merged[endReason] = len(merged)
+			}
+		}
+	}
+	return merged
+}
+
+// extraColumnNames returns the names of the extra columns of every header,
+// sorted.
+func extraColumnNames(headers []Header) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, header := range headers {
+		for name := range header.ExtraColumnTypes {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeExtraAttributes ends a read's line with its values for extraColumns,
+// or "." for values it doesn't have.
+func writeExtraAttributes(read Read, extraColumns []string, output io.Writer) error {
+	for name := range read.ExtraAttributes {
+		if !containsString(extraColumns, name) {
+			return fmt.Errorf("read %s has extra attribute %s, which isn't a column in ExtraColumnTypes of any header", read.ReadID, name)
+		}
+	}
+	var line strings.Builder
+	for _, name := range extraColumns {
+		value, ok := read.ExtraAttributes[name]
+		if !ok || value == "" {
+			value = "."
+		}
+		line.WriteString("\t")
+		line.WriteString(value)
+	}
+	line.WriteString("\n")
+	_, err := io.WriteString(output, line.String())
+	return err
+}
+
+// containsString returns true if value is in values.
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHeaderBody writes everything in a slow5 header after the version and
+// number of read groups: the attributes of each read group and the read
+// column types and names, followed by extraColumns. blow5 files contain the
+// same text.
+func writeHeaderBody(headers []Header, extraColumns []string, output io.Writer) error {
+	var err error
+	endReasonHeaderMap := mergeEndReasons(headers)
 	// Next, we need a map of what attribute values are available
 	possibleAttributeKeys := make(map[string]bool)
 	for _, header := range headers {
@@ -395,46 +782,29 @@ func Write(headers []Header, reads <-chan Read, output io.Writer) error {
 		endReasonStringList[endReasonIndex] = endReasonString
 	}
 	// Build endReasonString
-	var endReasonStringBuilder strings.Builder
-	for _, endReason := range endReasonStringList {
-		fmt.Fprintf(&endReasonStringBuilder, "%s,", endReason)
-	}
-	endReasonString := endReasonStringBuilder.String()
-	endReasonString = endReasonString[:len(endReasonString)-1] // Remove trailing comma
+	endReasonString := strings.Join(endReasonStringList, ",")
 
 	// Write the read headers
 	// These are according to the slow5 specifications
-	_, err = fmt.Fprintf(output, "#char*	uint32_t	double	double	double	double	uint64_t	int16_t*	uint64_t	int32_t	uint8_t	double	enum{%s}	char*\n", endReasonString)
+	// Extra columns go after the standard ones, with the type of the first
+	// header declaring them.
+	var extraTypes, extraNames strings.Builder
+	for _, name := range extraColumns {
+		for _, header := range headers {
+			if columnType, ok := header.ExtraColumnTypes[name]; ok {
+				extraTypes.WriteString("\t" + columnType)
+				break
+			}
+		}
+		extraNames.WriteString("\t" + name)
+	}
+	_, err = fmt.Fprintf(output, "#char*	uint32_t	double	double	double	double	uint64_t	int16_t*	uint64_t	int32_t	uint8_t	double	enum{%s}	char*%s\n", endReasonString, extraTypes.String())
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintln(output, "#read_id	read_group	digitisation	offset	range	sampling_rate	len_raw_signal	raw_signal	start_time	read_number	start_mux	median_before	end_reason	channel_number")
+	_, err = fmt.Fprintf(output, "#read_id	read_group	digitisation	offset	range	sampling_rate	len_raw_signal	raw_signal	start_time	read_number	start_mux	median_before	end_reason	channel_number%s\n", extraNames.String())
 	if err != nil {
 		return err
 	}
-
-	// Iterate over reads. This is reading from a channel, and will end
-	// when the channel is closed.
-	for read := range reads {
-		// converts []int16 to string
-		var rawSignalStringBuilder strings.Builder
-		for signalIndex, signal := range read.RawSignal {
-			_, err = fmt.Fprint(&rawSignalStringBuilder, signal)
-			if err != nil {
-				return err
-			}
-			if signalIndex != len(read.RawSignal)-1 { // Don't add a comma to last number
-				_, err = fmt.Fprint(&rawSignalStringBuilder, ",")
-				if err != nil {
-					return err
-				}
-			}
-		}
-		// Look at above output.Write("#read_id ... for the values here.
-		_, err = fmt.Fprintf(output, "%s\t%d\t%g\t%g\t%g\t%g\t%d\t%s\t%d\t%d\t%d\t%g\t%d\t%s\n", read.ReadID, read.ReadGroupID, read.Digitisation, read.Offset, read.Range, read.SamplingRate, read.LenRawSignal, rawSignalStringBuilder.String(), read.StartTime, read.ReadNumber, read.StartMux, read.MedianBefore, endReasonHeaderMap[read.EndReason], read.ChannelNumber)
-		if err != nil {
-			return err
-		}
-	}
 	return nil
 }
@@ -1,10 +1,16 @@
 package slow5
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -83,12 +89,12 @@ func TestParseImproperHeaders(t *testing.T) {
 	}
 }
 
-func testParseReadsHelper(t *testing.T, fileTarget string, errorMessage string) {
+func testParseReadsHelper(t *testing.T, fileTarget string, errorMessage string, options ...ParserOption) {
 	file, err := os.Open(fileTarget)
 	if err != nil {
 		t.Errorf("Failed to open file with error: %s", err)
 	}
-	parser, _, _ := NewParser(file, maxLineSize)
+	parser, _, _ := NewParser(file, maxLineSize, options...)
 	var targetErr []error
 	for {
 		read, err := parser.ParseNext()
@@ -135,7 +141,6 @@ func TestParseReads(t *testing.T) {
 	}
 
 	// Test improper files
-	testParseReadsHelper(t, "data/read_tests/endReason.slow5", "Test should have failed if there are unknown end reasons")
 	testParseReadsHelper(t, "data/read_tests/continue.slow5", "Test should have failed at terminate, but should have gone through a continue")
 	testParseReadsHelper(t, "data/read_tests/read_group.slow5", "Test should have failed with bad read_group")
 	testParseReadsHelper(t, "data/read_tests/digitisation.slow5", "Test should have failed with bad digitisation")
@@ -150,7 +155,7 @@ func TestParseReads(t *testing.T) {
 	testParseReadsHelper(t, "data/read_tests/median_before.slow5", "Test should have failed with bad median_before")
 	testParseReadsHelper(t, "data/read_tests/end_reason.slow5", "Test should have failed with if end reason can't be converted to int")
 	testParseReadsHelper(t, "data/read_tests/end_reason_unknown.slow5", "Test should have failed with end reason out of range")
-	testParseReadsHelper(t, "data/read_tests/unknown.slow5", "Test should have failed with unknown header")
+	testParseReadsHelper(t, "data/read_tests/unknown.slow5", "Test should have failed with unknown header", WithStrictColumns())
 }
 
 func TestWrite(t *testing.T) {
@@ -204,3 +209,679 @@ func TestWrite(t *testing.T) {
 		t.Errorf("Example and test write are different")
 	}
 }
+
+func TestParseNoTrailingNewline(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example file: %s", err)
+	}
+	truncated := strings.TrimSuffix(string(example), "\n")
+	for _, strict := range []bool{false, true} {
+		var options []ParserOption
+		if strict {
+			options = append(options, WithStrictMode())
+		}
+		parser, _, err := NewParser(strings.NewReader(truncated), maxLineSize, options...)
+		if err != nil {
+			t.Fatalf("Failed to parse headers: %s", err)
+		}
+		read, err := parser.ParseNext()
+		if err != nil {
+			t.Fatalf("Expected the last read without a trailing newline, got error: %s", err)
+		}
+		if read.ReadID != "0026631e-33a3-49ab-aa22-3ab157d71f8b" || read.ChannelNumber != "10" {
+			t.Errorf("Last read without a trailing newline parsed incorrectly: %s, channel %s", read.ReadID, read.ChannelNumber)
+		}
+		if _, err = parser.ParseNext(); !errors.Is(err, io.EOF) {
+			t.Errorf("Expected io.EOF after the last read, got %v", err)
+		}
+	}
+}
+
+func TestParseNextEOF(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example file: %s", err)
+	}
+	// a bad digitisation is a problem with the read, not the file.
+	lines := strings.Split(strings.TrimSuffix(string(example), "\n"), "\n")
+	last := strings.Split(lines[len(lines)-1], "\t")
+	last[2] = "not a number"
+	lines = append(lines, strings.Join(last, "\t"))
+	parser, _, err := NewParser(strings.NewReader(strings.Join(lines, "\n")), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	var reads []Read
+	for {
+		read, err := parser.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected only io.EOF from ParseNext, got %s", err)
+		}
+		reads = append(reads, read)
+	}
+	if len(reads) != 2 || reads[0].Error != nil || reads[1].Error == nil {
+		t.Fatalf("Expected a good read and a read with an error, got %d reads", len(reads))
+	}
+	if _, err = parser.ParseNext(); err != io.EOF {
+		t.Errorf("Expected io.EOF again after the end of the file, got %v", err)
+	}
+
+	// a line longer than the buffer is a problem with the file.
+	parser, _, err = NewParser(bytes.NewReader(example), 4096)
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	_, err = parser.ParseNext()
+	if err == nil || errors.Is(err, io.EOF) || !errors.Is(err, bufio.ErrBufferFull) {
+		t.Errorf("Expected a line longer than the buffer to fail with bufio.ErrBufferFull, got %v", err)
+	}
+}
+
+func TestParseToChannel(t *testing.T) {
+	path := writeManyReads(t, 10)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", path, err)
+	}
+	defer file.Close()
+	parser, _, err := NewParser(file, maxLineSize, WithStrictMode())
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	reads := make(chan Read)
+	parseErrors := make(chan error, 1)
+	go func() {
+		parseErrors <- parser.ParseToChannel(context.Background(), reads)
+		close(reads)
+	}()
+	count := 0
+	for read := range reads {
+		if expected := fmt.Sprintf("read-%06d", count); read.ReadID != expected {
+			t.Errorf("Expected read %s, got %s", expected, read.ReadID)
+		}
+		count++
+	}
+	if err = <-parseErrors; err != nil || count != 10 {
+		t.Errorf("Expected 10 reads and no error, got %d and %v", count, err)
+	}
+
+	// cancelling stops the parser even if nobody is reading.
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", path, err)
+	}
+	defer file.Close()
+	parser, _, err = NewParser(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	blocked := make(chan Read)
+	go func() {
+		<-blocked
+		cancel()
+	}()
+	err = parser.ParseToChannel(ctx, blocked)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParseStrictMode(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example file: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(example), "\n"), "\n")
+	header, readLine := strings.Join(lines[:len(lines)-1], "\n")+"\n", lines[len(lines)-1]
+	columns := strings.Split(readLine, "\t")
+
+	tests := []struct {
+		name    string
+		columns []string
+	}{
+		{"extra column", append(append([]string{}, columns...), "extra")},
+		{"missing column", columns[:len(columns)-1]},
+		{"len_raw_signal mismatch", append(append(append([]string{}, columns[:6]...), "1"), columns[7:]...)},
+		{"bad field", append(append(append([]string{}, columns[:2]...), "bad"), columns[3:]...)},
+	}
+	for _, test := range tests {
+		file := header + strings.Join(test.columns, "\t") + "\n"
+
+		parser, _, err := NewParser(strings.NewReader(file), maxLineSize, WithStrictMode())
+		if err != nil {
+			t.Fatalf("%s: failed to parse headers: %s", test.name, err)
+		}
+		if _, err = parser.ParseNext(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%s: expected a strict mode error, got %v", test.name, err)
+		}
+
+		// lenient mode puts column count problems in Read.Error, and doesn't
+		// check len_raw_signal.
+		parser, _, _ = NewParser(strings.NewReader(file), maxLineSize)
+		read, err := parser.ParseNext()
+		if err != nil {
+			t.Errorf("%s: expected no error in lenient mode, got %s", test.name, err)
+		}
+		if (read.Error == nil) != (test.name == "len_raw_signal mismatch") {
+			t.Errorf("%s: unexpected Read.Error in lenient mode: %v", test.name, read.Error)
+		}
+		if test.name == "extra column" && read.Error != nil && strings.Contains(read.Error.Error(), "Unknown field") {
+			t.Errorf("extra column: extra values should not be parsed as an unknown field, got %s", read.Error)
+		}
+	}
+
+	// a good file parses the same in strict mode.
+	parser, _, _ := NewParser(strings.NewReader(string(example)), maxLineSize, WithStrictMode())
+	read, err := parser.ParseNext()
+	if err != nil || read.Error != nil {
+		t.Errorf("Expected example.slow5 to parse in strict mode, got %v, %v", err, read.Error)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open example.slow5: %s", err)
+	}
+	defer file.Close()
+	headers, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %s", err)
+	}
+	if len(headers) != 1 || len(reads) != 1 {
+		t.Fatalf("Expected 1 header and 1 read, got %d and %d", len(headers), len(reads))
+	}
+	if reads[0].ReadID != "0026631e-33a3-49ab-aa22-3ab157d71f8b" {
+		t.Errorf("Expected read 0026631e-33a3-49ab-aa22-3ab157d71f8b, got %s", reads[0].ReadID)
+	}
+
+	// bad reads and bad headers are errors.
+	for _, path := range []string{"data/read_tests/digitisation.slow5", "data/header_tests/test_header_empty.slow5"} {
+		badFile, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %s", path, err)
+		}
+		if _, _, err = ReadAll(badFile, maxLineSize); err == nil {
+			t.Errorf("Expected ReadAll of %s to fail", path)
+		}
+		badFile.Close()
+	}
+}
+
+func TestParseNoTrailingNewlineFixture(t *testing.T) {
+	// no_trailing_newline.slow5 has two reads, and the second isn't followed
+	// by a newline.
+	file, err := os.Open("data/no_trailing_newline.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open no_trailing_newline.slow5: %s", err)
+	}
+	defer file.Close()
+	_, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse no_trailing_newline.slow5: %s", err)
+	}
+	if len(reads) != 2 {
+		t.Fatalf("Expected 2 reads, got %d", len(reads))
+	}
+	if reads[1].ReadID != "0031f4c5-fd4a-4f4b-a4f5-0b1c3e3e6d57" || reads[1].ChannelNumber != "10" {
+		t.Errorf("Last read parsed incorrectly: %s, channel %s", reads[1].ReadID, reads[1].ChannelNumber)
+	}
+
+	// a file with no reads whose header doesn't end with a newline.
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example file: %s", err)
+	}
+	headerOnly := string(example[:strings.Index(string(example), "\n0026631e")])
+	parser, headers, err := NewParser(strings.NewReader(headerOnly), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse a header without a trailing newline: %s", err)
+	}
+	if len(headers) != 1 || len(parser.headerMap) != 14 {
+		t.Errorf("Expected 1 header with 14 read columns, got %d headers and %d columns", len(headers), len(parser.headerMap))
+	}
+	if _, err = parser.ParseNext(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestExtraAttributes(t *testing.T) {
+	file, err := os.Open("data/read_tests/unknown.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open unknown.slow5: %s", err)
+	}
+	defer file.Close()
+	headers, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Expected unknown columns to be kept instead of failing, got: %s", err)
+	}
+	if reads[0].ExtraAttributes["bad"] != "1" {
+		t.Errorf("Expected extra attribute bad to be 1, got %v", reads[0].ExtraAttributes)
+	}
+	if headers[0].ExtraColumnTypes["bad"] == "" {
+		t.Errorf("Expected the type of column bad to be kept, got %v", headers[0].ExtraColumnTypes)
+	}
+
+	// extra columns round trip through Write, with their types.
+	newer := &strings.Builder{}
+	headers[0].ExtraColumnTypes = map[string]string{"num_minknow_events": "uint64_t", "bad": "uint8_t"}
+	// Write needs the required attributes the test file leaves out.
+	for key, required := range KnownHeaderAttributes {
+		if _, ok := headers[0].Attributes[key]; required && !ok {
+			headers[0].Attributes[key] = "1"
+		}
+	}
+	reads[0].ExtraAttributes["num_minknow_events"] = "1234"
+	readChannel := make(chan Read, 1)
+	readChannel <- reads[0]
+	close(readChannel)
+	if err = Write(headers, readChannel, newer); err != nil {
+		t.Fatalf("Failed to write extra columns: %s", err)
+	}
+	if !strings.Contains(newer.String(), "char*\tuint8_t\tuint64_t\n") || !strings.Contains(newer.String(), "channel_number\tbad\tnum_minknow_events\n") {
+		t.Errorf("Expected extra columns and types at the end of the column lines, got:\n%s", newer.String())
+	}
+	rereadHeaders, rereads, err := ReadAll(strings.NewReader(newer.String()), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse written extra columns: %s", err)
+	}
+	if rereads[0].ExtraAttributes["num_minknow_events"] != "1234" || rereads[0].ExtraAttributes["bad"] != "1" {
+		t.Errorf("Extra attributes didn't round trip: %v", rereads[0].ExtraAttributes)
+	}
+	if rereadHeaders[0].ExtraColumnTypes["num_minknow_events"] != "uint64_t" {
+		t.Errorf("Extra column types didn't round trip: %v", rereadHeaders[0].ExtraColumnTypes)
+	}
+
+	// missing values are written as ".", and undeclared ones are an error.
+	reads[0].ExtraAttributes = map[string]string{"bad": "2"}
+	readChannel = make(chan Read, 1)
+	readChannel <- reads[0]
+	close(readChannel)
+	newer.Reset()
+	if err = Write(headers, readChannel, newer); err != nil || !strings.HasSuffix(newer.String(), "\t2\t.\n") {
+		t.Errorf("Expected a missing extra attribute to be written as '.', got %v: %q", err, newer.String()[newer.Len()-10:])
+	}
+	reads[0].ExtraAttributes = map[string]string{"undeclared": "2"}
+	readChannel = make(chan Read, 1)
+	readChannel <- reads[0]
+	close(readChannel)
+	if err = Write(headers, readChannel, &strings.Builder{}); err == nil {
+		t.Error("Expected an error writing an extra attribute without a column")
+	}
+}
+
+func TestWriteMergedEndReasons(t *testing.T) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open example.slow5: %s", err)
+	}
+	defer file.Close()
+	headers, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse example.slow5: %s", err)
+	}
+
+	// two read groups from runs with disjoint end reason enums.
+	older := headers[0]
+	older.EndReasonHeaderMap = map[string]int{"unknown": 0, "partial": 1}
+	newer := headers[0]
+	newer.ReadGroupID = 1
+	newer.EndReasonHeaderMap = map[string]int{"signal_positive": 0, "data_service_unblock_mux_change": 1}
+	first, second := reads[0], reads[0]
+	first.EndReason = "partial"
+	second.ReadID = "second"
+	second.ReadGroupID = 1
+	second.EndReason = "data_service_unblock_mux_change"
+
+	readChannel := make(chan Read, 2)
+	readChannel <- first
+	readChannel <- second
+	close(readChannel)
+	output := &strings.Builder{}
+	if err = Write([]Header{older, newer}, readChannel, output); err != nil {
+		t.Fatalf("Failed to write read groups with different end reasons: %s", err)
+	}
+	if !strings.Contains(output.String(), "enum{unknown,partial,signal_positive,data_service_unblock_mux_change}") {
+		t.Errorf("Expected the union of both enums, got:\n%s", output.String())
+	}
+	_, rereads, err := ReadAll(strings.NewReader(output.String()), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse merged file: %s", err)
+	}
+	if rereads[0].EndReason != "partial" || rereads[1].EndReason != "data_service_unblock_mux_change" {
+		t.Errorf("End reasons didn't round trip, got %s and %s", rereads[0].EndReason, rereads[1].EndReason)
+	}
+
+	// end reasons missing from every header are an error.
+	second.EndReason = "mux_change"
+	readChannel = make(chan Read, 1)
+	readChannel <- second
+	close(readChannel)
+	if err = Write([]Header{older, newer}, readChannel, &strings.Builder{}); err == nil || !strings.Contains(err.Error(), "mux_change") {
+		t.Errorf("Expected an error for an end reason in no header, got %v", err)
+	}
+
+	// headers without an enum write an empty one, and reads without an end
+	// reason write ".".
+	older.EndReasonHeaderMap = nil
+	first.EndReason = ""
+	readChannel = make(chan Read, 1)
+	readChannel <- first
+	close(readChannel)
+	output.Reset()
+	if err = Write([]Header{older}, readChannel, output); err != nil {
+		t.Fatalf("Failed to write a header without end reasons: %s", err)
+	}
+	_, rereads, err = ReadAll(strings.NewReader(output.String()), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse file without end reasons: %s", err)
+	}
+	if rereads[0].EndReason != "" {
+		t.Errorf("Expected no end reason, got %s", rereads[0].EndReason)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example.slow5: %s", err)
+	}
+	noTrailingNewline, err := os.ReadFile("data/no_trailing_newline.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read no_trailing_newline.slow5: %s", err)
+	}
+	headers, reads, err := ReadAll(bytes.NewReader(example), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse example.slow5: %s", err)
+	}
+
+	// a run whose enum is in a different order, with fewer end reasons.
+	reordered := headers[0]
+	reordered.Attributes = map[string]string{"@run_id": "reordered"}
+	for key, value := range headers[0].Attributes {
+		if key != "@run_id" {
+			reordered.Attributes[key] = value
+		}
+	}
+	reordered.EndReasonHeaderMap = map[string]int{"signal_negative": 0, "signal_positive": 1, "unknown": 2}
+	read := reads[0]
+	read.ReadID = "reordered"
+	read.EndReason = "signal_positive"
+	readChannel := make(chan Read, 1)
+	readChannel <- read
+	close(readChannel)
+	var reorderedFile bytes.Buffer
+	if err = Write([]Header{reordered}, readChannel, &reorderedFile); err != nil {
+		t.Fatalf("Failed to write reordered run: %s", err)
+	}
+
+	var merged bytes.Buffer
+	inputs := []io.Reader{bytes.NewReader(example), bytes.NewReader(noTrailingNewline), &reorderedFile}
+	if err = Merge(inputs, maxLineSize, &merged); err != nil {
+		t.Fatalf("Failed to merge: %s", err)
+	}
+	// the read_group column of each read is renumbered.
+	var readGroupColumn []string
+	for _, line := range strings.Split(strings.TrimSpace(merged.String()), "\n") {
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "@") {
+			readGroupColumn = append(readGroupColumn, strings.Split(line, "\t")[1])
+		}
+	}
+	if expected := []string{"0", "0", "0", "1"}; strings.Join(readGroupColumn, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected read_group column %v, got %v", expected, readGroupColumn)
+	}
+	mergedHeaders, mergedReads, err := ReadAll(&merged, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse merged file: %s", err)
+	}
+	// example.slow5 and no_trailing_newline.slow5 are the same run.
+	if len(mergedHeaders) != 2 {
+		t.Fatalf("Expected 2 read groups, got %d", len(mergedHeaders))
+	}
+	expected := []struct {
+		readGroupID uint32
+		endReason   string
+	}{{0, reads[0].EndReason}, {0, reads[0].EndReason}, {0, reads[0].EndReason}, {1, "signal_positive"}}
+	if len(mergedReads) != len(expected) {
+		t.Fatalf("Expected %d reads, got %d", len(expected), len(mergedReads))
+	}
+	for index, read := range mergedReads {
+		if read.ReadGroupID != expected[index].readGroupID || read.EndReason != expected[index].endReason {
+			t.Errorf("Read %d: expected read group %d and end reason %s, got %d and %s", index, expected[index].readGroupID, expected[index].endReason, read.ReadGroupID, read.EndReason)
+		}
+	}
+
+	if err = Merge(nil, maxLineSize, &merged); err == nil {
+		t.Error("Expected an error merging nothing")
+	}
+	if err = Merge([]io.Reader{strings.NewReader("#slow5_version\t0.2.0\n")}, maxLineSize, &merged); err == nil {
+		t.Error("Expected an error merging a broken file")
+	}
+}
+
+func TestMergeSameRunDifferentEndReasons(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example.slow5: %s", err)
+	}
+	headers, reads, err := ReadAll(bytes.NewReader(example), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse example.slow5: %s", err)
+	}
+
+	// both inputs have the attributes of example.slow5, but each declares
+	// an end reason and the second a column that the other doesn't.
+	first := headers[0]
+	first.EndReasonHeaderMap = map[string]int{"unknown": 0, "signal_positive": 1}
+	first.ExtraColumnTypes = nil
+	second := headers[0]
+	second.EndReasonHeaderMap = map[string]int{"unknown": 0, "mux_change": 1}
+	second.ExtraColumnTypes = map[string]string{"num_minknow_events": "uint64_t"}
+
+	write := func(header Header, endReason string, extraAttributes map[string]string) []byte {
+		read := reads[0]
+		read.EndReason = endReason
+		read.ExtraAttributes = extraAttributes
+		readChannel := make(chan Read, 1)
+		readChannel <- read
+		close(readChannel)
+		var file bytes.Buffer
+		if err := Write([]Header{header}, readChannel, &file); err != nil {
+			t.Fatalf("Failed to write file to merge: %s", err)
+		}
+		return file.Bytes()
+	}
+	inputs := []io.Reader{
+		bytes.NewReader(write(first, "signal_positive", nil)),
+		bytes.NewReader(write(second, "mux_change", map[string]string{"num_minknow_events": "42"})),
+	}
+
+	var merged bytes.Buffer
+	if err = Merge(inputs, maxLineSize, &merged); err != nil {
+		t.Fatalf("Failed to merge read groups with different end reasons: %s", err)
+	}
+	mergedHeaders, mergedReads, err := ReadAll(bytes.NewReader(merged.Bytes()), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse merged file: %s", err)
+	}
+	if len(mergedHeaders) != 1 {
+		t.Fatalf("Expected 1 read group, got %d", len(mergedHeaders))
+	}
+	if len(mergedReads) != 2 {
+		t.Fatalf("Expected 2 reads, got %d", len(mergedReads))
+	}
+	if mergedReads[0].EndReason != "signal_positive" || mergedReads[1].EndReason != "mux_change" {
+		t.Errorf("Expected end reasons signal_positive and mux_change, got %s and %s", mergedReads[0].EndReason, mergedReads[1].EndReason)
+	}
+	if value := mergedReads[1].ExtraAttributes["num_minknow_events"]; value != "42" {
+		t.Errorf("Expected num_minknow_events 42, got %q", value)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example.slow5: %s", err)
+	}
+	headers, reads, err := ReadAll(bytes.NewReader(example), maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse example.slow5: %s", err)
+	}
+	second := headers[0]
+	second.ReadGroupID = 1
+	second.Attributes = map[string]string{"@run_id": "second"}
+	for key, value := range headers[0].Attributes {
+		if key != "@run_id" {
+			second.Attributes[key] = value
+		}
+	}
+	readChannel := make(chan Read, 3)
+	for index, readGroupID := range []uint32{1, 0, 1} {
+		read := reads[0]
+		read.ReadID = fmt.Sprintf("read%d", index)
+		read.ReadGroupID = readGroupID
+		readChannel <- read
+	}
+	close(readChannel)
+	var combined bytes.Buffer
+	if err = Write([]Header{headers[0], second}, readChannel, &combined); err != nil {
+		t.Fatalf("Failed to write file to split: %s", err)
+	}
+
+	outputs := make(map[uint32]*bytes.Buffer)
+	err = Split(bytes.NewReader(combined.Bytes()), maxLineSize, func(readGroupID uint32) (io.Writer, error) {
+		outputs[readGroupID] = &bytes.Buffer{}
+		return outputs[readGroupID], nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to split: %s", err)
+	}
+	expected := map[uint32][]string{0: {"read1"}, 1: {"read0", "read2"}}
+	for readGroupID, readIDs := range expected {
+		splitHeaders, splitReads, err := ReadAll(outputs[readGroupID], maxLineSize)
+		if err != nil {
+			t.Fatalf("Failed to parse read group %d: %s", readGroupID, err)
+		}
+		if len(splitHeaders) != 1 || splitHeaders[0].ReadGroupID != 0 {
+			t.Errorf("Read group %d: expected one header with read group 0, got %v", readGroupID, splitHeaders)
+		}
+		if len(splitReads) != len(readIDs) {
+			t.Fatalf("Read group %d: expected %d reads, got %d", readGroupID, len(readIDs), len(splitReads))
+		}
+		for index, read := range splitReads {
+			if read.ReadID != readIDs[index] || read.ReadGroupID != 0 {
+				t.Errorf("Read group %d: expected read %s in read group 0, got %s in %d", readGroupID, readIDs[index], read.ReadID, read.ReadGroupID)
+			}
+		}
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example.slow5: %s", err)
+	}
+	discard := func(uint32) (io.Writer, error) { return io.Discard, nil }
+
+	// a read in read group 3 of a file with one read group.
+	lines := strings.Split(string(example), "\n")
+	for index, line := range lines {
+		if strings.HasPrefix(line, "0026631e") {
+			values := strings.Split(line, "\t")
+			values[1] = "3"
+			lines[index] = strings.Join(values, "\t")
+		}
+	}
+	err = Split(strings.NewReader(strings.Join(lines, "\n")), maxLineSize, discard)
+	if err == nil || !strings.Contains(err.Error(), "read group 3") {
+		t.Errorf("Expected an error for a read without a header, got %v", err)
+	}
+
+	failing := func(uint32) (io.Writer, error) { return nil, errors.New("permission denied") }
+	if err = Split(bytes.NewReader(example), maxLineSize, failing); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected the error of outputFor, got %v", err)
+	}
+}
+
+func TestRegisterAux(t *testing.T) {
+	parse := func(options ...ParserOption) Read {
+		t.Helper()
+		file, err := os.Open("data/read_tests/unknown.slow5")
+		if err != nil {
+			t.Fatalf("Failed to open unknown.slow5: %s", err)
+		}
+		defer file.Close()
+		parser, _, err := NewParser(file, maxLineSize, options...)
+		if err != nil {
+			t.Fatalf("Failed to parse headers: %s", err)
+		}
+		parser.RegisterAux("bad", func(value string) (interface{}, error) {
+			return strconv.Atoi(value)
+		})
+		read, err := parser.ParseNext()
+		if err != nil {
+			t.Fatalf("Failed to parse read: %s", err)
+		}
+		return read
+	}
+
+	// registered columns are parsed, even with strict columns.
+	for _, read := range []Read{parse(), parse(WithStrictColumns())} {
+		if read.Error != nil {
+			t.Errorf("Unexpected error: %s", read.Error)
+		}
+		if value, err := read.Aux("bad"); err != nil || value != 1 {
+			t.Errorf("Expected aux field bad to be parsed to 1, got %#v, %v", value, err)
+		}
+		if read.ExtraAttributes["bad"] != "1" {
+			t.Errorf("Expected the raw value to be kept for Write, got %v", read.ExtraAttributes)
+		}
+
+		// Aux parses what is in ExtraAttributes, so a changed value is
+		// what it returns and what Write writes.
+		read.ExtraAttributes["bad"] = "2"
+		if value, err := read.Aux("bad"); err != nil || value != 2 {
+			t.Errorf("Expected the changed aux field bad to be parsed to 2, got %#v, %v", value, err)
+		}
+		if value, err := read.Aux("missing"); err != nil || value != nil {
+			t.Errorf("Expected no value for a missing column, got %#v, %v", value, err)
+		}
+	}
+
+	// unregistered columns are raw strings.
+	reads := readAllOrFail(t, "data/read_tests/unknown.slow5")
+	if value, err := reads[0].Aux("bad"); err != nil || value != "1" {
+		t.Errorf("Expected aux field bad to be the string 1, got %#v, %v", value, err)
+	}
+
+	// handler errors end up in Read.Error.
+	file, _ := os.Open("data/read_tests/unknown.slow5")
+	defer file.Close()
+	parser, _, _ := NewParser(file, maxLineSize)
+	parser.RegisterAux("bad", func(value string) (interface{}, error) {
+		return nil, errors.New("not a flag")
+	})
+	read, _ := parser.ParseNext()
+	if read.Error == nil || !strings.Contains(read.Error.Error(), "not a flag") {
+		t.Errorf("Expected the handler's error, got %v", read.Error)
+	}
+}
+
+func readAllOrFail(t *testing.T, path string) []Read {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", path, err)
+	}
+	defer file.Close()
+	_, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %s", path, err)
+	}
+	return reads
+}
@@ -0,0 +1,260 @@
+package slow5
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+/******************************************************************************
+
+Sorted writing begins here
+
+Indexing tools want reads in order, but a run rarely fits in memory, so
+WriteSorted is an external merge sort. Reads are collected until there are
+maxInMemory of them, sorted and spilled to a temporary slow5 file, and once
+the channel closes the sorted runs are merged into the output, holding just
+one read per run in memory. A run that fits in memory is sorted and written
+without touching the disk.
+
+Spilled runs are written and parsed as slow5, so reads come out of them like
+they would from any slow5 file, with their extra columns in
+ExtraAttributes. Temporary files are removed however WriteSorted returns.
+
+******************************************************************************/
+
+// ByReadID orders reads by ReadID, for WriteSorted.
+func ByReadID(a, b Read) bool {
+	return a.ReadID < b.ReadID
+}
+
+// ByStartTime orders reads by StartTime, for WriteSorted.
+func ByStartTime(a, b Read) bool {
+	return a.StartTime < b.StartTime
+}
+
+// WriteSorted is Write, but writes reads in the order given by less, holding
+// at most maxInMemory of them in memory and spilling the rest to temporary
+// files. Reads that are equal under less keep the order they came in. A
+// maxInMemory below 1 holds every read in memory.
+func WriteSorted(headers []Header, reads <-chan Read, output io.Writer, less func(a, b Read) bool, maxInMemory int) (err error) {
+	if err = ValidateHeaders(headers); err != nil {
+		return err
+	}
+	var runs []*sortedRun
+	defer func() {
+		for _, run := range runs {
+			if closeErr := run.close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	var buffer []Read
+	for read := range reads {
+		buffer = append(buffer, read)
+		if maxInMemory > 0 && len(buffer) >= maxInMemory {
+			run, err := spillRun(headers, buffer, less)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			buffer = nil
+		}
+	}
+	sort.SliceStable(buffer, func(i, j int) bool { return less(buffer[i], buffer[j]) })
+	runs = append(runs, &sortedRun{reads: buffer})
+
+	merged := make(chan Read)
+	mergeErrors := make(chan error, 1)
+	go func() {
+		defer close(merged)
+		mergeErrors <- mergeRuns(runs, less, merged)
+	}()
+	err = Write(headers, merged, output)
+	for range merged {
+		// keep merging after a failed write so the merge can finish.
+	}
+	if mergeErr := <-mergeErrors; mergeErr != nil {
+		return mergeErr
+	}
+	return err
+}
+
+// sortedRun is a sorted run of reads, either in memory or spilled to a
+// temporary slow5 file.
+type sortedRun struct {
+	reads  []Read
+	parser *Parser
+	file   *os.File
+}
+
+// next returns the next read of the run, or io.EOF once it has none left.
+func (run *sortedRun) next() (Read, error) {
+	if run.parser == nil {
+		if len(run.reads) == 0 {
+			return Read{}, io.EOF
+		}
+		read := run.reads[0]
+		run.reads = run.reads[1:]
+		return read, nil
+	}
+	read, err := run.parser.ParseNext()
+	if err == nil && read.Error != nil {
+		err = fmt.Errorf("failed to parse read %s of spilled run %s: %w", read.ReadID, run.file.Name(), read.Error)
+	}
+	return read, err
+}
+
+// close removes the run's temporary file, if it has one.
+func (run *sortedRun) close() error {
+	if run.file == nil {
+		return nil
+	}
+	closeErr := run.file.Close()
+	removeErr := os.Remove(run.file.Name())
+	run.file = nil
+	if removeErr != nil {
+		return removeErr
+	}
+	return closeErr
+}
+
+// spillRun sorts reads and writes them to a temporary file, returning a run
+// that parses them back.
+func spillRun(headers []Header, reads []Read, less func(a, b Read) bool) (*sortedRun, error) {
+	sort.SliceStable(reads, func(i, j int) bool { return less(reads[i], reads[j]) })
+	file, err := os.CreateTemp("", "slow5-sort-*.slow5")
+	if err != nil {
+		return nil, err
+	}
+	run := &sortedRun{file: file}
+
+	channel := make(chan Read)
+	go func() {
+		defer close(channel)
+		for _, read := range reads {
+			channel <- read
+		}
+	}()
+	writer := bufio.NewWriter(file)
+	err = Write(headers, channel, writer)
+	for range channel {
+		// drain the reads left after a failed write.
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		run.parser, _, err = NewParser(file, spillLineSize(headers, reads))
+	}
+	if err != nil {
+		run.close()
+		return nil, err
+	}
+	return run, nil
+}
+
+// spillLineSize returns a line size long enough for every line of a slow5
+// file of headers and reads.
+func spillLineSize(headers []Header, reads []Read) int {
+	// the header lines are at most every attribute value plus a key, and
+	// the column names and types.
+	size := 4096
+	for _, header := range headers {
+		size += len(header.ExtraColumnTypes) * 64
+		for _, value := range header.Attributes {
+			size += len(value) + 1
+		}
+		for endReason := range header.EndReasonHeaderMap {
+			size += len(endReason) + 1
+		}
+	}
+	for _, read := range reads {
+		// a signal value is at most 6 characters and a comma, and numbers
+		// other than the signal are at most 32 characters each.
+		lineSize := 4096 + len(read.ReadID) + len(read.ChannelNumber) + 7*len(read.RawSignal)
+		for _, value := range read.ExtraAttributes {
+			lineSize += len(value) + 1
+		}
+		if lineSize > size {
+			size = lineSize
+		}
+	}
+	return size
+}
+
+// mergeRuns sends the reads of every run to reads, merged in the order
+// given by less. Ties go to the earlier run, so merging stable runs made in
+// order is stable.
+func mergeRuns(runs []*sortedRun, less func(a, b Read) bool, reads chan<- Read) error {
+	heads := &runHeap{less: less}
+	for index, run := range runs {
+		read, err := run.next()
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		heads.items = append(heads.items, runHead{read: read, run: index})
+	}
+	heap.Init(heads)
+	for heads.Len() > 0 {
+		head := heads.items[0]
+		reads <- head.read
+		read, err := runs[head.run].next()
+		if errors.Is(err, io.EOF) {
+			heap.Pop(heads)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		heads.items[0].read = read
+		heap.Fix(heads, 0)
+	}
+	return nil
+}
+
+// runHead is the next read of a run being merged.
+type runHead struct {
+	read Read
+	run  int
+}
+
+// runHeap is a heap of the next reads of runs, ordered by less and then by
+// run, for container/heap.
+type runHeap struct {
+	items []runHead
+	less  func(a, b Read) bool
+}
+
+func (h *runHeap) Len() int { return len(h.items) }
+
+func (h *runHeap) Less(i, j int) bool {
+	if h.less(h.items[i].read, h.items[j].read) {
+		return true
+	}
+	if h.less(h.items[j].read, h.items[i].read) {
+		return false
+	}
+	return h.items[i].run < h.items[j].run
+}
+
+func (h *runHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *runHeap) Push(x interface{}) { h.items = append(h.items, x.(runHead)) }
+
+func (h *runHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,77 @@
+package slow5
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+// shuffledReads returns count copies of the example read with unique ReadIDs
+// and StartTimes, shuffled, and the example's headers.
+func shuffledReads(t *testing.T, count int) ([]Header, []Read) {
+	file, err := os.Open("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to open example.slow5: %s", err)
+	}
+	defer file.Close()
+	headers, reads, err := ReadAll(file, maxLineSize)
+	if err != nil {
+		t.Fatalf("Failed to parse example.slow5: %s", err)
+	}
+	shuffled := make([]Read, count)
+	for index := range shuffled {
+		read := reads[0]
+		read.ReadID = fmt.Sprintf("read-%03d", index)
+		// start times run backwards, and pairs of reads share one.
+		read.StartTime = uint64(count - index/2)
+		read.RawSignal = read.RawSignal[:index+1]
+		read.LenRawSignal = uint64(index + 1)
+		shuffled[index] = read
+	}
+	rand.New(rand.NewSource(1)).Shuffle(count, func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return headers, shuffled
+}
+
+func TestWriteSorted(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	headers, reads := shuffledReads(t, 25)
+
+	for name, less := range map[string]func(a, b Read) bool{"read ID": ByReadID, "start time": ByStartTime} {
+		expected := append([]Read{}, reads...)
+		sort.SliceStable(expected, func(i, j int) bool { return less(expected[i], expected[j]) })
+		var expectedOutput bytes.Buffer
+		if err := Write(headers, sendAll(expected), &expectedOutput); err != nil {
+			t.Fatalf("%s: failed to write sorted reads: %s", name, err)
+		}
+
+		// 4 spills 6 runs, 25 holds everything, and 0 never spills.
+		for _, maxInMemory := range []int{4, 25, 0} {
+			var output bytes.Buffer
+			if err := WriteSorted(headers, sendAll(reads), &output, less, maxInMemory); err != nil {
+				t.Fatalf("%s, %d in memory: %s", name, maxInMemory, err)
+			}
+			if output.String() != expectedOutput.String() {
+				t.Errorf("%s, %d in memory: output isn't sorted stably", name, maxInMemory)
+			}
+		}
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("Expected temporary files to be removed, found %d", len(files))
+	}
+
+	// a read that can't be written fails the spill, which is still removed.
+	reads[7].EndReason = "not an end reason"
+	if err := WriteSorted(headers, sendAll(reads), &bytes.Buffer{}, ByReadID, 4); err == nil {
+		t.Error("Expected WriteSorted to fail on a read with an unknown end reason")
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("Expected temporary files to be removed after an error, found %d", len(files))
+	}
+	if err := WriteSorted(nil, sendAll(reads), &bytes.Buffer{}, ByReadID, 4); err == nil {
+		t.Error("Expected WriteSorted to fail without headers")
+	}
+}
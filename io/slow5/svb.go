@@ -0,0 +1,91 @@
+package slow5
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/******************************************************************************
+
+svb-zd signal compression begins here
+
+Nanopore signal is a slowly wandering current, so consecutive samples are
+close to each other. svb-zd, the signal compression of slow5tools, takes
+advantage of that in three steps:
+
+	delta:      store each sample as its difference from the previous one,
+	            which is almost always small.
+	zigzag:     map signed differences onto unsigned integers so small
+	            negative numbers stay small: 0, -1, 1, -2, 2 become
+	            0, 1, 2, 3, 4.
+	streamvbyte: store each integer in 1 to 4 bytes. Lengths are packed as
+	            2 bit codes into control bytes, 4 per byte with the first
+	            integer in the lowest bits, and all control bytes come
+	            before all data bytes.
+
+The result is prefixed with the number of samples as a uint32. Everything is
+little endian.
+
+******************************************************************************/
+
+// svbZdEncode compresses a raw signal with svb-zd.
+func svbZdEncode(signal []int16) []byte {
+	controlLength := (len(signal) + 3) / 4
+	encoded := make([]byte, 4+controlLength, 4+controlLength+2*len(signal))
+	binary.LittleEndian.PutUint32(encoded, uint32(len(signal)))
+	control := encoded[4 : 4+controlLength]
+
+	var previous int32
+	for index, sample := range signal {
+		delta := int32(sample) - previous
+		previous = int32(sample)
+		zigzag := uint32(delta<<1) ^ uint32(delta>>31)
+
+		length := 1
+		for length < 4 && zigzag>>(8*length) != 0 {
+			length++
+		}
+		control[index/4] |= byte(length-1) << (2 * (index % 4))
+		for byteIndex := 0; byteIndex < length; byteIndex++ {
+			encoded = append(encoded, byte(zigzag>>(8*byteIndex)))
+		}
+	}
+	return encoded
+}
+
+// svbZdDecode decompresses a raw signal compressed with svbZdEncode, checking
+// that it holds count samples.
+func svbZdDecode(encoded []byte, count uint64) ([]int16, error) {
+	if len(encoded) < 4 {
+		return nil, fmt.Errorf("svb-zd signal is too short")
+	}
+	if length := uint64(binary.LittleEndian.Uint32(encoded)); length != count {
+		return nil, fmt.Errorf("svb-zd signal has %d samples, expected %d", length, count)
+	}
+	controlLength := (int(count) + 3) / 4
+	if len(encoded) < 4+controlLength {
+		return nil, fmt.Errorf("svb-zd signal is too short")
+	}
+	control, data := encoded[4:4+controlLength], encoded[4+controlLength:]
+
+	signal := make([]int16, count)
+	var previous int32
+	for index := range signal {
+		length := int(control[index/4]>>(2*(index%4))&3) + 1
+		if len(data) < length {
+			return nil, fmt.Errorf("svb-zd signal is too short")
+		}
+		var zigzag uint32
+		for byteIndex := 0; byteIndex < length; byteIndex++ {
+			zigzag |= uint32(data[byteIndex]) << (8 * byteIndex)
+		}
+		data = data[length:]
+		delta := int32(zigzag>>1) ^ -int32(zigzag&1)
+		previous += delta
+		signal[index] = int16(previous)
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("svb-zd signal has %d extra bytes", len(data))
+	}
+	return signal, nil
+}
@@ -0,0 +1,235 @@
+package slow5
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+/******************************************************************************
+
+Watch mode begins here
+
+During a run MinKNOW writes reads into a directory as they are sequenced,
+starting new files every so often and appending to the newest ones. Pipelines
+that basecall or align in real time want those reads as soon as they land,
+which is what Watch is for.
+
+Watch polls a directory for .slow5 files. Every file is read up to its last
+complete line, so a record that is still being written is left alone until
+its newline shows up, and the next poll picks up from that record boundary.
+Reads are deduplicated by ReadID, so files rewritten after a restart don't
+deliver the same read twice.
+
+MinKNOW writes a final_summary file once a run is done. When one appears,
+Watch reads whatever is left, including a final record without a newline,
+and stops.
+
+******************************************************************************/
+
+// watchFinalSummaryPattern matches the file MinKNOW writes at the end of a
+// run.
+const watchFinalSummaryPattern = "final_summary*"
+
+// watchedFile is how far Watch has read a slow5 file.
+type watchedFile struct {
+	offset int64   // offset is the start of the first record not read yet.
+	parser *Parser // parser is nil until the file's header is complete.
+	failed bool    // failed files had a broken header and are skipped.
+}
+
+// watcher holds the state of a Watch.
+type watcher struct {
+	ctx     context.Context
+	dir     string
+	files   map[string]*watchedFile
+	seen    map[string]bool
+	reads   chan Read
+	headers chan []Header
+	errors  chan error
+}
+
+// Watch streams reads from the .slow5 files in dir as they are written,
+// checking for new data every pollInterval. The headers of each file are
+// sent before any of its reads. Problems, like reads that fail to parse, are
+// sent as errors without stopping the watch.
+//
+// Watch stops, closing all three channels, when ctx is cancelled or once a
+// final_summary file appears in dir and everything has been read. All three
+// channels must be read from until they are closed.
+func Watch(ctx context.Context, dir string, pollInterval time.Duration) (<-chan Read, <-chan []Header, <-chan error) {
+	w := &watcher{
+		ctx:     ctx,
+		dir:     dir,
+		files:   make(map[string]*watchedFile),
+		seen:    make(map[string]bool),
+		reads:   make(chan Read),
+		headers: make(chan []Header),
+		errors:  make(chan error),
+	}
+	go func() {
+		defer close(w.errors)
+		defer close(w.headers)
+		defer close(w.reads)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			// look for the final summary before polling, so the poll sees
+			// everything written before the summary.
+			summaries, err := filepath.Glob(filepath.Join(dir, watchFinalSummaryPattern))
+			if err != nil && !w.sendError(err) {
+				return
+			}
+			final := len(summaries) > 0
+			if !w.poll(final) || final {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return w.reads, w.headers, w.errors
+}
+
+// poll reads new data from every slow5 file in the directory. It returns
+// false if the watch was cancelled.
+func (w *watcher) poll(final bool) bool {
+	paths, err := filepath.Glob(filepath.Join(w.dir, "*.slow5"))
+	if err != nil {
+		return w.sendError(err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !w.tail(path, final) {
+			return false
+		}
+	}
+	return true
+}
+
+// tail reads new records from the file at path. Unless final is true, a
+// last line without a newline is left for later. It returns false if the
+// watch was cancelled.
+func (w *watcher) tail(path string, final bool) bool {
+	file, ok := w.files[path]
+	if !ok {
+		file = &watchedFile{}
+		w.files[path] = file
+	}
+	if file.failed {
+		return true
+	}
+	data, err := readFrom(path, file.offset)
+	if err != nil {
+		return w.sendError(err)
+	}
+	if !final {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	}
+	if len(data) == 0 {
+		return true
+	}
+
+	if file.parser == nil {
+		parser, headers, err := NewParser(bytes.NewReader(data), len(data)+1)
+		if errors.Is(err, io.EOF) && !final {
+			return true // the header isn't finished yet.
+		}
+		if err != nil {
+			file.failed = true
+			return w.sendError(fmt.Errorf("failed to parse header of %s: %w", path, err))
+		}
+		if !w.sendHeaders(headers) {
+			return false
+		}
+		file.parser = parser
+		file.offset = parser.offset
+		data = data[parser.offset:]
+	}
+
+	parser := &Parser{
+		reader:       *bufio.NewReaderSize(bytes.NewReader(data), len(data)+1),
+		line:         file.parser.line,
+		headerMap:    file.parser.headerMap,
+		endReasonMap: file.parser.endReasonMap,
+	}
+	for {
+		read, err := parser.ParseNext()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return w.sendError(fmt.Errorf("failed to read %s: %w", path, err))
+		}
+		// reads that fail to parse aren't marked as seen, so a fixed copy of
+		// them can still come through.
+		if read.Error != nil {
+			if !w.sendError(fmt.Errorf("%s: %w", path, read.Error)) {
+				return false
+			}
+			continue
+		}
+		if w.seen[read.ReadID] {
+			continue
+		}
+		w.seen[read.ReadID] = true
+		if !w.sendRead(read) {
+			return false
+		}
+	}
+	file.offset += parser.offset
+	file.parser.line = parser.line
+	return true
+}
+
+// readFrom reads the file at path from offset to its end.
+func readFrom(path string, offset int64) ([]byte, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(file)
+}
+
+// sendRead sends read, returning false if the watch was cancelled.
+func (w *watcher) sendRead(read Read) bool {
+	select {
+	case w.reads <- read:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// sendHeaders sends headers, returning false if the watch was cancelled.
+func (w *watcher) sendHeaders(headers []Header) bool {
+	select {
+	case w.headers <- headers:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// sendError sends err, returning false if the watch was cancelled.
+func (w *watcher) sendError(err error) bool {
+	select {
+	case w.errors <- err:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,169 @@
+package slow5
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchCollector collects everything sent by Watch.
+type watchCollector struct {
+	mutex   sync.Mutex
+	readIDs []string
+	headers int
+	errors  []error
+	done    sync.WaitGroup
+}
+
+func collectWatch(reads <-chan Read, headers <-chan []Header, errs <-chan error) *watchCollector {
+	collector := &watchCollector{}
+	collector.done.Add(3)
+	go func() {
+		defer collector.done.Done()
+		for read := range reads {
+			collector.mutex.Lock()
+			collector.readIDs = append(collector.readIDs, read.ReadID)
+			collector.mutex.Unlock()
+		}
+	}()
+	go func() {
+		defer collector.done.Done()
+		for range headers {
+			collector.mutex.Lock()
+			collector.headers++
+			collector.mutex.Unlock()
+		}
+	}()
+	go func() {
+		defer collector.done.Done()
+		for err := range errs {
+			collector.mutex.Lock()
+			collector.errors = append(collector.errors, err)
+			collector.mutex.Unlock()
+		}
+	}()
+	return collector
+}
+
+func (collector *watchCollector) waitForReads(t *testing.T, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		collector.mutex.Lock()
+		got := len(collector.readIDs)
+		collector.mutex.Unlock()
+		if got >= count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d reads", count)
+}
+
+func (collector *watchCollector) waitForClose(t *testing.T) {
+	t.Helper()
+	closed := make(chan struct{})
+	go func() {
+		collector.done.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for Watch to stop")
+	}
+}
+
+// watchTestRecords returns the header of example.slow5 and a function making
+// records of its read with other read IDs.
+func watchTestRecords(t *testing.T) (string, func(readID string) string) {
+	example, err := os.ReadFile("data/example.slow5")
+	if err != nil {
+		t.Fatalf("Failed to read example file: %s", err)
+	}
+	readStart := strings.Index(string(example), "0026631e")
+	header, readLine := string(example[:readStart]), strings.TrimSuffix(string(example[readStart:]), "\n")
+	return header, func(readID string) string {
+		return strings.Replace(readLine, "0026631e-33a3-49ab-aa22-3ab157d71f8b", readID, 1)
+	}
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	header, record := watchTestRecords(t)
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	collector := collectWatch(Watch(ctx, dir, 2*time.Millisecond))
+
+	// a file with one complete read and one being written.
+	first := filepath.Join(dir, "run_0.slow5")
+	read1 := record("read-1")
+	appendFile(t, first, header+record("read-0")+"\n"+read1[:len(read1)/2])
+	collector.waitForReads(t, 1)
+	time.Sleep(20 * time.Millisecond) // a few polls, to check read-1 is held back
+	collector.mutex.Lock()
+	if len(collector.readIDs) != 1 {
+		t.Errorf("Expected the half written read-1 to be held back, got %v", collector.readIDs)
+	}
+	collector.mutex.Unlock()
+
+	appendFile(t, first, read1[len(read1)/2:]+"\n"+record("read-2")+"\n")
+	collector.waitForReads(t, 3)
+
+	// a second file, repeating read-2 like after a restart, and ending
+	// without a newline.
+	appendFile(t, filepath.Join(dir, "run_1.slow5"), header+record("read-2")+"\n"+record("read-3")+"\n"+record("read-4"))
+	collector.waitForReads(t, 4)
+
+	// files that aren't slow5 are ignored, and the final summary ends the
+	// watch after reading what is left.
+	appendFile(t, filepath.Join(dir, "notes.txt"), "not a slow5 file")
+	appendFile(t, filepath.Join(dir, "final_summary_run.txt"), "")
+	collector.waitForClose(t)
+
+	sort.Strings(collector.readIDs)
+	expected := []string{"read-0", "read-1", "read-2", "read-3", "read-4"}
+	if fmt.Sprint(collector.readIDs) != fmt.Sprint(expected) {
+		t.Errorf("Expected every read exactly once: %v, got %v", expected, collector.readIDs)
+	}
+	if collector.headers != 2 {
+		t.Errorf("Expected 2 headers, got %d", collector.headers)
+	}
+	if len(collector.errors) != 0 {
+		t.Errorf("Expected no errors, got %v", collector.errors)
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	header, record := watchTestRecords(t)
+	dir := t.TempDir()
+	appendFile(t, filepath.Join(dir, "run_0.slow5"), header+record("read-0")+"\n")
+	appendFile(t, filepath.Join(dir, "broken.slow5"), "#slow5_version\t0.2.0\nno tabs\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collector := collectWatch(Watch(ctx, dir, 2*time.Millisecond))
+	collector.waitForReads(t, 1)
+	cancel()
+	collector.waitForClose(t)
+	if len(collector.errors) != 1 {
+		t.Errorf("Expected 1 error for the broken file, got %v", collector.errors)
+	}
+}
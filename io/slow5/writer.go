@@ -0,0 +1,73 @@
+package slow5
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+/******************************************************************************
+
+Record writers begin here
+
+Write takes its reads from a channel, which suits pipelines but not code that
+has one read at a time to write, like a loop over another format or
+bio.WriteAll. RecordWriter wraps Write so reads can be written one call at a
+time. Write needs the headers before any read, so they are given when the
+RecordWriter is made, along with any WriteOptions.
+
+******************************************************************************/
+
+// RecordWriter writes reads to a slow5 file one at a time. It must be closed
+// with Close to finish writing.
+type RecordWriter struct {
+	reads  chan Read
+	done   chan struct{}
+	mutex  sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewRecordWriter returns a RecordWriter writing headers and then every read
+// given to WriteRecord to output, using Write with options.
+func NewRecordWriter(headers []Header, output io.Writer, options ...WriteOption) *RecordWriter {
+	writer := &RecordWriter{reads: make(chan Read), done: make(chan struct{})}
+	go func() {
+		err := Write(headers, writer.reads, output, options...)
+		writer.mutex.Lock()
+		writer.err = err
+		writer.mutex.Unlock()
+		for range writer.reads {
+			// keep reading after a failed write so WriteRecord doesn't block.
+		}
+		close(writer.done)
+	}()
+	return writer
+}
+
+// WriteRecord writes read. It returns the error Write stopped with, if it
+// has, and an error if the writer is closed.
+func (writer *RecordWriter) WriteRecord(read Read) error {
+	if writer.closed {
+		return errors.New("slow5 record writer is closed")
+	}
+	writer.mutex.Lock()
+	err := writer.err
+	writer.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	writer.reads <- read
+	return nil
+}
+
+// Close finishes writing and returns the first error Write had, if any. It
+// doesn't close the output.
+func (writer *RecordWriter) Close() error {
+	if !writer.closed {
+		writer.closed = true
+		close(writer.reads)
+	}
+	<-writer.done
+	return writer.err
+}
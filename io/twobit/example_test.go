@@ -0,0 +1,16 @@
+package twobit_test
+
+import (
+	"fmt"
+
+	"github.com/TimothyStiles/poly/io/twobit"
+)
+
+func ExampleOpen() {
+	reader, _ := twobit.Open("data/example.2bit")
+	defer reader.Close()
+
+	region, _ := reader.Fetch("chrA", 10, 20)
+	fmt.Println(region)
+	// Output: GTNNNNNNac
+}
@@ -0,0 +1,402 @@
+/*
+Package twobit contains a .2bit reader and writer.
+
+.2bit is the binary genome format UCSC uses to distribute reference genomes.
+Bases are packed four to a byte and runs of N and soft masked (lowercase)
+regions are stored as lists of blocks, so a human genome fits in ~800MB
+instead of ~3GB of fasta. Since every base sits at a known offset, any region
+can be read without touching the rest of the file.
+
+This package provides random access to .2bit files through the same Fetch
+interface as fasta.IndexedFasta, and a writer for creating .2bit files from
+fasta sequences.
+
+Format spec: https://genome.ucsc.edu/FAQ/FAQformat.html#format7
+*/
+package twobit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/TimothyStiles/poly/io/fasta"
+)
+
+/******************************************************************************
+Oct 16, 2026
+
+A .2bit file looks like this, with every integer in the byte order given by
+the signature:
+
+	header:
+		signature     uint32 0x1A412743
+		version       uint32 0, or 1 if offsets are 64 bit
+		sequenceCount uint32
+		reserved      uint32
+	index, once per sequence:
+		nameSize      uint8
+		name          [nameSize]byte
+		offset        uint32 (uint64 in version 1)
+	sequence record, once per sequence:
+		dnaSize        uint32
+		nBlockCount    uint32
+		nBlockStarts   [nBlockCount]uint32
+		nBlockSizes    [nBlockCount]uint32
+		maskBlockCount uint32
+		maskBlockStarts [maskBlockCount]uint32
+		maskBlockSizes  [maskBlockCount]uint32
+		reserved        uint32
+		packedDna       [(dnaSize+3)/4]byte
+
+Bases are packed two bits each, first base in the most significant bits, as
+T=0, C=1, A=2, G=3. N's are packed as T's and recovered from the N blocks.
+
+Since the signature is written in the native byte order of whatever machine
+made the file, reading it tells us which byte order the rest of the file uses.
+
+******************************************************************************/
+
+const signature = 0x1A412743
+
+var (
+	errClosed = errors.New("twobit reader is closed")
+	openFn    = os.Open
+)
+
+// block is a run of N's or masked bases.
+type block struct {
+	start, size int
+}
+
+// record is the decoded header of a single sequence.
+type record struct {
+	length     int
+	nBlocks    []block
+	maskBlocks []block
+	dnaOffset  int64 // file offset of the packed bases
+}
+
+// Reader provides random access to the sequences of a .2bit file. It is
+// safe for concurrent use.
+type Reader struct {
+	mu      sync.RWMutex
+	source  io.ReaderAt
+	closer  io.Closer
+	order   binary.ByteOrder
+	records map[string]record
+	names   []string
+}
+
+// Open opens a .2bit file for random access.
+func Open(path string) (*Reader, error) {
+	file, err := openFn(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// NewReader reads the header and index of a .2bit file from source.
+func NewReader(source io.ReaderAt) (*Reader, error) {
+	reader := &Reader{source: source, records: make(map[string]record)}
+
+	header := make([]byte, 16)
+	if _, err := source.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header) == signature:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == signature:
+		reader.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid .2bit signature %#x", header[:4])
+	}
+	version := reader.order.Uint32(header[4:])
+	if version > 1 {
+		return nil, fmt.Errorf("unsupported .2bit version %d", version)
+	}
+	sequenceCount := int(reader.order.Uint32(header[8:]))
+
+	offset := int64(len(header))
+	offsetSize := 4
+	if version == 1 {
+		offsetSize = 8
+	}
+	for i := 0; i < sequenceCount; i++ {
+		nameSize := make([]byte, 1)
+		if _, err := source.ReadAt(nameSize, offset); err != nil {
+			return nil, fmt.Errorf("reading index: %w", err)
+		}
+		entry := make([]byte, int(nameSize[0])+offsetSize)
+		if _, err := source.ReadAt(entry, offset+1); err != nil {
+			return nil, fmt.Errorf("reading index: %w", err)
+		}
+		offset += int64(1 + len(entry))
+
+		name := string(entry[:nameSize[0]])
+		var recordOffset int64
+		if version == 1 {
+			recordOffset = int64(reader.order.Uint64(entry[nameSize[0]:]))
+		} else {
+			recordOffset = int64(reader.order.Uint32(entry[nameSize[0]:]))
+		}
+		record, err := reader.readRecord(recordOffset)
+		if err != nil {
+			return nil, fmt.Errorf("reading sequence %q: %w", name, err)
+		}
+		reader.records[name] = record
+		reader.names = append(reader.names, name)
+	}
+	return reader, nil
+}
+
+// readRecord reads a sequence record header starting at offset.
+func (reader *Reader) readRecord(offset int64) (record, error) {
+	var rec record
+	readUint32 := func() (int, error) {
+		value := make([]byte, 4)
+		if _, err := reader.source.ReadAt(value, offset); err != nil {
+			return 0, err
+		}
+		offset += 4
+		return int(reader.order.Uint32(value)), nil
+	}
+	readBlocks := func() ([]block, error) {
+		count, err := readUint32()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]byte, 8*count)
+		if _, err := reader.source.ReadAt(values, offset); err != nil {
+			return nil, err
+		}
+		offset += int64(len(values))
+		blocks := make([]block, count)
+		for i := range blocks {
+			blocks[i].start = int(reader.order.Uint32(values[4*i:]))
+			blocks[i].size = int(reader.order.Uint32(values[4*(count+i):]))
+		}
+		return blocks, nil
+	}
+
+	var err error
+	if rec.length, err = readUint32(); err != nil {
+		return rec, err
+	}
+	if rec.nBlocks, err = readBlocks(); err != nil {
+		return rec, err
+	}
+	if rec.maskBlocks, err = readBlocks(); err != nil {
+		return rec, err
+	}
+	rec.dnaOffset = offset + 4 // skip reserved
+	return rec, nil
+}
+
+// Names returns the names of the sequences in file order.
+func (reader *Reader) Names() []string {
+	return reader.names
+}
+
+// Length returns the number of bases in the named sequence.
+func (reader *Reader) Length(name string) (int, error) {
+	rec, ok := reader.records[name]
+	if !ok {
+		return 0, fmt.Errorf("sequence %q not in file", name)
+	}
+	return rec.length, nil
+}
+
+// Fetch returns the bases of the named sequence from start (inclusive) to
+// end (exclusive), counting from 0. Masked regions are returned lowercase and
+// N blocks as N.
+func (reader *Reader) Fetch(name string, start, end int) (string, error) {
+	rec, ok := reader.records[name]
+	if !ok {
+		return "", fmt.Errorf("sequence %q not in file", name)
+	}
+	if start < 0 || end > rec.length || start > end {
+		return "", fmt.Errorf("range [%d, %d) out of bounds for %q of length %d", start, end, name, rec.length)
+	}
+	if start == end {
+		return "", nil
+	}
+
+	reader.mu.RLock()
+	defer reader.mu.RUnlock()
+	if reader.source == nil {
+		return "", errClosed
+	}
+
+	packed := make([]byte, (end-1)/4-start/4+1)
+	if _, err := reader.source.ReadAt(packed, rec.dnaOffset+int64(start/4)); err != nil {
+		return "", err
+	}
+	sequence := make([]byte, end-start)
+	for i := range sequence {
+		position := start + i
+		shift := 6 - 2*(position%4)
+		sequence[i] = "TCAG"[packed[position/4-start/4]>>shift&3]
+	}
+
+	for _, nBlock := range rec.nBlocks {
+		for position := maxInt(nBlock.start, start); position < minInt(nBlock.start+nBlock.size, end); position++ {
+			sequence[position-start] = 'N'
+		}
+	}
+	for _, maskBlock := range rec.maskBlocks {
+		for position := maxInt(maskBlock.start, start); position < minInt(maskBlock.start+maskBlock.size, end); position++ {
+			sequence[position-start] += 'a' - 'A'
+		}
+	}
+	return string(sequence), nil
+}
+
+// Close closes the underlying file if the Reader was created with Open.
+// Fetches after Close return an error.
+func (reader *Reader) Close() error {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	reader.source = nil
+	if reader.closer == nil {
+		return nil
+	}
+	err := reader.closer.Close()
+	reader.closer = nil
+	return err
+}
+
+// Build converts fasta sequences into a little endian .2bit file. Sequences
+// are named by the first word of their fasta name. Lowercase bases are
+// stored as masked, and any base other than A, C, G or T is stored as an N.
+func Build(fastas []fasta.Fasta) ([]byte, error) {
+	var index, records bytes.Buffer
+	order := binary.LittleEndian
+	writeUint32 := func(buffer *bytes.Buffer, value int) {
+		_ = binary.Write(buffer, order, uint32(value))
+	}
+
+	indexSize := 16
+	for _, record := range fastas {
+		indexSize += 1 + len(nameOf(record)) + 4
+	}
+
+	for _, record := range fastas {
+		name := nameOf(record)
+		if len(name) == 0 || len(name) > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid sequence name %q", name)
+		}
+		offset := indexSize + records.Len()
+		if offset+len(record.Sequence) > math.MaxUint32 {
+			return nil, errors.New("file too large for a version 0 .2bit file")
+		}
+		index.WriteByte(byte(len(name)))
+		index.WriteString(name)
+		writeUint32(&index, offset)
+
+		sequence := record.Sequence
+		nBlocks := findBlocks(sequence, func(base byte) bool {
+			return strings.IndexByte("ACGTacgt", base) == -1
+		})
+		maskBlocks := findBlocks(sequence, func(base byte) bool {
+			return base >= 'a' && base <= 'z'
+		})
+
+		writeUint32(&records, len(sequence))
+		for _, blocks := range [][]block{nBlocks, maskBlocks} {
+			writeUint32(&records, len(blocks))
+			for _, b := range blocks {
+				writeUint32(&records, b.start)
+			}
+			for _, b := range blocks {
+				writeUint32(&records, b.size)
+			}
+		}
+		writeUint32(&records, 0) // reserved
+
+		packed := make([]byte, (len(sequence)+3)/4)
+		for i := 0; i < len(sequence); i++ {
+			var bits byte
+			switch sequence[i] {
+			case 'C', 'c':
+				bits = 1
+			case 'A', 'a':
+				bits = 2
+			case 'G', 'g':
+				bits = 3
+			}
+			packed[i/4] |= bits << (6 - 2*(i%4))
+		}
+		records.Write(packed)
+	}
+
+	var output bytes.Buffer
+	for _, value := range []int{signature, 0, len(fastas), 0} {
+		writeUint32(&output, value)
+	}
+	output.Write(index.Bytes())
+	output.Write(records.Bytes())
+	return output.Bytes(), nil
+}
+
+// Write writes fasta sequences to a .2bit file. See Build.
+func Write(fastas []fasta.Fasta, path string) error {
+	twoBitBytes, err := Build(fastas)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, twoBitBytes, 0644)
+}
+
+// nameOf returns the first word of a fasta name.
+func nameOf(record fasta.Fasta) string {
+	fields := strings.Fields(record.Name)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// findBlocks returns the runs of bases in sequence matching inBlock.
+func findBlocks(sequence string, inBlock func(byte) bool) []block {
+	var blocks []block
+	for i := 0; i < len(sequence); i++ {
+		if !inBlock(sequence[i]) {
+			continue
+		}
+		if len(blocks) > 0 && blocks[len(blocks)-1].start+blocks[len(blocks)-1].size == i {
+			blocks[len(blocks)-1].size++
+		} else {
+			blocks = append(blocks, block{start: i, size: 1})
+		}
+	}
+	return blocks
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
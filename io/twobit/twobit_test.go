@@ -0,0 +1,106 @@
+package twobit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/io/fasta"
+)
+
+// data/example.2bit and data/example_big_endian.2bit were packed from
+// data/example.fasta independently of this package.
+func TestFetchMatchesFasta(t *testing.T) {
+	fastas, err := fasta.Read("data/example.fasta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"data/example.2bit", "data/example_big_endian.2bit"} {
+		reader, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if got := strings.Join(reader.Names(), ","); got != "chrA,chrB,chrC" {
+			t.Errorf("%s: got names %q", path, got)
+		}
+		for _, record := range fastas {
+			name := strings.Fields(record.Name)[0]
+			length, _ := reader.Length(name)
+			if length != len(record.Sequence) {
+				t.Errorf("%s: %s has length %d, want %d", path, name, length, len(record.Sequence))
+			}
+			// every subsequence, to cover all packing offsets and block boundaries.
+			for start := 0; start < len(record.Sequence); start++ {
+				for end := start; end <= len(record.Sequence); end++ {
+					got, err := reader.Fetch(name, start, end)
+					if err != nil {
+						t.Fatalf("%s: %s:%d-%d: %s", path, name, start, end, err)
+					}
+					if want := record.Sequence[start:end]; got != want {
+						t.Fatalf("%s: %s:%d-%d got %q, want %q", path, name, start, end, got, want)
+					}
+				}
+			}
+		}
+
+		for _, bad := range []struct {
+			name       string
+			start, end int
+		}{{"chrA", -1, 3}, {"chrA", 0, 1000}, {"chrB", 4, 2}, {"chrZ", 0, 1}} {
+			if _, err := reader.Fetch(bad.name, bad.start, bad.end); err == nil {
+				t.Errorf("%s: expected error fetching %s:%d-%d", path, bad.name, bad.start, bad.end)
+			}
+		}
+
+		if err := reader.Close(); err != nil {
+			t.Error(err)
+		}
+		if _, err := reader.Fetch("chrA", 0, 1); err != errClosed {
+			t.Errorf("expected closed error, got %v", err)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	fastas, _ := fasta.Read("data/example.fasta")
+	got, err := Build(fastas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile("data/example.2bit")
+	if !bytes.Equal(got, want) {
+		t.Errorf("Build output differs from data/example.2bit")
+	}
+
+	path := filepath.Join(t.TempDir(), "written.2bit")
+	if err := Write(fastas, path); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if got, _ := reader.Fetch("chrB", 0, 8); got != "ttttGGGG" {
+		t.Errorf("got %q from written file", got)
+	}
+
+	if _, err := Build([]fasta.Fasta{{Name: "", Sequence: "ACGT"}}); err == nil {
+		t.Errorf("expected error for empty name")
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("not a twobit file"))); err == nil {
+		t.Errorf("expected error for bad signature")
+	}
+	if _, err := NewReader(bytes.NewReader(nil)); err == nil {
+		t.Errorf("expected error for empty file")
+	}
+	if _, err := Open("data/missing.2bit"); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
@@ -0,0 +1,58 @@
+package primers
+
+import (
+	"strings"
+
+	"github.com/TimothyStiles/poly/fold"
+)
+
+/******************************************************************************
+Binding site accessibility begins here
+
+A primer with a perfect melting temperature still fails if the template
+folds over its binding site: the primer has to melt the template's own
+structure before it can anneal, and a stable hairpin wins that race.
+
+The proper measure of this is the probability that the site is unpaired,
+summed over every structure the template can fold into. BindingSiteAccessibility
+uses a cheaper proxy instead: it folds the site with bindingSiteMargin bases
+of flanking template on either side, which is enough to catch the local
+hairpins that matter, and returns the fraction of the site left unpaired by
+the minimum free energy structure.
+
+******************************************************************************/
+
+// bindingSiteMargin is how many bases of template on either side of a
+// binding site are folded with it.
+const bindingSiteMargin = 30
+
+// BindingSiteAccessibility returns the fraction of the bases of site, given
+// as 0 indexed [start, end) on template, that are unpaired when the site and
+// its flanking template fold at temp Celsius. 1 means the site is fully
+// accessible, and 0 means it is completely buried in template structure.
+// Templates that can't be folded, like ones with ambiguous bases, are taken
+// to be accessible.
+func BindingSiteAccessibility(template string, site [2]int, temp float64) float64 {
+	if site[0] < 0 || site[1] > len(template) || site[0] >= site[1] {
+		return 1
+	}
+	start, end := site[0]-bindingSiteMargin, site[1]+bindingSiteMargin
+	if start < 0 {
+		start = 0
+	}
+	if end > len(template) {
+		end = len(template)
+	}
+	result, err := fold.Zuker(strings.ToUpper(template[start:end]), temp)
+	if err != nil {
+		return 1
+	}
+	structure := result.DotBracket()
+	unpaired := 0
+	for index := site[0] - start; index < site[1]-start; index++ {
+		if structure[index] == '.' {
+			unpaired++
+		}
+	}
+	return float64(unpaired) / float64(site[1]-site[0])
+}
@@ -0,0 +1,162 @@
+package primers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/******************************************************************************
+Oligo synthesis constraints begin here
+
+A primer that anneals perfectly is no use if the vendor won't make it.
+Standard synthesis tops out around 60 bases before yield and purity fall
+off a cliff, and modifications come with their own rules: some 3'
+modifications can only be put on certain bases, and a phosphorothioate
+bond or 5' phosphate is one more thing to check the sequence against.
+
+OligoConstraints describes those rules, CheckOligo lists every rule an oligo
+breaks, and design functions take OligoConstraints to either design around
+them (by growing a primer until its 3' base is allowed, or by making oligos
+shorter) or fail with the rule they couldn't meet.
+
+Modifications are placeholders: poly doesn't model what they do to melting
+temperature or structure, it just keeps track of where they are assumed to
+be so the bases there can be checked.
+
+******************************************************************************/
+
+// Modification is a chemical modification assumed to be at one base of an
+// oligo.
+type Modification struct {
+	// Name is what the modification is, like "5' phosphate".
+	Name string
+	// Position is the 0 indexed base the modification is on. Negative
+	// positions count from the 3' end, so -1 is the 3' base.
+	Position int
+	// Bases are the bases the modified base may be, or "" for any base.
+	Bases string
+}
+
+// FivePrimePhosphate is a phosphate on the 5' base, needed to ligate an oligo.
+var FivePrimePhosphate = Modification{Name: "5' phosphate", Position: 0}
+
+// Phosphorothioate is a phosphorothioate bond between the base at position
+// and the base 3' of it, protecting the oligo from exonucleases. Negative
+// positions count from the 3' end, so -2 is the bond before the 3' base.
+func Phosphorothioate(position int) Modification {
+	return Modification{Name: "phosphorothioate", Position: position}
+}
+
+// OligoConstraints are the rules an oligo must meet to be synthesized.
+type OligoConstraints struct {
+	// MaxLength is the longest oligo that can be synthesized, or 0 for no
+	// limit.
+	MaxLength int
+	// FivePrimeBases and ThreePrimeBases are the bases allowed at each end
+	// of the oligo, or "" for any base.
+	FivePrimeBases, ThreePrimeBases string
+	// Modifications are the modifications assumed to be on the oligo.
+	Modifications []Modification
+}
+
+// StandardSynthesis are the constraints of standard, unmodified oligo
+// synthesis.
+var StandardSynthesis = OligoConstraints{MaxLength: 60}
+
+// Violation is a constraint an oligo doesn't meet.
+type Violation struct {
+	// Constraint is the OligoConstraints field that isn't met, like
+	// "MaxLength" or "Modifications".
+	Constraint string
+	// Position is the 0 indexed base that breaks the constraint, or -1 if
+	// it is the whole oligo.
+	Position int
+	// Message describes the violation.
+	Message string
+}
+
+// Error returns the message of violation, so it can be returned as an error.
+func (violation Violation) Error() string {
+	return violation.Message
+}
+
+// CheckOligo returns every constraint seq doesn't meet, or nil if it meets
+// them all.
+func CheckOligo(seq string, constraints OligoConstraints) []Violation {
+	seq = strings.ToUpper(seq)
+	var violations []Violation
+	if constraints.MaxLength > 0 && len(seq) > constraints.MaxLength {
+		violations = append(violations, Violation{
+			Constraint: "MaxLength",
+			Position:   -1,
+			Message:    fmt.Sprintf("oligo is %d bases long, longer than the maximum of %d", len(seq), constraints.MaxLength),
+		})
+	}
+	if len(seq) == 0 {
+		return violations
+	}
+	if !baseAllowed(seq[0], constraints.FivePrimeBases) {
+		violations = append(violations, Violation{
+			Constraint: "FivePrimeBases",
+			Position:   0,
+			Message:    fmt.Sprintf("5' base %c is not one of %s", seq[0], strings.ToUpper(constraints.FivePrimeBases)),
+		})
+	}
+	if last := len(seq) - 1; !baseAllowed(seq[last], constraints.ThreePrimeBases) {
+		violations = append(violations, Violation{
+			Constraint: "ThreePrimeBases",
+			Position:   last,
+			Message:    fmt.Sprintf("3' base %c is not one of %s", seq[last], strings.ToUpper(constraints.ThreePrimeBases)),
+		})
+	}
+	for _, modification := range constraints.Modifications {
+		position := modification.index(len(seq))
+		switch {
+		case position < 0 || position >= len(seq):
+			violations = append(violations, Violation{
+				Constraint: "Modifications",
+				Position:   -1,
+				Message:    fmt.Sprintf("%s at position %d is outside of an oligo of %d bases", modification.Name, modification.Position, len(seq)),
+			})
+		case !baseAllowed(seq[position], modification.Bases):
+			violations = append(violations, Violation{
+				Constraint: "Modifications",
+				Position:   position,
+				Message:    fmt.Sprintf("%s at position %d is on %c, which is not one of %s", modification.Name, position, seq[position], strings.ToUpper(modification.Bases)),
+			})
+		}
+	}
+	return violations
+}
+
+// ModifiedPositions returns the sorted, 0 indexed positions of an oligo of
+// length bases that constraints assume are modified.
+func (constraints OligoConstraints) ModifiedPositions(length int) []int {
+	seen := make(map[int]bool)
+	var positions []int
+	for _, modification := range constraints.Modifications {
+		position := modification.index(length)
+		if position < 0 || position >= length || seen[position] {
+			continue
+		}
+		seen[position] = true
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// index returns the 0 indexed position of modification on an oligo of
+// length bases.
+func (modification Modification) index(length int) int {
+	if modification.Position < 0 {
+		return length + modification.Position
+	}
+	return modification.Position
+}
+
+// baseAllowed returns true if base is one of allowed, or allowed is empty.
+func baseAllowed(base byte, allowed string) bool {
+	return allowed == "" || strings.IndexByte(strings.ToUpper(allowed), base) != -1
+}
@@ -0,0 +1,91 @@
+package primers_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/primers"
+	"github.com/TimothyStiles/poly/random"
+)
+
+func TestCheckOligo(t *testing.T) {
+	tests := []struct {
+		name        string
+		seq         string
+		constraints primers.OligoConstraints
+		violated    []string
+		positions   []int
+	}{
+		{"no constraints", "ACGTACGT", primers.OligoConstraints{}, nil, nil},
+		{"within max length", strings.Repeat("A", 60), primers.StandardSynthesis, nil, nil},
+		{"max length", strings.Repeat("A", 61), primers.StandardSynthesis, []string{"MaxLength"}, []int{-1}},
+		{"five prime base", "ACGTACGT", primers.OligoConstraints{FivePrimeBases: "gc"}, []string{"FivePrimeBases"}, []int{0}},
+		{"three prime base", "ACGTACGT", primers.OligoConstraints{ThreePrimeBases: "GC"}, []string{"ThreePrimeBases"}, []int{7}},
+		{"allowed ends", "acgtacgc", primers.OligoConstraints{FivePrimeBases: "A", ThreePrimeBases: "GC"}, nil, nil},
+		{"modified base", "ACGTACGT", primers.OligoConstraints{Modifications: []primers.Modification{{Name: "3' amine", Position: -1, Bases: "AC"}}}, []string{"Modifications"}, []int{7}},
+		{"modification outside", "ACGT", primers.OligoConstraints{Modifications: []primers.Modification{primers.Phosphorothioate(-5)}}, []string{"Modifications"}, []int{-1}},
+		{"several", strings.Repeat("T", 70), primers.OligoConstraints{MaxLength: 60, ThreePrimeBases: "GC"}, []string{"MaxLength", "ThreePrimeBases"}, []int{-1, 69}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var violated []string
+			var positions []int
+			for _, violation := range primers.CheckOligo(test.seq, test.constraints) {
+				violated = append(violated, violation.Constraint)
+				positions = append(positions, violation.Position)
+				if violation.Error() == "" {
+					t.Errorf("violation of %s has no message", violation.Constraint)
+				}
+			}
+			if !reflect.DeepEqual(violated, test.violated) || !reflect.DeepEqual(positions, test.positions) {
+				t.Errorf("expected violations %v at %v, got %v at %v", test.violated, test.positions, violated, positions)
+			}
+		})
+	}
+}
+
+func TestModifiedPositions(t *testing.T) {
+	constraints := primers.OligoConstraints{Modifications: []primers.Modification{
+		primers.Phosphorothioate(-2),
+		primers.FivePrimePhosphate,
+		primers.Phosphorothioate(-3),
+		primers.Phosphorothioate(-2),
+		primers.Phosphorothioate(30),
+	}}
+	if got, expected := constraints.ModifiedPositions(20), []int{0, 17, 18}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected modified positions %v, got %v", expected, got)
+	}
+}
+
+func TestMatchInventoryConstraints(t *testing.T) {
+	template, _ := random.DNASequence(600, 42)
+	target := [2]int{150, 450}
+	forward := primers.Oligo{Name: "oKA001", Sequence: template[130:152]}
+	opts := primers.DefaultInventoryOptions
+	opts.MinBindingSiteAccessibility = 0
+	opts.Constraints = primers.OligoConstraints{ThreePrimeBases: "G"}
+
+	matches, err := primers.MatchInventory(template, target, []primers.Oligo{forward}, opts)
+	if err != nil {
+		t.Fatalf("MatchInventory returned an unexpected error: %s", err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("MatchInventory found no matches")
+	}
+	for _, match := range matches {
+		if violations := primers.CheckOligo(match.Reverse.Sequence, opts.Constraints); len(violations) > 0 {
+			t.Errorf("designed reverse primer %q breaks constraints: %v", match.Reverse.Sequence, violations)
+		}
+	}
+
+	// no reverse primer fits in 16 bases.
+	opts.Constraints.MaxLength = 16
+	matches, err = primers.MatchInventory(template, target, []primers.Oligo{forward}, opts)
+	if err != nil {
+		t.Fatalf("MatchInventory returned an unexpected error: %s", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches with primers of at most 16 bases, got %+v", matches)
+	}
+}
@@ -0,0 +1,277 @@
+package primers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/TimothyStiles/poly/checks"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+/******************************************************************************
+Primer inventory matching begins here
+
+Every lab has a freezer box (or ten) full of oligos from past projects, and
+ordering new primers when a perfectly good one is already sitting at -20C
+wastes money and, worse, days. MatchInventory looks through an inventory of
+existing oligos for ones that bind next to a target region and pairs them up,
+either with each other or with a freshly designed partner.
+
+Binding is 3' anchored: polymerases only care that the 3' end of a primer is
+annealed, so an oligo with a 5' overhang (restriction site, Gibson homology,
+whatever) is still a fine primer as long as its 3' end matches the template.
+Binding sites buried in template structure are skipped, since the template
+folding over a site beats the primer to it (see BindingSiteAccessibility).
+
+******************************************************************************/
+
+// Oligo is a single stranded piece of DNA, like a primer sitting in a freezer.
+type Oligo struct {
+	Name     string
+	Sequence string
+}
+
+// InventoryOptions configures MatchInventory.
+type InventoryOptions struct {
+	// TargetTm is the desired melting temperature of the bound part of each primer.
+	TargetTm float64
+	// MaxTmDifference is how far the bound part of a primer may be from TargetTm.
+	MaxTmDifference float64
+	// MinBindingLength is the minimum number of 3' bases that must match the template.
+	MinBindingLength int
+	// Window is how many bases outside of the target a primer may bind.
+	Window int
+	// ReuseBonus is added to the score of a pair for every inventory oligo it uses.
+	ReuseBonus float64
+	// MinBindingSiteAccessibility is the smallest BindingSiteAccessibility,
+	// at TargetTm, a primer's binding site may have. 0 turns the check off.
+	MinBindingSiteAccessibility float64
+	// Constraints are the synthesis rules newly designed primers must meet.
+	// Primers are grown past TargetTm to meet them if they can.
+	Constraints OligoConstraints
+}
+
+// DefaultInventoryOptions are sensible options for Taq polymerase PCRs.
+var DefaultInventoryOptions = InventoryOptions{
+	TargetTm:         60,
+	MaxTmDifference:  5,
+	MinBindingLength: 15,
+	Window:           50,
+	ReuseBonus:       5,
+
+	MinBindingSiteAccessibility: 0.5,
+}
+
+// InventoryMatch is a primer pair that amplifies a target, using at least one
+// oligo from an inventory.
+type InventoryMatch struct {
+	Forward              Oligo
+	Reverse              Oligo
+	ForwardFromInventory bool
+	ReverseFromInventory bool
+	// Start and End are the boundaries of the amplified template, 0 indexed
+	// and end exclusive. Overhangs are not included.
+	Start, End int
+	// Score ranks pairs. Higher is better.
+	Score float64
+	// ForwardAccessibility and ReverseAccessibility are the
+	// BindingSiteAccessibility of each primer's binding site.
+	ForwardAccessibility, ReverseAccessibility float64
+}
+
+// primerSite is a 3' anchored binding site of an oligo on a template.
+type primerSite struct {
+	oligo         Oligo
+	fromInventory bool
+	start, end    int // bound region on the top strand
+	tm            float64
+	accessibility float64
+}
+
+// MatchInventory finds primer pairs amplifying the target region of template,
+// given as 0 indexed [start, end), that reuse oligos from inventory. Returned
+// pairs are either two inventory oligos or an inventory oligo with a newly
+// designed partner, sorted from best to worst score.
+//
+// Pairs are scored by how close both primers are to the target melting
+// temperature and to each other, plus opts.ReuseBonus for every inventory
+// oligo used. Primers whose binding sites are less accessible than
+// opts.MinBindingSiteAccessibility aren't used.
+func MatchInventory(template string, target [2]int, inventory []Oligo, opts InventoryOptions) ([]InventoryMatch, error) {
+	template = strings.ToUpper(template)
+	if err := checks.RequireIUPACAlphabet(template, checks.DNA); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	if target[0] < 0 || target[1] > len(template) || target[0] >= target[1] {
+		return nil, fmt.Errorf("target %v out of bounds for template of length %d", target, len(template))
+	}
+	if opts.MinBindingLength <= 0 {
+		return nil, errors.New("MinBindingLength must be greater than zero")
+	}
+
+	var forwardSites, reverseSites []primerSite
+	for _, oligo := range inventory {
+		forwardSites = append(forwardSites, forwardBindingSites(template, target, oligo, opts)...)
+		reverseSites = append(reverseSites, reverseBindingSites(template, target, oligo, opts)...)
+	}
+
+	var designedForward, designedReverse []primerSite
+	if len(reverseSites) > 0 {
+		if site, ok := designForward(template, target, opts); ok {
+			designedForward = append(designedForward, site)
+		}
+	}
+	if len(forwardSites) > 0 {
+		if site, ok := designReverse(template, target, opts); ok {
+			designedReverse = append(designedReverse, site)
+		}
+	}
+
+	var matches []InventoryMatch
+	pairUp := func(forwards, reverses []primerSite) {
+		for _, forward := range forwards {
+			for _, reverse := range reverses {
+				if forward.start >= reverse.end {
+					continue
+				}
+				matches = append(matches, scorePair(forward, reverse, opts))
+			}
+		}
+	}
+	pairUp(forwardSites, reverseSites)
+	pairUp(forwardSites, designedReverse)
+	pairUp(designedForward, reverseSites)
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches, nil
+}
+
+// scorePair scores a forward and reverse primer as a pair.
+func scorePair(forward, reverse primerSite, opts InventoryOptions) InventoryMatch {
+	penalty := math.Abs(forward.tm-opts.TargetTm) + math.Abs(reverse.tm-opts.TargetTm) + math.Abs(forward.tm-reverse.tm)
+	score := -penalty
+	if forward.fromInventory {
+		score += opts.ReuseBonus
+	}
+	if reverse.fromInventory {
+		score += opts.ReuseBonus
+	}
+	return InventoryMatch{
+		Forward:              forward.oligo,
+		Reverse:              reverse.oligo,
+		ForwardFromInventory: forward.fromInventory,
+		ReverseFromInventory: reverse.fromInventory,
+		Start:                forward.start,
+		End:                  reverse.end,
+		Score:                score,
+		ForwardAccessibility: forward.accessibility,
+		ReverseAccessibility: reverse.accessibility,
+	}
+}
+
+// forwardBindingSites finds where the 3' end of oligo anneals to the bottom
+// strand of template just upstream of target.
+func forwardBindingSites(template string, target [2]int, oligo Oligo, opts InventoryOptions) []primerSite {
+	var sites []primerSite
+	for _, site := range anchoredSites(template, strings.ToUpper(oligo.Sequence), opts) {
+		if site.start > target[0] || site.start < target[0]-opts.Window || !accessible(template, &site, opts) {
+			continue
+		}
+		site.oligo = oligo
+		site.fromInventory = true
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+// reverseBindingSites finds where the 3' end of oligo anneals to the top
+// strand of template just downstream of target.
+func reverseBindingSites(template string, target [2]int, oligo Oligo, opts InventoryOptions) []primerSite {
+	var sites []primerSite
+	reverseTemplate := transform.ReverseComplement(template)
+	for _, site := range anchoredSites(reverseTemplate, strings.ToUpper(oligo.Sequence), opts) {
+		// convert to top strand coordinates
+		site.start, site.end = len(template)-site.end, len(template)-site.start
+		if site.end < target[1] || site.end > target[1]+opts.Window || !accessible(template, &site, opts) {
+			continue
+		}
+		site.oligo = oligo
+		site.fromInventory = true
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+// anchoredSites finds every position where at least opts.MinBindingLength of
+// the 3' end of primer matches template, extending each match towards the
+// 5' end as far as it goes. Sites with a melting temperature too far from
+// opts.TargetTm are dropped.
+func anchoredSites(template, primer string, opts InventoryOptions) []primerSite {
+	if len(primer) < opts.MinBindingLength {
+		return nil
+	}
+	seed := primer[len(primer)-opts.MinBindingLength:]
+	var sites []primerSite
+	for offset := 0; ; {
+		index := strings.Index(template[offset:], seed)
+		if index == -1 {
+			break
+		}
+		end := offset + index + len(seed)
+		bound := len(seed)
+		for bound < len(primer) && end-bound-1 >= 0 && template[end-bound-1] == primer[len(primer)-bound-1] {
+			bound++
+		}
+		tm := MeltingTemp(template[end-bound : end])
+		if math.Abs(tm-opts.TargetTm) <= opts.MaxTmDifference {
+			sites = append(sites, primerSite{start: end - bound, end: end, tm: tm})
+		}
+		offset += index + 1
+	}
+	return sites
+}
+
+// designForward designs a new forward primer starting at the beginning of
+// target, growing it until it reaches opts.TargetTm and meets
+// opts.Constraints.
+func designForward(template string, target [2]int, opts InventoryOptions) (primerSite, bool) {
+	for end := target[0] + opts.MinBindingLength; end <= target[1]; end++ {
+		sequence := template[target[0]:end]
+		if opts.Constraints.MaxLength > 0 && len(sequence) > opts.Constraints.MaxLength {
+			break
+		}
+		if tm := MeltingTemp(sequence); tm >= opts.TargetTm && len(CheckOligo(sequence, opts.Constraints)) == 0 {
+			site := primerSite{oligo: Oligo{Sequence: sequence}, start: target[0], end: end, tm: tm}
+			return site, accessible(template, &site, opts)
+		}
+	}
+	return primerSite{}, false
+}
+
+// designReverse designs a new reverse primer ending at the end of target,
+// growing it until it reaches opts.TargetTm and meets opts.Constraints.
+func designReverse(template string, target [2]int, opts InventoryOptions) (primerSite, bool) {
+	for start := target[1] - opts.MinBindingLength; start >= target[0]; start-- {
+		sequence := transform.ReverseComplement(template[start:target[1]])
+		if opts.Constraints.MaxLength > 0 && len(sequence) > opts.Constraints.MaxLength {
+			break
+		}
+		if tm := MeltingTemp(sequence); tm >= opts.TargetTm && len(CheckOligo(sequence, opts.Constraints)) == 0 {
+			site := primerSite{oligo: Oligo{Sequence: sequence}, start: start, end: target[1], tm: tm}
+			return site, accessible(template, &site, opts)
+		}
+	}
+	return primerSite{}, false
+}
+
+// accessible sets the accessibility of site on the top strand of template,
+// and returns false if it is below opts.MinBindingSiteAccessibility.
+func accessible(template string, site *primerSite, opts InventoryOptions) bool {
+	site.accessibility = BindingSiteAccessibility(template, [2]int{site.start, site.end}, opts.TargetTm)
+	return site.accessibility >= opts.MinBindingSiteAccessibility
+}
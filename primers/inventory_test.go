@@ -0,0 +1,101 @@
+package primers_test
+
+import (
+	"testing"
+
+	"github.com/TimothyStiles/poly/primers"
+	"github.com/TimothyStiles/poly/random"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+func TestMatchInventory(t *testing.T) {
+	template, _ := random.DNASequence(600, 42)
+	target := [2]int{150, 450}
+
+	// a forward primer with a 5' overhang binding a little upstream of the target.
+	forwardBinding := template[130:145]
+	for end := 146; primers.MeltingTemp(forwardBinding) < 60; end++ {
+		forwardBinding = template[130:end]
+	}
+	forward := primers.Oligo{Name: "oKA001", Sequence: "GGTCTCA" + forwardBinding}
+	inventory := []primers.Oligo{
+		{Name: "oKA002", Sequence: "TTTTTTTTTTTTTTTTTTTT"},
+		forward,
+		{Name: "oKA003", Sequence: transform.ReverseComplement(template[10:35])}, // binds upstream, wrong orientation
+	}
+
+	matches, err := primers.MatchInventory(template, target, inventory, primers.DefaultInventoryOptions)
+	if err != nil {
+		t.Fatalf("MatchInventory returned an unexpected error: %s", err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("MatchInventory found no matches")
+	}
+	best := matches[0]
+	if best.Forward != forward || !best.ForwardFromInventory {
+		t.Errorf("expected best forward primer to be %+v from the inventory, got %+v", forward, best.Forward)
+	}
+	if best.ReverseFromInventory {
+		t.Errorf("expected best reverse primer to be newly designed, got %+v", best.Reverse)
+	}
+	if best.Start != 130 || best.End != target[1] {
+		t.Errorf("expected amplicon [130, %d), got [%d, %d)", target[1], best.Start, best.End)
+	}
+	if got := transform.ReverseComplement(best.Reverse.Sequence); got != template[best.End-len(got):best.End] {
+		t.Errorf("designed reverse primer %q does not bind the template", best.Reverse.Sequence)
+	}
+}
+
+func TestMatchInventoryErrors(t *testing.T) {
+	if _, err := primers.MatchInventory("ACGT", [2]int{2, 10}, nil, primers.DefaultInventoryOptions); err == nil {
+		t.Errorf("expected error for out of bounds target")
+	}
+	if _, err := primers.MatchInventory("ACGTACGT", [2]int{2, 4}, nil, primers.InventoryOptions{}); err == nil {
+		t.Errorf("expected error for invalid options")
+	}
+}
+
+func TestBindingSiteAccessibility(t *testing.T) {
+	// a GC rich hairpin between two random flanks.
+	left, _ := random.DNASequence(240, 1)
+	right, _ := random.DNASequence(400, 2)
+	stem := "GCGGCCGCGGCGCCGC"
+	template := left + stem + "GAAA" + transform.ReverseComplement(stem) + right
+
+	if accessibility := primers.BindingSiteAccessibility(template, [2]int{250, 270}, 60); accessibility > 0.5 {
+		t.Errorf("expected a site over the hairpin to be mostly paired, got accessibility %f", accessibility)
+	}
+	if accessibility := primers.BindingSiteAccessibility(template, [2]int{280, 300}, 60); accessibility < 0.9 {
+		t.Errorf("expected a site next to the hairpin to be accessible, got accessibility %f", accessibility)
+	}
+	if accessibility := primers.BindingSiteAccessibility(template, [2]int{300, 280}, 60); accessibility != 1 {
+		t.Errorf("expected an invalid site to be taken as accessible, got %f", accessibility)
+	}
+
+	// only the oligo next to the hairpin is used, whatever its Tm.
+	opts := primers.DefaultInventoryOptions
+	opts.MaxTmDifference = 100
+	inventory := []primers.Oligo{{Name: "overHairpin", Sequence: template[250:270]}, {Name: "nextToHairpin", Sequence: template[280:300]}}
+	matches, err := primers.MatchInventory(template, [2]int{300, 520}, inventory, opts)
+	if err != nil {
+		t.Fatalf("MatchInventory returned an unexpected error: %s", err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("MatchInventory found no matches")
+	}
+	for _, match := range matches {
+		if match.Forward.Name != "nextToHairpin" {
+			t.Errorf("expected only primers next to the hairpin, got %s", match.Forward.Name)
+		}
+		if match.ForwardAccessibility < opts.MinBindingSiteAccessibility || match.ReverseAccessibility < opts.MinBindingSiteAccessibility {
+			t.Errorf("expected accessibilities above %f, got %f and %f", opts.MinBindingSiteAccessibility, match.ForwardAccessibility, match.ReverseAccessibility)
+		}
+	}
+
+	// without the check, the oligo over the hairpin is used too.
+	opts.MinBindingSiteAccessibility = 0
+	matches, _ = primers.MatchInventory(template, [2]int{300, 520}, inventory, opts)
+	if len(matches) != 2 {
+		t.Errorf("expected both oligos to be used without an accessibility check, got %d matches", len(matches))
+	}
+}
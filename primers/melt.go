@@ -0,0 +1,165 @@
+package primers
+
+import (
+	"math"
+	"strings"
+)
+
+/******************************************************************************
+Melt curve simulation begins here
+
+High-resolution melt (HRM) genotyping amplifies a region with a dye that only
+fluoresces when bound to double stranded DNA, then slowly heats the amplicon
+and watches it fall apart. Amplicons differing by a single base melt a little
+differently, so alleles can be told apart by their melt curves without
+sequencing anything.
+
+SimulateMeltCurve predicts those curves with a deliberately coarse model. The
+amplicon is chopped into overlapping windows and each window is treated as an
+independent two state duplex, with its stability from the same SantaLucia
+nearest neighbor values MeltingTemp uses. The helicity of the amplicon at a
+temperature is the average fraction of its windows still paired. Real melting
+is cooperative (see the Poland-Scheraga model) so absolute temperatures will
+be off by a few degrees, but differences between alleles point the right way,
+which is usually what you want to know before ordering primers.
+
+Melt curves are usually read through their negative derivative, -dF/dT,
+which peaks at the melting temperature of each domain. Both are reported.
+
+******************************************************************************/
+
+// MeltOptions configures SimulateMeltCurve.
+type MeltOptions struct {
+	// Window is how many bases are melted together.
+	Window int
+	// SaltConcentration is the molar sodium concentration.
+	SaltConcentration float64
+	// MagnesiumConcentration is the molar magnesium concentration.
+	MagnesiumConcentration float64
+}
+
+// DefaultMeltOptions are typical conditions for an HRM assay.
+var DefaultMeltOptions = MeltOptions{
+	Window:                 20,
+	SaltConcentration:      50e-3,
+	MagnesiumConcentration: 0,
+}
+
+// MeltPoint is a point on a melt curve.
+type MeltPoint struct {
+	Temperature float64 // Temperature in Celsius.
+	Helicity    float64 // Helicity is the fraction of the amplicon that is double stranded, from 0 to 1.
+	Derivative  float64 // Derivative is -dHelicity/dTemperature.
+}
+
+// SimulateMeltCurve predicts the melt curve of a double stranded amplicon
+// from tempRange[0] to tempRange[1] Celsius, every step degrees. It returns
+// nil if the amplicon is shorter than 2 bases or the range is empty.
+func SimulateMeltCurve(amplicon string, tempRange [2]float64, step float64, opts MeltOptions) []MeltPoint {
+	amplicon = strings.ToUpper(amplicon)
+	if len(amplicon) < 2 || step <= 0 || tempRange[1] < tempRange[0] {
+		return nil
+	}
+	window := opts.Window
+	if window < 2 || window > len(amplicon) {
+		window = len(amplicon)
+	}
+
+	// enthalpy (kcal/mol) and entropy (cal/mol-K) of every window.
+	saltEffect := opts.SaltConcentration + opts.MagnesiumConcentration*140
+	windows := make([]thermodynamics, len(amplicon)-window+1)
+	for start := range windows {
+		for i := start; i+1 < start+window; i++ {
+			neighbors := nearestNeighborsThermodynamics[amplicon[i:i+2]]
+			windows[start].H += neighbors.H
+			windows[start].S += neighbors.S
+		}
+		if saltEffect > 0 {
+			windows[start].S += 0.368 * float64(window-1) * math.Log(saltEffect)
+		}
+	}
+
+	const gasConstant = 1.9872 // gas constant (cal / mol - K)
+	count := int(math.Floor((tempRange[1]-tempRange[0])/step+1e-9)) + 1
+	curve := make([]MeltPoint, count)
+	for index := range curve {
+		temperature := tempRange[0] + float64(index)*step
+		kelvin := temperature + 273.15
+		helicity := 0.0
+		for _, stability := range windows {
+			freeEnergy := stability.H*1000 - kelvin*stability.S
+			helicity += 1 / (1 + math.Exp(freeEnergy/(gasConstant*kelvin)))
+		}
+		curve[index] = MeltPoint{Temperature: temperature, Helicity: helicity / float64(len(windows))}
+	}
+
+	for index := range curve {
+		before, after := index-1, index+1
+		if before < 0 {
+			before = index
+		}
+		if after >= len(curve) {
+			after = index
+		}
+		if before == after {
+			continue
+		}
+		curve[index].Derivative = -(curve[after].Helicity - curve[before].Helicity) / (curve[after].Temperature - curve[before].Temperature)
+	}
+	return curve
+}
+
+// MeltPeak returns the temperature where curve melts fastest, the peak of
+// its derivative, interpolated between points. It returns NaN for an empty
+// curve.
+func MeltPeak(curve []MeltPoint) float64 {
+	if len(curve) == 0 {
+		return math.NaN()
+	}
+	peak := 0
+	for index, point := range curve {
+		if point.Derivative > curve[peak].Derivative {
+			peak = index
+		}
+	}
+	if peak == 0 || peak == len(curve)-1 {
+		return curve[peak].Temperature
+	}
+
+	// fit a parabola through the peak and its neighbors.
+	left, middle, right := curve[peak-1].Derivative, curve[peak].Derivative, curve[peak+1].Derivative
+	curvature := left - 2*middle + right
+	if curvature == 0 {
+		return curve[peak].Temperature
+	}
+	step := (curve[peak+1].Temperature - curve[peak-1].Temperature) / 2
+	return curve[peak].Temperature + step*(left-right)/(2*curvature)
+}
+
+// CompareMeltCurves returns the root mean square difference in helicity
+// between two melt curves, so 0 means indistinguishable. Points are paired
+// by temperature and points without a partner in the other curve are
+// ignored, so curves should be simulated over the same temperatures. It
+// returns NaN if no points pair up.
+func CompareMeltCurves(a, b []MeltPoint) float64 {
+	const tolerance = 1e-9
+	sum, pairs := 0.0, 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].Temperature < b[j].Temperature-tolerance:
+			i++
+		case b[j].Temperature < a[i].Temperature-tolerance:
+			j++
+		default:
+			difference := a[i].Helicity - b[j].Helicity
+			sum += difference * difference
+			pairs++
+			i++
+			j++
+		}
+	}
+	if pairs == 0 {
+		return math.NaN()
+	}
+	return math.Sqrt(sum / float64(pairs))
+}
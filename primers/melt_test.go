@@ -0,0 +1,40 @@
+package primers_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/primers"
+)
+
+func TestSimulateMeltCurve(t *testing.T) {
+	amplicon := "GATCCGTAGCTAGGCTTACGATCGGATTCAGCGTACCATGGTACGATCGATTCCGGAGTCTAGCATGCGGTACAGTTCAGATCCGATGGCTAACGTTGCAGATC"
+	index := strings.Index(amplicon, "CCATGG") + 4
+	mutant := amplicon[:index] + "A" + amplicon[index+1:] // G:C to A:T
+
+	temperatures := [2]float64{60, 100}
+	wildTypeCurve := primers.SimulateMeltCurve(amplicon, temperatures, 0.1, primers.DefaultMeltOptions)
+	mutantCurve := primers.SimulateMeltCurve(mutant, temperatures, 0.1, primers.DefaultMeltOptions)
+	if len(wildTypeCurve) != 401 {
+		t.Fatalf("expected 401 points, got %d", len(wildTypeCurve))
+	}
+	if wildTypeCurve[0].Helicity < 0.99 || wildTypeCurve[len(wildTypeCurve)-1].Helicity > 0.01 {
+		t.Errorf("amplicon should melt between 60 and 100C, got %f to %f", wildTypeCurve[0].Helicity, wildTypeCurve[len(wildTypeCurve)-1].Helicity)
+	}
+
+	wildTypeTm, mutantTm := primers.MeltPeak(wildTypeCurve), primers.MeltPeak(mutantCurve)
+	if mutantTm >= wildTypeTm {
+		t.Errorf("G:C to A:T substitution should lower the Tm peak, got %f and %f", wildTypeTm, mutantTm)
+	}
+
+	if distance := primers.CompareMeltCurves(wildTypeCurve, primers.SimulateMeltCurve(amplicon, temperatures, 0.1, primers.DefaultMeltOptions)); distance != 0 {
+		t.Errorf("identical amplicons should have distance 0, got %f", distance)
+	}
+	if distance := primers.CompareMeltCurves(wildTypeCurve, mutantCurve); distance <= 0 {
+		t.Errorf("different amplicons should have a positive distance, got %f", distance)
+	}
+	if distance := primers.CompareMeltCurves(wildTypeCurve, nil); !math.IsNaN(distance) {
+		t.Errorf("comparing to an empty curve should be NaN, got %f", distance)
+	}
+}
@@ -23,6 +23,7 @@ package pcr
 
 import (
 	"errors"
+	"fmt"
 	"index/suffixarray"
 	"sort"
 	"strings"
@@ -56,6 +57,55 @@ func DesignPrimersWithOverhangs(sequence, forwardOverhang, reverseOverhang strin
 	return forwardPrimer, reversePrimer
 }
 
+// DesignPrimersWithConstraints designs two primers like
+// DesignPrimersWithOverhangs that can also be synthesized under constraints.
+// Each primer is grown past targetTm until its 3' base is one of
+// constraints.ThreePrimeBases, and an error naming the violated constraint is
+// returned if a primer can't meet them all.
+func DesignPrimersWithConstraints(sequence, forwardOverhang, reverseOverhang string, targetTm float64, constraints primers.OligoConstraints) (string, string, error) {
+	sequence = strings.ToUpper(sequence)
+	forwardOverhang = strings.ToUpper(forwardOverhang)
+	reverseOverhang = transform.ReverseComplement(strings.ToUpper(reverseOverhang))
+	forwardPrimer, err := constrainedPrimer(sequence, forwardOverhang, targetTm, constraints)
+	if err != nil {
+		return "", "", fmt.Errorf("forward primer: %w", err)
+	}
+	reversePrimer, err := constrainedPrimer(transform.ReverseComplement(sequence), reverseOverhang, targetTm, constraints)
+	if err != nil {
+		return "", "", fmt.Errorf("reverse primer: %w", err)
+	}
+	return forwardPrimer, reversePrimer, nil
+}
+
+// constrainedPrimer returns overhang plus the shortest start of sequence, of
+// at least minimalPrimerLength bases, that melts at targetTm or above and
+// ends in one of constraints.ThreePrimeBases. It returns the first violation
+// of the primer if no length meets every constraint.
+func constrainedPrimer(sequence, overhang string, targetTm float64, constraints primers.OligoConstraints) (string, error) {
+	if len(sequence) < minimalPrimerLength {
+		return "", fmt.Errorf("sequence of %d bases is shorter than the minimal primer length of %d", len(sequence), minimalPrimerLength)
+	}
+	var violations []primers.Violation
+	for length := minimalPrimerLength; length <= len(sequence); length++ {
+		binding := sequence[:length]
+		if primers.MeltingTemp(binding) < targetTm {
+			continue
+		}
+		primer := overhang + binding
+		violations = primers.CheckOligo(primer, constraints)
+		if len(violations) == 0 {
+			return primer, nil
+		}
+		if constraints.MaxLength > 0 && len(primer) >= constraints.MaxLength {
+			break
+		}
+	}
+	if len(violations) == 0 {
+		return "", fmt.Errorf("no primer reaches a melting temperature of %.1f C", targetTm)
+	}
+	return "", violations[0]
+}
+
 // DesignPrimers designs two primers to amplify a target sequence and only that
 // target sequence (no overhangs).
 func DesignPrimers(sequence string, targetTm float64) (string, string) {
@@ -1,8 +1,12 @@
 package pcr
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/TimothyStiles/poly/primers"
+	"github.com/TimothyStiles/poly/transform"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -89,3 +93,47 @@ func TestIssue279PCRBug(t *testing.T) {
 		t.Errorf("incorrect PCR output (-want,+got): %s", diff)
 	}
 }
+
+func TestDesignPrimersWithConstraints(t *testing.T) {
+	forwardOverhang, reverseOverhang := "TTATAGGTCTCATACT", "ATGAAGAGACCATATA"
+	wantForward, wantReverse := DesignPrimersWithOverhangs(gene, forwardOverhang, reverseOverhang, 55.0)
+	forward, reverse, err := DesignPrimersWithConstraints(gene, forwardOverhang, reverseOverhang, 55.0, primers.OligoConstraints{})
+	if err != nil || forward != wantForward || reverse != wantReverse {
+		t.Errorf("expected %s, %s without constraints, got %s, %s, %v", wantForward, wantReverse, forward, reverse, err)
+	}
+
+	// the 3' bases of both primers are G or C, so they are grown to an A or T.
+	constraints := primers.OligoConstraints{MaxLength: 60, ThreePrimeBases: "AT"}
+	forward, reverse, err = DesignPrimersWithConstraints(gene, forwardOverhang, reverseOverhang, 55.0, constraints)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(primers.CheckOligo(forward, constraints)) > 0 || len(primers.CheckOligo(reverse, constraints)) > 0 {
+		t.Errorf("primers %s, %s break %+v", forward, reverse, constraints)
+	}
+	if !strings.HasPrefix(forward, wantForward) || !strings.HasPrefix(reverse, wantReverse) {
+		t.Errorf("expected %s, %s to be grown from %s, %s", forward, reverse, wantForward, wantReverse)
+	}
+	if !strings.HasPrefix(strings.ToUpper(gene), forward[len(forwardOverhang):]) || !strings.HasSuffix(strings.ToUpper(gene), transform.ReverseComplement(reverse[len(reverseOverhang):])) {
+		t.Errorf("primers %s, %s don't bind the ends of the gene", forward, reverse)
+	}
+
+	tests := []struct {
+		name        string
+		constraints primers.OligoConstraints
+		violated    string
+	}{
+		{"max length", primers.OligoConstraints{MaxLength: 30}, "MaxLength"},
+		{"five prime base", primers.OligoConstraints{FivePrimeBases: "G"}, "FivePrimeBases"},
+		{"modification", primers.OligoConstraints{Modifications: []primers.Modification{{Name: "3' amine", Position: -1, Bases: "C"}}, MaxLength: 48}, "Modifications"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := DesignPrimersWithConstraints(gene, forwardOverhang, reverseOverhang, 55.0, test.constraints)
+			var violation primers.Violation
+			if !errors.As(err, &violation) || violation.Constraint != test.violated {
+				t.Errorf("expected a violation of %s, got %v", test.violated, err)
+			}
+		})
+	}
+}
@@ -144,6 +144,12 @@ func Translate(sequence string, codonTable Table) (string, error) {
 
 // Optimize takes an amino acid sequence and codonTable and returns an optimized codon sequence. Takes an optional random seed as last argument.
 func Optimize(aminoAcids string, codonTable Table, randomState ...int) (string, error) {
+	return optimize(aminoAcids, codonTable, nil, randomState)
+}
+
+// optimize is Optimize and OptimizeConstrained, which only differ in the
+// constraints their codonPicker applies.
+func optimize(aminoAcids string, codonTable Table, constraints []Constraint, randomState []int) (string, error) {
 	// Finding any given aminoAcid is dependent upon it being capitalized, so
 	// we do that here.
 	aminoAcids = strings.ToUpper(aminoAcids)
@@ -163,21 +169,348 @@ func Optimize(aminoAcids string, codonTable Table, randomState ...int) (string,
 	}
 
 	var codons strings.Builder
-	codonChooser, err := codonTable.Chooser()
+	picker, err := newCodonPicker(codonTable, constraints)
+	if err != nil {
+		return "", err
+	}
+
+	for position, aminoAcid := range []rune(aminoAcids) {
+		codon, err := picker.pick(position, aminoAcid)
+		if err != nil {
+			return "", err
+		}
+		codons.WriteString(codon)
+	}
+	return codons.String(), nil
+}
+
+// codonPicker picks codons at random, weighted by their weights. Without
+// constraints it uses the table's Chooser, which drops codons used for less
+// than 10% of their amino acid. With constraints it picks from every codon
+// they all allow, since keeping a rare codon can be the point of one.
+type codonPicker struct {
+	choosers    map[string]weightedRand.Chooser
+	aminoAcids  map[string]AminoAcid
+	constraints []Constraint
+}
+
+func newCodonPicker(codonTable Table, constraints []Constraint) (codonPicker, error) {
+	if len(constraints) == 0 {
+		choosers, err := codonTable.Chooser()
+		return codonPicker{choosers: choosers}, err
+	}
+	aminoAcids := make(map[string]AminoAcid)
+	for _, aminoAcid := range codonTable.GetAminoAcids() {
+		aminoAcids[aminoAcid.Letter] = aminoAcid
+	}
+	return codonPicker{aminoAcids: aminoAcids, constraints: constraints}, nil
+}
+
+// pick returns a codon for aminoAcid at position, the 0 indexed codon of
+// the sequence being optimized.
+func (picker codonPicker) pick(position int, aminoAcid rune) (string, error) {
+	if len(picker.constraints) == 0 {
+		chooser, ok := picker.choosers[string(aminoAcid)]
+		if !ok {
+			return "", invalidAminoAcidError{aminoAcid}
+		}
+		return chooser.Pick().(string), nil
+	}
+
+	tableAminoAcid, ok := picker.aminoAcids[string(aminoAcid)]
+	if !ok || len(tableAminoAcid.Codons) == 0 {
+		return "", invalidAminoAcidError{aminoAcid}
+	}
+	allowed := tableAminoAcid.Codons
+	for _, constraint := range picker.constraints {
+		allowed = constraint(position, tableAminoAcid, allowed)
+	}
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("no codon of %c at codon %d is allowed by every constraint", aminoAcid, position)
+	}
+	codonChoices := make([]weightedRand.Choice, len(allowed))
+	for index, codon := range allowed {
+		codonChoices[index] = weightedRand.Choice{Item: codon.Triplet, Weight: uint(codon.Weight)}
+	}
+	chooser, err := newChooserFn(codonChoices...)
+	if err != nil {
+		// none of the allowed codons have weight, so any will do.
+		return allowed[0].Triplet, nil
+	}
+	return chooser.Pick().(string), nil
+}
+
+// AmbiguousAminoAcids is how BackTranslate and BackTranslateDegenerate
+// encode the IUPAC ambiguous amino acids B, Z, J and X.
+type AmbiguousAminoAcids int
+
+const (
+	// RejectAmbiguous returns an error for ambiguous amino acids. It is the
+	// default of BackTranslate.
+	RejectAmbiguous AmbiguousAminoAcids = iota + 1
+	// EncodeAmbiguous encodes an ambiguous amino acid as any of the amino
+	// acids it stands for. BackTranslate uses the highest weighted codon of
+	// all of them, and BackTranslateDegenerate, by default, the union of
+	// their codons.
+	EncodeAmbiguous
+)
+
+// BackTranslateOption changes how BackTranslate and BackTranslateDegenerate
+// encode stops and ambiguous amino acids.
+type BackTranslateOption func(*backTranslateOptions)
+
+type backTranslateOptions struct {
+	stopCodon string
+	ambiguous AmbiguousAminoAcids
+}
+
+// WithStopCodon encodes every stop ("*") as codon instead of the default.
+// For BackTranslate it must be one of the table's stop codons. For
+// BackTranslateDegenerate it may have IUPAC codes, like TAR, as long as
+// every codon it stands for is a stop in the standard genetic code.
+func WithStopCodon(codon string) BackTranslateOption {
+	return func(options *backTranslateOptions) {
+		options.stopCodon = strings.ToUpper(codon)
+	}
+}
+
+// WithAmbiguousAminoAcids sets how ambiguous amino acids are encoded.
+func WithAmbiguousAminoAcids(handling AmbiguousAminoAcids) BackTranslateOption {
+	return func(options *backTranslateOptions) {
+		options.ambiguous = handling
+	}
+}
+
+// newBackTranslateOptions applies options over the defaults, ambiguous
+// amino acids handled as ambiguous says.
+func newBackTranslateOptions(ambiguous AmbiguousAminoAcids, options []BackTranslateOption) (backTranslateOptions, error) {
+	settings := backTranslateOptions{ambiguous: ambiguous}
+	for _, option := range options {
+		option(&settings)
+	}
+	if settings.ambiguous != RejectAmbiguous && settings.ambiguous != EncodeAmbiguous {
+		return backTranslateOptions{}, fmt.Errorf("unknown ambiguous amino acid handling %d", settings.ambiguous)
+	}
+	return settings, nil
+}
+
+// BackTranslate takes an amino acid sequence and a codon table and returns the
+// most likely codon sequence encoding it, choosing the highest weighted codon
+// for every amino acid. Ties are broken by the order codons appear in the
+// table so the output is deterministic, unlike Optimize.
+//
+// Stop codons ("*") are back translated like any other amino acid using the
+// table's stop codons, unless WithStopCodon picks one. Ambiguous amino acids
+// (B, Z, J and X) have no single concrete encoding and return an error,
+// unless WithAmbiguousAminoAcids(EncodeAmbiguous) is given; use
+// BackTranslateDegenerate if you need to represent all their encodings.
+func BackTranslate(aminoAcids string, codonTable Table, options ...BackTranslateOption) (string, error) {
+	aminoAcids = strings.ToUpper(aminoAcids)
+
+	if codonTable.IsEmpty() {
+		return "", errEmptyCodonTable
+	}
+	if len(aminoAcids) == 0 {
+		return "", errEmptyAminoAcidString
+	}
+	settings, err := newBackTranslateOptions(RejectAmbiguous, options)
 	if err != nil {
 		return "", err
 	}
 
+	bestCodons := make(map[rune]string)
+	bestWeights := make(map[rune]int)
+	for _, aminoAcid := range codonTable.GetAminoAcids() {
+		letter := []rune(aminoAcid.Letter)[0]
+		bestWeights[letter] = -1
+		for _, codon := range aminoAcid.Codons {
+			if codon.Weight > bestWeights[letter] {
+				bestWeights[letter] = codon.Weight
+				bestCodons[letter] = codon.Triplet
+			}
+		}
+	}
+	if settings.stopCodon != "" {
+		if !isStopCodon(settings.stopCodon, codonTable) {
+			return "", fmt.Errorf("%s isn't a stop codon of the codon table", settings.stopCodon)
+		}
+		bestCodons['*'] = settings.stopCodon
+	}
+	if settings.ambiguous == EncodeAmbiguous {
+		for ambiguous, members := range ambiguousAminoAcids {
+			bestWeight := -1
+			for _, member := range members {
+				if codon, ok := bestCodons[member]; ok && bestWeights[member] > bestWeight {
+					bestWeight = bestWeights[member]
+					bestCodons[ambiguous] = codon
+				}
+			}
+		}
+	}
+
+	var codons strings.Builder
 	for _, aminoAcid := range aminoAcids {
-		chooser, ok := codonChooser[string(aminoAcid)]
+		codon, ok := bestCodons[aminoAcid]
 		if !ok {
 			return "", invalidAminoAcidError{aminoAcid}
 		}
-		codons.WriteString(chooser.Pick().(string))
+		codons.WriteString(codon)
 	}
 	return codons.String(), nil
 }
 
+// isStopCodon returns true if codon is one of the stop codons of codonTable.
+func isStopCodon(codon string, codonTable Table) bool {
+	for _, stop := range codonTable.GetStopCodons() {
+		if codon == stop {
+			return true
+		}
+	}
+	return false
+}
+
+// ambiguousAminoAcids maps the IUPAC ambiguous amino acid codes to the amino
+// acids they stand for, in the order BackTranslate breaks ties in.
+var ambiguousAminoAcids = map[rune]string{
+	'B': "DN",                   // aspartic acid or asparagine
+	'Z': "EQ",                   // glutamic acid or glutamine
+	'J': "IL",                   // isoleucine or leucine
+	'X': "ACDEFGHIKLMNPQRSTVWY", // any amino acid
+}
+
+// BackTranslateDegenerate takes an amino acid sequence and returns a
+// degenerate nucleotide sequence, written with IUPAC codes, representing
+// every possible encoding of it under the standard genetic code (NCBI
+// table 1).
+//
+// Each amino acid is encoded as a single degenerate codon built from the bases
+// its codons can have at each position, so some amino acids encoded by two
+// codon families are over-represented: Arg (CGN, AGR) becomes MGN, Leu (CTN,
+// TTR) becomes YTN and Ser (TCN, AGY) becomes WSN. Stops ("*") become TRR,
+// which also matches the Trp codon TGG, unless WithStopCodon picks another,
+// like TAR. Over-representation is deliberate so that the output never
+// misses a real encoding when converted to a pattern with
+// transform.IUPACToRegexp; matches should be translated to discard the false
+// positives.
+//
+// The ambiguous amino acids B, Z and J are encoded as the union of the amino
+// acids they represent, and X as NNN, unless
+// WithAmbiguousAminoAcids(RejectAmbiguous) makes them an error.
+func BackTranslateDegenerate(aminoAcids string, options ...BackTranslateOption) (string, error) {
+	aminoAcids = strings.ToUpper(aminoAcids)
+	if len(aminoAcids) == 0 {
+		return "", errEmptyAminoAcidString
+	}
+	settings, err := newBackTranslateOptions(EncodeAmbiguous, options)
+	if err != nil {
+		return "", err
+	}
+	standard := defaultCodonTablesByNumber[1]
+
+	// collect the bases used at each codon position for every amino acid
+	positionBases := make(map[rune][3]map[byte]bool)
+	for _, aminoAcid := range standard.AminoAcids {
+		letter := []rune(aminoAcid.Letter)[0]
+		bases := [3]map[byte]bool{{}, {}, {}}
+		for _, codon := range aminoAcid.Codons {
+			for position := range bases {
+				bases[position][codon.Triplet[position]] = true
+			}
+		}
+		positionBases[letter] = bases
+	}
+	if settings.ambiguous == EncodeAmbiguous {
+		for ambiguous, members := range ambiguousAminoAcids {
+			bases := [3]map[byte]bool{{}, {}, {}}
+			for _, member := range members {
+				for position := range bases {
+					for base := range positionBases[member][position] {
+						bases[position][base] = true
+					}
+				}
+			}
+			positionBases[ambiguous] = bases
+		}
+	}
+
+	stopCodon := ""
+	if settings.stopCodon != "" {
+		codons, err := expandDegenerateCodon(settings.stopCodon)
+		if err != nil {
+			return "", err
+		}
+		for _, codon := range codons {
+			if !isStopCodon(codon, standard) {
+				return "", fmt.Errorf("%s stands for %s, which isn't a stop codon", settings.stopCodon, codon)
+			}
+		}
+		stopCodon = settings.stopCodon
+	}
+
+	var codons strings.Builder
+	for _, aminoAcid := range aminoAcids {
+		if aminoAcid == '*' && stopCodon != "" {
+			codons.WriteString(stopCodon)
+			continue
+		}
+		bases, ok := positionBases[aminoAcid]
+		if !ok {
+			return "", invalidAminoAcidError{aminoAcid}
+		}
+		for _, position := range bases {
+			codons.WriteByte(iupacCode(position))
+		}
+	}
+	return codons.String(), nil
+}
+
+// expandDegenerateCodon returns every codon the IUPAC codon degenerate
+// stands for.
+func expandDegenerateCodon(degenerate string) ([]string, error) {
+	if len(degenerate) != 3 {
+		return nil, fmt.Errorf("codon %s isn't 3 bases long", degenerate)
+	}
+	codons := []string{""}
+	for index := 0; index < len(degenerate); index++ {
+		mask := strings.IndexByte(iupacCodes, degenerate[index])
+		if mask < 1 {
+			return nil, fmt.Errorf("codon %s has %q, which isn't an IUPAC nucleotide code", degenerate, degenerate[index])
+		}
+		var expanded []string
+		for _, codon := range codons {
+			for bit, base := range "ACGT" {
+				if mask&(1<<bit) != 0 {
+					expanded = append(expanded, codon+string(base))
+				}
+			}
+		}
+		codons = expanded
+	}
+	return codons, nil
+}
+
+// iupacCodes are the IUPAC nucleotide codes, indexed by the bitmask of the
+// bases they stand for, A=1, C=2, G=4, T=8.
+const iupacCodes = "-ACMGRSVTWYHKDBN"
+
+// iupacCode returns the IUPAC nucleotide code representing a set of bases.
+func iupacCode(bases map[byte]bool) byte {
+	var mask int
+	for base := range bases {
+		switch base {
+		case 'A':
+			mask |= 1
+		case 'C':
+			mask |= 2
+		case 'G':
+			mask |= 4
+		case 'T':
+			mask |= 8
+		}
+	}
+	return iupacCodes[mask]
+}
+
 // OptimizeTable weights each codon in a codon table according to input string codon frequency.
 // This function actually mutates the codonTable struct itself.
 func (table codonTable) OptimizeTable(sequence string) Table {
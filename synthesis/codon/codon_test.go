@@ -2,11 +2,13 @@ package codon
 
 import (
 	"errors"
+	"math"
 	"os"
 	"strings"
 	"testing"
 
 	"github.com/TimothyStiles/poly/io/genbank"
+	"github.com/TimothyStiles/poly/transform"
 	"github.com/google/go-cmp/cmp"
 	weightedRand "github.com/mroth/weightedrand"
 	"github.com/stretchr/testify/assert"
@@ -388,3 +390,298 @@ func TestCapitalizationRegression(t *testing.T) {
 		t.Errorf("TestOptimize has failed. Translate has returned %q, want %q", optimizedSequenceTranslation, gfpTranslation)
 	}
 }
+
+func TestBackTranslate(t *testing.T) {
+	gfpTranslation := "MASKGEELFTGVVPILVELDGDVNGHKFSVSGEGEGDATYGKLTLKFICTTGKLPVPWPTLVTTFSYGVQCFSRYPDHMKRHDFFKSAMPEGYVQERTISFKDDGNYKTRAEVKFEGDTLVNRIELKGIDFKEDGNILGHKLEYNYNSHNVYITADKQKNGIKANFKIRHNIEDGSVQLADHYQQNTPIGDGPVLLPDNHYLSTQSALSKDPNEKRDHMVLLEFVTAAGITHGMDELYK*"
+	table := GetCodonTable(11)
+
+	backTranslation, err := BackTranslate(gfpTranslation, table)
+	if err != nil {
+		t.Fatalf("BackTranslate returned an unexpected error: %s", err)
+	}
+	translation, _ := Translate(backTranslation, table)
+	if translation != gfpTranslation {
+		t.Errorf("TestBackTranslate has failed. Translate has returned %q, want %q", translation, gfpTranslation)
+	}
+
+	// the same table should always give the same sequence
+	secondBackTranslation, _ := BackTranslate(gfpTranslation, table)
+	if secondBackTranslation != backTranslation {
+		t.Errorf("BackTranslate is not deterministic")
+	}
+
+	if _, err := BackTranslate("MBZ", table); err == nil {
+		t.Errorf("BackTranslate should return an error on ambiguous amino acids")
+	}
+	if _, err := BackTranslate("", table); err != errEmptyAminoAcidString {
+		t.Errorf("BackTranslate should return an error on an empty amino acid string")
+	}
+	if _, err := BackTranslate("M", codonTable{}); err != errEmptyCodonTable {
+		t.Errorf("BackTranslate should return an error on an empty codon table")
+	}
+}
+
+func TestBackTranslateOptions(t *testing.T) {
+	table := GetCodonTable(11)
+
+	for _, stop := range table.GetStopCodons() {
+		got, err := BackTranslate("M*", table, WithStopCodon(strings.ToLower(stop)))
+		if err != nil {
+			t.Errorf("BackTranslate with stop codon %s returned an unexpected error: %s", stop, err)
+		}
+		if want := "ATG" + stop; got != want {
+			t.Errorf("BackTranslate with stop codon %s = %q, want %q", stop, got, want)
+		}
+	}
+	if _, err := BackTranslate("M*", table, WithStopCodon("TGG")); err == nil {
+		t.Errorf("BackTranslate should return an error on a stop codon that isn't one")
+	}
+
+	ambiguous, err := BackTranslate("MBZJX", table, WithAmbiguousAminoAcids(EncodeAmbiguous))
+	if err != nil {
+		t.Fatalf("BackTranslate with EncodeAmbiguous returned an unexpected error: %s", err)
+	}
+	translation, _ := Translate(ambiguous, table)
+	if len(translation) != 5 {
+		t.Fatalf("BackTranslate with EncodeAmbiguous returned %q, which translates to %q", ambiguous, translation)
+	}
+	for index, members := range []string{"DN", "EQ", "IL", "ACDEFGHIKLMNPQRSTVWY"} {
+		if !strings.ContainsRune(members, rune(translation[index+1])) {
+			t.Errorf("BackTranslate encoded %c as %c, want one of %s", "BZJX"[index], translation[index+1], members)
+		}
+	}
+	if _, err := BackTranslate("M", table, WithAmbiguousAminoAcids(0)); err == nil {
+		t.Errorf("BackTranslate should return an error on unknown ambiguous amino acid handling")
+	}
+}
+
+func TestBackTranslateDegenerate(t *testing.T) {
+	tests := []struct {
+		aminoAcids string
+		want       string
+	}{
+		{"A", "GCN"},
+		{"R", "MGN"},
+		{"L", "YTN"},
+		{"S", "WSN"},
+		{"M", "ATG"},
+		{"W", "TGG"},
+		{"I", "ATH"},
+		{"*", "TRR"},
+		{"B", "RAY"},
+		{"X", "NNN"},
+		{"mk", "ATGAAR"},
+	}
+	for _, test := range tests {
+		got, err := BackTranslateDegenerate(test.aminoAcids)
+		if err != nil {
+			t.Errorf("BackTranslateDegenerate(%q) returned an unexpected error: %s", test.aminoAcids, err)
+		}
+		if got != test.want {
+			t.Errorf("BackTranslateDegenerate(%q) = %q, want %q", test.aminoAcids, got, test.want)
+		}
+	}
+
+	if _, err := BackTranslateDegenerate("MO"); err == nil {
+		t.Errorf("BackTranslateDegenerate should return an error on invalid amino acids")
+	}
+}
+
+func TestBackTranslateDegenerateOptions(t *testing.T) {
+	tests := []struct {
+		stopCodon string
+		want      string
+	}{
+		{"TAR", "ATGTAR"},
+		{"tga", "ATGTGA"},
+		{"TRA", "ATGTRA"},
+	}
+	for _, test := range tests {
+		got, err := BackTranslateDegenerate("M*", WithStopCodon(test.stopCodon))
+		if err != nil {
+			t.Errorf("BackTranslateDegenerate with stop codon %s returned an unexpected error: %s", test.stopCodon, err)
+		}
+		if got != test.want {
+			t.Errorf("BackTranslateDegenerate with stop codon %s = %q, want %q", test.stopCodon, got, test.want)
+		}
+	}
+	for _, stopCodon := range []string{"TRR", "TGG", "TA", "TAO"} {
+		if _, err := BackTranslateDegenerate("M*", WithStopCodon(stopCodon)); err == nil {
+			t.Errorf("BackTranslateDegenerate should return an error on stop codon %s", stopCodon)
+		}
+	}
+
+	if _, err := BackTranslateDegenerate("MB", WithAmbiguousAminoAcids(RejectAmbiguous)); err == nil {
+		t.Errorf("BackTranslateDegenerate should return an error on ambiguous amino acids with RejectAmbiguous")
+	}
+	if got, _ := BackTranslateDegenerate("MK", WithAmbiguousAminoAcids(RejectAmbiguous)); got != "ATGAAR" {
+		t.Errorf("BackTranslateDegenerate with RejectAmbiguous = %q, want %q", got, "ATGAAR")
+	}
+}
+
+func TestBackTranslateDegenerateGenomeSearch(t *testing.T) {
+	plasmid, _ := genbank.Read("../../data/puc19.gbk")
+	codonTable := GetCodonTable(11)
+
+	var cds genbank.Feature
+	for _, feature := range plasmid.Features {
+		if feature.Type == "CDS" {
+			cds = feature
+			break
+		}
+	}
+	gene, _ := cds.GetSequence()
+	protein, _ := Translate(gene, codonTable)
+	peptide := protein[:10]
+
+	degenerate, err := BackTranslateDegenerate(peptide)
+	if err != nil {
+		t.Fatalf("BackTranslateDegenerate returned an unexpected error: %s", err)
+	}
+	pattern, err := transform.IUPACToRegexp(degenerate)
+	if err != nil {
+		t.Fatalf("IUPACToRegexp returned an unexpected error: %s", err)
+	}
+
+	// the gene may be on either strand, so search both.
+	var found bool
+	for _, strand := range []string{plasmid.Sequence, transform.ReverseComplement(plasmid.Sequence)} {
+		for _, match := range pattern.FindAllString(strand, -1) {
+			if translation, _ := Translate(match, codonTable); translation == peptide {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("failed to find peptide %q in puc19 using degenerate pattern %q", peptide, degenerate)
+	}
+}
+
+// bsubTable returns the codon table of B. subtilis in
+// data/bsub_codon_test.json, and the first coding region of data/bsub.gbk.
+func bsubTable(t *testing.T) (Table, string) {
+	t.Helper()
+	sequence, err := genbank.Read("../../data/bsub.gbk")
+	if err != nil {
+		t.Fatalf("Failed to read bsub.gbk: %s", err)
+	}
+	var firstCodingRegion string
+	for _, feature := range sequence.Features {
+		if feature.Type == "CDS" && firstCodingRegion == "" {
+			firstCodingRegion, _ = feature.GetSequence()
+		}
+	}
+	return ReadCodonJSON("../../data/bsub_codon_test.json"), firstCodingRegion
+}
+
+func TestMinMaxProfile(t *testing.T) {
+	table, _ := bsubTable(t)
+	protein := "MASKGEELFTGVVPILVELDGDVNGHKFSVSGEGEGDATYGKLTLKFICTTGKLPVPWPTLVTTFSYGVQCFSRYPDHMKRHDFFKSAMPEGYVQERTISFKDDGNYKTRAEVKFEGDTLVNRIELKGIDFKEDGNILGHKLEYNYNSHNVYITADKQKNGIKANFKIRHNIEDGSVQLADHYQQNTPIGDGPVLLPDNHYLSTQSALSKDPNEKRDHMVLLEFVTAAGITHGMDELYK*"
+
+	// only the most frequent codons.
+	frequent, _ := BackTranslate(protein, table)
+	profile := MinMaxProfile(frequent, table, 18)
+	if len(profile) != len(protein) {
+		t.Fatalf("Expected a value for each of %d codons, got %d", len(protein), len(profile))
+	}
+	for index, value := range profile {
+		if math.Abs(value-100) > 1e-9 {
+			t.Errorf("Expected %%MinMax of 100 at codon %d of frequent codons, got %f", index, value)
+		}
+	}
+
+	// windows at the ends are shorter, and amino acids with a single codon
+	// don't count.
+	profile = MinMaxProfile("ATGTGGATGTGGATGTGG"+frequent[:30], table, 5)
+	if profile[0] != 0 || profile[1] != 0 {
+		t.Errorf("Expected windows of only M and W to be 0, got %v", profile[:2])
+	}
+	if profile[len(profile)-1] != 100 {
+		t.Errorf("Expected the last, shortened window to be 100, got %f", profile[len(profile)-1])
+	}
+	if MinMaxProfile(frequent, table, 0) != nil {
+		t.Errorf("Expected no profile for windows of 0 codons")
+	}
+}
+
+func TestOptimizeConstrained(t *testing.T) {
+	table, source := bsubTable(t)
+	protein, err := Translate(source, table)
+	if err != nil {
+		t.Fatalf("Failed to translate: %s", err)
+	}
+	reference := MinMaxProfile(source, table, 18)
+
+	harmonized, err := OptimizeConstrained(protein, table, []Constraint{PreserveMinMaxProfile(reference, 10)}, 1)
+	if err != nil {
+		t.Fatalf("OptimizeConstrained returned an unexpected error: %s", err)
+	}
+	if translation, _ := Translate(harmonized, table); translation != protein {
+		t.Errorf("Harmonized sequence translates to %q, want %q", translation, protein)
+	}
+	correlation := pearson(reference, MinMaxProfile(harmonized, table, 18))
+	if correlation < 0.6 {
+		t.Errorf("Expected the harmonized profile to correlate with the reference above 0.6, got %f", correlation)
+	}
+
+	// a tolerance wider than %MinMax's range doesn't constrain anything.
+	unconstrained, _ := OptimizeConstrained(protein, table, []Constraint{PreserveMinMaxProfile(reference, 200)}, 1)
+	if unconstrainedCorrelation := pearson(reference, MinMaxProfile(unconstrained, table, 18)); unconstrainedCorrelation >= correlation {
+		t.Errorf("Expected an unconstrained profile to correlate less than %f, got %f", correlation, unconstrainedCorrelation)
+	}
+
+	// the same seed gives the same sequence.
+	again, _ := OptimizeConstrained(protein, table, []Constraint{PreserveMinMaxProfile(reference, 10)}, 1)
+	if again != harmonized {
+		t.Errorf("OptimizeConstrained is not deterministic for a seed")
+	}
+	if _, err := OptimizeConstrained("MBZ", table, nil, 1); err == nil {
+		t.Errorf("Expected an error for amino acids not in the table")
+	}
+
+	// without constraints it is Optimize.
+	optimized, _ := Optimize(protein, table, 1)
+	if plain, _ := OptimizeConstrained(protein, table, nil, 1); plain != optimized {
+		t.Errorf("OptimizeConstrained without constraints should match Optimize for a seed")
+	}
+
+	// constraints can be written outside of the package.
+	avoidCTG := func(position int, aminoAcid AminoAcid, codons []Codon) []Codon {
+		var allowed []Codon
+		for _, codon := range codons {
+			if codon.Triplet != "CTG" {
+				allowed = append(allowed, codon)
+			}
+		}
+		return allowed
+	}
+	avoided, err := OptimizeConstrained(protein, table, []Constraint{avoidCTG}, 1)
+	if err != nil {
+		t.Fatalf("OptimizeConstrained returned an unexpected error: %s", err)
+	}
+	for index := 0; index+3 <= len(avoided); index += 3 {
+		if avoided[index:index+3] == "CTG" {
+			t.Errorf("Expected no CTG codons, found one at codon %d", index/3)
+		}
+	}
+	allowNothing := func(position int, aminoAcid AminoAcid, codons []Codon) []Codon { return nil }
+	if _, err := OptimizeConstrained(protein, table, []Constraint{allowNothing}, 1); err == nil {
+		t.Errorf("Expected an error when a constraint allows no codon")
+	}
+}
+
+// pearson returns the Pearson correlation of x and y.
+func pearson(x, y []float64) float64 {
+	var meanX, meanY float64
+	for index := range x {
+		meanX += x[index] / float64(len(x))
+		meanY += y[index] / float64(len(y))
+	}
+	var covariance, varianceX, varianceY float64
+	for index := range x {
+		covariance += (x[index] - meanX) * (y[index] - meanY)
+		varianceX += (x[index] - meanX) * (x[index] - meanX)
+		varianceY += (y[index] - meanY) * (y[index] - meanY)
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
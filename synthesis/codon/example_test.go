@@ -200,3 +200,10 @@ func ExampleAddCodonTable() {
 	}
 	//output: 90
 }
+
+func ExampleBackTranslateDegenerate() {
+	degenerate, _ := codon.BackTranslateDegenerate("MAR*")
+
+	fmt.Println(degenerate)
+	// Output: ATGGCNMGNTRR
+}
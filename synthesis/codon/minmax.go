@@ -0,0 +1,163 @@
+package codon
+
+import (
+	"math"
+	"strings"
+)
+
+/******************************************************************************
+%MinMax begins here
+
+Ribosomes don't translate at a steady pace. Clusters of rare codons slow them
+down, and some proteins rely on those pauses to fold one domain before the
+next is made. Optimizing every codon to the most frequent one irons the
+pauses out, which can leave a protein well expressed and badly folded.
+
+%MinMax, from Clarke and Clark 2008 (https://doi.org/10.1371/journal.pone.0003412),
+measures how common the codons in a window are compared to the codons that
+could have been used instead. A window of only the most frequent codons is
+100, one of only the rarest is -100, and one of codons as common as the
+average synonymous codon is 0. Usage is each codon's weight as a fraction of
+the weights of its amino acid in a Table, so tables need weights, like those
+from OptimizeTable. Amino acids with one codon, like methionine, have no
+choice to measure and are left out of windows.
+
+Harmonizing a gene for a new host means keeping the profile of the source
+gene, measured with the source host's table, in the new host. OptimizeConstrained
+with PreserveMinMaxProfile does that by only choosing codons whose own
+%MinMax is close to the source profile at their position.
+
+******************************************************************************/
+
+// codonUsage is the usage of a codon and of the codons of its amino acid.
+type codonUsage struct {
+	usage, min, max, average float64
+}
+
+// codonUsages returns the usage of each codon of aminoAcid as a fraction of
+// the weights of its codons, or nil if it has one codon or no weight.
+func codonUsages(aminoAcid AminoAcid) map[string]codonUsage {
+	total := 0
+	for _, codon := range aminoAcid.Codons {
+		total += codon.Weight
+	}
+	if len(aminoAcid.Codons) < 2 || total == 0 {
+		return nil
+	}
+	usages := make(map[string]codonUsage, len(aminoAcid.Codons))
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+	for _, codon := range aminoAcid.Codons {
+		usage := float64(codon.Weight) / float64(total)
+		minimum, maximum = math.Min(minimum, usage), math.Max(maximum, usage)
+	}
+	average := 1 / float64(len(aminoAcid.Codons))
+	for _, codon := range aminoAcid.Codons {
+		usages[strings.ToUpper(codon.Triplet)] = codonUsage{usage: float64(codon.Weight) / float64(total), min: minimum, max: maximum, average: average}
+	}
+	return usages
+}
+
+// minMax returns the %MinMax of codons whose usages add up to usage.
+func minMax(usage codonUsage) float64 {
+	switch {
+	case usage.usage >= usage.average && usage.max > usage.average:
+		return 100 * (usage.usage - usage.average) / (usage.max - usage.average)
+	case usage.usage < usage.average && usage.average > usage.min:
+		return -100 * (usage.average - usage.usage) / (usage.average - usage.min)
+	}
+	return 0
+}
+
+// MinMaxProfile returns the %MinMax of every codon of cds under table, each
+// measured over a window of windowCodons codons centred on it. Windows at
+// the ends of cds are cut short rather than dropped, so the profile has a
+// value for every codon. Codons not in table and bases past the last full
+// codon are ignored. It returns nil if windowCodons is less than 1.
+func MinMaxProfile(cds string, table Table, windowCodons int) []float64 {
+	if windowCodons < 1 {
+		return nil
+	}
+	usages := make(map[string]codonUsage)
+	for _, aminoAcid := range table.GetAminoAcids() {
+		for triplet, usage := range codonUsages(aminoAcid) {
+			usages[triplet] = usage
+		}
+	}
+
+	// sums[i] is the sum of the usages of the first i codons.
+	cds = strings.ToUpper(cds)
+	codons := len(cds) / 3
+	sums := make([]codonUsage, codons+1)
+	for index := 0; index < codons; index++ {
+		usage := usages[cds[3*index:3*index+3]]
+		sums[index+1] = codonUsage{
+			usage:   sums[index].usage + usage.usage,
+			min:     sums[index].min + usage.min,
+			max:     sums[index].max + usage.max,
+			average: sums[index].average + usage.average,
+		}
+	}
+
+	profile := make([]float64, codons)
+	for index := range profile {
+		start := index - windowCodons/2
+		end := start + windowCodons
+		if start < 0 {
+			start = 0
+		}
+		if end > codons {
+			end = codons
+		}
+		profile[index] = minMax(codonUsage{
+			usage:   sums[end].usage - sums[start].usage,
+			min:     sums[end].min - sums[start].min,
+			max:     sums[end].max - sums[start].max,
+			average: sums[end].average - sums[start].average,
+		})
+	}
+	return profile
+}
+
+// Constraint limits the codons OptimizeConstrained may choose. It returns
+// the codons of codons, some of the codons of aminoAcid, that may be used at
+// position, the 0 indexed codon of the sequence being optimized.
+type Constraint func(position int, aminoAcid AminoAcid, codons []Codon) []Codon
+
+// PreserveMinMaxProfile constrains OptimizeConstrained to codons whose own
+// %MinMax is within tolerance of reference, a MinMaxProfile of the source
+// gene, at their position. Where no codon is that close, the closest is
+// used. Positions past the end of reference aren't constrained.
+func PreserveMinMaxProfile(reference []float64, tolerance float64) Constraint {
+	return func(position int, aminoAcid AminoAcid, codons []Codon) []Codon {
+		usages := codonUsages(aminoAcid)
+		if position >= len(reference) || usages == nil {
+			return codons
+		}
+		target := reference[position]
+		var allowed []Codon
+		var closest Codon
+		closestDistance := math.Inf(1)
+		for _, codon := range codons {
+			distance := math.Abs(minMax(usages[strings.ToUpper(codon.Triplet)]) - target)
+			if distance <= tolerance {
+				allowed = append(allowed, codon)
+			}
+			if distance < closestDistance {
+				closest, closestDistance = codon, distance
+			}
+		}
+		if len(allowed) == 0 {
+			return []Codon{closest}
+		}
+		return allowed
+	}
+}
+
+// OptimizeConstrained is Optimize, choosing each codon only from those every
+// constraint allows. Codons are weighted as in Optimize, but rare codons a
+// constraint allows aren't dropped, since keeping them can be the point.
+// Without constraints it is Optimize. Takes an optional random seed as last
+// argument.
+func OptimizeConstrained(aminoAcids string, codonTable Table, constraints []Constraint, randomState ...int) (string, error) {
+	return optimize(aminoAcids, codonTable, constraints, randomState)
+}
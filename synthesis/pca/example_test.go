@@ -0,0 +1,19 @@
+package pca_test
+
+import (
+	"fmt"
+
+	"github.com/TimothyStiles/poly/random"
+	"github.com/TimothyStiles/poly/synthesis/pca"
+)
+
+// This example splits a 300 base gene into 90 base oligos whose overlaps all
+// melt within 2.5 C of 60 C.
+func ExampleOligoPool() {
+	gene, _ := random.DNASequence(300, 1)
+	oligos, _ := pca.OligoPool(gene, 90, 60, pca.DefaultOptions)
+
+	assembled, _ := pca.Assemble(oligos, pca.DefaultOptions.MinOverlap)
+	fmt.Println(len(oligos), assembled == gene)
+	// Output: 4 true
+}
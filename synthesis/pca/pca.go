@@ -0,0 +1,269 @@
+/*
+Package pca designs oligo pools for polymerase cycling assembly.
+
+Genes too long to synthesize as one oligo are built from a pool of
+overlapping oligos that alternate between the two strands. In a PCR without
+primers, each oligo anneals to its neighbors through their overlaps and is
+extended across them, until the full length gene is made and can be
+amplified with a pair of outer primers.
+
+An assembly only works if every overlap anneals at the same temperature, so
+OligoPool splits a sequence at overlaps whose melting temperatures are all
+close to a target, using as few oligos as it can, and among those the split
+whose overlaps are closest to the target. Overlaps that appear more than
+once, on either strand, are never used, since they could anneal to the wrong
+oligo. Every oligo is folded to flag hairpins that would keep it from
+annealing, and the pool is checked by simulating the assembly.
+
+This is the approach of DNAWorks, from Hoover and Lubkowski 2002:
+https://doi.org/10.1093/nar/30.10.e43
+*/
+package pca
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/TimothyStiles/poly/fold"
+	"github.com/TimothyStiles/poly/primers"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+// Oligo is one oligo of a pool.
+type Oligo struct {
+	Sequence      string  // Sequence is the oligo as it is ordered, 5' to 3'.
+	Start, End    int     // Start and End are the 0 indexed, end exclusive region of the input the oligo covers.
+	TopStrand     bool    // TopStrand is true if Sequence is the input's strand, and false if it is its reverse complement.
+	OverlapTm     float64 // OverlapTm is the melting temperature of the overlap with the next oligo, or 0 for the last oligo.
+	HairpinEnergy float64 // HairpinEnergy is the minimum free energy of the oligo folded at Options.HairpinTemp.
+	Hairpin       bool    // Hairpin is true if HairpinEnergy is below Options.MaxHairpinEnergy.
+}
+
+// Options configures OligoPool.
+type Options struct {
+	// TmTolerance is how far, in Celsius, the melting temperature of every
+	// overlap may be from the target.
+	TmTolerance float64
+	// MinOverlap and MaxOverlap bound the length of the overlaps.
+	MinOverlap, MaxOverlap int
+	// HairpinTemp is the temperature, in Celsius, oligos are folded at to
+	// find hairpins. It should be the annealing temperature of the assembly.
+	HairpinTemp float64
+	// MaxHairpinEnergy is the free energy, in kcal/mol, below which an
+	// oligo's structure is flagged as a hairpin.
+	MaxHairpinEnergy float64
+	// Constraints are the synthesis rules every oligo must meet. Oligos are
+	// made no longer than Constraints.MaxLength, whatever oligoLength is.
+	Constraints primers.OligoConstraints
+}
+
+// DefaultOptions are options for a typical assembly with 60 C overlaps.
+var DefaultOptions = Options{
+	TmTolerance:      2.5,
+	MinOverlap:       15,
+	MaxOverlap:       30,
+	HairpinTemp:      60,
+	MaxHairpinEnergy: -3,
+}
+
+// junction is a candidate overlap between two oligos.
+type junction struct {
+	start, end int
+	tm         float64
+}
+
+// junctionChoice is the best way to split a sequence up to a junction.
+type junctionChoice struct {
+	// junctions is how many overlaps the split has, or -1 if there is no
+	// split.
+	junctions int
+	// deviation is the sum of squared differences of the overlap melting
+	// temperatures from the target.
+	deviation float64
+	previous  int
+}
+
+// better returns true if choice needs fewer oligos than other, or as many
+// with overlap melting temperatures closer to the target.
+func (choice junctionChoice) better(other junctionChoice) bool {
+	if choice.junctions != other.junctions {
+		return choice.junctions < other.junctions
+	}
+	return choice.deviation < other.deviation
+}
+
+// OligoPool splits seq into oligos of at most oligoLength bases, alternating
+// between the top and bottom strand, whose overlaps all have melting
+// temperatures within opts.TmTolerance of overlapTmTarget and which appear
+// only once in seq and its reverse complement. It returns an error if no
+// split meets that, if an oligo breaks opts.Constraints, or if the oligos
+// don't assemble back into seq.
+func OligoPool(seq string, oligoLength int, overlapTmTarget float64, opts Options) ([]Oligo, error) {
+	seq = strings.ToUpper(seq)
+	if maxLength := opts.Constraints.MaxLength; maxLength > 0 && oligoLength > maxLength {
+		oligoLength = maxLength
+	}
+	for index, base := range seq {
+		if !strings.ContainsRune("ATGC", base) {
+			return nil, fmt.Errorf("invalid base %q at index %d, only A, T, G and C can be synthesized", base, index)
+		}
+	}
+	switch {
+	case len(seq) == 0:
+		return nil, errors.New("empty sequence")
+	case opts.MinOverlap < 1 || opts.MaxOverlap < opts.MinOverlap:
+		return nil, fmt.Errorf("overlaps must be from %d to %d bases, which is not a valid range", opts.MinOverlap, opts.MaxOverlap)
+	case oligoLength < 2*opts.MaxOverlap:
+		return nil, fmt.Errorf("oligos of %d bases can't fit two overlaps of up to %d bases", oligoLength, opts.MaxOverlap)
+	}
+
+	var junctions []junction
+	if len(seq) > oligoLength {
+		var err error
+		junctions, err = splitJunctions(seq, oligoLength, overlapTmTarget, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oligos := make([]Oligo, len(junctions)+1)
+	for index := range oligos {
+		oligo := Oligo{Start: 0, End: len(seq), TopStrand: index%2 == 0}
+		if index > 0 {
+			oligo.Start = junctions[index-1].start
+		}
+		if index < len(junctions) {
+			oligo.End = junctions[index].end
+			oligo.OverlapTm = junctions[index].tm
+		}
+		oligo.Sequence = seq[oligo.Start:oligo.End]
+		if !oligo.TopStrand {
+			oligo.Sequence = transform.ReverseComplement(oligo.Sequence)
+		}
+		if violations := primers.CheckOligo(oligo.Sequence, opts.Constraints); len(violations) > 0 {
+			return nil, fmt.Errorf("oligo %d: %w", index+1, violations[0])
+		}
+		result, err := fold.Zuker(oligo.Sequence, opts.HairpinTemp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fold oligo %d: %w", index+1, err)
+		}
+		if energy := result.MinimumFreeEnergy(); !math.IsInf(energy, 0) {
+			oligo.HairpinEnergy = energy
+		}
+		oligo.Hairpin = oligo.HairpinEnergy < opts.MaxHairpinEnergy
+		oligos[index] = oligo
+	}
+
+	assembled, err := Assemble(oligos, opts.MinOverlap)
+	if err != nil {
+		return nil, fmt.Errorf("oligos failed to assemble: %w", err)
+	}
+	if assembled != seq {
+		return nil, errors.New("oligos assemble into a different sequence, an overlap probably matches a repeat")
+	}
+	return oligos, nil
+}
+
+// splitJunctions returns the overlaps of the best split of seq.
+func splitJunctions(seq string, oligoLength int, overlapTmTarget float64, opts Options) ([]junction, error) {
+	// candidates[start] are the overlaps starting at start with a melting
+	// temperature close enough to the target.
+	reverse := transform.ReverseComplement(seq)
+	candidates := make([][]junction, len(seq))
+	for start := range seq {
+		for length := opts.MinOverlap; length <= opts.MaxOverlap && start+length <= len(seq); length++ {
+			overlap := seq[start : start+length]
+			tm := primers.MeltingTemp(overlap)
+			if math.Abs(tm-overlapTmTarget) > opts.TmTolerance {
+				continue
+			}
+			// an overlap that appears elsewhere on either strand could
+			// anneal there instead.
+			if strings.Count(seq, overlap) == 1 && !strings.Contains(reverse, overlap) {
+				candidates[start] = append(candidates[start], junction{start: start, end: start + length, tm: tm})
+			}
+		}
+	}
+
+	// choices[start][index] is the best split ending with candidates[start][index].
+	choices := make([][]junctionChoice, len(seq))
+	best, bestStart, bestIndex := junctionChoice{junctions: -1}, -1, -1
+	for start := range seq {
+		choices[start] = make([]junctionChoice, len(candidates[start]))
+		for index, candidate := range candidates[start] {
+			squared := (candidate.tm - overlapTmTarget) * (candidate.tm - overlapTmTarget)
+			choice := junctionChoice{junctions: -1}
+			if candidate.end <= oligoLength {
+				choice = junctionChoice{junctions: 1, deviation: squared, previous: -1}
+			}
+			// the oligo between the previous overlap and this one starts
+			// where the previous overlap starts.
+			for previousStart := candidate.end - oligoLength; previousStart < start; previousStart++ {
+				if previousStart < 0 {
+					continue
+				}
+				for previousIndex, previous := range candidates[previousStart] {
+					previousChoice := choices[previousStart][previousIndex]
+					if previous.end > start || previousChoice.junctions == -1 {
+						continue
+					}
+					next := junctionChoice{junctions: previousChoice.junctions + 1, deviation: previousChoice.deviation + squared, previous: previousStart*(opts.MaxOverlap+1) + previousIndex}
+					if choice.junctions == -1 || next.better(choice) {
+						choice = next
+					}
+				}
+			}
+			choices[start][index] = choice
+			if choice.junctions != -1 && len(seq)-start <= oligoLength && (best.junctions == -1 || choice.better(best)) {
+				best, bestStart, bestIndex = choice, start, index
+			}
+		}
+	}
+	if best.junctions == -1 {
+		return nil, fmt.Errorf("no split into oligos of %d bases has every overlap within %.1f C of %.1f C", oligoLength, opts.TmTolerance, overlapTmTarget)
+	}
+
+	junctions := make([]junction, best.junctions)
+	for index := len(junctions) - 1; index >= 0; index-- {
+		junctions[index] = candidates[bestStart][bestIndex]
+		previous := choices[bestStart][bestIndex].previous
+		bestStart, bestIndex = previous/(opts.MaxOverlap+1), previous%(opts.MaxOverlap+1)
+	}
+	return junctions, nil
+}
+
+// Assemble simulates the overlap extension of a pool of oligos, in order,
+// and returns the top strand of the product. Each oligo is joined to the
+// product so far at the longest overlap of at least minOverlap bases, and
+// an error is returned if an oligo doesn't overlap the one before it.
+func Assemble(oligos []Oligo, minOverlap int) (string, error) {
+	if len(oligos) == 0 {
+		return "", errors.New("no oligos to assemble")
+	}
+	product := topStrand(oligos[0])
+	for index, oligo := range oligos[1:] {
+		next := topStrand(oligo)
+		overlap := 0
+		for length := len(next); length >= minOverlap && length > 0; length-- {
+			if length <= len(product) && strings.HasSuffix(product, next[:length]) {
+				overlap = length
+				break
+			}
+		}
+		if overlap == 0 {
+			return "", fmt.Errorf("oligo %d doesn't overlap oligo %d by at least %d bases", index+2, index+1, minOverlap)
+		}
+		product += next[overlap:]
+	}
+	return product, nil
+}
+
+// topStrand returns oligo as it reads on the top strand.
+func topStrand(oligo Oligo) string {
+	if oligo.TopStrand {
+		return oligo.Sequence
+	}
+	return transform.ReverseComplement(oligo.Sequence)
+}
@@ -0,0 +1,172 @@
+package pca
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/TimothyStiles/poly/primers"
+	"github.com/TimothyStiles/poly/random"
+	"github.com/TimothyStiles/poly/transform"
+)
+
+func TestOligoPool(t *testing.T) {
+	gene, err := random.DNASequence(1000, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const oligoLength, target = 90, 60.0
+	oligos, err := OligoPool(gene, oligoLength, target, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assembled, err := Assemble(oligos, DefaultOptions.MinOverlap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assembled != gene {
+		t.Errorf("oligos assemble into %s, expected %s", assembled, gene)
+	}
+
+	var tms []float64
+	for index, oligo := range oligos {
+		if len(oligo.Sequence) > oligoLength {
+			t.Errorf("oligo %d is %d bases, longer than %d", index, len(oligo.Sequence), oligoLength)
+		}
+		if oligo.TopStrand != (index%2 == 0) {
+			t.Errorf("oligo %d should be on the other strand", index)
+		}
+		region := gene[oligo.Start:oligo.End]
+		if !oligo.TopStrand {
+			region = transform.ReverseComplement(region)
+		}
+		if oligo.Sequence != region {
+			t.Errorf("oligo %d is %s, expected %s", index, oligo.Sequence, region)
+		}
+		if index == len(oligos)-1 {
+			if oligo.OverlapTm != 0 {
+				t.Errorf("last oligo has an overlap Tm of %f", oligo.OverlapTm)
+			}
+			continue
+		}
+		overlap := gene[oligos[index+1].Start:oligo.End]
+		if tm := primers.MeltingTemp(overlap); math.Abs(tm-oligo.OverlapTm) > 1e-9 {
+			t.Errorf("oligo %d has an overlap Tm of %f, but its overlap %s melts at %f", index, oligo.OverlapTm, overlap, tm)
+		}
+		tms = append(tms, oligo.OverlapTm)
+	}
+
+	var mean, variance float64
+	for _, tm := range tms {
+		if math.Abs(tm-target) > DefaultOptions.TmTolerance {
+			t.Errorf("overlap Tm %f is more than %f from %f", tm, DefaultOptions.TmTolerance, target)
+		}
+		mean += tm / float64(len(tms))
+	}
+	for _, tm := range tms {
+		variance += (tm - mean) * (tm - mean) / float64(len(tms)-1)
+	}
+	if stdev := math.Sqrt(variance); stdev > 1.5 {
+		t.Errorf("overlap Tms have a standard deviation of %f, expected at most 1.5", stdev)
+	}
+
+	// 1000 bases can't be split into fewer oligos than this.
+	if minimum := int(math.Ceil(float64(1000-DefaultOptions.MinOverlap) / float64(oligoLength-DefaultOptions.MinOverlap))); len(oligos) < minimum {
+		t.Errorf("got %d oligos, fewer than the minimum of %d", len(oligos), minimum)
+	}
+}
+
+func TestOligoPoolShort(t *testing.T) {
+	oligos, err := OligoPool("atgaaacgcattagcaccaccattaccaccaccatcaccattaccacaggtaacggtgcgggctga", 90, 60, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oligos) != 1 || !oligos[0].TopStrand || oligos[0].Sequence != "ATGAAACGCATTAGCACCACCATTACCACCACCATCACCATTACCACAGGTAACGGTGCGGGCTGA" {
+		t.Errorf("expected a single top strand oligo, got %+v", oligos)
+	}
+}
+
+func TestOligoPoolHairpin(t *testing.T) {
+	// a strong hairpin in the middle of the first oligo.
+	gene, err := random.DNASequence(300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gene = gene[:20] + "GCGCGCGCGCGAAAGCGCGCGCGCGC" + gene[46:]
+	oligos, err := OligoPool(gene, 90, 60, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !oligos[0].Hairpin || oligos[0].HairpinEnergy >= DefaultOptions.MaxHairpinEnergy {
+		t.Errorf("expected the first oligo to have a hairpin, got %+v", oligos[0])
+	}
+}
+
+func TestOligoPoolErrors(t *testing.T) {
+	gene, err := random.DNASequence(500, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	narrow := DefaultOptions
+	narrow.MinOverlap, narrow.MaxOverlap = 15, 10
+	tests := []struct {
+		name      string
+		seq       string
+		length    int
+		target    float64
+		opts      Options
+		errSubstr string
+	}{
+		{"empty", "", 90, 60, DefaultOptions, "empty sequence"},
+		{"invalid base", "ATGCN", 90, 60, DefaultOptions, "invalid base 'N' at index 4"},
+		{"overlap range", gene, 90, 60, narrow, "not a valid range"},
+		{"short oligos", gene, 50, 60, DefaultOptions, "can't fit two overlaps"},
+		{"unreachable Tm", gene, 90, 95, DefaultOptions, "no split into oligos"},
+		{"repeat", strings.Repeat(gene[:100], 3), 90, 60, DefaultOptions, "no split into oligos"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := OligoPool(test.seq, test.length, test.target, test.opts)
+			if err == nil || !strings.Contains(err.Error(), test.errSubstr) {
+				t.Errorf("expected an error containing %q, got %v", test.errSubstr, err)
+			}
+		})
+	}
+}
+
+func TestOligoPoolConstraints(t *testing.T) {
+	gene, err := random.DNASequence(500, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions
+	opts.Constraints = primers.StandardSynthesis
+	oligos, err := OligoPool(gene, 90, 60, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for index, oligo := range oligos {
+		if len(oligo.Sequence) > primers.StandardSynthesis.MaxLength {
+			t.Errorf("oligo %d is %d bases, longer than %d", index+1, len(oligo.Sequence), primers.StandardSynthesis.MaxLength)
+		}
+	}
+
+	opts.Constraints = primers.OligoConstraints{FivePrimeBases: "N"}
+	_, err = OligoPool(gene, 90, 60, opts)
+	var violation primers.Violation
+	if !errors.As(err, &violation) || violation.Constraint != "FivePrimeBases" {
+		t.Errorf("expected a violation of FivePrimeBases, got %v", err)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	if _, err := Assemble(nil, 15); err == nil {
+		t.Error("expected an error assembling no oligos")
+	}
+	oligos := []Oligo{{Sequence: "ATGCATGCATGCATGCATGC", TopStrand: true}, {Sequence: "TTTTTTTTTTTTTTTTTTTT"}}
+	if _, err := Assemble(oligos, 15); err == nil || !strings.Contains(err.Error(), "oligo 2 doesn't overlap oligo 1") {
+		t.Errorf("expected an overlap error, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/TimothyStiles/poly/alphabet"
+)
+
+/******************************************************************************
+
+Sequence cleaning begins here
+
+Sequences pasted into a web form or a terminal are rarely just sequences.
+They come with the position numbers and spacing of a GenBank ORIGIN block,
+the header line of a FASTA file, Windows line endings, or whatever else was
+selected along with them. CleanSequence strips all of that and checks that
+what is left is actually a sequence, reporting what it removed so that a
+tool can tell its user.
+
+Digits and whitespace are always removed, along with the ORIGIN and //
+lines around a GenBank sequence and a FASTA header line at the start. Any
+other character not in the alphabet is an error, since guessing what a
+stray character was meant to be is worse than asking.
+
+******************************************************************************/
+
+// CleanRecord is one record of a pasted multi-record FASTA.
+type CleanRecord struct {
+	Header   string // Header is the record's header line, without the '>'.
+	Sequence string // Sequence is the record's cleaned sequence.
+}
+
+// InvalidCharacter is a character that isn't in the alphabet.
+type InvalidCharacter struct {
+	Character rune // Character is the invalid character.
+	Position  int  // Position is the byte offset of the character in the input, 0 indexed.
+}
+
+// CleanReport describes what CleanSequence removed from its input.
+type CleanReport struct {
+	Header     string             // Header is the FASTA header line removed from the start of the input, without the '>'.
+	Digits     int                // Digits is the number of digits removed, like GenBank position numbers.
+	Whitespace int                // Whitespace is the number of spaces, tabs and line endings removed.
+	Formatting int                // Formatting is the number of characters removed with header, ORIGIN and // lines.
+	Invalid    []InvalidCharacter // Invalid are the characters not in the alphabet.
+	Records    []CleanRecord      // Records are the records of a multi-record FASTA, if AllowMultipleRecords was given.
+}
+
+// CleanOption changes how CleanSequence cleans sequences.
+type CleanOption func(*cleanOptions)
+
+type cleanOptions struct {
+	preserveCase    bool
+	multipleRecords bool
+}
+
+// PreserveCase keeps the case of the input instead of uppercasing it.
+func PreserveCase() CleanOption {
+	return func(options *cleanOptions) {
+		options.preserveCase = true
+	}
+}
+
+// AllowMultipleRecords accepts a pasted FASTA with more than one record. Each
+// record is returned in CleanReport.Records, and CleanSequence returns the
+// sequence of the first one.
+func AllowMultipleRecords() CleanOption {
+	return func(options *cleanOptions) {
+		options.multipleRecords = true
+	}
+}
+
+// CleanSequence removes digits, whitespace, GenBank ORIGIN formatting and a
+// FASTA header line from input and returns the uppercased sequence left,
+// along with a report of what was removed. Letters are checked against
+// alphabet, case insensitively, and a nil alphabet accepts any letter.
+//
+// An error is returned, along with the positions of the offending characters
+// in the report, if any character isn't in the alphabet. Input with more
+// than one FASTA record is an error unless AllowMultipleRecords is given.
+func CleanSequence(input string, alphabet *alphabet.Alphabet, options ...CleanOption) (string, CleanReport, error) {
+	var settings cleanOptions
+	for _, option := range options {
+		option(&settings)
+	}
+
+	var report CleanReport
+	var records []CleanRecord
+	var sequence strings.Builder
+	header, inRecord := "", false
+	endRecord := func() {
+		if inRecord || sequence.Len() > 0 {
+			records = append(records, CleanRecord{Header: header, Sequence: sequence.String()})
+		}
+		sequence.Reset()
+	}
+
+	position := 0
+	for _, line := range strings.SplitAfter(input, "\n") {
+		lineStart := position
+		position += len(line)
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, ">"):
+			endRecord()
+			header, inRecord = strings.TrimSpace(trimmed[1:]), true
+			report.Formatting += len(trimmed)
+			report.Whitespace += len(line) - len(trimmed)
+			continue
+		case strings.HasPrefix(trimmed, "ORIGIN"), trimmed == "//":
+			report.Formatting += len(trimmed)
+			report.Whitespace += len(line) - len(trimmed)
+			continue
+		}
+		for offset, character := range line {
+			switch {
+			case unicode.IsSpace(character):
+				report.Whitespace++
+			case unicode.IsDigit(character):
+				report.Digits++
+			case !inAlphabet(alphabet, character):
+				report.Invalid = append(report.Invalid, InvalidCharacter{Character: character, Position: lineStart + offset})
+			case settings.preserveCase:
+				sequence.WriteRune(character)
+			default:
+				sequence.WriteRune(unicode.ToUpper(character))
+			}
+		}
+	}
+	endRecord()
+
+	if len(records) > 0 {
+		report.Header = records[0].Header
+	}
+	if len(records) > 1 {
+		if !settings.multipleRecords {
+			return "", report, fmt.Errorf("input has %d FASTA records, expected 1", len(records))
+		}
+		report.Records = records
+	}
+	if len(report.Invalid) > 0 {
+		first := report.Invalid[0]
+		return "", report, fmt.Errorf("input has %d characters not in the alphabet, the first is %q at position %d", len(report.Invalid), first.Character, first.Position)
+	}
+	if len(records) == 0 {
+		return "", report, nil
+	}
+	return records[0].Sequence, report, nil
+}
+
+// inAlphabet returns true if character is in alphabet, ignoring case. Every
+// letter is in a nil alphabet.
+func inAlphabet(alphabet *alphabet.Alphabet, character rune) bool {
+	if alphabet == nil {
+		return unicode.IsLetter(character)
+	}
+	_, err := alphabet.Encode(string(unicode.ToUpper(character)))
+	return err == nil
+}
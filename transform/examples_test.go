@@ -3,6 +3,8 @@ package transform_test
 import (
 	"fmt"
 
+	"github.com/TimothyStiles/poly/alphabet"
+	"github.com/TimothyStiles/poly/fold"
 	"github.com/TimothyStiles/poly/transform"
 )
 
@@ -29,3 +31,38 @@ func ExampleReverse() {
 
 	// Output: ACATTAG
 }
+
+func ExampleIUPACToRegexp() {
+	pattern, _ := transform.IUPACToRegexp("GCNTAY")
+	fmt.Println(pattern.FindAllString("ttGCATACgctgcttat", -1))
+
+	// Output: [GCATAC gcttat]
+}
+
+func ExampleCleanSequence() {
+	pasted := `>my gene
+ORIGIN
+        1 atgaaagcaa ttttcgtact gaaaggttgg
+//`
+	sequence, report, _ := transform.CleanSequence(pasted, alphabet.DNA)
+	fmt.Println(sequence, report.Header)
+
+	// Output: ATGAAAGCAATTTTCGTACTGAAAGGTTGG my gene
+}
+
+func ExampleShufflePreservingKmers() {
+	// a hairpin folds far more stably than shuffles of itself with the same
+	// dinucleotides, so its structure is unlikely to be chance.
+	hairpin := "GGGAGCGCAAGCCGCTTCGGCGGCTTGCGCTCCCAAAA"
+	folded, _ := fold.Zuker(hairpin, 37)
+
+	shuffledEnergy := 0.0
+	for seed := int64(0); seed < 10; seed++ {
+		shuffled, _ := transform.ShufflePreservingKmers(hairpin, 2, seed)
+		result, _ := fold.Zuker(shuffled, 37)
+		shuffledEnergy += result.MinimumFreeEnergy() / 10
+	}
+	fmt.Println(folded.MinimumFreeEnergy() < shuffledEnergy-5)
+
+	// Output: true
+}
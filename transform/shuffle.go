@@ -0,0 +1,163 @@
+package transform
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+/******************************************************************************
+
+k-mer preserving shuffles begin here
+
+To tell whether a motif or a fold is interesting you need something to compare
+it against, and the usual baseline is the same sequence shuffled. A plain
+shuffle keeps the base composition but destroys everything else, including
+the dinucleotide stacking that dominates folding energies, which makes real
+sequences look far more special than they are. Shuffles that keep every k-mer
+count intact are a much fairer baseline.
+
+For k = 2 the shuffle is the Euler path algorithm of Altschul and Erickson
+(1985, doi:10.1093/oxfordjournals.molbev.a040370). Think of every base as a
+node and every dinucleotide as an edge, so the sequence is a walk using every
+edge once. Any other walk using every edge once, starting and ending at the
+same bases, has the same dinucleotides, and picking the last edge out of each
+node from a random spanning tree makes the walk uniformly random.
+
+For k > 2 a swap based Markov chain is used. If a sequence looks like
+
+	A u X v B u Y v C
+
+where u and v are (k-1)-mers, swapping uX and uY gives
+
+	A u Y v B u X v C
+
+which has the exact same k-mers, since every k-mer crossing a boundary of a
+swapped segment only sees u or v on the other side. Doing enough random swaps
+scrambles the sequence.
+
+******************************************************************************/
+
+// ShufflePreservingKmers returns a random shuffle of seq with the same count
+// of every k-mer, along with the same first and last k-1 bases. The shuffle
+// is deterministic for a given seed. Sequences with only one arrangement of
+// their k-mers, like homopolymers, are returned unchanged.
+func ShufflePreservingKmers(seq string, k int, seed int64) (string, error) {
+	if k < 1 {
+		return "", fmt.Errorf("k must be at least 1, got %d", k)
+	}
+	random := rand.New(rand.NewSource(seed))
+	switch {
+	case k >= len(seq):
+		return seq, nil
+	case k == 1:
+		shuffled := []byte(seq)
+		random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		return string(shuffled), nil
+	case k == 2:
+		return eulerShuffle(seq, random), nil
+	default:
+		return swapShuffle(seq, k, random), nil
+	}
+}
+
+// eulerShuffle is a dinucleotide preserving shuffle using a random Euler
+// path.
+func eulerShuffle(seq string, random *rand.Rand) string {
+	// edges[base] are the bases following each occurrence of base.
+	var edges [256][]byte
+	for index := 0; index+1 < len(seq); index++ {
+		edges[seq[index]] = append(edges[seq[index]], seq[index+1])
+	}
+
+	// pick the last edge out of every node with Wilson's algorithm, giving
+	// a random spanning tree pointing towards the last base.
+	last := seq[len(seq)-1]
+	var inTree [256]bool
+	var lastEdge [256]int
+	inTree[last] = true
+	for index := 0; index < len(seq); index++ {
+		for node := seq[index]; !inTree[node]; node = edges[node][lastEdge[node]] {
+			lastEdge[node] = random.Intn(len(edges[node]))
+		}
+		for node := seq[index]; !inTree[node]; node = edges[node][lastEdge[node]] {
+			inTree[node] = true
+		}
+	}
+
+	// shuffle every other edge and walk.
+	for node := range edges {
+		nodeEdges := edges[node]
+		if len(nodeEdges) == 0 {
+			continue
+		}
+		if byte(node) != last {
+			final := len(nodeEdges) - 1
+			nodeEdges[lastEdge[node]], nodeEdges[final] = nodeEdges[final], nodeEdges[lastEdge[node]]
+			nodeEdges = nodeEdges[:final]
+		}
+		random.Shuffle(len(nodeEdges), func(i, j int) { nodeEdges[i], nodeEdges[j] = nodeEdges[j], nodeEdges[i] })
+	}
+	shuffled := make([]byte, 1, len(seq))
+	shuffled[0] = seq[0]
+	var used [256]int
+	for len(shuffled) < len(seq) {
+		node := shuffled[len(shuffled)-1]
+		shuffled = append(shuffled, edges[node][used[node]])
+		used[node]++
+	}
+	return string(shuffled)
+}
+
+// swapShuffle is a k-mer preserving shuffle made of random swaps of segments
+// bounded by the same (k-1)-mers.
+func swapShuffle(seq string, k int, random *rand.Rand) string {
+	shuffled := []byte(seq)
+	word := k - 1
+	positions := wordPositions(shuffled, word)
+
+	// each attempt looks for segments starting with the same word at i and j
+	// and ending right before the same word at p and q, with i < p <= j < q.
+	attempts := 20 * len(seq)
+	for attempt := 0; attempt < attempts; attempt++ {
+		i := random.Intn(len(shuffled) - word + 1)
+		sameStart := positions[string(shuffled[i:i+word])]
+		j := sameStart[random.Intn(len(sameStart))]
+		if j <= i {
+			continue
+		}
+		p := i + 1 + random.Intn(j-i)
+		if p+word > len(shuffled) {
+			continue
+		}
+		var ends []int
+		for _, candidate := range positions[string(shuffled[p:p+word])] {
+			if candidate > j {
+				ends = append(ends, candidate)
+			}
+		}
+		if len(ends) == 0 {
+			continue
+		}
+		q := ends[random.Intn(len(ends))]
+
+		swapped := make([]byte, 0, len(shuffled))
+		swapped = append(swapped, shuffled[:i]...)
+		swapped = append(swapped, shuffled[j:q]...)
+		swapped = append(swapped, shuffled[p:j]...)
+		swapped = append(swapped, shuffled[i:p]...)
+		swapped = append(swapped, shuffled[q:]...)
+		shuffled = swapped
+		positions = wordPositions(shuffled, word)
+	}
+	return string(shuffled)
+}
+
+// wordPositions indexes where every word of length word starts in seq.
+func wordPositions(seq []byte, word int) map[string][]int {
+	positions := make(map[string][]int)
+	for index := 0; index+word <= len(seq); index++ {
+		key := string(seq[index : index+word])
+		positions[key] = append(positions[key], index)
+	}
+	return positions
+}
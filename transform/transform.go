@@ -3,7 +3,12 @@ Package transform provides functions for transforming sequences.
 */
 package transform
 
-import "unsafe"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unsafe"
+)
 
 // ReverseComplement returns the reversed complement of sequence.
 // It is the equivalent of calling
@@ -199,3 +204,45 @@ var complementTableRNA = [256]byte{
 	'y': 'r',
 	'x': 'x',
 }
+
+// iupacRegexpTable maps each IUPAC nucleotide code to the character class
+// of the bases it stands for.
+// see https://www.bioinformatics.org/sms/iupac.html
+var iupacRegexpTable = map[rune]string{
+	'A': "A",
+	'C': "C",
+	'G': "G",
+	'T': "T",
+	'U': "U",
+	'R': "[AG]",
+	'Y': "[CT]",
+	'S': "[CG]",
+	'W': "[AT]",
+	'K': "[GT]",
+	'M': "[AC]",
+	'B': "[CGT]",
+	'D': "[AGT]",
+	'H': "[ACT]",
+	'V': "[ACG]",
+	'N': "[ACGT]",
+}
+
+// IUPACToRegexp converts a sequence containing IUPAC ambiguity codes into a
+// regular expression matching every concrete DNA sequence the ambiguous
+// sequence can represent. For example, "GCN" becomes "GC[ACGT]".
+//
+// Matching is case insensitive so the returned expression can be run
+// directly against mixed case sequences, such as those read from genbank
+// files. An error is returned if sequence contains a non-IUPAC character.
+func IUPACToRegexp(sequence string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("(?i)")
+	for index, base := range strings.ToUpper(sequence) {
+		class, ok := iupacRegexpTable[base]
+		if !ok {
+			return nil, fmt.Errorf("invalid IUPAC code %q at position %d", base, index)
+		}
+		pattern.WriteString(class)
+	}
+	return regexp.Compile(pattern.String())
+}
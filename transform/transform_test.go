@@ -2,8 +2,11 @@ package transform
 
 import (
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/TimothyStiles/poly/alphabet"
 	"github.com/TimothyStiles/poly/random"
 )
 
@@ -164,3 +167,132 @@ func TestReverseComplementRNA(t *testing.T) {
 		}
 	}
 }
+
+func TestIUPACToRegexp(t *testing.T) {
+	pattern, err := IUPACToRegexp("ARN")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, match := range []string{"AAA", "AGT", "agc"} {
+		if !pattern.MatchString(match) {
+			t.Errorf("expected %q to match %q", pattern, match)
+		}
+	}
+	for _, nonMatch := range []string{"ACA", "TGT"} {
+		if pattern.MatchString(nonMatch) {
+			t.Errorf("expected %q to not match %q", pattern, nonMatch)
+		}
+	}
+
+	if _, err := IUPACToRegexp("AC!"); err == nil {
+		t.Errorf("expected error for invalid IUPAC code")
+	}
+}
+
+func kmerCounts(seq string, k int) map[string]int {
+	counts := make(map[string]int)
+	for index := 0; index+k <= len(seq); index++ {
+		counts[seq[index:index+k]]++
+	}
+	return counts
+}
+
+func TestShufflePreservingKmers(t *testing.T) {
+	seq, _ := random.DNASequence(300, 7)
+	for _, k := range []int{1, 2, 3, 4} {
+		shuffled, err := ShufflePreservingKmers(seq, k, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shuffled == seq {
+			t.Errorf("k=%d: shuffled sequence should differ", k)
+		}
+		if !reflect.DeepEqual(kmerCounts(seq, k), kmerCounts(shuffled, k)) {
+			t.Errorf("k=%d: k-mer counts differ", k)
+		}
+		again, _ := ShufflePreservingKmers(seq, k, 42)
+		if again != shuffled {
+			t.Errorf("k=%d: shuffle should be deterministic for a seed", k)
+		}
+		other, _ := ShufflePreservingKmers(seq, k, 43)
+		if other == shuffled {
+			t.Errorf("k=%d: different seeds should give different shuffles", k)
+		}
+	}
+
+	for _, seq := range []string{"AAAAAA", "ACGT", "A"} {
+		if shuffled, _ := ShufflePreservingKmers(seq, 2, 1); shuffled != seq {
+			t.Errorf("%s has only one arrangement, got %s", seq, shuffled)
+		}
+	}
+	if _, err := ShufflePreservingKmers(seq, 0, 1); err == nil {
+		t.Errorf("k=0 should fail")
+	}
+}
+
+func TestCleanSequenceGenbankOrigin(t *testing.T) {
+	origin := `ORIGIN
+        1 gatcctccat atacaacggt atctccacct caggtttaga tctcaacaac ggaaccattg
+       61 ccgacatgag acagttaggt atcgtcgaga
+//
+`
+	sequence, report, err := CleanSequence(origin, alphabet.DNA)
+	if err != nil {
+		t.Fatalf("Failed to clean ORIGIN block: %s", err)
+	}
+	expected := "GATCCTCCATATACAACGGTATCTCCACCTCAGGTTTAGATCTCAACAACGGAACCATTGCCGACATGAGACAGTTAGGTATCGTCGAGA"
+	if sequence != expected {
+		t.Errorf("Expected %s, got %s", expected, sequence)
+	}
+	if report.Digits != 3 || report.Formatting != len("ORIGIN//") || report.Header != "" {
+		t.Errorf("Expected 3 digits and the ORIGIN and // lines removed, got %+v", report)
+	}
+	if nonWhitespace := len(strings.Join(strings.Fields(origin), "")); report.Whitespace != len(origin)-nonWhitespace {
+		t.Errorf("Expected %d whitespace characters removed, got %d", len(origin)-nonWhitespace, report.Whitespace)
+	}
+
+	if lower, _, _ := CleanSequence(origin, alphabet.DNA, PreserveCase()); lower != strings.ToLower(expected) {
+		t.Errorf("Expected case to be preserved, got %s", lower)
+	}
+}
+
+func TestCleanSequenceFastaWindowsLineEndings(t *testing.T) {
+	input := ">pUC19 fragment\r\nATGCAT\r\nGGCC\r\n"
+	sequence, report, err := CleanSequence(input, alphabet.DNA)
+	if err != nil {
+		t.Fatalf("Failed to clean FASTA: %s", err)
+	}
+	if sequence != "ATGCATGGCC" || report.Header != "pUC19 fragment" || report.Whitespace != 6 {
+		t.Errorf("Expected sequence ATGCATGGCC with header and 6 whitespace characters removed, got %s and %+v", sequence, report)
+	}
+
+	multiple := input + ">second\r\nTTTT\r\n"
+	if _, _, err = CleanSequence(multiple, alphabet.DNA); err == nil {
+		t.Error("Expected an error for a multi-record FASTA")
+	}
+	sequence, report, err = CleanSequence(multiple, alphabet.DNA, AllowMultipleRecords())
+	if err != nil {
+		t.Fatalf("Failed to clean multi-record FASTA: %s", err)
+	}
+	expected := []CleanRecord{{Header: "pUC19 fragment", Sequence: "ATGCATGGCC"}, {Header: "second", Sequence: "TTTT"}}
+	if sequence != "ATGCATGGCC" || !reflect.DeepEqual(report.Records, expected) {
+		t.Errorf("Expected records %v, got %s and %v", expected, sequence, report.Records)
+	}
+}
+
+func TestCleanSequenceInvalidCharacter(t *testing.T) {
+	_, report, err := CleanSequence("ATG CAT\nGGJCC", alphabet.DNA)
+	if err == nil {
+		t.Fatal("Expected an error for a character not in the alphabet")
+	}
+	if expected := []InvalidCharacter{{Character: 'J', Position: 10}}; !reflect.DeepEqual(report.Invalid, expected) {
+		t.Errorf("Expected invalid characters %v, got %v", expected, report.Invalid)
+	}
+	// U is fine for RNA, and anything goes without an alphabet.
+	if sequence, _, err := CleanSequence("augc", alphabet.RNA); err != nil || sequence != "AUGC" {
+		t.Errorf("Expected AUGC, got %s and %v", sequence, err)
+	}
+	if sequence, _, err := CleanSequence("MKV*", nil); err == nil {
+		t.Errorf("Expected an error for a non letter without an alphabet, got %s", sequence)
+	}
+}